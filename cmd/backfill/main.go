@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/storage"
+)
+
+func main() {
+	var (
+		dataDir = flag.String("data-dir", "data", "Directory containing stations_*.tsv files to upload")
+		dryRun  = flag.Bool("dry-run", false, "Validate files and report what would be uploaded without uploading")
+	)
+	flag.Parse()
+
+	cfg, err := config.LoadR2Config()
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	store, err := storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, cfg.BucketName, cfg.Region, cfg.Prefix)
+	if err != nil {
+		log.Fatalf("Failed to initialize R2 storage: %v", err)
+	}
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot keys: %v", err)
+	}
+	store.SetEncryption(keys)
+
+	files, err := storage.FindSnapshotFiles(*dataDir)
+	if err != nil {
+		log.Fatalf("Failed to find snapshots: %v", err)
+	}
+
+	log.Printf("Found %d snapshot files in %s (bucket=%s, dry-run=%v)", len(files), *dataDir, cfg.BucketName, *dryRun)
+
+	ctx := context.Background()
+	var uploaded, skipped, failed int
+	for _, file := range files {
+		result, err := store.BackfillFile(ctx, file, *dryRun)
+		if err != nil {
+			log.Printf("FAILED %s: %v", file, err)
+			failed++
+			continue
+		}
+		if result.Skipped {
+			skipped++
+			continue
+		}
+		if *dryRun {
+			log.Printf("Would upload %s -> %s (%d stations)", file, result.Key, result.Stations)
+		} else {
+			log.Printf("Uploaded %s -> %s (%d stations)", file, result.Key, result.Stations)
+		}
+		uploaded++
+	}
+
+	log.Printf("Backfill complete: uploaded=%d skipped=%d failed=%d", uploaded, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// runBackfill uploads local snapshot files to R2, skipping those already there.
+func runBackfill(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("backfill", "<dir>")
+	store.register(fs)
+	dryRun := fs.Bool("dry-run", false, "Validate files and report what would be uploaded without uploading")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	s, err := store.open()
+	if err != nil {
+		return err
+	}
+	r2, ok := s.(*storage.R2Storage)
+	if !ok {
+		return fmt.Errorf("backfill uploads to R2; pass -r2")
+	}
+	files, err := storage.FindSnapshotFiles(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Found %d snapshot files in %s (dry-run=%v)", len(files), fs.Arg(0), *dryRun)
+	var uploaded, skipped, failed int
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := r2.BackfillFile(ctx, file, *dryRun)
+		if err != nil {
+			log.Printf("FAILED %s: %v", file, err)
+			failed++
+			continue
+		}
+		if result.Skipped {
+			skipped++
+			continue
+		}
+		if *dryRun {
+			log.Printf("Would upload %s -> %s (%d stations)", file, result.Key, result.Stations)
+		} else {
+			log.Printf("Uploaded %s -> %s (%d stations)", file, result.Key, result.Stations)
+		}
+		uploaded++
+	}
+	log.Printf("Backfill complete: uploaded=%d skipped=%d failed=%d", uploaded, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
+
+// runPrune deletes every snapshot taken before a cutoff.
+func runPrune(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("prune", "")
+	store.register(fs)
+	beforeFlag := fs.String("before", "", "Delete snapshots taken before this time (RFC 3339 or YYYY-MM-DD)")
+	olderThan := fs.String("older-than", "", "Delete snapshots older than this age, e.g. 90d or 720h")
+	dryRun := fs.Bool("dry-run", false, "List what would be deleted without deleting")
+	yes := fs.Bool("yes", false, "Delete without asking for confirmation")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	var cutoff time.Time
+	switch {
+	case *beforeFlag != "" && *olderThan != "":
+		return errors.New("-before and -older-than cannot be combined")
+	case *beforeFlag != "":
+		t, err := parseTime("before", *beforeFlag)
+		if err != nil {
+			return err
+		}
+		cutoff = t
+	case *olderThan != "":
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			return err
+		}
+		cutoff = time.Now().UTC().Add(-age)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	mgr, err := store.openManager()
+	if err != nil {
+		return err
+	}
+	keys, err := mgr.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	var doomed []string
+	for _, key := range keys {
+		if ts, err := storage.SnapshotTime(key); err == nil && ts.Before(cutoff) {
+			doomed = append(doomed, key)
+		}
+	}
+
+	fmt.Printf("%d of %d snapshots were taken before %s\n", len(doomed), len(keys), cutoff.Format(time.RFC3339))
+	if len(doomed) == 0 {
+		return nil
+	}
+	if *dryRun {
+		for _, key := range doomed {
+			fmt.Printf("Would delete %s\n", key)
+		}
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete %d snapshots?", len(doomed))) {
+		return errors.New("aborted")
+	}
+	return deleteSnapshots(ctx, mgr, doomed)
+}
+
+// parseAge parses a Go duration, additionally accepting a whole number of days such as 90d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid -older-than %q (expected e.g. 90d or 720h)", s)
+}
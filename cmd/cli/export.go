@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"city-cycling/internal/export"
+	"city-cycling/internal/storage"
+)
+
+// runExport writes every snapshot in a time range to stdout or a file.
+func runExport(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("export", "")
+	store.register(fs)
+	fromFlag := fs.String("from", "", "Start of the range (RFC 3339 or YYYY-MM-DD; default: the first snapshot)")
+	toFlag := fs.String("to", "", "End of the range (RFC 3339 or YYYY-MM-DD; default: now)")
+	format := fs.String("format", "tsv", "Output format: tsv (the snapshot format under one header), jsonl (one JSON object per station reading) or sqlite (an indexed database; needs -o)")
+	station := fs.Int("station", 0, "Only export this station ID (0: all stations)")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *format != "tsv" && *format != "jsonl" && *format != "sqlite" {
+		return fmt.Errorf("invalid -format %q (expected tsv, jsonl or sqlite)", *format)
+	}
+	if *format == "sqlite" && (*output == "" || *station != 0) {
+		return fmt.Errorf("-format sqlite needs -o and exports every station")
+	}
+	from, err := parseTime("from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime("to", *toFlag)
+	if err != nil {
+		return err
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+
+	s, err := store.open()
+	if err != nil {
+		return err
+	}
+	rangeStore, ok := s.(storage.RangeDataStore)
+	if !ok {
+		return fmt.Errorf("storage backend does not support range reads")
+	}
+
+	if *format == "sqlite" {
+		metadata := map[string]string{}
+		if store.root != "" {
+			metadata["root"] = store.root
+		}
+		stats, err := export.WriteSQLite(ctx, *output, rangeStore, from, to, metadata)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d rows from %d snapshots of %d stations to %s\n", stats.Rows, stats.Snapshots, stats.Stations, *output)
+		return nil
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	stats, err := export.WriteRows(ctx, out, rangeStore, from, to, export.Format(*format), *station)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d rows from %d snapshots\n", stats.Rows, stats.Snapshots)
+	return nil
+}
@@ -0,0 +1,215 @@
+// Command citycycling operates a snapshot archive on any storage backend:
+// listing, inspecting, verifying, exporting, backfilling and pruning snapshots
+// without one-off programs against the internal packages.
+//
+// Usage:
+//
+//	citycycling <command> [subcommand] [flags] [args]
+//
+// Run citycycling help for the list of commands.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/storage"
+)
+
+// errUsage reports a command line error; the command's usage has already been printed.
+var errUsage = errors.New("invalid usage")
+
+// command is one citycycling command. Commands with subcommands dispatch
+// to them from run.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// commands returns every top-level command in the order help lists them.
+func commands() []command {
+	return []command{
+		{"snapshots", "List, inspect, delete or verify individual snapshots", runSnapshots},
+		{"export", "Write the snapshots in a time range as TSV, JSON lines or SQLite", runExport},
+		{"stats", "Summarize the archive, or one station's occupancy", runStats},
+		{"backfill", "Upload local snapshot files to R2", runBackfill},
+		{"prune", "Delete snapshots older than a cutoff", runPrune},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		return
+	}
+	for _, c := range commands() {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(ctx, os.Args[2:]); err != nil {
+			if !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(os.Stderr, "citycycling %s: %v\n", c.name, err)
+			}
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "citycycling: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+// usage prints the list of commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: citycycling <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nStorage flags, accepted by every command:")
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	(&storeFlags{}).register(fs)
+	fs.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nRun citycycling <command> -h for a command's own flags.")
+}
+
+// newFlagSet returns a flag set for a command whose usage line is "citycycling name args".
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: citycycling %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args into fs, mapping parse errors to errUsage.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// storeFlags selects the storage backend a command operates on.
+type storeFlags struct {
+	dataDir string
+	r2      bool
+	azure   bool
+	root    string
+}
+
+// register adds the storage flags to fs.
+func (f *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.dataDir, "data-dir", "data", "Directory containing TSV data files (local mode only)")
+	fs.BoolVar(&f.r2, "r2", false, "Use Cloudflare R2 (configured from S3_* variables) instead of local files")
+	fs.BoolVar(&f.azure, "azure", false, "Use Azure Blob Storage (configured from AZURE_STORAGE_* variables) instead of local files")
+	fs.StringVar(&f.root, "root", "", "Key prefix of the city to operate on, e.g. \"manchester/\" (default: the unprefixed city)")
+}
+
+// open returns the selected store.
+func (f *storeFlags) open() (storage.DataStore, error) {
+	var base storage.DataStore
+	switch {
+	case f.azure:
+		cfg, err := config.LoadAzureConfig()
+		if err != nil {
+			return nil, fmt.Errorf("configuration error: %w", err)
+		}
+		base, err = storage.NewAzureBlobStorage(cfg.ConnectionString, cfg.AccountURL, cfg.Container, cfg.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Azure storage: %w", err)
+		}
+	case f.r2:
+		cfg, err := config.LoadR2Config()
+		if err != nil {
+			return nil, fmt.Errorf("configuration error: %w", err)
+		}
+		base, err = storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, cfg.BucketName, cfg.Region, cfg.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize R2 storage: %w", err)
+		}
+	default:
+		base = storage.NewTSVStorage(f.dataDir)
+	}
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.SetEncryption(base, keys); err != nil {
+		return nil, err
+	}
+	return storage.WithRoot(base, f.root)
+}
+
+// openManager returns the selected store as a storage.SnapshotManager.
+func (f *storeFlags) openManager() (storage.SnapshotManager, error) {
+	store, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	mgr, ok := store.(storage.SnapshotManager)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not support managing snapshots")
+	}
+	return mgr, nil
+}
+
+// parseTime parses a -from or -to flag: RFC 3339, or a YYYY-MM-DD date in UTC.
+func parseTime(name, v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q (expected RFC 3339 or YYYY-MM-DD)", name, v)
+	}
+	return t, nil
+}
+
+// snapshotRef resolves a snapshot given on the command line, either its file
+// name (stations_20260205_145000.tsv) or an RFC 3339 timestamp, to its key.
+func snapshotRef(mgr storage.SnapshotManager, arg string) (string, error) {
+	if storage.ValidSnapshotName(arg) {
+		ts, err := storage.SnapshotTime(arg)
+		if err != nil {
+			return "", err
+		}
+		return mgr.SnapshotKey(ts), nil
+	}
+	if ts, err := time.Parse(time.RFC3339, arg); err == nil {
+		return mgr.SnapshotKey(ts), nil
+	}
+	return "", fmt.Errorf("invalid snapshot %q (expected stations_YYYYMMDD_HHMMSS.tsv or an RFC 3339 time)", arg)
+}
+
+// confirm asks the user a yes/no question on the terminal.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/storage"
+)
+
+// snapshotCommands are the subcommands of citycycling snapshots.
+var snapshotCommands = []command{
+	{"list", "List snapshots, newest first", runSnapshotsList},
+	{"get", "Re-read a snapshot and report its checksum, annotations and malformed rows", runSnapshotsGet},
+	{"delete", "Delete snapshots", runSnapshotsDelete},
+	{"verify", "Check snapshots against their recorded checksums", runSnapshotsVerify},
+	{"migrate", "Move object store snapshots to the date-hierarchy key layout", runSnapshotsMigrate},
+	{"rekey", "Re-encrypt snapshots with the current SNAPSHOT_KEYS key", runSnapshotsRekey},
+}
+
+// runSnapshots dispatches to a snapshots subcommand.
+func runSnapshots(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		for _, c := range snapshotCommands {
+			if c.name == args[0] {
+				return c.run(ctx, args[1:])
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Unknown snapshots subcommand %q\n\n", args[0])
+	}
+	fmt.Fprintln(os.Stderr, "Usage: citycycling snapshots <subcommand> [flags] [args]\n\nSubcommands:")
+	for _, c := range snapshotCommands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	return errUsage
+}
+
+// runSnapshotsList prints the snapshots in a time range.
+func runSnapshotsList(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("snapshots list", "")
+	store.register(fs)
+	fromFlag := fs.String("from", "", "Only snapshots at or after this time (RFC 3339 or YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "Only snapshots at or before this time (RFC 3339 or YYYY-MM-DD)")
+	limit := fs.Int("limit", 0, "Print at most this many snapshots (0: all)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	from, err := parseTime("from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime("to", *toFlag)
+	if err != nil {
+		return err
+	}
+
+	mgr, err := store.openManager()
+	if err != nil {
+		return err
+	}
+	var keys []string
+	if !from.IsZero() && !to.IsZero() {
+		keys, err = mgr.ListSnapshotsRange(ctx, from, to)
+	} else {
+		keys, err = mgr.ListSnapshots(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	n := 0
+	for _, key := range keys {
+		ts, err := storage.SnapshotTime(key)
+		if err != nil || (!from.IsZero() && ts.Before(from)) || (!to.IsZero() && ts.After(to)) {
+			continue
+		}
+		if *limit > 0 && n == *limit {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\n", ts.Format(time.RFC3339), key)
+		n++
+	}
+	return w.Flush()
+}
+
+// runSnapshotsGet prints what re-reading one snapshot found.
+func runSnapshotsGet(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("snapshots get", "<snapshot>")
+	store.register(fs)
+	stations := fs.Bool("stations", false, "Also print the parsed stations as TSV")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	mgr, err := store.openManager()
+	if err != nil {
+		return err
+	}
+	key, err := snapshotRef(mgr, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	inspection, err := mgr.InspectSnapshot(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	ts, _ := storage.SnapshotTime(key)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Key:\t%s\n", inspection.Key)
+	fmt.Fprintf(w, "Timestamp:\t%s\n", ts.Format(time.RFC3339))
+	fmt.Fprintf(w, "Size:\t%d bytes\n", inspection.Size)
+	fmt.Fprintf(w, "Stations:\t%d\n", inspection.Parse.Rows)
+	fmt.Fprintf(w, "Checksum:\t%s\n", describeChecksum(inspection))
+	if inspection.Source != "" {
+		fmt.Fprintf(w, "Source:\t%s\n", inspection.Source)
+	}
+	if inspection.Validation != "" {
+		fmt.Fprintf(w, "Validation:\t%s\n", inspection.Validation)
+	}
+	fmt.Fprintf(w, "Malformed rows:\t%d\n", inspection.Parse.Malformed)
+	for _, l := range inspection.Parse.Lines {
+		fmt.Fprintf(w, "  line %d:\t%s\n", l.Line, l.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if *stations {
+		fmt.Println()
+		fmt.Println(storage.TSVHeader)
+		return storage.EncodeTSVRows(os.Stdout, ts, inspection.Stations)
+	}
+	return nil
+}
+
+// describeChecksum summarizes how a snapshot fared against its recorded checksum.
+func describeChecksum(inspection *storage.SnapshotInspection) string {
+	switch {
+	case inspection.Checksum == "":
+		return "none recorded"
+	case inspection.Verified:
+		return inspection.Checksum + " (verified)"
+	}
+	return inspection.Checksum + " (MISMATCH: " + inspection.VerifyError + ")"
+}
+
+// runSnapshotsDelete deletes the snapshots named on the command line.
+func runSnapshotsDelete(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("snapshots delete", "<snapshot>...")
+	store.register(fs)
+	yes := fs.Bool("yes", false, "Delete without asking for confirmation")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	mgr, err := store.openManager()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, fs.NArg())
+	for i, arg := range fs.Args() {
+		if keys[i], err = snapshotRef(mgr, arg); err != nil {
+			return err
+		}
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete %d snapshot(s)?", len(keys))) {
+		return errors.New("aborted")
+	}
+	return deleteSnapshots(ctx, mgr, keys)
+}
+
+// deleteSnapshots deletes keys, reporting each, and fails if any could not be deleted.
+func deleteSnapshots(ctx context.Context, mgr storage.SnapshotManager, keys []string) error {
+	failed := 0
+	for _, key := range keys {
+		if err := mgr.DeleteSnapshot(ctx, key); err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED %s: %v\n", key, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Deleted %s\n", key)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d snapshots could not be deleted", failed, len(keys))
+	}
+	return nil
+}
+
+// runSnapshotsVerify checks the named snapshots, or the whole archive, against
+// their recorded checksums.
+func runSnapshotsVerify(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("snapshots verify", "[snapshot...]")
+	store.register(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		s, err := store.open()
+		if err != nil {
+			return err
+		}
+		verifier, ok := s.(storage.IntegrityVerifier)
+		if !ok {
+			return fmt.Errorf("storage backend does not support verification")
+		}
+		report, err := verifier.VerifySnapshots(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Snapshots checked: %d\n", report.Checked)
+		fmt.Printf("Verified: %d\n", report.Verified)
+		fmt.Printf("Without checksum: %d\n", report.Unverified)
+		fmt.Printf("Failed: %d\n", len(report.Failures))
+		for _, f := range report.Failures {
+			fmt.Printf("  %s: %s\n", f.Key, f.Reason)
+		}
+		if len(report.Failures) > 0 {
+			return fmt.Errorf("%d snapshots failed verification", len(report.Failures))
+		}
+		return nil
+	}
+
+	mgr, err := store.openManager()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, arg := range fs.Args() {
+		key, err := snapshotRef(mgr, arg)
+		if err != nil {
+			return err
+		}
+		inspection, err := mgr.InspectSnapshot(ctx, key)
+		switch {
+		case err != nil:
+			fmt.Printf("FAILED   %s: %v\n", arg, err)
+			failed++
+		case inspection.VerifyError != "":
+			fmt.Printf("FAILED   %s: %s\n", arg, inspection.VerifyError)
+			failed++
+		case inspection.Verified:
+			fmt.Printf("OK       %s\n", arg)
+		default:
+			fmt.Printf("UNKNOWN  %s: no checksum recorded\n", arg)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d snapshots failed verification", failed)
+	}
+	return nil
+}
+
+// runSnapshotsMigrate moves snapshots stored under the flat key layout to the
+// date hierarchy.
+func runSnapshotsMigrate(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("snapshots migrate", "")
+	store.register(fs)
+	dryRun := fs.Bool("dry-run", false, "Print the snapshots that would move without moving them")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	s, err := store.open()
+	if err != nil {
+		return err
+	}
+	migrator, ok := s.(storage.KeyMigrator)
+	if !ok {
+		return fmt.Errorf("storage backend does not support key migration (local snapshots keep the flat layout)")
+	}
+
+	verb := "Moved"
+	if *dryRun {
+		verb = "Would move"
+	}
+	n := 0
+	err = migrator.MigrateSnapshotKeys(ctx, *dryRun, func(m storage.KeyMigration) {
+		fmt.Printf("%s %s -> %s\n", verb, m.From, m.To)
+		n++
+	})
+	fmt.Printf("%s %d snapshot(s)\n", verb, n)
+	return err
+}
+
+// runSnapshotsRekey re-encrypts the snapshots not encrypted with the current
+// key of SNAPSHOT_KEYS, plain ones included, so that old keys can be retired.
+func runSnapshotsRekey(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("snapshots rekey", "")
+	store.register(fs)
+	dryRun := fs.Bool("dry-run", false, "Print the snapshots that would be re-encrypted without rewriting them")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		return err
+	}
+	s, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	verb := "Re-encrypted"
+	if *dryRun {
+		verb = "Would re-encrypt"
+	}
+	n := 0
+	err = storage.RotateSnapshotKeys(ctx, s, keys, *dryRun, func(r storage.KeyRotation) {
+		from := r.From
+		if from == "" {
+			from = "(plain)"
+		}
+		fmt.Printf("%s %s: %s -> %s\n", verb, r.Key, from, keys.Current())
+		n++
+	})
+	fmt.Printf("%s %d snapshot(s)\n", verb, n)
+	return err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// runStats summarizes the archive, or with -station one station's occupancy.
+func runStats(ctx context.Context, args []string) error {
+	var store storeFlags
+	fs := newFlagSet("stats", "")
+	store.register(fs)
+	interval := fs.Duration("interval", 5*time.Minute, "Expected collector interval, for counting gaps")
+	station := fs.Int("station", 0, "Report occupancy statistics for this station ID instead")
+	fromFlag := fs.String("from", "", "Start of the -station window (RFC 3339 or YYYY-MM-DD; default: 7 days before -to)")
+	toFlag := fs.String("to", "", "End of the -station window (RFC 3339 or YYYY-MM-DD; default: now)")
+	timezone := fs.String("timezone", "Europe/London", "IANA time zone for -station hour-of-day buckets")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	s, err := store.open()
+	if err != nil {
+		return err
+	}
+	if *station != 0 {
+		to, err := parseTime("to", *toFlag)
+		if err != nil {
+			return err
+		}
+		if to.IsZero() {
+			to = time.Now().UTC()
+		}
+		from, err := parseTime("from", *fromFlag)
+		if err != nil {
+			return err
+		}
+		if from.IsZero() {
+			from = to.AddDate(0, 0, -7)
+		}
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return fmt.Errorf("invalid -timezone: %w", err)
+		}
+		return stationStats(ctx, s, *station, from, to, loc)
+	}
+
+	report, err := storage.GapReport(ctx, s, *interval)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Storage:\t%s\n", storage.BackendName(s))
+	fmt.Fprintf(w, "Snapshots:\t%d\n", report.SnapshotCount)
+	if report.SnapshotCount > 0 {
+		fmt.Fprintf(w, "Oldest:\t%s\n", report.First.Format(time.RFC3339))
+		fmt.Fprintf(w, "Newest:\t%s (%s ago)\n", report.Last.Format(time.RFC3339), time.Since(report.Last).Round(time.Second))
+		expected := int(report.Last.Sub(report.First)/report.ExpectedInterval) + 1
+		fmt.Fprintf(w, "Coverage:\t%.1f%% of %d expected at %s\n", 100*float64(report.SnapshotCount)/float64(max(expected, report.SnapshotCount)), expected, report.ExpectedInterval)
+		fmt.Fprintf(w, "Gaps:\t%d (%d missing snapshots)\n", len(report.Gaps), report.MissingCount)
+	}
+	return w.Flush()
+}
+
+// stationStats prints one station's occupancy statistics over [from, to].
+func stationStats(ctx context.Context, s storage.DataStore, stationID int, from, to time.Time, loc *time.Location) error {
+	rangeStore, ok := s.(storage.RangeDataStore)
+	if !ok {
+		return fmt.Errorf("storage backend does not support range reads")
+	}
+	samples, err := storage.StationSeries(ctx, rangeStore, stationID, from, to)
+	if err != nil {
+		return err
+	}
+	stats := storage.ComputeStationStats(stationID, from, to, samples, loc)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Station:\t%d\n", stats.StationID)
+	fmt.Fprintf(w, "Window:\t%s to %s\n", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	fmt.Fprintf(w, "Samples:\t%d\n", stats.SampleCount)
+	if stats.SampleCount > 0 {
+		fmt.Fprintf(w, "Average bikes:\t%.1f\n", stats.AvgBikes)
+		fmt.Fprintf(w, "Occupancy:\t%.1f%%\n", 100*stats.OccupancyRate)
+		fmt.Fprintf(w, "Empty:\t%.1f%% of samples\n", 100*stats.PctEmpty)
+		fmt.Fprintf(w, "Full:\t%.1f%% of samples\n", 100*stats.PctFull)
+		fmt.Fprintln(w, "Average bikes by hour:")
+		for hour, avg := range stats.AvgByHour {
+			if stats.HourSamples[hour] > 0 {
+				fmt.Fprintf(w, "  %02d:00\t%.1f\n", hour, avg)
+			}
+		}
+	}
+	return w.Flush()
+}
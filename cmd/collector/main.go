@@ -1,74 +1,332 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
-	"os"
+	"log/slog"
+	"net/http"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // so -schedule-tz works in minimal containers
 
+	"city-cycling/internal/alerts"
+	"city-cycling/internal/city"
+	"city-cycling/internal/collector"
+	"city-cycling/internal/config"
+	"city-cycling/internal/elevation"
+	"city-cycling/internal/events"
+	"city-cycling/internal/logging"
+	"city-cycling/internal/registry"
+	"city-cycling/internal/rollup"
 	"city-cycling/internal/storage"
+	"city-cycling/internal/stream"
+	"city-cycling/internal/telemetry"
 	"city-cycling/internal/tfl"
 )
 
 func main() {
+	logOpts := logging.AddFlags()
 	var (
-		dataDir  = flag.String("data-dir", "data", "Directory to store TSV files")
-		interval = flag.Duration("interval", 5*time.Minute, "Fetch interval (set to 0 for one-shot mode)")
-		oneShot  = flag.Bool("once", false, "Run once and exit")
+		dataDir    = flag.String("data-dir", "data", "Directory to store TSV files")
+		interval   = flag.Duration("interval", 5*time.Minute, "Fetch interval (set to 0 for one-shot mode)")
+		oneShot    = flag.Bool("once", false, "Run once and exit")
+		schedule   = flag.String("schedule", "", "Cron expression aligning fetches to wall-clock boundaries, e.g. \"*/5 * * * *\" (overrides -interval)")
+		scheduleTZ = flag.String("schedule-tz", "", "Time zone -schedule is evaluated in (default: each city's time zone, UTC without -cities)")
+		jitter     = flag.Duration("jitter", 0, "Delay each fetch by a random duration up to this much")
+		timeout    = flag.Duration("fetch-timeout", 0, "Give up on a feed fetch after this long (0: bounded only by the interval)")
+		elect      = flag.Bool("leader-election", false, "Coordinate with other replicas through a lease object so only one collects at a time")
+		replicaID  = flag.String("replica-id", collector.DefaultReplicaID(), "Name of this replica in the collector lease")
+		leaseTTL   = flag.Duration("lease-ttl", 0, "How long the collector lease lasts without renewal (0: twice the interval)")
+		heartbeat  = flag.String("heartbeat-url", "", "URL pinged after each successful collection, healthchecks.io style (<url>/fail on failure)")
+		heartbeatO = flag.Bool("heartbeat-object", false, "Record each successful collection in "+collector.HeartbeatKey)
+		metrics    = flag.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090 (disabled if empty)")
+		alertsPath = flag.String("alerts", "", "Path to an alerting rules JSON file, evaluated for the default city (disabled if empty)")
+		citiesPath = flag.String("cities", "", "JSON file of cities to collect, each in its own subdirectory (default: London only)")
+		feedType   = flag.String("feed", "", "Comma-separated sources for the built-in London city, in failover order: tfl (XML feed), bikepoint (Unified API, key from TFL_APP_KEY); default tfl")
+		validate   = flag.String("validate", "annotate", "What to do with a fetch that fails validation: reject, annotate or alert (annotate and notify the -alerts webhooks)")
+		minStation = flag.Int("min-stations", 1, "Fewest stations a valid fetch may have (0: no bound)")
+		maxStation = flag.Int("max-stations", 0, "Most stations a valid fetch may have (0: no bound)")
+		elevations = flag.String("elevation", "", "Record each station's elevation in the registry from open-meteo (the Open-Meteo API) or a CSV dataset of id or lat,lng and elevation (disabled if empty)")
+		eventLog   = flag.Bool("events", false, "Also store a log of per-station changes between consecutive snapshots under "+events.KeyPrefix)
+		streamURL  = flag.String("stream", "", "Also publish snapshot and per-station change events to nats://host:4222/<subject-prefix> (JetStream) or kafka://broker,.../<topic> (disabled if empty)")
+		rollups    = flag.Bool("rollups", false, "Also maintain hourly, daily and weekly rollups under "+rollup.KeyPrefix+", updated as each hour completes")
+		webhookURL = flag.String("webhook-url", "", "URL POSTed the key and summary of each snapshot written, signed with WEBHOOK_SECRET (disabled if empty)")
+		webhookN   = flag.Int("webhook-attempts", collector.DefaultWebhookAttempts, "How many times a snapshot webhook is tried before giving up")
+		webhookB   = flag.Duration("webhook-backoff", collector.DefaultWebhookBackoff, "Wait before the first webhook retry, doubling for each one after")
 	)
 	flag.Parse()
+	logOpts.MustApply()
 
-	client := tfl.NewClient()
-	store := storage.NewTSVStorage(*dataDir)
+	// Allow passing the heartbeat URL (which embeds a check token) via environment
+	if v, err := config.Secret("HEARTBEAT_URL"); err != nil {
+		log.Fatalf("Failed to load HEARTBEAT_URL: %v", err)
+	} else if v != "" {
+		*heartbeat = v
+	}
+	if v, err := config.Secret("WEBHOOK_URL"); err != nil {
+		log.Fatalf("Failed to load WEBHOOK_URL: %v", err)
+	} else if v != "" {
+		*webhookURL = v
+	}
+	webhookSecret, err := config.Secret("WEBHOOK_SECRET")
+	if err != nil {
+		log.Fatalf("Failed to load WEBHOOK_SECRET: %v", err)
+	}
 
-	// Perform initial fetch
-	if err := fetchAndStore(client, store); err != nil {
-		log.Fatalf("Initial fetch failed: %v", err)
+	cities, err := city.Load(*citiesPath, *feedType)
+	if err != nil {
+		log.Fatalf("Failed to load cities: %v", err)
+	}
+	var elevationSource elevation.Source
+	if *elevations != "" {
+		if elevationSource, err = elevation.NewSource(*elevations); err != nil {
+			log.Fatalf("Failed to set up elevations: %v", err)
+		}
+	}
+	policy, err := collector.ParseValidationPolicy(*validate)
+	if err != nil {
+		log.Fatalf("Invalid -validate: %v", err)
 	}
+	validation := collector.ValidationConfig{Policy: policy, MinStations: *minStation, MaxStations: *maxStation}
 
-	// If one-shot mode, exit after first fetch
-	if *oneShot || *interval == 0 {
-		log.Println("One-shot mode: exiting after single fetch")
-		return
+	shutdownTracing, err := telemetry.Setup(context.Background(), "city-cycling-collector")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
+	defer shutdownTracing(context.Background())
 
 	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	base := storage.NewTSVStorage(*dataDir)
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot keys: %v", err)
+	}
+	if keys != nil {
+		base.SetEncryption(keys)
+		slog.Info("Encrypting snapshots", "key", keys.Current())
+	}
+	var (
+		allMetrics     []*collector.Metrics
+		stationMetrics []*collector.StationMetrics
+		webhooks       []*collector.SnapshotWebhook
+	)
+	runs := make([]cityRun, len(cities))
+	var publisher stream.Publisher
+	if *streamURL != "" {
+		publisher, err = stream.Open(*streamURL, "city-cycling-collector")
+		if err != nil {
+			log.Fatalf("Failed to connect to event stream: %v", err)
+		}
+		defer publisher.Close()
+		slog.Info("Publishing events to stream", "url", stream.Redact(*streamURL))
+	}
 
-	ticker := time.NewTicker(*interval)
-	defer ticker.Stop()
+	for i, c := range cities {
+		rooted, err := storage.WithRoot(base, c.StoragePrefix)
+		if err != nil {
+			log.Fatalf("Failed to set up storage for %s: %v", c.ID, err)
+		}
+		store := rooted.(*storage.TSVStorage)
+		if _, err := store.QuarantinePartial(); err != nil {
+			log.Fatalf("Failed to scan for partial snapshots: %v", err)
+		}
+		logger := slog.Default()
+		if *citiesPath != "" {
+			logger = slog.With("city", c.ID)
+		}
 
-	log.Printf("Collector running with %v interval. Press Ctrl+C to stop.", *interval)
+		sched, err := parseSchedule(*schedule, *scheduleTZ, c, *citiesPath != "")
+		if err != nil {
+			log.Fatalf("Invalid schedule: %v", err)
+		}
+
+		col := collector.New(c.NewFeed(), store)
+		col.SetLogger(logger)
+		col.SetJitter(*jitter)
+		col.SetFetchTimeout(*timeout)
+		col.SetValidator(collector.NewValidator(validation.WithBounds(c.MinStations, c.MaxStations)))
 
-	for {
-		select {
-		case <-ticker.C:
-			if err := fetchAndStore(client, store); err != nil {
-				log.Printf("Fetch failed: %v", err)
+		if *elect {
+			ttl := *leaseTTL
+			if ttl == 0 {
+				ttl = 2 * collector.Period(sched, *interval)
 			}
-		case sig := <-sigChan:
-			log.Printf("Received signal %v, shutting down", sig)
-			return
+			col.SetLeaderElector(collector.NewLeaderElector(store, *replicaID, ttl))
+			logger.Info("Leader election enabled", "replica", *replicaID, "lease", collector.LeaseKey, "ttl", ttl)
 		}
+
+		if *heartbeat != "" || *heartbeatO {
+			var objects storage.ObjectStore
+			if *heartbeatO {
+				objects = store
+			}
+			hb := collector.NewHeartbeat(*heartbeat, objects, *replicaID)
+			col.OnWrite(hb.Success)
+			col.OnFailure(hb.Failure)
+		}
+
+		if *metrics != "" {
+			var label string
+			if *citiesPath != "" {
+				label = c.ID
+			}
+			m := collector.NewMetrics(label)
+			col.OnWrite(m.Success)
+			col.OnFailure(m.Failure)
+			allMetrics = append(allMetrics, m)
+			sm := collector.NewStationMetrics(label)
+			col.OnWrite(sm.Record)
+			stationMetrics = append(stationMetrics, sm)
+		}
+
+		reg, err := registry.Load(context.Background(), store)
+		if err != nil {
+			log.Fatalf("Failed to load station registry: %v", err)
+		}
+		reg.Elevation = elevationSource
+		col.OnWrite(reg.Record)
+
+		if *eventLog {
+			// Diff the first fetch against the latest stored snapshot, if any
+			latest, _, err := store.ReadLatestStations(ctx)
+			if err != nil {
+				latest = nil
+			}
+			col.OnWrite(events.NewLog(store, latest).Record)
+		}
+
+		if publisher != nil {
+			latest, _, err := store.ReadLatestStations(ctx)
+			if err != nil {
+				latest = nil
+			}
+			col.OnWrite(stream.NewSink(publisher, c.ID, latest).Record)
+		}
+
+		if *rollups {
+			col.OnWrite(rollup.NewJob(store, store, c.Location()).Record)
+		}
+
+		if *webhookURL != "" {
+			wh := collector.NewSnapshotWebhook(collector.WebhookConfig{
+				URL:         *webhookURL,
+				Secret:      webhookSecret,
+				City:        c.ID,
+				MaxAttempts: *webhookN,
+				Backoff:     *webhookB,
+			})
+			col.OnWrite(wh.Send)
+			webhooks = append(webhooks, wh)
+		}
+
+		// Alerts watch the default city only
+		if i == 0 && *alertsPath != "" {
+			alertsCfg, err := alerts.LoadConfig(*alertsPath)
+			if err != nil {
+				log.Fatalf("Failed to load alerts config: %v", err)
+			}
+			engine := alerts.NewEngineFromConfig(alertsCfg)
+			col.OnWrite(func(key string, stations *tfl.Stations) {
+				engine.Evaluate(ctx, time.Now().UTC(), stations.Stations)
+			})
+			col.OnInvalid(func(stations *tfl.Stations) {
+				engine.Notify(ctx, alerts.Alert{
+					Rule:      alerts.Rule{Name: "feed-validation"},
+					Text:      stations.Validation.Summary(),
+					Timestamp: time.Now().UTC(),
+				})
+			})
+			slog.Info("Loaded alert rules", "rules", len(alertsCfg.Rules), "path", *alertsPath)
+			if alertsCfg.Telegram != nil && alertsCfg.Telegram.Commands {
+				go alerts.NewTelegramBot(alertsCfg.Telegram, store.ReadLatestStations).Run(ctx)
+			}
+		}
+
+		runs[i] = cityRun{collector: col, schedule: sched, log: logger}
 	}
-}
 
-func fetchAndStore(client *tfl.Client, store *storage.TSVStorage) error {
-	log.Println("Fetching station data...")
+	if *metrics != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", collector.MetricsHandler(allMetrics...))
+		mux.Handle("/metrics/stations", collector.StationMetricsHandler(stationMetrics...))
+		go func() {
+			slog.Info("Serving metrics", "addr", *metrics)
+			if err := http.ListenAndServe(*metrics, mux); err != nil {
+				log.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
 
-	stations, err := client.FetchStations()
-	if err != nil {
-		return err
+	continuous := !*oneShot && (*schedule != "" || *interval != 0)
+
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		// Perform initial fetch, unless a schedule will align it to the next boundary
+		if run.schedule == nil || *oneShot {
+			if err := run.collector.Collect(ctx); err != nil {
+				log.Fatalf("Initial fetch failed: %v", err)
+			}
+		}
+		if !continuous {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if run.schedule != nil {
+				run.log.Info("Collector running. Press Ctrl+C to stop.", "schedule", *schedule, "next", run.schedule.Next(time.Now()).Format(time.RFC3339))
+				run.collector.RunSchedule(ctx, run.schedule)
+			} else {
+				run.log.Info("Collector running. Press Ctrl+C to stop.", "interval", *interval)
+				run.collector.Run(ctx, *interval)
+			}
+		}()
 	}
+	wg.Wait()
 
-	filepath, err := store.WriteStations(stations)
-	if err != nil {
-		return err
+	// Let webhook deliveries still in flight finish or give up
+	for _, wh := range webhooks {
+		wh.Wait()
+	}
+
+	if !continuous {
+		slog.Info("One-shot mode: exiting after single fetch")
+		return
 	}
+	slog.Info("Shutting down")
+}
+
+// cityRun is one city's collector and when it collects.
+type cityRun struct {
+	collector *collector.Collector
+	schedule  collector.Schedule
+	log       *slog.Logger
+}
 
-	log.Printf("Saved %d stations to %s", len(stations.Stations), filepath)
-	return nil
+// parseSchedule parses the -schedule expression for c, evaluated in tz or,
+// when tz is empty, in the city's time zone for multi-city runs and UTC otherwise.
+// It returns nil when expr is empty.
+func parseSchedule(expr, tz string, c city.City, multiCity bool) (collector.Schedule, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	loc := time.UTC
+	switch {
+	case tz != "":
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("invalid schedule time zone: %w", err)
+		}
+	case multiCity:
+		loc = c.Location()
+	}
+	return collector.ParseSchedule(expr, loc)
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/storage"
+)
+
+func main() {
+	var (
+		dataDir  = flag.String("data-dir", "data", "Directory containing TSV data files (local mode only)")
+		useR2    = flag.Bool("r2", false, "Read snapshots from Cloudflare R2 instead of local files")
+		interval = flag.Duration("interval", 5*time.Minute, "Expected collector interval")
+	)
+	flag.Parse()
+
+	var store storage.DataStore
+	if *useR2 {
+		cfg, err := config.LoadR2Config()
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+		store, err = storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, cfg.BucketName, cfg.Region, cfg.Prefix)
+		if err != nil {
+			log.Fatalf("Failed to initialize R2 storage: %v", err)
+		}
+	} else {
+		store = storage.NewTSVStorage(*dataDir)
+	}
+
+	report, err := storage.GapReport(context.Background(), store, *interval)
+	if err != nil {
+		log.Fatalf("Gap report failed: %v", err)
+	}
+
+	if report.SnapshotCount == 0 {
+		fmt.Println("No snapshots found")
+		return
+	}
+
+	fmt.Printf("Snapshots: %d (%s to %s)\n", report.SnapshotCount,
+		report.First.Format(time.RFC3339), report.Last.Format(time.RFC3339))
+	fmt.Printf("Expected interval: %s\n", report.ExpectedInterval)
+	fmt.Printf("Gaps: %d (%d missing snapshots)\n", len(report.Gaps), report.MissingCount)
+
+	for _, g := range report.Gaps {
+		fmt.Printf("  %s -> %s  %8s  missing=%d\n",
+			g.Start.Format(time.RFC3339), g.End.Format(time.RFC3339), g.Duration.Round(time.Second), g.Missing)
+	}
+
+	if len(report.Gaps) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"city-cycling/internal/logging"
+	"city-cycling/internal/tfl/tfltest"
+)
+
+func main() {
+	logOpts := logging.AddFlags()
+	var (
+		addr      = flag.String("addr", ":8765", "Address to serve the feeds on")
+		stations  = flag.Int("stations", tfltest.DefaultStations, "Number of synthetic stations")
+		seed      = flag.Uint64("seed", uint64(time.Now().UnixNano()), "Seed for the synthetic data and failures, to make a run reproducible")
+		recorded  = flag.String("recorded", "", "Serve the snapshots in this data directory in order instead of synthetic data")
+		latency   = flag.Duration("latency", 0, "Delay every response by this long")
+		jitter    = flag.Duration("jitter", 0, "Vary -latency by up to this much either way")
+		errorRate = flag.Float64("error-rate", 0, "Fraction of requests answered with 503 Service Unavailable")
+		malformed = flag.Float64("malformed-rate", 0, "Fraction of responses cut off halfway")
+		emptyRate = flag.Float64("empty-rate", 0, "Fraction of fetches listing no stations")
+	)
+	flag.Parse()
+	logOpts.MustApply()
+
+	cfg := tfltest.Config{
+		Stations:      *stations,
+		Seed:          *seed,
+		Latency:       *latency,
+		Jitter:        *jitter,
+		ErrorRate:     *errorRate,
+		MalformedRate: *malformed,
+		EmptyRate:     *emptyRate,
+	}
+	if *recorded != "" {
+		snapshots, err := tfltest.LoadRecorded(context.Background(), *recorded)
+		if err != nil {
+			log.Fatalf("Failed to load recorded snapshots: %v", err)
+		}
+		cfg.Recorded = snapshots
+		slog.Info("Serving recorded snapshots", "dir", *recorded, "snapshots", len(snapshots))
+	}
+
+	feed := tfltest.NewFeed(cfg)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		feed.ServeHTTP(w, r)
+		slog.Debug("Feed request", "path", r.URL.Path, "duration", time.Since(start))
+	})
+
+	slog.Info("Serving mock feeds", "addr", *addr, "xml", tfltest.XMLPath, "gbfs", tfltest.GBFSPath, "seed", *seed)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
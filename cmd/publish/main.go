@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // so -timezone works in minimal containers
+
+	"city-cycling/internal/collector"
+	"city-cycling/internal/config"
+	"city-cycling/internal/publish"
+	"city-cycling/internal/storage"
+)
+
+func main() {
+	var (
+		dataDir      = flag.String("data-dir", "data", "Directory containing TSV data files (local mode only)")
+		useR2        = flag.Bool("r2", false, "Read snapshots from Cloudflare R2 instead of local files")
+		root         = flag.String("root", "", "Key prefix of the city to publish, e.g. \"manchester/\" (default: the unprefixed city)")
+		cityName     = flag.String("city", "london", "City name recorded in the index and data dictionary")
+		timezone     = flag.String("timezone", "Europe/London", "IANA time zone days run midnight to midnight in")
+		publicBucket = flag.String("public-bucket", "", "R2 bucket to publish to, in the account of the S3_* variables (configure it for public access)")
+		publicPrefix = flag.String("public-prefix", "", "Key prefix to publish under in -public-bucket, e.g. \"open-data/london/\"")
+		publicDir    = flag.String("public-dir", "", "Publish to this local directory instead of a bucket")
+		publicURL    = flag.String("public-url", "", "Public URL the published files are served from, e.g. \"https://pub-<id>.r2.dev/open-data/london/\", listed in the server's /api/v1/datasets")
+		license      = flag.String("license", publish.DefaultLicense, "License or attribution recorded with the extracts")
+		fromDate     = flag.String("from", "", "First day to publish, YYYY-MM-DD, republishing any already published (default: the day after the last published, or yesterday)")
+		schedule     = flag.String("schedule", "", "Cron expression to keep running and publish on, e.g. \"30 2 * * *\" (default: publish once and exit)")
+	)
+	flag.Parse()
+
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		log.Fatalf("Invalid -timezone: %v", err)
+	}
+	var from time.Time
+	if *fromDate != "" {
+		if from, err = time.ParseInLocation("2006-01-02", *fromDate, loc); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+	}
+	if (*publicBucket == "") == (*publicDir == "") {
+		log.Fatalf("Exactly one of -public-bucket or -public-dir is required")
+	}
+
+	var base storage.DataStore
+	var target storage.ObjectStore
+	if *useR2 || *publicBucket != "" {
+		cfg, err := config.LoadR2Config()
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+		if *useR2 {
+			base, err = storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, cfg.BucketName, cfg.Region, cfg.Prefix)
+			if err != nil {
+				log.Fatalf("Failed to initialize R2 storage: %v", err)
+			}
+		}
+		if *publicBucket != "" {
+			// Never the live bucket: the public one holds nothing but extracts
+			if *publicBucket == cfg.BucketName {
+				log.Fatalf("-public-bucket must not be the bucket snapshots are stored in")
+			}
+			target, err = storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, *publicBucket, cfg.Region, *publicPrefix)
+			if err != nil {
+				log.Fatalf("Failed to initialize public R2 bucket: %v", err)
+			}
+		}
+	}
+	if base == nil {
+		base = storage.NewTSVStorage(*dataDir)
+	}
+	if target == nil {
+		target = storage.NewTSVStorage(*publicDir)
+	}
+	// Snapshots are decrypted to be published; the public extracts stay plain
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot keys: %v", err)
+	}
+	if err := storage.SetEncryption(base, keys); err != nil {
+		log.Fatalf("Failed to set up decryption: %v", err)
+	}
+	store, err := storage.WithRoot(base, *root)
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+	snapshots, ok := store.(storage.RangeDataStore)
+	if !ok {
+		log.Fatalf("Storage backend does not support range reads")
+	}
+
+	publisher := publish.New(snapshots, target, *cityName, loc)
+	publisher.License = *license
+	publisher.BaseURL = *publicURL
+	if publisher.BaseURL != "" && !strings.HasSuffix(publisher.BaseURL, "/") {
+		publisher.BaseURL += "/"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	run := func(from time.Time) {
+		start := time.Now()
+		days, err := publisher.PublishPending(ctx, time.Now(), from)
+		if err != nil {
+			slog.Error("Publication failed", "published", len(days), "error", err)
+			return
+		}
+		slog.Info("Publication complete", "days", len(days), "duration", time.Since(start).Round(time.Millisecond))
+	}
+
+	if *schedule == "" {
+		days, err := publisher.PublishPending(ctx, time.Now(), from)
+		if err != nil {
+			log.Fatalf("Publication failed after %d days: %v", len(days), err)
+		}
+		fmt.Printf("Published %d days\n", len(days))
+		return
+	}
+
+	sched, err := collector.ParseSchedule(*schedule, loc)
+	if err != nil {
+		log.Fatalf("Invalid -schedule: %v", err)
+	}
+	run(from)
+	for {
+		next := sched.Next(time.Now())
+		slog.Info("Next publication scheduled", "at", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			run(time.Time{})
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
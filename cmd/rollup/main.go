@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+	_ "time/tzdata" // so -timezone works in minimal containers
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/rollup"
+	"city-cycling/internal/storage"
+)
+
+func main() {
+	var (
+		dataDir  = flag.String("data-dir", "data", "Directory containing TSV data files (local mode only)")
+		useR2    = flag.Bool("r2", false, "Read snapshots from and write rollups to Cloudflare R2 instead of local files")
+		root     = flag.String("root", "", "Key prefix of the city to roll up, e.g. \"manchester/\" (default: the unprefixed city)")
+		timezone = flag.String("timezone", "Europe/London", "IANA time zone buckets are aligned to; must match the server's city")
+		fromDate = flag.String("from", "", "First day to roll up, YYYY-MM-DD (default: the first snapshot)")
+		toDate   = flag.String("to", "", "Last day to roll up, YYYY-MM-DD (default: up to the current hour)")
+	)
+	flag.Parse()
+
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		log.Fatalf("Invalid -timezone: %v", err)
+	}
+
+	var base storage.DataStore
+	if *useR2 {
+		cfg, err := config.LoadR2Config()
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+		base, err = storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, cfg.BucketName, cfg.Region, cfg.Prefix)
+		if err != nil {
+			log.Fatalf("Failed to initialize R2 storage: %v", err)
+		}
+	} else {
+		base = storage.NewTSVStorage(*dataDir)
+	}
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot keys: %v", err)
+	}
+	if err := storage.SetEncryption(base, keys); err != nil {
+		log.Fatalf("Failed to set up decryption: %v", err)
+	}
+	store, err := storage.WithRoot(base, *root)
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+	snapshots, ok := store.(storage.RangeDataStore)
+	if !ok {
+		log.Fatalf("Storage backend does not support range reads")
+	}
+	objects, ok := store.(storage.ObjectStore)
+	if !ok {
+		log.Fatalf("Storage backend does not support objects")
+	}
+
+	// Only complete hours are rolled up; the collector adds the rest as they end
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, loc)
+	if *toDate != "" {
+		d, err := time.ParseInLocation("2006-01-02", *toDate, loc)
+		if err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+		to = d.AddDate(0, 0, 1)
+	}
+	var from time.Time
+	if *fromDate != "" {
+		if from, err = time.ParseInLocation("2006-01-02", *fromDate, loc); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+	} else {
+		timestamps, err := store.ListAvailableTimestamps(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		for _, ts := range timestamps {
+			if from.IsZero() || ts.Before(from) {
+				from = ts
+			}
+		}
+		if from.IsZero() {
+			fmt.Println("No snapshots found")
+			return
+		}
+	}
+	if !from.Before(to) {
+		log.Fatalf("Nothing to roll up: -from must be before -to")
+	}
+
+	start := time.Now()
+	job := rollup.NewJob(snapshots, objects, loc)
+	if err := job.Update(context.Background(), from, to); err != nil {
+		log.Fatalf("Rollup failed: %v", err)
+	}
+	fmt.Printf("Rolled up %s to %s in %s\n", from.In(loc).Format(time.RFC3339), to.Format(time.RFC3339), time.Since(start).Round(time.Millisecond))
+}
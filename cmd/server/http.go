@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Connection defaults. Go's zero values let a client hold a connection open
+// forever by sending its headers or body slowly. The write timeout must outlast
+// the longest route timeout (5 minutes for range scans) or slow responses are
+// cut off before their own deadline answers. Streaming routes such as
+// /api/v1/export extend it for their own responses.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = time.Minute
+	defaultWriteTimeout      = 6 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultMaxHeaderBytes    = 64 << 10
+)
+
+// httpOptions tunes the HTTP servers' connection handling.
+type httpOptions struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// KeepAlives reuses connections between requests; off closes each
+	// connection after one response.
+	KeepAlives bool
+	// HTTP2 negotiates HTTP/2 on TLS connections; H2C also accepts it in
+	// cleartext, for proxies that speak HTTP/2 to their backends.
+	HTTP2 bool
+	H2C   bool
+}
+
+// validate reports out-of-range connection settings.
+func (o httpOptions) validate() error {
+	for name, d := range map[string]time.Duration{
+		"-read-header-timeout": o.ReadHeaderTimeout,
+		"-read-timeout":        o.ReadTimeout,
+		"-write-timeout":       o.WriteTimeout,
+		"-idle-timeout":        o.IdleTimeout,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if o.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("-max-header-bytes must be positive")
+	}
+	return nil
+}
+
+// server returns an HTTP server for handler on addr with these settings.
+func (o httpOptions) server(addr string, handler http.Handler) *http.Server {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(o.HTTP2)
+	protocols.SetUnencryptedHTTP2(o.H2C)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: o.ReadHeaderTimeout,
+		ReadTimeout:       o.ReadTimeout,
+		WriteTimeout:      o.WriteTimeout,
+		IdleTimeout:       o.IdleTimeout,
+		MaxHeaderBytes:    o.MaxHeaderBytes,
+		Protocols:         &protocols,
+	}
+	server.SetKeepAlivesEnabled(o.KeepAlives)
+	return server
+}
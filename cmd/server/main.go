@@ -1,80 +1,523 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // so -timezone and tz= work in minimal containers
 
+	"github.com/redis/go-redis/v9"
+
+	"city-cycling/internal/alerts"
+	"city-cycling/internal/city"
+	"city-cycling/internal/collector"
 	"city-cycling/internal/config"
+	"city-cycling/internal/elevation"
+	"city-cycling/internal/geo"
+	"city-cycling/internal/logging"
+	"city-cycling/internal/registry"
 	"city-cycling/internal/storage"
+	"city-cycling/internal/telemetry"
+	"city-cycling/internal/tenant"
 	"city-cycling/internal/tfl"
 	"city-cycling/internal/web"
 )
 
 func main() {
+	logOpts := logging.AddFlags()
 	var (
-		port    = flag.Int("port", 8080, "HTTP server port")
-		dataDir = flag.String("data-dir", "data", "Directory containing TSV data files (local mode only)")
-		useR2   = flag.Bool("r2", true, "Use Cloudflare R2 for data storage (default: local files)")
+		port       = flag.Int("port", 8080, "HTTP server port")
+		dataDir    = flag.String("data-dir", "data", "Directory containing TSV data files (local mode only)")
+		useR2      = flag.Bool("r2", true, "Use Cloudflare R2 for data storage (default: local files)")
+		useAzure   = flag.Bool("azure", false, "Use Azure Blob Storage for data storage (takes precedence over -r2)")
+		parquet    = flag.String("query-parquet", "", "Run /api/v1/query over the Parquet extracts published by cmd/publish with DuckDB: a directory or s3:// URL, {city} and {tenant} replaced by their IDs (needs a -tags duckdb build; disabled if empty)")
+		tierKeep   = flag.Duration("tier-keep", 0, "With -fallback and -collect, keep this much recent data in the storage and move older snapshots to the fallback every hour, e.g. 168h (0 disables)")
+		fallback   = flag.String("fallback", "", "Read snapshots the storage lacks from this backend, e.g. recent data in local files and the archive in r2: local (-data-dir), r2 or azure (disabled if empty)")
+		refresh    = flag.Duration("refresh-interval", time.Minute, "How often to reload the latest snapshot into memory")
+		collect    = flag.Bool("collect", false, "Also run the data collector in this process")
+		every      = flag.Duration("collect-interval", 5*time.Minute, "Fetch interval when -collect is set")
+		alertsPath = flag.String("alerts", "", "Path to an alerting rules JSON file, evaluated when -collect is set")
+		corsOrigin = flag.String("cors-origins", "", "Comma-separated origins allowed to call /api/* (\"*\" for any, empty disables CORS)")
+		corsMethod = flag.String("cors-methods", "GET, OPTIONS", "Comma-separated methods allowed for CORS requests")
+		corsMaxAge = flag.Duration("cors-max-age", 10*time.Minute, "How long browsers may cache CORS preflight responses")
+		keysFile   = flag.String("api-keys-file", "", "JSON file of API keys required for expensive endpoints (disabled if empty)")
+		ipRate     = flag.Float64("ip-rate", 0, "Requests per minute allowed per client IP on /api/* (0 disables)")
+		ipBurst    = flag.Int("ip-burst", 20, "Burst size for per-IP rate limiting")
+		trustProxy = flag.Bool("trust-proxy", false, "Use the last X-Forwarded-For address as the client IP (only behind a trusted proxy)")
+		maxHistory = flag.Int("max-history", web.DefaultConcurrencyLimits.History, "Most /api/history and /api/history/range requests served at once (0: no limit)")
+		maxAnalyze = flag.Int("max-analytics", web.DefaultConcurrencyLimits.Analytics, "Most analytics, query, station stats and health report requests served at once (0: no limit)")
+		maxExport  = flag.Int("max-export", web.DefaultConcurrencyLimits.Export, "Most /api/export requests served at once (0: no limit)")
+		loadQueue  = flag.Int("load-queue", web.DefaultConcurrencyLimits.Queue, "Requests per limited endpoint class that may wait for a slot before more are shed with 503")
+		loadWait   = flag.Duration("load-queue-timeout", web.DefaultConcurrencyLimits.QueueTimeout, "How long a request may wait for a slot before it is shed with 503 (0: shed at once)")
+		timezone   = flag.String("timezone", "", "IANA time zone for hour/day buckets and timestamps when a request has no tz parameter (default: each city's, Europe/London without -cities)")
+		citiesPath = flag.String("cities", "", "JSON file of cities to serve, each under /api/v1/{city} (default: London only)")
+		tenantFile = flag.String("tenants", "", "JSON file of tenants to serve in isolation, each with its own storage, cities and API keys, selected by host name or under /{tenant}/ (disabled if empty)")
+		elevations = flag.String("elevation", "", "Record each station's elevation in the registry when -collect is set, from open-meteo (the Open-Meteo API) or a CSV dataset of id or lat,lng and elevation (disabled if empty)")
+		areasPath  = flag.String("areas", "", "GeoJSON file of boroughs or neighbourhoods to group the default city's stations by, unless the cities file sets its areas (disabled if empty)")
+		areaProp   = flag.String("area-property", geo.DefaultAreaProperty, "Feature property naming each area in -areas")
+		feedType   = flag.String("feed", "", "Comma-separated sources for the built-in London city, in failover order: tfl (XML feed), bikepoint (Unified API, key from TFL_APP_KEY); default tfl")
+		validate   = flag.String("validate", "annotate", "What to do with a fetch that fails validation when -collect is set: reject, annotate or alert (annotate and notify the -alerts webhooks)")
+		minStation = flag.Int("min-stations", 1, "Fewest stations a valid fetch may have (0: no bound)")
+		maxStation = flag.Int("max-stations", 0, "Most stations a valid fetch may have (0: no bound)")
+		cacheSnaps = flag.Int("snapshot-cache-entries", web.DefaultSnapshotCacheEntries, "Most historical snapshots kept in memory per city for /api/history/snapshot (0: no bound)")
+		cacheMB    = flag.Int("snapshot-cache-mb", web.DefaultSnapshotCacheBytes>>20, "Most memory, in MiB, cached historical snapshots may use per city (0: no bound)")
+		metrics    = flag.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090 (disabled if empty)")
+		debugAddr  = flag.String("debug-addr", "", "Serve pprof profiles and Go runtime metrics on this address, e.g. localhost:6060, requiring an admin key when ADMIN_KEYS is set (disabled if empty)")
+		replayFrom = flag.String("replay-from", "", "Serve stored snapshots from this RFC 3339 time as if they were live, for demos and frontend development (disabled if empty)")
+		replaySpd  = flag.Float64("replay-speed", web.DefaultReplaySpeed, "How many times faster than real time -replay-from plays back")
+		redisURL   = flag.String("redis-url", "", "Share the snapshot and history caches between replicas in this Redis, e.g. redis://:password@host:6379/0 (default: REDIS_URL; in memory if empty)")
+		redisPfx   = flag.String("redis-prefix", "city-cycling:", "Prefix of the server's Redis keys, followed by the city ID")
+		redisTTL   = flag.Duration("redis-snapshot-ttl", 24*time.Hour, "How long snapshots stay in the Redis cache (0: until evicted by Redis)")
+		historyDir = flag.String("history-cache-dir", "", "Also keep the /api/history aggregate in this local directory, per city, for fast restarts (disabled if empty)")
+		tlsCert    = flag.String("tls-cert", "", "PEM certificate chain file; with -tls-key, serve HTTPS on -port")
+		tlsKey     = flag.String("tls-key", "", "PEM private key file for -tls-cert")
+		acmeHosts  = flag.String("autocert-hosts", "", "Comma-separated host names to obtain Let's Encrypt certificates for and serve HTTPS on -port (disabled if empty)")
+		acmeCache  = flag.String("autocert-cache", "autocert-cache", "Directory caching -autocert-hosts certificates and account keys")
+		acmeEmail  = flag.String("autocert-email", "", "Contact email registered with Let's Encrypt for -autocert-hosts")
+		acmeHTTP   = flag.String("autocert-http-addr", ":80", "Address answering ACME HTTP-01 challenges and redirecting HTTP to HTTPS with -autocert-hosts (empty: TLS-ALPN-01 only)")
+		hdrTimeout = flag.Duration("read-header-timeout", defaultReadHeaderTimeout, "How long a client may take to send request headers (0: no limit)")
+		rdTimeout  = flag.Duration("read-timeout", defaultReadTimeout, "How long a client may take to send a whole request (0: no limit)")
+		wrTimeout  = flag.Duration("write-timeout", defaultWriteTimeout, "How long writing a response may take, from the end of the request headers (0: no limit)")
+		idleTime   = flag.Duration("idle-timeout", defaultIdleTimeout, "How long an idle keep-alive connection stays open (0: the read timeout)")
+		maxHeader  = flag.Int("max-header-bytes", defaultMaxHeaderBytes, "Largest request header block accepted, in bytes")
+		keepAlive  = flag.Bool("keep-alive", true, "Reuse connections between requests")
+		useHTTP2   = flag.Bool("http2", true, "Negotiate HTTP/2 on HTTPS connections")
+		useH2C     = flag.Bool("h2c", false, "Also accept HTTP/2 without TLS (h2c), e.g. from a reverse proxy")
+		readOnly   = flag.Bool("read-only", false, "Start read-only: refuse admin changes and write nothing to storage, e.g. during a storage migration (switchable at runtime through /admin/mode)")
+		maintain   = flag.Bool("maintenance", false, "Start in maintenance mode: answer every request but /admin/ with 503 (switchable at runtime through /admin/mode)")
+		maintMsg   = flag.String("maintenance-message", "", "Message shown on the maintenance page and in API errors (default: a generic notice)")
 	)
 	flag.Parse()
+	logOpts.MustApply()
+
+	if *tierKeep > 0 && (*fallback == "" || !*collect) {
+		log.Fatalf("-tier-keep needs -fallback and -collect")
+	}
+
+	var replayStart time.Time
+	if *replayFrom != "" {
+		t, err := time.Parse(time.RFC3339, *replayFrom)
+		if err != nil {
+			log.Fatalf("Invalid -replay-from %q: expected an RFC 3339 time", *replayFrom)
+		}
+		if *collect {
+			log.Fatalf("-replay-from cannot be combined with -collect")
+		}
+		replayStart = t
+	}
+
+	tlsOpts := tlsOptions{
+		CertFile:         *tlsCert,
+		KeyFile:          *tlsKey,
+		AutocertHosts:    splitList(*acmeHosts),
+		AutocertCache:    *acmeCache,
+		AutocertEmail:    *acmeEmail,
+		AutocertHTTPAddr: *acmeHTTP,
+	}
+	if err := tlsOpts.validate(); err != nil {
+		log.Fatalf("Invalid TLS flags: %v", err)
+	}
+	httpOpts := httpOptions{
+		ReadHeaderTimeout: *hdrTimeout,
+		ReadTimeout:       *rdTimeout,
+		WriteTimeout:      *wrTimeout,
+		IdleTimeout:       *idleTime,
+		MaxHeaderBytes:    *maxHeader,
+		KeepAlives:        *keepAlive,
+		HTTP2:             *useHTTP2,
+		H2C:               *useH2C,
+	}
+	if err := httpOpts.validate(); err != nil {
+		log.Fatalf("Invalid HTTP flags: %v", err)
+	}
 
 	// Allow overriding via environment variable
 	if os.Getenv("USE_R2") != "" {
 		*useR2 = true
 	}
+	if os.Getenv("USE_AZURE") != "" {
+		*useAzure = true
+	}
+	// Allow overriding CORS origins via environment variable
+	if originsEnv := os.Getenv("CORS_ALLOWED_ORIGINS"); originsEnv != "" {
+		*corsOrigin = originsEnv
+	}
 	// Allow overriding port via environment variable
 	if portEnv := os.Getenv("PORT"); portEnv != "" {
 		fmt.Sscanf(portEnv, "%d", port)
 	}
 
-	var dataStore storage.DataStore
 	var err error
+	var elevationSource elevation.Source
+	if *elevations != "" {
+		if elevationSource, err = elevation.NewSource(*elevations); err != nil {
+			log.Fatalf("Failed to set up elevations: %v", err)
+		}
+	}
+	policy, err := collector.ParseValidationPolicy(*validate)
+	if err != nil {
+		log.Fatalf("Invalid -validate: %v", err)
+	}
+	validation := collector.ValidationConfig{Policy: policy, MinStations: *minStation, MaxStations: *maxStation}
+	var location *time.Location
+	if *timezone != "" {
+		if location, err = time.LoadLocation(*timezone); err != nil {
+			log.Fatalf("Invalid timezone: %v", err)
+		}
+	}
 
-	if *useR2 {
-		// Initialize R2 storage for production
-		log.Println("Using Cloudflare R2 for data storage")
-		cfg, err := config.LoadR2Config()
-		if err != nil {
-			log.Fatalf("Failed to load R2 config: %v", err)
+	shutdownTracing, err := telemetry.Setup(context.Background(), "city-cycling-server")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	backend := backendLocal
+	if *useAzure {
+		backend = backendAzure
+		slog.Info("Using Azure Blob Storage for data storage")
+	} else if *useR2 {
+		// R2 for production
+		backend = backendR2
+		slog.Info("Using Cloudflare R2 for data storage")
+	} else {
+		// Local files for development
+		slog.Info("Using local file storage")
+	}
+
+	opts := siteOptions{
+		IPRateLimit: web.IPRateLimitConfig{
+			RatePerMinute: *ipRate,
+			Burst:         *ipBurst,
+			TrustProxy:    *trustProxy,
+		},
+		Limits: web.ConcurrencyLimits{
+			History:      *maxHistory,
+			Analytics:    *maxAnalyze,
+			Export:       *maxExport,
+			Queue:        *loadQueue,
+			QueueTimeout: *loadWait,
+		},
+		Location:     location,
+		Metrics:      *metrics != "",
+		RedisPrefix:  *redisPfx,
+		RedisTTL:     *redisTTL,
+		CacheEntries: *cacheSnaps,
+		CacheBytes:   int64(*cacheMB) << 20,
+		HistoryDir:   *historyDir,
+		ReplayStart:  replayStart,
+		ReplaySpeed:  *replaySpd,
+		Refresh:      *refresh,
+		Collect:      *collect,
+		CollectEvery: *every,
+		Alerts:       *alertsPath,
+		Validation:   validation,
+		Elevations:   elevationSource,
+		TierKeep:     *tierKeep,
+		ReadOnly:     *readOnly,
+		Maintenance:  *maintain,
+		MaintMessage: *maintMsg,
+		Parquet:      *parquet,
+	}
+
+	if *corsOrigin != "" {
+		opts.CORS = &web.CORSConfig{
+			AllowedOrigins: splitList(*corsOrigin),
+			AllowedMethods: splitList(*corsMethod),
+			MaxAge:         *corsMaxAge,
 		}
+		slog.Info("CORS enabled", "origins", *corsOrigin)
+	}
 
-		dataStore, err = storage.NewR2Storage(
-			cfg.AccessKeyID,
-			cfg.SecretAccessKey,
-			cfg.Endpoint,
-			cfg.BucketName,
-			cfg.Region,
-			cfg.Prefix,
-		)
+	if *keysFile != "" {
+		opts.APIKeys, err = web.LoadAPIKeys(*keysFile)
 		if err != nil {
-			log.Fatalf("Failed to initialize R2 storage: %v", err)
+			log.Fatalf("Failed to load API keys: %v", err)
 		}
+	}
 
-		log.Printf("R2 Bucket: %s", cfg.BucketName)
-	} else {
-		// Initialize local file storage for development
-		log.Println("Using local file storage")
-		dataStore = storage.NewTSVStorage(*dataDir)
-		log.Printf("Data directory: %s", *dataDir)
+	snapKeys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot keys: %v", err)
+	}
+	if snapKeys != nil {
+		slog.Info("Encrypting snapshots", "key", snapKeys.Current())
 	}
 
-	tflClient := tfl.NewClient()
+	keysEnv, err := config.Secret("API_KEYS")
+	if err != nil {
+		log.Fatalf("Failed to load API_KEYS: %v", err)
+	}
+	if keysEnv != "" {
+		envKeys, err := web.ParseAPIKeys(keysEnv)
+		if err != nil {
+			log.Fatalf("Failed to parse API_KEYS: %v", err)
+		}
+		opts.APIKeys = append(opts.APIKeys, envKeys...)
+	}
 
-	handler, err := web.NewHandler(dataStore, tflClient)
+	// Admin keys are separate from API keys, which are handed out to consumers
+	adminEnv, err := config.Secret("ADMIN_KEYS")
 	if err != nil {
-		log.Fatalf("Failed to create handler: %v", err)
+		log.Fatalf("Failed to load ADMIN_KEYS: %v", err)
+	}
+	if adminEnv != "" {
+		opts.AdminKeys, err = web.ParseAPIKeys(adminEnv)
+		if err != nil {
+			log.Fatalf("Failed to parse ADMIN_KEYS: %v", err)
+		}
+		slog.Info("Admin API enabled", "keys", len(opts.AdminKeys))
 	}
 
-	mux := http.NewServeMux()
-	handler.RegisterRoutes(mux)
+	if *ipRate > 0 {
+		slog.Info("Per-IP rate limit enabled", "ratePerMinute", *ipRate, "burst", *ipBurst)
+	}
+	limits := opts.Limits
+	slog.Info("Concurrency limits", "history", limits.History, "analytics", limits.Analytics, "export", limits.Export, "queue", limits.Queue, "queueTimeout", limits.QueueTimeout)
+
+	if *redisURL == "" {
+		if *redisURL, err = config.Secret("REDIS_URL"); err != nil {
+			log.Fatalf("Failed to load REDIS_URL: %v", err)
+		}
+	}
+	if *redisURL != "" {
+		redisOpts, err := redis.ParseURL(*redisURL)
+		if err != nil {
+			log.Fatalf("Invalid Redis URL: %v", err)
+		}
+		opts.Redis = redis.NewClient(redisOpts)
+		if err := opts.Redis.Ping(context.Background()).Err(); err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		slog.Info("Sharing caches through Redis", "addr", redisOpts.Addr, "prefix", *redisPfx)
+	}
+
+	var sites []*site
+	var root http.Handler
+	if *tenantFile != "" {
+		// Tenants set their cities, areas and alerts themselves
+		for name, set := range map[string]bool{"-cities": *citiesPath != "", "-feed": *feedType != "", "-areas": *areasPath != "", "-alerts": *alertsPath != "", "-api-keys-file": *keysFile != "", "API_KEYS": keysEnv != ""} {
+			if set {
+				log.Fatalf("%s cannot be combined with -tenants; set it per tenant in the tenants file", name)
+			}
+		}
+		tenants, err := tenant.Load(*tenantFile)
+		if err != nil {
+			log.Fatalf("Failed to load tenants: %v", err)
+		}
+		router := web.NewTenantRouter()
+		for _, t := range tenants {
+			cities, err := city.Load(t.Cities, "")
+			if err != nil {
+				log.Fatalf("Failed to load cities for tenant %s: %v", t.ID, err)
+			}
+			dir := *dataDir
+			if t.Storage.DataDir != "" {
+				dir = t.Storage.DataDir
+			}
+			store, err := openStores(backend, *fallback, t.Storage.Bucket, dir, snapKeys)
+			if err != nil {
+				log.Fatalf("Failed to initialize storage for tenant %s: %v", t.ID, err)
+			}
+			if store, err = storage.WithRoot(store, t.Storage.Prefix); err != nil {
+				log.Fatalf("Failed to set up storage for tenant %s: %v", t.ID, err)
+			}
+
+			tenantOpts := opts
+			tenantOpts.Alerts = t.Alerts
+			if t.APIKeysFile != "" {
+				if tenantOpts.APIKeys, err = web.LoadAPIKeys(t.APIKeysFile); err != nil {
+					log.Fatalf("Failed to load API keys for tenant %s: %v", t.ID, err)
+				}
+			}
+			s := newSite(t.ID, cities, t.Cities != "", store, tenantOpts)
+			router.Add(t.ID, t.Hosts, s.handler)
+			sites = append(sites, s)
+			slog.Info("Serving tenant", "tenant", t.ID, "path", "/"+t.ID+"/", "hosts", t.Hosts, "cities", len(cities))
+		}
+		root = router
+	} else {
+		cities, err := city.Load(*citiesPath, *feedType)
+		if err != nil {
+			log.Fatalf("Failed to load cities: %v", err)
+		}
+		if *areasPath != "" && cities[0].Areas == "" {
+			cities[0].Areas, cities[0].AreaProperty = *areasPath, *areaProp
+		}
+		store, err := openStores(backend, *fallback, "", *dataDir, snapKeys)
+		if err != nil {
+			log.Fatalf("Failed to initialize %s storage: %v", backend, err)
+		}
+		sites = []*site{newSite("", cities, *citiesPath != "", store, opts)}
+		root = sites[0].handler
+	}
+
+	if *metrics != "" {
+		var stationMetrics []*collector.StationMetrics
+		for _, s := range sites {
+			stationMetrics = append(stationMetrics, s.stationMetrics...)
+		}
+		serverMetrics := web.MetricsHandler(sites[0].handlers...)
+		if *tenantFile != "" {
+			byTenant := make(map[string][]*web.Handler, len(sites))
+			for _, s := range sites {
+				byTenant[s.tenant] = s.handlers
+			}
+			serverMetrics = web.TenantMetricsHandler(byTenant)
+		}
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", serverMetrics)
+		metricsMux.Handle("/metrics/stations", collector.StationMetricsHandler(stationMetrics...))
+		go func() {
+			slog.Info("Serving metrics", "addr", *metrics)
+			if err := httpOpts.server(*metrics, metricsMux).ListenAndServe(); err != nil {
+				log.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
+	if *debugAddr != "" {
+		// Profiles stream for as long as requested, so no write timeout
+		debugOpts := httpOpts
+		debugOpts.WriteTimeout = 0
+		if adminEnv == "" {
+			slog.Warn("Debug endpoints need no key without ADMIN_KEYS; keep -debug-addr off public networks")
+		}
+		go func() {
+			slog.Info("Serving debug endpoints", "addr", *debugAddr)
+			if err := debugOpts.server(*debugAddr, sites[0].handlers[0].DebugHandler()).ListenAndServe(); err != nil {
+				log.Fatalf("Debug server error: %v", err)
+			}
+		}()
+	}
 
 	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("Starting server on http://localhost%s", addr)
+	slog.Info("Starting server", "url", tlsOpts.scheme()+"://localhost"+addr)
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if err := serve(httpOpts.server(addr, root), tlsOpts); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readOnlyWriter holds off writing snapshots while the handler is read-only.
+type readOnlyWriter struct {
+	storage.SnapshotWriter
+	h *web.Handler
+}
+
+// WriteStations refuses the write if h turned read-only while the snapshot was
+// being fetched; otherwise it writes to the wrapped writer.
+func (w readOnlyWriter) WriteStations(ctx context.Context, stations *tfl.Stations) (string, error) {
+	if w.h.ReadOnly() {
+		return "", errors.New("server is read-only")
+	}
+	return w.SnapshotWriter.WriteStations(ctx, stations)
+}
+
+// startCollector runs a collector for c in the background, writing to store and
+// refreshing h after every snapshot. A non-empty alertsPath evaluates its
+// alerting rules against each snapshot; a non-nil elevations enriches the
+// station registry.
+func startCollector(c city.City, store storage.DataStore, h *web.Handler, every time.Duration, alertsPath string, validation collector.ValidationConfig, elevations elevation.Source) {
+	writer, ok := store.(storage.SnapshotWriter)
+	if !ok {
+		log.Fatalf("Storage backend does not support writing snapshots")
+	}
+
+	col := collector.New(c.NewFeed(), readOnlyWriter{writer, h})
+	col.SetLogger(slog.With("city", c.ID))
+	col.SetValidator(collector.NewValidator(validation.WithBounds(c.MinStations, c.MaxStations)))
+	col.SetPaused(h.ReadOnly)
+	col.OnWrite(func(key string, stations *tfl.Stations) {
+		h.NotifySnapshot()
+	})
+
+	if objects, ok := store.(storage.ObjectStore); ok {
+		reg, err := registry.Load(context.Background(), objects)
+		if err != nil {
+			log.Fatalf("Failed to load station registry: %v", err)
+		}
+		reg.Elevation = elevations
+		col.OnWrite(reg.Record)
+	}
+
+	if alertsPath != "" {
+		alertsCfg, err := alerts.LoadConfig(alertsPath)
+		if err != nil {
+			log.Fatalf("Failed to load alerts config: %v", err)
+		}
+		engine := alerts.NewEngineFromConfig(alertsCfg)
+		col.OnWrite(func(key string, stations *tfl.Stations) {
+			engine.Evaluate(context.Background(), time.Now().UTC(), stations.Stations)
+		})
+		col.OnInvalid(func(stations *tfl.Stations) {
+			engine.Notify(context.Background(), alerts.Alert{
+				Rule:      alerts.Rule{Name: "feed-validation"},
+				Text:      stations.Validation.Summary(),
+				Timestamp: time.Now().UTC(),
+			})
+		})
+		slog.Info("Loaded alert rules", "rules", len(alertsCfg.Rules), "path", alertsPath)
+		if alertsCfg.Telegram != nil && alertsCfg.Telegram.Commands {
+			go alerts.NewTelegramBot(alertsCfg.Telegram, store.ReadLatestStations).Run(context.Background())
+		}
+	}
+
+	go func() {
+		ctx := context.Background()
+		if err := col.Collect(ctx); err != nil {
+			slog.Error("Initial fetch failed", "city", c.ID, "error", err)
+		}
+		slog.Info("Collector running", "city", c.ID, "interval", every)
+		col.Run(ctx, every)
+	}()
+}
+
+// startTiering moves the snapshots of store older than keep to its fallback
+// every tieringInterval, while h is not read-only.
+func startTiering(c city.City, store storage.DataStore, h *web.Handler, keep time.Duration) {
+	tiers, ok := store.(*storage.FallbackStorage)
+	if !ok {
+		log.Fatalf("Storage has no fallback to move old snapshots to")
+	}
+	logger := slog.With("city", c.ID)
+	go func() {
+		ticker := time.NewTicker(tieringInterval)
+		defer ticker.Stop()
+		for {
+			if h.ReadOnly() {
+				logger.Info("Skipping snapshot demotion while read-only")
+			} else {
+				report, err := tiers.Demote(context.Background(), time.Now().Add(-keep))
+				if err != nil {
+					logger.Error("Snapshot demotion failed", "error", err)
+				}
+				if report != nil {
+					for key, problem := range report.Skipped {
+						logger.Warn("Snapshot left in the hot store", "key", key, "problem", problem)
+					}
+					logger.Info("Demoted old snapshots", "demoted", report.Demoted, "boundary", report.Boundary.Format(time.RFC3339))
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/cache"
+	"city-cycling/internal/city"
+	"city-cycling/internal/collector"
+	"city-cycling/internal/config"
+	"city-cycling/internal/elevation"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/web"
+)
+
+// Storage backends selected by -azure and -r2.
+const (
+	backendLocal = "local"
+	backendR2    = "r2"
+	backendAzure = "azure"
+)
+
+// tieringInterval is how often -tier-keep moves old snapshots to the fallback.
+const tieringInterval = time.Hour
+
+// openStore creates the data store of backend. A non-empty bucket replaces
+// the R2 bucket or Azure container configured in the environment; dataDir is
+// the directory of local files.
+func openStore(backend, bucket, dataDir string) (storage.DataStore, error) {
+	switch backend {
+	case backendAzure:
+		cfg, err := config.LoadAzureConfig()
+		if err != nil {
+			return nil, err
+		}
+		if bucket != "" {
+			cfg.Container = bucket
+		}
+		store, err := storage.NewAzureBlobStorage(cfg.ConnectionString, cfg.AccountURL, cfg.Container, cfg.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Azure container configured", "container", cfg.Container)
+		return store, nil
+	case backendR2:
+		cfg, err := config.LoadR2Config()
+		if err != nil {
+			return nil, err
+		}
+		if bucket != "" {
+			cfg.BucketName = bucket
+		}
+		store, err := storage.NewR2Storage(
+			cfg.AccessKeyID,
+			cfg.SecretAccessKey,
+			cfg.Endpoint,
+			cfg.BucketName,
+			cfg.Region,
+			cfg.Prefix,
+		)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("R2 bucket configured", "bucket", cfg.BucketName)
+		return store, nil
+	}
+	slog.Info("Data directory configured", "dir", dataDir)
+	return storage.NewTSVStorage(dataDir), nil
+}
+
+// openStores creates the data store of backend, falling back to the store of
+// fallback for the snapshots it lacks unless fallback is empty. Snapshots are
+// encrypted with keys unless it is nil.
+func openStores(backend, fallback, bucket, dataDir string, keys *storage.Keyring) (storage.DataStore, error) {
+	store, err := openFallback(backend, fallback, bucket, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.SetEncryption(store, keys); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// openFallback creates the data store of backend and, unless fallback is
+// empty, wraps it to fall back to the store of fallback.
+func openFallback(backend, fallback, bucket, dataDir string) (storage.DataStore, error) {
+	switch fallback {
+	case "":
+		return openStore(backend, bucket, dataDir)
+	case backend:
+		return nil, fmt.Errorf("fallback backend %q is the primary backend", fallback)
+	case backendLocal, backendR2, backendAzure:
+	default:
+		return nil, fmt.Errorf("unknown fallback backend %q: expected local, r2 or azure", fallback)
+	}
+	primary, err := openStore(backend, bucket, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := openStore(fallback, bucket, dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize fallback storage: %w", err)
+	}
+	slog.Info("Falling back to another backend for missing snapshots", "primary", backend, "fallback", fallback)
+	return storage.NewFallbackStorage(primary, secondary)
+}
+
+// duckDBEngine returns an engine running queries of city over the Parquet
+// extracts at dataset, with {tenant} and {city} replaced by their IDs, and
+// on h's default engine for days not published yet. An s3:// dataset is read
+// with the S3_* credentials.
+func duckDBEngine(dataset, tenant string, c city.City, store storage.DataStore, h *web.Handler) (*analytics.DuckDBEngine, error) {
+	catalog, ok := store.(storage.ObjectStore)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %T cannot hold the publication catalog", store)
+	}
+	cfg := analytics.DuckDBConfig{Dataset: strings.NewReplacer("{tenant}", tenant, "{city}", c.ID).Replace(dataset)}
+	if strings.HasPrefix(cfg.Dataset, "s3://") {
+		r2, err := config.LoadR2Config()
+		if err != nil {
+			return nil, err
+		}
+		cfg.S3KeyID, cfg.S3Secret, cfg.S3Endpoint, cfg.S3Region = r2.AccessKeyID, r2.SecretAccessKey, r2.Endpoint, r2.Region
+	}
+	engine, err := analytics.NewDuckDBEngine(cfg, catalog, h.QueryEngine())
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Running queries on published extracts with DuckDB", "city", c.ID, "dataset", cfg.Dataset)
+	return engine, nil
+}
+
+// siteOptions are the settings every site of the server is built with.
+type siteOptions struct {
+	CORS        *web.CORSConfig
+	APIKeys     []web.APIKey
+	AdminKeys   []web.APIKey
+	IPRateLimit web.IPRateLimitConfig
+	Limits      web.ConcurrencyLimits
+	// Location overrides each city's time zone when set.
+	Location *time.Location
+	// Metrics exports per-station gauges.
+	Metrics bool
+	// Redis, when set, holds the snapshot and history caches under
+	// RedisPrefix; otherwise snapshots are cached in memory within
+	// CacheEntries and CacheBytes.
+	Redis        *redis.Client
+	RedisPrefix  string
+	RedisTTL     time.Duration
+	CacheEntries int
+	CacheBytes   int64
+	HistoryDir   string
+	ReplayStart  time.Time
+	ReplaySpeed  float64
+	Refresh      time.Duration
+	// Collect runs a collector per city every CollectEvery, evaluating the
+	// Alerts rules against the default city.
+	Collect      bool
+	CollectEvery time.Duration
+	Alerts       string
+	Validation   collector.ValidationConfig
+	Elevations   elevation.Source
+	// TierKeep, when set, keeps this much recent data in the primary of a
+	// fallback store, moving older snapshots to the fallback.
+	TierKeep time.Duration
+	// ReadOnly and Maintenance set the starting mode, which admins can switch
+	// through /admin/mode.
+	ReadOnly     bool
+	Maintenance  bool
+	MaintMessage string
+	// Parquet, when set, is where the query API reads published extracts
+	// with DuckDB (see duckDBEngine).
+	Parquet string
+}
+
+// site is one dataset served by the server: the whole deployment, or one
+// tenant of a multi-tenant server.
+type site struct {
+	// tenant is empty for a single deployment.
+	tenant         string
+	handlers       []*web.Handler
+	stationMetrics []*collector.StationMetrics
+	// handler serves every route of the site.
+	handler http.Handler
+}
+
+// newSite serves cities from dataStore, each city in its own namespace of the
+// store. multiCity, set when the cities come from a cities file, mounts every
+// city under its ID as well as the default one at the unprefixed routes.
+func newSite(tenant string, cities []city.City, multiCity bool, dataStore storage.DataStore, opts siteOptions) *site {
+	logger := slog.Default()
+	if tenant != "" {
+		logger = logger.With("tenant", tenant)
+	}
+
+	// Every city gets its own namespace in the store; the default keeps the flat layout
+	stores := make([]storage.DataStore, len(cities))
+	for i, c := range cities {
+		var err error
+		stores[i], err = storage.WithRoot(dataStore, c.StoragePrefix)
+		if err != nil {
+			log.Fatalf("Failed to set up storage for %s: %v", c.ID, err)
+		}
+		// Only the process writing snapshots may clean up after interrupted writes
+		if tsvStore, ok := stores[i].(*storage.TSVStorage); ok && opts.Collect {
+			if _, err := tsvStore.QuarantinePartial(); err != nil {
+				log.Fatalf("Failed to scan for partial snapshots: %v", err)
+			}
+		}
+	}
+
+	handler, err := web.NewHandler(stores[0], cities[0].NewFeed())
+	if err != nil {
+		log.Fatalf("Failed to create handler: %v", err)
+	}
+	if multiCity {
+		handler.SetCities(cities)
+	}
+	if opts.CORS != nil {
+		handler.EnableCORS(*opts.CORS)
+	}
+	if len(opts.APIKeys) > 0 {
+		handler.EnableAPIKeys(opts.APIKeys)
+		logger.Info("API key authentication enabled", "keys", len(opts.APIKeys))
+	}
+	if len(opts.AdminKeys) > 0 {
+		handler.EnableAdmin(opts.AdminKeys)
+	}
+	if opts.IPRateLimit.RatePerMinute > 0 {
+		handler.EnableIPRateLimit(opts.IPRateLimit)
+	}
+	handler.SetConcurrencyLimits(opts.Limits)
+	handler.SetReadOnly(opts.ReadOnly)
+	handler.SetMaintenance(opts.Maintenance, opts.MaintMessage)
+	if opts.ReadOnly || opts.Maintenance {
+		logger.Warn("Starting in restricted mode", "readOnly", opts.ReadOnly, "maintenance", opts.Maintenance)
+	}
+
+	// The default city is served by handler; the others share its middleware state
+	s := &site{tenant: tenant, handlers: []*web.Handler{handler}}
+	for i, c := range cities[1:] {
+		s.handlers = append(s.handlers, handler.ForCity(c, stores[i+1]))
+	}
+
+	// Keys in shared caches and directories are namespaced by tenant, then city
+	redisPrefix, historyDir := opts.RedisPrefix, opts.HistoryDir
+	if tenant != "" {
+		redisPrefix += tenant + ":"
+		if historyDir != "" {
+			historyDir = filepath.Join(historyDir, tenant)
+		}
+	}
+
+	for i, h := range s.handlers {
+		if opts.Metrics {
+			labels := prometheus.Labels{}
+			if tenant != "" {
+				labels["tenant"] = tenant
+			}
+			if multiCity {
+				labels["city"] = cities[i].ID
+			}
+			sm := collector.NewStationMetricsWithLabels(labels)
+			h.SetStationMetrics(sm)
+			s.stationMetrics = append(s.stationMetrics, sm)
+		}
+		if opts.Location != nil {
+			h.SetTimezone(opts.Location)
+		}
+		areas, err := cities[i].LoadAreas()
+		if err != nil {
+			log.Fatalf("Failed to load areas for %s: %v", cities[i].ID, err)
+		}
+		if areas != nil {
+			h.SetAreas(areas)
+			logger.Info("Grouping stations by area", "city", cities[i].ID, "areas", len(areas.List()))
+		}
+		if opts.Redis != nil {
+			h.SetSharedCache(cache.NewRedis(opts.Redis, redisPrefix+cities[i].ID+":"), opts.RedisTTL)
+		} else {
+			h.SetSnapshotCacheLimits(opts.CacheEntries, opts.CacheBytes)
+		}
+		if historyDir != "" {
+			h.SetHistoryCacheFile(filepath.Join(historyDir, cities[i].StoragePrefix, "history_cache.json"))
+		}
+
+		if opts.Parquet != "" {
+			engine, err := duckDBEngine(opts.Parquet, tenant, cities[i], stores[i], h)
+			if err != nil {
+				log.Fatalf("Failed to set up DuckDB queries for %s: %v", cities[i].ID, err)
+			}
+			h.SetQueryEngine(engine)
+		}
+
+		if !opts.ReplayStart.IsZero() {
+			if err := h.EnableReplay(context.Background(), web.NewReplayClock(opts.ReplayStart, opts.ReplaySpeed)); err != nil {
+				log.Fatalf("Failed to start replay: %v", err)
+			}
+		}
+
+		// Keep the latest snapshot in memory so /api/stations never waits on storage
+		h.StartLatestRefresh(context.Background(), opts.Refresh)
+
+		if opts.Collect {
+			// Alerts watch the default city only
+			var rules string
+			if i == 0 {
+				rules = opts.Alerts
+			}
+			startCollector(cities[i], stores[i], h, opts.CollectEvery, rules, opts.Validation, opts.Elevations)
+			if opts.TierKeep > 0 {
+				startTiering(cities[i], stores[i], h, opts.TierKeep)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+	if multiCity {
+		for _, h := range s.handlers {
+			if err := h.RegisterCityRoutes(mux); err != nil {
+				log.Fatalf("Failed to register city routes: %v", err)
+			}
+		}
+		logger.Info("Serving cities", "cities", len(cities), "default", cities[0].ID)
+	}
+	s.handler = handler.Middleware(mux)
+	return s
+}
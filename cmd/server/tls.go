@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsOptions selects how the server terminates HTTPS, if at all.
+type tlsOptions struct {
+	// CertFile and KeyFile are a PEM certificate chain and private key.
+	CertFile string
+	KeyFile  string
+	// AutocertHosts enables Let's Encrypt certificates for exactly these host
+	// names, cached in AutocertCache.
+	AutocertHosts []string
+	AutocertCache string
+	AutocertEmail string
+	// AutocertHTTPAddr serves ACME HTTP-01 challenges and redirects plain
+	// HTTP to HTTPS; empty relies on TLS-ALPN-01 alone.
+	AutocertHTTPAddr string
+}
+
+// validate reports conflicting or incomplete TLS flags.
+func (o tlsOptions) validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	if o.CertFile != "" && len(o.AutocertHosts) > 0 {
+		return fmt.Errorf("-tls-cert cannot be combined with -autocert-hosts")
+	}
+	return nil
+}
+
+// scheme returns the URL scheme the server is reachable on.
+func (o tlsOptions) scheme() string {
+	if o.CertFile != "" || len(o.AutocertHosts) > 0 {
+		return "https"
+	}
+	return "http"
+}
+
+// serve runs server over plain HTTP, or HTTPS per o, until it fails. The ACME
+// challenge listener shares the server's connection settings.
+func serve(server *http.Server, o tlsOptions) error {
+	switch {
+	case o.CertFile != "":
+		return server.ListenAndServeTLS(o.CertFile, o.KeyFile)
+
+	case len(o.AutocertHosts) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.AutocertHosts...),
+			Cache:      autocert.DirCache(o.AutocertCache),
+			Email:      o.AutocertEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		if server.Protocols != nil && !server.Protocols.HTTP2() {
+			// The manager offers h2 unconditionally
+			server.TLSConfig.NextProtos = slices.DeleteFunc(server.TLSConfig.NextProtos, func(p string) bool { return p == "h2" })
+		}
+
+		if o.AutocertHTTPAddr != "" {
+			go func() {
+				slog.Info("Serving ACME challenges and HTTPS redirects", "addr", o.AutocertHTTPAddr)
+				challenges := &http.Server{
+					Addr:              o.AutocertHTTPAddr,
+					Handler:           manager.HTTPHandler(nil),
+					ReadHeaderTimeout: server.ReadHeaderTimeout,
+					ReadTimeout:       server.ReadTimeout,
+					WriteTimeout:      server.WriteTimeout,
+					IdleTimeout:       server.IdleTimeout,
+					MaxHeaderBytes:    server.MaxHeaderBytes,
+				}
+				if err := challenges.ListenAndServe(); err != nil {
+					log.Fatalf("ACME challenge server error: %v", err)
+				}
+			}()
+		}
+		return server.ListenAndServeTLS("", "")
+
+	default:
+		return server.ListenAndServe()
+	}
+}
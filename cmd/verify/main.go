@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/storage"
+)
+
+func main() {
+	var (
+		dataDir  = flag.String("data-dir", "data", "Directory containing TSV data files (local mode only)")
+		useR2    = flag.Bool("r2", false, "Verify snapshots in Cloudflare R2 instead of local files")
+		useAzure = flag.Bool("azure", false, "Verify snapshots in Azure Blob Storage instead of local files")
+	)
+	flag.Parse()
+
+	var verifier storage.IntegrityVerifier
+	switch {
+	case *useAzure:
+		cfg, err := config.LoadAzureConfig()
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+		verifier, err = storage.NewAzureBlobStorage(cfg.ConnectionString, cfg.AccountURL, cfg.Container, cfg.Prefix)
+		if err != nil {
+			log.Fatalf("Failed to initialize Azure storage: %v", err)
+		}
+	case *useR2:
+		cfg, err := config.LoadR2Config()
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+		verifier, err = storage.NewR2Storage(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Endpoint, cfg.BucketName, cfg.Region, cfg.Prefix)
+		if err != nil {
+			log.Fatalf("Failed to initialize R2 storage: %v", err)
+		}
+	default:
+		verifier = storage.NewTSVStorage(*dataDir)
+	}
+	keys, err := config.LoadSnapshotKeys()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot keys: %v", err)
+	}
+	if e, ok := verifier.(storage.Encrypter); ok {
+		e.SetEncryption(keys)
+	}
+
+	report, err := verifier.VerifySnapshots(context.Background())
+	if err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+
+	fmt.Printf("Snapshots checked: %d\n", report.Checked)
+	fmt.Printf("Verified: %d\n", report.Verified)
+	fmt.Printf("Without checksum: %d\n", report.Unverified)
+	fmt.Printf("Failed: %d\n", len(report.Failures))
+
+	for _, f := range report.Failures {
+		fmt.Printf("  %s: %s\n", f.Key, f.Reason)
+	}
+
+	if len(report.Failures) > 0 {
+		os.Exit(1)
+	}
+}
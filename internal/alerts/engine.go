@@ -0,0 +1,182 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+// Alert is raised when a rule's condition has held for its configured duration,
+// and again (with Resolved set) when the condition clears.
+type Alert struct {
+	Rule        Rule
+	StationName string
+	Value       int
+	Since       time.Time
+	Timestamp   time.Time
+	Resolved    bool
+	// Text replaces the rule-based description for alerts raised outside the
+	// rules, such as feed validation failures; Rule then only carries a name.
+	Text string
+}
+
+// Message returns a human-readable description of the alert.
+func (a Alert) Message() string {
+	if a.Text != "" {
+		return fmt.Sprintf("[alert] %s: %s", a.Rule.Name, a.Text)
+	}
+
+	subject := "Network"
+	if a.Rule.StationID != 0 {
+		subject = fmt.Sprintf("Station %d", a.Rule.StationID)
+		if a.StationName != "" {
+			subject = fmt.Sprintf("%s (%s)", a.StationName, subject)
+		}
+	}
+
+	if a.Resolved {
+		return fmt.Sprintf("[resolved] %s: %s %s now %d", a.Rule.Name, subject, a.Rule.Metric, a.Value)
+	}
+	return fmt.Sprintf("[alert] %s: %s %s is %d (%s %d) since %s",
+		a.Rule.Name, subject, a.Rule.Metric, a.Value, a.Rule.Op, a.Rule.Threshold, a.Since.Format(time.RFC3339))
+}
+
+// Notifier delivers alerts to an external system.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// ruleState tracks how long a rule's condition has been true.
+type ruleState struct {
+	since  time.Time
+	firing bool
+}
+
+// Engine evaluates rules against each new snapshot and sends alerts to notifiers.
+type Engine struct {
+	rules     []Rule
+	notifiers []Notifier
+
+	mu    sync.Mutex
+	state map[string]*ruleState
+}
+
+// NewEngine creates an engine for the given rules and notifiers.
+func NewEngine(rules []Rule, notifiers ...Notifier) *Engine {
+	return &Engine{
+		rules:     rules,
+		notifiers: notifiers,
+		state:     make(map[string]*ruleState),
+	}
+}
+
+// NewEngineFromConfig creates an engine with webhook and Telegram notifiers built from cfg.
+func NewEngineFromConfig(cfg *Config) *Engine {
+	notifiers := make([]Notifier, 0, len(cfg.Webhooks))
+	for _, wh := range cfg.Webhooks {
+		notifiers = append(notifiers, NewWebhookNotifier(wh.Type, wh.URL))
+	}
+	if cfg.Telegram != nil && len(cfg.Telegram.ChatIDs) > 0 {
+		notifiers = append(notifiers, NewTelegramNotifier(cfg.Telegram))
+	}
+	return NewEngine(cfg.Rules, notifiers...)
+}
+
+// AddNotifier registers an additional delivery channel.
+func (e *Engine) AddNotifier(n Notifier) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.notifiers = append(e.notifiers, n)
+}
+
+// Evaluate checks all rules against a snapshot taken at timestamp and delivers
+// any alerts that fire or resolve. It returns the alerts that were raised.
+func (e *Engine) Evaluate(ctx context.Context, timestamp time.Time, stations []tfl.Station) []Alert {
+	byID := make(map[int]tfl.Station, len(stations))
+	for _, s := range stations {
+		byID[s.ID] = s
+	}
+
+	e.mu.Lock()
+	var raised []Alert
+	for _, rule := range e.rules {
+		value, name, ok := e.ruleValue(rule, stations, byID)
+		if !ok {
+			continue
+		}
+
+		triggered, _ := compare(rule.Op, value, rule.Threshold)
+		st := e.state[rule.Name]
+		if st == nil {
+			st = &ruleState{}
+			e.state[rule.Name] = st
+		}
+
+		if !triggered {
+			if st.firing {
+				raised = append(raised, Alert{Rule: rule, StationName: name, Value: value, Since: st.since, Timestamp: timestamp, Resolved: true})
+			}
+			*st = ruleState{}
+			continue
+		}
+
+		if st.since.IsZero() {
+			st.since = timestamp
+		}
+		if !st.firing && timestamp.Sub(st.since) >= time.Duration(rule.For) {
+			st.firing = true
+			raised = append(raised, Alert{Rule: rule, StationName: name, Value: value, Since: st.since, Timestamp: timestamp})
+		}
+	}
+	notifiers := e.notifiers
+	e.mu.Unlock()
+
+	for _, alert := range raised {
+		deliver(ctx, notifiers, alert)
+	}
+
+	return raised
+}
+
+// Notify delivers an alert raised outside the rules, such as a feed validation
+// failure, to every notifier.
+func (e *Engine) Notify(ctx context.Context, alert Alert) {
+	e.mu.Lock()
+	notifiers := e.notifiers
+	e.mu.Unlock()
+	deliver(ctx, notifiers, alert)
+}
+
+// deliver logs an alert and sends it to notifiers.
+func deliver(ctx context.Context, notifiers []Notifier, alert Alert) {
+	slog.Info("Alert raised", "rule", alert.Rule.Name, "resolved", alert.Resolved, "value", alert.Value, "message", alert.Message())
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, alert); err != nil {
+			slog.Error("Alert delivery failed", "rule", alert.Rule.Name, "error", err)
+		}
+	}
+}
+
+// ruleValue returns the value a rule is evaluated against and the station name, if any.
+// ok is false when the rule's station is not present in the snapshot.
+func (e *Engine) ruleValue(rule Rule, stations []tfl.Station, byID map[int]tfl.Station) (value int, name string, ok bool) {
+	if rule.StationID != 0 {
+		s, found := byID[rule.StationID]
+		if !found {
+			return 0, "", false
+		}
+		v, _ := metricValue(rule.Metric, s)
+		return v, s.Name, true
+	}
+
+	total := 0
+	for _, s := range stations {
+		v, _ := metricValue(rule.Metric, s)
+		total += v
+	}
+	return total, "", true
+}
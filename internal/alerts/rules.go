@@ -0,0 +1,147 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+// Metric names a station or network value a rule can be evaluated against.
+type Metric string
+
+const (
+	MetricBikes         Metric = "bikes"
+	MetricStandardBikes Metric = "standard_bikes"
+	MetricEBikes        Metric = "ebikes"
+	MetricEmptyDocks    Metric = "empty_docks"
+)
+
+// Duration is a time.Duration that unmarshals from strings like "15m".
+type Duration time.Duration
+
+// UnmarshalJSON parses a Go duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON formats the duration as a Go duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule describes a condition that should raise an alert when it holds for at least For.
+// A rule with StationID 0 is evaluated against network-wide totals.
+type Rule struct {
+	Name      string   `json:"name"`
+	StationID int      `json:"stationId,omitempty"`
+	Metric    Metric   `json:"metric"`
+	Op        string   `json:"op"` // one of <, <=, >, >=, ==
+	Threshold int      `json:"threshold"`
+	For       Duration `json:"for,omitempty"`
+}
+
+// WebhookConfig configures a single delivery target.
+type WebhookConfig struct {
+	Type string `json:"type"` // generic, slack or discord
+	URL  string `json:"url"`
+}
+
+// Config is the alerting configuration loaded from a JSON file.
+type Config struct {
+	Rules    []Rule          `json:"rules"`
+	Webhooks []WebhookConfig `json:"webhooks"`
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+}
+
+// LoadConfig reads and validates an alerting configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alerts config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse alerts config: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, rule := range cfg.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: missing name", i)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("rule %q: duplicate name", rule.Name)
+		}
+		seen[rule.Name] = true
+		if _, err := metricValue(rule.Metric, tfl.Station{}); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		if _, err := compare(rule.Op, 0, 0); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}
+
+	for i, wh := range cfg.Webhooks {
+		if wh.URL == "" {
+			return nil, fmt.Errorf("webhook %d: missing url", i)
+		}
+		switch wh.Type {
+		case "", "generic", "slack", "discord":
+		default:
+			return nil, fmt.Errorf("webhook %d: unknown type %q", i, wh.Type)
+		}
+	}
+
+	if cfg.Telegram != nil && cfg.Telegram.token() == "" {
+		return nil, fmt.Errorf("telegram: missing token (set token or TELEGRAM_BOT_TOKEN)")
+	}
+
+	return &cfg, nil
+}
+
+// metricValue returns the value of metric for a single station.
+func metricValue(metric Metric, s tfl.Station) (int, error) {
+	switch metric {
+	case MetricBikes:
+		return s.NbBikes, nil
+	case MetricStandardBikes:
+		return s.NbStandardBikes, nil
+	case MetricEBikes:
+		return s.NbEBikes, nil
+	case MetricEmptyDocks:
+		return s.NbEmptyDocks, nil
+	default:
+		return 0, fmt.Errorf("unknown metric %q", metric)
+	}
+}
+
+// compare applies op to value and threshold.
+func compare(op string, value, threshold int) (bool, error) {
+	switch op {
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case ">":
+		return value > threshold, nil
+	case ">=":
+		return value >= threshold, nil
+	case "==":
+		return value == threshold, nil
+	default:
+		return false, fmt.Errorf("unknown op %q", op)
+	}
+}
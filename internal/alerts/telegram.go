@@ -0,0 +1,270 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/tfl"
+)
+
+const (
+	// telegramAPI is the base URL of the Telegram Bot API.
+	telegramAPI = "https://api.telegram.org"
+	// telegramPollTimeout is the long-polling timeout passed to getUpdates.
+	telegramPollTimeout = 30 * time.Second
+	// maxBikesMatches caps the number of stations listed in a /bikes reply.
+	maxBikesMatches = 5
+)
+
+// TelegramConfig configures Telegram delivery and bot commands.
+// If Token is empty, the TELEGRAM_BOT_TOKEN environment variable is used.
+type TelegramConfig struct {
+	Token    string  `json:"token,omitempty"`
+	ChatIDs  []int64 `json:"chatIds"`
+	Commands bool    `json:"commands"`
+}
+
+// token returns the configured bot token, falling back to the environment
+// (TELEGRAM_BOT_TOKEN, TELEGRAM_BOT_TOKEN_FILE or a secret manager reference).
+func (c *TelegramConfig) token() string {
+	if c.Token != "" {
+		return c.Token
+	}
+	token, err := config.Secret("TELEGRAM_BOT_TOKEN")
+	if err != nil {
+		slog.Error("Failed to load Telegram bot token", "error", err)
+	}
+	return token
+}
+
+// LatestFunc returns the most recent snapshot. It is used to answer bot commands.
+type LatestFunc func(ctx context.Context) ([]tfl.Station, time.Time, error)
+
+// telegramClient is a minimal Telegram Bot API client.
+type telegramClient struct {
+	token      string
+	httpClient *http.Client
+}
+
+func newTelegramClient(token string) *telegramClient {
+	return &telegramClient{
+		token: token,
+		httpClient: &http.Client{
+			// Long polls must be allowed to outlive the poll timeout
+			Timeout: telegramPollTimeout + webhookTimeout,
+		},
+	}
+}
+
+// sendMessage sends text to a chat.
+func (c *telegramClient) sendMessage(ctx context.Context, chatID int64, text string) error {
+	body, err := json.Marshal(map[string]any{"chat_id": chatID, "text": text})
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL("sendMessage"), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// telegramUpdate is the subset of a Telegram update used by the bot.
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// getUpdates long-polls for updates after offset.
+func (c *telegramClient) getUpdates(ctx context.Context, offset int64) ([]telegramUpdate, error) {
+	q := url.Values{}
+	q.Set("offset", fmt.Sprintf("%d", offset))
+	q.Set("timeout", fmt.Sprintf("%d", int(telegramPollTimeout.Seconds())))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.methodURL("getUpdates")+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get updates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK     bool             `json:"ok"`
+		Result []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode updates: %w", err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("telegram returned ok=false (status %d)", resp.StatusCode)
+	}
+	return result.Result, nil
+}
+
+func (c *telegramClient) methodURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", telegramAPI, c.token, method)
+}
+
+// TelegramNotifier delivers alerts as Telegram messages to a fixed set of chats.
+type TelegramNotifier struct {
+	client  *telegramClient
+	chatIDs []int64
+}
+
+// NewTelegramNotifier creates a notifier from cfg.
+func NewTelegramNotifier(cfg *TelegramConfig) *TelegramNotifier {
+	return &TelegramNotifier{
+		client:  newTelegramClient(cfg.token()),
+		chatIDs: cfg.ChatIDs,
+	}
+}
+
+// Notify sends the alert message to every configured chat.
+func (n *TelegramNotifier) Notify(ctx context.Context, alert Alert) error {
+	var errs []string
+	for _, id := range n.chatIDs {
+		if err := n.client.sendMessage(ctx, id, alert.Message()); err != nil {
+			errs = append(errs, fmt.Sprintf("chat %d: %v", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("telegram delivery failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// TelegramBot answers simple commands from the latest snapshot.
+//
+// Supported commands:
+//
+//	/bikes <station name>  bike and dock counts for matching stations
+//	/help                  list commands
+type TelegramBot struct {
+	client *telegramClient
+	latest LatestFunc
+}
+
+// NewTelegramBot creates a bot that reads station data via latest.
+func NewTelegramBot(cfg *TelegramConfig, latest LatestFunc) *TelegramBot {
+	return &TelegramBot{
+		client: newTelegramClient(cfg.token()),
+		latest: latest,
+	}
+}
+
+// Run polls for commands until ctx is cancelled.
+func (b *TelegramBot) Run(ctx context.Context) {
+	slog.Info("Telegram bot started")
+
+	var offset int64
+	for {
+		updates, err := b.client.getUpdates(ctx, offset)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("Telegram polling failed", "error", err)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil {
+				continue
+			}
+			reply := b.handleCommand(ctx, u.Message.Text)
+			if reply == "" {
+				continue
+			}
+			if err := b.client.sendMessage(ctx, u.Message.Chat.ID, reply); err != nil {
+				slog.Error("Telegram reply failed", "error", err)
+			}
+		}
+	}
+}
+
+// handleCommand returns the reply for a message, or "" if it is not a command.
+func (b *TelegramBot) handleCommand(ctx context.Context, text string) string {
+	cmd, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	// Commands in groups may be addressed as /bikes@BotName
+	cmd, _, _ = strings.Cut(cmd, "@")
+
+	switch cmd {
+	case "/start", "/help":
+		return "Send /bikes <station name> to see current availability."
+	case "/bikes":
+		return b.bikesReply(ctx, strings.TrimSpace(args))
+	default:
+		return ""
+	}
+}
+
+// bikesReply lists availability for stations whose name contains query.
+func (b *TelegramBot) bikesReply(ctx context.Context, query string) string {
+	if query == "" {
+		return "Usage: /bikes <station name>"
+	}
+
+	stations, timestamp, err := b.latest(ctx)
+	if err != nil {
+		slog.Error("Telegram failed to read latest snapshot", "error", err)
+		return "Sorry, station data is unavailable right now."
+	}
+
+	q := strings.ToLower(query)
+	var lines []string
+	matches := 0
+	for _, s := range stations {
+		if !strings.Contains(strings.ToLower(s.Name), q) {
+			continue
+		}
+		matches++
+		if matches <= maxBikesMatches {
+			lines = append(lines, fmt.Sprintf("%s: %d bikes (%d e-bikes), %d empty docks",
+				s.Name, s.NbBikes, s.NbEBikes, s.NbEmptyDocks))
+		}
+	}
+
+	if matches == 0 {
+		return fmt.Sprintf("No stations matching %q.", query)
+	}
+	if matches > maxBikesMatches {
+		lines = append(lines, fmt.Sprintf("...and %d more. Try a more specific name.", matches-maxBikesMatches))
+	}
+	lines = append(lines, "As of "+timestamp.Format("15:04 MST"))
+	return strings.Join(lines, "\n")
+}
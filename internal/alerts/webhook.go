@@ -0,0 +1,98 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds each delivery attempt.
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier POSTs alerts to a URL using a generic, Slack or Discord payload.
+type WebhookNotifier struct {
+	kind       string
+	url        string
+	httpClient *http.Client
+}
+
+// NewWebhookNotifier creates a notifier. kind is "generic", "slack" or "discord";
+// an empty kind is treated as generic.
+func NewWebhookNotifier(kind, url string) *WebhookNotifier {
+	if kind == "" {
+		kind = "generic"
+	}
+	return &WebhookNotifier{
+		kind: kind,
+		url:  url,
+		httpClient: &http.Client{
+			Timeout: webhookTimeout,
+		},
+	}
+}
+
+// genericPayload is the JSON body sent to generic webhooks.
+type genericPayload struct {
+	Rule        string    `json:"rule"`
+	StationID   int       `json:"stationId,omitempty"`
+	StationName string    `json:"stationName,omitempty"`
+	Metric      Metric    `json:"metric"`
+	Value       int       `json:"value"`
+	Threshold   int       `json:"threshold"`
+	Op          string    `json:"op"`
+	Since       time.Time `json:"since"`
+	Timestamp   time.Time `json:"timestamp"`
+	Resolved    bool      `json:"resolved"`
+	Message     string    `json:"message"`
+}
+
+// Notify delivers a single alert.
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	var payload any
+	switch n.kind {
+	case "slack":
+		payload = map[string]string{"text": alert.Message()}
+	case "discord":
+		payload = map[string]string{"content": alert.Message()}
+	default:
+		payload = genericPayload{
+			Rule:        alert.Rule.Name,
+			StationID:   alert.Rule.StationID,
+			StationName: alert.StationName,
+			Metric:      alert.Rule.Metric,
+			Value:       alert.Value,
+			Threshold:   alert.Rule.Threshold,
+			Op:          alert.Rule.Op,
+			Since:       alert.Since,
+			Timestamp:   alert.Timestamp,
+			Resolved:    alert.Resolved,
+			Message:     alert.Message(),
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "city-cycling/1.0")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// Package analytics computes derived metrics from sequences of snapshots.
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// Accumulator consumes snapshots in chronological order and builds up a result.
+type Accumulator interface {
+	Add(snap storage.Snapshot)
+}
+
+// Run feeds every snapshot in [from, to] to each accumulator, oldest first.
+func Run(ctx context.Context, store storage.RangeDataStore, from, to time.Time, accs ...Accumulator) error {
+	return store.ForEachSnapshot(ctx, from, to, func(snap storage.Snapshot) error {
+		for _, acc := range accs {
+			acc.Add(snap)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,33 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl/tfltest"
+)
+
+// benchmarkStart is when the benchmark snapshots begin.
+var benchmarkStart = time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC)
+
+// benchmarkSnapshots returns a day of 5-minute snapshots of a synthetic
+// network the size of London's, about 230,000 readings.
+func benchmarkSnapshots() []storage.Snapshot {
+	feed := tfltest.NewFeed(tfltest.Config{Seed: 1})
+	return feed.Snapshots(288, benchmarkStart, 5*time.Minute)
+}
+
+// BenchmarkSummaryBuilder builds the network summary of a day of snapshots.
+func BenchmarkSummaryBuilder(b *testing.B) {
+	snaps := benchmarkSnapshots()
+	from, to := snaps[0].Timestamp, snaps[len(snaps)-1].Timestamp
+	b.ReportAllocs()
+	for b.Loop() {
+		builder := NewSummaryBuilder(from, to)
+		for _, snap := range snaps {
+			builder.Add(snap)
+		}
+		builder.Result(10)
+	}
+}
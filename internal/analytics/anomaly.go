@@ -0,0 +1,216 @@
+package analytics
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// Station status values reported by the anomaly detector.
+const (
+	StatusOK           = "ok"
+	StatusStale        = "stale"         // counts unchanged for abnormally long
+	StatusDocksChanged = "docks_changed" // nbDocks changed recently
+)
+
+const (
+	// DefaultStaleAfter is how long a station's counts may stay unchanged before it
+	// is considered stale rather than merely quiet.
+	DefaultStaleAfter = 24 * time.Hour
+	// DefaultDocksChangedFor is how long a station stays flagged after its dock count changes.
+	DefaultDocksChangedFor = 24 * time.Hour
+	// DefaultBrokenDockReadings is how many consecutive readings must each be
+	// missing docks (see DockMismatch) before that many are presumed broken:
+	// an hour of 5-minute snapshots.
+	DefaultBrokenDockReadings = 12
+)
+
+// StationAnomaly describes a station flagged by the detector.
+type StationAnomaly struct {
+	StationID int       `json:"stationId"`
+	Status    string    `json:"status"`
+	Since     time.Time `json:"since"`
+	PrevDocks int       `json:"prevDocks,omitempty"`
+	Docks     int       `json:"docks,omitempty"`
+}
+
+// anomalyState is the per-station state the detector keeps between snapshots.
+type anomalyState struct {
+	Bikes          int       `json:"bikes"`
+	EBikes         int       `json:"ebikes"`
+	EmptyDocks     int       `json:"emptyDocks"`
+	Docks          int       `json:"docks"`
+	LastChange     time.Time `json:"lastChange"`
+	PrevDocks      int       `json:"prevDocks,omitempty"`
+	DocksChangedAt time.Time `json:"docksChangedAt,omitempty"`
+	// Missing holds DockMismatch of the latest readings, oldest first: up to
+	// BrokenDockReadings before the latest, and the latest.
+	Missing []int `json:"missing,omitempty"`
+}
+
+// AnomalyDetector flags stations whose readings look like feed or hardware faults.
+// Its state can be saved and restored so detection survives restarts.
+type AnomalyDetector struct {
+	StaleAfter      time.Duration
+	DocksChangedFor time.Duration
+	// BrokenDockReadings is how many readings DockAdjustments looks back on.
+	BrokenDockReadings int
+
+	lastSeen time.Time
+	stations map[int]*anomalyState
+}
+
+// NewAnomalyDetector creates a detector with default thresholds.
+func NewAnomalyDetector() *AnomalyDetector {
+	return &AnomalyDetector{
+		StaleAfter:         DefaultStaleAfter,
+		DocksChangedFor:    DefaultDocksChangedFor,
+		BrokenDockReadings: DefaultBrokenDockReadings,
+		stations:           make(map[int]*anomalyState),
+	}
+}
+
+// LastSeen returns the timestamp of the most recent snapshot added.
+func (d *AnomalyDetector) LastSeen() time.Time {
+	return d.lastSeen
+}
+
+// Add records a snapshot. Snapshots at or before the last one added are ignored.
+func (d *AnomalyDetector) Add(snap storage.Snapshot) {
+	if !snap.Timestamp.After(d.lastSeen) {
+		return
+	}
+	d.lastSeen = snap.Timestamp
+
+	for _, s := range snap.Stations {
+		st, seen := d.stations[s.ID]
+		if !seen {
+			d.stations[s.ID] = &anomalyState{
+				Bikes:      s.NbBikes,
+				EBikes:     s.NbEBikes,
+				EmptyDocks: s.NbEmptyDocks,
+				Docks:      s.NbDocks,
+				LastChange: snap.Timestamp,
+				Missing:    []int{DockMismatch(s.NbBikes, s.NbEmptyDocks, s.NbDocks)},
+			}
+			continue
+		}
+
+		if s.NbBikes != st.Bikes || s.NbEBikes != st.EBikes || s.NbEmptyDocks != st.EmptyDocks {
+			st.LastChange = snap.Timestamp
+		}
+		if s.NbDocks != st.Docks {
+			st.PrevDocks = st.Docks
+			st.DocksChangedAt = snap.Timestamp
+			st.LastChange = snap.Timestamp
+		}
+
+		st.Bikes = s.NbBikes
+		st.EBikes = s.NbEBikes
+		st.EmptyDocks = s.NbEmptyDocks
+		st.Docks = s.NbDocks
+		st.Missing = append(st.Missing, DockMismatch(s.NbBikes, s.NbEmptyDocks, s.NbDocks))
+		if extra := len(st.Missing) - d.BrokenDockReadings - 1; extra > 0 {
+			st.Missing = slices.Delete(st.Missing, 0, extra)
+		}
+	}
+}
+
+// DockAdjustment is a correction to a station's free docks in the latest
+// snapshot, for docks presumed broken.
+type DockAdjustment struct {
+	// PresumedBroken is the fewest docks missing in any of the readings
+	// before the latest, all of which were missing some.
+	PresumedBroken int
+	// EmptyDocks is the adjusted free dock count: free docks cannot exceed
+	// the docks less those presumed broken and those holding a bike, so when
+	// the latest reading is missing fewer docks than are presumed broken, the
+	// difference is taken off its free docks.
+	EmptyDocks int
+}
+
+// DockAdjustments returns the stations in the last snapshot added whose free
+// docks are adjusted for docks presumed broken, keyed by station ID. A station
+// is presumed to have broken docks once each of its last BrokenDockReadings
+// readings before the latest was missing docks.
+func (d *AnomalyDetector) DockAdjustments() map[int]DockAdjustment {
+	result := make(map[int]DockAdjustment)
+	for id, st := range d.stations {
+		if d.BrokenDockReadings <= 0 || len(st.Missing) != d.BrokenDockReadings+1 {
+			continue
+		}
+		previous, latest := st.Missing[:len(st.Missing)-1], st.Missing[len(st.Missing)-1]
+		broken := slices.Min(previous)
+		if broken <= 0 || latest >= broken {
+			continue
+		}
+		result[id] = DockAdjustment{
+			PresumedBroken: broken,
+			EmptyDocks:     max(0, st.EmptyDocks-(broken-latest)),
+		}
+	}
+	return result
+}
+
+// Anomalies returns the stations currently flagged, keyed by station ID,
+// evaluated as of the last snapshot added.
+func (d *AnomalyDetector) Anomalies() map[int]StationAnomaly {
+	result := make(map[int]StationAnomaly)
+	for id, st := range d.stations {
+		switch {
+		case !st.DocksChangedAt.IsZero() && d.lastSeen.Sub(st.DocksChangedAt) < d.DocksChangedFor:
+			result[id] = StationAnomaly{
+				StationID: id,
+				Status:    StatusDocksChanged,
+				Since:     st.DocksChangedAt,
+				PrevDocks: st.PrevDocks,
+				Docks:     st.Docks,
+			}
+		case d.lastSeen.Sub(st.LastChange) >= d.StaleAfter:
+			result[id] = StationAnomaly{
+				StationID: id,
+				Status:    StatusStale,
+				Since:     st.LastChange,
+			}
+		}
+	}
+	return result
+}
+
+// detectorState is the serialized form of an AnomalyDetector.
+type detectorState struct {
+	LastSeen  time.Time             `json:"lastSeen"`
+	Stations  map[int]*anomalyState `json:"stations"`
+	Anomalies []StationAnomaly      `json:"anomalies"`
+}
+
+// MarshalJSON saves the detector state along with the current anomalies.
+func (d *AnomalyDetector) MarshalJSON() ([]byte, error) {
+	state := detectorState{
+		LastSeen:  d.lastSeen,
+		Stations:  d.stations,
+		Anomalies: make([]StationAnomaly, 0),
+	}
+	for _, a := range d.Anomalies() {
+		state.Anomalies = append(state.Anomalies, a)
+	}
+	sort.Slice(state.Anomalies, func(i, j int) bool { return state.Anomalies[i].StationID < state.Anomalies[j].StationID })
+	return json.Marshal(state)
+}
+
+// UnmarshalJSON restores detector state saved with MarshalJSON.
+func (d *AnomalyDetector) UnmarshalJSON(data []byte) error {
+	var state detectorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	d.lastSeen = state.LastSeen
+	d.stations = state.Stations
+	if d.stations == nil {
+		d.stations = make(map[int]*anomalyState)
+	}
+	return nil
+}
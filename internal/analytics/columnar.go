@@ -0,0 +1,216 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Frame holds the readings of a sequence of snapshots in columnar form: one
+// parallel int32 slice per reading field, with station names and positions
+// kept once per station instead of once per reading. Aggregations over frames
+// touch only the columns they need, and a reading takes 24 bytes instead of
+// the 136 of a tfl.Station.
+//
+// A frame is built by adding snapshots oldest first, and converted back to
+// snapshots with Snapshot where a result leaves the analytics package.
+type Frame struct {
+	// timestamps holds each snapshot's time; offsets[i] is the first row of
+	// snapshot i, with a final entry one past the last row.
+	timestamps []time.Time
+	offsets    []int
+
+	// One entry per row. station indexes the station columns below.
+	station       []int32
+	bikes         []int32
+	standardBikes []int32
+	ebikes        []int32
+	emptyDocks    []int32
+	docks         []int32
+
+	// One entry per station, holding its latest name and position.
+	ids   []int
+	names []string
+	lats  []float64
+	longs []float64
+	index map[int]int32
+}
+
+// NewFrame creates an empty frame.
+func NewFrame() *Frame {
+	return &Frame{offsets: []int{0}, index: make(map[int]int32)}
+}
+
+// FrameOf builds a frame from snapshots ordered oldest first.
+func FrameOf(snaps []storage.Snapshot) *Frame {
+	f := NewFrame()
+	for _, snap := range snaps {
+		f.Add(snap)
+	}
+	return f
+}
+
+// Add implements Accumulator. Snapshots must be added oldest first.
+func (f *Frame) Add(snap storage.Snapshot) {
+	f.timestamps = append(f.timestamps, snap.Timestamp)
+	for _, s := range snap.Stations {
+		f.station = append(f.station, f.stationIndex(s.ID, s.Name, s.Lat, s.Long))
+		f.bikes = append(f.bikes, int32(s.NbBikes))
+		f.standardBikes = append(f.standardBikes, int32(s.NbStandardBikes))
+		f.ebikes = append(f.ebikes, int32(s.NbEBikes))
+		f.emptyDocks = append(f.emptyDocks, int32(s.NbEmptyDocks))
+		f.docks = append(f.docks, int32(s.NbDocks))
+	}
+	f.offsets = append(f.offsets, len(f.station))
+}
+
+// stationIndex returns the index of a station's columns, adding the station
+// when it is new and otherwise updating its name and position to the latest.
+func (f *Frame) stationIndex(id int, name string, lat, long float64) int32 {
+	i, ok := f.index[id]
+	if !ok {
+		i = int32(len(f.ids))
+		f.index[id] = i
+		f.ids = append(f.ids, id)
+		f.names = append(f.names, name)
+		f.lats = append(f.lats, lat)
+		f.longs = append(f.longs, long)
+		return i
+	}
+	f.names[i], f.lats[i], f.longs[i] = name, lat, long
+	return i
+}
+
+// Len returns the number of snapshots in the frame.
+func (f *Frame) Len() int {
+	return len(f.timestamps)
+}
+
+// Rows returns the number of station readings in the frame.
+func (f *Frame) Rows() int {
+	return len(f.station)
+}
+
+// Timestamp returns the time of snapshot i.
+func (f *Frame) Timestamp(i int) time.Time {
+	return f.timestamps[i]
+}
+
+// Snapshot converts snapshot i back to station readings. Names and positions
+// are the latest the frame holds for each station.
+func (f *Frame) Snapshot(i int) storage.Snapshot {
+	start, end := f.offsets[i], f.offsets[i+1]
+	stations := make([]tfl.Station, 0, end-start)
+	for row := start; row < end; row++ {
+		st := f.station[row]
+		stations = append(stations, tfl.Station{
+			ID:              f.ids[st],
+			Name:            f.names[st],
+			Lat:             f.lats[st],
+			Long:            f.longs[st],
+			NbBikes:         int(f.bikes[row]),
+			NbStandardBikes: int(f.standardBikes[row]),
+			NbEBikes:        int(f.ebikes[row]),
+			NbEmptyDocks:    int(f.emptyDocks[row]),
+			NbDocks:         int(f.docks[row]),
+		})
+	}
+	return storage.Snapshot{Timestamp: f.timestamps[i], Stations: stations}
+}
+
+// StationSamples returns the readings of each of ids in snapshots [start, end),
+// oldest first.
+func (f *Frame) StationSamples(ids []int, start, end int) map[int][]storage.StationSample {
+	series := make(map[int][]storage.StationSample, len(ids))
+	want := make([]bool, len(f.ids))
+	for _, id := range ids {
+		series[id] = nil
+		if i, ok := f.index[id]; ok {
+			want[i] = true
+		}
+	}
+	for snap := start; snap < end; snap++ {
+		for row := f.offsets[snap]; row < f.offsets[snap+1]; row++ {
+			st := f.station[row]
+			if !want[st] {
+				continue
+			}
+			id := f.ids[st]
+			series[id] = append(series[id], storage.StationSample{
+				Timestamp:       f.timestamps[snap],
+				NbBikes:         int(f.bikes[row]),
+				NbStandardBikes: int(f.standardBikes[row]),
+				NbEBikes:        int(f.ebikes[row]),
+				NbEmptyDocks:    int(f.emptyDocks[row]),
+				NbDocks:         int(f.docks[row]),
+			})
+		}
+	}
+	return series
+}
+
+// Range returns the half-open range of snapshots taken in [from, to].
+func (f *Frame) Range(from, to time.Time) (start, end int) {
+	start = sort.Search(len(f.timestamps), func(i int) bool { return !f.timestamps[i].Before(from) })
+	end = sort.Search(len(f.timestamps), func(i int) bool { return f.timestamps[i].After(to) })
+	return start, max(start, end)
+}
+
+// Append adds every snapshot of o, all of which must be newer than those of f.
+func (f *Frame) Append(o *Frame) {
+	remap := make([]int32, len(o.ids))
+	for i, id := range o.ids {
+		remap[i] = f.stationIndex(id, o.names[i], o.lats[i], o.longs[i])
+	}
+	base := len(f.station)
+	for _, st := range o.station {
+		f.station = append(f.station, remap[st])
+	}
+	f.bikes = append(f.bikes, o.bikes...)
+	f.standardBikes = append(f.standardBikes, o.standardBikes...)
+	f.ebikes = append(f.ebikes, o.ebikes...)
+	f.emptyDocks = append(f.emptyDocks, o.emptyDocks...)
+	f.docks = append(f.docks, o.docks...)
+	f.timestamps = append(f.timestamps, o.timestamps...)
+	for _, off := range o.offsets[1:] {
+		f.offsets = append(f.offsets, base+off)
+	}
+}
+
+// DropBefore removes the snapshots taken before t, reusing the columns'
+// storage for the rows that remain.
+func (f *Frame) DropBefore(t time.Time) {
+	n, _ := f.Range(t, t)
+	if n == 0 {
+		return
+	}
+	rows := f.offsets[n]
+	for _, col := range []*[]int32{&f.station, &f.bikes, &f.standardBikes, &f.ebikes, &f.emptyDocks, &f.docks} {
+		*col = (*col)[:copy(*col, (*col)[rows:])]
+	}
+	f.timestamps = f.timestamps[:copy(f.timestamps, f.timestamps[n:])]
+	f.offsets = f.offsets[:copy(f.offsets, f.offsets[n:])]
+	for i := range f.offsets {
+		f.offsets[i] -= rows
+	}
+}
+
+// metric returns the column holding m, or nil for occupancy and count, which
+// have no column of their own.
+func (f *Frame) metric(m Metric) []int32 {
+	switch m {
+	case MetricBikes:
+		return f.bikes
+	case MetricStandardBikes:
+		return f.standardBikes
+	case MetricEBikes:
+		return f.ebikes
+	case MetricEmptyDocks:
+		return f.emptyDocks
+	case MetricDocks:
+		return f.docks
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+// benchmarkQuery averages occupancy and bikes by station and hour.
+var benchmarkQuery = Query{
+	Select:  []Aggregate{{Func: AggAvg, Metric: MetricOccupancy}, {Func: AggMax, Metric: MetricBikes}, {Func: AggCount}},
+	GroupBy: []Dimension{DimStation, DimHour},
+	From:    benchmarkStart,
+	To:      benchmarkStart.Add(24 * time.Hour),
+	Limit:   MaxQueryRows,
+}
+
+// BenchmarkQueryAccumulator runs a query over snapshots of stations.
+func BenchmarkQueryAccumulator(b *testing.B) {
+	snaps := benchmarkSnapshots()
+	b.ReportAllocs()
+	for b.Loop() {
+		acc := NewQueryAccumulator(benchmarkQuery)
+		for _, snap := range snaps {
+			acc.Add(snap)
+		}
+		acc.Result()
+	}
+}
+
+// BenchmarkExecuteFrame runs the same query over the snapshots in a frame.
+func BenchmarkExecuteFrame(b *testing.B) {
+	f := FrameOf(benchmarkSnapshots())
+	b.ReportAllocs()
+	for b.Loop() {
+		ExecuteFrame(f, benchmarkQuery)
+	}
+}
@@ -0,0 +1,277 @@
+package analytics
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// DefaultColumnarWindow is how much recent history a ColumnarEngine keeps in
+// memory, about 40 MB for 800 stations snapshotted every 5 minutes.
+const DefaultColumnarWindow = 7 * 24 * time.Hour
+
+// groupKey holds the time dimensions of a query group, one code for each of
+// up to five dimensions: an hour, a weekday, or an index into the dates seen.
+type groupKey [5]int32
+
+// ExecuteFrame runs q over the snapshots of f taken in [q.From, q.To]. It
+// returns the same result as scanning those snapshots, except that station
+// names and areas follow each station's latest name and position in f.
+func ExecuteFrame(f *Frame, q Query) *QueryResult {
+	start, end := f.Range(q.From, q.To)
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var include []bool
+	if len(q.Stations) > 0 {
+		include = make([]bool, len(f.ids))
+		for _, id := range q.Stations {
+			if i, ok := f.index[id]; ok {
+				include[i] = true
+			}
+		}
+	}
+
+	// Areas depend only on the station and dates only on the snapshot, so
+	// both are worked out once rather than per reading
+	var areas, dates []string
+	var stationAreas []int32
+	if slices.Contains(q.GroupBy, DimArea) {
+		codes := make(map[string]int32)
+		stationAreas = make([]int32, len(f.ids))
+		for i := range f.ids {
+			area := q.Areas.Locate(f.lats[i], f.longs[i])
+			code, ok := codes[area]
+			if !ok {
+				code = int32(len(areas))
+				codes[area] = code
+				areas = append(areas, area)
+			}
+			stationAreas[i] = code
+		}
+	}
+	dateCodes := make(map[string]int32)
+
+	columns := make([][]int32, len(q.Select))
+	for i, agg := range q.Select {
+		columns[i] = f.metric(agg.Metric)
+	}
+
+	// A reading's group depends on its snapshot's time dimensions and on its
+	// station, or only its area when not grouping by station. Each reading so
+	// finds its group by index in the table for its snapshot's time
+	// dimensions: slot 0, or the station's column index or area code.
+	tableSize := 1
+	byStation := slices.Contains(q.GroupBy, DimStation)
+	var slots []int32
+	switch {
+	case byStation:
+		tableSize = len(f.ids)
+	case stationAreas != nil:
+		tableSize, slots = len(areas), stationAreas
+	}
+	tables := make(map[groupKey][]*queryGroup)
+	var groups []*queryGroup
+	for snap := start; snap < end; snap++ {
+		var key groupKey
+		ts := f.timestamps[snap].In(loc)
+		for i, d := range q.GroupBy {
+			switch d {
+			case DimHour:
+				key[i] = int32(ts.Hour())
+			case DimWeekday:
+				key[i] = int32(ts.Weekday())
+			case DimDate:
+				date := ts.Format("2006-01-02")
+				code, ok := dateCodes[date]
+				if !ok {
+					code = int32(len(dates))
+					dateCodes[date] = code
+					dates = append(dates, date)
+				}
+				key[i] = code
+			}
+		}
+		table, ok := tables[key]
+		if !ok {
+			table = make([]*queryGroup, tableSize)
+			tables[key] = table
+		}
+
+		for row := f.offsets[snap]; row < f.offsets[snap+1]; row++ {
+			st := f.station[row]
+			if include != nil && !include[st] {
+				continue
+			}
+			var slot int32
+			switch {
+			case byStation:
+				slot = st
+			case slots != nil:
+				slot = slots[st]
+			}
+
+			g := table[slot]
+			if g == nil {
+				g = &queryGroup{key: make([]any, len(q.GroupBy)), aggs: make([]aggState, len(q.Select))}
+				for i, d := range q.GroupBy {
+					switch d {
+					case DimStation:
+						g.key[i] = f.ids[st]
+					case DimDate:
+						g.key[i] = dates[key[i]]
+					case DimArea:
+						g.key[i] = areas[stationAreas[st]]
+					default:
+						g.key[i] = int(key[i])
+					}
+				}
+				table[slot] = g
+				groups = append(groups, g)
+			}
+
+			for i, agg := range q.Select {
+				switch {
+				case columns[i] != nil:
+					g.aggs[i].add(float64(columns[i][row]))
+				case agg.Metric == MetricOccupancy:
+					if docks := f.docks[row]; docks != 0 {
+						g.aggs[i].add(float64(f.bikes[row]) / float64(docks))
+					}
+				default:
+					// count has no metric and counts every reading
+					g.aggs[i].add(0)
+				}
+			}
+		}
+	}
+
+	name := func(id int) string { return f.names[f.index[id]] }
+	return queryResult(q, groups, name, end-start)
+}
+
+// ColumnarEngine executes queries over a frame of recent snapshots held in
+// memory, reading from the store only the snapshots it has not loaded yet.
+// Queries reaching further back than its window before the newest snapshot
+// are scanned from the store instead. Queries over the frame run one at a time.
+type ColumnarEngine struct {
+	store  storage.RangeDataStore
+	window time.Duration
+
+	mu    sync.Mutex
+	frame *Frame // nil until the first query
+	// Every stored snapshot in [from, to] is in frame. to is the newest
+	// snapshot loaded, so snapshots stored after it are read by the next query.
+	from, to time.Time
+}
+
+// NewColumnarEngine creates an engine keeping the last window of snapshots
+// from store in memory, DefaultColumnarWindow when window is 0.
+func NewColumnarEngine(store storage.RangeDataStore, window time.Duration) *ColumnarEngine {
+	if window <= 0 {
+		window = DefaultColumnarWindow
+	}
+	return &ColumnarEngine{store: store, window: window}
+}
+
+// Execute runs q over every snapshot in [q.From, q.To].
+func (e *ColumnarEngine) Execute(ctx context.Context, q Query) (*QueryResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	newest := q.To
+	if e.frame != nil && e.to.After(newest) {
+		newest = e.to
+	}
+	if q.From.Before(newest.Add(-e.window)) {
+		e.mu.Unlock()
+		return ScanEngine{Store: e.store}.Execute(ctx, q)
+	}
+	defer e.mu.Unlock()
+
+	if err := e.load(ctx, q.From, q.To); err != nil {
+		return nil, err
+	}
+	return ExecuteFrame(e.frame, q), nil
+}
+
+// StationSeries returns the readings of each of ids taken in [from, to],
+// oldest first, from the frame, or from the store like Execute when from is
+// further back than the window.
+func (e *ColumnarEngine) StationSeries(ctx context.Context, ids []int, from, to time.Time) (map[int][]storage.StationSample, error) {
+	e.mu.Lock()
+	newest := to
+	if e.frame != nil && e.to.After(newest) {
+		newest = e.to
+	}
+	if from.Before(newest.Add(-e.window)) {
+		e.mu.Unlock()
+		return storage.StationsSeries(ctx, e.store, ids, from, to)
+	}
+	defer e.mu.Unlock()
+
+	if err := e.load(ctx, from, to); err != nil {
+		return nil, err
+	}
+	start, end := e.frame.Range(from, to)
+	return e.frame.StationSamples(ids, start, end), nil
+}
+
+// load extends the frame to hold every snapshot in [from, to], and drops the
+// snapshots that have fallen out of the window.
+func (e *ColumnarEngine) load(ctx context.Context, from, to time.Time) error {
+	// Starting over is cheaper than filling a gap before the range
+	if e.frame == nil || from.After(e.to) {
+		f := NewFrame()
+		if err := Run(ctx, e.store, from, to, f); err != nil {
+			return err
+		}
+		e.frame, e.from, e.to = f, from, from
+		if f.Len() > 0 {
+			e.to = f.Timestamp(f.Len() - 1)
+		}
+		return nil
+	}
+
+	if from.Before(e.from) {
+		older := NewFrame()
+		if err := Run(ctx, e.store, from, e.from.Add(-time.Nanosecond), older); err != nil {
+			return err
+		}
+		older.Append(e.frame)
+		e.frame, e.from = older, from
+	}
+	if to.After(e.to) {
+		newer := NewFrame()
+		if err := Run(ctx, e.store, e.to.Add(time.Nanosecond), to, newer); err != nil {
+			return err
+		}
+		e.frame.Append(newer)
+		if newer.Len() > 0 {
+			e.to = newer.Timestamp(newer.Len() - 1)
+		}
+	}
+
+	// Compact once an eighth of the window is stale rather than on every new snapshot
+	horizon := e.to.Add(-e.window)
+	if e.from.Before(horizon.Add(-e.window / 8)) {
+		e.frame.DropBefore(horizon)
+		e.from = horizon
+	}
+	return nil
+}
+
+// Reset drops the snapshots held in memory, so the next query reads them
+// again. Call it when stored snapshots change other than by new ones being added.
+func (e *ColumnarEngine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.frame = nil
+}
@@ -0,0 +1,189 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// DefaultChronicShare is the fraction of a station's readings that must fail
+// to add up before DockAuditor reports its docks as chronically broken.
+const DefaultChronicShare = 0.5
+
+// DockMismatch is how far a station's reading fails to add up: positive when
+// docks are reported that hold neither a bike nor a free space, which is how a
+// dock out of service shows in the feed, and negative when the feed reports
+// more bikes and free docks than the station has.
+func DockMismatch(nbBikes, nbEmptyDocks, nbDocks int) int {
+	return nbDocks - nbBikes - nbEmptyDocks
+}
+
+// StationDockAudit is how consistently a station's readings added up.
+type StationDockAudit struct {
+	StationID int
+	Name      string
+	Readings  int
+	// Mismatched counts the readings where bikes + empty docks != docks, and
+	// MismatchShare is their fraction of Readings.
+	Mismatched    int
+	MismatchShare float64
+	// AvgMissing is the average number of docks unaccounted for over the
+	// mismatched readings; MaxMissing and MinMissing are the extremes (a
+	// negative MinMissing means the station was over-reported).
+	AvgMissing float64
+	MaxMissing int
+	MinMissing int
+	// LongestStreak is the longest run of consecutive mismatched readings,
+	// and Ongoing is set when the latest reading was mismatched too.
+	LongestStreak int
+	Ongoing       bool
+	FirstMismatch time.Time
+	LastMismatch  time.Time
+	// Latest is the time of the latest reading, ReportedDocks its dock
+	// count and InServiceDocks the docks holding a bike or free: the cleaned
+	// dock count. LatestMissing is the difference.
+	Latest         time.Time
+	ReportedDocks  int
+	InServiceDocks int
+	LatestMissing  int
+	// Chronic is set when MismatchShare reached the auditor's chronic share;
+	// EstimatedBroken is then the typical number of docks missing.
+	Chronic         bool
+	EstimatedBroken int
+}
+
+// DockAuditReport is the result of a DockAuditor.
+type DockAuditReport struct {
+	SnapshotCount int
+	// Readings and Mismatched cover every station reading in the window.
+	Readings      int
+	Mismatched    int
+	MismatchShare float64
+	// Chronic lists the stations whose MismatchShare reached the chronic
+	// share, most often mismatched first: likely broken docks.
+	Chronic []StationDockAudit
+	// Stations lists every station with at least one mismatched reading, by ID.
+	Stations []StationDockAudit
+}
+
+// dockStation is what the auditor tracks per station.
+type dockStation struct {
+	name                        string
+	readings, mismatched        int
+	sumMissing                  int64
+	maxMissing, minMissing      int
+	streak, longest             int
+	firstMismatch, lastMismatch time.Time
+	latest                      time.Time
+	reported, inService         int
+}
+
+// DockAuditor checks that every station reading adds up, nbBikes +
+// nbEmptyDocks = nbDocks, and tracks the stations that chronically do not:
+// TfL's feed reports docks out of service as neither holding a bike nor free.
+type DockAuditor struct {
+	chronicShare float64
+	snapshots    int
+	stations     map[int]*dockStation
+}
+
+// NewDockAuditor creates an auditor reporting stations as chronic when at
+// least chronicShare of their readings are mismatched; a share <= 0 uses
+// DefaultChronicShare.
+func NewDockAuditor(chronicShare float64) *DockAuditor {
+	if chronicShare <= 0 {
+		chronicShare = DefaultChronicShare
+	}
+	return &DockAuditor{chronicShare: chronicShare, stations: make(map[int]*dockStation)}
+}
+
+// Add records a snapshot. Snapshots must be added oldest first.
+func (a *DockAuditor) Add(snap storage.Snapshot) {
+	a.snapshots++
+	for _, s := range snap.Stations {
+		st := a.stations[s.ID]
+		if st == nil {
+			st = &dockStation{}
+			a.stations[s.ID] = st
+		}
+		st.name = s.Name
+		st.readings++
+		st.latest = snap.Timestamp
+		st.reported = s.NbDocks
+		st.inService = s.NbBikes + s.NbEmptyDocks
+
+		missing := DockMismatch(s.NbBikes, s.NbEmptyDocks, s.NbDocks)
+		if missing == 0 {
+			st.streak = 0
+			continue
+		}
+		if st.mismatched == 0 {
+			st.firstMismatch = snap.Timestamp
+			st.maxMissing, st.minMissing = missing, missing
+		}
+		st.mismatched++
+		st.sumMissing += int64(missing)
+		st.maxMissing = max(st.maxMissing, missing)
+		st.minMissing = min(st.minMissing, missing)
+		st.lastMismatch = snap.Timestamp
+		st.streak++
+		st.longest = max(st.longest, st.streak)
+	}
+}
+
+// Result returns the report, with at most top chronic stations (0 for all).
+func (a *DockAuditor) Result(top int) *DockAuditReport {
+	report := &DockAuditReport{SnapshotCount: a.snapshots, Stations: []StationDockAudit{}}
+	for id, st := range a.stations {
+		report.Readings += st.readings
+		report.Mismatched += st.mismatched
+		if st.mismatched == 0 {
+			continue
+		}
+		audit := StationDockAudit{
+			StationID:      id,
+			Name:           st.name,
+			Readings:       st.readings,
+			Mismatched:     st.mismatched,
+			MismatchShare:  float64(st.mismatched) / float64(st.readings),
+			AvgMissing:     float64(st.sumMissing) / float64(st.mismatched),
+			MaxMissing:     st.maxMissing,
+			MinMissing:     st.minMissing,
+			LongestStreak:  st.longest,
+			Ongoing:        st.streak > 0,
+			FirstMismatch:  st.firstMismatch,
+			LastMismatch:   st.lastMismatch,
+			Latest:         st.latest,
+			ReportedDocks:  st.reported,
+			InServiceDocks: st.inService,
+			LatestMissing:  st.reported - st.inService,
+		}
+		audit.Chronic = audit.MismatchShare >= a.chronicShare
+		if audit.Chronic && audit.AvgMissing > 0 {
+			audit.EstimatedBroken = int(math.Round(audit.AvgMissing))
+		}
+		report.Stations = append(report.Stations, audit)
+	}
+	if report.Readings > 0 {
+		report.MismatchShare = float64(report.Mismatched) / float64(report.Readings)
+	}
+	sort.Slice(report.Stations, func(i, j int) bool { return report.Stations[i].StationID < report.Stations[j].StationID })
+
+	for _, s := range report.Stations {
+		if s.Chronic {
+			report.Chronic = append(report.Chronic, s)
+		}
+	}
+	sort.SliceStable(report.Chronic, func(i, j int) bool {
+		if report.Chronic[i].MismatchShare != report.Chronic[j].MismatchShare {
+			return report.Chronic[i].MismatchShare > report.Chronic[j].MismatchShare
+		}
+		return report.Chronic[i].AvgMissing > report.Chronic[j].AvgMissing
+	})
+	if top > 0 && len(report.Chronic) > top {
+		report.Chronic = report.Chronic[:top]
+	}
+	return report
+}
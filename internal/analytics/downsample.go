@@ -0,0 +1,56 @@
+package analytics
+
+import "math"
+
+// Downsample picks which of n points to keep so that a chart of threshold
+// points looks like a chart of all n, using Largest-Triangle-Three-Buckets:
+// the first and last points are kept, the rest are split into threshold-2
+// buckets and each bucket keeps the point forming the largest triangle with
+// the point kept before it and the average of the next bucket. x must be
+// monotonic (either direction).
+//
+// It returns the indices of the kept points in order, or every index when
+// threshold < 3 or n <= threshold.
+func Downsample(n, threshold int, x, y func(i int) float64) []int {
+	if threshold < 3 || n <= threshold {
+		keep := make([]int, n)
+		for i := range keep {
+			keep[i] = i
+		}
+		return keep
+	}
+
+	keep := make([]int, 0, threshold)
+	keep = append(keep, 0)
+	size := float64(n-2) / float64(threshold-2)
+	a := 0
+	for b := 0; b < threshold-2; b++ {
+		start := int(float64(b)*size) + 1
+		end := int(float64(b+1)*size) + 1
+
+		// Average of the next bucket, or the last point for the final bucket
+		nextStart, nextEnd := end, min(int(float64(b+2)*size)+1, n)
+		if b == threshold-3 {
+			nextStart, nextEnd = n-1, n
+		}
+		var avgX, avgY float64
+		for i := nextStart; i < nextEnd; i++ {
+			avgX += x(i)
+			avgY += y(i)
+		}
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		best, bestArea := start, -1.0
+		ax, ay := x(a), y(a)
+		for i := start; i < end; i++ {
+			area := math.Abs((ax-avgX)*(y(i)-ay) - (ax-x(i))*(avgY-ay))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		keep = append(keep, best)
+		a = best
+	}
+	return append(keep, n-1)
+}
@@ -0,0 +1,377 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"city-cycling/internal/publish"
+	"city-cycling/internal/storage"
+)
+
+// duckDBDriver is the database/sql driver name registered by the DuckDB
+// driver, which is only linked into builds with the duckdb tag (it needs cgo).
+const duckDBDriver = "duckdb"
+
+// catalogRecheckInterval is how long a DuckDBEngine trusts the publication
+// catalog before reading it again, so newly published days are picked up.
+const catalogRecheckInterval = time.Minute
+
+// DuckDBConfig configures a DuckDBEngine.
+type DuckDBConfig struct {
+	// Dataset is the root of the public dataset written by cmd/publish: a
+	// local directory, or an s3:// URL of its bucket and prefix.
+	Dataset string
+	// S3 credentials and endpoint for an s3:// dataset, e.g. R2's.
+	S3KeyID    string
+	S3Secret   string
+	S3Endpoint string
+	S3Region   string
+}
+
+// DuckDBEngine executes queries with DuckDB over the daily Parquet extracts
+// published by cmd/publish, so long ranges are aggregated by a columnar engine
+// reading only the columns a query needs instead of scanning every snapshot.
+// The days published are read from the copy of the publication index kept in
+// the snapshot store; a query reaching a day not published yet, such as
+// today, runs on the fallback engine instead.
+type DuckDBEngine struct {
+	db       *sql.DB
+	dataset  string
+	catalog  storage.ObjectStore
+	fallback QueryEngine
+
+	mu      sync.Mutex
+	checked time.Time
+	days    map[string]string // date -> Parquet key
+	loc     *time.Location
+}
+
+// NewDuckDBEngine opens an in-process DuckDB database querying the extracts
+// of cfg.Dataset, whose publication catalog is read from catalog. Queries
+// over days not published run on fallback. It fails in builds without the
+// duckdb tag.
+func NewDuckDBEngine(cfg DuckDBConfig, catalog storage.ObjectStore, fallback QueryEngine) (*DuckDBEngine, error) {
+	if !slices.Contains(sql.Drivers(), duckDBDriver) {
+		return nil, fmt.Errorf("DuckDB support is not compiled in: rebuild with -tags duckdb")
+	}
+	if cfg.Dataset == "" {
+		return nil, fmt.Errorf("no Parquet dataset configured")
+	}
+	db, err := sql.Open(duckDBDriver, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DuckDB: %w", err)
+	}
+
+	dataset := cfg.Dataset
+	if !strings.HasSuffix(dataset, "/") {
+		dataset += "/"
+	}
+	if strings.HasPrefix(dataset, "s3://") {
+		if err := configureS3(db, cfg); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &DuckDBEngine{db: db, dataset: dataset, catalog: catalog, fallback: fallback}, nil
+}
+
+// configureS3 loads DuckDB's httpfs extension and gives it the credentials of
+// an s3:// dataset. The extension is downloaded on first use.
+func configureS3(db *sql.DB, cfg DuckDBConfig) error {
+	if _, err := db.Exec("INSTALL httpfs; LOAD httpfs"); err != nil {
+		return fmt.Errorf("failed to load DuckDB httpfs extension: %w", err)
+	}
+	options := []string{"TYPE s3", "URL_STYLE 'path'"}
+	for _, o := range []struct{ name, value string }{
+		{"KEY_ID", cfg.S3KeyID},
+		{"SECRET", cfg.S3Secret},
+		{"ENDPOINT", strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(cfg.S3Endpoint, "https://"), "http://"), "/")},
+		{"REGION", cfg.S3Region},
+	} {
+		if o.value != "" {
+			options = append(options, o.name+" "+sqlString(o.value))
+		}
+	}
+	if _, err := db.Exec("CREATE OR REPLACE SECRET dataset (" + strings.Join(options, ", ") + ")"); err != nil {
+		return fmt.Errorf("failed to configure DuckDB S3 credentials: %w", err)
+	}
+	return nil
+}
+
+// Close closes the DuckDB database.
+func (e *DuckDBEngine) Close() error {
+	return e.db.Close()
+}
+
+// Execute runs q over the Parquet extracts of the days it covers, or on the
+// fallback engine if any of them has not been published.
+func (e *DuckDBEngine) Execute(ctx context.Context, q Query) (*QueryResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	files, err := e.files(ctx, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	// Local is not a zone name DuckDB knows
+	if files == nil || (q.Location != nil && q.Location.String() == "Local") {
+		if e.fallback == nil {
+			return nil, fmt.Errorf("range %s to %s has not been published", q.From.Format(time.RFC3339), q.To.Format(time.RFC3339))
+		}
+		return e.fallback.Execute(ctx, q)
+	}
+
+	source := "read_parquet([" + strings.Join(files, ", ") + "])"
+	readings := fmt.Sprintf("SELECT * FROM %s WHERE timestamp >= %s::TIMESTAMPTZ AND timestamp <= %s::TIMESTAMPTZ",
+		source, sqlTime(q.From), sqlTime(q.To))
+
+	var snapshots int
+	if err := e.db.QueryRowContext(ctx, "SELECT count(DISTINCT timestamp) FROM ("+readings+")").Scan(&snapshots); err != nil {
+		return nil, fmt.Errorf("failed to count snapshots: %w", err)
+	}
+
+	var areas string
+	if slices.Contains(q.GroupBy, DimArea) {
+		if areas, err = e.stationAreas(ctx, readings, q); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := e.db.QueryContext(ctx, querySQL(q, readings, areas))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	result := &QueryResult{Columns: q.Columns(), Rows: [][]any{}, SnapshotCount: snapshots}
+	for rows.Next() {
+		values := make([]any, len(result.Columns))
+		ptrs := make([]any, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to read query result: %w", err)
+		}
+		for i, v := range values {
+			values[i] = resultValue(v)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query result: %w", err)
+	}
+	return result, nil
+}
+
+// files returns the quoted paths of the extracts of every day in [from, to],
+// or nil if any of them has not been published.
+func (e *DuckDBEngine) files(ctx context.Context, from, to time.Time) ([]string, error) {
+	days, loc, err := e.publishedDays(ctx)
+	if err != nil || days == nil {
+		return nil, err
+	}
+	var files []string
+	from = from.In(loc)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc); !day.After(to); day = day.AddDate(0, 0, 1) {
+		key, ok := days[day.Format("2006-01-02")]
+		if !ok {
+			return nil, nil
+		}
+		files = append(files, sqlString(e.dataset+key))
+	}
+	return files, nil
+}
+
+// publishedDays returns the Parquet key of every published day, and the zone
+// days run in, rereading the catalog every catalogRecheckInterval. Nothing
+// published returns nil days.
+func (e *DuckDBEngine) publishedDays(ctx context.Context) (map[string]string, *time.Location, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.checked.IsZero() && time.Since(e.checked) < catalogRecheckInterval {
+		return e.days, e.loc, nil
+	}
+
+	index, err := publish.LoadCatalog(ctx, e.catalog)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, err
+	}
+	loc := time.UTC
+	if index.TimeZone != "" {
+		if loc, err = time.LoadLocation(index.TimeZone); err != nil {
+			slog.Warn("Unknown time zone in publication index", "timeZone", index.TimeZone, "error", err)
+			loc = time.UTC
+		}
+	}
+	var days map[string]string
+	if len(index.Days) > 0 {
+		days = make(map[string]string, len(index.Days))
+		for _, d := range index.Days {
+			days[d.Date] = d.Parquet
+		}
+	}
+	e.days, e.loc, e.checked = days, loc, time.Now()
+	return days, loc, nil
+}
+
+// stationAreas returns a VALUES list locating every station position in
+// readings in q.Areas, or "" if there are none.
+func (e *DuckDBEngine) stationAreas(ctx context.Context, readings string, q Query) (string, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT DISTINCT station_id, lat, lng FROM ("+readings+")")
+	if err != nil {
+		return "", fmt.Errorf("failed to list stations: %w", err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var id int64
+		var lat, lng float64
+		if err := rows.Scan(&id, &lat, &lng); err != nil {
+			return "", fmt.Errorf("failed to list stations: %w", err)
+		}
+		values = append(values, fmt.Sprintf("(%d, %s::DOUBLE, %s::DOUBLE, %s)", id,
+			strconv.FormatFloat(lat, 'g', -1, 64), strconv.FormatFloat(lng, 'g', -1, 64), sqlString(q.Areas.Locate(lat, lng))))
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to list stations: %w", err)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// querySQL returns the SQL of q over the readings subquery. areas locates
+// station positions for the area dimension.
+func querySQL(q Query, readings, areas string) string {
+	local := "timezone('UTC', timestamp)"
+	if q.Location != nil {
+		local = fmt.Sprintf("timezone(%s, timestamp)", sqlString(q.Location.String()))
+	}
+
+	var cols, groups []string
+	for _, d := range q.GroupBy {
+		switch d {
+		case DimStation:
+			cols = append(cols, "station_id::INTEGER", "arg_max(station_name, timestamp)")
+			groups = append(groups, "station_id")
+		case DimHour:
+			cols = append(cols, "hour("+local+")::INTEGER")
+			groups = append(groups, "hour("+local+")")
+		case DimWeekday:
+			cols = append(cols, "dayofweek("+local+")::INTEGER")
+			groups = append(groups, "dayofweek("+local+")")
+		case DimDate:
+			cols = append(cols, "strftime("+local+", '%Y-%m-%d')")
+			groups = append(groups, "strftime("+local+", '%Y-%m-%d')")
+		case DimArea:
+			cols = append(cols, "coalesce(area, '')")
+			groups = append(groups, "coalesce(area, '')")
+		}
+	}
+	keyCols := len(cols)
+	for _, a := range q.Select {
+		cols = append(cols, aggregateSQL(a))
+	}
+
+	from := "(" + readings + ")"
+	switch {
+	case areas != "":
+		from += " LEFT JOIN (VALUES " + areas + ") AS areas(station_id, lat, lng, area) USING (station_id, lat, lng)"
+	case slices.Contains(q.GroupBy, DimArea):
+		from += " CROSS JOIN (SELECT NULL::VARCHAR AS area)"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT " + strings.Join(cols, ", ") + " FROM " + from)
+	if len(q.Stations) > 0 {
+		ids := make([]string, len(q.Stations))
+		for i, id := range q.Stations {
+			ids[i] = strconv.Itoa(id)
+		}
+		sb.WriteString(" WHERE station_id IN (" + strings.Join(ids, ", ") + ")")
+	}
+	if len(groups) > 0 {
+		sb.WriteString(" GROUP BY " + strings.Join(groups, ", "))
+	} else {
+		// Without groups, as with ScanEngine, no readings means no row
+		sb.WriteString(" HAVING count(*) > 0")
+	}
+
+	// Ordered as by ScanEngine: nil first ascending, then by the group columns
+	var order []string
+	for i, c := range q.Columns() {
+		if c == q.OrderBy {
+			if q.Desc {
+				order = append(order, strconv.Itoa(i+1)+" DESC NULLS LAST")
+			} else {
+				order = append(order, strconv.Itoa(i+1)+" ASC NULLS FIRST")
+			}
+		}
+	}
+	for i := range keyCols {
+		order = append(order, strconv.Itoa(i+1)+" ASC NULLS FIRST")
+	}
+	if len(order) > 0 {
+		sb.WriteString(" ORDER BY " + strings.Join(order, ", "))
+	}
+	sb.WriteString(" LIMIT " + strconv.Itoa(q.Limit))
+	return sb.String()
+}
+
+// aggregateSQL returns the SQL of an aggregate, with the types and rounding
+// of ScanEngine's results.
+func aggregateSQL(a Aggregate) string {
+	var metric string
+	switch a.Metric {
+	case MetricOccupancy:
+		metric = "nb_bikes::DOUBLE / NULLIF(nb_docks, 0)"
+	default:
+		metric = string(a.Metric)
+	}
+	switch a.Func {
+	case AggCount:
+		return "count(*)"
+	case AggAvg:
+		return "round(avg(" + metric + "), 3)"
+	default:
+		return string(a.Func) + "(" + metric + ")::DOUBLE"
+	}
+}
+
+// resultValue converts a value scanned from DuckDB to the types ScanEngine
+// returns: int, float64, string or nil.
+func resultValue(v any) any {
+	switch n := v.(type) {
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint64:
+		return int(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
+
+// sqlString quotes s as a SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlTime returns t as a SQL string literal castable to TIMESTAMPTZ.
+func sqlTime(t time.Time) string {
+	return sqlString(t.UTC().Format("2006-01-02 15:04:05.999999") + "+00")
+}
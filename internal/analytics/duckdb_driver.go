@@ -0,0 +1,7 @@
+//go:build duckdb
+
+package analytics
+
+// The DuckDB driver needs cgo, so it is only linked into builds with the
+// duckdb tag; see NewDuckDBEngine.
+import _ "github.com/duckdb/duckdb-go/v2"
@@ -0,0 +1,255 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// BikeTypeStats describes one type of bike (standard or electric) at a
+// station, or across the network.
+type BikeTypeStats struct {
+	// AvgDocked is the average number docked; PresentShare the fraction of
+	// snapshots with at least one.
+	AvgDocked    float64
+	PresentShare float64
+	// Arrivals and Departures are estimated as by FlowEstimator, and so are
+	// lower bounds. Rebalancing jumps are left out.
+	Arrivals   int
+	Departures int
+	// AvgDwell approximates how long a bike of this type stays docked before
+	// it is taken: the bike-time spent docked divided by the arrivals (Little's
+	// law). It is zero when there were no arrivals.
+	AvgDwell time.Duration
+}
+
+// StationEBikes compares e-bike and standard bike dynamics at a station.
+type StationEBikes struct {
+	StationID int
+	Name      string
+	Standard  BikeTypeStats
+	EBike     BikeTypeStats
+	// EBikeArrivalShare is the fraction of arrivals that were e-bikes.
+	EBikeArrivalShare float64
+}
+
+// HourEBikeShare is the share of docked bikes that were e-bikes during one
+// local hour of the day, over every day in the window.
+type HourEBikeShare struct {
+	Hour       int
+	Samples    int
+	EBikeShare float64
+}
+
+// EBikeReport is the result of an EBikeAnalyzer.
+type EBikeReport struct {
+	SnapshotCount int
+	// Standard and EBike pool every station, so their averages are per
+	// station; EBikeShare is the fraction of docked bikes that were e-bikes.
+	Standard   BikeTypeStats
+	EBike      BikeTypeStats
+	EBikeShare float64
+	ByHour     []HourEBikeShare
+	Stations   []StationEBikes
+	// RarelyEBikes lists the stations receiving the smallest share of e-bike
+	// arrivals first, among those with any arrivals.
+	RarelyEBikes []StationEBikes
+}
+
+// typeTally accumulates one bike type at one station, or network-wide.
+type typeTally struct {
+	samples    int
+	present    int
+	sumDocked  int64
+	arrivals   int
+	departures int
+	// dockedSeconds integrates the docked count over the time between
+	// consecutive snapshots.
+	dockedSeconds float64
+}
+
+// add records one reading, and the change since the previous one when prev
+// is set. elapsed is the time since the previous reading.
+func (t *typeTally) add(docked, prev int, elapsed time.Duration, counted bool) {
+	t.samples++
+	t.sumDocked += int64(docked)
+	if docked > 0 {
+		t.present++
+	}
+	if !counted {
+		return
+	}
+	t.dockedSeconds += float64(prev) * elapsed.Seconds()
+	if d := docked - prev; d > 0 {
+		t.arrivals += d
+	} else {
+		t.departures -= d
+	}
+}
+
+// merge folds o into t.
+func (t *typeTally) merge(o typeTally) {
+	t.samples += o.samples
+	t.present += o.present
+	t.sumDocked += o.sumDocked
+	t.arrivals += o.arrivals
+	t.departures += o.departures
+	t.dockedSeconds += o.dockedSeconds
+}
+
+// stats converts the tally.
+func (t typeTally) stats() BikeTypeStats {
+	var s BikeTypeStats
+	if t.samples > 0 {
+		s.AvgDocked = float64(t.sumDocked) / float64(t.samples)
+		s.PresentShare = float64(t.present) / float64(t.samples)
+	}
+	s.Arrivals = t.arrivals
+	s.Departures = t.departures
+	if t.arrivals > 0 {
+		s.AvgDwell = time.Duration(t.dockedSeconds / float64(t.arrivals) * float64(time.Second)).Round(time.Second)
+	}
+	return s
+}
+
+// ebikeStation is what the analyzer tracks per station.
+type ebikeStation struct {
+	name            string
+	last            time.Time
+	standard, ebike int
+	standardTally   typeTally
+	ebikeTally      typeTally
+}
+
+// hourTally sums docked bikes over the snapshots in one hour of the day.
+type hourTally struct {
+	samples       int
+	bikes, ebikes int64
+}
+
+// EBikeAnalyzer separates e-bike from standard bike dynamics: how many of
+// each are docked, how quickly they come and go at each station, the e-bike
+// share by local hour of day, and which stations rarely receive e-bikes.
+type EBikeAnalyzer struct {
+	loc       *time.Location
+	threshold int
+	maxGap    time.Duration
+
+	snapshots int
+	stations  map[int]*ebikeStation
+	hours     [24]hourTally
+}
+
+// NewEBikeAnalyzer creates an analyzer bucketing hours of the day in loc (nil
+// means UTC). Jumps of at least threshold bikes faster than riders could
+// manage are treated as rebalancing and not counted; a threshold <= 0 uses
+// DefaultRebalanceThreshold.
+func NewEBikeAnalyzer(threshold int, loc *time.Location) *EBikeAnalyzer {
+	if threshold <= 0 {
+		threshold = DefaultRebalanceThreshold
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &EBikeAnalyzer{
+		loc:       loc,
+		threshold: threshold,
+		maxGap:    DefaultFlowMaxGap,
+		stations:  make(map[int]*ebikeStation),
+	}
+}
+
+// Add records a snapshot. Snapshots must be added oldest first.
+func (a *EBikeAnalyzer) Add(snap storage.Snapshot) {
+	a.snapshots++
+	hour := &a.hours[snap.Timestamp.In(a.loc).Hour()]
+	hour.samples++
+
+	for _, s := range snap.Stations {
+		hour.bikes += int64(s.NbBikes)
+		hour.ebikes += int64(s.NbEBikes)
+
+		st := a.stations[s.ID]
+		if st == nil {
+			st = &ebikeStation{}
+			a.stations[s.ID] = st
+		}
+		elapsed := snap.Timestamp.Sub(st.last)
+		counted := !st.last.IsZero() && elapsed > 0 && elapsed <= a.maxGap
+		if counted {
+			net := s.NbStandardBikes + s.NbEBikes - st.standard - st.ebike
+			if abs(net) >= a.threshold && float64(abs(net))/elapsed.Minutes() > maxOrganicRatePerMinute {
+				counted = false
+			}
+		}
+		st.standardTally.add(s.NbStandardBikes, st.standard, elapsed, counted)
+		st.ebikeTally.add(s.NbEBikes, st.ebike, elapsed, counted)
+
+		st.name = s.Name
+		st.last = snap.Timestamp
+		st.standard = s.NbStandardBikes
+		st.ebike = s.NbEBikes
+	}
+}
+
+// Result returns the report, with the top stations that rarely receive e-bikes.
+func (a *EBikeAnalyzer) Result(top int) *EBikeReport {
+	report := &EBikeReport{SnapshotCount: a.snapshots}
+
+	var standard, ebike typeTally
+	var bikes, ebikes int64
+	for hour, t := range a.hours {
+		bikes += t.bikes
+		ebikes += t.ebikes
+		if t.samples == 0 {
+			continue
+		}
+		share := HourEBikeShare{Hour: hour, Samples: t.samples}
+		if t.bikes > 0 {
+			share.EBikeShare = float64(t.ebikes) / float64(t.bikes)
+		}
+		report.ByHour = append(report.ByHour, share)
+	}
+	if bikes > 0 {
+		report.EBikeShare = float64(ebikes) / float64(bikes)
+	}
+
+	for id, st := range a.stations {
+		standard.merge(st.standardTally)
+		ebike.merge(st.ebikeTally)
+		s := StationEBikes{
+			StationID: id,
+			Name:      st.name,
+			Standard:  st.standardTally.stats(),
+			EBike:     st.ebikeTally.stats(),
+		}
+		if arrivals := s.Standard.Arrivals + s.EBike.Arrivals; arrivals > 0 {
+			s.EBikeArrivalShare = float64(s.EBike.Arrivals) / float64(arrivals)
+		}
+		report.Stations = append(report.Stations, s)
+	}
+	sort.Slice(report.Stations, func(i, j int) bool { return report.Stations[i].StationID < report.Stations[j].StationID })
+
+	report.Standard = standard.stats()
+	report.EBike = ebike.stats()
+
+	var rare []StationEBikes
+	for _, s := range report.Stations {
+		if s.Standard.Arrivals+s.EBike.Arrivals > 0 {
+			rare = append(rare, s)
+		}
+	}
+	sort.SliceStable(rare, func(i, j int) bool {
+		if rare[i].EBikeArrivalShare != rare[j].EBikeArrivalShare {
+			return rare[i].EBikeArrivalShare < rare[j].EBikeArrivalShare
+		}
+		return rare[i].EBike.PresentShare < rare[j].EBike.PresentShare
+	})
+	if top > 0 && len(rare) > top {
+		rare = rare[:top]
+	}
+	report.RarelyEBikes = rare
+
+	return report
+}
@@ -0,0 +1,270 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"city-cycling/internal/storage"
+)
+
+// DefaultElevationBands is how many bands of equal station count an
+// ElevationAnalyzer groups stations into.
+const DefaultElevationBands = 4
+
+// StationElevation is how often a station of known elevation was empty or full.
+type StationElevation struct {
+	StationID int
+	Name      string
+	Elevation float64
+	Readings  int
+	// EmptyShare and FullShare are the fractions of readings with no bike
+	// and with no free dock.
+	EmptyShare float64
+	FullShare  float64
+	// Imbalance is EmptyShare - FullShare: positive for a station riders
+	// empty, as they do stations uphill, negative for one they fill.
+	Imbalance    float64
+	AvgOccupancy float64
+}
+
+// ElevationBand averages the stations in a range of elevations.
+type ElevationBand struct {
+	MinElevation float64
+	MaxElevation float64
+	AvgElevation float64
+	Stations     int
+	EmptyShare   float64
+	FullShare    float64
+	Imbalance    float64
+	AvgOccupancy float64
+}
+
+// ElevationReport is the result of an ElevationAnalyzer.
+type ElevationReport struct {
+	SnapshotCount int
+	// StationCount counts the stations analysed; WithoutElevation those
+	// read but left out for want of an elevation.
+	StationCount     int
+	WithoutElevation int
+	// The correlations are Pearson's r between elevation and each station's
+	// share: a positive EmptyCorrelation means higher stations are empty more
+	// often. They are zero with fewer than three stations or no variation.
+	EmptyCorrelation     float64
+	FullCorrelation      float64
+	ImbalanceCorrelation float64
+	OccupancyCorrelation float64
+	// ImbalancePer10m is the least-squares slope of Imbalance against
+	// elevation, per 10 meters climbed.
+	ImbalancePer10m float64
+	// Bands splits the stations by elevation, lowest first.
+	Bands []ElevationBand
+	// MostEmptied and MostFilled rank the stations by Imbalance, highest and
+	// lowest first.
+	MostEmptied []StationElevation
+	MostFilled  []StationElevation
+	// Stations lists every station analysed, highest first.
+	Stations []StationElevation
+}
+
+// elevationStation is what the analyzer tracks per station.
+type elevationStation struct {
+	name                  string
+	readings, empty, full int
+	occupancy             float64
+}
+
+// ElevationAnalyzer relates station elevation to chronic emptiness and
+// fullness: riders coast downhill and avoid climbing, so stations on hills
+// tend to empty and those below them to fill.
+type ElevationAnalyzer struct {
+	elevations map[int]float64
+	bands      int
+	snapshots  int
+	stations   map[int]*elevationStation
+	unknown    map[int]bool
+}
+
+// NewElevationAnalyzer creates an analyzer for the stations in elevations,
+// keyed by station ID, grouping them into bands (DefaultElevationBands if <= 0).
+func NewElevationAnalyzer(elevations map[int]float64, bands int) *ElevationAnalyzer {
+	if bands <= 0 {
+		bands = DefaultElevationBands
+	}
+	return &ElevationAnalyzer{
+		elevations: elevations,
+		bands:      bands,
+		stations:   make(map[int]*elevationStation),
+		unknown:    make(map[int]bool),
+	}
+}
+
+// Add implements Accumulator.
+func (a *ElevationAnalyzer) Add(snap storage.Snapshot) {
+	a.snapshots++
+	for _, s := range snap.Stations {
+		if _, ok := a.elevations[s.ID]; !ok {
+			a.unknown[s.ID] = true
+			continue
+		}
+		// A station without docks is out of service, neither empty nor full
+		if s.NbDocks == 0 {
+			continue
+		}
+		st := a.stations[s.ID]
+		if st == nil {
+			st = &elevationStation{}
+			a.stations[s.ID] = st
+		}
+		st.name = s.Name
+		st.readings++
+		if s.NbBikes == 0 {
+			st.empty++
+		}
+		if s.NbEmptyDocks == 0 {
+			st.full++
+		}
+		st.occupancy += float64(s.NbBikes) / float64(s.NbDocks)
+	}
+}
+
+// Result returns the report, with at most top stations in each ranking (0 for all).
+func (a *ElevationAnalyzer) Result(top int) *ElevationReport {
+	report := &ElevationReport{SnapshotCount: a.snapshots, WithoutElevation: len(a.unknown)}
+
+	stations := make([]StationElevation, 0, len(a.stations))
+	for id, st := range a.stations {
+		n := float64(st.readings)
+		s := StationElevation{
+			StationID:    id,
+			Name:         st.name,
+			Elevation:    a.elevations[id],
+			Readings:     st.readings,
+			EmptyShare:   float64(st.empty) / n,
+			FullShare:    float64(st.full) / n,
+			AvgOccupancy: st.occupancy / n,
+		}
+		s.Imbalance = s.EmptyShare - s.FullShare
+		stations = append(stations, s)
+	}
+	sort.Slice(stations, func(i, j int) bool {
+		if stations[i].Elevation != stations[j].Elevation {
+			return stations[i].Elevation > stations[j].Elevation
+		}
+		return stations[i].StationID < stations[j].StationID
+	})
+	report.StationCount = len(stations)
+	report.Stations = stations
+
+	elevations := make([]float64, len(stations))
+	share := func(f func(StationElevation) float64) []float64 {
+		values := make([]float64, len(stations))
+		for i, s := range stations {
+			values[i] = f(s)
+		}
+		return values
+	}
+	for i, s := range stations {
+		elevations[i] = s.Elevation
+	}
+	imbalance := share(func(s StationElevation) float64 { return s.Imbalance })
+	report.EmptyCorrelation = pearson(elevations, share(func(s StationElevation) float64 { return s.EmptyShare }))
+	report.FullCorrelation = pearson(elevations, share(func(s StationElevation) float64 { return s.FullShare }))
+	report.ImbalanceCorrelation = pearson(elevations, imbalance)
+	report.OccupancyCorrelation = pearson(elevations, share(func(s StationElevation) float64 { return s.AvgOccupancy }))
+	report.ImbalancePer10m = 10 * slope(elevations, imbalance)
+
+	report.Bands = elevationBands(stations, a.bands)
+
+	report.MostEmptied = rankElevations(stations, top, func(a, b StationElevation) bool { return a.Imbalance > b.Imbalance })
+	report.MostFilled = rankElevations(stations, top, func(a, b StationElevation) bool { return a.Imbalance < b.Imbalance })
+	return report
+}
+
+// elevationBands splits stations, ordered highest first, into n bands of
+// near-equal size, lowest first.
+func elevationBands(stations []StationElevation, n int) []ElevationBand {
+	n = min(n, len(stations))
+	bands := make([]ElevationBand, 0, n)
+	for b := 0; b < n; b++ {
+		// Bands count up from the lowest station, at the end of the slice
+		lo, hi := len(stations)*(n-b-1)/n, len(stations)*(n-b)/n
+		members := stations[lo:hi]
+		band := ElevationBand{
+			MinElevation: members[len(members)-1].Elevation,
+			MaxElevation: members[0].Elevation,
+			Stations:     len(members),
+		}
+		for _, s := range members {
+			band.AvgElevation += s.Elevation
+			band.EmptyShare += s.EmptyShare
+			band.FullShare += s.FullShare
+			band.Imbalance += s.Imbalance
+			band.AvgOccupancy += s.AvgOccupancy
+		}
+		count := float64(len(members))
+		band.AvgElevation /= count
+		band.EmptyShare /= count
+		band.FullShare /= count
+		band.Imbalance /= count
+		band.AvgOccupancy /= count
+		bands = append(bands, band)
+	}
+	return bands
+}
+
+// rankElevations returns up to top stations (0 for all) ordered by less.
+func rankElevations(stations []StationElevation, top int, less func(a, b StationElevation) bool) []StationElevation {
+	ranked := append([]StationElevation(nil), stations...)
+	sort.SliceStable(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+	if top > 0 && len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	return ranked
+}
+
+// pearson returns the correlation coefficient of xs and ys, or 0 when it is
+// undefined or there are fewer than three pairs.
+func pearson(xs, ys []float64) float64 {
+	if len(xs) < 3 {
+		return 0
+	}
+	mx, my := mean(xs), mean(ys)
+	var sxy, sxx, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// slope returns the least-squares slope of ys against xs, or 0 when undefined.
+func slope(xs, ys []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	mx, my := mean(xs), mean(ys)
+	var sxy, sxx float64
+	for i := range xs {
+		dx := xs[i] - mx
+		sxy += dx * (ys[i] - my)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0
+	}
+	return sxy / sxx
+}
+
+// mean returns the average of values, which must not be empty.
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
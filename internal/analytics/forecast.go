@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"math"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+const (
+	// hoursPerWeek is the number of seasonal buckets in the forecast model.
+	hoursPerWeek = 7 * 24
+	// trendDecay is the time constant over which the recent-trend correction fades
+	// back to the seasonal average.
+	trendDecay = 30 * time.Minute
+)
+
+// ForecastPoint is a predicted availability at a future time.
+type ForecastPoint struct {
+	Timestamp  time.Time
+	Bikes      float64
+	EmptyDocks float64
+}
+
+// seasonalBucket accumulates readings for one hour of the week.
+type seasonalBucket struct {
+	bikes, emptyDocks float64
+	count             int
+}
+
+// SeasonalModel predicts station availability from hour-of-week averages,
+// corrected by how far the latest reading deviates from its own average.
+type SeasonalModel struct {
+	buckets [hoursPerWeek]seasonalBucket
+	overall seasonalBucket
+	latest  storage.StationSample
+	docks   int
+	loc     *time.Location
+}
+
+// TrainSeasonalModel builds a model from a station's history, oldest first.
+// Hours of the week follow the wall clock in loc, so commuter peaks line up
+// across daylight saving changes. It returns nil if samples is empty.
+func TrainSeasonalModel(samples []storage.StationSample, loc *time.Location) *SeasonalModel {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	m := &SeasonalModel{loc: loc}
+	for _, s := range samples {
+		b := &m.buckets[m.hourOfWeek(s.Timestamp)]
+		b.bikes += float64(s.NbBikes)
+		b.emptyDocks += float64(s.NbEmptyDocks)
+		b.count++
+
+		m.overall.bikes += float64(s.NbBikes)
+		m.overall.emptyDocks += float64(s.NbEmptyDocks)
+		m.overall.count++
+	}
+
+	m.latest = samples[len(samples)-1]
+	m.docks = m.latest.NbDocks
+	return m
+}
+
+// Forecast predicts availability every step for horizon after the latest sample.
+func (m *SeasonalModel) Forecast(horizon, step time.Duration) []ForecastPoint {
+	baseBikes, baseDocks := m.seasonal(m.latest.Timestamp)
+	residualBikes := float64(m.latest.NbBikes) - baseBikes
+	residualDocks := float64(m.latest.NbEmptyDocks) - baseDocks
+
+	var points []ForecastPoint
+	for offset := step; offset <= horizon; offset += step {
+		points = append(points, m.forecast(m.latest.Timestamp.Add(offset), residualBikes, residualDocks))
+	}
+	return points
+}
+
+// At predicts availability at ts, which should be after the latest sample.
+func (m *SeasonalModel) At(ts time.Time) ForecastPoint {
+	baseBikes, baseDocks := m.seasonal(m.latest.Timestamp)
+	return m.forecast(ts, float64(m.latest.NbBikes)-baseBikes, float64(m.latest.NbEmptyDocks)-baseDocks)
+}
+
+// forecast predicts availability at ts from its hour-of-week average and the
+// latest sample's residuals, which fade with time since the sample.
+func (m *SeasonalModel) forecast(ts time.Time, residualBikes, residualDocks float64) ForecastPoint {
+	bikes, docks := m.seasonal(ts)
+	weight := math.Exp(-float64(max(ts.Sub(m.latest.Timestamp), 0)) / float64(trendDecay))
+	return ForecastPoint{
+		Timestamp:  ts,
+		Bikes:      m.clamp(bikes + residualBikes*weight),
+		EmptyDocks: m.clamp(docks + residualDocks*weight),
+	}
+}
+
+// Latest returns the most recent sample the model was trained on.
+func (m *SeasonalModel) Latest() storage.StationSample {
+	return m.latest
+}
+
+// seasonal returns the average bikes and empty docks for ts's hour of the week,
+// falling back to the overall average for hours with no history.
+func (m *SeasonalModel) seasonal(ts time.Time) (float64, float64) {
+	b := m.buckets[m.hourOfWeek(ts)]
+	if b.count == 0 {
+		b = m.overall
+	}
+	return b.bikes / float64(b.count), b.emptyDocks / float64(b.count)
+}
+
+// clamp bounds a prediction to the station's physical capacity.
+func (m *SeasonalModel) clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if m.docks > 0 && v > float64(m.docks) {
+		return float64(m.docks)
+	}
+	return v
+}
+
+// hourOfWeek returns the bucket index for ts, with Sunday 00:00 local time as 0.
+func (m *SeasonalModel) hourOfWeek(ts time.Time) int {
+	ts = ts.In(m.loc)
+	return int(ts.Weekday())*24 + ts.Hour()
+}
@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// DeltaFrame lists the stations that changed since the previous frame.
+type DeltaFrame struct {
+	Timestamp time.Time
+	Added     []tfl.Station // stations not present in the previous frame
+	Changed   []tfl.Station // stations whose counts changed
+	Removed   []int
+}
+
+// PlaybackBuilder turns a snapshot sequence into an initial full frame followed by
+// delta frames sampled at most once per step.
+type PlaybackBuilder struct {
+	step time.Duration
+
+	initial *storage.Snapshot
+	frames  []DeltaFrame
+	last    time.Time
+	prev    map[int]tfl.Station
+}
+
+// NewPlaybackBuilder creates a builder emitting one frame per step.
+func NewPlaybackBuilder(step time.Duration) *PlaybackBuilder {
+	return &PlaybackBuilder{step: step}
+}
+
+// Add records a snapshot. Snapshots must be added oldest first; snapshots less than
+// step after the previous frame are skipped.
+func (b *PlaybackBuilder) Add(snap storage.Snapshot) {
+	if b.initial == nil {
+		b.initial = &snap
+		b.last = snap.Timestamp
+		b.prev = indexStations(snap.Stations)
+		return
+	}
+
+	if snap.Timestamp.Sub(b.last) < b.step {
+		return
+	}
+
+	frame := DeltaFrame{Timestamp: snap.Timestamp}
+	current := indexStations(snap.Stations)
+	for _, s := range snap.Stations {
+		old, ok := b.prev[s.ID]
+		switch {
+		case !ok:
+			frame.Added = append(frame.Added, s)
+		case countsChanged(old, s):
+			frame.Changed = append(frame.Changed, s)
+		}
+	}
+	for id := range b.prev {
+		if _, ok := current[id]; !ok {
+			frame.Removed = append(frame.Removed, id)
+		}
+	}
+	sort.Ints(frame.Removed)
+
+	b.frames = append(b.frames, frame)
+	b.last = snap.Timestamp
+	b.prev = current
+}
+
+// Initial returns the first full frame, or nil if no snapshots were added.
+func (b *PlaybackBuilder) Initial() *storage.Snapshot {
+	return b.initial
+}
+
+// Frames returns the delta frames following the initial frame.
+func (b *PlaybackBuilder) Frames() []DeltaFrame {
+	return b.frames
+}
+
+// indexStations maps stations by ID.
+func indexStations(stations []tfl.Station) map[int]tfl.Station {
+	m := make(map[int]tfl.Station, len(stations))
+	for _, s := range stations {
+		m[s.ID] = s
+	}
+	return m
+}
+
+// countsChanged reports whether any availability count differs between two readings.
+func countsChanged(a, b tfl.Station) bool {
+	return a.NbBikes != b.NbBikes ||
+		a.NbStandardBikes != b.NbStandardBikes ||
+		a.NbEBikes != b.NbEBikes ||
+		a.NbEmptyDocks != b.NbEmptyDocks ||
+		a.NbDocks != b.NbDocks
+}
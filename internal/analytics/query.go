@@ -0,0 +1,473 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/geo"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// MaxQueryRows caps how many result rows a query may return.
+const MaxQueryRows = 10000
+
+// Dimension is a column a query can group by.
+type Dimension string
+
+// Dimensions supported by queries. Time dimensions follow the wall clock in
+// Query.Location.
+const (
+	DimStation Dimension = "station"
+	DimHour    Dimension = "hour"    // hour of day, 0-23
+	DimWeekday Dimension = "weekday" // day of week, 0 = Sunday
+	DimDate    Dimension = "date"    // calendar day, YYYY-MM-DD
+	// DimArea is the borough or neighbourhood a station is in, "" outside
+	// every area; it needs Query.Areas.
+	DimArea Dimension = "area"
+)
+
+// Metric is a per-station reading a query can aggregate.
+type Metric string
+
+// Metrics supported by queries.
+const (
+	MetricBikes         Metric = "nb_bikes"
+	MetricStandardBikes Metric = "nb_standard_bikes"
+	MetricEBikes        Metric = "nb_ebikes"
+	MetricEmptyDocks    Metric = "nb_empty_docks"
+	MetricDocks         Metric = "nb_docks"
+	MetricOccupancy     Metric = "occupancy" // nb_bikes / nb_docks; readings with no docks are skipped
+)
+
+// AggFunc is an aggregate function.
+type AggFunc string
+
+// Aggregate functions supported by queries.
+const (
+	AggCount AggFunc = "count"
+	AggSum   AggFunc = "sum"
+	AggAvg   AggFunc = "avg"
+	AggMin   AggFunc = "min"
+	AggMax   AggFunc = "max"
+)
+
+var (
+	validDimensions = map[Dimension]bool{DimStation: true, DimHour: true, DimWeekday: true, DimDate: true, DimArea: true}
+	validMetrics    = map[Metric]bool{
+		MetricBikes: true, MetricStandardBikes: true, MetricEBikes: true,
+		MetricEmptyDocks: true, MetricDocks: true, MetricOccupancy: true,
+	}
+	validAggFuncs = map[AggFunc]bool{AggCount: true, AggSum: true, AggAvg: true, AggMin: true, AggMax: true}
+)
+
+// Aggregate is one selected output column, e.g. avg(nb_bikes).
+type Aggregate struct {
+	Func   AggFunc
+	Metric Metric // empty for count
+}
+
+// String returns the aggregate in the form it is written in a query.
+func (a Aggregate) String() string {
+	if a.Func == AggCount {
+		return "count"
+	}
+	return fmt.Sprintf("%s(%s)", a.Func, a.Metric)
+}
+
+// Query is a constrained analytical query over station readings. It only
+// expresses filtering, grouping and aggregation over a fixed set of columns,
+// so it can be accepted from untrusted callers.
+type Query struct {
+	Select   []Aggregate
+	GroupBy  []Dimension
+	Stations []int // only include these stations; empty means all
+	From, To time.Time
+	// Location is the time zone of the hour, weekday and date dimensions;
+	// nil means UTC.
+	Location *time.Location
+	// Areas locates stations for the area dimension.
+	Areas *geo.Areas
+	// OrderBy is an output column name; Desc sorts it descending.
+	// Rows are ordered by the group columns when empty.
+	OrderBy string
+	Desc    bool
+	Limit   int
+}
+
+// QueryResult is the tabular result of a query. Rows hold one value per column.
+type QueryResult struct {
+	Columns       []string
+	Rows          [][]any
+	SnapshotCount int
+}
+
+// QueryEngine executes queries. ScanEngine runs them over any RangeDataStore; an
+// engine backed by a columnar store can implement the same interface.
+type QueryEngine interface {
+	Execute(ctx context.Context, q Query) (*QueryResult, error)
+}
+
+// ParseSelect parses a comma-separated list of aggregates such as
+// "avg(nb_bikes),max(nb_empty_docks),count".
+func ParseSelect(s string) ([]Aggregate, error) {
+	var aggs []Aggregate
+	for _, item := range splitList(s) {
+		if item == string(AggCount) || item == "count()" {
+			aggs = append(aggs, Aggregate{Func: AggCount})
+			continue
+		}
+		open := strings.IndexByte(item, '(')
+		if open < 0 || !strings.HasSuffix(item, ")") {
+			return nil, fmt.Errorf("invalid aggregate %q", item)
+		}
+		fn, metric := AggFunc(item[:open]), Metric(item[open+1:len(item)-1])
+		if !validAggFuncs[fn] || fn == AggCount {
+			return nil, fmt.Errorf("unknown aggregate function %q", fn)
+		}
+		if !validMetrics[metric] {
+			return nil, fmt.Errorf("unknown metric %q", metric)
+		}
+		aggs = append(aggs, Aggregate{Func: fn, Metric: metric})
+	}
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("select must name at least one aggregate")
+	}
+	return aggs, nil
+}
+
+// ParseGroupBy parses a comma-separated list of dimensions such as "station,hour".
+func ParseGroupBy(s string) ([]Dimension, error) {
+	var dims []Dimension
+	seen := make(map[Dimension]bool)
+	for _, item := range splitList(s) {
+		d := Dimension(item)
+		if !validDimensions[d] {
+			return nil, fmt.Errorf("unknown group_by dimension %q", item)
+		}
+		if !seen[d] {
+			seen[d] = true
+			dims = append(dims, d)
+		}
+	}
+	return dims, nil
+}
+
+// ParseStationList parses a comma-separated list of station IDs.
+func ParseStationList(s string) ([]int, error) {
+	var ids []int
+	for _, item := range splitList(s) {
+		id, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid station id %q", item)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// splitList splits a comma-separated list, dropping blanks and surrounding spaces.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Columns returns the output column names of q: group columns first, then aggregates.
+// Grouping by station adds a name column after it.
+func (q Query) Columns() []string {
+	var cols []string
+	for _, d := range q.GroupBy {
+		cols = append(cols, string(d))
+		if d == DimStation {
+			cols = append(cols, "name")
+		}
+	}
+	for _, a := range q.Select {
+		cols = append(cols, a.String())
+	}
+	return cols
+}
+
+// Validate checks that q is complete and its ordering names an output column.
+func (q Query) Validate() error {
+	if len(q.Select) == 0 {
+		return fmt.Errorf("select must name at least one aggregate")
+	}
+	for i, d := range q.GroupBy {
+		if slices.Contains(q.GroupBy[:i], d) {
+			return fmt.Errorf("group_by names %q twice", d)
+		}
+	}
+	if q.Areas == nil && slices.Contains(q.GroupBy, DimArea) {
+		return fmt.Errorf("group_by area needs areas to be configured")
+	}
+	if q.Limit < 1 || q.Limit > MaxQueryRows {
+		return fmt.Errorf("limit must be between 1 and %d", MaxQueryRows)
+	}
+	if q.OrderBy != "" {
+		for _, c := range q.Columns() {
+			if c == q.OrderBy {
+				return nil
+			}
+		}
+		return fmt.Errorf("order must name an output column")
+	}
+	return nil
+}
+
+// ScanEngine executes queries by scanning snapshots from a RangeDataStore.
+type ScanEngine struct {
+	Store storage.RangeDataStore
+}
+
+// Execute runs q over every snapshot in [q.From, q.To].
+func (e ScanEngine) Execute(ctx context.Context, q Query) (*QueryResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	acc := NewQueryAccumulator(q)
+	if err := Run(ctx, e.Store, q.From, q.To, acc); err != nil {
+		return nil, err
+	}
+	return acc.Result(), nil
+}
+
+// aggState accumulates one aggregate for one group.
+type aggState struct {
+	count    int
+	sum      float64
+	min, max float64
+}
+
+// add records one value.
+func (st *aggState) add(v float64) {
+	if st.count == 0 || v < st.min {
+		st.min = v
+	}
+	if st.count == 0 || v > st.max {
+		st.max = v
+	}
+	st.count++
+	st.sum += v
+}
+
+// queryGroup is the running state for one combination of group values.
+type queryGroup struct {
+	key  []any
+	aggs []aggState
+}
+
+// QueryAccumulator evaluates a query incrementally over snapshots.
+type QueryAccumulator struct {
+	q         Query
+	stations  map[int]bool
+	names     map[int]string
+	groups    map[string]*queryGroup
+	snapshots int
+}
+
+// NewQueryAccumulator creates an accumulator for q.
+func NewQueryAccumulator(q Query) *QueryAccumulator {
+	acc := &QueryAccumulator{
+		q:      q,
+		names:  make(map[int]string),
+		groups: make(map[string]*queryGroup),
+	}
+	if len(q.Stations) > 0 {
+		acc.stations = make(map[int]bool, len(q.Stations))
+		for _, id := range q.Stations {
+			acc.stations[id] = true
+		}
+	}
+	return acc
+}
+
+// Add implements Accumulator.
+func (a *QueryAccumulator) Add(snap storage.Snapshot) {
+	a.snapshots++
+	ts := snap.Timestamp.UTC()
+	if a.q.Location != nil {
+		ts = ts.In(a.q.Location)
+	}
+
+	for _, s := range snap.Stations {
+		if a.stations != nil && !a.stations[s.ID] {
+			continue
+		}
+		a.names[s.ID] = s.Name
+
+		key := make([]any, len(a.q.GroupBy))
+		for i, d := range a.q.GroupBy {
+			switch d {
+			case DimStation:
+				key[i] = s.ID
+			case DimHour:
+				key[i] = ts.Hour()
+			case DimWeekday:
+				key[i] = int(ts.Weekday())
+			case DimDate:
+				key[i] = ts.Format("2006-01-02")
+			case DimArea:
+				key[i] = a.q.Areas.Locate(s.Lat, s.Long)
+			}
+		}
+		id := fmt.Sprintf("%v", key)
+
+		g, ok := a.groups[id]
+		if !ok {
+			g = &queryGroup{key: key, aggs: make([]aggState, len(a.q.Select))}
+			a.groups[id] = g
+		}
+		for i, agg := range a.q.Select {
+			v, ok := metricValue(agg.Metric, s)
+			if !ok {
+				continue
+			}
+			g.aggs[i].add(v)
+		}
+	}
+}
+
+// metricValue returns a station's value for m, or false if it has none.
+func metricValue(m Metric, s tfl.Station) (float64, bool) {
+	switch m {
+	case MetricBikes:
+		return float64(s.NbBikes), true
+	case MetricStandardBikes:
+		return float64(s.NbStandardBikes), true
+	case MetricEBikes:
+		return float64(s.NbEBikes), true
+	case MetricEmptyDocks:
+		return float64(s.NbEmptyDocks), true
+	case MetricDocks:
+		return float64(s.NbDocks), true
+	case MetricOccupancy:
+		if s.NbDocks == 0 {
+			return 0, false
+		}
+		return float64(s.NbBikes) / float64(s.NbDocks), true
+	}
+	// count has no metric and counts every reading
+	return 0, true
+}
+
+// Result returns the query result, ordered and limited as the query requests.
+func (a *QueryAccumulator) Result() *QueryResult {
+	groups := make([]*queryGroup, 0, len(a.groups))
+	for _, g := range a.groups {
+		groups = append(groups, g)
+	}
+	return queryResult(a.q, groups, func(id int) string { return a.names[id] }, a.snapshots)
+}
+
+// queryResult turns the groups of q into its result, ordered and limited as
+// the query requests. name returns a station's name for the station column.
+func queryResult(q Query, groups []*queryGroup, name func(id int) string, snapshots int) *QueryResult {
+	result := &QueryResult{Columns: q.Columns(), Rows: [][]any{}, SnapshotCount: snapshots}
+
+	for _, g := range groups {
+		row := make([]any, 0, len(result.Columns))
+		for i, d := range q.GroupBy {
+			row = append(row, g.key[i])
+			if d == DimStation {
+				row = append(row, name(g.key[i].(int)))
+			}
+		}
+		for i, agg := range q.Select {
+			row = append(row, aggValue(agg.Func, g.aggs[i]))
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	orderCol := -1
+	for i, c := range result.Columns {
+		if c == q.OrderBy {
+			orderCol = i
+		}
+	}
+	groupCols := len(result.Columns) - len(q.Select)
+	// Group columns are unique, so ties on them cannot occur
+	slices.SortFunc(result.Rows, func(a, b []any) int {
+		if orderCol >= 0 {
+			if c := compareValues(a[orderCol], b[orderCol]); c != 0 {
+				if q.Desc {
+					return -c
+				}
+				return c
+			}
+		}
+		for col := 0; col < groupCols; col++ {
+			if c := compareValues(a[col], b[col]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	if q.Limit > 0 && len(result.Rows) > q.Limit {
+		result.Rows = result.Rows[:q.Limit]
+	}
+	return result
+}
+
+// aggValue returns the final value of an aggregate. Empty aggregates are nil.
+func aggValue(fn AggFunc, st aggState) any {
+	if fn == AggCount {
+		return st.count
+	}
+	if st.count == 0 {
+		return nil
+	}
+	switch fn {
+	case AggSum:
+		return st.sum
+	case AggMin:
+		return st.min
+	case AggMax:
+		return st.max
+	default:
+		return math.Round(st.sum/float64(st.count)*1000) / 1000
+	}
+}
+
+// compareValues orders two result values of the same column. nil sorts first.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch av := a.(type) {
+	case int:
+		return sign(float64(av - b.(int)))
+	case float64:
+		return sign(av - b.(float64))
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+	return 0
+}
+
+// sign returns -1, 0 or 1 according to the sign of f.
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
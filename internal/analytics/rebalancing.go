@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+const (
+	// DefaultRebalanceThreshold is the minimum change in docked bikes between two
+	// consecutive snapshots that is treated as a possible rebalancing event.
+	DefaultRebalanceThreshold = 8
+	// maxOrganicRatePerMinute is the largest per-minute change in docked bikes that
+	// ordinary riders are assumed to produce at a single station.
+	maxOrganicRatePerMinute = 1.0
+)
+
+// RebalanceEvent is a sudden change in docked bikes at a station that is more
+// likely to be an operator van than rider activity.
+type RebalanceEvent struct {
+	StationID int
+	Name      string
+	Start     time.Time // timestamp of the snapshot before the jump
+	End       time.Time // timestamp of the snapshot after the jump
+	Before    int
+	After     int
+	Delta     int // positive for a refill, negative for a removal
+}
+
+// RebalancingDetector flags large jumps in docked bikes inconsistent with organic usage.
+type RebalancingDetector struct {
+	threshold int
+	last      map[int]stationReading
+	events    []RebalanceEvent
+}
+
+// stationReading is a station's docked bike count at a point in time.
+type stationReading struct {
+	timestamp time.Time
+	bikes     int
+}
+
+// NewRebalancingDetector creates a detector. Jumps smaller than threshold are ignored;
+// a threshold <= 0 uses DefaultRebalanceThreshold.
+func NewRebalancingDetector(threshold int) *RebalancingDetector {
+	if threshold <= 0 {
+		threshold = DefaultRebalanceThreshold
+	}
+	return &RebalancingDetector{
+		threshold: threshold,
+		last:      make(map[int]stationReading),
+	}
+}
+
+// Add records a snapshot. Snapshots must be added oldest first.
+func (d *RebalancingDetector) Add(snap storage.Snapshot) {
+	for _, s := range snap.Stations {
+		prev, seen := d.last[s.ID]
+		d.last[s.ID] = stationReading{timestamp: snap.Timestamp, bikes: s.NbBikes}
+		if !seen {
+			continue
+		}
+
+		delta := s.NbBikes - prev.bikes
+		if abs(delta) < d.threshold {
+			continue
+		}
+
+		// A jump is only suspicious if riders couldn't plausibly have caused it in the elapsed time
+		minutes := snap.Timestamp.Sub(prev.timestamp).Minutes()
+		if minutes > 0 && float64(abs(delta))/minutes <= maxOrganicRatePerMinute {
+			continue
+		}
+
+		d.events = append(d.events, RebalanceEvent{
+			StationID: s.ID,
+			Name:      s.Name,
+			Start:     prev.timestamp,
+			End:       snap.Timestamp,
+			Before:    prev.bikes,
+			After:     s.NbBikes,
+			Delta:     delta,
+		})
+	}
+}
+
+// Events returns detected events ordered by time, then station.
+func (d *RebalancingDetector) Events() []RebalanceEvent {
+	events := make([]RebalanceEvent, len(d.events))
+	copy(events, d.events)
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].End.Equal(events[j].End) {
+			return events[i].End.Before(events[j].End)
+		}
+		return events[i].StationID < events[j].StationID
+	})
+	return events
+}
+
+// EventsByStation groups detected events by station ID, for per-station annotations.
+func (d *RebalancingDetector) EventsByStation() map[int][]RebalanceEvent {
+	byStation := make(map[int][]RebalanceEvent)
+	for _, e := range d.Events() {
+		byStation[e.StationID] = append(byStation[e.StationID], e)
+	}
+	return byStation
+}
@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+const (
+	// DefaultRecordWarmup is how much history must precede a low before it
+	// counts as a record, so the first days of collection don't all set one.
+	DefaultRecordWarmup = 7 * 24 * time.Hour
+	// recordMinStations is the fraction of the most stations yet seen a
+	// snapshot must report to count: a partial feed is not a record low.
+	recordMinStations = 0.9
+)
+
+// RecordLow is a snapshot whose network-wide docked bikes fell below every
+// earlier snapshot.
+type RecordLow struct {
+	Timestamp  time.Time
+	TotalBikes int
+	// PrevLow is the record it broke, set at PrevLowAt.
+	PrevLow   int
+	PrevLowAt time.Time
+}
+
+// RecordLows returns the record lows of available bikes in points, oldest
+// first. Lows within warmup of the first point only set the bar, and of the
+// records set on one day in loc, only that day's lowest is returned.
+func RecordLows(points []storage.HistoricalDataPoint, warmup time.Duration, loc *time.Location) []RecordLow {
+	if len(points) == 0 {
+		return nil
+	}
+	sorted := append([]storage.HistoricalDataPoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	start := sorted[0].Timestamp
+	var records []RecordLow
+	var low storage.HistoricalDataPoint
+	maxStations := 0
+	for _, p := range sorted {
+		maxStations = max(maxStations, p.StationCount)
+		if float64(p.StationCount) < recordMinStations*float64(maxStations) {
+			continue
+		}
+		if low.Timestamp.IsZero() || p.TotalBikes < low.TotalBikes {
+			if p.Timestamp.Sub(start) >= warmup && !low.Timestamp.IsZero() {
+				record := RecordLow{Timestamp: p.Timestamp, TotalBikes: p.TotalBikes, PrevLow: low.TotalBikes, PrevLowAt: low.Timestamp}
+				if n := len(records); n > 0 && sameDay(records[n-1].Timestamp, p.Timestamp, loc) {
+					// Keep the record the day started from
+					record.PrevLow, record.PrevLowAt = records[n-1].PrevLow, records[n-1].PrevLowAt
+					records[n-1] = record
+				} else {
+					records = append(records, record)
+				}
+			}
+			low = p
+		}
+	}
+	return records
+}
+
+// sameDay reports whether a and b fall on the same calendar day in loc.
+func sameDay(a, b time.Time, loc *time.Location) bool {
+	ay, am, ad := a.In(loc).Date()
+	by, bm, bd := b.In(loc).Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,147 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// TrendPoint holds network-wide values for a single snapshot.
+type TrendPoint struct {
+	Timestamp   time.Time
+	DockedBikes int
+	InTransit   int     // estimated bikes in use: peak docked total minus DockedBikes
+	EBikeShare  float64 // fraction of docked bikes that are e-bikes
+}
+
+// StationChurn is the total absolute change in docked bikes at a station.
+type StationChurn struct {
+	StationID int
+	Name      string
+	Churn     int
+}
+
+// Summary is the network-wide analytics result over a window.
+type Summary struct {
+	From          time.Time
+	To            time.Time
+	SnapshotCount int
+	PeakDocked    int
+	InTransitNow  int
+	MaxInTransit  int
+	EmptyEvents   int // times a station went from having bikes to having none
+	FullEvents    int // times a station went from having empty docks to having none
+	Busiest       []StationChurn
+	Trend         []TrendPoint
+}
+
+// stationState is the last reading seen for a station.
+type stationState struct {
+	name       string
+	bikes      int
+	emptyDocks int
+	churn      int
+}
+
+// SummaryBuilder accumulates snapshots into a Summary.
+type SummaryBuilder struct {
+	from, to time.Time
+	trend    []TrendPoint
+	stations map[int]*stationState
+	empty    int
+	full     int
+}
+
+// NewSummaryBuilder creates a builder for the window [from, to].
+func NewSummaryBuilder(from, to time.Time) *SummaryBuilder {
+	return &SummaryBuilder{
+		from:     from,
+		to:       to,
+		stations: make(map[int]*stationState),
+	}
+}
+
+// Add records a snapshot. Snapshots must be added oldest first.
+func (b *SummaryBuilder) Add(snap storage.Snapshot) {
+	docked, ebikes := 0, 0
+	for _, s := range snap.Stations {
+		docked += s.NbBikes
+		ebikes += s.NbEBikes
+
+		st, seen := b.stations[s.ID]
+		if !seen {
+			b.stations[s.ID] = &stationState{name: s.Name, bikes: s.NbBikes, emptyDocks: s.NbEmptyDocks}
+			continue
+		}
+
+		st.churn += abs(s.NbBikes - st.bikes)
+		if st.bikes > 0 && s.NbBikes == 0 {
+			b.empty++
+		}
+		if st.emptyDocks > 0 && s.NbEmptyDocks == 0 {
+			b.full++
+		}
+		st.name = s.Name
+		st.bikes = s.NbBikes
+		st.emptyDocks = s.NbEmptyDocks
+	}
+
+	point := TrendPoint{Timestamp: snap.Timestamp, DockedBikes: docked}
+	if docked > 0 {
+		point.EBikeShare = float64(ebikes) / float64(docked)
+	}
+	b.trend = append(b.trend, point)
+}
+
+// Result returns the summary with the top busiest stations by churn.
+func (b *SummaryBuilder) Result(top int) *Summary {
+	summary := &Summary{
+		From:          b.from,
+		To:            b.to,
+		SnapshotCount: len(b.trend),
+		EmptyEvents:   b.empty,
+		FullEvents:    b.full,
+		Trend:         b.trend,
+	}
+
+	for _, p := range b.trend {
+		if p.DockedBikes > summary.PeakDocked {
+			summary.PeakDocked = p.DockedBikes
+		}
+	}
+	for i := range b.trend {
+		inTransit := summary.PeakDocked - b.trend[i].DockedBikes
+		b.trend[i].InTransit = inTransit
+		if inTransit > summary.MaxInTransit {
+			summary.MaxInTransit = inTransit
+		}
+	}
+	if len(b.trend) > 0 {
+		summary.InTransitNow = b.trend[len(b.trend)-1].InTransit
+	}
+
+	churn := make([]StationChurn, 0, len(b.stations))
+	for id, st := range b.stations {
+		churn = append(churn, StationChurn{StationID: id, Name: st.name, Churn: st.churn})
+	}
+	sort.Slice(churn, func(i, j int) bool {
+		if churn[i].Churn != churn[j].Churn {
+			return churn[i].Churn > churn[j].Churn
+		}
+		return churn[i].StationID < churn[j].StationID
+	})
+	if top > 0 && len(churn) > top {
+		churn = churn[:top]
+	}
+	summary.Busiest = churn
+
+	return summary
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,45 @@
+// Package cache stores the server's derived data, such as decoded historical
+// snapshots, either in process memory or in Redis so that several replicas
+// share one copy.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get when no value is cached under the key.
+var ErrMiss = errors.New("cache miss")
+
+// Cache holds byte values by key. Implementations are safe for concurrent use.
+type Cache interface {
+	// Get returns the value cached under key, or an error wrapping ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Contains reports whether a value is cached under key, without counting
+	// a hit or miss or marking it recently used.
+	Contains(ctx context.Context, key string) (bool, error)
+
+	// Set caches value under key for ttl; a ttl <= 0 keeps it until evicted
+	// or cleared.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Clear drops every value this cache holds.
+	Clear(ctx context.Context) error
+
+	// Stats returns the cache's size and counters.
+	Stats() Stats
+}
+
+// Stats is a point-in-time view of a cache. Counters cover this process only.
+type Stats struct {
+	// Backend is "memory" or "redis".
+	Backend string
+	// Entries and Bytes are zero for backends that cannot report them cheaply.
+	Entries   int
+	Bytes     int64
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryEntry is one cached value.
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for no expiry
+}
+
+// Memory is a least-recently-used cache bounded by entry count and total value
+// size, for a single server process.
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	order      *list.List // front is most recently used
+	entries    map[string]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+// NewMemory creates a cache holding at most maxEntries values and maxBytes of
+// value data; a bound <= 0 is not enforced.
+func NewMemory(maxEntries int, maxBytes int64) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value cached under key and marks it recently used.
+func (c *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if ok {
+		if e := el.Value.(*memoryEntry); !e.expires.IsZero() && time.Now().After(e.expires) {
+			c.remove(el)
+			ok = false
+		}
+	}
+	if !ok {
+		c.misses++
+		return nil, fmt.Errorf("%w: %s", ErrMiss, key)
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*memoryEntry).value, nil
+}
+
+// Contains reports whether an unexpired value is cached under key.
+func (c *Memory) Contains(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return false, nil
+	}
+	e := el.Value.(*memoryEntry)
+	return e.expires.IsZero() || !time.Now().After(e.expires), nil
+}
+
+// Set caches value under key, evicting the least recently used values until
+// the cache is within its bounds. A value larger than maxBytes on its own is
+// not cached. The cache keeps value, so the caller must not modify it.
+func (c *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	size := int64(len(value))
+	entry := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return nil
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += size
+
+	for c.order.Len() > 1 && ((c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+	return nil
+}
+
+// Clear drops every cached value.
+func (c *Memory) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.bytes = 0
+	return nil
+}
+
+// remove drops an entry. The caller holds c.mu.
+func (c *Memory) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*memoryEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.value))
+}
+
+// Stats returns the cache's current size and counters.
+func (c *Memory) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Backend:   "memory",
+		Entries:   c.order.Len(),
+		Bytes:     c.bytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+var _ Cache = (*Memory)(nil)
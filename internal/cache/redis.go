@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisScanCount is how many keys Clear asks Redis to examine per SCAN call.
+const redisScanCount = 1000
+
+// Redis is a cache in a Redis server, shared by every process using the same
+// server and key prefix. Bounding its memory is left to the server's
+// maxmemory policy and the TTLs given to Set.
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+
+	hits, misses atomic.Uint64
+}
+
+// NewRedis creates a cache storing its values in client under keys starting
+// with prefix, e.g. "city-cycling:london:".
+func NewRedis(client redis.UniversalClient, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Get returns the value cached under key.
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		c.misses.Add(1)
+		return nil, fmt.Errorf("%w: %s", ErrMiss, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get from redis: %w", err)
+	}
+	c.hits.Add(1)
+	return value, nil
+}
+
+// Contains reports whether a value is cached under key.
+func (c *Redis) Contains(ctx context.Context, key string) (bool, error) {
+	n, err := c.client.Exists(ctx, c.prefix+key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check redis: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Set caches value under key for ttl.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	if err := c.client.Set(ctx, c.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set in redis: %w", err)
+	}
+	return nil
+}
+
+// Clear deletes every key under the cache's prefix.
+func (c *Redis) Clear(ctx context.Context) error {
+	match := escapeRedisPattern(c.prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, match, redisScanCount).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan redis: %w", err)
+		}
+		if len(keys) > 0 {
+			if err := c.client.Del(ctx, keys...).Err(); err != nil {
+				return fmt.Errorf("failed to delete from redis: %w", err)
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Stats returns this process's hit and miss counts. Redis cannot report the
+// size of one prefix cheaply, so Entries and Bytes are zero.
+func (c *Redis) Stats() Stats {
+	return Stats{Backend: "redis", Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// escapeRedisPattern escapes the glob characters SCAN MATCH interprets.
+func escapeRedisPattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var _ Cache = (*Redis)(nil)
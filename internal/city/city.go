@@ -0,0 +1,299 @@
+// Package city describes the bike-share systems a deployment collects and serves.
+package city
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/config"
+	"city-cycling/internal/gbfs"
+	"city-cycling/internal/geo"
+	"city-cycling/internal/tfl"
+)
+
+// Feed types.
+const (
+	// FeedTFL is the TFL Santander Cycles XML feed.
+	FeedTFL = "tfl"
+	// FeedBikePoint is the TFL Unified API BikePoint JSON endpoint, the same
+	// data as FeedTFL from an independent source.
+	FeedBikePoint = "bikepoint"
+	// FeedGBFS is a General Bikeshare Feed Specification system (gbfs.json URL).
+	FeedGBFS = "gbfs"
+)
+
+// idPattern restricts city IDs to what can appear as a URL path segment and a
+// storage key prefix without escaping.
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Source is one feed a city's data can be fetched from.
+type Source struct {
+	// FeedType is FeedTFL, FeedBikePoint or FeedGBFS; FeedURL defaults to
+	// the TFL endpoint for the first two.
+	FeedType string `json:"feedType"`
+	FeedURL  string `json:"feedUrl"`
+	// AppKey is the TFL Unified API key for FeedBikePoint, read from
+	// TFL_APP_KEY rather than the cities file.
+	AppKey string `json:"-"`
+}
+
+// City is one bike-share system.
+type City struct {
+	// ID names the city in routes (/api/v1/{id}/stations) and logs.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Source is the primary feed.
+	Source
+	// Fallbacks are tried in order when the primary feed fails or its
+	// lastUpdate is older than StaleAfter.
+	Fallbacks []Source `json:"fallbacks,omitempty"`
+	// StaleAfter is a duration such as "15m"; it defaults to tfl.DefaultMaxAge
+	// and only applies when there are fallbacks.
+	StaleAfter string `json:"staleAfter,omitempty"`
+	// MinStations and MaxStations override the collector's bounds on the
+	// station count of a valid fetch; 0 keeps the command-line default.
+	MinStations int `json:"minStations,omitempty"`
+	MaxStations int `json:"maxStations,omitempty"`
+	// Timezone is an IANA zone name used for local-time scheduling.
+	Timezone string `json:"timezone"`
+	// StoragePrefix nests the city's snapshots and objects in the store, e.g.
+	// "manchester/". The default city may leave it empty to keep the flat layout.
+	StoragePrefix string `json:"storagePrefix"`
+	// Areas is a GeoJSON file of the boroughs or neighbourhoods stations are
+	// grouped by, each feature named by its AreaProperty property
+	// (geo.DefaultAreaProperty when empty).
+	Areas        string `json:"areas,omitempty"`
+	AreaProperty string `json:"areaProperty,omitempty"`
+}
+
+// Feed fetches the live state of a city's stations.
+type Feed interface {
+	FetchStations(ctx context.Context) (*tfl.Stations, error)
+}
+
+// London returns the built-in city used when no cities file is given: the TFL
+// feed stored without a prefix.
+func London() City {
+	return City{
+		ID:       "london",
+		Name:     "London Santander Cycles",
+		Source:   Source{FeedType: FeedTFL, FeedURL: tfl.DefaultEndpoint},
+		Timezone: "Europe/London",
+	}
+}
+
+// Config is the JSON cities file.
+type Config struct {
+	// Cities lists every system; the first is the default, also served at the
+	// unprefixed routes.
+	Cities []City `json:"cities"`
+}
+
+// LoadConfig reads and validates a cities file, filling in defaults.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cities config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse cities config: %w", err)
+	}
+	if len(cfg.Cities) == 0 {
+		return nil, fmt.Errorf("cities config lists no cities")
+	}
+
+	ids := make(map[string]bool)
+	prefixes := make(map[string]string)
+	for i := range cfg.Cities {
+		c := &cfg.Cities[i]
+		if !idPattern.MatchString(c.ID) {
+			return nil, fmt.Errorf("city %d: id %q must be lowercase letters, digits and dashes", i, c.ID)
+		}
+		if ids[c.ID] {
+			return nil, fmt.Errorf("city %q: duplicate id", c.ID)
+		}
+		ids[c.ID] = true
+
+		if c.Name == "" {
+			c.Name = c.ID
+		}
+		if err := c.Source.validate(); err != nil {
+			return nil, fmt.Errorf("city %q: %w", c.ID, err)
+		}
+		for j := range c.Fallbacks {
+			if err := c.Fallbacks[j].validate(); err != nil {
+				return nil, fmt.Errorf("city %q: fallback %d: %w", c.ID, j, err)
+			}
+		}
+		if c.StaleAfter != "" {
+			if _, err := time.ParseDuration(c.StaleAfter); err != nil {
+				return nil, fmt.Errorf("city %q: invalid staleAfter: %w", c.ID, err)
+			}
+		}
+		if c.Timezone == "" {
+			c.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return nil, fmt.Errorf("city %q: %w", c.ID, err)
+		}
+
+		// Only the default city may share the root of the store
+		if c.StoragePrefix == "" && i > 0 {
+			c.StoragePrefix = c.ID + "/"
+		}
+		if other, ok := prefixes[c.StoragePrefix]; ok {
+			return nil, fmt.Errorf("city %q: storage prefix %q already used by %q", c.ID, c.StoragePrefix, other)
+		}
+		prefixes[c.StoragePrefix] = c.ID
+	}
+
+	return &cfg, nil
+}
+
+// validate checks the feed type and fills in the default URL.
+func (s *Source) validate() error {
+	switch s.FeedType {
+	case "", FeedTFL:
+		s.FeedType = FeedTFL
+		if s.FeedURL == "" {
+			s.FeedURL = tfl.DefaultEndpoint
+		}
+	case FeedBikePoint:
+		if s.FeedURL == "" {
+			s.FeedURL = tfl.BikePointEndpoint
+		}
+	case FeedGBFS:
+		if s.FeedURL == "" {
+			return fmt.Errorf("gbfs feed needs feedUrl (the system's gbfs.json)")
+		}
+	default:
+		return fmt.Errorf("unknown feed type %q", s.FeedType)
+	}
+	return nil
+}
+
+// Load returns the cities in path, or London alone when path is empty.
+// feeds, if set, is a comma-separated list of London's sources in order of
+// preference (FeedTFL, FeedBikePoint); it cannot be combined with a cities
+// file, which sets sources per city.
+func Load(path, feeds string) ([]City, error) {
+	var cities []City
+	if path == "" {
+		london := London()
+		if feeds != "" {
+			for i, t := range strings.Split(feeds, ",") {
+				t = strings.TrimSpace(t)
+				if t != FeedTFL && t != FeedBikePoint {
+					return nil, fmt.Errorf("unknown feed type %q for London", t)
+				}
+				src := Source{FeedType: t}
+				if err := src.validate(); err != nil {
+					return nil, err
+				}
+				if i == 0 {
+					london.Source = src
+				} else {
+					london.Fallbacks = append(london.Fallbacks, src)
+				}
+			}
+		}
+		cities = []City{london}
+	} else {
+		if feeds != "" {
+			return nil, fmt.Errorf("feed type override cannot be used with a cities file")
+		}
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		cities = cfg.Cities
+	}
+
+	var appKey *string
+	for i := range cities {
+		for _, src := range cities[i].sources() {
+			if src.FeedType != FeedBikePoint {
+				continue
+			}
+			if appKey == nil {
+				key, err := config.Secret("TFL_APP_KEY")
+				if err != nil {
+					return nil, err
+				}
+				appKey = &key
+			}
+			src.AppKey = *appKey
+		}
+	}
+	return cities, nil
+}
+
+// sources returns the primary source followed by the fallbacks.
+func (c *City) sources() []*Source {
+	sources := []*Source{&c.Source}
+	for i := range c.Fallbacks {
+		sources = append(sources, &c.Fallbacks[i])
+	}
+	return sources
+}
+
+// NewFeed creates a client for the city's feed, failing over between its
+// sources when it has fallbacks.
+func (c City) NewFeed() Feed {
+	if len(c.Fallbacks) == 0 {
+		return c.Source.newFetcher()
+	}
+
+	maxAge := tfl.DefaultMaxAge
+	if c.StaleAfter != "" {
+		// Validated by LoadConfig
+		maxAge, _ = time.ParseDuration(c.StaleAfter)
+	}
+	var sources []tfl.Source
+	seen := make(map[string]int)
+	for _, src := range c.sources() {
+		// Name repeated feed types by position, e.g. gbfs and gbfs#2
+		name := src.FeedType
+		if seen[name]++; seen[name] > 1 {
+			name += "#" + strconv.Itoa(seen[src.FeedType])
+		}
+		sources = append(sources, tfl.Source{Name: name, Fetcher: src.newFetcher()})
+	}
+	return tfl.NewFailover(sources, maxAge)
+}
+
+// newFetcher creates a client for a single source.
+func (s Source) newFetcher() tfl.Fetcher {
+	switch s.FeedType {
+	case FeedGBFS:
+		return gbfs.NewClient(s.FeedURL)
+	case FeedBikePoint:
+		return tfl.NewBikePointClient(s.FeedURL, s.AppKey)
+	}
+	return tfl.NewClientWithEndpoint(s.FeedURL)
+}
+
+// Location returns the city's time zone (UTC if it cannot be loaded).
+func (c City) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LoadAreas reads the city's areas, or returns nil when it has none.
+func (c City) LoadAreas() (*geo.Areas, error) {
+	if c.Areas == "" {
+		return nil, nil
+	}
+	return geo.LoadAreas(c.Areas, c.AreaProperty)
+}
@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"city-cycling/internal/city"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/telemetry"
+	"city-cycling/internal/tfl"
+)
+
+// Collector periodically fetches station data from a city's feed and writes it to a store.
+type Collector struct {
+	feed         city.Feed
+	log          *slog.Logger
+	writer       storage.SnapshotWriter
+	onWrite      []func(key string, stations *tfl.Stations)
+	onFailure    []func(err error)
+	onInvalid    []func(stations *tfl.Stations)
+	jitter       time.Duration
+	fetchTimeout time.Duration
+	elector      *LeaderElector
+	validator    *Validator
+	paused       func() bool
+}
+
+// New creates a collector that fetches from feed and writes snapshots to writer.
+func New(feed city.Feed, writer storage.SnapshotWriter) *Collector {
+	return &Collector{
+		feed:   feed,
+		log:    slog.Default(),
+		writer: writer,
+	}
+}
+
+// SetLogger replaces the logger, e.g. to tag each city's collector in a
+// multi-city deployment.
+func (c *Collector) SetLogger(l *slog.Logger) {
+	c.log = l
+}
+
+// OnWrite registers a callback invoked after each successful snapshot write.
+func (c *Collector) OnWrite(fn func(key string, stations *tfl.Stations)) {
+	c.onWrite = append(c.onWrite, fn)
+}
+
+// OnFailure registers a callback invoked after each failed collection.
+func (c *Collector) OnFailure(fn func(err error)) {
+	c.onFailure = append(c.onFailure, fn)
+}
+
+// SetJitter delays each scheduled collection by a random duration up to d, so
+// several collectors started together do not hit the feed in the same second.
+func (c *Collector) SetJitter(d time.Duration) {
+	c.jitter = d
+}
+
+// SetFetchTimeout bounds how long a single fetch from the feed may take (0 for no bound
+// beyond the iteration deadline).
+func (c *Collector) SetFetchTimeout(d time.Duration) {
+	c.fetchTimeout = d
+}
+
+// SetLeaderElector makes the collector skip collections while another replica
+// holds the lease, so redundant replicas never write duplicate snapshots.
+func (c *Collector) SetLeaderElector(e *LeaderElector) {
+	c.elector = e
+}
+
+// SetPaused makes the collector skip collections, without fetching, while
+// paused reports true, e.g. while the server is read-only.
+func (c *Collector) SetPaused(paused func() bool) {
+	c.paused = paused
+}
+
+// SetValidator checks every fetch before it is written; the validator's policy
+// decides whether a fetch that fails is dropped or written with its issues.
+func (c *Collector) SetValidator(v *Validator) {
+	c.validator = v
+}
+
+// OnInvalid registers a callback invoked for each fetch that fails validation
+// under PolicyAlert, after it has been written.
+func (c *Collector) OnInvalid(fn func(stations *tfl.Stations)) {
+	c.onInvalid = append(c.onInvalid, fn)
+}
+
+// Collect performs a single fetch and write.
+func (c *Collector) Collect(ctx context.Context) (err error) {
+	ctx, span := telemetry.Start(ctx, "collector.Collect")
+	defer telemetry.End(span, &err)
+	defer func() {
+		if err != nil {
+			for _, fn := range c.onFailure {
+				fn(err)
+			}
+		}
+	}()
+
+	if c.paused != nil && c.paused() {
+		c.log.Info("Skipping collection while paused")
+		return nil
+	}
+
+	if c.elector != nil {
+		leader, err := c.elector.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if !leader {
+			c.log.Debug("Standing by: another replica holds the collector lease")
+			return nil
+		}
+	}
+
+	c.log.Info("Fetching station data")
+
+	fetchCtx := ctx
+	if c.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithTimeout(ctx, c.fetchTimeout)
+		defer cancel()
+	}
+	stations, err := c.feed.FetchStations(fetchCtx)
+	if err != nil {
+		if errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("fetch timed out: %w", err)
+		}
+		return err
+	}
+
+	if c.validator != nil {
+		stations.Validation = c.validator.Check(stations)
+		if !stations.Validation.Passed {
+			if c.validator.Policy() == PolicyReject {
+				return fmt.Errorf("%w: %s", ErrInvalidSnapshot, strings.Join(stations.Validation.Issues, "; "))
+			}
+			c.log.Warn("Snapshot failed validation", "issues", stations.Validation.Issues)
+		}
+	}
+
+	key, err := c.writer.WriteStations(ctx, stations)
+	if err != nil {
+		return err
+	}
+	if c.validator != nil {
+		c.validator.Accept(stations)
+		if !stations.Validation.Passed && c.validator.Policy() == PolicyAlert {
+			for _, fn := range c.onInvalid {
+				fn(stations)
+			}
+		}
+	}
+
+	if stations.Source != "" {
+		c.log.Info("Stored snapshot", "stations", len(stations.Stations), "key", key, "source", stations.Source)
+	} else {
+		c.log.Info("Stored snapshot", "stations", len(stations.Stations), "key", key)
+	}
+
+	for _, fn := range c.onWrite {
+		fn(key, stations)
+	}
+	return nil
+}
+
+// Run collects every interval until ctx is cancelled.
+// Failed iterations are logged and do not stop the loop.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case t := <-ticker.C:
+			c.runIteration(ctx, t.Add(interval))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runIteration waits out the jitter and collects, abandoning the attempt at
+// deadline so a hung fetch never runs into the next iteration.
+func (c *Collector) runIteration(ctx context.Context, deadline time.Time) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	if c.jitter > 0 {
+		delay := rand.N(c.jitter)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := c.Collect(ctx); err != nil {
+		c.log.Error("Fetch failed", "error", err)
+	}
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Sink is a named snapshot destination used by FanOut. Every sink is written
+// under the same timestamp, so its writer must take one.
+type Sink struct {
+	Name   string
+	Writer storage.TimestampedWriter
+}
+
+// SinkStats holds write metrics for a single sink.
+type SinkStats struct {
+	Name         string
+	Writes       int
+	Failures     int
+	LastKey      string
+	LastError    string
+	LastDuration time.Duration
+	LastSuccess  time.Time
+}
+
+// FanOut writes each snapshot to several sinks concurrently.
+// A failing sink does not prevent the others from being written; the write only
+// fails if every sink fails.
+type FanOut struct {
+	sinks []Sink
+
+	mu    sync.Mutex
+	stats map[string]*SinkStats
+}
+
+// NewFanOut creates a writer that fans out to the given sinks.
+func NewFanOut(sinks ...Sink) *FanOut {
+	stats := make(map[string]*SinkStats, len(sinks))
+	for _, s := range sinks {
+		stats[s.Name] = &SinkStats{Name: s.Name}
+	}
+	return &FanOut{sinks: sinks, stats: stats}
+}
+
+// WriteStations writes stations to every sink as the snapshot taken now.
+func (f *FanOut) WriteStations(ctx context.Context, stations *tfl.Stations) (string, error) {
+	return f.WriteStationsAt(ctx, time.Now(), stations)
+}
+
+// WriteStationsAt writes stations to every sink as the snapshot taken at
+// timestamp, so that all sinks hold it under the same time. It returns the
+// key written by the first sink, the primary, or by the first sink that
+// succeeded when the primary failed.
+func (f *FanOut) WriteStationsAt(ctx context.Context, timestamp time.Time, stations *tfl.Stations) (string, error) {
+	keys := make([]string, len(f.sinks))
+	errs := make([]error, len(f.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range f.sinks {
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+
+			start := time.Now()
+			key, err := sink.Writer.WriteStationsAt(ctx, timestamp, stations)
+			f.record(sink.Name, key, err, time.Since(start))
+
+			if err != nil {
+				slog.Error("Sink write failed", "sink", sink.Name, "error", err)
+				errs[i] = fmt.Errorf("%s: %w", sink.Name, err)
+				return
+			}
+			keys[i] = key
+		}(i, sink)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if key != "" {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("all sinks failed: %w", errors.Join(errs...))
+}
+
+// Stats returns a copy of the per-sink metrics in sink order.
+func (f *FanOut) Stats() []SinkStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := make([]SinkStats, 0, len(f.sinks))
+	for _, s := range f.sinks {
+		result = append(result, *f.stats[s.Name])
+	}
+	return result
+}
+
+// record updates the metrics for a sink after a write attempt.
+func (f *FanOut) record(name, key string, err error, duration time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.stats[name]
+	st.LastDuration = duration
+	if err != nil {
+		st.Failures++
+		st.LastError = err.Error()
+		return
+	}
+	st.Writes++
+	st.LastKey = key
+	st.LastError = ""
+	st.LastSuccess = time.Now()
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// HeartbeatKey is the object key under which the last successful collection is recorded.
+const HeartbeatKey = "meta/heartbeat.json"
+
+// heartbeatTimeout bounds each heartbeat ping so a slow monitor never delays collection.
+const heartbeatTimeout = 10 * time.Second
+
+// HeartbeatRecord is the persisted form of a heartbeat.
+type HeartbeatRecord struct {
+	Time     time.Time `json:"time"`
+	Key      string    `json:"key"`
+	Stations int       `json:"stations"`
+	Replica  string    `json:"replica,omitempty"`
+}
+
+// Heartbeat signals an external dead-man's switch after every successful
+// collection, so a collector that silently stops is noticed. It can ping a
+// healthchecks.io-style URL, record a heartbeat object in the store, or both.
+type Heartbeat struct {
+	url     string
+	objects storage.ObjectStore
+	replica string
+	client  *http.Client
+}
+
+// NewHeartbeat creates a heartbeat that pings url (if set) and writes HeartbeatKey
+// to objects (if non-nil). replica identifies this collector in the heartbeat object.
+func NewHeartbeat(url string, objects storage.ObjectStore, replica string) *Heartbeat {
+	return &Heartbeat{
+		url:     url,
+		objects: objects,
+		replica: replica,
+		client:  &http.Client{Timeout: heartbeatTimeout},
+	}
+}
+
+// Success records a successful collection. Its signature matches Collector.OnWrite;
+// errors are logged.
+func (h *Heartbeat) Success(key string, stations *tfl.Stations) {
+	ctx, cancel := context.WithTimeout(context.Background(), heartbeatTimeout)
+	defer cancel()
+
+	if h.url != "" {
+		if err := h.ping(ctx, h.url); err != nil {
+			slog.Error("Heartbeat ping failed", "error", err)
+		}
+	}
+
+	if h.objects != nil {
+		data, err := json.Marshal(HeartbeatRecord{
+			Time:     time.Now().UTC(),
+			Key:      key,
+			Stations: len(stations.Stations),
+			Replica:  h.replica,
+		})
+		if err == nil {
+			err = h.objects.PutObject(ctx, HeartbeatKey, data, "application/json")
+		}
+		if err != nil {
+			slog.Error("Failed to write heartbeat object", "error", err)
+		}
+	}
+}
+
+// ReadHeartbeat returns the last successful collection recorded in objects, or
+// an error wrapping storage.ErrNotFound if no collector has written one.
+func ReadHeartbeat(ctx context.Context, objects storage.ObjectStore) (*HeartbeatRecord, error) {
+	data, err := objects.GetObject(ctx, HeartbeatKey)
+	if err != nil {
+		return nil, err
+	}
+	var rec HeartbeatRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse heartbeat: %w", err)
+	}
+	return &rec, nil
+}
+
+// Failure reports a failed collection to the ping URL's /fail endpoint, so the
+// monitor can alert before the grace period runs out. Its signature matches
+// Collector.OnFailure.
+func (h *Heartbeat) Failure(err error) {
+	if h.url == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), heartbeatTimeout)
+	defer cancel()
+
+	if err := h.ping(ctx, strings.TrimSuffix(h.url, "/")+"/fail"); err != nil {
+		slog.Error("Heartbeat failure ping failed", "error", err)
+	}
+}
+
+// ping requests url and checks for a successful response.
+func (h *Heartbeat) ping(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ping %s: %w", req.URL.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("heartbeat returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// LeaseKey is the object key under which the collector lease is recorded.
+const LeaseKey = "meta/collector-lease.json"
+
+// lease records which replica may collect and until when.
+type lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LeaderElector elects one collector replica at a time through a lease object in
+// the shared store. The holder renews the lease on every collection; if it stops,
+// another replica takes over once the lease expires.
+type LeaderElector struct {
+	store  storage.ConditionalObjectStore
+	holder string
+	ttl    time.Duration
+	leader bool
+}
+
+// NewLeaderElector creates an elector for the replica named holder. ttl is how long
+// a lease lasts without renewal and should exceed the collection interval.
+func NewLeaderElector(store storage.ConditionalObjectStore, holder string, ttl time.Duration) *LeaderElector {
+	return &LeaderElector{store: store, holder: holder, ttl: ttl}
+}
+
+// DefaultReplicaID names this replica after its host and process.
+func DefaultReplicaID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Acquire takes or renews the lease and reports whether this replica holds it.
+func (e *LeaderElector) Acquire(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+
+	var version string
+	data, v, err := e.store.GetObjectVersion(ctx, LeaseKey)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		return false, fmt.Errorf("failed to read collector lease: %w", err)
+	default:
+		var current lease
+		if err := json.Unmarshal(data, &current); err != nil {
+			return false, fmt.Errorf("failed to parse collector lease: %w", err)
+		}
+		if current.Holder != e.holder && now.Before(current.ExpiresAt) {
+			e.setLeader(false, current.Holder)
+			return false, nil
+		}
+		version = v
+	}
+
+	data, err = json.Marshal(lease{Holder: e.holder, ExpiresAt: now.Add(e.ttl)})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode collector lease: %w", err)
+	}
+	err = e.store.PutObjectIf(ctx, LeaseKey, data, "application/json", version)
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		// Another replica took or renewed the lease first
+		e.setLeader(false, "")
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write collector lease: %w", err)
+	}
+
+	e.setLeader(true, e.holder)
+	return true, nil
+}
+
+// setLeader records the election outcome, logging transitions.
+func (e *LeaderElector) setLeader(leader bool, holder string) {
+	if leader == e.leader {
+		return
+	}
+	e.leader = leader
+	if leader {
+		slog.Info("Acquired collector lease", "replica", e.holder, "ttl", e.ttl)
+	} else {
+		slog.Info("Lost collector lease", "replica", e.holder, "holder", holder)
+	}
+}
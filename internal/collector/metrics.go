@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"city-cycling/internal/tfl"
+)
+
+// Metrics exports collection outcomes in the Prometheus format.
+type Metrics struct {
+	registry    *prometheus.Registry
+	lastSuccess atomic.Int64 // unix seconds, 0 before the first success
+	successes   prometheus.Counter
+	failures    prometheus.Counter
+	invalid     prometheus.Counter
+	stations    prometheus.Gauge
+}
+
+// NewMetrics creates the collector metrics in a dedicated registry. A non-empty
+// city labels every series, so the collectors of several cities can be served
+// together with MetricsHandler.
+func NewMetrics(city string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		successes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "collector_collections_total",
+			Help: "Snapshots fetched and written successfully.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "collector_failures_total",
+			Help: "Collections that failed to fetch or write a snapshot.",
+		}),
+		invalid: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "collector_validation_failures_total",
+			Help: "Fetches that failed validation, whether rejected or written with annotations.",
+		}),
+		stations: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "collector_last_snapshot_stations",
+			Help: "Number of stations in the last snapshot written.",
+		}),
+	}
+
+	var reg prometheus.Registerer = m.registry
+	if city != "" {
+		reg = prometheus.WrapRegistererWith(prometheus.Labels{"city": city}, m.registry)
+	}
+	reg.MustRegister(
+		m.successes,
+		m.failures,
+		m.invalid,
+		m.stations,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "collector_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful collection (0 if none yet).",
+		}, func() float64 {
+			return float64(m.lastSuccess.Load())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "collector_last_success_age_seconds",
+			Help: "Seconds since the last successful collection (-1 if none yet).",
+		}, func() float64 {
+			last := m.lastSuccess.Load()
+			if last == 0 {
+				return -1
+			}
+			return time.Since(time.Unix(last, 0)).Seconds()
+		}),
+	)
+	return m
+}
+
+// Success records a successful collection. Its signature matches Collector.OnWrite.
+func (m *Metrics) Success(key string, stations *tfl.Stations) {
+	m.lastSuccess.Store(time.Now().Unix())
+	m.successes.Inc()
+	m.stations.Set(float64(len(stations.Stations)))
+	if stations.Validation != nil && !stations.Validation.Passed {
+		m.invalid.Inc()
+	}
+}
+
+// Failure records a failed collection. Its signature matches Collector.OnFailure.
+func (m *Metrics) Failure(err error) {
+	m.failures.Inc()
+	if errors.Is(err, ErrInvalidSnapshot) {
+		m.invalid.Inc()
+	}
+}
+
+// Handler serves the metrics for scraping.
+func (m *Metrics) Handler() http.Handler {
+	return MetricsHandler(m)
+}
+
+// MetricsHandler serves the metrics of several collectors in one scrape.
+func MetricsHandler(ms ...*Metrics) http.Handler {
+	gatherers := make(prometheus.Gatherers, len(ms))
+	for i, m := range ms {
+		gatherers[i] = m.registry
+	}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule reports when collections are due.
+type Schedule interface {
+	// Next returns the first collection time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a standard five-field cron expression such as "*/5 * * * *",
+// evaluated in loc. An expression may instead name its own zone with a
+// CRON_TZ=<zone> prefix.
+func ParseSchedule(expr string, loc *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if loc != nil && !strings.HasPrefix(expr, "CRON_TZ=") && !strings.HasPrefix(expr, "TZ=") {
+		expr = fmt.Sprintf("CRON_TZ=%s %s", loc, expr)
+	}
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+	}
+	return sched, nil
+}
+
+// RunSchedule collects at every time due under sched until ctx is cancelled,
+// aligning snapshots to wall-clock boundaries. Failed iterations are logged and
+// do not stop the loop.
+func (c *Collector) RunSchedule(ctx context.Context, sched Schedule) {
+	for {
+		next := sched.Next(time.Now())
+		c.log.Debug("Next collection scheduled", "at", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			c.runIteration(ctx, sched.Next(next))
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Period returns the time between collections under sched, or interval when
+// sched is nil.
+func Period(sched Schedule, interval time.Duration) time.Duration {
+	if sched == nil {
+		return interval
+	}
+	next := sched.Next(time.Now())
+	return sched.Next(next).Sub(next)
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Per-station gauge descriptions. Every station is one series per gauge, so
+// they are served apart from the collector metrics (see StationMetricsHandler).
+var (
+	stationLabels   = []string{"id", "name"}
+	stationBikes    = prometheus.NewDesc("santander_station_bikes", "Bikes docked at the station in the latest snapshot.", stationLabels, nil)
+	stationStandard = prometheus.NewDesc("santander_station_standard_bikes", "Standard (non-electric) bikes docked at the station in the latest snapshot.", stationLabels, nil)
+	stationEBikes   = prometheus.NewDesc("santander_station_ebikes", "E-bikes docked at the station in the latest snapshot.", stationLabels, nil)
+	stationEmpty    = prometheus.NewDesc("santander_station_empty_docks", "Empty docks at the station in the latest snapshot.", stationLabels, nil)
+	stationDocks    = prometheus.NewDesc("santander_station_docks", "Docks at the station in the latest snapshot.", stationLabels, nil)
+	snapshotTime    = prometheus.NewDesc("santander_snapshot_timestamp_seconds", "Unix time of the snapshot the station gauges come from.", nil, nil)
+)
+
+// StationMetrics exports the counts of every station in the latest snapshot
+// as Prometheus gauges labelled with the station's ID and name. It is safe for
+// concurrent use.
+type StationMetrics struct {
+	registry *prometheus.Registry
+
+	mu        sync.Mutex
+	timestamp time.Time
+	stations  []tfl.Station
+}
+
+// NewStationMetrics creates the station gauges in a dedicated registry. A
+// non-empty city labels every series, as with NewMetrics.
+func NewStationMetrics(city string) *StationMetrics {
+	labels := prometheus.Labels{}
+	if city != "" {
+		labels["city"] = city
+	}
+	return NewStationMetricsWithLabels(labels)
+}
+
+// NewStationMetricsWithLabels creates the station gauges in a dedicated
+// registry, with labels on every series.
+func NewStationMetricsWithLabels(labels prometheus.Labels) *StationMetrics {
+	m := &StationMetrics{registry: prometheus.NewRegistry()}
+	prometheus.WrapRegistererWith(labels, m.registry).MustRegister(m)
+	return m
+}
+
+// Set replaces the snapshot the gauges report.
+func (m *StationMetrics) Set(timestamp time.Time, stations []tfl.Station) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timestamp = timestamp
+	m.stations = stations
+}
+
+// Record reports a newly written snapshot. Its signature matches Collector.OnWrite.
+func (m *StationMetrics) Record(key string, stations *tfl.Stations) {
+	ts, err := storage.SnapshotTime(key)
+	if err != nil {
+		ts = time.Now().UTC()
+	}
+	m.Set(ts, stations.Stations)
+}
+
+// Describe implements prometheus.Collector.
+func (m *StationMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{stationBikes, stationStandard, stationEBikes, stationEmpty, stationDocks, snapshotTime} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector. Nothing is reported before the
+// first snapshot.
+func (m *StationMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	timestamp, stations := m.timestamp, m.stations
+	m.mu.Unlock()
+	if stations == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(snapshotTime, prometheus.GaugeValue, float64(timestamp.Unix()))
+	seen := make(map[int]bool, len(stations))
+	for _, s := range stations {
+		// Duplicate IDs would make the scrape fail
+		if seen[s.ID] {
+			continue
+		}
+		seen[s.ID] = true
+
+		id := strconv.Itoa(s.ID)
+		for _, g := range []struct {
+			desc  *prometheus.Desc
+			value int
+		}{
+			{stationBikes, s.NbBikes},
+			{stationStandard, s.NbStandardBikes},
+			{stationEBikes, s.NbEBikes},
+			{stationEmpty, s.NbEmptyDocks},
+			{stationDocks, s.NbDocks},
+		} {
+			ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, float64(g.value), id, s.Name)
+		}
+	}
+}
+
+// StationMetricsHandler serves the station gauges of several cities in one scrape.
+func StationMetricsHandler(ms ...*StationMetrics) http.Handler {
+	gatherers := make(prometheus.Gatherers, len(ms))
+	for i, m := range ms {
+		gatherers[i] = m.registry
+	}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
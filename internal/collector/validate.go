@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"city-cycling/internal/tfl"
+)
+
+// ErrInvalidSnapshot is returned (wrapped) by Collect when a fetch fails
+// validation under PolicyReject.
+var ErrInvalidSnapshot = errors.New("snapshot failed validation")
+
+// ValidationPolicy decides what happens to a fetch that fails validation.
+type ValidationPolicy string
+
+const (
+	// PolicyReject drops the fetch; the collection fails and nothing is written.
+	PolicyReject ValidationPolicy = "reject"
+	// PolicyAnnotate writes the snapshot with the issues in its metadata.
+	PolicyAnnotate ValidationPolicy = "annotate"
+	// PolicyAlert annotates and also notifies the OnInvalid callbacks.
+	PolicyAlert ValidationPolicy = "alert"
+)
+
+// maxListedStations caps how many station IDs an issue lists, keeping the
+// summary small enough for object metadata.
+const maxListedStations = 5
+
+// ParseValidationPolicy parses a -validate flag value.
+func ParseValidationPolicy(s string) (ValidationPolicy, error) {
+	switch p := ValidationPolicy(s); p {
+	case PolicyReject, PolicyAnnotate, PolicyAlert:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown validation policy %q (want reject, annotate or alert)", s)
+}
+
+// ValidationConfig configures a Validator.
+type ValidationConfig struct {
+	Policy ValidationPolicy
+	// MinStations and MaxStations bound the station count; 0 disables a bound.
+	MinStations int
+	MaxStations int
+}
+
+// WithBounds returns cfg with the station count bounds replaced by min and max
+// where they are non-zero, e.g. a city's own bounds over the defaults.
+func (cfg ValidationConfig) WithBounds(min, max int) ValidationConfig {
+	if min > 0 {
+		cfg.MinStations = min
+	}
+	if max > 0 {
+		cfg.MaxStations = max
+	}
+	return cfg
+}
+
+// Validator sanity-checks each fetch before it is written, so a half-broken
+// upstream response is not archived as truth. It remembers the last accepted
+// fetch to check that lastUpdate never goes backwards.
+type Validator struct {
+	cfg        ValidationConfig
+	lastUpdate int64
+}
+
+// NewValidator creates a validator. Each collector needs its own.
+func NewValidator(cfg ValidationConfig) *Validator {
+	return &Validator{cfg: cfg}
+}
+
+// Policy returns the validator's policy.
+func (v *Validator) Policy() ValidationPolicy {
+	return v.cfg.Policy
+}
+
+// Check validates stations and returns the result; it does not modify stations.
+func (v *Validator) Check(stations *tfl.Stations) *tfl.Validation {
+	var issues []string
+
+	n := len(stations.Stations)
+	if v.cfg.MinStations > 0 && n < v.cfg.MinStations {
+		issues = append(issues, fmt.Sprintf("%d stations, expected at least %d", n, v.cfg.MinStations))
+	}
+	if v.cfg.MaxStations > 0 && n > v.cfg.MaxStations {
+		issues = append(issues, fmt.Sprintf("%d stations, expected at most %d", n, v.cfg.MaxStations))
+	}
+
+	var negative, overfull []int
+	for _, s := range stations.Stations {
+		if s.NbBikes < 0 || s.NbStandardBikes < 0 || s.NbEBikes < 0 || s.NbEmptyDocks < 0 || s.NbDocks < 0 {
+			negative = append(negative, s.ID)
+		} else if s.NbBikes+s.NbEmptyDocks > s.NbDocks {
+			overfull = append(overfull, s.ID)
+		}
+	}
+	if len(negative) > 0 {
+		issues = append(issues, stationIssue(negative, "negative counts"))
+	}
+	if len(overfull) > 0 {
+		issues = append(issues, stationIssue(overfull, "more bikes and empty docks than docks"))
+	}
+
+	if v.lastUpdate != 0 && stations.LastUpdate < v.lastUpdate {
+		issues = append(issues, fmt.Sprintf("lastUpdate %d is older than the previous snapshot's %d", stations.LastUpdate, v.lastUpdate))
+	}
+
+	return &tfl.Validation{Passed: len(issues) == 0, Issues: issues}
+}
+
+// Accept records stations as written, making its lastUpdate the new baseline.
+func (v *Validator) Accept(stations *tfl.Stations) {
+	if stations.LastUpdate > v.lastUpdate {
+		v.lastUpdate = stations.LastUpdate
+	}
+}
+
+// stationIssue describes a problem affecting several stations, listing the first few.
+func stationIssue(ids []int, what string) string {
+	listed := ids
+	if len(listed) > maxListedStations {
+		listed = listed[:maxListedStations]
+	}
+	parts := make([]string, len(listed))
+	for i, id := range listed {
+		parts[i] = fmt.Sprint(id)
+	}
+	list := strings.Join(parts, ", ")
+	if len(ids) > len(listed) {
+		list += ", ..."
+	}
+	return fmt.Sprintf("%d stations with %s (%s)", len(ids), what, list)
+}
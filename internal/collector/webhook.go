@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Snapshot webhook defaults.
+const (
+	DefaultWebhookAttempts = 4
+	DefaultWebhookBackoff  = 5 * time.Second
+)
+
+// webhookTimeout bounds each delivery attempt.
+const webhookTimeout = 10 * time.Second
+
+// maxRetryAfter caps how long a Retry-After header may delay the next attempt.
+const maxRetryAfter = 5 * time.Minute
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed with
+// the webhook secret, as "sha256=<hex>".
+const SignatureHeader = "X-Signature-256"
+
+// WebhookConfig configures a SnapshotWebhook.
+type WebhookConfig struct {
+	URL string
+	// Secret signs each request body (see SignatureHeader); empty sends no signature.
+	Secret string
+	// City is the ID of the city the snapshots belong to.
+	City string
+	// MaxAttempts is how many times a delivery is tried; Backoff is the wait
+	// before the first retry, doubling for each one after.
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// webhookPayload is the JSON body of a snapshot webhook.
+type webhookPayload struct {
+	Event     string        `json:"event"`
+	City      string        `json:"city"`
+	Key       string        `json:"key"`
+	Timestamp time.Time     `json:"timestamp"`
+	Source    string        `json:"source,omitempty"`
+	Stations  int           `json:"stations"`
+	Totals    webhookTotals `json:"totals"`
+	// Valid is false when the snapshot was written with validation issues.
+	Valid  bool     `json:"valid"`
+	Issues []string `json:"issues,omitempty"`
+}
+
+// webhookTotals are the network-wide counts in a webhook payload.
+type webhookTotals struct {
+	Bikes      int `json:"bikes"`
+	EBikes     int `json:"ebikes"`
+	EmptyDocks int `json:"emptyDocks"`
+	Docks      int `json:"docks"`
+}
+
+// SnapshotWebhook POSTs the key and summary of every snapshot written to a
+// URL, so downstream jobs can react to new data instead of polling the store.
+// Deliveries run in the background and are retried with exponential backoff
+// on network errors, 429 and 5xx responses.
+type SnapshotWebhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// NewSnapshotWebhook creates a webhook; zero MaxAttempts and Backoff take the
+// defaults.
+func NewSnapshotWebhook(cfg WebhookConfig) *SnapshotWebhook {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultWebhookAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultWebhookBackoff
+	}
+	return &SnapshotWebhook{cfg: cfg, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Send delivers a newly written snapshot in the background. Its signature
+// matches Collector.OnWrite; failures are logged.
+func (w *SnapshotWebhook) Send(key string, stations *tfl.Stations) {
+	ts, err := storage.SnapshotTime(key)
+	if err != nil {
+		ts = time.Now().UTC().Truncate(time.Second)
+	}
+	payload := webhookPayload{
+		Event:     "snapshot.written",
+		City:      w.cfg.City,
+		Key:       key,
+		Timestamp: ts,
+		Source:    stations.Source,
+		Stations:  len(stations.Stations),
+		Valid:     stations.Validation == nil || stations.Validation.Passed,
+	}
+	if stations.Validation != nil {
+		payload.Issues = stations.Validation.Issues
+	}
+	for _, s := range stations.Stations {
+		payload.Totals.Bikes += s.NbBikes
+		payload.Totals.EBikes += s.NbEBikes
+		payload.Totals.EmptyDocks += s.NbEmptyDocks
+		payload.Totals.Docks += s.NbDocks
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode snapshot webhook", "key", key, "error", err)
+		return
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if err := w.deliver(context.Background(), key, body); err != nil {
+			slog.Error("Snapshot webhook failed", "key", key, "attempts", w.cfg.MaxAttempts, "error", err)
+		}
+	}()
+}
+
+// Wait blocks until every delivery in progress has succeeded or given up.
+func (w *SnapshotWebhook) Wait() {
+	w.wg.Wait()
+}
+
+// deliver POSTs body, retrying as configured.
+func (w *SnapshotWebhook) deliver(ctx context.Context, key string, body []byte) error {
+	backoff := w.cfg.Backoff
+	var err error
+	for attempt := 1; attempt <= w.cfg.MaxAttempts; attempt++ {
+		var retryAfter time.Duration
+		var retry bool
+		retryAfter, retry, err = w.post(ctx, key, body, attempt)
+		if err == nil {
+			slog.Debug("Snapshot webhook delivered", "key", key, "attempt", attempt)
+			return nil
+		}
+		if !retry || attempt == w.cfg.MaxAttempts {
+			break
+		}
+
+		wait := max(backoff, retryAfter)
+		slog.Warn("Snapshot webhook attempt failed, retrying", "key", key, "attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// post makes one delivery attempt. It reports whether a failure is worth
+// retrying and how long the receiver asked to wait first, if it did.
+func (w *SnapshotWebhook) post(ctx context.Context, key string, body []byte, attempt int) (time.Duration, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "city-cycling-collector")
+	// The key identifies the delivery, so receivers can ignore retried duplicates
+	req.Header.Set("X-Webhook-Id", key)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+	if w.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.cfg.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, true, fmt.Errorf("failed to post to %s: %w", req.URL.Host, err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = min(time.Duration(secs)*time.Second, maxRetryAfter)
+		}
+		return retryAfter, true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return 0, false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+// Sign returns the SignatureHeader value for body: "sha256=" followed by the
+// hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
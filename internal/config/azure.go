@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/joho/godotenv"
+)
+
+// AzureConfig holds Azure Blob Storage configuration.
+// Either ConnectionString or AccountURL must be set; AccountURL is accessed
+// with the default Azure credential chain (managed identity, environment, CLI).
+type AzureConfig struct {
+	ConnectionString string
+	AccountURL       string
+	Container        string
+	Prefix           string
+}
+
+// LoadAzureConfig loads Azure Blob Storage configuration from environment variables or .env file.
+func LoadAzureConfig() (*AzureConfig, error) {
+	// Ignore error if file doesn't exist (expected in production)
+	_ = godotenv.Load()
+
+	var env envReader
+	connectionString := env.get("AZURE_STORAGE_CONNECTION_STRING")
+	accountURL := env.get("AZURE_STORAGE_ACCOUNT_URL")
+	account := env.get("AZURE_STORAGE_ACCOUNT")
+	container := env.get("AZURE_STORAGE_CONTAINER")
+	prefix := env.get("AZURE_STORAGE_PREFIX")
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	if prefix == "" {
+		prefix = "snapshots/"
+	}
+
+	// An account name alone is enough to build the public endpoint URL
+	if accountURL == "" && account != "" {
+		accountURL = fmt.Sprintf("https://%s.blob.core.windows.net/", account)
+	}
+
+	// Validate required fields
+	var missing []string
+	if connectionString == "" && accountURL == "" {
+		missing = append(missing, "AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT_URL")
+	}
+	if container == "" {
+		missing = append(missing, "AZURE_STORAGE_CONTAINER")
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required environment variables: %v", missing)
+	}
+
+	return &AzureConfig{
+		ConnectionString: connectionString,
+		AccountURL:       accountURL,
+		Container:        container,
+		Prefix:           prefix,
+	}, nil
+}
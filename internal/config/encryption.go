@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+
+	"city-cycling/internal/storage"
+)
+
+// LoadSnapshotKeys loads the keys snapshots are encrypted with at rest from
+// SNAPSHOT_KEYS: comma-separated id:key pairs of base64 AES keys, the current
+// key first. Like any secret it may be given as SNAPSHOT_KEYS_FILE or held in
+// AWS Secrets Manager or Vault. It returns a nil keyring when unset, which
+// leaves snapshots unencrypted.
+func LoadSnapshotKeys() (*storage.Keyring, error) {
+	spec, err := Secret("SNAPSHOT_KEYS")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := storage.ParseKeyring(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SNAPSHOT_KEYS: %w", err)
+	}
+	return keys, nil
+}
@@ -2,7 +2,6 @@ package config
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/joho/godotenv"
 )
@@ -25,12 +24,17 @@ func LoadR2Config() (*R2Config, error) {
 	// Ignore error if file doesn't exist (expected in production)
 	_ = godotenv.Load()
 
-	accessKeyID := os.Getenv("S3_ACCESS_KEY_ID")
-	secretAccessKey := os.Getenv("S3_SECRET_ACCESS_KEY")
-	endpoint := os.Getenv("S3_ENDPOINT")
-	bucketName := os.Getenv("S3_BUCKET_NAME")
-	prefix := os.Getenv("S3_PREFIX")
-	region := os.Getenv("S3_REGION")
+	// Any variable may instead be supplied as NAME_FILE or a secret manager reference
+	var env envReader
+	accessKeyID := env.get("S3_ACCESS_KEY_ID")
+	secretAccessKey := env.get("S3_SECRET_ACCESS_KEY")
+	endpoint := env.get("S3_ENDPOINT")
+	bucketName := env.get("S3_BUCKET_NAME")
+	prefix := env.get("S3_PREFIX")
+	region := env.get("S3_REGION")
+	if env.err != nil {
+		return nil, env.err
+	}
 
 	if prefix == "" {
 		prefix = "snapshots/"
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+const (
+	// awsSecretScheme and vaultSecretScheme prefix environment values that refer
+	// to a secret held in AWS Secrets Manager or HashiCorp Vault.
+	awsSecretScheme   = "awssm://"
+	vaultSecretScheme = "vault://"
+
+	// secretFetchTimeout bounds each secret manager request.
+	secretFetchTimeout = 10 * time.Second
+)
+
+var (
+	// secretCache holds fetched secret documents by scheme and ID, so several
+	// variables drawn from one secret cost a single request.
+	secretCache   = make(map[string]string)
+	secretCacheMu sync.Mutex
+)
+
+// Secret returns the value of the environment variable name. Secrets need not be
+// passed as plain environment values:
+//
+//   - NAME_FILE names a file holding the value (Docker/Kubernetes secrets);
+//     a trailing newline is removed.
+//   - A value of awssm://<secret-id>[#field] is fetched from AWS Secrets Manager
+//     using the default AWS credential chain.
+//   - A value of vault://<mount>/<path>[#field] is read from a Vault KV v2 engine
+//     at VAULT_ADDR, authenticated with VAULT_TOKEN (or VAULT_TOKEN_FILE).
+//
+// For secret manager references, field selects a key of a JSON secret and
+// defaults to name. A secret that is not a JSON object is used as a whole.
+func Secret(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		path := os.Getenv(name + "_FILE")
+		if path == "" {
+			return "", nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	switch {
+	case strings.HasPrefix(value, awsSecretScheme):
+		return resolveSecret(name, awsSecretScheme, strings.TrimPrefix(value, awsSecretScheme), fetchAWSSecret)
+	case strings.HasPrefix(value, vaultSecretScheme):
+		return resolveSecret(name, vaultSecretScheme, strings.TrimPrefix(value, vaultSecretScheme), fetchVaultSecret)
+	}
+	return value, nil
+}
+
+// resolveSecret fetches the secret ref (<id>[#field]) with fetch and selects field.
+func resolveSecret(name, scheme, ref string, fetch func(ctx context.Context, id string) (string, error)) (string, error) {
+	id, field, ok := strings.Cut(ref, "#")
+	if !ok {
+		field = name
+	}
+	if id == "" {
+		return "", fmt.Errorf("empty secret reference in %s", name)
+	}
+
+	secretCacheMu.Lock()
+	defer secretCacheMu.Unlock()
+
+	doc, cached := secretCache[scheme+id]
+	if !cached {
+		ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+		defer cancel()
+
+		var err error
+		doc, err = fetch(ctx, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch secret for %s: %w", name, err)
+		}
+		secretCache[scheme+id] = doc
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(doc), &fields); err != nil {
+		// Plain-text secret
+		return doc, nil
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret for %s has no field %q", name, field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// fetchAWSSecret returns the string value of an AWS Secrets Manager secret.
+func fetchAWSSecret(ctx context.Context, id string) (string, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", id)
+	}
+	return *out.SecretString, nil
+}
+
+// fetchVaultSecret reads a Vault KV v2 secret (<mount>/<path>) and returns its
+// data as a JSON object.
+func fetchVaultSecret(ctx context.Context, id string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if path := os.Getenv("VAULT_TOKEN_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read VAULT_TOKEN_FILE: %w", err)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("VAULT_TOKEN is not set")
+	}
+
+	mount, path, ok := strings.Cut(id, "/")
+	if !ok || path == "" {
+		return "", fmt.Errorf("vault reference %q must be <mount>/<path>", id)
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(addr, "/"), mount, path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	return string(result.Data.Data), nil
+}
+
+// envReader resolves a series of variables with Secret, keeping the first error.
+type envReader struct {
+	err error
+}
+
+// get returns the resolved value of name, or "" once an error has occurred.
+func (e *envReader) get(name string) string {
+	if e.err != nil {
+		return ""
+	}
+	v, err := Secret(name)
+	if err != nil {
+		e.err = err
+	}
+	return v
+}
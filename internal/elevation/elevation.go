@@ -0,0 +1,257 @@
+// Package elevation looks up the ground height of stations, from an offline
+// dataset or an elevation API, for analyses such as uphill stations emptying.
+package elevation
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/geo"
+)
+
+const (
+	// OpenMeteoEndpoint is the Open-Meteo elevation API, backed by a 90 m
+	// digital elevation model and free for non-commercial use.
+	OpenMeteoEndpoint = "https://api.open-meteo.com/v1/elevation"
+	// openMeteoBatch is the most coordinates Open-Meteo accepts per request.
+	openMeteoBatch = 100
+	// DefaultTimeout for HTTP requests.
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxDistance is how far a station may be from the nearest point of
+	// a coordinate dataset for that point's elevation to be used.
+	DefaultMaxDistance = 250.0 // meters
+)
+
+// Point is a station whose elevation is wanted.
+type Point struct {
+	StationID int
+	Lat, Lng  float64
+}
+
+// Source looks up elevations in meters above sea level.
+type Source interface {
+	// Lookup returns the elevations it knows of points, keyed by station ID.
+	// Points it has no elevation for are left out.
+	Lookup(ctx context.Context, points []Point) (map[int]float64, error)
+}
+
+// NewSource returns the source named by spec: "open-meteo" for the Open-Meteo
+// API, or the path of a CSV file read by LoadFile.
+func NewSource(spec string) (Source, error) {
+	if spec == "open-meteo" {
+		return NewOpenMeteo(OpenMeteoEndpoint), nil
+	}
+	return LoadFile(spec)
+}
+
+// OpenMeteo looks up elevations with the Open-Meteo elevation API.
+type OpenMeteo struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewOpenMeteo creates a client for the Open-Meteo elevation API at endpoint.
+func NewOpenMeteo(endpoint string) *OpenMeteo {
+	return &OpenMeteo{
+		endpoint: endpoint,
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+	}
+}
+
+// Lookup implements Source, asking for up to 100 points per request.
+func (o *OpenMeteo) Lookup(ctx context.Context, points []Point) (map[int]float64, error) {
+	result := make(map[int]float64, len(points))
+	for start := 0; start < len(points); start += openMeteoBatch {
+		batch := points[start:min(start+openMeteoBatch, len(points))]
+		lats := make([]string, len(batch))
+		lngs := make([]string, len(batch))
+		for i, p := range batch {
+			lats[i] = strconv.FormatFloat(p.Lat, 'f', 6, 64)
+			lngs[i] = strconv.FormatFloat(p.Lng, 'f', 6, 64)
+		}
+		query := url.Values{"latitude": {strings.Join(lats, ",")}, "longitude": {strings.Join(lngs, ",")}}
+
+		var response struct {
+			Elevation []float64 `json:"elevation"`
+		}
+		if err := o.get(ctx, o.endpoint+"?"+query.Encode(), &response); err != nil {
+			return result, err
+		}
+		if len(response.Elevation) != len(batch) {
+			return result, fmt.Errorf("open-meteo returned %d elevations for %d points", len(response.Elevation), len(batch))
+		}
+		for i, p := range batch {
+			result[p.StationID] = response.Elevation[i]
+		}
+	}
+	return result, nil
+}
+
+// get fetches url and decodes its JSON body into v.
+func (o *OpenMeteo) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "city-cycling/1.0")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch elevations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from elevation API: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse elevations: %w", err)
+	}
+	return nil
+}
+
+// File is an offline elevation dataset, by station ID or by coordinates.
+type File struct {
+	// MaxDistance bounds how far a station may be from a coordinate row.
+	MaxDistance float64
+
+	byStation map[int]float64
+	samples   []sample
+}
+
+// sample is a coordinate row of a dataset.
+type sample struct {
+	lat, lng, elevation float64
+}
+
+// LoadFile reads a CSV dataset with a header row naming an elevation column
+// and either an id column of station IDs or lat and lng (or lon) columns; a
+// station is then given the elevation of the nearest row within MaxDistance.
+func LoadFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open elevation dataset: %w", err)
+	}
+	defer f.Close()
+
+	file, err := parseFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse elevation dataset %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// parseFile reads a dataset in the format described at LoadFile.
+func parseFile(r io.Reader) (*File, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(names ...string) (int, bool) {
+		for _, name := range names {
+			if i, ok := cols[name]; ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	elevationCol, ok := column("elevation")
+	if !ok {
+		return nil, errors.New("no elevation column")
+	}
+	idCol, byID := column("id")
+	latCol, hasLat := column("lat", "latitude")
+	lngCol, hasLng := column("lng", "lon", "long", "longitude")
+	if !byID && !(hasLat && hasLng) {
+		return nil, errors.New("needs an id column or lat and lng columns")
+	}
+
+	file := &File{MaxDistance: DefaultMaxDistance, byStation: make(map[int]float64)}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		number := func(col int) (float64, error) {
+			if col >= len(record) {
+				return 0, fmt.Errorf("line %d: missing column %d", line, col+1)
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(record[col]), 64)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: %w", line, err)
+			}
+			return v, nil
+		}
+
+		elevation, err := number(elevationCol)
+		if err != nil {
+			return nil, err
+		}
+		if byID {
+			id, err := number(idCol)
+			if err != nil {
+				return nil, err
+			}
+			file.byStation[int(id)] = elevation
+			continue
+		}
+		lat, err := number(latCol)
+		if err != nil {
+			return nil, err
+		}
+		lng, err := number(lngCol)
+		if err != nil {
+			return nil, err
+		}
+		file.samples = append(file.samples, sample{lat: lat, lng: lng, elevation: elevation})
+	}
+	return file, nil
+}
+
+// Lookup implements Source.
+func (f *File) Lookup(_ context.Context, points []Point) (map[int]float64, error) {
+	result := make(map[int]float64, len(points))
+	for _, p := range points {
+		if elevation, ok := f.byStation[p.StationID]; ok {
+			result[p.StationID] = elevation
+			continue
+		}
+		nearest, best := -1, f.MaxDistance
+		for i, s := range f.samples {
+			if d := geo.DistanceMeters(p.Lat, p.Lng, s.lat, s.lng); d <= best {
+				nearest, best = i, d
+			}
+		}
+		if nearest >= 0 {
+			result[p.StationID] = f.samples[nearest].elevation
+		}
+	}
+	return result, nil
+}
+
+var (
+	_ Source = (*OpenMeteo)(nil)
+	_ Source = (*File)(nil)
+)
@@ -0,0 +1,200 @@
+// Package events derives a compact log of per-station changes from consecutive
+// snapshots and stores it next to them.
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// KeyPrefix is the object key prefix under which event logs are stored, one
+// object per snapshot that changed anything.
+const KeyPrefix = "events/"
+
+// Fields whose changes are logged: the snapshot TSV count columns, so the log
+// can be rebuilt from stored snapshots, and FieldPresent for a station
+// appearing in or disappearing from the feed.
+const (
+	FieldNbBikes         = "nb_bikes"
+	FieldNbStandardBikes = "nb_standard_bikes"
+	FieldNbEBikes        = "nb_ebikes"
+	FieldNbEmptyDocks    = "nb_empty_docks"
+	FieldNbDocks         = "nb_docks"
+	FieldPresent         = "present"
+)
+
+// header is the first line of every event log.
+const header = "timestamp\tstation\tfield\told\tnew"
+
+// Event is a single change to one field of one station.
+type Event struct {
+	Timestamp time.Time
+	StationID int
+	Field     string
+	Old       string
+	New       string
+}
+
+// Key returns the object key of the event log for a snapshot taken at ts.
+func Key(ts time.Time) string {
+	return fmt.Sprintf("%sevents_%s.tsv", KeyPrefix, ts.UTC().Format("20060102_150405"))
+}
+
+// Diff returns the changes from prev to cur, stamped with ts and ordered by
+// station ID.
+func Diff(prev, cur []tfl.Station, ts time.Time) []Event {
+	before := make(map[int]tfl.Station, len(prev))
+	for _, s := range prev {
+		before[s.ID] = s
+	}
+
+	var events []Event
+	add := func(id int, field, old, new string) {
+		if old != new {
+			events = append(events, Event{Timestamp: ts, StationID: id, Field: field, Old: old, New: new})
+		}
+	}
+	seen := make(map[int]bool, len(cur))
+	for _, s := range cur {
+		seen[s.ID] = true
+		p, ok := before[s.ID]
+		if !ok {
+			add(s.ID, FieldPresent, "false", "true")
+			continue
+		}
+		add(s.ID, FieldNbBikes, strconv.Itoa(p.NbBikes), strconv.Itoa(s.NbBikes))
+		add(s.ID, FieldNbStandardBikes, strconv.Itoa(p.NbStandardBikes), strconv.Itoa(s.NbStandardBikes))
+		add(s.ID, FieldNbEBikes, strconv.Itoa(p.NbEBikes), strconv.Itoa(s.NbEBikes))
+		add(s.ID, FieldNbEmptyDocks, strconv.Itoa(p.NbEmptyDocks), strconv.Itoa(s.NbEmptyDocks))
+		add(s.ID, FieldNbDocks, strconv.Itoa(p.NbDocks), strconv.Itoa(s.NbDocks))
+	}
+	for _, p := range prev {
+		if !seen[p.ID] {
+			add(p.ID, FieldPresent, "true", "false")
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StationID < events[j].StationID
+	})
+	return events
+}
+
+// Encode writes events as TSV with a header line.
+func Encode(w io.Writer, events []Event) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, header)
+	for _, e := range events {
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%s\t%s\n", e.Timestamp.UTC().Format(time.RFC3339), e.StationID, e.Field, e.Old, e.New)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write events: %w", err)
+	}
+	return nil
+}
+
+// Decode parses an event log written by Encode.
+func Decode(r io.Reader) ([]Event, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read events: %w", err)
+		}
+		return nil, nil
+	}
+	if scanner.Text() != header {
+		return nil, fmt.Errorf("unexpected event log header %q", scanner.Text())
+	}
+
+	var events []Event
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("line %d: expected 5 fields, got %d", line, len(fields))
+		}
+		ts, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %w", line, err)
+		}
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid station: %w", line, err)
+		}
+		events = append(events, Event{Timestamp: ts, StationID: id, Field: fields[2], Old: fields[3], New: fields[4]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	return events, nil
+}
+
+// Log diffs each snapshot against the previous one and stores the changes.
+// It is safe for concurrent use.
+type Log struct {
+	objects storage.ObjectStore
+
+	mu   sync.Mutex
+	prev []tfl.Station
+}
+
+// NewLog creates an event log writing to objects. prev is the snapshot the
+// first diff is taken against, typically the latest stored one; nil makes the
+// first snapshot only seed the log.
+func NewLog(objects storage.ObjectStore, prev []tfl.Station) *Log {
+	return &Log{objects: objects, prev: prev}
+}
+
+// Write stores the changes between the previous snapshot and stations, taken
+// at ts. Nothing is stored when nothing changed.
+func (l *Log) Write(ctx context.Context, ts time.Time, stations []tfl.Station) (int, error) {
+	l.mu.Lock()
+	prev := l.prev
+	l.prev = stations
+	l.mu.Unlock()
+	if prev == nil {
+		return 0, nil
+	}
+
+	events := Diff(prev, stations, ts)
+	if len(events) == 0 {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, events); err != nil {
+		return 0, err
+	}
+	if err := l.objects.PutObject(ctx, Key(ts), buf.Bytes(), "text/tab-separated-values"); err != nil {
+		return 0, fmt.Errorf("failed to store events: %w", err)
+	}
+	return len(events), nil
+}
+
+// Record writes the events for a newly written snapshot. Its signature matches
+// Collector.OnWrite.
+func (l *Log) Record(key string, stations *tfl.Stations) {
+	// Stamp events with the snapshot's own time so the two line up
+	ts, err := storage.SnapshotTime(key)
+	if err != nil {
+		ts = time.Now().UTC().Truncate(time.Second)
+	}
+	n, err := l.Write(context.Background(), ts, stations.Stations)
+	if err != nil {
+		slog.Error("Failed to write event log", "key", key, "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Debug("Stored station events", "key", key, "events", n)
+	}
+}
@@ -0,0 +1,243 @@
+// Package export materializes ranges of the snapshot archive into a single
+// SQLite database file that can be shared without access to the store.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+
+	// Registers the pure Go "sqlite" driver, so exports need no cgo
+	_ "modernc.org/sqlite"
+)
+
+// timeFormat is how timestamps are stored: ISO 8601 text, which SQLite's date
+// functions and DuckDB's sqlite scanner both understand.
+const timeFormat = "2006-01-02T15:04:05Z"
+
+// batchSnapshots is how many snapshots are written per transaction.
+const batchSnapshots = 100
+
+// schema creates the tables of an export. Indexes are created by indexes once
+// the rows are loaded, which is much faster than maintaining them on insert.
+const schema = `
+CREATE TABLE metadata (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE snapshots (
+	id            INTEGER PRIMARY KEY,
+	timestamp     TEXT NOT NULL,
+	station_count INTEGER NOT NULL
+);
+CREATE TABLE stations (
+	id         INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	lat        REAL NOT NULL,
+	lng        REAL NOT NULL,
+	docks      INTEGER NOT NULL,
+	first_seen TEXT NOT NULL,
+	last_seen  TEXT NOT NULL
+);
+CREATE TABLE readings (
+	snapshot_id       INTEGER NOT NULL REFERENCES snapshots(id),
+	station_id        INTEGER NOT NULL REFERENCES stations(id),
+	nb_bikes          INTEGER NOT NULL,
+	nb_standard_bikes INTEGER NOT NULL,
+	nb_ebikes         INTEGER NOT NULL,
+	nb_empty_docks    INTEGER NOT NULL,
+	nb_docks          INTEGER NOT NULL,
+	PRIMARY KEY (snapshot_id, station_id)
+) WITHOUT ROWID;
+`
+
+// indexes speed up the common queries: by time and by station over time.
+const indexes = `
+CREATE INDEX snapshots_timestamp ON snapshots (timestamp);
+CREATE INDEX readings_station ON readings (station_id, snapshot_id);
+`
+
+// Stats describes what an export contains.
+type Stats struct {
+	Snapshots int
+	Stations  int
+	Rows      int
+	// First and Last are the times of the oldest and newest snapshot exported.
+	First time.Time
+	Last  time.Time
+}
+
+// stationSummary is a station's row in the stations table: its name, position
+// and docks as of the last reading exported.
+type stationSummary struct {
+	station   tfl.Station
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// WriteSQLite exports every snapshot in [from, to] from store to a new SQLite
+// database at path, recording metadata (such as the city) alongside. path must
+// not exist. On error the partial file is removed.
+func WriteSQLite(ctx context.Context, path string, store storage.RangeDataStore, from, to time.Time, metadata map[string]string) (_ Stats, err error) {
+	if _, err := os.Stat(path); err == nil {
+		return Stats{}, fmt.Errorf("export file %s already exists", path)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to create export: %w", err)
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to close export: %w", cerr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	// One connection: the pragmas below are per connection
+	db.SetMaxOpenConns(1)
+
+	// The file is built from scratch and discarded on failure, so it needs
+	// no rollback journal or fsyncs
+	if _, err := db.ExecContext(ctx, "PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF;"+schema); err != nil {
+		return Stats{}, fmt.Errorf("failed to create export schema: %w", err)
+	}
+
+	var stats Stats
+	stations := make(map[int]*stationSummary)
+	var tx *sql.Tx
+	var insertSnapshot, insertReading *sql.Stmt
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		defer func() { tx = nil }()
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		return nil
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = store.ForEachSnapshot(ctx, from, to, func(snap storage.Snapshot) error {
+		if tx == nil {
+			var err error
+			if tx, err = db.BeginTx(ctx, nil); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+			if insertSnapshot, err = tx.PrepareContext(ctx, "INSERT INTO snapshots (id, timestamp, station_count) VALUES (?, ?, ?)"); err != nil {
+				return fmt.Errorf("failed to prepare export: %w", err)
+			}
+			if insertReading, err = tx.PrepareContext(ctx, "INSERT OR REPLACE INTO readings VALUES (?, ?, ?, ?, ?, ?, ?)"); err != nil {
+				return fmt.Errorf("failed to prepare export: %w", err)
+			}
+		}
+
+		stats.Snapshots++
+		id := stats.Snapshots
+		ts := snap.Timestamp.UTC()
+		if stats.First.IsZero() {
+			stats.First = ts
+		}
+		stats.Last = ts
+		if _, err := insertSnapshot.ExecContext(ctx, id, ts.Format(timeFormat), len(snap.Stations)); err != nil {
+			return fmt.Errorf("failed to write snapshot %s: %w", ts.Format(time.RFC3339), err)
+		}
+		for _, s := range snap.Stations {
+			if _, err := insertReading.ExecContext(ctx, id, s.ID, s.NbBikes, s.NbStandardBikes, s.NbEBikes, s.NbEmptyDocks, s.NbDocks); err != nil {
+				return fmt.Errorf("failed to write snapshot %s: %w", ts.Format(time.RFC3339), err)
+			}
+			stats.Rows++
+			summary := stations[s.ID]
+			if summary == nil {
+				summary = &stationSummary{firstSeen: ts}
+				stations[s.ID] = summary
+			}
+			summary.station, summary.lastSeen = s, ts
+		}
+
+		if stats.Snapshots%batchSnapshots == 0 {
+			return commit()
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	if err := commit(); err != nil {
+		return Stats{}, err
+	}
+
+	if err := writeStations(ctx, db, stations); err != nil {
+		return Stats{}, err
+	}
+	stats.Stations = len(stations)
+
+	metadata = withStats(metadata, stats, from, to)
+	for k, v := range metadata {
+		if _, err := db.ExecContext(ctx, "INSERT INTO metadata (key, value) VALUES (?, ?)", k, v); err != nil {
+			return Stats{}, fmt.Errorf("failed to write export metadata: %w", err)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, indexes+"ANALYZE;"); err != nil {
+		return Stats{}, fmt.Errorf("failed to index export: %w", err)
+	}
+	return stats, nil
+}
+
+// writeStations fills the stations table.
+func writeStations(ctx context.Context, db *sql.DB, stations map[int]*stationSummary) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write export stations: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO stations VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare export stations: %w", err)
+	}
+	for id, s := range stations {
+		if _, err := stmt.ExecContext(ctx, id, s.station.Name, s.station.Lat, s.station.Long, s.station.NbDocks, s.firstSeen.Format(timeFormat), s.lastSeen.Format(timeFormat)); err != nil {
+			return fmt.Errorf("failed to write station %d: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write export stations: %w", err)
+	}
+	return nil
+}
+
+// withStats returns metadata with the export's range and counts added.
+func withStats(metadata map[string]string, stats Stats, from, to time.Time) map[string]string {
+	result := map[string]string{
+		"exported_at": time.Now().UTC().Format(timeFormat),
+		"snapshots":   fmt.Sprint(stats.Snapshots),
+		"stations":    fmt.Sprint(stats.Stations),
+		"rows":        fmt.Sprint(stats.Rows),
+	}
+	if !from.IsZero() {
+		result["from"] = from.UTC().Format(timeFormat)
+	}
+	if !to.IsZero() {
+		result["to"] = to.UTC().Format(timeFormat)
+	}
+	if !stats.First.IsZero() {
+		result["first_snapshot"] = stats.First.Format(timeFormat)
+		result["last_snapshot"] = stats.Last.Format(timeFormat)
+	}
+	for k, v := range metadata {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,349 @@
+// Package gbfs reads bike-share feeds published in the General Bikeshare Feed
+// Specification (GBFS) and converts them to the station model used throughout
+// the repository.
+package gbfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+
+	"city-cycling/internal/telemetry"
+	"city-cycling/internal/tfl"
+)
+
+// DefaultTimeout for HTTP requests.
+const DefaultTimeout = 30 * time.Second
+
+// Client fetches station data from a GBFS system. It supports the v2 discovery
+// layout (feeds keyed by language) and v3 (a single feed list).
+type Client struct {
+	discoveryURL string
+	language     string
+	httpClient   *http.Client
+}
+
+// NewClient creates a client for the system whose gbfs.json is at discoveryURL.
+func NewClient(discoveryURL string) *Client {
+	return &Client{
+		discoveryURL: discoveryURL,
+		language:     "en",
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+	}
+}
+
+// discovery is the gbfs.json document listing a system's feeds.
+type discovery struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// feedList is the list of feeds in a discovery document.
+type feedList struct {
+	Feeds []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"feeds"`
+}
+
+// stationInformation is the station_information feed (static station details).
+type stationInformation struct {
+	Data struct {
+		Stations []struct {
+			StationID string          `json:"station_id"`
+			Name      localizedString `json:"name"`
+			Lat       float64         `json:"lat"`
+			Lon       float64         `json:"lon"`
+			Capacity  int             `json:"capacity"`
+		} `json:"stations"`
+	} `json:"data"`
+}
+
+// stationStatus is the station_status feed (live availability).
+type stationStatus struct {
+	LastUpdated flexTime `json:"last_updated"`
+	Data        struct {
+		Stations []struct {
+			StationID             string   `json:"station_id"`
+			NumBikesAvailable     *int     `json:"num_bikes_available"`
+			NumVehiclesAvailable  *int     `json:"num_vehicles_available"`
+			NumEBikesAvailable    *int     `json:"num_ebikes_available"`
+			NumDocksAvailable     int      `json:"num_docks_available"`
+			IsInstalled           flexBool `json:"is_installed"`
+			IsRenting             flexBool `json:"is_renting"`
+			VehicleTypesAvailable []struct {
+				VehicleTypeID string `json:"vehicle_type_id"`
+				Count         int    `json:"count"`
+			} `json:"vehicle_types_available"`
+		} `json:"stations"`
+	} `json:"data"`
+}
+
+// vehicleTypes is the optional vehicle_types feed.
+type vehicleTypes struct {
+	Data struct {
+		VehicleTypes []struct {
+			VehicleTypeID  string `json:"vehicle_type_id"`
+			PropulsionType string `json:"propulsion_type"`
+		} `json:"vehicle_types"`
+	} `json:"data"`
+}
+
+// FetchStations retrieves the current station data from the GBFS feeds.
+func (c *Client) FetchStations(ctx context.Context) (_ *tfl.Stations, err error) {
+	ctx, span := telemetry.Start(ctx, "gbfs.FetchStations")
+	defer telemetry.End(span, &err)
+
+	feeds, err := c.feeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"station_information", "station_status"} {
+		if feeds[name] == "" {
+			return nil, fmt.Errorf("GBFS system does not publish %s", name)
+		}
+	}
+
+	var info stationInformation
+	if err := c.get(ctx, feeds["station_information"], &info); err != nil {
+		return nil, fmt.Errorf("failed to fetch station information: %w", err)
+	}
+	var status stationStatus
+	if err := c.get(ctx, feeds["station_status"], &status); err != nil {
+		return nil, fmt.Errorf("failed to fetch station status: %w", err)
+	}
+
+	// Vehicle types tell electric bikes apart where num_ebikes_available is absent
+	electric := make(map[string]bool)
+	if url := feeds["vehicle_types"]; url != "" {
+		var types vehicleTypes
+		if err := c.get(ctx, url, &types); err != nil {
+			return nil, fmt.Errorf("failed to fetch vehicle types: %w", err)
+		}
+		for _, vt := range types.Data.VehicleTypes {
+			electric[vt.VehicleTypeID] = vt.PropulsionType != "human"
+		}
+	}
+
+	type live struct {
+		bikes, ebikes, docks int
+		installed, renting   bool
+	}
+	statuses := make(map[string]live, len(status.Data.Stations))
+	for _, s := range status.Data.Stations {
+		l := live{
+			docks:     s.NumDocksAvailable,
+			installed: s.IsInstalled.value(true),
+			renting:   s.IsRenting.value(true),
+		}
+		switch {
+		case s.NumBikesAvailable != nil:
+			l.bikes = *s.NumBikesAvailable
+		case s.NumVehiclesAvailable != nil:
+			l.bikes = *s.NumVehiclesAvailable
+		}
+		if s.NumEBikesAvailable != nil {
+			l.ebikes = *s.NumEBikesAvailable
+		} else {
+			for _, vt := range s.VehicleTypesAvailable {
+				if electric[vt.VehicleTypeID] {
+					l.ebikes += vt.Count
+				}
+			}
+		}
+		statuses[s.StationID] = l
+	}
+
+	updated := status.LastUpdated.Time
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+	result := &tfl.Stations{
+		LastUpdate: updated.UnixMilli(),
+		Version:    "gbfs",
+		Stations:   make([]tfl.Station, 0, len(info.Data.Stations)),
+	}
+	for _, s := range info.Data.Stations {
+		l, ok := statuses[s.StationID]
+		if !ok {
+			// Stations without a status are not operating
+			continue
+		}
+		result.Stations = append(result.Stations, tfl.Station{
+			ID:              stationID(s.StationID),
+			Name:            s.Name.text(c.language),
+			TerminalName:    s.StationID,
+			Lat:             s.Lat,
+			Long:            s.Lon,
+			Installed:       l.installed,
+			Locked:          !l.renting,
+			NbBikes:         l.bikes,
+			NbStandardBikes: max(l.bikes-l.ebikes, 0),
+			NbEBikes:        l.ebikes,
+			NbEmptyDocks:    l.docks,
+			NbDocks:         s.Capacity,
+		})
+	}
+	span.SetAttributes(attribute.Int("stations", len(result.Stations)))
+
+	return result, nil
+}
+
+// feeds reads the discovery document and returns feed URLs by name.
+func (c *Client) feeds(ctx context.Context) (map[string]string, error) {
+	var doc discovery
+	if err := c.get(ctx, c.discoveryURL, &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch GBFS discovery: %w", err)
+	}
+
+	// v3 lists feeds directly under data
+	var list feedList
+	if err := json.Unmarshal(doc.Data, &list); err != nil || len(list.Feeds) == 0 {
+		// v2 keys feed lists by language; prefer ours, else take any
+		var byLanguage map[string]feedList
+		if err := json.Unmarshal(doc.Data, &byLanguage); err != nil {
+			return nil, fmt.Errorf("failed to parse GBFS discovery: %w", err)
+		}
+		list, ok := byLanguage[c.language]
+		if !ok {
+			for _, l := range byLanguage {
+				list = l
+				break
+			}
+		}
+		return feedURLs(list), nil
+	}
+	return feedURLs(list), nil
+}
+
+// feedURLs indexes a feed list by feed name.
+func feedURLs(list feedList) map[string]string {
+	urls := make(map[string]string, len(list.Feeds))
+	for _, f := range list.Feeds {
+		urls[f.Name] = f.URL
+	}
+	return urls
+}
+
+// get fetches url and decodes its JSON body into v.
+func (c *Client) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "city-cycling/1.0")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from %s: %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", url, err)
+	}
+	return nil
+}
+
+// stationID maps a GBFS station_id (an arbitrary string) to the integer IDs
+// used elsewhere: numeric IDs are kept, others are hashed.
+func stationID(id string) int {
+	if n, err := strconv.Atoi(id); err == nil && n >= 0 {
+		return n
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() & 0x7fffffff)
+}
+
+// localizedString is a GBFS text field: a plain string before v3, a list of
+// translations from v3.
+type localizedString struct {
+	plain        string
+	translations []struct {
+		Text     string `json:"text"`
+		Language string `json:"language"`
+	}
+}
+
+func (s *localizedString) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.plain); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &s.translations)
+}
+
+// text returns the translation for language, falling back to the first one.
+func (s localizedString) text(language string) string {
+	if s.plain != "" || len(s.translations) == 0 {
+		return s.plain
+	}
+	for _, t := range s.translations {
+		if t.Language == language {
+			return t.Text
+		}
+	}
+	return s.translations[0].Text
+}
+
+// flexBool accepts both JSON booleans and the 0/1 integers used by GBFS v1.
+type flexBool struct {
+	set, v bool
+}
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*b = flexBool{set: true, v: true}
+	case "false", "0":
+		*b = flexBool{set: true, v: false}
+	case "null":
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// value returns the parsed value, or def when the field was absent.
+func (b flexBool) value(def bool) bool {
+	if !b.set {
+		return def
+	}
+	return b.v
+}
+
+// flexTime accepts POSIX timestamps (GBFS v2) and RFC 3339 strings (v3).
+type flexTime struct {
+	time.Time
+}
+
+func (t *flexTime) UnmarshalJSON(data []byte) error {
+	var secs int64
+	if err := json.Unmarshal(data, &secs); err == nil {
+		t.Time = time.Unix(secs, 0).UTC()
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed.UTC()
+	return nil
+}
@@ -0,0 +1,272 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"city-cycling/internal/tfl"
+)
+
+// DefaultAreaProperty is the GeoJSON feature property naming an area.
+const DefaultAreaProperty = "name"
+
+// ring is a closed polygon boundary as [lng, lat] pairs, as GeoJSON orders them.
+type ring [][2]float64
+
+// polygon is an outer ring followed by any holes.
+type polygon []ring
+
+// Area is a named region such as a borough or neighbourhood.
+type Area struct {
+	Name string
+	// South, West, North and East bound every polygon of the area.
+	South, West, North, East float64
+	// SquareKm is the area's land area, holes excluded.
+	SquareKm float64
+
+	polygons []polygon
+}
+
+// Contains reports whether a point lies inside the area.
+func (a *Area) Contains(lat, lng float64) bool {
+	if lat < a.South || lat > a.North || lng < a.West || lng > a.East {
+		return false
+	}
+	for _, p := range a.polygons {
+		if p.contains(lat, lng) {
+			return true
+		}
+	}
+	return false
+}
+
+// Areas is a set of areas, e.g. a city's boroughs, that stations are grouped by.
+type Areas struct {
+	areas []*Area
+
+	// located caches Locate by point: stations rarely move, and testing a
+	// point against detailed boundaries costs far more than a lookup.
+	located sync.Map
+}
+
+// featureCollection is the subset of GeoJSON read by ParseAreas.
+type featureCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Properties map[string]any `json:"properties"`
+		Geometry   *struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+// LoadAreas reads a GeoJSON file of areas; see ParseAreas.
+func LoadAreas(path, nameProperty string) (*Areas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read areas: %w", err)
+	}
+	areas, err := ParseAreas(data, nameProperty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse areas %s: %w", path, err)
+	}
+	return areas, nil
+}
+
+// ParseAreas parses a GeoJSON FeatureCollection of Polygon and MultiPolygon
+// features, each named by its nameProperty property (DefaultAreaProperty when
+// empty). Features sharing a name form one area; other geometries are ignored.
+func ParseAreas(data []byte, nameProperty string) (*Areas, error) {
+	if nameProperty == "" {
+		nameProperty = DefaultAreaProperty
+	}
+	var fc featureCollection
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, err
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a FeatureCollection, got %q", fc.Type)
+	}
+
+	byName := make(map[string]*Area)
+	result := &Areas{}
+	for i, f := range fc.Features {
+		if f.Geometry == nil {
+			continue
+		}
+		var polygons []polygon
+		switch f.Geometry.Type {
+		case "Polygon":
+			var p polygon
+			if err := json.Unmarshal(f.Geometry.Coordinates, &p); err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i, err)
+			}
+			polygons = []polygon{p}
+		case "MultiPolygon":
+			if err := json.Unmarshal(f.Geometry.Coordinates, &polygons); err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i, err)
+			}
+		default:
+			continue
+		}
+
+		name, _ := f.Properties[nameProperty].(string)
+		if name == "" {
+			return nil, fmt.Errorf("feature %d has no %q property", i, nameProperty)
+		}
+		area, ok := byName[name]
+		if !ok {
+			area = &Area{Name: name, South: math.Inf(1), West: math.Inf(1), North: math.Inf(-1), East: math.Inf(-1)}
+			byName[name] = area
+			result.areas = append(result.areas, area)
+		}
+		for _, p := range polygons {
+			if len(p) == 0 {
+				continue
+			}
+			for _, pt := range p[0] {
+				area.West, area.East = min(area.West, pt[0]), max(area.East, pt[0])
+				area.South, area.North = min(area.South, pt[1]), max(area.North, pt[1])
+			}
+			area.SquareKm += p.squareKm()
+			area.polygons = append(area.polygons, p)
+		}
+	}
+	if len(result.areas) == 0 {
+		return nil, fmt.Errorf("no polygon features")
+	}
+	sort.Slice(result.areas, func(i, j int) bool { return result.areas[i].Name < result.areas[j].Name })
+	return result, nil
+}
+
+// List returns every area, ordered by name.
+func (a *Areas) List() []*Area {
+	return a.areas
+}
+
+// Area returns the area with the given name.
+func (a *Areas) Area(name string) (*Area, bool) {
+	i := sort.Search(len(a.areas), func(i int) bool { return a.areas[i].Name >= name })
+	if i < len(a.areas) && a.areas[i].Name == name {
+		return a.areas[i], true
+	}
+	return nil, false
+}
+
+// Locate returns the name of the area containing a point, or "" when it is in
+// none. Where areas overlap, the first by name wins.
+func (a *Areas) Locate(lat, lng float64) string {
+	point := [2]float64{lat, lng}
+	if name, ok := a.located.Load(point); ok {
+		return name.(string)
+	}
+	name := ""
+	for _, area := range a.areas {
+		if area.Contains(lat, lng) {
+			name = area.Name
+			break
+		}
+	}
+	a.located.Store(point, name)
+	return name
+}
+
+// AreaTotals aggregates the stations in one area.
+type AreaTotals struct {
+	Area       *Area
+	Stations   int
+	Bikes      int
+	EBikes     int
+	EmptyDocks int
+	Docks      int
+}
+
+// Occupancy returns the fraction of docks in the area holding a bike.
+func (t AreaTotals) Occupancy() float64 {
+	if t.Docks == 0 {
+		return 0
+	}
+	return float64(t.Bikes) / float64(t.Docks)
+}
+
+// Totals aggregates stations by area. Every area is included, in name order,
+// even without stations; stations outside every area are counted in the
+// returned unassigned total.
+func (a *Areas) Totals(stations []tfl.Station) (totals []AreaTotals, unassigned int) {
+	totals = make([]AreaTotals, len(a.areas))
+	index := make(map[string]int, len(a.areas))
+	for i, area := range a.areas {
+		totals[i].Area = area
+		index[area.Name] = i
+	}
+	for _, s := range stations {
+		name := a.Locate(s.Lat, s.Long)
+		if name == "" {
+			unassigned++
+			continue
+		}
+		t := &totals[index[name]]
+		t.Stations++
+		t.Bikes += s.NbBikes
+		t.EBikes += s.NbEBikes
+		t.EmptyDocks += s.NbEmptyDocks
+		t.Docks += s.NbDocks
+	}
+	return totals, unassigned
+}
+
+// contains reports whether a point is inside the outer ring and no hole.
+func (p polygon) contains(lat, lng float64) bool {
+	if !p[0].contains(lat, lng) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(lat, lng) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether a point is inside the ring, by counting the edges
+// a ray from it crosses.
+func (r ring) contains(lat, lng float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i][0], r[i][1]
+		xj, yj := r[j][0], r[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// squareKm returns the polygon's area less its holes, projecting onto a plane
+// at the outer ring's first latitude: accurate to well under 1% at city scale.
+func (p polygon) squareKm() float64 {
+	if len(p[0]) == 0 {
+		return 0
+	}
+	scale := math.Cos(p[0][0][1] * math.Pi / 180)
+	km := math.Abs(p[0].shoelace(scale))
+	for _, hole := range p[1:] {
+		km -= math.Abs(hole.shoelace(scale))
+	}
+	return km
+}
+
+// shoelace returns the ring's signed area in km², with longitudes scaled by scale.
+func (r ring) shoelace(scale float64) float64 {
+	const kmPerDegree = earthRadiusMeters / 1000 * math.Pi / 180
+	var sum float64
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		sum += (r[j][0]*scale)*r[i][1] - (r[i][0]*scale)*r[j][1]
+	}
+	return sum / 2 * kmPerDegree * kmPerDegree
+}
@@ -0,0 +1,127 @@
+package geo
+
+import (
+	"math"
+	"sort"
+
+	"city-cycling/internal/tfl"
+)
+
+// ClusterRadius is the distance, in screen pixels at the map zoom, within which
+// stations are merged into one marker. 60 px keeps markers from overlapping
+// with room for a count label.
+const ClusterRadius = 60
+
+// tileSize is the edge of a rendered map tile in pixels.
+const tileSize = 256
+
+// Cluster aggregates stations close enough together at a map zoom to be drawn
+// as one marker.
+type Cluster struct {
+	// Lat and Lng are the station-weighted centroid.
+	Lat, Lng float64
+	// South, West, North and East bound the cluster's stations, the area a
+	// map zooms to when the marker is clicked.
+	South, West, North, East float64
+	// StationID is the station of a cluster of one, and zero otherwise.
+	StationID  int
+	Stations   int
+	Bikes      int
+	EBikes     int
+	EmptyDocks int
+	Docks      int
+}
+
+// Occupancy returns the fraction of docks in the cluster holding a bike.
+func (c Cluster) Occupancy() float64 {
+	if c.Docks == 0 {
+		return 0
+	}
+	return float64(c.Bikes) / float64(c.Docks)
+}
+
+// Contains reports whether the cluster's centroid is in the box with the
+// given edges.
+func (c Cluster) Contains(south, west, north, east float64) bool {
+	return c.Lat >= south && c.Lat <= north && c.Lng >= west && c.Lng <= east
+}
+
+// Clusters groups stations into markers for rendering at map zoom: taking
+// stations in ID order, each station not yet clustered starts a cluster with
+// every unclustered station within ClusterRadius pixels of it. The result
+// depends only on the stations and zoom, so markers do not move as the map
+// is panned, and is in the order clusters were started.
+func Clusters(stations []tfl.Station, zoom int) []Cluster {
+	zoom = clampInt(zoom, 0, MaxZoom)
+	sorted := make([]tfl.Station, len(stations))
+	copy(sorted, stations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	// Bucket stations by radius-sized squares of world pixels, so a station's
+	// neighbours are in its own square or the eight around it
+	type point struct{ x, y float64 }
+	type key struct{ x, y int }
+	points := make([]point, len(sorted))
+	buckets := make(map[key][]int)
+	for i, s := range sorted {
+		x, y := worldPixel(s.Lat, s.Long, zoom)
+		points[i] = point{x, y}
+		k := key{int(math.Floor(x / ClusterRadius)), int(math.Floor(y / ClusterRadius))}
+		buckets[k] = append(buckets[k], i)
+	}
+
+	clustered := make([]bool, len(sorted))
+	var clusters []Cluster
+	for i, s := range sorted {
+		if clustered[i] {
+			continue
+		}
+		c := Cluster{South: s.Lat, West: s.Long, North: s.Lat, East: s.Long}
+		p := points[i]
+		k := key{int(math.Floor(p.x / ClusterRadius)), int(math.Floor(p.y / ClusterRadius))}
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, j := range buckets[key{k.x + dx, k.y + dy}] {
+					q := points[j]
+					if clustered[j] || math.Hypot(q.x-p.x, q.y-p.y) > ClusterRadius {
+						continue
+					}
+					clustered[j] = true
+					c.add(sorted[j])
+				}
+			}
+		}
+		c.Lat /= float64(c.Stations)
+		c.Lng /= float64(c.Stations)
+		if c.Stations == 1 {
+			c.StationID = s.ID
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
+
+// add merges a station into the cluster's sums and bounds.
+func (c *Cluster) add(s tfl.Station) {
+	c.Lat += s.Lat
+	c.Lng += s.Long
+	c.South = math.Min(c.South, s.Lat)
+	c.West = math.Min(c.West, s.Long)
+	c.North = math.Max(c.North, s.Lat)
+	c.East = math.Max(c.East, s.Long)
+	c.Stations++
+	c.Bikes += s.NbBikes
+	c.EBikes += s.NbEBikes
+	c.EmptyDocks += s.NbEmptyDocks
+	c.Docks += s.NbDocks
+}
+
+// worldPixel returns the Web Mercator pixel coordinates of lat/lng on the
+// whole map rendered at zoom.
+func worldPixel(lat, lng float64, zoom int) (x, y float64) {
+	size := tileSize * math.Exp2(float64(zoom))
+	latRad := lat * math.Pi / 180
+	x = (lng + 180) / 360 * size
+	y = (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * size
+	return x, y
+}
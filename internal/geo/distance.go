@@ -0,0 +1,17 @@
+package geo
+
+import "math"
+
+// earthRadiusMeters is the mean Earth radius used for distance calculations.
+const earthRadiusMeters = 6371000
+
+// DistanceMeters returns the great-circle distance between two points.
+func DistanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,77 @@
+package geo
+
+import (
+	"sort"
+
+	"city-cycling/internal/tfl"
+)
+
+// gridSubdivision is how many grid cells span one map tile edge. Aggregating at
+// zoom+2 gives 4x4 cells per rendered tile, fine enough for a smooth density layer.
+const gridSubdivision = 2
+
+// Cell aggregates the stations falling in one grid cell.
+type Cell struct {
+	X, Y       int // tile coordinates at the grid zoom
+	Zoom       int // grid zoom (map zoom + gridSubdivision)
+	Lat, Lng   float64
+	Stations   int
+	Bikes      int
+	EBikes     int
+	EmptyDocks int
+	Docks      int
+}
+
+// Occupancy returns the fraction of docks in the cell holding a bike.
+func (c Cell) Occupancy() float64 {
+	if c.Docks == 0 {
+		return 0
+	}
+	return float64(c.Bikes) / float64(c.Docks)
+}
+
+// Bounds returns the south, west, north and east edges of the cell.
+func (c Cell) Bounds() (south, west, north, east float64) {
+	return TileBounds(c.X, c.Y, c.Zoom)
+}
+
+// GridCells aggregates stations into grid cells suitable for rendering at map zoom.
+// Cell positions are the station-weighted centroid of the stations they contain.
+func GridCells(stations []tfl.Station, zoom int) []Cell {
+	gridZoom := zoom + gridSubdivision
+	if gridZoom > MaxZoom {
+		gridZoom = MaxZoom
+	}
+
+	type key struct{ x, y int }
+	cells := make(map[key]*Cell)
+	for _, s := range stations {
+		x, y := TileXY(s.Lat, s.Long, gridZoom)
+		c, ok := cells[key{x, y}]
+		if !ok {
+			c = &Cell{X: x, Y: y, Zoom: gridZoom}
+			cells[key{x, y}] = c
+		}
+		c.Lat += s.Lat
+		c.Lng += s.Long
+		c.Stations++
+		c.Bikes += s.NbBikes
+		c.EBikes += s.NbEBikes
+		c.EmptyDocks += s.NbEmptyDocks
+		c.Docks += s.NbDocks
+	}
+
+	result := make([]Cell, 0, len(cells))
+	for _, c := range cells {
+		c.Lat /= float64(c.Stations)
+		c.Lng /= float64(c.Stations)
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Y != result[j].Y {
+			return result[i].Y < result[j].Y
+		}
+		return result[i].X < result[j].X
+	})
+	return result
+}
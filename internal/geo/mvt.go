@@ -0,0 +1,185 @@
+package geo
+
+import (
+	"encoding/binary"
+	"math"
+
+	"city-cycling/internal/tfl"
+)
+
+// Vector tile parameters: the extent is the tile's coordinate resolution, and
+// the buffer how far past its edges points are included, so that symbols
+// straddling an edge are drawn whole by both tiles.
+const (
+	TileExtent = 4096
+	tileBuffer = 64
+)
+
+// StationLayer is the name of the vector tile layer holding stations.
+const StationLayer = "stations"
+
+// Mapbox Vector Tile protobuf field numbers and values
+// (https://github.com/mapbox/vector-tile-spec/tree/master/2.1).
+const (
+	mvtTileLayers = 3
+
+	mvtLayerName     = 1
+	mvtLayerFeatures = 2
+	mvtLayerKeys     = 3
+	mvtLayerValues   = 4
+	mvtLayerExtent   = 5
+	mvtLayerVersion  = 15
+
+	mvtFeatureID       = 1
+	mvtFeatureTags     = 2
+	mvtFeatureType     = 3
+	mvtFeatureGeometry = 4
+
+	mvtValueString = 1
+	mvtValueDouble = 3
+	mvtValueUint   = 5
+
+	mvtPoint  = 1
+	mvtMoveTo = 1
+)
+
+// StationTile encodes the stations in tile x, y at zoom as a Mapbox Vector
+// Tile with one point layer, StationLayer, whose features are identified by
+// station ID and carry its name and availability: bikes, standardBikes,
+// ebikes, emptyDocks, docks and occupancy. A tile with no stations encodes to
+// no bytes.
+func StationTile(stations []tfl.Station, zoom, x, y int) []byte {
+	enc := newLayerEncoder()
+	for _, s := range stations {
+		wx, wy := worldPixel(s.Lat, s.Long, zoom)
+		px := int64(math.Round((wx/tileSize - float64(x)) * TileExtent))
+		py := int64(math.Round((wy/tileSize - float64(y)) * TileExtent))
+		if px < -tileBuffer || px > TileExtent+tileBuffer || py < -tileBuffer || py > TileExtent+tileBuffer {
+			continue
+		}
+		occupancy := 0.0
+		if s.NbDocks > 0 {
+			occupancy = float64(s.NbBikes) / float64(s.NbDocks)
+		}
+		enc.point(uint64(s.ID), px, py, []mvtProperty{
+			{"name", s.Name},
+			{"bikes", uint64(max(s.NbBikes, 0))},
+			{"standardBikes", uint64(max(s.NbStandardBikes, 0))},
+			{"ebikes", uint64(max(s.NbEBikes, 0))},
+			{"emptyDocks", uint64(max(s.NbEmptyDocks, 0))},
+			{"docks", uint64(max(s.NbDocks, 0))},
+			{"occupancy", occupancy},
+		})
+	}
+	if len(enc.features) == 0 {
+		return nil
+	}
+
+	layer := appendString(nil, mvtLayerName, StationLayer)
+	for _, f := range enc.features {
+		layer = appendBytes(layer, mvtLayerFeatures, f)
+	}
+	for _, k := range enc.keys {
+		layer = appendString(layer, mvtLayerKeys, k)
+	}
+	for _, v := range enc.values {
+		layer = appendBytes(layer, mvtLayerValues, v)
+	}
+	layer = appendVarintField(layer, mvtLayerExtent, TileExtent)
+	layer = appendVarintField(layer, mvtLayerVersion, 2)
+	return appendBytes(nil, mvtTileLayers, layer)
+}
+
+// mvtProperty is a feature attribute: a string, uint64 or float64.
+type mvtProperty struct {
+	key   string
+	value any
+}
+
+// layerEncoder accumulates a layer's features with their keys and values,
+// which features reference by index.
+type layerEncoder struct {
+	features [][]byte
+	keys     []string
+	values   [][]byte
+	keyIndex map[string]uint64
+	valIndex map[string]uint64
+}
+
+func newLayerEncoder() *layerEncoder {
+	return &layerEncoder{keyIndex: make(map[string]uint64), valIndex: make(map[string]uint64)}
+}
+
+// point adds a point feature at tile coordinates px, py.
+func (e *layerEncoder) point(id uint64, px, py int64, props []mvtProperty) {
+	var tags []byte
+	for _, p := range props {
+		tags = binary.AppendUvarint(tags, e.key(p.key))
+		tags = binary.AppendUvarint(tags, e.value(p.value))
+	}
+	var geometry []byte
+	geometry = binary.AppendUvarint(geometry, mvtMoveTo|1<<3)
+	geometry = binary.AppendUvarint(geometry, zigzag(px))
+	geometry = binary.AppendUvarint(geometry, zigzag(py))
+
+	f := appendVarintField(nil, mvtFeatureID, id)
+	f = appendBytes(f, mvtFeatureTags, tags)
+	f = appendVarintField(f, mvtFeatureType, mvtPoint)
+	f = appendBytes(f, mvtFeatureGeometry, geometry)
+	e.features = append(e.features, f)
+}
+
+// key returns the index of key in the layer's keys, adding it if new.
+func (e *layerEncoder) key(key string) uint64 {
+	i, ok := e.keyIndex[key]
+	if !ok {
+		i = uint64(len(e.keys))
+		e.keyIndex[key] = i
+		e.keys = append(e.keys, key)
+	}
+	return i
+}
+
+// value returns the index of v in the layer's values, adding it if new.
+func (e *layerEncoder) value(v any) uint64 {
+	var encoded []byte
+	switch v := v.(type) {
+	case string:
+		encoded = appendString(nil, mvtValueString, v)
+	case uint64:
+		encoded = appendVarintField(nil, mvtValueUint, v)
+	case float64:
+		encoded = binary.AppendUvarint(nil, mvtValueDouble<<3|1)
+		encoded = binary.LittleEndian.AppendUint64(encoded, math.Float64bits(v))
+	}
+	i, ok := e.valIndex[string(encoded)]
+	if !ok {
+		i = uint64(len(e.values))
+		e.valIndex[string(encoded)] = i
+		e.values = append(e.values, encoded)
+	}
+	return i
+}
+
+// appendVarintField appends a varint protobuf field.
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytes appends a length-delimited protobuf field.
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendString appends a string protobuf field.
+func appendString(b []byte, field int, s string) []byte {
+	return appendBytes(b, field, []byte(s))
+}
+
+// zigzag encodes a signed geometry parameter.
+func zigzag(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
@@ -0,0 +1,44 @@
+// Package geo provides spatial helpers for working with station locations.
+package geo
+
+import "math"
+
+// MaxZoom is the highest zoom level accepted by the tile helpers.
+const MaxZoom = 22
+
+// TileXY returns the Web Mercator tile containing lat/lng at zoom.
+func TileXY(lat, lng float64, zoom int) (x, y int) {
+	n := math.Exp2(float64(zoom))
+	latRad := lat * math.Pi / 180
+
+	x = int(math.Floor((lng + 180) / 360 * n))
+	y = int(math.Floor((1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n))
+
+	max := int(n) - 1
+	return clampInt(x, 0, max), clampInt(y, 0, max)
+}
+
+// TileBounds returns the south, west, north and east edges of a tile in degrees.
+func TileBounds(x, y, zoom int) (south, west, north, east float64) {
+	n := math.Exp2(float64(zoom))
+	west = float64(x)/n*360 - 180
+	east = float64(x+1)/n*360 - 180
+	north = tileLat(y, n)
+	south = tileLat(y+1, n)
+	return south, west, north, east
+}
+
+// tileLat returns the latitude of the top edge of tile row y.
+func tileLat(y int, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,63 @@
+// Package logging configures the process-wide structured logger.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options holds logger settings registered as command-line flags.
+type Options struct {
+	Level  string
+	Format string
+}
+
+// AddFlags registers -log-level and -log-format on the default flag set.
+// Defaults come from the LOG_LEVEL and LOG_FORMAT environment variables.
+func AddFlags() *Options {
+	o := &Options{}
+	flag.StringVar(&o.Level, "log-level", envOr("LOG_LEVEL", "info"), "Log level: debug, info, warn or error")
+	flag.StringVar(&o.Format, "log-format", envOr("LOG_FORMAT", "text"), "Log output format: text or json")
+	return o
+}
+
+// Apply installs a slog handler for the configured level and format as the default
+// logger. Output from the standard log package is routed through it as well.
+func (o *Options) Apply() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q", o.Level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(o.Format) {
+	case "text", "":
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return fmt.Errorf("invalid log format %q (use text or json)", o.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// MustApply calls Apply and exits on error.
+func (o *Options) MustApply() {
+	if err := o.Apply(); err != nil {
+		log.Fatalf("Logging configuration error: %v", err)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,398 @@
+// Package publish writes daily open-data extracts of the snapshots to a public
+// bucket: gzipped CSV and Parquet files under a stable key layout, with a data
+// dictionary and an index of the days published.
+package publish
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+
+	"city-cycling/internal/storage"
+)
+
+const (
+	// DictionaryKey is the key of the data dictionary describing the extracts.
+	DictionaryKey = "data-dictionary.json"
+	// IndexKey is the key of the index listing every day published.
+	IndexKey = "index.json"
+	// CatalogKey is where a copy of the index is kept alongside the snapshots,
+	// so the server can list the published days without reading the public bucket.
+	CatalogKey = "meta/published.json"
+	// DefaultLicense is the attribution TfL open data must be published with.
+	DefaultLicense = "Powered by TfL Open Data. Contains OS data © Crown copyright and database rights."
+)
+
+// columns are the columns of an extract, in order, with their description.
+var columns = []Column{
+	{Name: "timestamp", Type: "timestamp", Description: "Time the snapshot was taken, UTC (RFC 3339 in CSV, millisecond timestamp in Parquet)"},
+	{Name: "station_id", Type: "int32", Description: "Station ID assigned by the operator; stable across days"},
+	{Name: "station_name", Type: "string", Description: "Station name as reported in the feed at the time"},
+	{Name: "lat", Type: "double", Description: "Station latitude, WGS 84"},
+	{Name: "lng", Type: "double", Description: "Station longitude, WGS 84"},
+	{Name: "nb_bikes", Type: "int32", Description: "Bikes docked and available to rent"},
+	{Name: "nb_standard_bikes", Type: "int32", Description: "Of nb_bikes, the standard (non-electric) bikes"},
+	{Name: "nb_ebikes", Type: "int32", Description: "Of nb_bikes, the e-bikes"},
+	{Name: "nb_empty_docks", Type: "int32", Description: "Free docks a bike can be returned to"},
+	{Name: "nb_docks", Type: "int32", Description: "Total docks; may exceed nb_bikes + nb_empty_docks when docks are out of service"},
+}
+
+// Column describes one column of the extracts.
+type Column struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Dictionary is the data dictionary published at DictionaryKey.
+type Dictionary struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	City        string   `json:"city"`
+	TimeZone    string   `json:"timeZone"`
+	License     string   `json:"license"`
+	Layout      []string `json:"layout"`
+	Columns     []Column `json:"columns"`
+}
+
+// Day is one published day in the index. The sizes and SHA-256 checksums of
+// its files are missing from days published before they were recorded.
+type Day struct {
+	Date          string    `json:"date"`
+	CSV           string    `json:"csv"`
+	CSVBytes      int64     `json:"csvBytes,omitempty"`
+	CSVSHA256     string    `json:"csvSha256,omitempty"`
+	Parquet       string    `json:"parquet"`
+	ParquetBytes  int64     `json:"parquetBytes,omitempty"`
+	ParquetSHA256 string    `json:"parquetSha256,omitempty"`
+	Snapshots     int       `json:"snapshots"`
+	Stations      int       `json:"stations"`
+	Rows          int       `json:"rows"`
+	PublishedAt   time.Time `json:"publishedAt"`
+}
+
+// Index is the list of days published, at IndexKey, oldest first.
+type Index struct {
+	City       string `json:"city"`
+	Dictionary string `json:"dictionary"`
+	License    string `json:"license"`
+	// TimeZone is the zone days run midnight to midnight in.
+	TimeZone string `json:"timeZone,omitempty"`
+	// BaseURL is the public URL the keys are relative to, when known.
+	BaseURL string `json:"baseUrl,omitempty"`
+	Days    []Day  `json:"days"`
+}
+
+// row is one station reading in an extract.
+type row struct {
+	Timestamp       time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	StationID       int32     `parquet:"station_id"`
+	StationName     string    `parquet:"station_name,dict"`
+	Lat             float64   `parquet:"lat"`
+	Lng             float64   `parquet:"lng"`
+	NbBikes         int32     `parquet:"nb_bikes"`
+	NbStandardBikes int32     `parquet:"nb_standard_bikes"`
+	NbEBikes        int32     `parquet:"nb_ebikes"`
+	NbEmptyDocks    int32     `parquet:"nb_empty_docks"`
+	NbDocks         int32     `parquet:"nb_docks"`
+}
+
+// Publisher builds the extract of each local day in loc from snapshots and
+// writes it to target. Only the public station counts are published: nothing
+// about the collectors, storage keys or API users appears in an extract.
+type Publisher struct {
+	// License is the terms the extracts are published under, recorded in the
+	// index and the dictionary.
+	License string
+	// BaseURL is the public URL of the target, recorded in the index so
+	// readers of the catalog can fetch the files.
+	BaseURL string
+
+	snapshots storage.RangeDataStore
+	target    storage.ObjectStore
+	loc       *time.Location
+	city      string
+}
+
+// New creates a publisher of the snapshots of city, split into days in loc.
+func New(snapshots storage.RangeDataStore, target storage.ObjectStore, city string, loc *time.Location) *Publisher {
+	return &Publisher{License: DefaultLicense, snapshots: snapshots, target: target, loc: loc, city: city}
+}
+
+// DayKeys returns the keys of the CSV and Parquet extracts of the day of date,
+// e.g. daily/2026/02/05/stations_2026-02-05.csv.gz.
+func DayKeys(date string) (csvKey, parquetKey string) {
+	base := fmt.Sprintf("daily/%s/%s/%s/stations_%s", date[0:4], date[5:7], date[8:10], date)
+	return base + ".csv.gz", base + ".parquet"
+}
+
+// Publish writes the extract of the day starting at day (midnight in the
+// publisher's time zone) and records it in the index, replacing an earlier
+// extract of that day. A day without snapshots is not published; ok is false.
+func (p *Publisher) Publish(ctx context.Context, day time.Time) (_ Day, ok bool, err error) {
+	from := day
+	to := day.AddDate(0, 0, 1)
+	var rows []row
+	snapshots := 0
+	stations := make(map[int]bool)
+	err = p.snapshots.ForEachSnapshot(ctx, from, to, func(snap storage.Snapshot) error {
+		// The range is inclusive; midnight belongs to the next day
+		if !snap.Timestamp.Before(to) {
+			return nil
+		}
+		snapshots++
+		for _, s := range snap.Stations {
+			stations[s.ID] = true
+			rows = append(rows, row{
+				Timestamp:       snap.Timestamp.UTC(),
+				StationID:       int32(s.ID),
+				StationName:     s.Name,
+				Lat:             s.Lat,
+				Lng:             s.Long,
+				NbBikes:         int32(s.NbBikes),
+				NbStandardBikes: int32(s.NbStandardBikes),
+				NbEBikes:        int32(s.NbEBikes),
+				NbEmptyDocks:    int32(s.NbEmptyDocks),
+				NbDocks:         int32(s.NbDocks),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return Day{}, false, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+	if snapshots == 0 {
+		return Day{}, false, nil
+	}
+
+	date := day.Format("2006-01-02")
+	csvKey, parquetKey := DayKeys(date)
+	csvData, err := encodeCSV(rows)
+	if err != nil {
+		return Day{}, false, err
+	}
+	parquetData, err := encodeParquet(rows)
+	if err != nil {
+		return Day{}, false, err
+	}
+	if err := p.target.PutObject(ctx, csvKey, csvData, "application/gzip"); err != nil {
+		return Day{}, false, fmt.Errorf("failed to publish %s: %w", csvKey, err)
+	}
+	if err := p.target.PutObject(ctx, parquetKey, parquetData, "application/vnd.apache.parquet"); err != nil {
+		return Day{}, false, fmt.Errorf("failed to publish %s: %w", parquetKey, err)
+	}
+
+	published := Day{
+		Date:          date,
+		CSV:           csvKey,
+		CSVBytes:      int64(len(csvData)),
+		CSVSHA256:     checksum(csvData),
+		Parquet:       parquetKey,
+		ParquetBytes:  int64(len(parquetData)),
+		ParquetSHA256: checksum(parquetData),
+		Snapshots:     snapshots,
+		Stations:      len(stations),
+		Rows:          len(rows),
+		PublishedAt:   time.Now().UTC(),
+	}
+	if err := p.record(ctx, published); err != nil {
+		return Day{}, false, err
+	}
+	return published, true, nil
+}
+
+// PublishPending publishes every complete day up to now that follows the last
+// day in the index, starting at from when given, or with yesterday when
+// nothing has been published yet. It returns the days published.
+func (p *Publisher) PublishPending(ctx context.Context, now, from time.Time) ([]Day, error) {
+	n := now.In(p.loc)
+	today := time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, p.loc)
+	start := today.AddDate(0, 0, -1)
+	if !from.IsZero() {
+		f := from.In(p.loc)
+		start = time.Date(f.Year(), f.Month(), f.Day(), 0, 0, 0, 0, p.loc)
+	} else {
+		index, err := p.index(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(index.Days) > 0 {
+			last, err := time.ParseInLocation("2006-01-02", index.Days[len(index.Days)-1].Date, p.loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date in publication index: %w", err)
+			}
+			start = last.AddDate(0, 0, 1)
+		}
+	}
+
+	var published []Day
+	for day := start; day.Before(today); day = day.AddDate(0, 0, 1) {
+		d, ok, err := p.Publish(ctx, day)
+		if err != nil {
+			return published, fmt.Errorf("failed to publish %s: %w", day.Format("2006-01-02"), err)
+		}
+		if !ok {
+			slog.Debug("No snapshots to publish", "date", day.Format("2006-01-02"))
+			continue
+		}
+		slog.Info("Published daily extract", "date", d.Date, "snapshots", d.Snapshots, "rows", d.Rows)
+		published = append(published, d)
+	}
+	return published, nil
+}
+
+// index reads the publication index, empty if nothing has been published.
+func (p *Publisher) index(ctx context.Context) (Index, error) {
+	index := Index{City: p.city, Dictionary: DictionaryKey, License: p.License}
+	data, err := p.target.GetObject(ctx, IndexKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return index, nil
+	}
+	if err != nil {
+		return index, fmt.Errorf("failed to read publication index: %w", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, fmt.Errorf("failed to parse publication index: %w", err)
+	}
+	return index, nil
+}
+
+// LoadCatalog reads the copy of the publication index kept at CatalogKey in
+// the snapshot store. It returns an error wrapping storage.ErrNotFound when
+// nothing has been published from the store.
+func LoadCatalog(ctx context.Context, objects storage.ObjectStore) (Index, error) {
+	var index Index
+	data, err := objects.GetObject(ctx, CatalogKey)
+	if err != nil {
+		return index, fmt.Errorf("failed to read publication index: %w", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, fmt.Errorf("failed to parse publication index: %w", err)
+	}
+	return index, nil
+}
+
+// record adds day to the index, replacing an earlier entry for its date, and
+// rewrites the data dictionary alongside so both describe the same layout.
+func (p *Publisher) record(ctx context.Context, day Day) error {
+	index, err := p.index(ctx)
+	if err != nil {
+		return err
+	}
+	days := index.Days[:0]
+	for _, d := range index.Days {
+		if d.Date != day.Date {
+			days = append(days, d)
+		}
+	}
+	index.Days = append(days, day)
+	sort.Slice(index.Days, func(i, j int) bool { return index.Days[i].Date < index.Days[j].Date })
+	index.License = p.License
+	index.TimeZone = p.loc.String()
+	if p.BaseURL != "" {
+		index.BaseURL = p.BaseURL
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode publication index: %w", err)
+	}
+	if err := p.target.PutObject(ctx, IndexKey, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to publish index: %w", err)
+	}
+	if objects, ok := p.snapshots.(storage.ObjectStore); ok {
+		if err := objects.PutObject(ctx, CatalogKey, data, "application/json"); err != nil {
+			return fmt.Errorf("failed to record publication index: %w", err)
+		}
+	}
+
+	data, err = json.MarshalIndent(p.dictionary(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode data dictionary: %w", err)
+	}
+	if err := p.target.PutObject(ctx, DictionaryKey, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to publish data dictionary: %w", err)
+	}
+	return nil
+}
+
+// dictionary returns the data dictionary of the publisher's extracts.
+func (p *Publisher) dictionary() Dictionary {
+	csvKey, parquetKey := DayKeys("YYYY-MM-DD")
+	return Dictionary{
+		Title:       "Cycle hire station availability: " + p.city,
+		Description: "Every snapshot of the docking station feed taken in one day, one row per station per snapshot. Days run midnight to midnight in timeZone.",
+		City:        p.city,
+		TimeZone:    p.loc.String(),
+		License:     p.License,
+		Layout:      []string{IndexKey, DictionaryKey, csvKey, parquetKey},
+		Columns:     columns,
+	}
+}
+
+// checksum returns the hex SHA-256 of data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeCSV returns rows as gzipped CSV with a header line.
+func encodeCSV(rows []row) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := csv.NewWriter(gz)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	w.Write(header)
+	itoa := func(v int32) string { return strconv.Itoa(int(v)) }
+	for _, r := range rows {
+		w.Write([]string{
+			r.Timestamp.Format(time.RFC3339),
+			itoa(r.StationID),
+			r.StationName,
+			strconv.FormatFloat(r.Lat, 'f', 6, 64),
+			strconv.FormatFloat(r.Lng, 'f', 6, 64),
+			itoa(r.NbBikes),
+			itoa(r.NbStandardBikes),
+			itoa(r.NbEBikes),
+			itoa(r.NbEmptyDocks),
+			itoa(r.NbDocks),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to encode CSV extract: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress CSV extract: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeParquet returns rows as a zstd-compressed Parquet file.
+func encodeParquet(rows []row) ([]byte, error) {
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[row](&buf, parquet.Compression(&zstd.Codec{}), parquet.CreatedBy("city-cycling", "", ""))
+	if _, err := w.Write(rows); err != nil {
+		return nil, fmt.Errorf("failed to encode Parquet extract: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode Parquet extract: %w", err)
+	}
+	return buf.Bytes(), nil
+}
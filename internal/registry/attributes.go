@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"city-cycling/internal/storage"
+)
+
+// AttributesKey is the object key under which station attributes are recorded.
+// They are kept apart from the registry, which the collector rewrites with
+// every snapshot, so that edits made through the admin API are never lost.
+const AttributesKey = "meta/attributes.json"
+
+const (
+	// MaxAttributeKeyLength and MaxAttributeValueLength bound one attribute.
+	MaxAttributeKeyLength   = 64
+	MaxAttributeValueLength = 1024
+	// MaxStationAttributes bounds how many attributes a station may have.
+	MaxStationAttributes = 50
+	// attributeRetries is how often a conditional write is retried after
+	// losing to a concurrent edit.
+	attributeRetries = 5
+)
+
+// ErrInvalidAttribute is returned (wrapped) when an attribute edit is rejected.
+var ErrInvalidAttribute = errors.New("invalid attribute")
+
+// attributesDocument is the persisted form of station attributes.
+type attributesDocument struct {
+	// Revision counts the edits, so that clients can tell the attributes changed.
+	Revision int64                     `json:"revision"`
+	Stations map[int]map[string]string `json:"stations"`
+}
+
+// Attributes holds free-form key-value attributes per station, such as
+// capacity notes, nearby transit or custom tags, that the feed does not carry.
+// It is safe for concurrent use.
+type Attributes struct {
+	objects storage.ObjectStore
+
+	mu  sync.RWMutex
+	doc attributesDocument
+}
+
+// NewAttributes creates an empty attribute store backed by objects. Call
+// Reload to read the attributes already recorded.
+func NewAttributes(objects storage.ObjectStore) *Attributes {
+	return &Attributes{
+		objects: objects,
+		doc:     attributesDocument{Stations: make(map[int]map[string]string)},
+	}
+}
+
+// Reload re-reads the attributes from the store, picking up edits made by
+// other processes. A store without recorded attributes yields none.
+func (a *Attributes) Reload(ctx context.Context) error {
+	doc, _, err := a.read(ctx)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.doc = doc
+	a.mu.Unlock()
+	return nil
+}
+
+// Station returns a copy of the attributes of a station, or nil if it has none.
+func (a *Attributes) Station(id int) map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return maps.Clone(a.doc.Stations[id])
+}
+
+// All returns a copy of every station's attributes, keyed by station ID.
+func (a *Attributes) All() map[int]map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	all := make(map[int]map[string]string, len(a.doc.Stations))
+	for id, attrs := range a.doc.Stations {
+		all[id] = maps.Clone(attrs)
+	}
+	return all
+}
+
+// Revision returns the number of edits made to the attributes.
+func (a *Attributes) Revision() int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.doc.Revision
+}
+
+// Set edits the attributes of a station and saves them, returning the
+// station's attributes afterwards. With replace, attrs replaces them all;
+// otherwise attrs is merged into them and an empty value removes its key.
+// Stores that support conditional writes are updated with compare-and-swap,
+// so concurrent edits from several servers are not lost.
+func (a *Attributes) Set(ctx context.Context, id int, attrs map[string]string, replace bool) (map[string]string, error) {
+	for k, v := range attrs {
+		if err := validateAttribute(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		doc, version, err := a.read(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		station := doc.Stations[id]
+		if replace || station == nil {
+			station = make(map[string]string, len(attrs))
+		}
+		for k, v := range attrs {
+			if v == "" {
+				delete(station, k)
+			} else {
+				station[k] = v
+			}
+		}
+		if len(station) > MaxStationAttributes {
+			return nil, fmt.Errorf("%w: station %d would have %d attributes (at most %d)", ErrInvalidAttribute, id, len(station), MaxStationAttributes)
+		}
+		if len(station) == 0 {
+			delete(doc.Stations, id)
+		} else {
+			doc.Stations[id] = station
+		}
+		doc.Revision++
+
+		err = a.write(ctx, doc, version)
+		if errors.Is(err, storage.ErrPreconditionFailed) && attempt < attributeRetries {
+			// Another server edited the attributes first; apply the edit to theirs
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		a.mu.Lock()
+		a.doc = doc
+		a.mu.Unlock()
+		return maps.Clone(station), nil
+	}
+}
+
+// read returns the recorded attributes and, for conditional stores, their version.
+func (a *Attributes) read(ctx context.Context) (attributesDocument, string, error) {
+	doc := attributesDocument{Stations: make(map[int]map[string]string)}
+
+	var data []byte
+	var version string
+	var err error
+	if cond, ok := a.objects.(storage.ConditionalObjectStore); ok {
+		data, version, err = cond.GetObjectVersion(ctx, AttributesKey)
+	} else {
+		data, err = a.objects.GetObject(ctx, AttributesKey)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return doc, "", nil
+	}
+	if err != nil {
+		return doc, "", fmt.Errorf("failed to load station attributes: %w", err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return doc, "", fmt.Errorf("failed to parse station attributes: %w", err)
+	}
+	if doc.Stations == nil {
+		doc.Stations = make(map[int]map[string]string)
+	}
+	return doc, version, nil
+}
+
+// write saves doc, conditionally on version for stores that support it.
+func (a *Attributes) write(ctx context.Context, doc attributesDocument, version string) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode station attributes: %w", err)
+	}
+	if cond, ok := a.objects.(storage.ConditionalObjectStore); ok {
+		err = cond.PutObjectIf(ctx, AttributesKey, data, "application/json", version)
+	} else {
+		err = a.objects.PutObject(ctx, AttributesKey, data, "application/json")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save station attributes: %w", err)
+	}
+	return nil
+}
+
+// validateAttribute checks an attribute's key and value are acceptable.
+func validateAttribute(key, value string) error {
+	if key == "" || len(key) > MaxAttributeKeyLength {
+		return fmt.Errorf("%w: key must be 1 to %d characters", ErrInvalidAttribute, MaxAttributeKeyLength)
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return fmt.Errorf("%w: key %q may only contain letters, digits, '_', '-' and '.'", ErrInvalidAttribute, key)
+		}
+	}
+	if len(value) > MaxAttributeValueLength {
+		return fmt.Errorf("%w: value of %q is longer than %d bytes", ErrInvalidAttribute, key, MaxAttributeValueLength)
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+// Package registry maintains a canonical list of stations and how they change over time.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"city-cycling/internal/elevation"
+	"city-cycling/internal/geo"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Key is the object key under which the registry is recorded in the store.
+const Key = "meta/registry.json"
+
+// DefaultRelocationThreshold is how far a station's coordinates must move before
+// it counts as relocated rather than a correction of the reported position.
+const DefaultRelocationThreshold = 25.0 // meters
+
+// ChangeKind identifies what changed about a station.
+type ChangeKind string
+
+// Change kinds recorded by the registry.
+const (
+	ChangeRenamed      ChangeKind = "renamed"
+	ChangeRelocated    ChangeKind = "relocated"
+	ChangeDocksChanged ChangeKind = "docks_changed"
+)
+
+// Change is a single recorded change to a station's metadata.
+type Change struct {
+	StationID int        `json:"stationId"`
+	Time      time.Time  `json:"time"`
+	Kind      ChangeKind `json:"kind"`
+	PrevName  string     `json:"prevName,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	PrevLat   float64    `json:"prevLat,omitempty"`
+	PrevLong  float64    `json:"prevLong,omitempty"`
+	Lat       float64    `json:"lat,omitempty"`
+	Long      float64    `json:"long,omitempty"`
+	PrevDocks int        `json:"prevDocks,omitempty"`
+	Docks     int        `json:"docks,omitempty"`
+}
+
+// Period is a span of time during which a station was in some state.
+// A zero End means the period is ongoing.
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitempty"`
+}
+
+// Station is the canonical record for a station, keyed by its TFL ID.
+type Station struct {
+	ID           int       `json:"id"`
+	TerminalName string    `json:"terminalName,omitempty"`
+	Name         string    `json:"name"`
+	Lat          float64   `json:"lat"`
+	Long         float64   `json:"long"`
+	Docks        int       `json:"docks"`
+	Installed    bool      `json:"installed"`
+	Locked       bool      `json:"locked"`
+	Temporary    bool      `json:"temporary"`
+	InstallDate  time.Time `json:"installDate,omitempty"`
+	RemovalDate  time.Time `json:"removalDate,omitempty"`
+	FirstSeen    time.Time `json:"firstSeen"`
+	LastSeen     time.Time `json:"lastSeen"`
+	Changes      []Change  `json:"changes,omitempty"`
+	// LockedPeriods and TemporaryPeriods record when the feed flagged the station.
+	LockedPeriods    []Period `json:"lockedPeriods,omitempty"`
+	TemporaryPeriods []Period `json:"temporaryPeriods,omitempty"`
+	// Elevation is the station's ground height in meters above sea level,
+	// looked up once from Registry.Elevation and again after a relocation;
+	// nil until then.
+	Elevation *float64 `json:"elevation,omitempty"`
+}
+
+// Registry tracks every station ever seen in the feed. It is safe for concurrent use.
+type Registry struct {
+	RelocationThreshold float64
+	// Elevation, if set, looks up the elevation of stations that have none.
+	Elevation elevation.Source
+
+	mu       sync.Mutex
+	objects  storage.ObjectStore
+	lastSeen time.Time
+	stations map[int]*Station
+}
+
+// New creates an empty registry that is not persisted.
+func New() *Registry {
+	return &Registry{
+		RelocationThreshold: DefaultRelocationThreshold,
+		stations:            make(map[int]*Station),
+	}
+}
+
+// Load restores the registry recorded in objects. Updates are written back to objects.
+// A store without a recorded registry yields an empty one.
+func Load(ctx context.Context, objects storage.ObjectStore) (*Registry, error) {
+	r := New()
+	r.objects = objects
+
+	data, err := objects.GetObject(ctx, Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse registry: %w", err)
+	}
+	return r, nil
+}
+
+// Update records a snapshot of the feed taken at ts and saves the registry if it is
+// backed by a store. Snapshots at or before the last one recorded are ignored.
+// It returns the changes detected in this snapshot.
+func (r *Registry) Update(ctx context.Context, ts time.Time, stations []tfl.Station) ([]Change, error) {
+	r.mu.Lock()
+	if !ts.After(r.lastSeen) {
+		r.mu.Unlock()
+		return nil, nil
+	}
+	r.lastSeen = ts
+
+	var changes []Change
+	for _, s := range stations {
+		st, ok := r.stations[s.ID]
+		if !ok {
+			st = &Station{
+				ID:        s.ID,
+				Name:      s.Name,
+				Lat:       s.Lat,
+				Long:      s.Long,
+				Docks:     s.NbDocks,
+				FirstSeen: ts,
+			}
+			r.stations[s.ID] = st
+		}
+		changes = append(changes, r.apply(st, ts, s)...)
+	}
+	missing := r.missingElevations()
+	r.mu.Unlock()
+
+	// Looked up without holding the lock: it may be a network request
+	if len(missing) > 0 {
+		r.lookupElevations(ctx, missing)
+	}
+	return changes, r.save(ctx)
+}
+
+// missingElevations returns the stations to look up elevations for.
+// Callers must hold r.mu.
+func (r *Registry) missingElevations() []elevation.Point {
+	if r.Elevation == nil {
+		return nil
+	}
+	var points []elevation.Point
+	for _, st := range r.stations {
+		if st.Elevation == nil {
+			points = append(points, elevation.Point{StationID: st.ID, Lat: st.Lat, Lng: st.Long})
+		}
+	}
+	return points
+}
+
+// lookupElevations records the elevations of points found by r.Elevation.
+// Failures are logged, and the stations tried again with the next snapshot.
+func (r *Registry) lookupElevations(ctx context.Context, points []elevation.Point) {
+	found, err := r.Elevation.Lookup(ctx, points)
+	if err != nil {
+		slog.Warn("Failed to look up station elevations", "stations", len(points), "found", len(found), "error", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, e := range found {
+		if st, ok := r.stations[id]; ok {
+			st.Elevation = &e
+		}
+	}
+	if len(found) > 0 {
+		slog.Info("Recorded station elevations", "stations", len(found))
+	}
+}
+
+// save writes the registry to its store, if it is backed by one.
+func (r *Registry) save(ctx context.Context) error {
+	if r.objects == nil {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.Marshal(r)
+	r.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to encode registry: %w", err)
+	}
+	if err := r.objects.PutObject(ctx, Key, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+	return nil
+}
+
+// Record updates the registry from a snapshot just written by the collector.
+// Its signature matches collector.Collector.OnWrite; errors are logged.
+func (r *Registry) Record(key string, stations *tfl.Stations) {
+	changes, err := r.Update(context.Background(), time.Now().UTC(), stations.Stations)
+	if err != nil {
+		slog.Error("Failed to update station registry", "key", key, "error", err)
+		return
+	}
+	for _, c := range changes {
+		slog.Info("Station metadata changed", "station", c.StationID, "kind", c.Kind, "time", c.Time.Format(time.RFC3339))
+	}
+}
+
+// apply updates st from a feed reading at ts and returns any changes recorded.
+func (r *Registry) apply(st *Station, ts time.Time, s tfl.Station) []Change {
+	var changes []Change
+
+	if s.Name != st.Name {
+		changes = append(changes, Change{StationID: st.ID, Time: ts, Kind: ChangeRenamed, PrevName: st.Name, Name: s.Name})
+		st.Name = s.Name
+	}
+	if geo.DistanceMeters(st.Lat, st.Long, s.Lat, s.Long) > r.RelocationThreshold {
+		changes = append(changes, Change{
+			StationID: st.ID, Time: ts, Kind: ChangeRelocated,
+			PrevLat: st.Lat, PrevLong: st.Long,
+			Lat: s.Lat, Long: s.Long,
+		})
+		st.Lat, st.Long = s.Lat, s.Long
+		// The old elevation was of the old site
+		st.Elevation = nil
+	}
+	// A zero dock count is a feed glitch rather than a station with no docks
+	if s.NbDocks != st.Docks && s.NbDocks > 0 {
+		changes = append(changes, Change{StationID: st.ID, Time: ts, Kind: ChangeDocksChanged, PrevDocks: st.Docks, Docks: s.NbDocks})
+		st.Docks = s.NbDocks
+	}
+
+	if s.Locked != st.Locked {
+		st.LockedPeriods = togglePeriod(st.LockedPeriods, s.Locked, ts)
+		st.Locked = s.Locked
+	}
+	if s.Temporary != st.Temporary {
+		st.TemporaryPeriods = togglePeriod(st.TemporaryPeriods, s.Temporary, ts)
+		st.Temporary = s.Temporary
+	}
+
+	if s.TerminalName != "" {
+		st.TerminalName = s.TerminalName
+	}
+	if s.InstallDate > 0 {
+		st.InstallDate = time.UnixMilli(s.InstallDate).UTC()
+	}
+	// The feed reports removal dates as epoch milliseconds, or empty while in service
+	if ms, err := strconv.ParseInt(s.RemovalDate, 10, 64); err == nil && ms > 0 {
+		st.RemovalDate = time.UnixMilli(ms).UTC()
+	} else {
+		st.RemovalDate = time.Time{}
+	}
+	st.Installed = s.Installed
+	st.LastSeen = ts
+	st.Changes = append(st.Changes, changes...)
+	return changes
+}
+
+// togglePeriod opens a new period at ts when on, or closes the open one when off.
+func togglePeriod(periods []Period, on bool, ts time.Time) []Period {
+	if on {
+		return append(periods, Period{Start: ts})
+	}
+	if n := len(periods); n > 0 && periods[n-1].End.IsZero() {
+		periods[n-1].End = ts
+	}
+	return periods
+}
+
+// Station returns the record for a station.
+func (r *Registry) Station(id int) (Station, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.stations[id]
+	if !ok {
+		return Station{}, false
+	}
+	return copyStation(st), true
+}
+
+// Stations returns every station ever seen, ordered by ID.
+func (r *Registry) Stations() []Station {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]Station, 0, len(r.stations))
+	for _, st := range r.stations {
+		result = append(result, copyStation(st))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Elevations returns the elevation of every station that has one, keyed by ID.
+func (r *Registry) Elevations() map[int]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make(map[int]float64)
+	for id, st := range r.stations {
+		if st.Elevation != nil {
+			result[id] = *st.Elevation
+		}
+	}
+	return result
+}
+
+// LastSeen returns the timestamp of the most recent snapshot recorded.
+func (r *Registry) LastSeen() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSeen
+}
+
+// CapacityChangeKind classifies a change in how many docks a station offers.
+type CapacityChangeKind string
+
+// Capacity change kinds.
+const (
+	CapacityExpanded CapacityChangeKind = "expansion"
+	CapacityShrunk   CapacityChangeKind = "shrinkage"
+	// CapacityClosed is a period the feed flagged the station as locked.
+	CapacityClosed CapacityChangeKind = "closure"
+	// CapacityRemoved is a station that has dropped out of the feed.
+	CapacityRemoved CapacityChangeKind = "removal"
+)
+
+// CapacityChange is a change in a station's capacity. For closures, End is
+// when the station reopened, zero while it is still closed.
+type CapacityChange struct {
+	StationID    int
+	Name         string
+	TerminalName string
+	Kind         CapacityChangeKind
+	Time         time.Time
+	End          time.Time
+	PrevDocks    int
+	Docks        int
+}
+
+// CapacityChanges returns the dock count changes, closures and removals of
+// every station in [from, to], oldest first. A closure is included if any of
+// it falls in the range.
+func (r *Registry) CapacityChanges(from, to time.Time) []CapacityChange {
+	lastSeen := r.LastSeen()
+	var changes []CapacityChange
+	for _, st := range r.Stations() {
+		change := func(kind CapacityChangeKind, t time.Time) CapacityChange {
+			return CapacityChange{StationID: st.ID, Name: st.Name, TerminalName: st.TerminalName, Kind: kind, Time: t}
+		}
+		for _, c := range st.Changes {
+			if c.Kind != ChangeDocksChanged || c.Time.Before(from) || c.Time.After(to) {
+				continue
+			}
+			kind := CapacityExpanded
+			if c.Docks < c.PrevDocks {
+				kind = CapacityShrunk
+			}
+			cc := change(kind, c.Time)
+			cc.PrevDocks, cc.Docks = c.PrevDocks, c.Docks
+			changes = append(changes, cc)
+		}
+		for _, p := range st.LockedPeriods {
+			if p.Start.After(to) || (!p.End.IsZero() && p.End.Before(from)) {
+				continue
+			}
+			cc := change(CapacityClosed, p.Start)
+			cc.End = p.End
+			cc.PrevDocks, cc.Docks = st.Docks, st.Docks
+			changes = append(changes, cc)
+		}
+		// Gone from the latest snapshot the registry saw
+		if st.LastSeen.Before(lastSeen) && !st.LastSeen.Before(from) && !st.LastSeen.After(to) {
+			cc := change(CapacityRemoved, st.LastSeen)
+			cc.PrevDocks = st.Docks
+			changes = append(changes, cc)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time.Before(changes[j].Time) })
+	return changes
+}
+
+// copyStation returns a copy of st that does not share its history slices.
+func copyStation(st *Station) Station {
+	c := *st
+	c.Changes = append([]Change(nil), st.Changes...)
+	c.LockedPeriods = append([]Period(nil), st.LockedPeriods...)
+	c.TemporaryPeriods = append([]Period(nil), st.TemporaryPeriods...)
+	if st.Elevation != nil {
+		e := *st.Elevation
+		c.Elevation = &e
+	}
+	return c
+}
+
+// registryJSON is the persisted form of the registry.
+type registryJSON struct {
+	LastSeen time.Time `json:"lastSeen"`
+	Stations []Station `json:"stations"`
+}
+
+// MarshalJSON encodes the registry. Callers must hold r.mu or own r exclusively.
+func (r *Registry) MarshalJSON() ([]byte, error) {
+	state := registryJSON{LastSeen: r.lastSeen, Stations: make([]Station, 0, len(r.stations))}
+	for _, st := range r.stations {
+		state.Stations = append(state.Stations, *st)
+	}
+	sort.Slice(state.Stations, func(i, j int) bool { return state.Stations[i].ID < state.Stations[j].ID })
+	return json.Marshal(state)
+}
+
+// UnmarshalJSON restores a registry encoded by MarshalJSON.
+func (r *Registry) UnmarshalJSON(data []byte) error {
+	var state registryJSON
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	r.lastSeen = state.LastSeen
+	r.stations = make(map[int]*Station, len(state.Stations))
+	for i := range state.Stations {
+		st := state.Stations[i]
+		r.stations[st.ID] = &st
+	}
+	return nil
+}
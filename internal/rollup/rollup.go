@@ -0,0 +1,509 @@
+// Package rollup maintains hourly, daily and weekly aggregates of the snapshots,
+// per station and network-wide, so long histories can be served without
+// rescanning every snapshot.
+package rollup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Resolution is the width of a rollup bucket.
+type Resolution string
+
+// Supported resolutions. Weeks start on Monday; all buckets are aligned to
+// local time in the job's time zone.
+const (
+	Hour Resolution = "hour"
+	Day  Resolution = "day"
+	Week Resolution = "week"
+)
+
+// KeyPrefix is the object key prefix under which rollups are stored.
+const KeyPrefix = "meta/rollups/"
+
+// ParseResolution parses a resolution name.
+func ParseResolution(s string) (Resolution, error) {
+	switch r := Resolution(s); r {
+	case Hour, Day, Week:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown resolution %q (want hour, day or week)", s)
+}
+
+// Bucket aggregates the readings in one interval. It keeps sums rather than
+// averages so buckets can be merged into coarser ones.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	// Samples is the number of snapshots the bucket covers.
+	Samples       int   `json:"samples"`
+	SumBikes      int64 `json:"sumBikes"`
+	SumEBikes     int64 `json:"sumEBikes"`
+	SumEmptyDocks int64 `json:"sumEmptyDocks"`
+	// SumStations is the sum of station counts; only network buckets set it.
+	SumStations int64 `json:"sumStations,omitempty"`
+	MinBikes    int   `json:"minBikes"`
+	MaxBikes    int   `json:"maxBikes"`
+
+	// Availability counts, set on station buckets only: of AvailSamples
+	// snapshots, how many had at least one bike, at least one empty dock, and
+	// both. Buckets built before these were recorded have AvailSamples 0.
+	AvailSamples    int `json:"availSamples,omitempty"`
+	SamplesWithBike int `json:"samplesWithBike,omitempty"`
+	SamplesWithDock int `json:"samplesWithDock,omitempty"`
+	SamplesWithBoth int `json:"samplesWithBoth,omitempty"`
+}
+
+// add records one reading.
+func (b *Bucket) add(bikes, ebikes, emptyDocks, stations int) {
+	if b.Samples == 0 || bikes < b.MinBikes {
+		b.MinBikes = bikes
+	}
+	if b.Samples == 0 || bikes > b.MaxBikes {
+		b.MaxBikes = bikes
+	}
+	b.Samples++
+	b.SumBikes += int64(bikes)
+	b.SumEBikes += int64(ebikes)
+	b.SumEmptyDocks += int64(emptyDocks)
+	b.SumStations += int64(stations)
+}
+
+// addAvailability records whether a station could be rented from and returned
+// to in one reading.
+func (b *Bucket) addAvailability(bikes, emptyDocks int) {
+	b.AvailSamples++
+	if bikes > 0 {
+		b.SamplesWithBike++
+	}
+	if emptyDocks > 0 {
+		b.SamplesWithDock++
+	}
+	if bikes > 0 && emptyDocks > 0 {
+		b.SamplesWithBoth++
+	}
+}
+
+// Merge folds o into b.
+func (b *Bucket) Merge(o Bucket) {
+	if o.Samples == 0 {
+		return
+	}
+	if b.Samples == 0 || o.MinBikes < b.MinBikes {
+		b.MinBikes = o.MinBikes
+	}
+	if b.Samples == 0 || o.MaxBikes > b.MaxBikes {
+		b.MaxBikes = o.MaxBikes
+	}
+	b.Samples += o.Samples
+	b.SumBikes += o.SumBikes
+	b.SumEBikes += o.SumEBikes
+	b.SumEmptyDocks += o.SumEmptyDocks
+	b.SumStations += o.SumStations
+	b.AvailSamples += o.AvailSamples
+	b.SamplesWithBike += o.SamplesWithBike
+	b.SamplesWithDock += o.SamplesWithDock
+	b.SamplesWithBoth += o.SamplesWithBoth
+}
+
+// average returns sum divided by the sample count.
+func (b Bucket) average(sum int64) float64 {
+	if b.Samples == 0 {
+		return 0
+	}
+	return float64(sum) / float64(b.Samples)
+}
+
+// AvgBikes returns the average number of docked bikes.
+func (b Bucket) AvgBikes() float64 { return b.average(b.SumBikes) }
+
+// AvgEBikes returns the average number of docked e-bikes.
+func (b Bucket) AvgEBikes() float64 { return b.average(b.SumEBikes) }
+
+// AvgEmptyDocks returns the average number of empty docks.
+func (b Bucket) AvgEmptyDocks() float64 { return b.average(b.SumEmptyDocks) }
+
+// AvgStations returns the average number of stations in the feed.
+func (b Bucket) AvgStations() float64 { return b.average(b.SumStations) }
+
+// availability returns count as a fraction of the availability samples.
+func (b Bucket) availability(count int) float64 {
+	if b.AvailSamples == 0 {
+		return 0
+	}
+	return float64(count) / float64(b.AvailSamples)
+}
+
+// BikeAvailability returns the fraction of the time a station had a bike to rent.
+func (b Bucket) BikeAvailability() float64 { return b.availability(b.SamplesWithBike) }
+
+// DockAvailability returns the fraction of the time a station had a dock free.
+func (b Bucket) DockAvailability() float64 { return b.availability(b.SamplesWithDock) }
+
+// Availability returns the fraction of the time a station had both a bike and
+// a free dock, so it could be used either way.
+func (b Bucket) Availability() float64 { return b.availability(b.SamplesWithBoth) }
+
+// partition is one stored rollup object: the hours of a day, the days of a
+// month or the weeks starting in a year.
+type partition struct {
+	Resolution Resolution       `json:"resolution"`
+	Timezone   string           `json:"timezone"`
+	Network    []Bucket         `json:"network"`
+	Stations   map[int][]Bucket `json:"stations"`
+}
+
+// upsert replaces the bucket starting at b.Start, or inserts it in order.
+func upsert(buckets []Bucket, b Bucket) []Bucket {
+	i := sort.Search(len(buckets), func(i int) bool { return !buckets[i].Start.Before(b.Start) })
+	if i < len(buckets) && buckets[i].Start.Equal(b.Start) {
+		buckets[i] = b
+		return buckets
+	}
+	buckets = append(buckets, Bucket{})
+	copy(buckets[i+1:], buckets[i:])
+	buckets[i] = b
+	return buckets
+}
+
+// key returns the object key of the partition holding the bucket starting at
+// start (local time).
+func key(res Resolution, start time.Time) string {
+	switch res {
+	case Hour:
+		return KeyPrefix + "hour/" + start.Format("2006-01-02") + ".json"
+	case Day:
+		return KeyPrefix + "day/" + start.Format("2006-01") + ".json"
+	}
+	return KeyPrefix + "week/" + start.Format("2006") + ".json"
+}
+
+// bucketStart returns the start of the bucket containing t, in loc.
+func bucketStart(res Resolution, t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch res {
+	case Hour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+	// Weeks start on Monday
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+}
+
+// next returns the start of the bucket after the one starting at start.
+func next(res Resolution, start time.Time) time.Time {
+	switch res {
+	case Hour:
+		return bucketStart(Hour, start.Add(time.Hour), start.Location())
+	case Day:
+		return time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, start.Location())
+	}
+	return time.Date(start.Year(), start.Month(), start.Day()+7, 0, 0, 0, 0, start.Location())
+}
+
+// partitions caches partitions loaded during one update or read.
+type partitions struct {
+	objects storage.ObjectStore
+	loc     *time.Location
+	loaded  map[string]*partition
+	dirty   map[string]bool
+}
+
+func newPartitions(objects storage.ObjectStore, loc *time.Location) *partitions {
+	return &partitions{
+		objects: objects,
+		loc:     loc,
+		loaded:  make(map[string]*partition),
+		dirty:   make(map[string]bool),
+	}
+}
+
+// get returns the partition holding the bucket starting at start, loading it
+// from the store or starting an empty one.
+func (p *partitions) get(ctx context.Context, res Resolution, start time.Time) (*partition, error) {
+	k := key(res, start)
+	if part, ok := p.loaded[k]; ok {
+		return part, nil
+	}
+
+	part := &partition{Resolution: res, Timezone: p.loc.String(), Stations: make(map[int][]Bucket)}
+	data, err := p.objects.GetObject(ctx, k)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to load rollup %s: %w", k, err)
+	default:
+		if err := json.Unmarshal(data, part); err != nil {
+			return nil, fmt.Errorf("failed to parse rollup %s: %w", k, err)
+		}
+		if part.Stations == nil {
+			part.Stations = make(map[int][]Bucket)
+		}
+	}
+	p.loaded[k] = part
+	return part, nil
+}
+
+// put stores a network bucket and its station buckets.
+func (p *partitions) put(ctx context.Context, res Resolution, network Bucket, stations map[int]Bucket) error {
+	part, err := p.get(ctx, res, network.Start)
+	if err != nil {
+		return err
+	}
+	part.Network = upsert(part.Network, network)
+	for id, b := range stations {
+		part.Stations[id] = upsert(part.Stations[id], b)
+	}
+	p.dirty[key(res, network.Start)] = true
+	return nil
+}
+
+// merged returns the merge of every bucket of res in [from, to), network-wide
+// and per station, as one bucket starting at from.
+func (p *partitions) merged(ctx context.Context, res Resolution, from, to time.Time) (Bucket, map[int]Bucket, error) {
+	network := Bucket{Start: from}
+	stations := make(map[int]Bucket)
+	for start := from; start.Before(to); start = next(res, start) {
+		part, err := p.get(ctx, res, start)
+		if err != nil {
+			return Bucket{}, nil, err
+		}
+		if b, ok := find(part.Network, start); ok {
+			network.Merge(b)
+		}
+		for id, buckets := range part.Stations {
+			if b, ok := find(buckets, start); ok {
+				sb, seen := stations[id]
+				if !seen {
+					sb.Start = from
+				}
+				sb.Merge(b)
+				stations[id] = sb
+			}
+		}
+	}
+	return network, stations, nil
+}
+
+// find returns the bucket starting at start.
+func find(buckets []Bucket, start time.Time) (Bucket, bool) {
+	i := sort.Search(len(buckets), func(i int) bool { return !buckets[i].Start.Before(start) })
+	if i < len(buckets) && buckets[i].Start.Equal(start) {
+		return buckets[i], true
+	}
+	return Bucket{}, false
+}
+
+// save writes every modified partition.
+func (p *partitions) save(ctx context.Context) error {
+	keys := make([]string, 0, len(p.dirty))
+	for k := range p.dirty {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data, err := json.Marshal(p.loaded[k])
+		if err != nil {
+			return fmt.Errorf("failed to encode rollup %s: %w", k, err)
+		}
+		if err := p.objects.PutObject(ctx, k, data, "application/json"); err != nil {
+			return fmt.Errorf("failed to save rollup %s: %w", k, err)
+		}
+	}
+	p.dirty = make(map[string]bool)
+	return nil
+}
+
+// Job builds rollups from a store's snapshots and saves them alongside.
+type Job struct {
+	snapshots storage.RangeDataStore
+	objects   storage.ObjectStore
+	loc       *time.Location
+
+	mu sync.Mutex // serializes updates
+
+	hourMu   sync.Mutex
+	lastHour time.Time
+}
+
+// NewJob creates a rollup job reading snapshots from snapshots and storing the
+// rollups in objects, with buckets aligned to local time in loc.
+func NewJob(snapshots storage.RangeDataStore, objects storage.ObjectStore, loc *time.Location) *Job {
+	return &Job{snapshots: snapshots, objects: objects, loc: loc}
+}
+
+// Update recomputes every hour overlapping [from, to) from the snapshots, then
+// the days and weeks containing those hours.
+func (j *Job) Update(ctx context.Context, from, to time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	from = bucketStart(Hour, from, j.loc)
+	type hourBuckets struct {
+		network  Bucket
+		stations map[int]Bucket
+	}
+	hours := make(map[time.Time]*hourBuckets)
+	for h := from; h.Before(to); h = next(Hour, h) {
+		hours[h] = &hourBuckets{network: Bucket{Start: h}, stations: make(map[int]Bucket)}
+	}
+
+	err := j.snapshots.ForEachSnapshot(ctx, from, to, func(snap storage.Snapshot) error {
+		hb := hours[bucketStart(Hour, snap.Timestamp, j.loc)]
+		if hb == nil {
+			// At to itself, which belongs to the next hour
+			return nil
+		}
+		var bikes, ebikes, empty int
+		for _, s := range snap.Stations {
+			bikes += s.NbBikes
+			ebikes += s.NbEBikes
+			empty += s.NbEmptyDocks
+			sb := hb.stations[s.ID]
+			sb.Start = hb.network.Start
+			sb.add(s.NbBikes, s.NbEBikes, s.NbEmptyDocks, 0)
+			sb.addAvailability(s.NbBikes, s.NbEmptyDocks)
+			hb.stations[s.ID] = sb
+		}
+		hb.network.add(bikes, ebikes, empty, len(snap.Stations))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read snapshots: %w", err)
+	}
+
+	parts := newPartitions(j.objects, j.loc)
+	days := make(map[time.Time]bool)
+	for h, hb := range hours {
+		if err := parts.put(ctx, Hour, hb.network, hb.stations); err != nil {
+			return err
+		}
+		days[bucketStart(Day, h, j.loc)] = true
+	}
+
+	weeks := make(map[time.Time]bool)
+	for d := range days {
+		network, stations, err := parts.merged(ctx, Hour, d, next(Day, d))
+		if err != nil {
+			return err
+		}
+		if err := parts.put(ctx, Day, network, stations); err != nil {
+			return err
+		}
+		weeks[bucketStart(Week, d, j.loc)] = true
+	}
+
+	for w := range weeks {
+		network, stations, err := parts.merged(ctx, Day, w, next(Week, w))
+		if err != nil {
+			return err
+		}
+		if err := parts.put(ctx, Week, network, stations); err != nil {
+			return err
+		}
+	}
+
+	return parts.save(ctx)
+}
+
+// Record updates the rollups of the previous hour once a snapshot from a new
+// hour is written, in the background. The first snapshot after startup also
+// catches up the hour before it. Its signature matches Collector.OnWrite.
+func (j *Job) Record(key string, stations *tfl.Stations) {
+	ts, err := storage.SnapshotTime(key)
+	if err != nil {
+		ts = time.Now().UTC()
+	}
+	hour := bucketStart(Hour, ts, j.loc)
+
+	j.hourMu.Lock()
+	last := j.lastHour
+	if !hour.After(last) {
+		j.hourMu.Unlock()
+		return
+	}
+	j.lastHour = hour
+	j.hourMu.Unlock()
+
+	from := last
+	if from.IsZero() {
+		from = hour.Add(-time.Hour)
+	}
+	go func() {
+		if err := j.Update(context.Background(), from, hour); err != nil {
+			slog.Error("Failed to update rollups", "from", from, "to", hour, "error", err)
+			return
+		}
+		slog.Debug("Updated rollups", "from", from, "to", hour)
+	}()
+}
+
+// Read returns the buckets of res overlapping [from, to] in loc, network-wide
+// when stationID is 0 and for that station otherwise.
+func Read(ctx context.Context, objects storage.ObjectStore, res Resolution, loc *time.Location, stationID int, from, to time.Time) ([]Bucket, error) {
+	parts := newPartitions(objects, loc)
+	var buckets []Bucket
+	seen := make(map[string]bool)
+	for start := bucketStart(res, from, loc); !start.After(to); start = next(res, start) {
+		k := key(res, start)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		part, err := parts.get(ctx, res, start)
+		if err != nil {
+			return nil, err
+		}
+		list := part.Network
+		if stationID != 0 {
+			list = part.Stations[stationID]
+		}
+		for _, b := range list {
+			if b.Samples > 0 && !b.Start.Before(bucketStart(res, from, loc)) && !b.Start.After(to) {
+				buckets = append(buckets, b)
+			}
+		}
+	}
+	return buckets, nil
+}
+
+// ReadStations returns the station buckets of res overlapping [from, to] in
+// loc, by station.
+func ReadStations(ctx context.Context, objects storage.ObjectStore, res Resolution, loc *time.Location, from, to time.Time) (map[int][]Bucket, error) {
+	parts := newPartitions(objects, loc)
+	first := bucketStart(res, from, loc)
+	stations := make(map[int][]Bucket)
+	seen := make(map[string]bool)
+	for start := first; !start.After(to); start = next(res, start) {
+		k := key(res, start)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		part, err := parts.get(ctx, res, start)
+		if err != nil {
+			return nil, err
+		}
+		for id, list := range part.Stations {
+			for _, b := range list {
+				if b.Samples > 0 && !b.Start.Before(first) && !b.Start.After(to) {
+					stations[id] = append(stations[id], b)
+				}
+			}
+		}
+	}
+	return stations, nil
+}
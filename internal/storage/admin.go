@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"city-cycling/internal/tfl"
+)
+
+// snapshotNamePattern matches the file name of a snapshot, the last segment of
+// its key on every backend.
+var snapshotNamePattern = regexp.MustCompile(`^stations_\d{8}_\d{6}\.tsv$`)
+
+// ValidSnapshotName reports whether name is a snapshot file name such as
+// stations_20260205_145000.tsv, and so safe to turn into a key.
+func ValidSnapshotName(name string) bool {
+	return snapshotNamePattern.MatchString(name)
+}
+
+// SnapshotInspection is what re-reading a stored snapshot found.
+type SnapshotInspection struct {
+	Key  string
+	Size int64
+	// Checksum is the recorded SHA-256; empty for snapshots written before
+	// checksums were recorded.
+	Checksum string
+	// Verified is set when the content matched Checksum; VerifyError says why
+	// it did not.
+	Verified    bool
+	VerifyError string
+	// Source and Validation are the annotations the collector recorded.
+	Source     string
+	Validation string
+	Parse      ParseReport
+	Stations   []tfl.Station
+	// EncryptionKey is the ID of the key the snapshot is encrypted with, ""
+	// for a plain snapshot.
+	EncryptionKey string
+}
+
+// SnapshotManager is implemented by stores whose snapshots can be managed one
+// at a time by key, as the admin API does.
+type SnapshotManager interface {
+	// ListSnapshots returns every snapshot key, newest first by the time in
+	// the key rather than in the order the backend lists them.
+	ListSnapshots(ctx context.Context) ([]string, error)
+
+	// ListSnapshotsRange returns the keys of the snapshots taken in
+	// [from, to], ordered like ListSnapshots. A zero bound is open.
+	ListSnapshotsRange(ctx context.Context, from, to time.Time) ([]string, error)
+
+	// InspectSnapshot re-reads and re-parses a snapshot, reporting malformed
+	// rows and checksum mismatches instead of failing on them. It returns an
+	// error wrapping ErrNotFound if the snapshot does not exist.
+	InspectSnapshot(ctx context.Context, key string) (*SnapshotInspection, error)
+
+	// DeleteSnapshot deletes a snapshot.
+	DeleteSnapshot(ctx context.Context, key string) error
+
+	// SnapshotKey returns the key a snapshot taken at timestamp is written
+	// under. Snapshots written before the date hierarchy are still found
+	// under it by InspectSnapshot and DeleteSnapshot.
+	SnapshotKey(timestamp time.Time) string
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// inspectTSV parses snapshot content from r, decrypting it with keys and
+// checking it against expected if a checksum was recorded.
+func inspectTSV(r io.Reader, key string, expected *snapshotChecksum, keys *Keyring) (*SnapshotInspection, error) {
+	r, keyID, err := keys.reader(r)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	var size countingWriter
+	tee := io.TeeReader(r, io.MultiWriter(h, &size))
+	stations, _, report, err := decodeTSV(tee, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	inspection := &SnapshotInspection{Key: key, Size: size.n, Parse: report, Stations: stations, EncryptionKey: keyID}
+	if expected != nil {
+		inspection.Checksum = expected.SHA256
+		inspection.Source = expected.Source
+		if expected.Validation != nil {
+			inspection.Validation = expected.Validation.Summary()
+		}
+		if err := expected.verify(h, len(stations)); err != nil {
+			inspection.VerifyError = err.Error()
+		} else {
+			inspection.Verified = true
+		}
+	}
+	return inspection, nil
+}
+
+// ListSnapshots returns the paths of every local snapshot, newest first.
+func (s *TSVStorage) ListSnapshots(ctx context.Context) ([]string, error) {
+	return s.listTSVFiles()
+}
+
+// ListSnapshotsRange returns the paths of the local snapshots taken in
+// [from, to], newest first.
+func (s *TSVStorage) ListSnapshotsRange(ctx context.Context, from, to time.Time) ([]string, error) {
+	files, err := s.listTSVFiles()
+	if err != nil {
+		return nil, err
+	}
+	return keysInRange(files, from, to), nil
+}
+
+// SnapshotKey returns the path of the local snapshot taken at timestamp.
+func (s *TSVStorage) SnapshotKey(timestamp time.Time) string {
+	return filepath.Join(s.dataDir, fmt.Sprintf("stations_%s.tsv", timestamp.UTC().Format("20060102_150405")))
+}
+
+// InspectSnapshot re-reads the local snapshot at path key.
+func (s *TSVStorage) InspectSnapshot(ctx context.Context, key string) (*SnapshotInspection, error) {
+	file, err := os.Open(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, filepath.Base(key))
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	expected, err := readChecksumSidecar(key)
+	if err != nil {
+		return nil, err
+	}
+	return inspectTSV(file, key, expected, s.keys)
+}
+
+// DeleteSnapshot deletes the local snapshot at path key and its checksum sidecar.
+func (s *TSVStorage) DeleteSnapshot(ctx context.Context, key string) error {
+	if err := os.Remove(key); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, filepath.Base(key))
+		}
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if err := os.Remove(key + checksumSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete checksum: %w", err)
+	}
+	return nil
+}
+
+// InspectSnapshot downloads and re-parses an R2 snapshot. A dated key that
+// does not exist is retried under the flat layout.
+func (r *R2Storage) InspectSnapshot(ctx context.Context, key string) (*SnapshotInspection, error) {
+	result, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			if legacy, ok := legacyKeyOf(r.prefix, key); ok {
+				return r.InspectSnapshot(ctx, legacy)
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer result.Body.Close()
+
+	return inspectObject(result.Body, key, result.Metadata, r.keys)
+}
+
+// SnapshotKey returns the blob name used for a snapshot taken at timestamp, in
+// the date hierarchy.
+func (a *AzureBlobStorage) SnapshotKey(timestamp time.Time) string {
+	return datedSnapshotKey(a.prefix, timestamp)
+}
+
+// InspectSnapshot downloads and re-parses a snapshot blob. A dated name that
+// does not exist is retried under the flat layout.
+func (a *AzureBlobStorage) InspectSnapshot(ctx context.Context, key string) (*SnapshotInspection, error) {
+	result, err := a.client.DownloadStream(ctx, a.container, key, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			if legacy, ok := legacyKeyOf(a.prefix, key); ok {
+				return a.InspectSnapshot(ctx, legacy)
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	defer result.Body.Close()
+
+	return inspectObject(result.Body, key, azureMetadata(result.Metadata), a.keys)
+}
+
+// inspectObject parses a snapshot object with the given metadata.
+func inspectObject(r io.Reader, key string, metadata map[string]string, keys *Keyring) (*SnapshotInspection, error) {
+	var expected *snapshotChecksum
+	if c, ok := checksumFromMetadata(metadata); ok {
+		expected = &c
+	}
+	inspection, err := inspectTSV(r, key, expected, keys)
+	if err != nil {
+		return nil, err
+	}
+	inspection.Source = metadata[sourceMetadataKey]
+	inspection.Validation = metadata[validationMetadataKey]
+	return inspection, nil
+}
+
+var (
+	_ SnapshotManager = (*TSVStorage)(nil)
+	_ SnapshotManager = (*R2Storage)(nil)
+	_ SnapshotManager = (*AzureBlobStorage)(nil)
+)
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// quarantineDir is the data subdirectory partial or corrupt snapshots are moved to.
+const quarantineDir = "quarantine"
+
+// tmpSuffix marks files being written that have not yet been renamed into place.
+const tmpSuffix = ".tmp"
+
+// writeFileAtomic writes path by calling write on a temporary file in the same
+// directory, syncing it and renaming it into place, so readers and crashes never
+// leave a partial file at path.
+func writeFileAtomic(path string, write func(io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*"+tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// WriteFileAtomic writes data to path, creating its directory, without ever
+// leaving a partial file at path.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// QuarantinePartial moves leftover temporary files and truncated or unparseable
+// snapshots out of the data directory into its quarantine subdirectory, so they
+// are never served. It returns the names of the files moved.
+func (s *TSVStorage) QuarantinePartial() ([]string, error) {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	var moved []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "stations_") {
+			continue
+		}
+
+		var reason string
+		switch {
+		case strings.HasSuffix(name, tmpSuffix):
+			reason = "incomplete write"
+		case strings.HasSuffix(name, ".tsv"):
+			reason = s.snapshotProblem(filepath.Join(s.dataDir, name))
+		}
+		if reason == "" {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Join(s.dataDir, quarantineDir), 0755); err != nil {
+			return moved, fmt.Errorf("failed to create quarantine directory: %w", err)
+		}
+		if err := os.Rename(filepath.Join(s.dataDir, name), filepath.Join(s.dataDir, quarantineDir, name)); err != nil {
+			return moved, fmt.Errorf("failed to quarantine %s: %w", name, err)
+		}
+		slog.Warn("Quarantined partial snapshot", "file", name, "reason", reason)
+		moved = append(moved, name)
+	}
+	return moved, nil
+}
+
+// snapshotProblem returns why a local snapshot looks partial, or "" if it is complete.
+func (s *TSVStorage) snapshotProblem(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "unreadable"
+	}
+	if len(data) == 0 {
+		return "empty"
+	}
+	plaintext, _, err := s.keys.open(data)
+	if errors.Is(err, errUnknownKey) {
+		// Only a process holding the key can tell; leave it for that one
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+	data = plaintext
+	// Complete snapshots always end with a newline; a missing one means the write was cut off
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		return "truncated"
+	}
+
+	stations, _, report, err := decodeTSV(bytes.NewReader(data), 0)
+	if err != nil {
+		return err.Error()
+	}
+	releaseStations(stations)
+	if report.Rows == 0 {
+		return "no station rows"
+	}
+	return ""
+}
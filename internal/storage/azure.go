@@ -0,0 +1,505 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"go.opentelemetry.io/otel/attribute"
+
+	"city-cycling/internal/telemetry"
+	"city-cycling/internal/tfl"
+)
+
+// AzureBlobStorage handles reading and writing station data to an Azure Blob Storage container.
+// Snapshots use the same key layouts and metadata as R2Storage.
+type AzureBlobStorage struct {
+	client    *azblob.Client
+	container string
+	prefix    string
+	// root is prepended to object keys (see WithRoot)
+	root string
+	// legacy tracks whether flat-layout snapshot keys remain
+	legacy *legacyKeys
+	// keys encrypts snapshots at rest when set (see SetEncryption)
+	keys *Keyring
+}
+
+// NewAzureBlobStorage creates a new Azure Blob Storage instance.
+// If connectionString is set it is used to authenticate; otherwise accountURL
+// (https://<account>.blob.core.windows.net/) is accessed with the default Azure
+// credential chain, which includes managed identity.
+// prefix is optional and defaults to "snapshots/".
+func NewAzureBlobStorage(connectionString, accountURL, container, prefix string) (*AzureBlobStorage, error) {
+	if prefix == "" {
+		prefix = "snapshots/"
+	}
+
+	var client *azblob.Client
+	var err error
+	if connectionString != "" {
+		client, err = azblob.NewClientFromConnectionString(connectionString, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client from connection string: %w", err)
+		}
+	} else {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure credential: %w", err)
+		}
+		client, err = azblob.NewClient(accountURL, cred, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client: %w", err)
+		}
+	}
+
+	return &AzureBlobStorage{
+		client:    client,
+		container: container,
+		prefix:    prefix,
+		legacy:    &legacyKeys{},
+	}, nil
+}
+
+// WriteStations writes station data to the container as a timestamped TSV blob.
+func (a *AzureBlobStorage) WriteStations(ctx context.Context, stations *tfl.Stations) (string, error) {
+	return a.WriteStationsAt(ctx, time.Now(), stations)
+}
+
+// WriteStationsAt writes station data as the snapshot taken at timestamp,
+// replacing any snapshot taken in the same second. It records demoted and
+// imported data under the time they were taken.
+func (a *AzureBlobStorage) WriteStationsAt(ctx context.Context, timestamp time.Time, stations *tfl.Stations) (_ string, err error) {
+	ctx, span := telemetry.Start(ctx, "azure.WriteStations", attribute.Int("stations", len(stations.Stations)))
+	defer telemetry.End(span, &err)
+
+	start := time.Now()
+	defer func() {
+		slog.Info("Azure WriteStations completed", "duration", time.Since(start), "stations", len(stations.Stations))
+	}()
+
+	timestamp = timestamp.UTC()
+	key := a.SnapshotKey(timestamp)
+
+	// Build TSV content in memory
+	var buf bytes.Buffer
+	if err := encodeTSV(&buf, timestamp, stations.Stations); err != nil {
+		return "", err
+	}
+	checksum := checksumOf(buf.Bytes(), len(stations.Stations))
+
+	metadata := map[string]*string{
+		timestampMetadataKey: ptr(timestamp.Format(time.RFC3339)),
+		rowsMetadataKey:      ptr(fmt.Sprintf("%d", checksum.Rows)),
+		checksumMetadataKey:  ptr(checksum.SHA256),
+	}
+	for k, v := range annotationMetadata(stations.Source, stations.Validation) {
+		metadata[k] = ptr(v)
+	}
+
+	// The checksum covers the plaintext, so it is verified after decryption
+	body, err := a.keys.seal(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	_, err = a.client.UploadBuffer(ctx, a.container, key, body, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: ptr(a.keys.contentType())},
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to Azure: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListSnapshots returns all snapshot blobs in the container, in either key
+// layout, sorted by timestamp (newest first).
+func (a *AzureBlobStorage) ListSnapshots(ctx context.Context) (_ []string, err error) {
+	ctx, span := telemetry.Start(ctx, "azure.ListSnapshots")
+	defer telemetry.End(span, &err)
+
+	start := time.Now()
+	defer func() {
+		slog.Info("Azure ListSnapshots completed", "duration", time.Since(start))
+	}()
+
+	keys, err := a.listKeys(ctx, a.prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+	sortSnapshotKeys(keys)
+	return keys, nil
+}
+
+// ListSnapshotsRange returns the snapshots taken in [from, to], newest
+// first, listing only the days, months or years the range covers. Ranges too
+// long for that list everything.
+func (a *AzureBlobStorage) ListSnapshotsRange(ctx context.Context, from, to time.Time) (_ []string, err error) {
+	ctx, span := telemetry.Start(ctx, "azure.ListSnapshotsRange", rangeAttrs(from, to)...)
+	defer telemetry.End(span, &err)
+
+	prefixes, ok := rangePrefixes(a.prefix, from, to, a.legacy.check(ctx, a.probeLegacy))
+	if !ok {
+		keys, err := a.ListSnapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return keysInRange(keys, from, to), nil
+	}
+
+	var keys []string
+	for _, prefix := range prefixes {
+		listed, err := a.listKeys(ctx, prefix, 0)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, listed...)
+	}
+	keys = keysInRange(keys, from, to)
+	sortSnapshotKeys(keys)
+	return keys, nil
+}
+
+// listKeys returns the .tsv blobs under prefix, at most limit of them if limit > 0.
+func (a *AzureBlobStorage) listKeys(ctx context.Context, prefix string, limit int32) ([]string, error) {
+	options := &azblob.ListBlobsFlatOptions{Prefix: ptr(prefix)}
+	if limit > 0 {
+		options.MaxResults = ptr(limit)
+	}
+	pager := a.client.NewListBlobsFlatPager(a.container, options)
+
+	var keys []string
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil && strings.HasSuffix(*item.Name, ".tsv") {
+				keys = append(keys, *item.Name)
+			}
+		}
+		if limit > 0 && len(keys) >= int(limit) {
+			break
+		}
+	}
+	return keys, nil
+}
+
+// probeLegacy reports whether any flat-layout snapshot blobs remain.
+func (a *AzureBlobStorage) probeLegacy(ctx context.Context) (bool, error) {
+	keys, err := a.listKeys(ctx, a.prefix+"stations_", 1)
+	return len(keys) > 0, err
+}
+
+// ReadLatestStations reads the most recent snapshot from the container,
+// listing only the last two days when they hold one.
+func (a *AzureBlobStorage) ReadLatestStations(ctx context.Context) ([]tfl.Station, time.Time, error) {
+	start := time.Now()
+	defer func() {
+		slog.Info("Azure ReadLatestStations completed", "duration", time.Since(start))
+	}()
+
+	now := time.Now().UTC()
+	keys, err := a.ListSnapshotsRange(ctx, now.AddDate(0, 0, -1), now)
+	if err == nil && len(keys) == 0 {
+		keys, err = a.ListSnapshots(ctx)
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if len(keys) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no snapshots found in Azure container")
+	}
+
+	return a.GetSnapshot(ctx, keys[0])
+}
+
+// ListAvailableTimestamps returns all available snapshot timestamps, newest
+// first, taken from blob names.
+func (a *AzureBlobStorage) ListAvailableTimestamps(ctx context.Context) ([]time.Time, error) {
+	return a.ListTimestamps(ctx, TimestampQuery{})
+}
+
+// ListTimestamps returns the snapshot timestamps matching q, newest first,
+// listing only the days a bounded range covers. Blobs without a timestamp in
+// their name, which only an open-ended listing finds as they cannot be placed
+// in the date hierarchy, fall back to the timestamp in the blob's metadata.
+func (a *AzureBlobStorage) ListTimestamps(ctx context.Context, q TimestampQuery) ([]time.Time, error) {
+	var keys []string
+	var err error
+	if q.From.IsZero() || q.To.IsZero() {
+		keys, err = a.ListSnapshots(ctx)
+	} else {
+		keys, err = a.ListSnapshotsRange(ctx, q.From, q.To)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return timestampsOfKeys(ctx, keys, q, a.metadataTimestamp), nil
+}
+
+// metadataTimestamp reads the timestamp recorded in a blob's metadata.
+func (a *AzureBlobStorage) metadataTimestamp(ctx context.Context, key string) (time.Time, error) {
+	props, err := a.client.ServiceClient().NewContainerClient(a.container).NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get blob properties: %w", err)
+	}
+	return parseTimestampMetadata(key, azureMetadata(props.Metadata))
+}
+
+// GetSnapshot downloads and parses a specific snapshot from the container.
+func (a *AzureBlobStorage) GetSnapshot(ctx context.Context, key string) (_ []tfl.Station, _ time.Time, err error) {
+	ctx, span := telemetry.Start(ctx, "azure.GetSnapshot", attribute.String("key", key))
+	defer telemetry.End(span, &err)
+
+	start := time.Now()
+	defer func() {
+		slog.Debug("Azure GetSnapshot completed", "duration", time.Since(start), "key", key)
+	}()
+
+	stations, timestamp, _, err := a.readSnapshot(ctx, key)
+	return stations, timestamp, err
+}
+
+// readSnapshot downloads and parses a snapshot, verifying it against the checksum
+// in its metadata when one was recorded. It reports whether it was verified.
+func (a *AzureBlobStorage) readSnapshot(ctx context.Context, key string) ([]tfl.Station, time.Time, bool, error) {
+	result, err := a.client.DownloadStream(ctx, a.container, key, nil)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("failed to get blob: %w", err)
+	}
+	defer result.Body.Close()
+
+	var expected *snapshotChecksum
+	if c, ok := checksumFromMetadata(azureMetadata(result.Metadata)); ok {
+		expected = &c
+	}
+	body, _, err := a.keys.reader(result.Body)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return parseVerifiedTSV(body, key, expected)
+}
+
+// azureMetadata flattens blob metadata. Azure treats metadata names
+// case-insensitively and may return them capitalised, so names are lowercased.
+func azureMetadata(metadata map[string]*string) map[string]string {
+	result := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if v != nil {
+			result[strings.ToLower(k)] = *v
+		}
+	}
+	return result
+}
+
+// DeleteSnapshot deletes a specific snapshot from the container. A dated name
+// that does not exist is retried under the flat layout.
+func (a *AzureBlobStorage) DeleteSnapshot(ctx context.Context, key string) error {
+	_, err := a.client.DeleteBlob(ctx, a.container, key, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		if legacy, ok := legacyKeyOf(a.prefix, key); ok {
+			return a.DeleteSnapshot(ctx, legacy)
+		}
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// PutObject uploads an arbitrary object to the container.
+func (a *AzureBlobStorage) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := a.client.UploadBuffer(ctx, a.container, a.root+key, data, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: ptr(contentType)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// GetObject downloads an object from the container. It returns an error wrapping
+// ErrNotFound if the key does not exist.
+func (a *AzureBlobStorage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	result, err := a.client.DownloadStream(ctx, a.container, a.root+key, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer result.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(result.Body); err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ContainerExists checks if the container exists and is accessible.
+func (a *AzureBlobStorage) ContainerExists(ctx context.Context) (bool, error) {
+	_, err := a.client.ServiceClient().NewContainerClient(a.container).GetProperties(ctx, nil)
+	if err == nil {
+		return true, nil
+	}
+	if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to access container '%s': %w", a.container, err)
+}
+
+// GetHistoricalData returns aggregate statistics for all available snapshots.
+func (a *AzureBlobStorage) GetHistoricalData(ctx context.Context) (_ []HistoricalDataPoint, err error) {
+	ctx, span := telemetry.Start(ctx, "azure.GetHistoricalData")
+	defer telemetry.End(span, &err)
+
+	start := time.Now()
+	defer func() {
+		slog.Info("Azure GetHistoricalData completed", "duration", time.Since(start))
+	}()
+
+	keys, err := a.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var dataPoints []HistoricalDataPoint
+	for _, key := range keys {
+		stations, timestamp, err := a.GetSnapshot(ctx, key)
+		if err != nil {
+			slog.Error("Failed to read snapshot", "backend", "azure", "key", key, "error", err)
+			continue
+		}
+
+		dataPoints = append(dataPoints, aggregateSnapshot(timestamp, stations))
+		releaseStations(stations)
+	}
+
+	return dataPoints, nil
+}
+
+// GetSnapshotByTimestamp returns station data for the closest matching timestamp.
+func (a *AzureBlobStorage) GetSnapshotByTimestamp(ctx context.Context, targetTime time.Time) (_ []tfl.Station, err error) {
+	ctx, span := telemetry.Start(ctx, "azure.GetSnapshotByTimestamp", attribute.String("target", targetTime.Format(time.RFC3339)))
+	defer telemetry.End(span, &err)
+
+	keys, err := a.ListSnapshotsRange(ctx, targetTime.AddDate(0, 0, -1), targetTime.AddDate(0, 0, 1))
+	if err == nil && len(keys) == 0 {
+		keys, err = a.ListSnapshots(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no snapshots available")
+	}
+
+	// Parse timestamps from blob names instead of downloading each blob
+	var closestKey string
+	closestDiff := time.Duration(1<<63 - 1)
+	for _, key := range keys {
+		timestamp, err := parseTimestampFromKey(key)
+		if err != nil {
+			slog.Warn("Failed to parse timestamp from key", "key", key, "error", err)
+			continue
+		}
+
+		diff := timestamp.Sub(targetTime)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < closestDiff {
+			closestDiff = diff
+			closestKey = key
+		}
+	}
+
+	if closestKey == "" {
+		return nil, fmt.Errorf("no matching snapshot found for timestamp")
+	}
+
+	stations, _, err := a.GetSnapshot(ctx, closestKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+
+	return stations, nil
+}
+
+// ForEachSnapshot downloads every snapshot in [from, to], oldest first.
+// Only the days the range covers are listed, and timestamps are taken from
+// blob names so snapshots outside the range are never downloaded.
+func (a *AzureBlobStorage) ForEachSnapshot(ctx context.Context, from, to time.Time, fn func(Snapshot) error) (err error) {
+	ctx, span := telemetry.Start(ctx, "azure.ForEachSnapshot", rangeAttrs(from, to)...)
+	defer telemetry.End(span, &err)
+
+	keys, err := a.ListSnapshotsRange(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	// ListSnapshots returns newest first; iterate oldest first
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ts, err := parseTimestampFromKey(keys[i])
+		if err != nil || !inRange(ts, from, to) {
+			continue
+		}
+
+		stations, timestamp, err := a.GetSnapshot(ctx, keys[i])
+		if err != nil {
+			slog.Error("Failed to read snapshot", "backend", "azure", "key", keys[i], "error", err)
+			continue
+		}
+		if timestamp.IsZero() {
+			timestamp = ts
+		}
+
+		if err := fn(Snapshot{Timestamp: timestamp, Stations: stations}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifySnapshots downloads every snapshot and checks it against its metadata checksum.
+func (a *AzureBlobStorage) VerifySnapshots(ctx context.Context) (*IntegrityReport, error) {
+	keys, err := a.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, _, verified, err := a.readSnapshot(ctx, key)
+		report.add(key, verified, err)
+	}
+	return report, nil
+}
+
+// ptr returns a pointer to v, as the Azure SDK takes optional fields by pointer.
+func ptr[T any](v T) *T {
+	return &v
+}
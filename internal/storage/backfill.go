@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// BackfillResult describes what happened to a single local file during a backfill.
+type BackfillResult struct {
+	File     string
+	Key      string
+	Stations int
+	Skipped  bool
+}
+
+// SnapshotKey returns the R2 key used for a snapshot taken at timestamp, in
+// the date hierarchy.
+func (r *R2Storage) SnapshotKey(timestamp time.Time) string {
+	return datedSnapshotKey(r.prefix, timestamp)
+}
+
+// ObjectExists reports whether an object with the given key exists in the bucket.
+func (r *R2Storage) ObjectExists(ctx context.Context, key string) (bool, error) {
+	_, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to head object: %w", err)
+}
+
+// BackfillFile validates a local stations_*.tsv file and uploads it to R2 under the
+// same key the collector would have used. Files already uploaded, under either
+// key layout, are skipped.
+// If dryRun is set, the file is validated but not uploaded.
+func (r *R2Storage) BackfillFile(ctx context.Context, path string, dryRun bool) (*BackfillResult, error) {
+	timestamp, err := parseSnapshotFilename(filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	// Local snapshots may have been encrypted with the same keys
+	if data, _, err = r.keys.open(data); err != nil {
+		return nil, err
+	}
+
+	expected, err := readChecksumSidecar(path)
+	if err != nil {
+		return nil, err
+	}
+	stations, rowTimestamp, _, err := parseVerifiedTSV(bytes.NewReader(data), path, expected)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if len(stations) == 0 {
+		return nil, fmt.Errorf("invalid snapshot: no station rows")
+	}
+	if !rowTimestamp.IsZero() && !rowTimestamp.Truncate(time.Second).Equal(timestamp) {
+		return nil, fmt.Errorf("invalid snapshot: filename timestamp %s does not match row timestamp %s",
+			timestamp.Format(time.RFC3339), rowTimestamp.Format(time.RFC3339))
+	}
+
+	result := &BackfillResult{
+		File:     path,
+		Key:      r.SnapshotKey(timestamp),
+		Stations: len(stations),
+	}
+
+	// A snapshot not yet migrated to the date hierarchy counts as uploaded
+	exists, err := r.ObjectExists(ctx, result.Key)
+	if err == nil && !exists {
+		exists, err = r.ObjectExists(ctx, legacySnapshotKey(r.prefix, timestamp))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		result.Skipped = true
+		return result, nil
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	metadata := map[string]string{
+		timestampMetadataKey: timestamp.Format(time.RFC3339),
+		rowsMetadataKey:      fmt.Sprintf("%d", len(stations)),
+		checksumMetadataKey:  checksumOf(data, len(stations)).SHA256,
+	}
+	if expected != nil {
+		maps.Copy(metadata, annotationMetadata(expected.Source, expected.Validation))
+	}
+
+	body, err := r.keys.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(r.bucket),
+		Key:         aws.String(result.Key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(r.keys.contentType()),
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload to R2: %w", err)
+	}
+
+	return result, nil
+}
+
+// FindSnapshotFiles returns the stations_*.tsv files under dir, oldest first.
+// Partial snapshots the collector moved to its quarantine subdirectory are skipped.
+func FindSnapshotFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() && name == quarantineDir {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasPrefix(name, "stations_") && strings.HasSuffix(name, ".tsv") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseSnapshotFilename extracts the timestamp from a stations_YYYYMMDD_HHMMSS.tsv filename.
+func parseSnapshotFilename(name string) (time.Time, error) {
+	ts, err := parseTimestampFromKey(name)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid snapshot filename %q: %w", name, err)
+	}
+	return ts, nil
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrPreconditionFailed is returned (wrapped) when a conditional write loses to a
+// concurrent writer.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ConditionalObjectStore is implemented by stores that support compare-and-swap
+// writes, the building block for coordinating several processes through the store.
+type ConditionalObjectStore interface {
+	ObjectStore
+
+	// GetObjectVersion returns the data stored under key and an opaque version
+	// token, or an error wrapping ErrNotFound.
+	GetObjectVersion(ctx context.Context, key string) ([]byte, string, error)
+
+	// PutObjectIf stores data under key only if the stored object is still at
+	// version, or does not exist when version is "". Otherwise it returns an
+	// error wrapping ErrPreconditionFailed.
+	PutObjectIf(ctx context.Context, key string, data []byte, contentType, version string) error
+}
+
+// GetObjectVersion downloads an object and its ETag from R2.
+func (r *R2Storage) GetObjectVersion(ctx context.Context, key string) ([]byte, string, error) {
+	result, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.root + key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, "", fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, "", fmt.Errorf("failed to get object: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read object: %w", err)
+	}
+	return data, aws.ToString(result.ETag), nil
+}
+
+// PutObjectIf uploads an object to R2 with an If-Match or If-None-Match condition.
+func (r *R2Storage) PutObjectIf(ctx context.Context, key string, data []byte, contentType, version string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(r.bucket),
+		Key:         aws.String(r.root + key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	}
+	if version == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(version)
+	}
+
+	if _, err := r.client.PutObject(ctx, input); err != nil {
+		var respErr *smithyhttp.ResponseError
+		if errors.As(err, &respErr) && (respErr.HTTPStatusCode() == http.StatusPreconditionFailed || respErr.HTTPStatusCode() == http.StatusConflict) {
+			return fmt.Errorf("%w: %s", ErrPreconditionFailed, key)
+		}
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// GetObjectVersion downloads a blob and its ETag from the container.
+func (a *AzureBlobStorage) GetObjectVersion(ctx context.Context, key string) ([]byte, string, error) {
+	result, err := a.client.DownloadStream(ctx, a.container, a.root+key, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, "", fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, "", fmt.Errorf("failed to get object: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read object: %w", err)
+	}
+	var version string
+	if result.ETag != nil {
+		version = string(*result.ETag)
+	}
+	return data, version, nil
+}
+
+// PutObjectIf uploads a blob with an If-Match or If-None-Match condition.
+func (a *AzureBlobStorage) PutObjectIf(ctx context.Context, key string, data []byte, contentType, version string) error {
+	conditions := &blob.ModifiedAccessConditions{}
+	if version == "" {
+		conditions.IfNoneMatch = ptr(azcore.ETagAny)
+	} else {
+		conditions.IfMatch = ptr(azcore.ETag(version))
+	}
+
+	_, err := a.client.UploadBuffer(ctx, a.container, a.root+key, data, &azblob.UploadBufferOptions{
+		HTTPHeaders:      &blob.HTTPHeaders{BlobContentType: ptr(contentType)},
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: conditions},
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+			return fmt.Errorf("%w: %s", ErrPreconditionFailed, key)
+		}
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// staleLockAge is how old a local lock file must be before it is assumed to be
+// left over from a crashed process.
+const staleLockAge = 30 * time.Second
+
+// GetObjectVersion reads a local object; its version is the SHA-256 of its contents.
+func (s *TSVStorage) GetObjectVersion(ctx context.Context, key string) ([]byte, string, error) {
+	data, err := s.GetObject(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentVersion(data), nil
+}
+
+// PutObjectIf writes a local object if it is still at version. A lock file next to
+// the object serialises concurrent writers on the same machine.
+func (s *TSVStorage) PutObjectIf(ctx context.Context, key string, data []byte, contentType, version string) error {
+	path, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	unlock, err := lockFile(ctx, path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if version != "" {
+			return fmt.Errorf("%w: %s", ErrPreconditionFailed, key)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to read object: %w", err)
+	case version == "" || contentVersion(current) != version:
+		return fmt.Errorf("%w: %s", ErrPreconditionFailed, key)
+	}
+
+	return s.PutObject(ctx, key, data, contentType)
+}
+
+// contentVersion returns the version token of a local object.
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lockFile creates path exclusively, waiting while another process holds it.
+// It returns a function that releases the lock.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		// Break locks left behind by a process that died while holding them
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"city-cycling/internal/tfl"
+)
+
+// encryptedMagic starts every encrypted snapshot, followed by the length of
+// the key ID, the key ID, the nonce and the AES-GCM ciphertext. Snapshots are
+// plain TSV otherwise, which never starts with it.
+const encryptedMagic = "CCSNAP1\x00"
+
+// keyIDPattern restricts key IDs to what fits in the envelope header and reads
+// well in logs.
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// errUnknownKey is returned (wrapped) for a snapshot encrypted with a key the
+// keyring does not hold.
+var errUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds the AES-GCM keys snapshots are encrypted with at rest. New
+// snapshots are encrypted with the current key; any key of the ring decrypts,
+// so keys can be rotated by adding a new current key and keeping the old ones
+// until every snapshot has been re-encrypted (see RotateSnapshotKeys).
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeyring parses comma-separated id:key pairs, each key 16, 24 or 32
+// bytes in standard base64 (AES-128, -192 or -256). The first pair is the
+// current key. An empty spec returns a nil keyring, which leaves snapshots
+// unencrypted.
+func ParseKeyring(spec string) (*Keyring, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for i, pair := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("key %d: expected id:base64key with an id of letters, digits, '_', '-' or '.'", i)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("key %q: duplicate id", id)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid base64: %w", id, err)
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.keys[id] = aead
+		if i == 0 {
+			k.current = id
+		}
+	}
+	return k, nil
+}
+
+// Current returns the ID of the key new snapshots are encrypted with, or ""
+// for a nil keyring.
+func (k *Keyring) Current() string {
+	if k == nil {
+		return ""
+	}
+	return k.current
+}
+
+// seal encrypts a snapshot with the current key. A nil keyring returns it
+// unchanged.
+func (k *Keyring) seal(plaintext []byte) ([]byte, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	aead := k.keys[k.current]
+	header := envelopeHeader(k.current)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(append(out, header...), nonce...)
+	return aead.Seal(out, nonce, plaintext, header), nil
+}
+
+// open decrypts a snapshot, returning the ID of the key it was encrypted
+// with; plaintext snapshots are returned unchanged with an empty ID.
+func (k *Keyring) open(data []byte) ([]byte, string, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return data, "", nil
+	}
+	rest := data[len(encryptedMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, "", fmt.Errorf("truncated encrypted snapshot")
+	}
+	id := string(rest[1 : 1+int(rest[0])])
+	header := data[:len(encryptedMagic)+1+len(id)]
+	if k == nil {
+		return nil, id, fmt.Errorf("%w %q: snapshot is encrypted but no keys are configured", errUnknownKey, id)
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, id, fmt.Errorf("%w %q", errUnknownKey, id)
+	}
+	sealed := data[len(header):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, id, fmt.Errorf("truncated encrypted snapshot")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], header)
+	if err != nil {
+		return nil, id, fmt.Errorf("failed to decrypt snapshot with key %q: %w", id, err)
+	}
+	return plaintext, id, nil
+}
+
+// reader returns the plaintext of the snapshot read from r. Plaintext
+// snapshots are streamed; encrypted ones are read whole to be decrypted.
+func (k *Keyring) reader(r io.Reader) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(r, len(encryptedMagic))
+	magic, err := buffered.Peek(len(encryptedMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", fmt.Errorf("error reading file: %w", err)
+	}
+	if string(magic) != encryptedMagic {
+		return buffered, "", nil
+	}
+	data, err := io.ReadAll(buffered)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading file: %w", err)
+	}
+	plaintext, id, err := k.open(data)
+	if err != nil {
+		return nil, id, err
+	}
+	return bytes.NewReader(plaintext), id, nil
+}
+
+// contentType returns the content type snapshots are stored with.
+func (k *Keyring) contentType() string {
+	if k == nil {
+		return "text/tab-separated-values"
+	}
+	return "application/octet-stream"
+}
+
+// envelopeHeader returns the header of a snapshot encrypted with key id,
+// which is also authenticated as additional data.
+func envelopeHeader(id string) []byte {
+	header := make([]byte, 0, len(encryptedMagic)+1+len(id))
+	header = append(header, encryptedMagic...)
+	header = append(header, byte(len(id)))
+	return append(header, id...)
+}
+
+// Encrypter is implemented by stores that can encrypt the snapshots they
+// write, and decrypt the ones they read.
+type Encrypter interface {
+	// SetEncryption encrypts snapshots written from now on with keys, and
+	// decrypts snapshots read with any of them. A nil keyring writes plain
+	// snapshots, and still reads plain ones.
+	SetEncryption(keys *Keyring)
+}
+
+// SetEncryption encrypts snapshots with keys.
+func (s *TSVStorage) SetEncryption(keys *Keyring) {
+	s.keys = keys
+}
+
+// SetEncryption encrypts snapshots with keys.
+func (r *R2Storage) SetEncryption(keys *Keyring) {
+	r.keys = keys
+}
+
+// SetEncryption encrypts snapshots with keys.
+func (a *AzureBlobStorage) SetEncryption(keys *Keyring) {
+	a.keys = keys
+}
+
+// SetEncryption encrypts the snapshots of store with keys. A fallback store
+// encrypts both its stores.
+func SetEncryption(store DataStore, keys *Keyring) error {
+	if f, ok := store.(*FallbackStorage); ok {
+		if err := SetEncryption(f.primary, keys); err != nil {
+			return err
+		}
+		return SetEncryption(f.secondary, keys)
+	}
+	e, ok := store.(Encrypter)
+	if !ok {
+		return fmt.Errorf("storage backend %T does not support encryption", store)
+	}
+	e.SetEncryption(keys)
+	return nil
+}
+
+// KeyRotation is one snapshot re-encrypted by RotateSnapshotKeys.
+type KeyRotation struct {
+	Key string
+	// From is the key the snapshot was encrypted with, "" if it was plain.
+	From string
+}
+
+// encryptedStore is what RotateSnapshotKeys needs of a store.
+type encryptedStore interface {
+	SnapshotManager
+	TimestampedWriter
+}
+
+// RotateSnapshotKeys re-encrypts every snapshot of store not encrypted with
+// keys' current key, plain ones included, calling fn after each; store must
+// already be set to use keys. With dryRun it only reports what would be
+// re-encrypted. Each snapshot is rewritten under its own key, so it stays
+// readable throughout; afterwards the old keys can be dropped from the ring.
+func RotateSnapshotKeys(ctx context.Context, store DataStore, keys *Keyring, dryRun bool, fn func(KeyRotation)) error {
+	if keys == nil {
+		return fmt.Errorf("no encryption keys configured")
+	}
+	s, ok := store.(encryptedStore)
+	if !ok {
+		return fmt.Errorf("storage backend %T cannot rewrite snapshots", store)
+	}
+	snapshots, err := s.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range snapshots {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		inspection, err := s.InspectSnapshot(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to read snapshot %s: %w", key, err)
+		}
+		if inspection.EncryptionKey == keys.Current() {
+			continue
+		}
+		if inspection.Checksum != "" && !inspection.Verified {
+			return fmt.Errorf("snapshot %s does not match its checksum, not rewriting it: %s", key, inspection.VerifyError)
+		}
+		rotation := KeyRotation{Key: key, From: inspection.EncryptionKey}
+		if !dryRun {
+			timestamp, err := parseTimestampFromKey(key)
+			if err != nil {
+				return err
+			}
+			stations := &tfl.Stations{
+				Stations:   inspection.Stations,
+				Source:     inspection.Source,
+				Validation: validationFromSummary(inspection.Validation),
+			}
+			written, err := s.WriteStationsAt(ctx, timestamp, stations)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite snapshot %s: %w", key, err)
+			}
+			// A flat-layout snapshot is rewritten at its dated key
+			if written != key {
+				if err := s.DeleteSnapshot(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+					return fmt.Errorf("failed to delete rewritten snapshot %s: %w", key, err)
+				}
+			}
+		}
+		if fn != nil {
+			fn(rotation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+// TieredStore is what FallbackStorage needs of each of its stores: every
+// backend is one.
+type TieredStore interface {
+	HistoricalDataStore
+	RangeDataStore
+	SnapshotWriter
+	TimestampedWriter
+	SnapshotManager
+	ConditionalObjectStore
+}
+
+// FallbackStorage reads from a primary store, falling back to a secondary one
+// for whatever the primary lacks, e.g. recent snapshots in local files and the
+// archive in R2. Snapshot listings and the history are merged, the primary's
+// copy winning where both hold a snapshot; writes go to the primary alone.
+//
+// A secondary that fails is logged and skipped, so the primary's data is
+// still served; a primary that fails is an error, except for the latest
+// snapshot, which the secondary stands in for.
+//
+// Used as hot and cold tiers, with Demote moving old snapshots from the
+// primary to the secondary, reads of ranges after the tier boundary go to the
+// primary alone.
+type FallbackStorage struct {
+	primary   TieredStore
+	secondary TieredStore
+	tiers     *tierIndexCache
+}
+
+// NewFallbackStorage returns a store reading from primary and falling back to
+// secondary.
+func NewFallbackStorage(primary, secondary DataStore) (*FallbackStorage, error) {
+	p, ok := primary.(TieredStore)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %T cannot be a primary store", primary)
+	}
+	s, ok := secondary.(TieredStore)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %T cannot be a fallback store", secondary)
+	}
+	return &FallbackStorage{primary: p, secondary: s, tiers: &tierIndexCache{}}, nil
+}
+
+// Primary returns the store written to and read first.
+func (f *FallbackStorage) Primary() TieredStore {
+	return f.primary
+}
+
+// Secondary returns the store read for what the primary lacks.
+func (f *FallbackStorage) Secondary() TieredStore {
+	return f.secondary
+}
+
+// ReadLatestStations reads the primary's latest snapshot, or the secondary's
+// while the primary has none.
+func (f *FallbackStorage) ReadLatestStations(ctx context.Context) ([]tfl.Station, time.Time, error) {
+	stations, timestamp, err := f.primary.ReadLatestStations(ctx)
+	if err == nil && len(stations) > 0 {
+		return stations, timestamp, nil
+	}
+	if ctx.Err() != nil {
+		return nil, time.Time{}, ctx.Err()
+	}
+	fallback, fallbackTimestamp, fallbackErr := f.secondary.ReadLatestStations(ctx)
+	if fallbackErr != nil {
+		if err != nil {
+			return nil, time.Time{}, errors.Join(err, fallbackErr)
+		}
+		return stations, timestamp, nil
+	}
+	return fallback, fallbackTimestamp, nil
+}
+
+// ListAvailableTimestamps returns the timestamps of both stores, newest first,
+// each once.
+func (f *FallbackStorage) ListAvailableTimestamps(ctx context.Context) ([]time.Time, error) {
+	return f.ListTimestamps(ctx, TimestampQuery{})
+}
+
+// ListTimestamps returns the timestamps of both stores matching q, newest
+// first, each once.
+func (f *FallbackStorage) ListTimestamps(ctx context.Context, q TimestampQuery) ([]time.Time, error) {
+	primary, secondary, err := f.timestamps(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	merged := append(primary, secondary...)
+	slices.SortFunc(merged, func(a, b time.Time) int { return b.Compare(a) })
+	merged = slices.CompactFunc(merged, time.Time.Equal)
+	if q.Limit > 0 && len(merged) > q.Limit {
+		merged = merged[:q.Limit]
+	}
+	return merged, nil
+}
+
+// GetHistoricalData merges the history of both stores, newest first.
+func (f *FallbackStorage) GetHistoricalData(ctx context.Context) ([]HistoricalDataPoint, error) {
+	points, err := f.primary.GetHistoricalData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	older, err := f.secondary.GetHistoricalData(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		slog.Warn("Fallback store unavailable, serving the primary's history", "error", err)
+		older = nil
+	}
+
+	seen := make(map[time.Time]bool, len(points))
+	for _, p := range points {
+		seen[p.Timestamp] = true
+	}
+	for _, p := range older {
+		if !seen[p.Timestamp] {
+			points = append(points, p)
+		}
+	}
+	slices.SortFunc(points, func(a, b HistoricalDataPoint) int { return b.Timestamp.Compare(a.Timestamp) })
+	return points, nil
+}
+
+// GetSnapshotByTimestamp returns the snapshot closest to timestamp in either
+// store, preferring the primary's when both are as close.
+func (f *FallbackStorage) GetSnapshotByTimestamp(ctx context.Context, timestamp time.Time) ([]tfl.Station, error) {
+	// Every demoted snapshot is further away than a primary one nearer than the boundary
+	if boundary := f.boundary(ctx); !boundary.IsZero() && !timestamp.Before(boundary) {
+		primary, err := ListTimestamps(ctx, f.primary, TimestampQuery{})
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := closestTimestamp(primary, timestamp); ok && absDuration(p.Sub(timestamp)) <= timestamp.Sub(boundary) {
+			return f.primary.GetSnapshotByTimestamp(ctx, p)
+		}
+	}
+
+	primary, secondary, err := f.timestamps(ctx, TimestampQuery{})
+	if err != nil {
+		return nil, err
+	}
+	p, pOK := closestTimestamp(primary, timestamp)
+	s, sOK := closestTimestamp(secondary, timestamp)
+	if sOK && (!pOK || absDuration(s.Sub(timestamp)) < absDuration(p.Sub(timestamp))) {
+		return f.secondary.GetSnapshotByTimestamp(ctx, s)
+	}
+	if !pOK {
+		return nil, fmt.Errorf("no snapshots available")
+	}
+	return f.primary.GetSnapshotByTimestamp(ctx, p)
+}
+
+// ForEachSnapshot calls fn for every snapshot of either store with from <=
+// timestamp <= to, oldest first. The range is split into runs of snapshots
+// held by the same store, each read from that store alone.
+func (f *FallbackStorage) ForEachSnapshot(ctx context.Context, from, to time.Time, fn func(Snapshot) error) error {
+	primary, secondary, err := f.timestamps(ctx, TimestampQuery{From: from, To: to})
+	if err != nil {
+		return err
+	}
+	if len(secondary) == 0 {
+		return f.primary.ForEachSnapshot(ctx, from, to, fn)
+	}
+
+	held := make(map[time.Time]bool, len(primary))
+	for _, ts := range primary {
+		held[ts] = true
+	}
+	for _, run := range snapshotRuns(primary, secondary, held) {
+		store := f.secondary
+		if run.primary {
+			store = f.primary
+		}
+		if err := store.ForEachSnapshot(ctx, run.from, run.to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteStations writes a snapshot to the primary.
+func (f *FallbackStorage) WriteStations(ctx context.Context, stations *tfl.Stations) (string, error) {
+	return f.primary.WriteStations(ctx, stations)
+}
+
+// PutObject stores an object in the primary.
+func (f *FallbackStorage) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	return f.primary.PutObject(ctx, key, data, contentType)
+}
+
+// GetObject returns an object from the primary, or from the secondary when
+// the primary has none.
+func (f *FallbackStorage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	data, err := f.primary.GetObject(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+	return f.secondary.GetObject(ctx, key)
+}
+
+// GetObjectVersion returns an object and its version from the primary, which
+// compare-and-swap writes go to.
+func (f *FallbackStorage) GetObjectVersion(ctx context.Context, key string) ([]byte, string, error) {
+	return f.primary.GetObjectVersion(ctx, key)
+}
+
+// PutObjectIf stores an object in the primary if it is still at version.
+func (f *FallbackStorage) PutObjectIf(ctx context.Context, key string, data []byte, contentType, version string) error {
+	return f.primary.PutObjectIf(ctx, key, data, contentType, version)
+}
+
+// timestamps lists the timestamps matching q in the primary and, unless it
+// fails, in the secondary. A range wholly on one side of the tier boundary
+// is listed in that store alone.
+func (f *FallbackStorage) timestamps(ctx context.Context, q TimestampQuery) (primary, secondary []time.Time, err error) {
+	boundary := f.boundary(ctx)
+	if !boundary.IsZero() && !q.To.IsZero() && q.To.Before(boundary) {
+		secondary, err = ListTimestamps(ctx, f.secondary, q)
+		return nil, secondary, err
+	}
+
+	primary, err = ListTimestamps(ctx, f.primary, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !boundary.IsZero() && !q.From.IsZero() && !q.From.Before(boundary) {
+		return primary, nil, nil
+	}
+	secondary, err = ListTimestamps(ctx, f.secondary, q)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		slog.Warn("Fallback store unavailable, serving the primary's snapshots", "error", err)
+		return primary, nil, nil
+	}
+	return primary, secondary, nil
+}
+
+// snapshotRun is a range of consecutive snapshots held by one store.
+type snapshotRun struct {
+	from, to time.Time
+	primary  bool
+}
+
+// snapshotRuns splits the snapshots of both stores, oldest first, into runs
+// held by the same store; held marks the primary's, which win ties.
+func snapshotRuns(primary, secondary []time.Time, held map[time.Time]bool) []snapshotRun {
+	all := slices.Concat(primary, secondary)
+	slices.SortFunc(all, time.Time.Compare)
+	all = slices.CompactFunc(all, time.Time.Equal)
+
+	var runs []snapshotRun
+	for _, ts := range all {
+		inPrimary := held[ts]
+		if n := len(runs); n > 0 && runs[n-1].primary == inPrimary {
+			runs[n-1].to = ts
+			continue
+		}
+		runs = append(runs, snapshotRun{from: ts, to: ts, primary: inPrimary})
+	}
+	return runs
+}
+
+// closestTimestamp returns the timestamp in timestamps closest to target.
+func closestTimestamp(timestamps []time.Time, target time.Time) (time.Time, bool) {
+	var closest time.Time
+	found := false
+	for _, ts := range timestamps {
+		if !found || absDuration(ts.Sub(target)) < absDuration(closest.Sub(target)) {
+			closest, found = ts, true
+		}
+	}
+	return closest, found
+}
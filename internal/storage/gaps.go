@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// gapTolerance is how much longer than the expected interval two consecutive
+// snapshots may be apart before the space between them counts as a gap.
+const gapTolerance = 1.5
+
+// Gap is a window in which one or more expected snapshots are missing.
+type Gap struct {
+	Start    time.Time     // timestamp of the last snapshot before the gap
+	End      time.Time     // timestamp of the first snapshot after the gap
+	Duration time.Duration // End - Start
+	Missing  int           // estimated number of missed snapshots
+}
+
+// GapReportResult summarizes missing snapshot windows across the archive.
+type GapReportResult struct {
+	ExpectedInterval time.Duration
+	First            time.Time
+	Last             time.Time
+	SnapshotCount    int
+	MissingCount     int
+	Gaps             []Gap
+}
+
+// GapReport scans the available snapshot timestamps in store and returns every window
+// where consecutive snapshots are further apart than expectedInterval allows.
+func GapReport(ctx context.Context, store DataStore, expectedInterval time.Duration) (*GapReportResult, error) {
+	if expectedInterval <= 0 {
+		return nil, fmt.Errorf("expected interval must be positive")
+	}
+
+	timestamps, err := store.ListAvailableTimestamps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list timestamps: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return FindGaps(timestamps, expectedInterval), nil
+}
+
+// FindGaps builds a gap report from an unordered list of snapshot timestamps.
+func FindGaps(timestamps []time.Time, expectedInterval time.Duration) *GapReportResult {
+	sorted := make([]time.Time, len(timestamps))
+	copy(sorted, timestamps)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	report := &GapReportResult{
+		ExpectedInterval: expectedInterval,
+		SnapshotCount:    len(sorted),
+	}
+	if len(sorted) == 0 {
+		return report
+	}
+	report.First = sorted[0]
+	report.Last = sorted[len(sorted)-1]
+
+	threshold := time.Duration(float64(expectedInterval) * gapTolerance)
+	for i := 1; i < len(sorted); i++ {
+		diff := sorted[i].Sub(sorted[i-1])
+		if diff <= threshold {
+			continue
+		}
+
+		missing := int((diff+expectedInterval/2)/expectedInterval) - 1
+		if missing < 1 {
+			missing = 1
+		}
+		report.Gaps = append(report.Gaps, Gap{
+			Start:    sorted[i-1],
+			End:      sorted[i],
+			Duration: diff,
+			Missing:  missing,
+		})
+		report.MissingCount += missing
+	}
+
+	return report
+}
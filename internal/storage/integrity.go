@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+// ErrChecksumMismatch is returned (wrapped) when a snapshot does not match its recorded checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+const (
+	// checksumMetadataKey and rowsMetadataKey are the R2 object metadata fields
+	// recording a snapshot's SHA-256 and station row count.
+	checksumMetadataKey = "sha256"
+	rowsMetadataKey     = "stations"
+	// timestampMetadataKey records when a snapshot was taken, in RFC 3339.
+	timestampMetadataKey = "timestamp"
+	// sourceMetadataKey records which feed source produced a snapshot, when known.
+	sourceMetadataKey = "source"
+	// validationMetadataKey records the collector's validation summary.
+	validationMetadataKey = "validation"
+	// maxValidationMetadata caps the validation summary, as object metadata
+	// is limited to a few kilobytes in total.
+	maxValidationMetadata = 1024
+
+	// checksumSuffix is appended to a local snapshot's filename to name its checksum sidecar.
+	checksumSuffix = ".checksum.json"
+)
+
+// snapshotChecksum records what a snapshot looked like when it was written.
+type snapshotChecksum struct {
+	SHA256 string `json:"sha256"`
+	Rows   int    `json:"rows"`
+	// Source is the feed source that produced the snapshot, recorded in the
+	// sidecar alongside the checksum.
+	Source string `json:"source,omitempty"`
+	// Validation is the collector's validation result, if it ran one.
+	Validation *tfl.Validation `json:"validation,omitempty"`
+}
+
+// checksumOf returns the checksum of snapshot content with rows station rows.
+func checksumOf(data []byte, rows int) snapshotChecksum {
+	sum := sha256.Sum256(data)
+	return snapshotChecksum{SHA256: hex.EncodeToString(sum[:]), Rows: rows}
+}
+
+// verify compares a snapshot read back against the recorded checksum.
+func (c snapshotChecksum) verify(h hash.Hash, rows int) error {
+	if got := hex.EncodeToString(h.Sum(nil)); got != c.SHA256 {
+		return fmt.Errorf("%w: sha256 %s, expected %s", ErrChecksumMismatch, got, c.SHA256)
+	}
+	if rows != c.Rows {
+		return fmt.Errorf("%w: %d rows, expected %d", ErrChecksumMismatch, rows, c.Rows)
+	}
+	return nil
+}
+
+// annotationMetadata returns the object metadata describing where a snapshot
+// came from and how it fared in validation, omitting whatever is unknown.
+func annotationMetadata(source string, validation *tfl.Validation) map[string]string {
+	metadata := make(map[string]string)
+	if source != "" {
+		metadata[sourceMetadataKey] = source
+	}
+	if validation != nil {
+		summary := validation.Summary()
+		if len(summary) > maxValidationMetadata {
+			summary = summary[:maxValidationMetadata-3] + "..."
+		}
+		metadata[validationMetadataKey] = summary
+	}
+	return metadata
+}
+
+// checksumFromMetadata reads a checksum from R2 object metadata.
+// Objects written before checksums were recorded have none.
+func checksumFromMetadata(metadata map[string]string) (snapshotChecksum, bool) {
+	sum, ok := metadata[checksumMetadataKey]
+	if !ok || sum == "" {
+		return snapshotChecksum{}, false
+	}
+	rows, err := strconv.Atoi(metadata[rowsMetadataKey])
+	if err != nil {
+		return snapshotChecksum{}, false
+	}
+	return snapshotChecksum{SHA256: sum, Rows: rows}, true
+}
+
+// parseVerifiedTSV parses snapshot content from r and checks it against expected,
+// if a checksum was recorded. It reports whether the snapshot was verified.
+func parseVerifiedTSV(r io.Reader, source string, expected *snapshotChecksum) ([]tfl.Station, time.Time, bool, error) {
+	h := sha256.New()
+	rows := 0
+	if expected != nil {
+		rows = expected.Rows
+	}
+	stations, timestamp, err := parseTSV(io.TeeReader(r, h), source, rows)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if expected == nil {
+		return stations, timestamp, false, nil
+	}
+	// Drain anything the parser did not consume so the hash covers the whole object
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("error reading file: %w", err)
+	}
+	if err := expected.verify(h, len(stations)); err != nil {
+		releaseStations(stations)
+		return nil, time.Time{}, false, err
+	}
+	return stations, timestamp, true, nil
+}
+
+// writeChecksumSidecar records the checksum of a local snapshot next to it.
+func writeChecksumSidecar(path string, c snapshotChecksum) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode checksum: %w", err)
+	}
+	return writeFileAtomic(path+checksumSuffix, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// readChecksumSidecar returns the checksum recorded for a local snapshot, or nil
+// if it has none.
+func readChecksumSidecar(path string) (*snapshotChecksum, error) {
+	data, err := os.ReadFile(path + checksumSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checksum: %w", err)
+	}
+	var c snapshotChecksum
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse checksum: %w", err)
+	}
+	return &c, nil
+}
+
+// IntegrityFailure describes a snapshot that failed verification.
+type IntegrityFailure struct {
+	Key    string
+	Reason string
+}
+
+// IntegrityReport summarises an archive audit.
+type IntegrityReport struct {
+	Checked    int
+	Verified   int
+	Unverified int // snapshots written before checksums were recorded
+	Failures   []IntegrityFailure
+}
+
+// IntegrityVerifier is implemented by stores that can audit their snapshots
+// against recorded checksums.
+type IntegrityVerifier interface {
+	VerifySnapshots(ctx context.Context) (*IntegrityReport, error)
+}
+
+// add records the outcome of verifying one snapshot.
+func (r *IntegrityReport) add(key string, verified bool, err error) {
+	r.Checked++
+	switch {
+	case err != nil:
+		r.Failures = append(r.Failures, IntegrityFailure{Key: key, Reason: err.Error()})
+	case verified:
+		r.Verified++
+	default:
+		r.Unverified++
+	}
+}
+
+// VerifySnapshots reads every local snapshot and checks it against its sidecar checksum.
+func (s *TSVStorage) VerifySnapshots(ctx context.Context) (*IntegrityReport, error) {
+	files, err := s.listTSVFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, _, verified, err := s.readSnapshotFile(file)
+		report.add(filepath.Base(file), verified, err)
+	}
+	return report, nil
+}
+
+// VerifySnapshots downloads every R2 snapshot and checks it against its metadata checksum.
+func (r *R2Storage) VerifySnapshots(ctx context.Context) (*IntegrityReport, error) {
+	keys, err := r.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, _, verified, err := r.readSnapshot(ctx, key)
+		report.add(key, verified, err)
+	}
+	return report, nil
+}
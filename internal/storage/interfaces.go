@@ -2,19 +2,67 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"time"
 
 	"city-cycling/internal/tfl"
 )
 
+// ErrNotFound is returned (wrapped) when a requested object does not exist.
+var ErrNotFound = errors.New("object not found")
+
 // DataStore is the interface for reading station data.
 // It's implemented by both TSVStorage and R2Storage.
 type DataStore interface {
 	// ReadLatestStations reads the most recent station data.
-	ReadLatestStations() ([]tfl.Station, time.Time, error)
+	ReadLatestStations(ctx context.Context) ([]tfl.Station, time.Time, error)
 
 	// ListAvailableTimestamps returns all available data timestamps.
-	ListAvailableTimestamps() ([]time.Time, error)
+	ListAvailableTimestamps(ctx context.Context) ([]time.Time, error)
+}
+
+// TimestampQuery selects snapshot timestamps for ListTimestamps.
+type TimestampQuery struct {
+	// From and To bound the timestamps, inclusive; a zero bound is open.
+	From, To time.Time
+	// Limit caps how many timestamps are returned, newest first; 0 returns all.
+	Limit int
+}
+
+// TimestampLister is implemented by stores that can list the snapshot
+// timestamps in a range without listing the whole archive.
+type TimestampLister interface {
+	// ListTimestamps returns the timestamps matching q, newest first.
+	ListTimestamps(ctx context.Context, q TimestampQuery) ([]time.Time, error)
+}
+
+// ListTimestamps returns the snapshot timestamps in store matching q, newest
+// first, using the store's own range listing when it has one.
+func ListTimestamps(ctx context.Context, store DataStore, q TimestampQuery) ([]time.Time, error) {
+	if lister, ok := store.(TimestampLister); ok {
+		return lister.ListTimestamps(ctx, q)
+	}
+	all, err := store.ListAvailableTimestamps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return q.apply(all), nil
+}
+
+// apply returns the timestamps matching q, newest first.
+func (q TimestampQuery) apply(timestamps []time.Time) []time.Time {
+	var selected []time.Time
+	for _, ts := range timestamps {
+		if inRange(ts, q.From, q.To) {
+			selected = append(selected, ts)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].After(selected[j]) })
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+	}
+	return selected
 }
 
 // HistoricalDataStore extends DataStore with methods for accessing historical data.
@@ -24,27 +72,49 @@ type HistoricalDataStore interface {
 	// GetHistoricalData returns aggregate statistics for all available snapshots.
 	// This is used to display trends over time.
 	GetHistoricalData(ctx context.Context) ([]HistoricalDataPoint, error)
+
+	// GetSnapshotByTimestamp returns station data from the snapshot closest to timestamp.
+	GetSnapshotByTimestamp(ctx context.Context, timestamp time.Time) ([]tfl.Station, error)
+}
+
+// SnapshotWriter is implemented by stores that can persist a new snapshot.
+type SnapshotWriter interface {
+	// WriteStations writes station data and returns the location it was written to.
+	WriteStations(ctx context.Context, stations *tfl.Stations) (string, error)
+}
+
+// TimestampedWriter is implemented by stores that can persist a snapshot under
+// the time it was taken rather than the current time.
+type TimestampedWriter interface {
+	// WriteStationsAt writes station data as the snapshot taken at timestamp
+	// and returns the location it was written to.
+	WriteStationsAt(ctx context.Context, timestamp time.Time, stations *tfl.Stations) (string, error)
+}
+
+// ObjectStore is implemented by stores that can hold auxiliary objects
+// (indexes, caches, derived state) alongside snapshots.
+type ObjectStore interface {
+	// PutObject stores data under key, replacing any existing object.
+	PutObject(ctx context.Context, key string, data []byte, contentType string) error
+
+	// GetObject returns the data stored under key, or an error wrapping ErrNotFound.
+	GetObject(ctx context.Context, key string) ([]byte, error)
 }
 
 // TSVDataStore is an interface for TSV-specific operations.
 type TSVDataStore interface {
-	DataStore
-	// WriteStations writes station data to a file.
-	WriteStations(stations *tfl.Stations) (string, error)
+	HistoricalDataStore
+	SnapshotWriter
 }
 
 // R2DataStore is an interface for R2-specific operations.
 type R2DataStore interface {
 	HistoricalDataStore
-	// WriteStations writes station data to R2.
-	WriteStations(ctx context.Context, stations *tfl.Stations) (string, error)
+	SnapshotWriter
 
 	// ListSnapshots returns all snapshot keys in R2.
 	ListSnapshots(ctx context.Context) ([]string, error)
 
 	// GetSnapshot downloads and parses a specific snapshot from R2.
 	GetSnapshot(ctx context.Context, key string) ([]tfl.Station, time.Time, error)
-
-	// GetSnapshotByTimestamp returns station data for a specific timestamp.
-	GetSnapshotByTimestamp(ctx context.Context, timestamp time.Time) ([]tfl.Station, error)
 }
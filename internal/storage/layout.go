@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Object stores keep snapshots under a date hierarchy,
+// {prefix}YYYY/MM/DD/stations_HHMMSS.tsv, so that a time range is listed a day,
+// month or year at a time instead of paging through the whole archive.
+// Snapshots written before the hierarchy, at {prefix}stations_YYYYMMDD_HHMMSS.tsv,
+// are still read until migrated with MigrateSnapshotKeys. Local snapshots keep
+// the flat layout: listing a directory is cheap.
+const (
+	datedKeyLayout  = "2006/01/02/stations_150405.tsv"
+	legacyKeyLayout = "stations_20060102_150405.tsv"
+)
+
+const (
+	// maxListPeriods is the most days, months or years a range listing is
+	// split into before falling back to listing everything.
+	maxListPeriods = 62
+	// legacyRecheckInterval is how long a store trusts its last check for
+	// flat-layout snapshots. Rechecking picks up keys that a collector not yet
+	// upgraded writes during a rollout.
+	legacyRecheckInterval = 10 * time.Minute
+)
+
+// datedSnapshotKey returns the key under prefix of a snapshot taken at timestamp.
+func datedSnapshotKey(prefix string, timestamp time.Time) string {
+	return prefix + timestamp.UTC().Format(datedKeyLayout)
+}
+
+// legacySnapshotKey returns the flat-layout key under prefix of a snapshot
+// taken at timestamp.
+func legacySnapshotKey(prefix string, timestamp time.Time) string {
+	return prefix + timestamp.UTC().Format(legacyKeyLayout)
+}
+
+// SnapshotName returns the file name identifying a snapshot taken at
+// timestamp in either layout, e.g. stations_20260205_145000.tsv, as the admin
+// API and CLI accept it.
+func SnapshotName(timestamp time.Time) string {
+	return timestamp.UTC().Format(legacyKeyLayout)
+}
+
+// legacyKeyOf returns the flat-layout key of the snapshot at the dated key,
+// if key is one.
+func legacyKeyOf(prefix, key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return "", false
+	}
+	ts, err := time.Parse(datedKeyLayout, rest)
+	if err != nil {
+		return "", false
+	}
+	return legacySnapshotKey(prefix, ts), true
+}
+
+// parseTimestampFromKey extracts the timestamp from a snapshot key or path in
+// either layout: {prefix}stations_YYYYMMDD_HHMMSS.tsv or
+// {prefix}YYYY/MM/DD/stations_HHMMSS.tsv.
+func parseTimestampFromKey(key string) (time.Time, error) {
+	dir, base := key, key
+	if i := strings.LastIndexAny(key, `/\`); i >= 0 {
+		dir, base = key[:i], key[i+1:]
+	}
+
+	idx := strings.Index(base, "stations_")
+	if idx == -1 {
+		return time.Time{}, fmt.Errorf("invalid key format: missing 'stations_' prefix")
+	}
+	stamp := base[idx+len("stations_"):]
+
+	// Flat layout: YYYYMMDD_HHMMSS
+	if len(stamp) >= 15 && stamp[8] == '_' {
+		return time.Parse("20060102_150405", stamp[:15])
+	}
+
+	// Dated layout: the date is the last three directories
+	if len(stamp) < 6 || len(dir) < len("2006/01/02") {
+		return time.Time{}, fmt.Errorf("invalid key format: timestamp too short")
+	}
+	date := strings.ReplaceAll(dir[len(dir)-len("2006/01/02"):], `\`, "/")
+	return time.Parse("2006/01/02 150405", date+" "+stamp[:6])
+}
+
+// sortSnapshotKeys orders keys newest first by the time in the key, across
+// both layouts and whatever order they were listed in. Snapshots taken the
+// same second, e.g. one not yet migrated and its dated copy, are ordered by
+// key so the result is deterministic. Keys that are not snapshots go last.
+func sortSnapshotKeys(keys []string) {
+	times := make(map[string]time.Time, len(keys))
+	for _, key := range keys {
+		if ts, err := parseTimestampFromKey(key); err == nil {
+			times[key] = ts
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := times[keys[i]], times[keys[j]]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return keys[i] > keys[j]
+	})
+}
+
+// keysInRange returns the snapshot keys taken in [from, to].
+func keysInRange(keys []string, from, to time.Time) []string {
+	var selected []string
+	for _, key := range keys {
+		if ts, err := parseTimestampFromKey(key); err == nil && inRange(ts, from, to) {
+			selected = append(selected, key)
+		}
+	}
+	return selected
+}
+
+// timestampsOfKeys returns the timestamps of the snapshot keys matching q,
+// newest first. They are taken from the key names; a key that does not carry
+// one is looked up with stamp, typically a metadata request.
+func timestampsOfKeys(ctx context.Context, keys []string, q TimestampQuery, stamp func(context.Context, string) (time.Time, error)) []time.Time {
+	timestamps := make([]time.Time, 0, len(keys))
+	for _, key := range keys {
+		ts, err := parseTimestampFromKey(key)
+		if err != nil {
+			if ts, err = stamp(ctx, key); err != nil {
+				slog.Debug("Skipping snapshot without a timestamp", "key", key, "error", err)
+				continue
+			}
+		}
+		timestamps = append(timestamps, ts)
+	}
+	return q.apply(timestamps)
+}
+
+// parseTimestampMetadata reads the timestamp recorded in a snapshot's metadata.
+func parseTimestampMetadata(key string, metadata map[string]string) (time.Time, error) {
+	v, ok := metadata[timestampMetadataKey]
+	if !ok {
+		return time.Time{}, fmt.Errorf("no timestamp in name or metadata of %s", key)
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// keyPeriod is a granularity of the date hierarchy: the dated and flat-layout
+// key prefixes of one period and how to step to the next.
+type keyPeriod struct {
+	dated  string
+	legacy string
+	start  func(time.Time) time.Time
+	next   func(time.Time) time.Time
+}
+
+// keyPeriods are tried finest first.
+var keyPeriods = []keyPeriod{
+	{
+		dated:  "2006/01/02/",
+		legacy: "stations_20060102",
+		start:  func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) },
+		next:   func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	},
+	{
+		dated:  "2006/01/",
+		legacy: "stations_200601",
+		start:  func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC) },
+		next:   func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	},
+	{
+		dated:  "2006/",
+		legacy: "stations_2006",
+		start:  func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC) },
+		next:   func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+	},
+}
+
+// rangePrefixes returns the key prefixes under prefix that together hold
+// every snapshot in [from, to], in the dated layout and, if legacy is set, the
+// flat one. It reports false when the range is open-ended or too long to
+// list piecemeal.
+func rangePrefixes(prefix string, from, to time.Time, legacy bool) ([]string, bool) {
+	if from.IsZero() || to.IsZero() {
+		return nil, false
+	}
+	from, to = from.UTC(), to.UTC()
+	if to.Before(from) {
+		return nil, true
+	}
+	for _, p := range keyPeriods {
+		var prefixes []string
+		n := 0
+		for t := p.start(from); !t.After(to) && n <= maxListPeriods; t = p.next(t) {
+			prefixes = append(prefixes, prefix+t.Format(p.dated))
+			if legacy {
+				prefixes = append(prefixes, prefix+t.Format(p.legacy))
+			}
+			n++
+		}
+		if n <= maxListPeriods {
+			return prefixes, true
+		}
+	}
+	return nil, false
+}
+
+// legacyKeys remembers whether a store still holds flat-layout snapshots.
+type legacyKeys struct {
+	mu      sync.Mutex
+	checked time.Time
+	present bool
+}
+
+// check reports whether flat-layout snapshots may exist, calling probe when
+// the last answer is older than legacyRecheckInterval. A failed probe assumes
+// they do, which costs extra listings but never hides a snapshot.
+func (l *legacyKeys) check(ctx context.Context, probe func(context.Context) (bool, error)) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.checked.IsZero() && time.Since(l.checked) < legacyRecheckInterval {
+		return l.present
+	}
+	present, err := probe(ctx)
+	if err != nil {
+		return true
+	}
+	l.present, l.checked = present, time.Now()
+	return present
+}
+
+// reset forgets the last answer, e.g. after a migration.
+func (l *legacyKeys) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.checked = time.Time{}
+}
+
+// KeyMigration is one snapshot moved from the flat layout to the date hierarchy.
+type KeyMigration struct {
+	From string
+	To   string
+}
+
+// KeyMigrator is implemented by stores whose snapshots can be moved from the
+// flat layout to the date hierarchy.
+type KeyMigrator interface {
+	// MigrateSnapshotKeys moves every flat-layout snapshot to its dated key,
+	// keeping its content and metadata, and calls fn after each. With dryRun
+	// it only reports what would move. Snapshots remain readable throughout.
+	MigrateSnapshotKeys(ctx context.Context, dryRun bool, fn func(KeyMigration)) error
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// flatSnapshotKeys returns the flat-layout snapshots under prefix, oldest
+// first, with the dated key each moves to.
+func flatSnapshotKeys(prefix string, keys []string) []KeyMigration {
+	sortSnapshotKeys(keys)
+	var moves []KeyMigration
+	for i := len(keys) - 1; i >= 0; i-- {
+		ts, err := parseTimestampFromKey(keys[i])
+		if err != nil || keys[i] != legacySnapshotKey(prefix, ts) {
+			continue
+		}
+		moves = append(moves, KeyMigration{From: keys[i], To: datedSnapshotKey(prefix, ts)})
+	}
+	return moves
+}
+
+// MigrateSnapshotKeys copies every flat-layout snapshot to its dated key with
+// its metadata, then deletes the original. A snapshot is never absent: it is
+// readable under its old key until the copy exists.
+func (r *R2Storage) MigrateSnapshotKeys(ctx context.Context, dryRun bool, fn func(KeyMigration)) error {
+	keys, err := r.listKeys(ctx, r.prefix+"stations_", 0)
+	if err != nil {
+		return err
+	}
+	defer r.legacy.reset()
+
+	for _, move := range flatSnapshotKeys(r.prefix, keys) {
+		if !dryRun {
+			_, err := r.client.CopyObject(ctx, &s3.CopyObjectInput{
+				Bucket:            aws.String(r.bucket),
+				Key:               aws.String(move.To),
+				CopySource:        aws.String(r.bucket + "/" + move.From),
+				MetadataDirective: types.MetadataDirectiveCopy,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to copy %s: %w", move.From, err)
+			}
+			_, err = r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(r.bucket),
+				Key:    aws.String(move.From),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete %s: %w", move.From, err)
+			}
+			slog.Debug("Migrated snapshot key", "from", move.From, "to", move.To)
+		}
+		if fn != nil {
+			fn(move)
+		}
+	}
+	return nil
+}
+
+// MigrateSnapshotKeys re-uploads every flat-layout snapshot blob under its
+// dated name with its metadata, then deletes the original. A snapshot is never
+// absent: it is readable under its old name until the copy exists.
+func (a *AzureBlobStorage) MigrateSnapshotKeys(ctx context.Context, dryRun bool, fn func(KeyMigration)) error {
+	keys, err := a.listKeys(ctx, a.prefix+"stations_", 0)
+	if err != nil {
+		return err
+	}
+	defer a.legacy.reset()
+
+	for _, move := range flatSnapshotKeys(a.prefix, keys) {
+		if !dryRun {
+			if err := a.moveBlob(ctx, move); err != nil {
+				return err
+			}
+			slog.Debug("Migrated snapshot key", "from", move.From, "to", move.To)
+		}
+		if fn != nil {
+			fn(move)
+		}
+	}
+	return nil
+}
+
+// moveBlob copies a blob's content, metadata and content type to a new name
+// and deletes the original.
+func (a *AzureBlobStorage) moveBlob(ctx context.Context, move KeyMigration) error {
+	result, err := a.client.DownloadStream(ctx, a.container, move.From, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", move.From, err)
+	}
+	data, err := io.ReadAll(result.Body)
+	result.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", move.From, err)
+	}
+
+	_, err = a.client.UploadBuffer(ctx, a.container, move.To, data, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: result.ContentType},
+		Metadata:    result.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", move.To, err)
+	}
+	if _, err := a.client.DeleteBlob(ctx, a.container, move.From, nil); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", move.From, err)
+	}
+	return nil
+}
+
+var (
+	_ KeyMigrator = (*R2Storage)(nil)
+	_ KeyMigrator = (*AzureBlobStorage)(nil)
+)
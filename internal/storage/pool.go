@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bufio"
+	"sync"
+
+	"city-cycling/internal/tfl"
+)
+
+const (
+	// tsvReaderSize is the buffer of the readers snapshots are parsed through,
+	// enough for any row; longer rows are still read, just not in place.
+	tsvReaderSize = 64 << 10
+	// maxInternedNames bounds the station names shared between parsed
+	// snapshots, several times any network's stations.
+	maxInternedNames = 16 << 10
+)
+
+// tsvReaders recycles the buffered readers snapshots are parsed through.
+var tsvReaders = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, tsvReaderSize) }}
+
+// stationSlices recycles the station slices of snapshots parsed only to be
+// aggregated, such as while building the history.
+var stationSlices sync.Pool
+
+// getStations returns an empty station slice with room for n stations,
+// reusing a released one when it is big enough.
+func getStations(n int) []tfl.Station {
+	if p, ok := stationSlices.Get().(*[]tfl.Station); ok {
+		if cap(*p) >= n {
+			return (*p)[:0]
+		}
+	}
+	return make([]tfl.Station, 0, n)
+}
+
+// releaseStations returns the stations of a parsed snapshot to the pool once
+// the caller is done with them. Nothing may use them afterwards.
+func releaseStations(stations []tfl.Station) {
+	if cap(stations) == 0 {
+		return
+	}
+	clear(stations[:cap(stations)])
+	stations = stations[:0]
+	stationSlices.Put(&stations)
+}
+
+// stationNames interns station names so the thousands of snapshots held in
+// caches share one copy of each name instead of one per snapshot.
+var stationNames = struct {
+	sync.RWMutex
+	names map[string]string
+}{names: make(map[string]string)}
+
+// internName returns the shared copy of the station name in field, a TSV
+// field that may still be escaped. field is not retained.
+func internName(field []byte) string {
+	stationNames.RLock()
+	name, ok := stationNames.names[string(field)]
+	stationNames.RUnlock()
+	if ok {
+		return name
+	}
+
+	raw := string(field)
+	name = unescapeTSVField(raw)
+	stationNames.Lock()
+	defer stationNames.Unlock()
+	if len(stationNames.names) < maxInternedNames {
+		stationNames.names[raw] = name
+	}
+	return name
+}
@@ -1,18 +1,21 @@
 package storage
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
+	"maps"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel/attribute"
 
+	"city-cycling/internal/telemetry"
 	"city-cycling/internal/tfl"
 )
 
@@ -21,6 +24,12 @@ type R2Storage struct {
 	client *s3.Client
 	bucket string
 	prefix string
+	// root is prepended to object keys (see WithRoot)
+	root string
+	// legacy tracks whether flat-layout snapshot keys remain
+	legacy *legacyKeys
+	// keys encrypts snapshots at rest when set (see SetEncryption)
+	keys *Keyring
 }
 
 // NewR2Storage creates a new R2 storage instance.
@@ -46,62 +55,58 @@ func NewR2Storage(accessKeyID, secretAccessKey, endpoint, bucket, region, prefix
 		client: client,
 		bucket: bucket,
 		prefix: prefix,
+		legacy: &legacyKeys{},
 	}, nil
 }
 
 // WriteStations writes station data to R2 as a timestamped TSV file.
 func (r *R2Storage) WriteStations(ctx context.Context, stations *tfl.Stations) (string, error) {
+	return r.WriteStationsAt(ctx, time.Now(), stations)
+}
+
+// WriteStationsAt writes station data as the snapshot taken at timestamp,
+// replacing any snapshot taken in the same second. It records demoted and
+// imported data under the time they were taken.
+func (r *R2Storage) WriteStationsAt(ctx context.Context, timestamp time.Time, stations *tfl.Stations) (_ string, err error) {
+	ctx, span := telemetry.Start(ctx, "r2.WriteStations", attribute.Int("stations", len(stations.Stations)))
+	defer telemetry.End(span, &err)
+
 	start := time.Now()
 	defer func() {
-		log.Printf("[R2] WriteStations completed in %s (stations=%d)", time.Since(start), len(stations.Stations))
+		slog.Info("R2 WriteStations completed", "duration", time.Since(start), "stations", len(stations.Stations))
 	}()
 
-	timestamp := time.Now().UTC()
-	key := fmt.Sprintf("%sstations_%s.tsv", r.prefix, timestamp.Format("20060102_150405"))
+	timestamp = timestamp.UTC()
+	key := r.SnapshotKey(timestamp)
 
 	// Build TSV content in memory
 	var buf bytes.Buffer
-	writer := bufio.NewWriter(&buf)
-
-	// Write header
-	if _, err := writer.WriteString(TSVHeader + "\n"); err != nil {
-		return "", fmt.Errorf("failed to write header: %w", err)
+	if err := encodeTSV(&buf, timestamp, stations.Stations); err != nil {
+		return "", err
 	}
-
-	// Write station data
 	tsStr := timestamp.Format(time.RFC3339)
-	for _, station := range stations.Stations {
-		line := fmt.Sprintf("%s\t%d\t%s\t%.6f\t%.6f\t%d\t%d\t%d\t%d\t%d\n",
-			tsStr,
-			station.ID,
-			strings.ReplaceAll(station.Name, "\t", " "), // Escape tabs in name
-			station.Lat,
-			station.Long,
-			station.NbBikes,
-			station.NbStandardBikes,
-			station.NbEBikes,
-			station.NbEmptyDocks,
-			station.NbDocks,
-		)
-		if _, err := writer.WriteString(line); err != nil {
-			return "", fmt.Errorf("failed to write station: %w", err)
-		}
+	checksum := checksumOf(buf.Bytes(), len(stations.Stations))
+
+	metadata := map[string]string{
+		timestampMetadataKey: tsStr,
+		rowsMetadataKey:      fmt.Sprintf("%d", checksum.Rows),
+		checksumMetadataKey:  checksum.SHA256,
 	}
+	maps.Copy(metadata, annotationMetadata(stations.Source, stations.Validation))
 
-	if err := writer.Flush(); err != nil {
-		return "", fmt.Errorf("failed to flush writer: %w", err)
+	// The checksum covers the plaintext, so it is verified after decryption
+	body, err := r.keys.seal(buf.Bytes())
+	if err != nil {
+		return "", err
 	}
 
 	// Upload to R2
-	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
+	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(r.bucket),
 		Key:         aws.String(key),
-		Body:        bytes.NewReader(buf.Bytes()),
-		ContentType: aws.String("text/tab-separated-values"),
-		Metadata: map[string]string{
-			"timestamp": tsStr,
-			"stations":  fmt.Sprintf("%d", len(stations.Stations)),
-		},
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(r.keys.contentType()),
+		Metadata:    metadata,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to upload to R2: %w", err)
@@ -110,17 +115,64 @@ func (r *R2Storage) WriteStations(ctx context.Context, stations *tfl.Stations) (
 	return key, nil
 }
 
-// ListSnapshots returns all snapshot objects in R2, sorted by timestamp (newest first).
-func (r *R2Storage) ListSnapshots(ctx context.Context) ([]string, error) {
+// ListSnapshots returns all snapshot objects in R2, in either key layout,
+// sorted by timestamp (newest first).
+func (r *R2Storage) ListSnapshots(ctx context.Context) (_ []string, err error) {
+	ctx, span := telemetry.Start(ctx, "r2.ListSnapshots")
+	defer telemetry.End(span, &err)
+
 	start := time.Now()
 	defer func() {
-		log.Printf("[R2] ListSnapshots completed in %s", time.Since(start))
+		slog.Info("R2 ListSnapshots completed", "duration", time.Since(start))
 	}()
 
-	paginator := s3.NewListObjectsV2Paginator(r.client, &s3.ListObjectsV2Input{
+	keys, err := r.listKeys(ctx, r.prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+	sortSnapshotKeys(keys)
+	return keys, nil
+}
+
+// ListSnapshotsRange returns the snapshots taken in [from, to], newest
+// first, listing only the days, months or years the range covers. Ranges too
+// long for that list everything.
+func (r *R2Storage) ListSnapshotsRange(ctx context.Context, from, to time.Time) (_ []string, err error) {
+	ctx, span := telemetry.Start(ctx, "r2.ListSnapshotsRange", rangeAttrs(from, to)...)
+	defer telemetry.End(span, &err)
+
+	prefixes, ok := rangePrefixes(r.prefix, from, to, r.legacy.check(ctx, r.probeLegacy))
+	if !ok {
+		keys, err := r.ListSnapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return keysInRange(keys, from, to), nil
+	}
+
+	var keys []string
+	for _, prefix := range prefixes {
+		listed, err := r.listKeys(ctx, prefix, 0)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, listed...)
+	}
+	keys = keysInRange(keys, from, to)
+	sortSnapshotKeys(keys)
+	return keys, nil
+}
+
+// listKeys returns the keys under prefix, at most limit of them if limit > 0.
+func (r *R2Storage) listKeys(ctx context.Context, prefix string, limit int32) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(r.bucket),
-		Prefix: aws.String(r.prefix),
-	})
+		Prefix: aws.String(prefix),
+	}
+	if limit > 0 {
+		input.MaxKeys = aws.Int32(limit)
+	}
+	paginator := s3.NewListObjectsV2Paginator(r.client, input)
 
 	var keys []string
 	for paginator.HasMorePages() {
@@ -128,31 +180,35 @@ func (r *R2Storage) ListSnapshots(ctx context.Context) ([]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to list objects: %w", err)
 		}
-
 		for _, obj := range result.Contents {
 			keys = append(keys, aws.ToString(obj.Key))
 		}
+		if limit > 0 && len(keys) >= int(limit) {
+			break
+		}
 	}
-
-	// Sort by key in descending order (newest first)
-	// Since format is "snapshots/stations_YYYYMMDD_HHMMSS.tsv", reverse alphabetical sort works
-	for i := len(keys)/2 - 1; i >= 0; i-- {
-		j := len(keys) - 1 - i
-		keys[i], keys[j] = keys[j], keys[i]
-	}
-
 	return keys, nil
 }
 
-// ReadLatestStations reads the most recent snapshot from R2.
-func (r *R2Storage) ReadLatestStations() ([]tfl.Station, time.Time, error) {
+// probeLegacy reports whether any flat-layout snapshot keys remain.
+func (r *R2Storage) probeLegacy(ctx context.Context) (bool, error) {
+	keys, err := r.listKeys(ctx, r.prefix+"stations_", 1)
+	return len(keys) > 0, err
+}
+
+// ReadLatestStations reads the most recent snapshot from R2, listing only the
+// last two days when they hold one.
+func (r *R2Storage) ReadLatestStations(ctx context.Context) ([]tfl.Station, time.Time, error) {
 	start := time.Now()
 	defer func() {
-		log.Printf("[R2] ReadLatestStations completed in %s", time.Since(start))
+		slog.Info("R2 ReadLatestStations completed", "duration", time.Since(start))
 	}()
 
-	ctx := context.Background()
-	keys, err := r.ListSnapshots(ctx)
+	now := time.Now().UTC()
+	keys, err := r.ListSnapshotsRange(ctx, now.AddDate(0, 0, -1), now)
+	if err == nil && len(keys) == 0 {
+		keys, err = r.ListSnapshots(ctx)
+	}
 	if err != nil {
 		return nil, time.Time{}, err
 	}
@@ -165,111 +221,95 @@ func (r *R2Storage) ReadLatestStations() ([]tfl.Station, time.Time, error) {
 	return r.GetSnapshot(ctx, keys[0])
 }
 
-// ListAvailableTimestamps returns all available snapshot timestamps from R2.
-func (r *R2Storage) ListAvailableTimestamps() ([]time.Time, error) {
-	ctx := context.Background()
-	keys, err := r.ListSnapshots(ctx)
+// ListAvailableTimestamps returns all available snapshot timestamps from R2,
+// newest first, taken from key names without downloading the snapshots.
+func (r *R2Storage) ListAvailableTimestamps(ctx context.Context) ([]time.Time, error) {
+	return r.ListTimestamps(ctx, TimestampQuery{})
+}
+
+// ListTimestamps returns the snapshot timestamps matching q, newest first,
+// listing only the days a bounded range covers. Keys without a timestamp in
+// their name, which only an open-ended listing finds as they cannot be placed
+// in the date hierarchy, fall back to the timestamp in the object's metadata.
+func (r *R2Storage) ListTimestamps(ctx context.Context, q TimestampQuery) ([]time.Time, error) {
+	var keys []string
+	var err error
+	if q.From.IsZero() || q.To.IsZero() {
+		keys, err = r.ListSnapshots(ctx)
+	} else {
+		keys, err = r.ListSnapshotsRange(ctx, q.From, q.To)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return timestampsOfKeys(ctx, keys, q, r.metadataTimestamp), nil
+}
 
-	var timestamps []time.Time
-	for _, key := range keys {
-		_, ts, err := r.GetSnapshot(ctx, key)
-		if err == nil {
-			timestamps = append(timestamps, ts)
-		}
+// metadataTimestamp reads the timestamp recorded in an object's metadata.
+func (r *R2Storage) metadataTimestamp(ctx context.Context, key string) (time.Time, error) {
+	head, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to head object: %w", err)
 	}
-
-	return timestamps, nil
+	return parseTimestampMetadata(key, head.Metadata)
 }
 
 // GetSnapshot downloads and parses a specific snapshot from R2.
-func (r *R2Storage) GetSnapshot(ctx context.Context, key string) ([]tfl.Station, time.Time, error) {
+func (r *R2Storage) GetSnapshot(ctx context.Context, key string) (_ []tfl.Station, _ time.Time, err error) {
+	ctx, span := telemetry.Start(ctx, "r2.GetSnapshot", attribute.String("key", key))
+	defer telemetry.End(span, &err)
+
 	start := time.Now()
 	defer func() {
-		log.Printf("[R2] GetSnapshot completed in %s (key=%s)", time.Since(start), key)
+		slog.Debug("R2 GetSnapshot completed", "duration", time.Since(start), "key", key)
 	}()
 
+	stations, timestamp, _, err := r.readSnapshot(ctx, key)
+	return stations, timestamp, err
+}
+
+// readSnapshot downloads and parses a snapshot, verifying it against the checksum
+// in its metadata when one was recorded. It reports whether it was verified.
+func (r *R2Storage) readSnapshot(ctx context.Context, key string) ([]tfl.Station, time.Time, bool, error) {
 	result, err := r.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(r.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return nil, time.Time{}, fmt.Errorf("failed to get object: %w", err)
+		return nil, time.Time{}, false, fmt.Errorf("failed to get object: %w", err)
 	}
 	defer result.Body.Close()
 
-	scanner := bufio.NewScanner(result.Body)
-
-	// Skip header
-	if !scanner.Scan() {
-		return nil, time.Time{}, fmt.Errorf("empty file")
+	var expected *snapshotChecksum
+	if c, ok := checksumFromMetadata(result.Metadata); ok {
+		expected = &c
 	}
-
-	var stations []tfl.Station
-	var timestamp time.Time
-	var firstRow = true
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Split(line, "\t")
-		if len(fields) < 10 {
-			continue
-		}
-
-		if firstRow {
-			timestamp, _ = time.Parse(time.RFC3339, fields[0])
-			firstRow = false
-		}
-
-		var (
-			id           int
-			lat, long    float64
-			nbBikes      int
-			nbStdBikes   int
-			nbEBikes     int
-			nbEmptyDocks int
-			nbDocks      int
-		)
-
-		fmt.Sscanf(fields[1], "%d", &id)
-		fmt.Sscanf(fields[3], "%f", &lat)
-		fmt.Sscanf(fields[4], "%f", &long)
-		fmt.Sscanf(fields[5], "%d", &nbBikes)
-		fmt.Sscanf(fields[6], "%d", &nbStdBikes)
-		fmt.Sscanf(fields[7], "%d", &nbEBikes)
-		fmt.Sscanf(fields[8], "%d", &nbEmptyDocks)
-		fmt.Sscanf(fields[9], "%d", &nbDocks)
-
-		stations = append(stations, tfl.Station{
-			ID:              id,
-			Name:            fields[2],
-			Lat:             lat,
-			Long:            long,
-			NbBikes:         nbBikes,
-			NbStandardBikes: nbStdBikes,
-			NbEBikes:        nbEBikes,
-			NbEmptyDocks:    nbEmptyDocks,
-			NbDocks:         nbDocks,
-		})
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, time.Time{}, fmt.Errorf("error reading file: %w", err)
+	body, _, err := r.keys.reader(result.Body)
+	if err != nil {
+		return nil, time.Time{}, false, err
 	}
-
-	return stations, timestamp, nil
+	return parseVerifiedTSV(body, key, expected)
 }
 
-// DeleteSnapshot deletes a specific snapshot from R2.
+// DeleteSnapshot deletes a specific snapshot from R2. Deleting a dated key
+// also deletes the snapshot's flat-layout key, as R2 does not say whether a
+// deleted key existed.
 func (r *R2Storage) DeleteSnapshot(ctx context.Context, key string) error {
-	_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(r.bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to delete object: %w", err)
+	keys := []string{key}
+	if legacy, ok := legacyKeyOf(r.prefix, key); ok {
+		keys = append(keys, legacy)
+	}
+	for _, k := range keys {
+		_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(r.bucket),
+			Key:    aws.String(k),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete object: %w", err)
+		}
 	}
 	return nil
 }
@@ -278,7 +318,7 @@ func (r *R2Storage) DeleteSnapshot(ctx context.Context, key string) error {
 func (r *R2Storage) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
 	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(r.bucket),
-		Key:         aws.String(key),
+		Key:         aws.String(r.root + key),
 		Body:        bytes.NewReader(data),
 		ContentType: aws.String(contentType),
 	})
@@ -288,13 +328,18 @@ func (r *R2Storage) PutObject(ctx context.Context, key string, data []byte, cont
 	return nil
 }
 
-// GetObjectACL retrieves the ACL of an object
+// GetObject downloads an object from R2. It returns an error wrapping ErrNotFound
+// if the key does not exist.
 func (r *R2Storage) GetObject(ctx context.Context, key string) ([]byte, error) {
 	result, err := r.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(r.bucket),
-		Key:    aws.String(key),
+		Key:    aws.String(r.root + key),
 	})
 	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
 		return nil, fmt.Errorf("failed to get object: %w", err)
 	}
 	defer result.Body.Close()
@@ -331,10 +376,13 @@ type HistoricalDataPoint struct {
 }
 
 // GetHistoricalData returns aggregate statistics for all available snapshots.
-func (r *R2Storage) GetHistoricalData(ctx context.Context) ([]HistoricalDataPoint, error) {
+func (r *R2Storage) GetHistoricalData(ctx context.Context) (_ []HistoricalDataPoint, err error) {
+	ctx, span := telemetry.Start(ctx, "r2.GetHistoricalData")
+	defer telemetry.End(span, &err)
+
 	start := time.Now()
 	defer func() {
-		log.Printf("[R2] GetHistoricalData completed in %s", time.Since(start))
+		slog.Info("R2 GetHistoricalData completed", "duration", time.Since(start))
 	}()
 
 	keys, err := r.ListSnapshots(ctx)
@@ -347,60 +395,48 @@ func (r *R2Storage) GetHistoricalData(ctx context.Context) ([]HistoricalDataPoin
 	for _, key := range keys {
 		stations, timestamp, err := r.GetSnapshot(ctx, key)
 		if err != nil {
-			log.Printf("Failed to read snapshot %s: %v", key, err)
+			slog.Error("Failed to read snapshot", "backend", "r2", "key", key, "error", err)
 			continue
 		}
 
-		// Calculate aggregates
-		totalBikes := 0
-		totalEBikes := 0
-		totalEmptyDocks := 0
-
-		for _, station := range stations {
-			totalBikes += station.NbBikes
-			totalEBikes += station.NbEBikes
-			totalEmptyDocks += station.NbEmptyDocks
-		}
-
-		dataPoints = append(dataPoints, HistoricalDataPoint{
-			Timestamp:       timestamp,
-			TotalBikes:      totalBikes,
-			TotalEBikes:     totalEBikes,
-			TotalEmptyDocks: totalEmptyDocks,
-			StationCount:    len(stations),
-		})
+		dataPoints = append(dataPoints, aggregateSnapshot(timestamp, stations))
+		releaseStations(stations)
 	}
 
 	return dataPoints, nil
 }
 
-// parseTimestampFromKey extracts the timestamp from a snapshot key.
-// Key format: {prefix}stations_YYYYMMDD_HHMMSS.tsv
-func parseTimestampFromKey(key string) (time.Time, error) {
-	// Find "stations_" and extract the timestamp portion
-	idx := strings.Index(key, "stations_")
-	if idx == -1 {
-		return time.Time{}, fmt.Errorf("invalid key format: missing 'stations_' prefix")
-	}
-
-	// Extract YYYYMMDD_HHMMSS portion (15 characters after "stations_")
-	tsStart := idx + len("stations_")
-	if len(key) < tsStart+15 {
-		return time.Time{}, fmt.Errorf("invalid key format: timestamp too short")
+// aggregateSnapshot computes the network-wide totals for a single snapshot.
+func aggregateSnapshot(timestamp time.Time, stations []tfl.Station) HistoricalDataPoint {
+	dp := HistoricalDataPoint{Timestamp: timestamp, StationCount: len(stations)}
+	for _, station := range stations {
+		dp.TotalBikes += station.NbBikes
+		dp.TotalEBikes += station.NbEBikes
+		dp.TotalEmptyDocks += station.NbEmptyDocks
 	}
+	return dp
+}
 
-	tsStr := key[tsStart : tsStart+15]
-	return time.Parse("20060102_150405", tsStr)
+// SnapshotTime returns the time a snapshot was taken from its key or local path,
+// as returned by WriteStations.
+func SnapshotTime(key string) (time.Time, error) {
+	return parseTimestampFromKey(key)
 }
 
 // GetSnapshotByTimestamp returns station data for the closest matching timestamp.
-func (r *R2Storage) GetSnapshotByTimestamp(ctx context.Context, targetTime time.Time) ([]tfl.Station, error) {
+func (r *R2Storage) GetSnapshotByTimestamp(ctx context.Context, targetTime time.Time) (_ []tfl.Station, err error) {
+	ctx, span := telemetry.Start(ctx, "r2.GetSnapshotByTimestamp", attribute.String("target", targetTime.Format(time.RFC3339)))
+	defer telemetry.End(span, &err)
+
 	start := time.Now()
 	defer func() {
-		log.Printf("[R2] GetSnapshotByTimestamp completed in %s (target=%s)", time.Since(start), targetTime.Format(time.RFC3339))
+		slog.Info("R2 GetSnapshotByTimestamp completed", "duration", time.Since(start), "target", targetTime.Format(time.RFC3339))
 	}()
 
-	keys, err := r.ListSnapshots(ctx)
+	keys, err := r.ListSnapshotsRange(ctx, targetTime.AddDate(0, 0, -1), targetTime.AddDate(0, 0, 1))
+	if err == nil && len(keys) == 0 {
+		keys, err = r.ListSnapshots(ctx)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to list snapshots: %w", err)
 	}
@@ -418,7 +454,7 @@ func (r *R2Storage) GetSnapshotByTimestamp(ctx context.Context, targetTime time.
 	for _, key := range keys {
 		timestamp, err := parseTimestampFromKey(key)
 		if err != nil {
-			log.Printf("[R2] Failed to parse timestamp from key %s: %v", key, err)
+			slog.Warn("Failed to parse timestamp from key", "key", key, "error", err)
 			continue
 		}
 
@@ -437,7 +473,7 @@ func (r *R2Storage) GetSnapshotByTimestamp(ctx context.Context, targetTime time.
 		return nil, fmt.Errorf("no matching snapshot found for timestamp")
 	}
 
-	log.Printf("[R2] GetSnapshotByTimestamp found closest key %s (diff=%s)", closestKey, closestDiff)
+	slog.Debug("R2 GetSnapshotByTimestamp found closest key", "key", closestKey, "diff", closestDiff)
 
 	stations, _, err := r.GetSnapshot(ctx, closestKey)
 	if err != nil {
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// WithRoot returns a view of store with every key, snapshots and auxiliary
+// objects alike, nested under root. It lets several cities share one data
+// directory, bucket or container: with root "manchester/" R2 snapshots live
+// under "manchester/snapshots/" and the collector lease under
+// "manchester/meta/". Roots nest: applied again, e.g. for a city of a tenant,
+// the new root goes inside the previous one. An empty root returns store
+// unchanged.
+func WithRoot(store DataStore, root string) (DataStore, error) {
+	if root == "" {
+		return store, nil
+	}
+	if !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+
+	switch s := store.(type) {
+	case *TSVStorage:
+		rooted := NewTSVStorage(filepath.Join(s.dataDir, filepath.FromSlash(root)))
+		rooted.keys = s.keys
+		return rooted, nil
+	case *R2Storage:
+		rooted := *s
+		rooted.root = s.root + root
+		rooted.prefix = s.root + root + strings.TrimPrefix(s.prefix, s.root)
+		rooted.legacy = &legacyKeys{}
+		return &rooted, nil
+	case *AzureBlobStorage:
+		rooted := *s
+		rooted.root = s.root + root
+		rooted.prefix = s.root + root + strings.TrimPrefix(s.prefix, s.root)
+		rooted.legacy = &legacyKeys{}
+		return &rooted, nil
+	case *FallbackStorage:
+		primary, err := WithRoot(s.primary, root)
+		if err != nil {
+			return nil, err
+		}
+		secondary, err := WithRoot(s.secondary, root)
+		if err != nil {
+			return nil, err
+		}
+		return NewFallbackStorage(primary, secondary)
+	}
+	return nil, fmt.Errorf("storage backend %T does not support key prefixes", store)
+}
+
+// BackendName names the kind of store behind store: "local", "r2" or "azure",
+// or "local+r2" and the like for a primary with a fallback.
+func BackendName(store DataStore) string {
+	switch s := store.(type) {
+	case *TSVStorage:
+		return "local"
+	case *R2Storage:
+		return "r2"
+	case *AzureBlobStorage:
+		return "azure"
+	case *FallbackStorage:
+		return BackendName(s.primary) + "+" + BackendName(s.secondary)
+	}
+	return fmt.Sprintf("%T", store)
+}
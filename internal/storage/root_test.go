@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWithRootNested checks that a root applied on top of another, as for a
+// city of a tenant, nests snapshots and other objects the same way.
+func TestWithRootNested(t *testing.T) {
+	ts := time.Date(2026, 2, 5, 14, 50, 0, 0, time.UTC)
+	stores := map[string]DataStore{
+		"r2":    &R2Storage{prefix: "snapshots/", legacy: &legacyKeys{}},
+		"azure": &AzureBlobStorage{prefix: "snapshots/", legacy: &legacyKeys{}},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			tenant, err := WithRoot(store, "group-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			city, err := WithRoot(tenant, "manchester/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var root, key string
+			switch s := city.(type) {
+			case *R2Storage:
+				root, key = s.root, s.SnapshotKey(ts)
+			case *AzureBlobStorage:
+				root, key = s.root, s.SnapshotKey(ts)
+			}
+			if want := "group-a/manchester/"; root != want {
+				t.Errorf("root = %q, want %q", root, want)
+			}
+			if want := "group-a/manchester/snapshots/2026/02/05/stations_145000.tsv"; key != want {
+				t.Errorf("snapshot key = %q, want %q", key, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"city-cycling/internal/telemetry"
+	"city-cycling/internal/tfl"
+)
+
+// Snapshot is the full set of station readings taken at one point in time.
+type Snapshot struct {
+	Timestamp time.Time
+	Stations  []tfl.Station
+}
+
+// RangeDataStore extends DataStore with ordered iteration over snapshots in a time range.
+// It is the basis for time-series aggregation.
+type RangeDataStore interface {
+	DataStore
+
+	// ForEachSnapshot calls fn for every snapshot with from <= timestamp <= to, oldest first.
+	// Iteration stops at the first error returned by fn.
+	ForEachSnapshot(ctx context.Context, from, to time.Time, fn func(Snapshot) error) error
+}
+
+// StationSample is a single station's readings at one point in time.
+type StationSample struct {
+	Timestamp       time.Time
+	NbBikes         int
+	NbStandardBikes int
+	NbEBikes        int
+	NbEmptyDocks    int
+	NbDocks         int
+}
+
+// StationSeries returns the readings for one station across all snapshots in [from, to].
+// Snapshots in which the station does not appear are skipped.
+func StationSeries(ctx context.Context, store RangeDataStore, stationID int, from, to time.Time) ([]StationSample, error) {
+	series, err := StationsSeries(ctx, store, []int{stationID}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return series[stationID], nil
+}
+
+// StationsSeries returns the readings for each of stationIDs across all
+// snapshots in [from, to], oldest first, reading the range once.
+func StationsSeries(ctx context.Context, store RangeDataStore, stationIDs []int, from, to time.Time) (map[int][]StationSample, error) {
+	series := make(map[int][]StationSample, len(stationIDs))
+	for _, id := range stationIDs {
+		series[id] = nil
+	}
+	err := store.ForEachSnapshot(ctx, from, to, func(snap Snapshot) error {
+		for _, s := range snap.Stations {
+			samples, ok := series[s.ID]
+			if !ok {
+				continue
+			}
+			series[s.ID] = append(samples, StationSample{
+				Timestamp:       snap.Timestamp,
+				NbBikes:         s.NbBikes,
+				NbStandardBikes: s.NbStandardBikes,
+				NbEBikes:        s.NbEBikes,
+				NbEmptyDocks:    s.NbEmptyDocks,
+				NbDocks:         s.NbDocks,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// HistoricalDataRange returns aggregate statistics for the snapshots in
+// [from, to], newest first, reading no snapshot outside the range.
+func HistoricalDataRange(ctx context.Context, store RangeDataStore, from, to time.Time) ([]HistoricalDataPoint, error) {
+	var points []HistoricalDataPoint
+	err := store.ForEachSnapshot(ctx, from, to, func(snap Snapshot) error {
+		points = append(points, aggregateSnapshot(snap.Timestamp, snap.Stations))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(points)
+	return points, nil
+}
+
+// NearestSnapshot returns the snapshot in [from, to] taken closest to target,
+// listing only the range and reading only that snapshot. It returns an error
+// wrapping ErrNotFound if the range holds none.
+func NearestSnapshot(ctx context.Context, store RangeDataStore, target, from, to time.Time) (Snapshot, error) {
+	timestamps, err := ListTimestamps(ctx, store, TimestampQuery{From: from, To: to})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var nearest time.Time
+	for _, ts := range timestamps {
+		if nearest.IsZero() || absDuration(ts.Sub(target)) < absDuration(nearest.Sub(target)) {
+			nearest = ts
+		}
+	}
+	if nearest.IsZero() {
+		return Snapshot{}, fmt.Errorf("%w: no snapshot between %s and %s", ErrNotFound, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	var (
+		snap  Snapshot
+		found bool
+	)
+	err = store.ForEachSnapshot(ctx, nearest, nearest, func(s Snapshot) error {
+		snap, found = s, true
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if !found {
+		return Snapshot{}, fmt.Errorf("failed to read snapshot at %s", nearest.Format(time.RFC3339))
+	}
+	return snap, nil
+}
+
+// absDuration returns the magnitude of d.
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// StationStats summarizes a station's occupancy over a window.
+type StationStats struct {
+	StationID      int
+	From           time.Time
+	To             time.Time
+	SampleCount    int
+	OccupancyRate  float64     // average fraction of docks holding a bike
+	PctEmpty       float64     // fraction of samples with no bikes
+	PctFull        float64     // fraction of samples with no empty docks
+	AvgBikes       float64     // average bikes across all samples
+	AvgByHour      [24]float64 // average bikes by local hour of day
+	AvgByWeekday   [7]float64  // average bikes by local day of week, Sunday first
+	HourSamples    [24]int
+	WeekdaySamples [7]int
+}
+
+// ComputeStationStats aggregates a station series into occupancy statistics.
+// Hour-of-day and day-of-week buckets follow the wall clock in loc, so a
+// morning peak stays at the same hour across daylight saving changes.
+func ComputeStationStats(stationID int, from, to time.Time, samples []StationSample, loc *time.Location) *StationStats {
+	stats := &StationStats{
+		StationID:   stationID,
+		From:        from,
+		To:          to,
+		SampleCount: len(samples),
+	}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	var (
+		occupancySum   float64
+		occupancyCount int
+		bikesSum       int
+		empty, full    int
+		hourSums       [24]int
+		weekdaySums    [7]int
+	)
+
+	for _, s := range samples {
+		if s.NbDocks > 0 {
+			occupancySum += float64(s.NbBikes) / float64(s.NbDocks)
+			occupancyCount++
+		}
+		if s.NbBikes == 0 {
+			empty++
+		}
+		if s.NbEmptyDocks == 0 {
+			full++
+		}
+		bikesSum += s.NbBikes
+
+		ts := s.Timestamp.In(loc)
+		hourSums[ts.Hour()] += s.NbBikes
+		stats.HourSamples[ts.Hour()]++
+		weekdaySums[ts.Weekday()] += s.NbBikes
+		stats.WeekdaySamples[ts.Weekday()]++
+	}
+
+	n := float64(len(samples))
+	if occupancyCount > 0 {
+		stats.OccupancyRate = occupancySum / float64(occupancyCount)
+	}
+	stats.PctEmpty = float64(empty) / n
+	stats.PctFull = float64(full) / n
+	stats.AvgBikes = float64(bikesSum) / n
+
+	for h := range hourSums {
+		if stats.HourSamples[h] > 0 {
+			stats.AvgByHour[h] = float64(hourSums[h]) / float64(stats.HourSamples[h])
+		}
+	}
+	for d := range weekdaySums {
+		if stats.WeekdaySamples[d] > 0 {
+			stats.AvgByWeekday[d] = float64(weekdaySums[d]) / float64(stats.WeekdaySamples[d])
+		}
+	}
+
+	return stats
+}
+
+// ForEachSnapshot reads every local snapshot in [from, to], oldest first.
+func (s *TSVStorage) ForEachSnapshot(ctx context.Context, from, to time.Time, fn func(Snapshot) error) (err error) {
+	ctx, span := telemetry.Start(ctx, "tsv.ForEachSnapshot", rangeAttrs(from, to)...)
+	defer telemetry.End(span, &err)
+
+	files, err := s.listTSVFiles()
+	if err != nil {
+		return err
+	}
+
+	// listTSVFiles returns newest first; iterate oldest first
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ts, err := s.parseFilenameTimestamp(files[i])
+		if err != nil || !inRange(ts, from, to) {
+			continue
+		}
+
+		stations, timestamp, err := s.readTSVFile(files[i])
+		if err != nil {
+			slog.Error("Failed to read snapshot", "backend", "tsv", "key", filepath.Base(files[i]), "error", err)
+			continue
+		}
+		if timestamp.IsZero() {
+			timestamp = ts
+		}
+
+		if err := fn(Snapshot{Timestamp: timestamp, Stations: stations}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachSnapshot downloads every R2 snapshot in [from, to], oldest first.
+// Only the days the range covers are listed, and timestamps are taken from key
+// names so snapshots outside the range are never downloaded.
+func (r *R2Storage) ForEachSnapshot(ctx context.Context, from, to time.Time, fn func(Snapshot) error) (err error) {
+	ctx, span := telemetry.Start(ctx, "r2.ForEachSnapshot", rangeAttrs(from, to)...)
+	defer telemetry.End(span, &err)
+
+	keys, err := r.ListSnapshotsRange(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	type keyed struct {
+		key string
+		ts  time.Time
+	}
+	var selected []keyed
+	for _, key := range keys {
+		ts, err := parseTimestampFromKey(key)
+		if err != nil || !inRange(ts, from, to) {
+			continue
+		}
+		selected = append(selected, keyed{key: key, ts: ts})
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].ts.Before(selected[j].ts) })
+
+	for _, k := range selected {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		stations, timestamp, err := r.GetSnapshot(ctx, k.key)
+		if err != nil {
+			slog.Error("Failed to read snapshot", "backend", "r2", "key", k.key, "error", err)
+			continue
+		}
+		if timestamp.IsZero() {
+			timestamp = k.ts
+		}
+
+		if err := fn(Snapshot{Timestamp: timestamp, Stations: stations}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeAttrs describes a [from, to] query as span attributes.
+func rangeAttrs(from, to time.Time) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("from", from.Format(time.RFC3339)),
+		attribute.String("to", to.Format(time.RFC3339)),
+	}
+}
+
+// inRange reports whether ts is within [from, to]. A zero bound is unbounded.
+func inRange(ts, from, to time.Time) bool {
+	if !from.IsZero() && ts.Before(from) {
+		return false
+	}
+	if !to.IsZero() && ts.After(to) {
+		return false
+	}
+	return true
+}
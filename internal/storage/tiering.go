@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+// TierIndexKey is the object key, in the hot store, of the index recording
+// which snapshots have been demoted to the cold store.
+const TierIndexKey = "meta/tiers.json"
+
+// tierIndexRecheckInterval is how long readers trust the tier index before
+// reading it again, so demotions by another process are picked up.
+const tierIndexRecheckInterval = time.Minute
+
+// TierIndex records where each range of snapshots lives in a FallbackStorage
+// used as hot and cold tiers.
+type TierIndex struct {
+	// Boundary is the time before which the hot store holds no snapshots:
+	// earlier ones have been demoted to the cold store.
+	Boundary time.Time `json:"boundary"`
+	// UpdatedAt is when the last demotion finished.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DemotionReport describes a run of Demote.
+type DemotionReport struct {
+	Before   time.Time
+	Boundary time.Time
+	Demoted  int
+	// Skipped lists the snapshots left in the hot store because they failed
+	// to re-read cleanly, with the reason.
+	Skipped map[string]string
+}
+
+// tierIndexCache remembers the tier index between reads.
+type tierIndexCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	index   TierIndex
+}
+
+// boundary returns the tier boundary, reading the index from the hot store
+// when the last read is older than tierIndexRecheckInterval. Without an
+// index, or when it cannot be read, it returns the zero time, which makes
+// every read consult both stores: slower, but never hiding a snapshot.
+func (f *FallbackStorage) boundary(ctx context.Context) time.Time {
+	f.tiers.mu.Lock()
+	defer f.tiers.mu.Unlock()
+	if !f.tiers.checked.IsZero() && time.Since(f.tiers.checked) < tierIndexRecheckInterval {
+		return f.tiers.index.Boundary
+	}
+
+	data, err := f.primary.GetObject(ctx, TierIndexKey)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			slog.Warn("Failed to read tier index", "key", TierIndexKey, "error", err)
+			return time.Time{}
+		}
+		f.tiers.index, f.tiers.checked = TierIndex{}, time.Now()
+		return time.Time{}
+	}
+	var index TierIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		slog.Warn("Failed to parse tier index", "key", TierIndexKey, "error", err)
+		return time.Time{}
+	}
+	f.tiers.index, f.tiers.checked = index, time.Now()
+	return index.Boundary
+}
+
+// Demote moves every snapshot taken before the given time from the hot
+// (primary) store to the cold (secondary) one, then records the new boundary
+// in the tier index. Each snapshot is re-read and verified, written to the
+// cold store under the time it was taken, and only then deleted from the hot
+// store, so an interrupted run loses nothing and can simply be run again.
+// Snapshots that fail to re-read are left in place and hold the boundary
+// back.
+func (f *FallbackStorage) Demote(ctx context.Context, before time.Time) (*DemotionReport, error) {
+	keys, err := f.primary.ListSnapshotsRange(ctx, time.Time{}, before.Add(-time.Nanosecond))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots to demote: %w", err)
+	}
+
+	report := &DemotionReport{Before: before, Boundary: before, Skipped: make(map[string]string)}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		timestamp, err := parseTimestampFromKey(key)
+		if err != nil {
+			continue
+		}
+
+		stations, problem, err := f.rereadSnapshot(ctx, key)
+		if err != nil {
+			return report, err
+		}
+		if problem != "" {
+			report.Skipped[key] = problem
+			if timestamp.Before(report.Boundary) {
+				report.Boundary = timestamp
+			}
+			continue
+		}
+
+		if _, err := f.secondary.WriteStationsAt(ctx, timestamp, stations); err != nil {
+			return report, fmt.Errorf("failed to demote snapshot %s: %w", key, err)
+		}
+		if err := f.primary.DeleteSnapshot(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+			return report, fmt.Errorf("failed to delete demoted snapshot %s: %w", key, err)
+		}
+		report.Demoted++
+	}
+
+	index := TierIndex{Boundary: report.Boundary, UpdatedAt: time.Now().UTC()}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return report, fmt.Errorf("failed to encode tier index: %w", err)
+	}
+	if err := f.primary.PutObject(ctx, TierIndexKey, data, "application/json"); err != nil {
+		return report, fmt.Errorf("failed to record tier index: %w", err)
+	}
+	f.tiers.mu.Lock()
+	f.tiers.index, f.tiers.checked = index, time.Now()
+	f.tiers.mu.Unlock()
+	return report, nil
+}
+
+// rereadSnapshot reads a hot snapshot for demotion, keeping the collector's
+// annotations. It returns a problem instead of the stations if the snapshot
+// does not match its checksum or has malformed rows.
+func (f *FallbackStorage) rereadSnapshot(ctx context.Context, key string) (*tfl.Stations, string, error) {
+	inspection, err := f.primary.InspectSnapshot(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, "deleted during demotion", nil
+		}
+		return nil, "", fmt.Errorf("failed to read snapshot %s: %w", key, err)
+	}
+	switch {
+	case inspection.Checksum != "" && !inspection.Verified:
+		return nil, "checksum mismatch: " + inspection.VerifyError, nil
+	case inspection.Parse.Malformed > 0:
+		return nil, fmt.Sprintf("%d malformed rows", inspection.Parse.Malformed), nil
+	case len(inspection.Stations) == 0:
+		return nil, "no station rows", nil
+	}
+	return &tfl.Stations{
+		Stations:   inspection.Stations,
+		Source:     inspection.Source,
+		Validation: validationFromSummary(inspection.Validation),
+	}, "", nil
+}
+
+// validationFromSummary rebuilds a validation result from its Summary, as
+// recorded with a snapshot, or returns nil for a snapshot without one.
+func validationFromSummary(summary string) *tfl.Validation {
+	if summary == "" {
+		return nil
+	}
+	if summary == "passed" {
+		return &tfl.Validation{Passed: true}
+	}
+	issues, _ := strings.CutPrefix(summary, "failed: ")
+	return &tfl.Validation{Issues: strings.Split(issues, "; ")}
+}
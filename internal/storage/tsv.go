@@ -1,26 +1,27 @@
 package storage
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
-	"city-cycling/internal/tfl"
-)
+	"go.opentelemetry.io/otel/attribute"
 
-const (
-	// TSVHeader defines the column headers for the TSV file.
-	TSVHeader = "timestamp\tid\tname\tlat\tlong\tnb_bikes\tnb_standard_bikes\tnb_ebikes\tnb_empty_docks\tnb_docks"
+	"city-cycling/internal/telemetry"
+	"city-cycling/internal/tfl"
 )
 
 // TSVStorage handles reading and writing station data to TSV files.
 type TSVStorage struct {
 	dataDir string
+	// keys encrypts snapshots at rest when set (see SetEncryption)
+	keys *Keyring
 }
 
 // NewTSVStorage creates a new TSV storage instance.
@@ -29,57 +30,57 @@ func NewTSVStorage(dataDir string) *TSVStorage {
 }
 
 // WriteStations writes station data to a timestamped TSV file.
-func (s *TSVStorage) WriteStations(stations *tfl.Stations) (string, error) {
+func (s *TSVStorage) WriteStations(ctx context.Context, stations *tfl.Stations) (string, error) {
+	return s.WriteStationsAt(ctx, time.Now(), stations)
+}
+
+// WriteStationsAt writes station data as the snapshot taken at timestamp,
+// replacing any snapshot taken in the same second. It records fixtures and
+// imported data under the time they were taken.
+func (s *TSVStorage) WriteStationsAt(ctx context.Context, timestamp time.Time, stations *tfl.Stations) (_ string, err error) {
+	_, span := telemetry.Start(ctx, "tsv.WriteStations", attribute.Int("stations", len(stations.Stations)))
+	defer telemetry.End(span, &err)
+
 	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	timestamp := time.Now().UTC()
+	timestamp = timestamp.UTC().Truncate(time.Second)
 	filename := fmt.Sprintf("stations_%s.tsv", timestamp.Format("20060102_150405"))
 	filepath := filepath.Join(s.dataDir, filename)
 
-	file, err := os.Create(filepath)
+	var buf bytes.Buffer
+	if err := encodeTSV(&buf, timestamp, stations.Stations); err != nil {
+		return "", err
+	}
+	body, err := s.keys.seal(buf.Bytes())
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		return "", err
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-
-	// Write header
-	if _, err := writer.WriteString(TSVHeader + "\n"); err != nil {
-		return "", fmt.Errorf("failed to write header: %w", err)
-	}
-
-	// Write station data
-	tsStr := timestamp.Format(time.RFC3339)
-	for _, station := range stations.Stations {
-		line := fmt.Sprintf("%s\t%d\t%s\t%.6f\t%.6f\t%d\t%d\t%d\t%d\t%d\n",
-			tsStr,
-			station.ID,
-			strings.ReplaceAll(station.Name, "\t", " "), // Escape tabs in name
-			station.Lat,
-			station.Long,
-			station.NbBikes,
-			station.NbStandardBikes,
-			station.NbEBikes,
-			station.NbEmptyDocks,
-			station.NbDocks,
-		)
-		if _, err := writer.WriteString(line); err != nil {
-			return "", fmt.Errorf("failed to write station: %w", err)
-		}
+	// Write to a temporary file and rename so a crash never leaves a truncated snapshot
+	err = writeFileAtomic(filepath, func(w io.Writer) error {
+		_, err := w.Write(body)
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
-
-	if err := writer.Flush(); err != nil {
-		return "", fmt.Errorf("failed to flush writer: %w", err)
+	checksum := checksumOf(buf.Bytes(), len(stations.Stations))
+	checksum.Source = stations.Source
+	checksum.Validation = stations.Validation
+	if err := writeChecksumSidecar(filepath, checksum); err != nil {
+		return "", err
 	}
 
 	return filepath, nil
 }
 
 // ReadLatestStations reads the most recent TSV file and returns the stations.
-func (s *TSVStorage) ReadLatestStations() ([]tfl.Station, time.Time, error) {
+func (s *TSVStorage) ReadLatestStations(ctx context.Context) ([]tfl.Station, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
 	files, err := s.listTSVFiles()
 	if err != nil {
 		return nil, time.Time{}, err
@@ -94,7 +95,10 @@ func (s *TSVStorage) ReadLatestStations() ([]tfl.Station, time.Time, error) {
 }
 
 // ListAvailableTimestamps returns all timestamps for which data is available.
-func (s *TSVStorage) ListAvailableTimestamps() ([]time.Time, error) {
+func (s *TSVStorage) ListAvailableTimestamps(ctx context.Context) ([]time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	files, err := s.listTSVFiles()
 	if err != nil {
 		return nil, err
@@ -111,6 +115,81 @@ func (s *TSVStorage) ListAvailableTimestamps() ([]time.Time, error) {
 	return timestamps, nil
 }
 
+// GetHistoricalData returns aggregate statistics for all local snapshots, newest first.
+func (s *TSVStorage) GetHistoricalData(ctx context.Context) (_ []HistoricalDataPoint, err error) {
+	_, span := telemetry.Start(ctx, "tsv.GetHistoricalData")
+	defer telemetry.End(span, &err)
+
+	files, err := s.listTSVFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var dataPoints []HistoricalDataPoint
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		stations, timestamp, err := s.readTSVFile(file)
+		if err != nil {
+			slog.Error("Failed to read snapshot", "backend", "tsv", "key", filepath.Base(file), "error", err)
+			continue
+		}
+		if timestamp.IsZero() {
+			if timestamp, err = s.parseFilenameTimestamp(file); err != nil {
+				releaseStations(stations)
+				continue
+			}
+		}
+
+		dataPoints = append(dataPoints, aggregateSnapshot(timestamp, stations))
+		releaseStations(stations)
+	}
+
+	return dataPoints, nil
+}
+
+// GetSnapshotByTimestamp returns station data from the local snapshot closest to targetTime.
+// Timestamps are taken from filenames so only the matching file is read.
+func (s *TSVStorage) GetSnapshotByTimestamp(ctx context.Context, targetTime time.Time) (_ []tfl.Station, err error) {
+	_, span := telemetry.Start(ctx, "tsv.GetSnapshotByTimestamp", attribute.String("target", targetTime.Format(time.RFC3339)))
+	defer telemetry.End(span, &err)
+
+	files, err := s.listTSVFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var closestFile string
+	closestDiff := time.Duration(1<<63 - 1) // Max duration
+	for _, file := range files {
+		ts, err := s.parseFilenameTimestamp(file)
+		if err != nil {
+			continue
+		}
+
+		diff := ts.Sub(targetTime)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < closestDiff {
+			closestDiff = diff
+			closestFile = file
+		}
+	}
+
+	if closestFile == "" {
+		return nil, fmt.Errorf("no snapshots available")
+	}
+
+	stations, _, err := s.readTSVFile(closestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return stations, nil
+}
+
 // listTSVFiles returns TSV files sorted by timestamp (newest first).
 func (s *TSVStorage) listTSVFiles() ([]string, error) {
 	entries, err := os.ReadDir(s.dataDir)
@@ -128,8 +207,7 @@ func (s *TSVStorage) listTSVFiles() ([]string, error) {
 		}
 	}
 
-	// Sort by filename (which contains timestamp) in descending order
-	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	sortSnapshotKeys(files)
 
 	return files, nil
 }
@@ -142,61 +220,28 @@ func (s *TSVStorage) parseFilenameTimestamp(filepath string) (time.Time, error)
 }
 
 // readTSVFile reads a TSV file and returns the stations.
-func (s *TSVStorage) readTSVFile(filepath string) ([]tfl.Station, time.Time, error) {
-	file, err := os.Open(filepath)
+func (s *TSVStorage) readTSVFile(path string) ([]tfl.Station, time.Time, error) {
+	stations, timestamp, _, err := s.readSnapshotFile(path)
+	return stations, timestamp, err
+}
+
+// readSnapshotFile reads a TSV file, verifying it against its checksum sidecar
+// when one exists. It reports whether the file was verified.
+func (s *TSVStorage) readSnapshotFile(path string) ([]tfl.Station, time.Time, bool, error) {
+	expected, err := readChecksumSidecar(path)
 	if err != nil {
-		return nil, time.Time{}, fmt.Errorf("failed to open file: %w", err)
+		return nil, time.Time{}, false, err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
 
-	// Skip header
-	if !scanner.Scan() {
-		return nil, time.Time{}, fmt.Errorf("empty file")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
-	var stations []tfl.Station
-	var timestamp time.Time
-	var firstRow = true
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Split(line, "\t")
-		if len(fields) < 10 {
-			continue
-		}
-
-		if firstRow {
-			timestamp, _ = time.Parse(time.RFC3339, fields[0])
-			firstRow = false
-		}
-
-		id, _ := strconv.Atoi(fields[1])
-		lat, _ := strconv.ParseFloat(fields[3], 64)
-		long, _ := strconv.ParseFloat(fields[4], 64)
-		nbBikes, _ := strconv.Atoi(fields[5])
-		nbStandardBikes, _ := strconv.Atoi(fields[6])
-		nbEBikes, _ := strconv.Atoi(fields[7])
-		nbEmptyDocks, _ := strconv.Atoi(fields[8])
-		nbDocks, _ := strconv.Atoi(fields[9])
-
-		stations = append(stations, tfl.Station{
-			ID:              id,
-			Name:            fields[2],
-			Lat:             lat,
-			Long:            long,
-			NbBikes:         nbBikes,
-			NbStandardBikes: nbStandardBikes,
-			NbEBikes:        nbEBikes,
-			NbEmptyDocks:    nbEmptyDocks,
-			NbDocks:         nbDocks,
-		})
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, time.Time{}, fmt.Errorf("error reading file: %w", err)
-	}
-
-	return stations, timestamp, nil
+	body, _, err := s.keys.reader(file)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return parseVerifiedTSV(body, filepath.Base(path), expected)
 }
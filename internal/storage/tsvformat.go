@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+const (
+	// TSVHeader defines the column headers for the TSV file.
+	TSVHeader = "timestamp\tid\tname\tlat\tlong\tnb_bikes\tnb_standard_bikes\tnb_ebikes\tnb_empty_docks\tnb_docks"
+
+	// tsvColumns is the number of fields in a snapshot row.
+	tsvColumns = 10
+	// maxReportedLines caps how many malformed lines a ParseReport lists individually.
+	maxReportedLines = 10
+)
+
+// MalformedLine describes a snapshot row that could not be parsed.
+type MalformedLine struct {
+	Line   int
+	Reason string
+}
+
+// ParseReport summarises a snapshot parse.
+type ParseReport struct {
+	Rows      int
+	Malformed int
+	// Lines lists the first malformed lines encountered.
+	Lines []MalformedLine
+}
+
+// lineNumbers returns the line numbers listed in the report.
+func (p ParseReport) lineNumbers() []int {
+	nums := make([]int, len(p.Lines))
+	for i, l := range p.Lines {
+		nums[i] = l.Line
+	}
+	return nums
+}
+
+// tsvEscaper escapes characters that would break the row layout. Backslash is
+// escaped first so escaped names round-trip exactly.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// escapeTSVField escapes a free-text field for writing.
+func escapeTSVField(s string) string {
+	return tsvEscaper.Replace(s)
+}
+
+// unescapeTSVField reverses escapeTSVField. Unknown escapes are kept as-is.
+func unescapeTSVField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// encodeTSV writes a snapshot taken at timestamp in the TSV snapshot format.
+func encodeTSV(w io.Writer, timestamp time.Time, stations []tfl.Station) error {
+	writer := bufio.NewWriter(w)
+
+	// Write header
+	if _, err := writer.WriteString(TSVHeader + "\n"); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if err := EncodeTSVRows(writer, timestamp, stations); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush writer: %w", err)
+	}
+	return nil
+}
+
+// EncodeTSVRows writes the rows of a snapshot taken at timestamp in the TSV
+// snapshot format without the header, so several snapshots can share one
+// TSVHeader line.
+func EncodeTSVRows(w io.Writer, timestamp time.Time, stations []tfl.Station) error {
+	tsStr := timestamp.Format(time.RFC3339)
+	for _, station := range stations {
+		_, err := fmt.Fprintf(w, "%s\t%d\t%s\t%.6f\t%.6f\t%d\t%d\t%d\t%d\t%d\n",
+			tsStr,
+			station.ID,
+			escapeTSVField(station.Name),
+			station.Lat,
+			station.Long,
+			station.NbBikes,
+			station.NbStandardBikes,
+			station.NbEBikes,
+			station.NbEmptyDocks,
+			station.NbDocks,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to write station: %w", err)
+		}
+	}
+	return nil
+}
+
+// decodeTSV streams TSV snapshot content and returns the stations and snapshot
+// timestamp. Malformed rows are skipped and described in the report. rows is
+// the number of stations expected, when known, so the slice is allocated once.
+// Rows are parsed in place in a pooled buffer, so a well-formed row costs no
+// allocation beyond its share of the stations slice.
+func decodeTSV(r io.Reader, rows int) ([]tfl.Station, time.Time, ParseReport, error) {
+	var report ParseReport
+	reader := tsvReaders.Get().(*bufio.Reader)
+	reader.Reset(r)
+	defer func() {
+		reader.Reset(nil)
+		tsvReaders.Put(reader)
+	}()
+
+	// Skip header
+	var long []byte
+	header, err := readTSVLine(reader, &long)
+	if err != nil && err != io.EOF {
+		return nil, time.Time{}, report, fmt.Errorf("error reading file: %w", err)
+	}
+	if len(header) == 0 {
+		return nil, time.Time{}, report, fmt.Errorf("empty file")
+	}
+
+	stations := getStations(rows)
+	var timestamp time.Time
+	var parser tsvRowParser
+
+	for lineNum := 2; ; lineNum++ {
+		line, err := readTSVLine(reader, &long)
+		if err != nil && err != io.EOF {
+			releaseStations(stations)
+			return nil, time.Time{}, report, fmt.Errorf("error reading file: %w", err)
+		}
+		eof := err == io.EOF
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > 0 {
+			station, ts, perr := parser.parse(line)
+			if perr != nil {
+				report.Malformed++
+				if len(report.Lines) < maxReportedLines {
+					report.Lines = append(report.Lines, MalformedLine{Line: lineNum, Reason: perr.Error()})
+				}
+			} else {
+				if timestamp.IsZero() {
+					timestamp = ts
+				}
+				stations = append(stations, station)
+				report.Rows++
+			}
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	return stations, timestamp, report, nil
+}
+
+// readTSVLine returns the next line from reader, including its newline. The
+// line is only valid until the next read: it is reader's buffer, or long for
+// a line that does not fit in it.
+func readTSVLine(reader *bufio.Reader, long *[]byte) ([]byte, error) {
+	line, err := reader.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+	*long = append((*long)[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = reader.ReadSlice('\n')
+		*long = append(*long, line...)
+	}
+	return *long, err
+}
+
+// tsvRowParser parses the rows of one snapshot, which all share a timestamp:
+// it is parsed once and reused while rows repeat it.
+type tsvRowParser struct {
+	lastTimestamp []byte
+	timestamp     time.Time
+}
+
+// parse parses a single snapshot row without its line ending. line is not
+// retained.
+func (p *tsvRowParser) parse(line []byte) (tfl.Station, time.Time, error) {
+	var fields [tsvColumns][]byte
+	n := 0
+	for rest := line; ; n++ {
+		i := bytes.IndexByte(rest, '\t')
+		if n < tsvColumns {
+			if i < 0 {
+				fields[n] = rest
+			} else {
+				fields[n] = rest[:i]
+			}
+		}
+		if i < 0 {
+			n++
+			break
+		}
+		rest = rest[i+1:]
+	}
+	if n != tsvColumns {
+		return tfl.Station{}, time.Time{}, fmt.Errorf("expected %d fields, got %d", tsvColumns, n)
+	}
+
+	if p.lastTimestamp == nil || !bytes.Equal(fields[0], p.lastTimestamp) {
+		ts, err := time.Parse(time.RFC3339, string(fields[0]))
+		if err != nil {
+			return tfl.Station{}, time.Time{}, fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		p.lastTimestamp = append(p.lastTimestamp[:0], fields[0]...)
+		p.timestamp = ts
+	}
+
+	// Conversions of fields to strings for strconv do not escape, so they
+	// do not allocate
+	var bad []int
+	atoi := func(i int) int {
+		v, err := strconv.Atoi(string(fields[i]))
+		if err != nil {
+			bad = append(bad, i)
+		}
+		return v
+	}
+	parseFloat := func(i int) float64 {
+		v, err := strconv.ParseFloat(string(fields[i]), 64)
+		if err != nil {
+			bad = append(bad, i)
+		}
+		return v
+	}
+	station := tfl.Station{
+		ID:              atoi(1),
+		Lat:             parseFloat(3),
+		Long:            parseFloat(4),
+		NbBikes:         atoi(5),
+		NbStandardBikes: atoi(6),
+		NbEBikes:        atoi(7),
+		NbEmptyDocks:    atoi(8),
+		NbDocks:         atoi(9),
+	}
+	if len(bad) > 0 {
+		errs := make([]error, len(bad))
+		for j, i := range bad {
+			errs[j] = fmt.Errorf("invalid %s %q", tsvFieldNames[i], fields[i])
+		}
+		return tfl.Station{}, time.Time{}, errors.Join(errs...)
+	}
+	station.Name = internName(fields[2])
+	return station, p.timestamp, nil
+}
+
+// tsvFieldNames names the snapshot columns in parse errors.
+var tsvFieldNames = [tsvColumns]string{"timestamp", "id", "name", "lat", "long", "nb_bikes", "nb_standard_bikes", "nb_ebikes", "nb_empty_docks", "nb_docks"}
+
+// parseTSV parses TSV snapshot content read from source and returns the stations
+// and snapshot timestamp, with room for rows stations when that is known.
+// Malformed rows are skipped and logged.
+func parseTSV(r io.Reader, source string, rows int) ([]tfl.Station, time.Time, error) {
+	stations, timestamp, report, err := decodeTSV(r, rows)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if report.Malformed > 0 {
+		slog.Warn("Skipped malformed snapshot rows",
+			"source", source,
+			"malformed", report.Malformed,
+			"rows", report.Rows,
+			"lines", report.lineNumbers(),
+			"firstError", report.Lines[0].Reason,
+		)
+	}
+	return stations, timestamp, nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"city-cycling/internal/tfl"
+)
+
+// benchmarkStations is about the size of the London network.
+const benchmarkStations = 800
+
+// benchmarkSnapshot returns a TSV snapshot of n stations taken at ts.
+func benchmarkSnapshot(b *testing.B, ts time.Time, n int) []byte {
+	b.Helper()
+	var buf bytes.Buffer
+	if err := encodeTSV(&buf, ts, benchmarkStationList(n)); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// benchmarkStationList returns n stations with realistic names and counts.
+func benchmarkStationList(n int) []tfl.Station {
+	stations := make([]tfl.Station, n)
+	for i := range stations {
+		stations[i] = tfl.Station{
+			ID:              i + 1,
+			Name:            fmt.Sprintf("Station %d, Example Street", i+1),
+			Lat:             51.5 + float64(i)/1e4,
+			Long:            -0.1 - float64(i)/1e4,
+			NbBikes:         i % 20,
+			NbStandardBikes: i % 15,
+			NbEBikes:        i % 5,
+			NbEmptyDocks:    20 - i%20,
+			NbDocks:         20,
+		}
+	}
+	return stations
+}
+
+// BenchmarkEncodeTSV serializes a snapshot, as every collector write does.
+func BenchmarkEncodeTSV(b *testing.B) {
+	stations := benchmarkStationList(benchmarkStations)
+	ts := time.Now().UTC()
+	var buf bytes.Buffer
+	if err := encodeTSV(&buf, ts, stations); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(buf.Len()))
+	b.ReportAllocs()
+	for b.Loop() {
+		buf.Reset()
+		if err := encodeTSV(&buf, ts, stations); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeTSV parses a snapshot without knowing its row count.
+func BenchmarkDecodeTSV(b *testing.B) {
+	data := benchmarkSnapshot(b, time.Now().UTC(), benchmarkStations)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, _, err := decodeTSV(bytes.NewReader(data), 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseVerifiedTSV parses and verifies a snapshot with a recorded
+// checksum, as every read from storage does.
+func BenchmarkParseVerifiedTSV(b *testing.B) {
+	data := benchmarkSnapshot(b, time.Now().UTC(), benchmarkStations)
+	expected := checksumOf(data, benchmarkStations)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, _, err := parseVerifiedTSV(bytes.NewReader(data), "benchmark", &expected); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetHistoricalData builds the history of a day of 5-minute local
+// snapshots.
+func BenchmarkGetHistoricalData(b *testing.B) {
+	dir := b.TempDir()
+	start := time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC)
+	for i := range 288 {
+		ts := start.Add(time.Duration(i) * 5 * time.Minute)
+		data := benchmarkSnapshot(b, ts, benchmarkStations)
+		path := filepath.Join(dir, fmt.Sprintf("stations_%s.tsv", ts.Format("20060102_150405")))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			b.Fatal(err)
+		}
+		if err := writeChecksumSidecar(path, checksumOf(data, benchmarkStations)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	store := NewTSVStorage(dir)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		points, err := store.GetHistoricalData(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(points) != 288 {
+			b.Fatalf("got %d points, want 288", len(points))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaPublisher publishes every event to one Kafka topic, partitioned by key
+// so each station's deltas stay in order.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// newKafkaPublisher creates a publisher for spec, "broker[,broker...]/topic".
+func newKafkaPublisher(spec, clientName string) (*kafkaPublisher, error) {
+	brokers, topic, _ := strings.Cut(spec, "/")
+	topic = strings.Trim(topic, "/")
+	if brokers == "" || topic == "" {
+		return nil, fmt.Errorf("invalid Kafka URL: want kafka://broker[,broker...]/topic")
+	}
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    &kafka.Transport{ClientID: clientName},
+	}}, nil
+}
+
+// Publish writes msgs in one batch and waits for all in-sync replicas.
+func (p *kafkaPublisher) Publish(ctx context.Context, msgs []Message) error {
+	batch := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		batch[i] = kafka.Message{
+			Key:   []byte(m.Key),
+			Value: m.Value,
+			Headers: []kafka.Header{
+				{Key: "type", Value: []byte(m.Type)},
+				{Key: "subject", Value: []byte(m.Subject)},
+				{Key: "id", Value: []byte(m.ID)},
+			},
+		}
+	}
+	if err := p.writer.WriteMessages(ctx, batch...); err != nil {
+		return fmt.Errorf("failed to write to Kafka topic %s: %w", p.writer.Topic, err)
+	}
+	return nil
+}
+
+// Close flushes pending writes and closes the connections.
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
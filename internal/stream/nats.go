@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// defaultSubjectPrefix is the NATS subject prefix when the URL has no path.
+const defaultSubjectPrefix = "santander"
+
+// natsPublisher publishes to NATS JetStream. A stream must capture the
+// subjects (e.g. "santander.>"); publishes to subjects no stream captures fail.
+type natsPublisher struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	prefix string
+}
+
+// newNATSPublisher connects to the NATS server in rawURL, whose path is the
+// subject prefix.
+func newNATSPublisher(rawURL, clientName string) (*natsPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix == "" {
+		prefix = defaultSubjectPrefix
+	}
+	u.Path = ""
+
+	conn, err := nats.Connect(u.String(), nats.Name(clientName), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+	return &natsPublisher{conn: conn, js: js, prefix: strings.ReplaceAll(prefix, "/", ".")}, nil
+}
+
+// Publish sends msgs asynchronously and waits for every acknowledgement. Each
+// carries a Nats-Msg-Id, so a retried publish is deduplicated by the stream.
+func (p *natsPublisher) Publish(ctx context.Context, msgs []Message) error {
+	futures := make([]jetstream.PubAckFuture, 0, len(msgs))
+	for _, m := range msgs {
+		msg := nats.NewMsg(p.prefix + "." + m.Subject)
+		msg.Data = m.Value
+		msg.Header.Set("Type", m.Type)
+		f, err := p.js.PublishMsgAsync(msg, jetstream.WithMsgID(m.ID))
+		if err != nil {
+			return fmt.Errorf("failed to publish %s: %w", msg.Subject, err)
+		}
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		select {
+		case <-f.Ok():
+		case err := <-f.Err():
+			return fmt.Errorf("failed to publish %s: %w", f.Msg().Subject, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close drains pending publishes and closes the connection.
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,276 @@
+// Package stream publishes snapshots and per-station changes to an event bus
+// (NATS JetStream or Kafka) as versioned JSON events.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"city-cycling/internal/events"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// SchemaVersion is the version field of every event. It changes only when a
+// field is removed or changes meaning; new fields may be added within a version.
+const SchemaVersion = 1
+
+// Event types.
+const (
+	TypeSnapshot     = "snapshot"
+	TypeStationDelta = "station_delta"
+)
+
+// publishTimeout bounds how long publishing one snapshot's events may take.
+const publishTimeout = 30 * time.Second
+
+// SnapshotEvent is published for every snapshot written.
+type SnapshotEvent struct {
+	Type      string    `json:"type"`
+	Version   int       `json:"version"`
+	City      string    `json:"city"`
+	Key       string    `json:"key"`
+	Timestamp time.Time `json:"timestamp"`
+	// Source is the feed the snapshot came from, when fallbacks are configured.
+	Source   string    `json:"source,omitempty"`
+	Totals   Totals    `json:"totals"`
+	Stations []Station `json:"stations"`
+}
+
+// Totals are the network-wide counts of a snapshot.
+type Totals struct {
+	Stations   int `json:"stations"`
+	Bikes      int `json:"bikes"`
+	EBikes     int `json:"ebikes"`
+	EmptyDocks int `json:"emptyDocks"`
+	Docks      int `json:"docks"`
+}
+
+// Station is one station's state in a SnapshotEvent.
+type Station struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name"`
+	Lat             float64 `json:"lat"`
+	Lng             float64 `json:"lng"`
+	NbBikes         int     `json:"nbBikes"`
+	NbStandardBikes int     `json:"nbStandardBikes"`
+	NbEBikes        int     `json:"nbEBikes"`
+	NbEmptyDocks    int     `json:"nbEmptyDocks"`
+	NbDocks         int     `json:"nbDocks"`
+}
+
+// StationDeltaEvent is published for every station that changed since the
+// previous snapshot, with the same fields as the event log (see events.Diff).
+type StationDeltaEvent struct {
+	Type      string            `json:"type"`
+	Version   int               `json:"version"`
+	City      string            `json:"city"`
+	Timestamp time.Time         `json:"timestamp"`
+	StationID int               `json:"stationId"`
+	Changes   map[string]Change `json:"changes"`
+}
+
+// Change is a field's value before and after: a number for counts, a boolean
+// for events.FieldPresent.
+type Change struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// Message is one event ready to publish.
+type Message struct {
+	// Subject is appended to the NATS subject prefix, e.g. "london.snapshot";
+	// Kafka publishers send it as the "subject" header.
+	Subject string
+	// Key orders and partitions related messages: the city for snapshots and
+	// city/station for deltas.
+	Key string
+	// ID identifies the message for deduplication of retried publishes.
+	ID    string
+	Type  string
+	Value []byte
+}
+
+// Publisher delivers messages to an event bus.
+type Publisher interface {
+	// Publish delivers msgs, in order per key, returning once the bus has
+	// acknowledged them all.
+	Publish(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// Open connects to the event bus at rawURL: nats://[user:pass@]host:port/prefix
+// for NATS JetStream or kafka://broker[,broker...]/topic for Kafka.
+func Open(rawURL, clientName string) (Publisher, error) {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid stream URL %q: missing scheme", rawURL)
+	}
+	switch scheme {
+	case "nats", "tls":
+		return newNATSPublisher(rawURL, clientName)
+	case "kafka":
+		return newKafkaPublisher(rest, clientName)
+	}
+	return nil, fmt.Errorf("unsupported stream scheme %q (want nats or kafka)", scheme)
+}
+
+// Redact returns rawURL with any password masked, for logging.
+func Redact(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	scheme, _, _ := strings.Cut(rawURL, "://")
+	return scheme + "://..."
+}
+
+// Sink publishes an event for each snapshot and each station that changed
+// since the previous one. It is safe for concurrent use.
+type Sink struct {
+	pub  Publisher
+	city string
+
+	mu   sync.Mutex
+	prev []tfl.Station
+}
+
+// NewSink creates a sink for city's snapshots. prev is the snapshot the first
+// deltas are taken against, typically the latest stored one; nil publishes no
+// deltas for the first snapshot.
+func NewSink(pub Publisher, city string, prev []tfl.Station) *Sink {
+	return &Sink{pub: pub, city: city, prev: prev}
+}
+
+// Messages returns the events for a snapshot stored under key at ts, given
+// the previous snapshot.
+func (s *Sink) Messages(key string, ts time.Time, stations *tfl.Stations, prev []tfl.Station) ([]Message, error) {
+	snap := SnapshotEvent{
+		Type:      TypeSnapshot,
+		Version:   SchemaVersion,
+		City:      s.city,
+		Key:       key,
+		Timestamp: ts,
+		Source:    stations.Source,
+		Stations:  make([]Station, len(stations.Stations)),
+	}
+	for i, st := range stations.Stations {
+		snap.Stations[i] = Station{
+			ID:              st.ID,
+			Name:            st.Name,
+			Lat:             st.Lat,
+			Lng:             st.Long,
+			NbBikes:         st.NbBikes,
+			NbStandardBikes: st.NbStandardBikes,
+			NbEBikes:        st.NbEBikes,
+			NbEmptyDocks:    st.NbEmptyDocks,
+			NbDocks:         st.NbDocks,
+		}
+		snap.Totals.Bikes += st.NbBikes
+		snap.Totals.EBikes += st.NbEBikes
+		snap.Totals.EmptyDocks += st.NbEmptyDocks
+		snap.Totals.Docks += st.NbDocks
+	}
+	snap.Totals.Stations = len(stations.Stations)
+
+	stamp := ts.UTC().Format("20060102T150405Z")
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot event: %w", err)
+	}
+	msgs := []Message{{
+		Subject: s.city + "." + TypeSnapshot,
+		Key:     s.city,
+		ID:      s.city + "-" + TypeSnapshot + "-" + stamp,
+		Type:    TypeSnapshot,
+		Value:   data,
+	}}
+	if prev == nil {
+		return msgs, nil
+	}
+
+	// events.Diff orders changes by station, so each station's are adjacent
+	var delta *StationDeltaEvent
+	flush := func() error {
+		if delta == nil {
+			return nil
+		}
+		data, err := json.Marshal(delta)
+		if err != nil {
+			return fmt.Errorf("failed to encode station delta event: %w", err)
+		}
+		id := strconv.Itoa(delta.StationID)
+		msgs = append(msgs, Message{
+			Subject: s.city + ".station." + id,
+			Key:     s.city + "/" + id,
+			ID:      s.city + "-" + id + "-" + stamp,
+			Type:    TypeStationDelta,
+			Value:   data,
+		})
+		return nil
+	}
+	for _, e := range events.Diff(prev, stations.Stations, ts) {
+		if delta == nil || delta.StationID != e.StationID {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			delta = &StationDeltaEvent{
+				Type:      TypeStationDelta,
+				Version:   SchemaVersion,
+				City:      s.city,
+				Timestamp: ts,
+				StationID: e.StationID,
+				Changes:   make(map[string]Change),
+			}
+		}
+		delta.Changes[e.Field] = Change{Old: jsonValue(e.Old), New: jsonValue(e.New)}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// Record publishes the events for a newly written snapshot. Its signature
+// matches Collector.OnWrite. Failures are logged; the snapshot is already stored.
+func (s *Sink) Record(key string, stations *tfl.Stations) {
+	// Stamp events with the snapshot's own time so they line up with the store
+	ts, err := storage.SnapshotTime(key)
+	if err != nil {
+		ts = time.Now().UTC().Truncate(time.Second)
+	}
+
+	s.mu.Lock()
+	prev := s.prev
+	s.prev = stations.Stations
+	s.mu.Unlock()
+
+	msgs, err := s.Messages(key, ts, stations, prev)
+	if err != nil {
+		slog.Error("Failed to build stream events", "key", key, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := s.pub.Publish(ctx, msgs); err != nil {
+		slog.Error("Failed to publish stream events", "key", key, "events", len(msgs), "error", err)
+		return
+	}
+	slog.Debug("Published stream events", "key", key, "events", len(msgs))
+}
+
+// jsonValue returns an event log value as JSON: counts and booleans as they
+// are, anything else as a string.
+func jsonValue(v string) json.RawMessage {
+	if _, err := strconv.Atoi(v); err == nil || v == "true" || v == "false" {
+		return json.RawMessage(v)
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,123 @@
+// Package tenant describes the isolated datasets a multi-tenant server serves.
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// idPattern restricts tenant IDs to what can appear as a URL path segment and
+// a storage key prefix without escaping.
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedIDs are first path segments every tenant's pages reference, which a
+// tenant ID would shadow.
+var reservedIDs = map[string]bool{"static": true}
+
+// Storage is where a tenant's data lives. The backend is the server's (-r2,
+// -azure or local files); each field left empty keeps the server's setting.
+type Storage struct {
+	// Bucket replaces the R2 bucket (R2_BUCKET_NAME) or the Azure container
+	// (AZURE_STORAGE_CONTAINER).
+	Bucket string `json:"bucket,omitempty"`
+	// DataDir replaces -data-dir for local files.
+	DataDir string `json:"dataDir,omitempty"`
+	// Prefix nests every key of the tenant under it, e.g. "group-a/", so
+	// tenants can share a bucket, container or directory.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Tenant is one dataset served in isolation from the others: its own store,
+// cities, caches, API keys and load limits.
+type Tenant struct {
+	// ID selects the tenant by path, /{id}/api/v1/..., and names it in logs
+	// and metrics.
+	ID string `json:"id"`
+	// Hosts also select the tenant, serving it at the unprefixed routes for
+	// requests to these host names.
+	Hosts   []string `json:"hosts,omitempty"`
+	Storage Storage  `json:"storage"`
+	// Cities is a cities file as read by -cities; empty serves London alone.
+	Cities string `json:"cities,omitempty"`
+	// APIKeysFile is a JSON file of the API keys accepted by the tenant's
+	// protected endpoints, in place of the server's -api-keys-file and
+	// API_KEYS.
+	APIKeysFile string `json:"apiKeysFile,omitempty"`
+	// Alerts is an alerting rules file evaluated against the tenant's default
+	// city when the server collects (-collect).
+	Alerts string `json:"alerts,omitempty"`
+}
+
+// Config is the JSON tenants file.
+type Config struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// Load reads and validates a tenants file.
+func Load(path string) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants config: %w", err)
+	}
+	if len(cfg.Tenants) == 0 {
+		return nil, fmt.Errorf("tenants config lists no tenants")
+	}
+
+	ids := make(map[string]bool)
+	hosts := make(map[string]string)
+	locations := make(map[Storage]string)
+	for i := range cfg.Tenants {
+		t := &cfg.Tenants[i]
+		if !idPattern.MatchString(t.ID) {
+			return nil, fmt.Errorf("tenant %d: id %q must be lowercase letters, digits and dashes", i, t.ID)
+		}
+		if reservedIDs[t.ID] {
+			return nil, fmt.Errorf("tenant %q: id is reserved", t.ID)
+		}
+		if ids[t.ID] {
+			return nil, fmt.Errorf("tenant %q: duplicate id", t.ID)
+		}
+		ids[t.ID] = true
+
+		for j, host := range t.Hosts {
+			host = NormalizeHost(host)
+			if host == "" {
+				return nil, fmt.Errorf("tenant %q: host %d is empty", t.ID, j)
+			}
+			if other, ok := hosts[host]; ok {
+				return nil, fmt.Errorf("tenant %q: host %q already used by %q", t.ID, host, other)
+			}
+			hosts[host] = t.ID
+			t.Hosts[j] = host
+		}
+
+		if t.Storage.Prefix != "" && !strings.HasSuffix(t.Storage.Prefix, "/") {
+			t.Storage.Prefix += "/"
+		}
+		// Tenants sharing a store would read and overwrite each other's snapshots
+		if other, ok := locations[t.Storage]; ok {
+			return nil, fmt.Errorf("tenant %q: storage already used by %q; set a bucket, dataDir or prefix", t.ID, other)
+		}
+		locations[t.Storage] = t.ID
+	}
+
+	return cfg.Tenants, nil
+}
+
+// NormalizeHost lowercases a host name and drops its port, the form tenant
+// hosts are matched in.
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,170 @@
+package tfl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+
+	"city-cycling/internal/telemetry"
+)
+
+// BikePointEndpoint is the TFL Unified API list of every bike point.
+const BikePointEndpoint = "https://api.tfl.gov.uk/BikePoint"
+
+// BikePointClient fetches station data from the TFL Unified API. It carries the
+// same data as the XML syndication feed and is an independent fallback when
+// that feed lags or breaks.
+type BikePointClient struct {
+	endpoint   string
+	appKey     string
+	httpClient *http.Client
+}
+
+// NewBikePointClient creates a client for the BikePoint API at endpoint.
+// appKey is the Unified API app key; requests without one are rate limited harder.
+func NewBikePointClient(endpoint, appKey string) *BikePointClient {
+	return &BikePointClient{
+		endpoint: endpoint,
+		appKey:   appKey,
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+	}
+}
+
+// bikePoint is a Place returned by the BikePoint API.
+type bikePoint struct {
+	ID                   string  `json:"id"` // e.g. "BikePoints_1"
+	CommonName           string  `json:"commonName"`
+	Lat                  float64 `json:"lat"`
+	Lon                  float64 `json:"lon"`
+	AdditionalProperties []struct {
+		Key      string    `json:"key"`
+		Value    string    `json:"value"`
+		Modified time.Time `json:"modified"`
+	} `json:"additionalProperties"`
+}
+
+// FetchStations retrieves the current station data from the BikePoint API.
+func (c *BikePointClient) FetchStations(ctx context.Context) (_ *Stations, err error) {
+	ctx, span := telemetry.Start(ctx, "tfl.BikePoint.FetchStations")
+	defer telemetry.End(span, &err)
+
+	endpoint := c.endpoint
+	if c.appKey != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+		q := u.Query()
+		q.Set("app_key", c.appKey)
+		u.RawQuery = q.Encode()
+		endpoint = u.String()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "city-cycling/1.0")
+	req.Header.Set("Accept", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The URL carries the app key, so report the error without it
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to fetch stations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var points []bikePoint
+	if err := json.NewDecoder(resp.Body).Decode(&points); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	stations := &Stations{
+		Version:  "bikepoint",
+		Stations: make([]Station, 0, len(points)),
+	}
+	var lastUpdate time.Time
+	for _, p := range points {
+		s, modified, err := p.station()
+		if err != nil {
+			return nil, err
+		}
+		stations.Stations = append(stations.Stations, s)
+		if modified.After(lastUpdate) {
+			lastUpdate = modified
+		}
+	}
+	if lastUpdate.IsZero() {
+		lastUpdate = time.Now()
+	}
+	stations.LastUpdate = lastUpdate.UnixMilli()
+	span.SetAttributes(attribute.Int("stations", len(stations.Stations)))
+
+	return stations, nil
+}
+
+// station normalises a bike point into the feed's Station model, returning the
+// most recent modification time of its properties too.
+func (p bikePoint) station() (Station, time.Time, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(p.ID, "BikePoints_"))
+	if err != nil {
+		return Station{}, time.Time{}, fmt.Errorf("unexpected bike point id %q", p.ID)
+	}
+	s := Station{
+		ID:   id,
+		Name: p.CommonName,
+		Lat:  p.Lat,
+		Long: p.Lon,
+	}
+
+	var modified time.Time
+	for _, prop := range p.AdditionalProperties {
+		if prop.Modified.After(modified) {
+			modified = prop.Modified
+		}
+		switch prop.Key {
+		case "TerminalName":
+			s.TerminalName = prop.Value
+		case "Installed":
+			s.Installed = prop.Value == "true"
+		case "Locked":
+			s.Locked = prop.Value == "true"
+		case "Temporary":
+			s.Temporary = prop.Value == "true"
+		case "InstallDate":
+			s.InstallDate, _ = strconv.ParseInt(prop.Value, 10, 64)
+		case "RemovalDate":
+			s.RemovalDate = prop.Value
+		case "NbBikes":
+			s.NbBikes, _ = strconv.Atoi(prop.Value)
+		case "NbStandardBikes":
+			s.NbStandardBikes, _ = strconv.Atoi(prop.Value)
+		case "NbEBikes":
+			s.NbEBikes, _ = strconv.Atoi(prop.Value)
+		case "NbEmptyDocks":
+			s.NbEmptyDocks, _ = strconv.Atoi(prop.Value)
+		case "NbDocks":
+			s.NbDocks, _ = strconv.Atoi(prop.Value)
+		}
+	}
+	return s, modified, nil
+}
@@ -1,11 +1,18 @@
 package tfl
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+
+	"city-cycling/internal/telemetry"
 )
 
 const (
@@ -19,6 +26,8 @@ const (
 type Client struct {
 	endpoint   string
 	httpClient *http.Client
+	// Recorded responses read instead of fetching endpoint (nil for HTTP)
+	fixtures *fixtures
 }
 
 // NewClient creates a new TFL client with default settings.
@@ -31,8 +40,14 @@ func NewClient() *Client {
 	}
 }
 
-// NewClientWithEndpoint creates a new TFL client with a custom endpoint.
+// NewClientWithEndpoint creates a new TFL client with a custom endpoint. An
+// endpoint that is a file:// URL or a plain path reads recorded XML responses
+// instead: a file is returned by every fetch, and a directory's *.xml files
+// are returned one per fetch in name order, starting over after the last.
 func NewClientWithEndpoint(endpoint string) *Client {
+	if path, ok := fixturePath(endpoint); ok {
+		return &Client{endpoint: endpoint, fixtures: &fixtures{path: path}}
+	}
 	return &Client{
 		endpoint: endpoint,
 		httpClient: &http.Client{
@@ -42,12 +57,37 @@ func NewClientWithEndpoint(endpoint string) *Client {
 }
 
 // FetchStations retrieves the current station data from the TFL API.
-func (c *Client) FetchStations() (*Stations, error) {
-	req, err := http.NewRequest("GET", c.endpoint, nil)
+func (c *Client) FetchStations(ctx context.Context) (_ *Stations, err error) {
+	ctx, span := telemetry.Start(ctx, "tfl.FetchStations")
+	defer telemetry.End(span, &err)
+
+	var body []byte
+	if c.fixtures != nil {
+		body, err = c.fixtures.read()
+	} else {
+		body, err = c.fetch(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stations Stations
+	if err := xml.Unmarshal(body, &stations); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+	span.SetAttributes(attribute.Int("stations", len(stations.Stations)))
+
+	return &stations, nil
+}
+
+// fetch downloads the feed from the endpoint.
+func (c *Client) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", "city-cycling/1.0")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -63,11 +103,5 @@ func (c *Client) FetchStations() (*Stations, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
-
-	var stations Stations
-	if err := xml.Unmarshal(body, &stations); err != nil {
-		return nil, fmt.Errorf("failed to parse XML: %w", err)
-	}
-
-	return &stations, nil
+	return body, nil
 }
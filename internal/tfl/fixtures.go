@@ -0,0 +1,87 @@
+package tfl
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fixtures replays recorded XML feed responses from a file or a directory of
+// them, for deterministic integration tests and offline development.
+type fixtures struct {
+	path string
+
+	mu    sync.Mutex
+	files []string // nil until first read
+	next  int
+}
+
+// fixturePath returns the local path an endpoint names, if it is a file:// URL
+// or has no scheme at all.
+func fixturePath(endpoint string) (string, bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false
+	}
+	switch u.Scheme {
+	case "file":
+		return u.Path, true
+	case "":
+		return endpoint, endpoint != ""
+	}
+	return "", false
+}
+
+// read returns the next recorded response.
+func (f *fixtures) read() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.files == nil {
+		files, err := fixtureFiles(f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.files = files
+	}
+	file := f.files[f.next%len(f.files)]
+	f.next++
+
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded response: %w", err)
+	}
+	return body, nil
+}
+
+// fixtureFiles lists the responses recorded at path: path itself if it is a
+// file, else the *.xml files in it, sorted by name.
+func fixtureFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recorded responses: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recorded responses: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".xml") {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded responses (*.xml) in %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
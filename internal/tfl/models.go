@@ -1,6 +1,9 @@
 package tfl
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"strings"
+)
 
 // Stations represents the root XML element containing all bike stations.
 type Stations struct {
@@ -8,6 +11,27 @@ type Stations struct {
 	LastUpdate int64     `xml:"lastUpdate,attr"`
 	Version    string    `xml:"version,attr"`
 	Stations   []Station `xml:"station"`
+
+	// Source names the feed source that produced the data when fetched
+	// through a Failover.
+	Source string `xml:"-"`
+	// Validation is the outcome of the collector's sanity checks, if it ran them.
+	Validation *Validation `xml:"-"`
+}
+
+// Validation records whether a fetch passed the collector's sanity checks.
+type Validation struct {
+	Passed bool     `json:"passed"`
+	Issues []string `json:"issues,omitempty"`
+}
+
+// Summary describes the result in one line: "passed", or "failed: " followed
+// by the issues.
+func (v *Validation) Summary() string {
+	if v.Passed {
+		return "passed"
+	}
+	return "failed: " + strings.Join(v.Issues, "; ")
 }
 
 // Station represents a single Santander Cycles docking station.
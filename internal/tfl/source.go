@@ -0,0 +1,101 @@
+package tfl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"city-cycling/internal/telemetry"
+)
+
+// DefaultMaxAge is how old a source's lastUpdate may be before Failover tries
+// the next source.
+const DefaultMaxAge = 15 * time.Minute
+
+// Fetcher returns the live state of the stations. Client and BikePointClient
+// implement it.
+type Fetcher interface {
+	FetchStations(ctx context.Context) (*Stations, error)
+}
+
+// Source is a named Fetcher. The name is recorded on each snapshot it produces.
+type Source struct {
+	Name    string
+	Fetcher Fetcher
+}
+
+// Failover fetches from an ordered list of sources, moving on to the next when
+// one fails or returns data whose lastUpdate is older than the maximum age.
+type Failover struct {
+	sources []Source
+	maxAge  time.Duration
+}
+
+// NewFailover creates a Failover over sources, in order of preference.
+// maxAge of 0 disables the staleness check.
+func NewFailover(sources []Source, maxAge time.Duration) *Failover {
+	return &Failover{
+		sources: sources,
+		maxAge:  maxAge,
+	}
+}
+
+// FetchStations returns the first fresh result, with Stations.Source set to the
+// name of the source that produced it. If every source that answered was stale,
+// the most recent of them is returned rather than nothing; it fails only when
+// every source fails.
+func (f *Failover) FetchStations(ctx context.Context) (_ *Stations, err error) {
+	ctx, span := telemetry.Start(ctx, "tfl.Failover.FetchStations")
+	defer telemetry.End(span, &err)
+
+	var (
+		errs  []error
+		stale *Stations
+	)
+	for i, src := range f.sources {
+		stations, err := src.Fetcher.FetchStations(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name, err))
+			if ctx.Err() != nil {
+				break
+			}
+			if i < len(f.sources)-1 {
+				slog.Warn("Feed source failed, trying next", "source", src.Name, "error", err)
+			}
+			continue
+		}
+		stations.Source = src.Name
+
+		age := time.Since(time.UnixMilli(stations.LastUpdate))
+		if f.maxAge > 0 && age > f.maxAge {
+			if i < len(f.sources)-1 {
+				slog.Warn("Feed source is stale, trying next", "source", src.Name, "age", age.Round(time.Second))
+			}
+			if stale == nil || stations.LastUpdate > stale.LastUpdate {
+				stale = stations
+			}
+			continue
+		}
+		setSourceAttributes(span, stations.Source, i)
+		return stations, nil
+	}
+
+	if stale != nil {
+		slog.Warn("Every feed source is stale, using the most recent", "source", stale.Source,
+			"lastUpdate", time.UnixMilli(stale.LastUpdate).UTC())
+		setSourceAttributes(span, stale.Source, -1)
+		return stale, nil
+	}
+	return nil, fmt.Errorf("all feed sources failed: %w", errors.Join(errs...))
+}
+
+// setSourceAttributes records the chosen source on the span; index is -1 when
+// the result was a stale fallback.
+func setSourceAttributes(span trace.Span, name string, index int) {
+	span.SetAttributes(attribute.String("source", name), attribute.Int("source.index", index))
+}
@@ -0,0 +1,427 @@
+// Package tfltest serves fake bike-share feeds for development and tests: the
+// TfL live cycle hire XML feed and a GBFS system, backed by synthetic or
+// recorded station data, with configurable latency and failures.
+package tfltest
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Paths the feeds are served at.
+const (
+	XMLPath             = "/livecyclehireupdates.xml"
+	GBFSPath            = "/gbfs.json"
+	GBFSInformationPath = "/station_information.json"
+	GBFSStatusPath      = "/station_status.json"
+)
+
+// DefaultStations is the size of the synthetic network, roughly London's.
+const DefaultStations = 800
+
+// The synthetic network is spread around central London, and each fetch moves
+// every station's bike count by at most syntheticMaxChange.
+const (
+	syntheticCenterLat  = 51.5074
+	syntheticCenterLong = -0.1278
+	syntheticSpreadLat  = 0.06
+	syntheticSpreadLong = 0.12
+	syntheticMaxChange  = 2
+)
+
+// Config describes the data a Feed serves and how badly it behaves.
+type Config struct {
+	// Stations is the number of synthetic stations (DefaultStations if <= 0).
+	// It is ignored when Recorded is set.
+	Stations int
+	// Seed makes the synthetic data and the failures reproducible.
+	Seed uint64
+	// Recorded snapshots are served in order instead of synthetic data, one per
+	// fetch, starting over after the last.
+	Recorded []tfl.Stations
+
+	// Latency delays every response, by up to Jitter more or less.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the fraction of requests answered with 503 Service
+	// Unavailable, MalformedRate the fraction whose body is cut off halfway and
+	// EmptyRate the fraction of fetches that list no stations.
+	ErrorRate     float64
+	MalformedRate float64
+	EmptyRate     float64
+}
+
+// Feed is an http.Handler serving the TfL XML feed at XMLPath and a GBFS v2
+// system discovered at GBFSPath. Every XML or station_status request is a
+// fetch and moves the data on: synthetic stations gain or lose a few bikes,
+// recorded data advances to the next snapshot. It is safe for concurrent use.
+type Feed struct {
+	cfg Config
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	stations []tfl.Station
+	next     int
+	failNext int
+	requests int
+	fetches  int
+}
+
+// NewFeed creates a feed serving the data described by cfg.
+func NewFeed(cfg Config) *Feed {
+	f := &Feed{cfg: cfg, rng: rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x5eed))}
+	if len(cfg.Recorded) > 0 {
+		f.stations = cfg.Recorded[0].Stations
+	} else {
+		f.stations = f.syntheticStations()
+	}
+	return f
+}
+
+// NewServer starts a server for a new feed. Callers should Close it when done.
+func NewServer(cfg Config) (*httptest.Server, *Feed) {
+	f := NewFeed(cfg)
+	return httptest.NewServer(f), f
+}
+
+// FailNext makes the next n requests fail with 503 Service Unavailable,
+// whatever the configured rates, to simulate an outage.
+func (f *Feed) FailNext(n int) {
+	f.mu.Lock()
+	f.failNext = n
+	f.mu.Unlock()
+}
+
+// Requests returns how many requests the feed has received.
+func (f *Feed) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// Fetches returns how many fetches (XML or station_status requests) the feed
+// has answered, failed ones included.
+func (f *Feed) Fetches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches
+}
+
+// Snapshots returns the next n snapshots of the feed's data, oldest first, as
+// if fetched every interval from start: full-size, realistic fixtures for
+// benchmarks and tests. Each snapshot advances the data like a fetch.
+func (f *Feed) Snapshots(n int, start time.Time, interval time.Duration) []storage.Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	snaps := make([]storage.Snapshot, n)
+	for i := range snaps {
+		snaps[i] = storage.Snapshot{Timestamp: start.Add(time.Duration(i) * interval).UTC(), Stations: f.stations}
+		f.advance()
+	}
+	return snaps
+}
+
+// WriteSnapshots records snaps in a local data directory, as the collector
+// would have, for a server or store to read back.
+func WriteSnapshots(ctx context.Context, dir string, snaps []storage.Snapshot) error {
+	store := storage.NewTSVStorage(dir)
+	for _, snap := range snaps {
+		if _, err := store.WriteStationsAt(ctx, snap.Timestamp, &tfl.Stations{Stations: snap.Stations}); err != nil {
+			return fmt.Errorf("failed to write snapshot %s: %w", snap.Timestamp.Format(time.RFC3339), err)
+		}
+	}
+	return nil
+}
+
+// outcome is how the feed answers one request.
+type outcome struct {
+	delay     time.Duration
+	fail      bool
+	malformed bool
+	empty     bool
+}
+
+// ServeHTTP serves the feeds.
+func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fetch := r.URL.Path == XMLPath || r.URL.Path == GBFSStatusPath
+	known := fetch || r.URL.Path == GBFSPath || r.URL.Path == GBFSInformationPath
+	if !known {
+		http.NotFound(w, r)
+		return
+	}
+
+	o := f.roll(fetch)
+	if o.delay > 0 {
+		select {
+		case <-time.After(o.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if o.fail {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body []byte
+	var err error
+	contentType := "application/json"
+	switch r.URL.Path {
+	case XMLPath:
+		contentType = "application/xml"
+		body, err = f.xmlFeed(o.empty)
+	case GBFSPath:
+		body, err = gbfsDiscovery(baseURL(r))
+	case GBFSInformationPath:
+		body, err = f.gbfsInformation()
+	case GBFSStatusPath:
+		body, err = f.gbfsStatus(o.empty)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if o.malformed {
+		body = body[:len(body)/2]
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// roll decides how to answer a request, advancing the data for a fetch.
+func (f *Feed) roll(fetch bool) outcome {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	var o outcome
+	if f.cfg.Latency > 0 || f.cfg.Jitter > 0 {
+		o.delay = f.cfg.Latency
+		if f.cfg.Jitter > 0 {
+			o.delay += time.Duration(f.rng.Int64N(int64(2*f.cfg.Jitter))) - f.cfg.Jitter
+		}
+		o.delay = max(o.delay, 0)
+	}
+	switch {
+	case f.failNext > 0:
+		f.failNext--
+		o.fail = true
+	case f.rng.Float64() < f.cfg.ErrorRate:
+		o.fail = true
+	case f.rng.Float64() < f.cfg.MalformedRate:
+		o.malformed = true
+	}
+	if fetch {
+		f.fetches++
+		o.empty = f.rng.Float64() < f.cfg.EmptyRate
+		if !o.fail {
+			f.advance()
+		}
+	}
+	return o
+}
+
+// current returns the stations currently served.
+func (f *Feed) current() []tfl.Station {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stations
+}
+
+// advance moves the data on by one fetch. The caller holds f.mu.
+func (f *Feed) advance() {
+	if n := len(f.cfg.Recorded); n > 0 {
+		f.stations = f.cfg.Recorded[f.next%n].Stations
+		f.next++
+		return
+	}
+
+	// Stations are replaced rather than modified so earlier readers keep a consistent copy
+	stations := make([]tfl.Station, len(f.stations))
+	for i, s := range f.stations {
+		change := f.rng.IntN(2*syntheticMaxChange+1) - syntheticMaxChange
+		bikes := min(max(s.NbBikes+change, 0), s.NbDocks)
+		s.NbEBikes = min(s.NbEBikes, bikes)
+		if change > 0 && f.rng.IntN(4) == 0 {
+			s.NbEBikes = min(s.NbEBikes+1, bikes)
+		}
+		s.NbBikes = bikes
+		s.NbStandardBikes = bikes - s.NbEBikes
+		s.NbEmptyDocks = s.NbDocks - bikes
+		stations[i] = s
+	}
+	f.stations = stations
+}
+
+// syntheticStations generates the stations of a made-up network around
+// central London.
+func (f *Feed) syntheticStations() []tfl.Station {
+	n := f.cfg.Stations
+	if n <= 0 {
+		n = DefaultStations
+	}
+	stations := make([]tfl.Station, n)
+	for i := range stations {
+		docks := 10 + f.rng.IntN(31)
+		bikes := f.rng.IntN(docks + 1)
+		ebikes := f.rng.IntN(bikes/3 + 1)
+		stations[i] = tfl.Station{
+			ID:              i + 1,
+			Name:            fmt.Sprintf("Synthetic Station %d", i+1),
+			TerminalName:    strconv.Itoa(100000 + i + 1),
+			Lat:             syntheticCenterLat + (f.rng.Float64()*2-1)*syntheticSpreadLat,
+			Long:            syntheticCenterLong + (f.rng.Float64()*2-1)*syntheticSpreadLong,
+			Installed:       true,
+			NbBikes:         bikes,
+			NbStandardBikes: bikes - ebikes,
+			NbEBikes:        ebikes,
+			NbEmptyDocks:    docks - bikes,
+			NbDocks:         docks,
+		}
+	}
+	return stations
+}
+
+// xmlFeed renders the TfL live cycle hire XML feed.
+func (f *Feed) xmlFeed(empty bool) ([]byte, error) {
+	feed := tfl.Stations{LastUpdate: time.Now().UnixMilli(), Version: "2.0"}
+	if !empty {
+		feed.Stations = f.current()
+	}
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode XML feed: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// baseURL returns the scheme and host the request was made to.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// gbfsFeed is the envelope of every GBFS v2 feed.
+type gbfsFeed struct {
+	LastUpdated int64  `json:"last_updated"`
+	TTL         int    `json:"ttl"`
+	Version     string `json:"version"`
+	Data        any    `json:"data"`
+}
+
+// gbfsDiscovery renders gbfs.json, with feed URLs under base.
+func gbfsDiscovery(base string) ([]byte, error) {
+	type feed struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	feeds := []feed{
+		{Name: "station_information", URL: base + GBFSInformationPath},
+		{Name: "station_status", URL: base + GBFSStatusPath},
+	}
+	return json.Marshal(gbfsFeed{
+		LastUpdated: time.Now().Unix(),
+		Version:     "2.3",
+		Data:        map[string]any{"en": map[string]any{"feeds": feeds}},
+	})
+}
+
+// gbfsInformation renders station_information.json.
+func (f *Feed) gbfsInformation() ([]byte, error) {
+	type station struct {
+		StationID string  `json:"station_id"`
+		Name      string  `json:"name"`
+		Lat       float64 `json:"lat"`
+		Lon       float64 `json:"lon"`
+		Capacity  int     `json:"capacity"`
+	}
+	current := f.current()
+	stations := make([]station, len(current))
+	for i, s := range current {
+		stations[i] = station{StationID: strconv.Itoa(s.ID), Name: s.Name, Lat: s.Lat, Lon: s.Long, Capacity: s.NbDocks}
+	}
+	return json.Marshal(gbfsFeed{
+		LastUpdated: time.Now().Unix(),
+		TTL:         3600,
+		Version:     "2.3",
+		Data:        map[string]any{"stations": stations},
+	})
+}
+
+// gbfsStatus renders station_status.json.
+func (f *Feed) gbfsStatus(empty bool) ([]byte, error) {
+	type station struct {
+		StationID          string `json:"station_id"`
+		NumBikesAvailable  int    `json:"num_bikes_available"`
+		NumEBikesAvailable int    `json:"num_ebikes_available"`
+		NumDocksAvailable  int    `json:"num_docks_available"`
+		IsInstalled        bool   `json:"is_installed"`
+		IsRenting          bool   `json:"is_renting"`
+		IsReturning        bool   `json:"is_returning"`
+		LastReported       int64  `json:"last_reported"`
+	}
+	now := time.Now().Unix()
+	stations := []station{}
+	if !empty {
+		for _, s := range f.current() {
+			stations = append(stations, station{
+				StationID:          strconv.Itoa(s.ID),
+				NumBikesAvailable:  s.NbBikes,
+				NumEBikesAvailable: s.NbEBikes,
+				NumDocksAvailable:  s.NbEmptyDocks,
+				IsInstalled:        true,
+				IsRenting:          !s.Locked,
+				IsReturning:        !s.Locked,
+				LastReported:       now,
+			})
+		}
+	}
+	return json.Marshal(gbfsFeed{
+		LastUpdated: now,
+		Version:     "2.3",
+		Data:        map[string]any{"stations": stations},
+	})
+}
+
+// LoadRecorded reads the snapshots in a local data directory, such as one
+// written by the collector, oldest first, for Config.Recorded.
+func LoadRecorded(ctx context.Context, dir string) ([]tfl.Stations, error) {
+	store := storage.NewTSVStorage(dir)
+	timestamps, err := store.ListAvailableTimestamps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recorded snapshots: %w", err)
+	}
+	if len(timestamps) == 0 {
+		return nil, fmt.Errorf("no snapshots in %s", dir)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+
+	recorded := make([]tfl.Stations, 0, len(timestamps))
+	for _, ts := range timestamps {
+		stations, err := store.GetSnapshotByTimestamp(ctx, ts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recorded snapshot %s: %w", ts.Format(time.RFC3339), err)
+		}
+		// TSV snapshots only keep what the archive needs
+		for i := range stations {
+			stations[i].Installed = true
+		}
+		recorded = append(recorded, tfl.Stations{LastUpdate: ts.UnixMilli(), Version: "recorded", Stations: stations})
+	}
+	return recorded, nil
+}
@@ -0,0 +1,383 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+const (
+	// adminRoot is the path the admin API is mounted under.
+	adminRoot = "/admin"
+	// AuditKeyPrefix is the object key prefix under which admin changes are
+	// recorded, one object per change.
+	AuditKeyPrefix = "meta/audit/"
+	// defaultAdminListLimit is how many snapshots a list returns by default.
+	defaultAdminListLimit = 100
+)
+
+// AdminSnapshotSummary is one entry of the admin snapshot list.
+type AdminSnapshotSummary struct {
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+	Timestamp string `json:"timestamp"`
+}
+
+// AdminSnapshotListResponse is the JSON response for listing snapshots.
+type AdminSnapshotListResponse struct {
+	Total     int                    `json:"total"`
+	Snapshots []AdminSnapshotSummary `json:"snapshots"`
+}
+
+// MalformedLineResponse is a snapshot row that could not be parsed.
+type MalformedLineResponse struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// AdminSnapshotResponse describes one snapshot as read back from the store.
+type AdminSnapshotResponse struct {
+	Name        string                  `json:"name"`
+	Key         string                  `json:"key"`
+	Timestamp   string                  `json:"timestamp"`
+	Size        int64                   `json:"size"`
+	Checksum    string                  `json:"checksum,omitempty"`
+	Verified    bool                    `json:"verified"`
+	VerifyError string                  `json:"verifyError,omitempty"`
+	Source      string                  `json:"source,omitempty"`
+	Validation  string                  `json:"validation,omitempty"`
+	Rows        int                     `json:"rows"`
+	Malformed   int                     `json:"malformed"`
+	Lines       []MalformedLineResponse `json:"malformedLines,omitempty"`
+	Stations    []StationResponse       `json:"stations,omitempty"`
+}
+
+// auditRecord is the persisted form of an admin change.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Admin    string    `json:"admin"`
+	Action   string    `json:"action"`
+	City     string    `json:"city"`
+	Key      string    `json:"key"`
+	Checksum string    `json:"checksum,omitempty"`
+	Stations int       `json:"stations"`
+	// StationID is the station whose attributes were edited.
+	StationID int    `json:"stationId,omitempty"`
+	Remote    string `json:"remote"`
+}
+
+// adminHandlerFunc is an admin API handler, given the name of the calling admin.
+type adminHandlerFunc func(w http.ResponseWriter, r *http.Request, admin string)
+
+// EnableAdmin mounts the admin API, accepting any of keys as a bearer token.
+// Call before RegisterRoutes; without it the admin API is not served.
+func (h *Handler) EnableAdmin(keys []APIKey) {
+	h.adminKeys = keys
+}
+
+// registerAdmin mounts the snapshot, export and station attribute admin endpoints for the routes mounted at mount.
+func (h *Handler) registerAdmin(mux *http.ServeMux, mount string) {
+	if len(h.adminKeys) == 0 {
+		return
+	}
+	prefix := adminRoot + mount + "/snapshots"
+	mux.HandleFunc("GET "+prefix, h.admin(h.handleAdminListSnapshots))
+	mux.HandleFunc("GET "+prefix+"/{name}", h.admin(h.handleAdminGetSnapshot))
+	mux.HandleFunc("POST "+prefix+"/{name}/reparse", h.admin(h.handleAdminReparseSnapshot))
+	mux.HandleFunc("DELETE "+prefix+"/{name}", h.admin(h.handleAdminDeleteSnapshot))
+
+	mux.HandleFunc("GET "+adminRoot+mount+"/export", h.admin(h.handleAdminExport))
+
+	attributes := adminRoot + mount + "/stations"
+	mux.HandleFunc("GET "+attributes+"/attributes", h.admin(h.handleAdminListAttributes))
+	mux.HandleFunc("GET "+attributes+"/{id}/attributes", h.admin(h.handleAdminGetAttributes))
+	mux.HandleFunc("PUT "+attributes+"/{id}/attributes", h.admin(h.handleAdminSetAttributes))
+	mux.HandleFunc("PATCH "+attributes+"/{id}/attributes", h.admin(h.handleAdminSetAttributes))
+	mux.HandleFunc("DELETE "+attributes+"/{id}/attributes", h.admin(h.handleAdminDeleteAttributes))
+
+	// The mode is shared by every city, so it has one route
+	if mount == "" {
+		mux.HandleFunc("GET "+adminModePath, h.admin(h.handleAdminGetMode))
+		mux.HandleFunc("PATCH "+adminModePath, h.admin(h.handleAdminSetMode))
+	}
+}
+
+// admin wraps an admin handler, requiring an admin key in the Authorization
+// header. Keys are never accepted in the query string, where they would be logged.
+// In read-only mode only reads, and changes of the mode itself, are let through.
+func (h *Handler) admin(next adminHandlerFunc) http.HandlerFunc {
+	return h.withLogging(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || presented == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="city-cycling-admin"`)
+			httpError(w, r, "Admin key required", http.StatusUnauthorized)
+			return
+		}
+
+		var name string
+		matched := false
+		for _, k := range h.adminKeys {
+			if subtle.ConstantTimeCompare([]byte(k.Key), []byte(presented)) == 1 {
+				name, matched = k.Name, true
+			}
+		}
+		if !matched {
+			slog.Warn("Admin request with invalid key", "path", r.URL.Path, "remote", r.RemoteAddr)
+			httpError(w, r, "Invalid admin key", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != adminModePath && h.refuseReadOnly(w, r) {
+			return
+		}
+		next(w, r, name)
+	})
+}
+
+// snapshotManager returns the store as a storage.SnapshotManager, or writes an
+// error if the backend cannot manage snapshots.
+func (h *Handler) snapshotManager(w http.ResponseWriter, r *http.Request) (storage.SnapshotManager, bool) {
+	mgr, ok := h.store.(storage.SnapshotManager)
+	if !ok {
+		httpError(w, r, "Snapshot management not available with current storage backend", http.StatusNotImplemented)
+	}
+	return mgr, ok
+}
+
+// snapshotKey resolves the {name} path value to a snapshot key.
+func snapshotKey(w http.ResponseWriter, r *http.Request, mgr storage.SnapshotManager) (string, time.Time, bool) {
+	name := r.PathValue("name")
+	if !storage.ValidSnapshotName(name) {
+		httpError(w, r, "Invalid snapshot name (expected stations_YYYYMMDD_HHMMSS.tsv)", http.StatusBadRequest)
+		return "", time.Time{}, false
+	}
+	ts, err := storage.SnapshotTime(name)
+	if err != nil {
+		httpError(w, r, "Invalid snapshot name", http.StatusBadRequest)
+		return "", time.Time{}, false
+	}
+	return mgr.SnapshotKey(ts), ts, true
+}
+
+// handleAdminListSnapshots lists stored snapshots, newest first.
+func (h *Handler) handleAdminListSnapshots(w http.ResponseWriter, r *http.Request, admin string) {
+	mgr, ok := h.snapshotManager(w, r)
+	if !ok {
+		return
+	}
+	var from, to time.Time
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				httpError(w, r, errInvalidParam(name).Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	limit, err := parseIntParam(r, "limit", defaultAdminListLimit)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := parseIntParam(r, "offset", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	if !from.IsZero() && !to.IsZero() {
+		keys, err = mgr.ListSnapshotsRange(r.Context(), from, to)
+	} else {
+		keys, err = mgr.ListSnapshots(r.Context())
+	}
+	if err != nil {
+		slog.Error("Failed to list snapshots", "error", err)
+		httpError(w, r, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	response := AdminSnapshotListResponse{Snapshots: []AdminSnapshotSummary{}}
+	for _, key := range keys {
+		ts, err := storage.SnapshotTime(key)
+		if err != nil || (!from.IsZero() && ts.Before(from)) || (!to.IsZero() && ts.After(to)) {
+			continue
+		}
+		response.Total++
+		if response.Total <= offset || len(response.Snapshots) >= limit {
+			continue
+		}
+		response.Snapshots = append(response.Snapshots, AdminSnapshotSummary{
+			Name:      storage.SnapshotName(ts),
+			Key:       key,
+			Timestamp: ts.Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, response)
+}
+
+// handleAdminGetSnapshot re-reads one snapshot and reports what it contains;
+// ?stations=true includes the parsed stations.
+func (h *Handler) handleAdminGetSnapshot(w http.ResponseWriter, r *http.Request, admin string) {
+	mgr, ok := h.snapshotManager(w, r)
+	if !ok {
+		return
+	}
+	key, ts, ok := snapshotKey(w, r, mgr)
+	if !ok {
+		return
+	}
+	inspection, ok := inspectSnapshot(w, r, mgr, key)
+	if !ok {
+		return
+	}
+	writeJSON(w, adminSnapshotResponse(inspection, ts, r.URL.Query().Get("stations") == "true"))
+}
+
+// handleAdminReparseSnapshot re-reads one snapshot and drops whatever the
+// server derived from it, so a snapshot repaired in the store is served anew.
+func (h *Handler) handleAdminReparseSnapshot(w http.ResponseWriter, r *http.Request, admin string) {
+	mgr, ok := h.snapshotManager(w, r)
+	if !ok {
+		return
+	}
+	key, ts, ok := snapshotKey(w, r, mgr)
+	if !ok {
+		return
+	}
+	inspection, ok := inspectSnapshot(w, r, mgr, key)
+	if !ok {
+		return
+	}
+
+	h.invalidateSnapshots()
+	h.audit(r, admin, "reparse", inspection)
+	writeJSON(w, adminSnapshotResponse(inspection, ts, false))
+}
+
+// handleAdminDeleteSnapshot deletes one snapshot.
+func (h *Handler) handleAdminDeleteSnapshot(w http.ResponseWriter, r *http.Request, admin string) {
+	mgr, ok := h.snapshotManager(w, r)
+	if !ok {
+		return
+	}
+	key, ts, ok := snapshotKey(w, r, mgr)
+	if !ok {
+		return
+	}
+	// Read it first: object stores report success deleting a missing key, and
+	// the audit record keeps the checksum of what was deleted
+	inspection, ok := inspectSnapshot(w, r, mgr, key)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	if err := mgr.DeleteSnapshot(ctx, key); err != nil {
+		slog.Error("Failed to delete snapshot", "key", key, "admin", admin, "error", err)
+		httpError(w, r, "Failed to delete snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	h.invalidateSnapshots()
+	h.audit(r, admin, "delete", inspection)
+	writeJSON(w, adminSnapshotResponse(inspection, ts, false))
+}
+
+// inspectSnapshot re-reads key, writing an error if it cannot.
+func inspectSnapshot(w http.ResponseWriter, r *http.Request, mgr storage.SnapshotManager, key string) (*storage.SnapshotInspection, bool) {
+	inspection, err := mgr.InspectSnapshot(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		httpError(w, r, "Snapshot not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to read snapshot", "key", key, "error", err)
+		httpError(w, r, "Failed to read snapshot", http.StatusInternalServerError)
+		return nil, false
+	}
+	return inspection, true
+}
+
+// invalidateSnapshots drops the cached snapshots and expires the history
+// cache after a snapshot changed under the server.
+func (h *Handler) invalidateSnapshots() {
+	if err := h.snapshotCache.Clear(context.Background()); err != nil {
+		slog.Warn("Failed to clear snapshot cache", "error", err)
+	}
+	if h.columnar != nil {
+		h.columnar.Reset()
+	}
+	h.statusMu.Lock()
+	h.statusCache = nil
+	h.statusMu.Unlock()
+	h.NotifySnapshot()
+}
+
+// audit logs an admin change and records it in the store.
+func (h *Handler) audit(r *http.Request, admin, action string, inspection *storage.SnapshotInspection) {
+	h.recordAudit(r, auditRecord{
+		Time:     time.Now().UTC(),
+		Admin:    admin,
+		Action:   action,
+		City:     h.city.ID,
+		Key:      inspection.Key,
+		Checksum: inspection.Checksum,
+		Stations: len(inspection.Stations),
+		Remote:   r.RemoteAddr,
+	})
+}
+
+// recordAudit logs rec and records it in the store.
+func (h *Handler) recordAudit(r *http.Request, rec auditRecord) {
+	slog.Info("Admin audit", "admin", rec.Admin, "action", rec.Action, "city", rec.City, "key", rec.Key, "checksum", rec.Checksum, "remote", rec.Remote)
+
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err == nil {
+		key := fmt.Sprintf("%s%s_%s.json", AuditKeyPrefix, rec.Time.Format("20060102_150405.000000000"), rec.Action)
+		err = objects.PutObject(context.WithoutCancel(r.Context()), key, data, "application/json")
+	}
+	if err != nil {
+		slog.Error("Failed to record admin audit", "action", rec.Action, "key", rec.Key, "error", err)
+	}
+}
+
+// adminSnapshotResponse converts an inspection to its JSON representation.
+func adminSnapshotResponse(inspection *storage.SnapshotInspection, ts time.Time, withStations bool) AdminSnapshotResponse {
+	response := AdminSnapshotResponse{
+		Name:        storage.SnapshotName(ts),
+		Key:         inspection.Key,
+		Timestamp:   ts.Format(time.RFC3339),
+		Size:        inspection.Size,
+		Checksum:    inspection.Checksum,
+		Verified:    inspection.Verified,
+		VerifyError: inspection.VerifyError,
+		Source:      inspection.Source,
+		Validation:  inspection.Validation,
+		Rows:        inspection.Parse.Rows,
+		Malformed:   inspection.Parse.Malformed,
+	}
+	for _, l := range inspection.Parse.Lines {
+		response.Lines = append(response.Lines, MalformedLineResponse{Line: l.Line, Reason: l.Reason})
+	}
+	if withStations {
+		response.Stations = make([]StationResponse, len(inspection.Stations))
+		for i, s := range inspection.Stations {
+			response.Stations[i] = toStationResponse(s)
+		}
+	}
+	return response
+}
@@ -0,0 +1,442 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// defaultAnalyticsWindow is the window used when an analytics request has no from parameter.
+	defaultAnalyticsWindow = 24 * time.Hour
+	// defaultAnalyticsTop is the number of ranked stations returned by default.
+	defaultAnalyticsTop = 10
+)
+
+// StationChurnResponse represents a station ranked by churn.
+type StationChurnResponse struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Churn int    `json:"churn"`
+}
+
+// TrendPointResponse represents network-wide values at a point in time.
+type TrendPointResponse struct {
+	Timestamp   string  `json:"timestamp"`
+	DockedBikes int     `json:"dockedBikes"`
+	InTransit   int     `json:"inTransit"`
+	EBikeShare  float64 `json:"eBikeShare"`
+}
+
+// AnalyticsSummaryResponse is the JSON response for the analytics summary API.
+type AnalyticsSummaryResponse struct {
+	From          string                 `json:"from"`
+	To            string                 `json:"to"`
+	SnapshotCount int                    `json:"snapshotCount"`
+	PeakDocked    int                    `json:"peakDocked"`
+	InTransitNow  int                    `json:"inTransitNow"`
+	MaxInTransit  int                    `json:"maxInTransit"`
+	EmptyEvents   int                    `json:"emptyEvents"`
+	FullEvents    int                    `json:"fullEvents"`
+	Busiest       []StationChurnResponse `json:"busiestStations"`
+	Trend         []TrendPointResponse   `json:"trend"`
+}
+
+// analyticsStore returns the store as a RangeDataStore, writing a 501 if unsupported.
+func (h *Handler) analyticsStore(w http.ResponseWriter, r *http.Request) (storage.RangeDataStore, bool) {
+	rangeStore, ok := h.store.(storage.RangeDataStore)
+	if !ok {
+		httpError(w, r, "Analytics not available with current storage backend", http.StatusNotImplemented)
+	}
+	return rangeStore, ok
+}
+
+// handleAnalyticsSummary serves network-wide derived metrics over a window.
+func (h *Handler) handleAnalyticsSummary(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultAnalyticsWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	top, err := parseTop(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	builder := analytics.NewSummaryBuilder(from, to)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, builder); err != nil {
+		slog.Error("Failed to compute analytics summary", "error", err)
+		httpError(w, r, "Failed to compute analytics", http.StatusInternalServerError)
+		return
+	}
+	summary := builder.Result(top)
+
+	response := AnalyticsSummaryResponse{
+		From:          formatTime(summary.From, loc),
+		To:            formatTime(summary.To, loc),
+		SnapshotCount: summary.SnapshotCount,
+		PeakDocked:    summary.PeakDocked,
+		InTransitNow:  summary.InTransitNow,
+		MaxInTransit:  summary.MaxInTransit,
+		EmptyEvents:   summary.EmptyEvents,
+		FullEvents:    summary.FullEvents,
+		Busiest:       make([]StationChurnResponse, len(summary.Busiest)),
+		Trend:         make([]TrendPointResponse, len(summary.Trend)),
+	}
+	for i, s := range summary.Busiest {
+		response.Busiest[i] = StationChurnResponse{ID: s.StationID, Name: s.Name, Churn: s.Churn}
+	}
+	for i, p := range summary.Trend {
+		response.Trend[i] = TrendPointResponse{
+			Timestamp:   formatTime(p.Timestamp, loc),
+			DockedBikes: p.DockedBikes,
+			InTransit:   p.InTransit,
+			EBikeShare:  p.EBikeShare,
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// RebalanceEventResponse represents a likely operator rebalancing event.
+type RebalanceEventResponse struct {
+	StationID int    `json:"stationId"`
+	Name      string `json:"name"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Before    int    `json:"before"`
+	After     int    `json:"after"`
+	Delta     int    `json:"delta"`
+}
+
+// RebalancingResponse is the JSON response for the rebalancing API.
+type RebalancingResponse struct {
+	From      string                   `json:"from"`
+	To        string                   `json:"to"`
+	Threshold int                      `json:"threshold"`
+	Events    []RebalanceEventResponse `json:"events"`
+}
+
+// handleRebalancing serves likely rebalancing events, optionally for a single station.
+func (h *Handler) handleRebalancing(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultAnalyticsWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	threshold, err := parseIntParam(r, "threshold", analytics.DefaultRebalanceThreshold)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Per-station annotations come from the station path or query parameter
+	stationID := 0
+	if v := r.PathValue("id"); v != "" {
+		stationID, err = strconv.Atoi(v)
+		if err != nil {
+			httpError(w, r, "Invalid station id", http.StatusBadRequest)
+			return
+		}
+	} else if stationID, err = parseIntParam(r, "station", 0); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detector := analytics.NewRebalancingDetector(threshold)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, detector); err != nil {
+		slog.Error("Failed to detect rebalancing", "error", err)
+		httpError(w, r, "Failed to compute analytics", http.StatusInternalServerError)
+		return
+	}
+
+	events := detector.Events()
+	if stationID != 0 {
+		events = detector.EventsByStation()[stationID]
+	}
+
+	response := RebalancingResponse{
+		From:      from.Format("2006-01-02T15:04:05Z"),
+		To:        to.Format("2006-01-02T15:04:05Z"),
+		Threshold: threshold,
+		Events:    make([]RebalanceEventResponse, len(events)),
+	}
+	for i, e := range events {
+		response.Events[i] = RebalanceEventResponse{
+			StationID: e.StationID,
+			Name:      e.Name,
+			Start:     e.Start.Format("2006-01-02T15:04:05Z"),
+			End:       e.End.Format("2006-01-02T15:04:05Z"),
+			Before:    e.Before,
+			After:     e.After,
+			Delta:     e.Delta,
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+const (
+	// maxFlowInterval is the widest flow bucket accepted.
+	maxFlowInterval = 24 * time.Hour
+	// minFlowInterval is the narrowest flow bucket accepted; finer buckets
+	// would be narrower than the collection interval.
+	minFlowInterval = 5 * time.Minute
+)
+
+// FlowResponse represents estimated departures and arrivals in one interval.
+type FlowResponse struct {
+	Start      string `json:"start"`
+	Departures int    `json:"departures"`
+	Arrivals   int    `json:"arrivals"`
+	Rebalanced int    `json:"rebalanced"`
+}
+
+// StationFlowsResponse holds one station's flows, omitting intervals without activity.
+type StationFlowsResponse struct {
+	StationID int            `json:"stationId"`
+	Name      string         `json:"name"`
+	Flows     []FlowResponse `json:"flows"`
+}
+
+// FlowsResponse is the JSON response for the flows API.
+type FlowsResponse struct {
+	From     string                 `json:"from"`
+	To       string                 `json:"to"`
+	Interval string                 `json:"interval"`
+	Network  []FlowResponse         `json:"network"`
+	Stations []StationFlowsResponse `json:"stations"`
+}
+
+// handleFlows serves estimated departures and arrivals per station per interval.
+func (h *Handler) handleFlows(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultAnalyticsWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	interval := analytics.DefaultFlowInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minFlowInterval || d > maxFlowInterval {
+			httpError(w, r, "Invalid interval parameter", http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+	threshold, err := parseIntParam(r, "threshold", analytics.DefaultRebalanceThreshold)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	estimator := analytics.NewFlowEstimator(interval, threshold, loc)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, estimator); err != nil {
+		slog.Error("Failed to estimate flows", "error", err)
+		httpError(w, r, "Failed to compute analytics", http.StatusInternalServerError)
+		return
+	}
+
+	response := FlowsResponse{
+		From:     formatTime(from, loc),
+		To:       formatTime(to, loc),
+		Interval: interval.String(),
+		Network:  []FlowResponse{},
+		Stations: []StationFlowsResponse{},
+	}
+	for _, f := range estimator.NetworkFlows() {
+		response.Network = append(response.Network, flowResponse(f, loc))
+	}
+	for _, f := range estimator.StationFlows() {
+		if stationID != 0 && f.StationID != stationID {
+			continue
+		}
+		n := len(response.Stations)
+		if n == 0 || response.Stations[n-1].StationID != f.StationID {
+			response.Stations = append(response.Stations, StationFlowsResponse{StationID: f.StationID, Name: f.Name})
+			n++
+		}
+		response.Stations[n-1].Flows = append(response.Stations[n-1].Flows, flowResponse(f, loc))
+	}
+
+	writeJSON(w, response)
+}
+
+// flowResponse converts an estimated flow for the API.
+func flowResponse(f analytics.Flow, loc *time.Location) FlowResponse {
+	return FlowResponse{
+		Start:      formatTime(f.Start, loc),
+		Departures: f.Departures,
+		Arrivals:   f.Arrivals,
+		Rebalanced: f.Rebalanced,
+	}
+}
+
+// defaultEBikeWindow is the window used when an e-bike analysis request has no
+// from parameter; a week sees enough arrivals at quiet stations to rank them.
+const defaultEBikeWindow = 7 * 24 * time.Hour
+
+// BikeTypeStatsResponse describes one type of bike at a station or across the network.
+type BikeTypeStatsResponse struct {
+	AvgDocked    float64 `json:"avgDocked"`
+	PresentShare float64 `json:"presentShare"`
+	Arrivals     int     `json:"arrivals"`
+	Departures   int     `json:"departures"`
+	// AvgDwellMinutes approximates how long a bike stays docked
+	AvgDwellMinutes float64 `json:"avgDwellMinutes"`
+}
+
+// StationEBikesResponse compares e-bikes with standard bikes at a station.
+type StationEBikesResponse struct {
+	ID                int                   `json:"id"`
+	Name              string                `json:"name"`
+	Standard          BikeTypeStatsResponse `json:"standard"`
+	EBike             BikeTypeStatsResponse `json:"ebike"`
+	EBikeArrivalShare float64               `json:"ebikeArrivalShare"`
+}
+
+// HourEBikeShareResponse is the e-bike share of docked bikes in one local hour of the day.
+type HourEBikeShareResponse struct {
+	Hour       int     `json:"hour"`
+	Samples    int     `json:"samples"`
+	EBikeShare float64 `json:"ebikeShare"`
+}
+
+// EBikesResponse is the JSON response for the e-bike analysis API.
+type EBikesResponse struct {
+	From          string                   `json:"from"`
+	To            string                   `json:"to"`
+	SnapshotCount int                      `json:"snapshotCount"`
+	EBikeShare    float64                  `json:"ebikeShare"`
+	Standard      BikeTypeStatsResponse    `json:"standard"`
+	EBike         BikeTypeStatsResponse    `json:"ebike"`
+	ByHour        []HourEBikeShareResponse `json:"byHour"`
+	RarelyEBikes  []StationEBikesResponse  `json:"rarelyEBikes"`
+	Stations      []StationEBikesResponse  `json:"stations"`
+}
+
+// handleEBikes serves e-bike dynamics analyzed separately from standard bikes.
+func (h *Handler) handleEBikes(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultEBikeWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	top, err := parseTop(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	threshold, err := parseIntParam(r, "threshold", analytics.DefaultRebalanceThreshold)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	analyzer := analytics.NewEBikeAnalyzer(threshold, loc)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, analyzer); err != nil {
+		slog.Error("Failed to analyze e-bikes", "error", err)
+		httpError(w, r, "Failed to compute analytics", http.StatusInternalServerError)
+		return
+	}
+	report := analyzer.Result(top)
+
+	response := EBikesResponse{
+		From:          formatTime(from, loc),
+		To:            formatTime(to, loc),
+		SnapshotCount: report.SnapshotCount,
+		EBikeShare:    report.EBikeShare,
+		Standard:      bikeTypeStatsResponse(report.Standard),
+		EBike:         bikeTypeStatsResponse(report.EBike),
+		ByHour:        make([]HourEBikeShareResponse, len(report.ByHour)),
+		RarelyEBikes:  make([]StationEBikesResponse, len(report.RarelyEBikes)),
+		Stations:      []StationEBikesResponse{},
+	}
+	for i, hs := range report.ByHour {
+		response.ByHour[i] = HourEBikeShareResponse{Hour: hs.Hour, Samples: hs.Samples, EBikeShare: hs.EBikeShare}
+	}
+	for i, s := range report.RarelyEBikes {
+		response.RarelyEBikes[i] = stationEBikesResponse(s)
+	}
+	for _, s := range report.Stations {
+		if stationID == 0 || s.StationID == stationID {
+			response.Stations = append(response.Stations, stationEBikesResponse(s))
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// bikeTypeStatsResponse converts one bike type's statistics for the API.
+func bikeTypeStatsResponse(s analytics.BikeTypeStats) BikeTypeStatsResponse {
+	return BikeTypeStatsResponse{
+		AvgDocked:       s.AvgDocked,
+		PresentShare:    s.PresentShare,
+		Arrivals:        s.Arrivals,
+		Departures:      s.Departures,
+		AvgDwellMinutes: s.AvgDwell.Minutes(),
+	}
+}
+
+// stationEBikesResponse converts a station's e-bike comparison for the API.
+func stationEBikesResponse(s analytics.StationEBikes) StationEBikesResponse {
+	return StationEBikesResponse{
+		ID:                s.StationID,
+		Name:              s.Name,
+		Standard:          bikeTypeStatsResponse(s.Standard),
+		EBike:             bikeTypeStatsResponse(s.EBike),
+		EBikeArrivalShare: s.EBikeArrivalShare,
+	}
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// anomaliesKey is the object key under which detector state is recorded in the store.
+const anomaliesKey = "meta/anomalies.json"
+
+// loadAnomalies restores anomaly detector state previously recorded in the store.
+func (h *Handler) loadAnomalies(ctx context.Context) {
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok || h.replay != nil {
+		return
+	}
+
+	data, err := objects.GetObject(ctx, anomaliesKey)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.Error("Failed to load anomaly state", "key", anomaliesKey, "error", err)
+		}
+		return
+	}
+
+	detector := analytics.NewAnomalyDetector()
+	if err := json.Unmarshal(data, detector); err != nil {
+		slog.Error("Failed to parse anomaly state", "key", anomaliesKey, "error", err)
+		return
+	}
+
+	h.anomaliesMu.Lock()
+	h.anomalies = detector
+	h.anomalyStatus = detector.Anomalies()
+	h.dockAdjustment = detector.DockAdjustments()
+	h.anomaliesMu.Unlock()
+	slog.Info("Loaded anomaly state", "lastSeen", detector.LastSeen().Format(time.RFC3339))
+}
+
+// updateAnomalies feeds a new latest snapshot to the anomaly detector and records
+// the result in the store. Snapshots already seen are ignored.
+func (h *Handler) updateAnomalies(timestamp time.Time, stations []tfl.Station) {
+	h.anomaliesMu.Lock()
+	if !timestamp.After(h.anomalies.LastSeen()) {
+		h.anomaliesMu.Unlock()
+		return
+	}
+	h.anomalies.Add(storage.Snapshot{Timestamp: timestamp, Stations: stations})
+	h.anomalyStatus = h.anomalies.Anomalies()
+	h.dockAdjustment = h.anomalies.DockAdjustments()
+	data, err := json.Marshal(h.anomalies)
+	flagged := len(h.anomalyStatus)
+	h.anomaliesMu.Unlock()
+
+	if err != nil {
+		slog.Error("Failed to encode anomaly state", "error", err)
+		return
+	}
+
+	if objects, ok := h.store.(storage.ObjectStore); ok && h.replay == nil && !h.ReadOnly() {
+		if err := objects.PutObject(context.Background(), anomaliesKey, data, "application/json"); err != nil {
+			slog.Error("Failed to record anomaly state", "key", anomaliesKey, "error", err)
+			return
+		}
+	}
+	slog.Info("Anomaly detection updated", "flagged", flagged)
+}
+
+// stationStatus returns the anomaly status for a station in the latest snapshot.
+func (h *Handler) stationStatus(id int) (string, time.Time) {
+	h.anomaliesMu.Lock()
+	defer h.anomaliesMu.Unlock()
+
+	if a, ok := h.anomalyStatus[id]; ok {
+		return a.Status, a.Since
+	}
+	return analytics.StatusOK, time.Time{}
+}
+
+// stationDockAdjustment returns the free dock adjustment for a station in the
+// latest snapshot, if its docks are presumed broken.
+func (h *Handler) stationDockAdjustment(id int) (analytics.DockAdjustment, bool) {
+	h.anomaliesMu.Lock()
+	defer h.anomaliesMu.Unlock()
+
+	adj, ok := h.dockAdjustment[id]
+	return adj, ok
+}
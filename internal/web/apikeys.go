@@ -0,0 +1,196 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeyRatePerMinute is the per-key request rate when a key doesn't set one.
+	DefaultKeyRatePerMinute = 30
+	// DefaultKeyBurst is the per-key burst size when a key doesn't set one.
+	DefaultKeyBurst = 10
+)
+
+// APIKey grants access to protected endpoints, subject to its own rate limit.
+type APIKey struct {
+	Name          string  `json:"name"`
+	Key           string  `json:"key"`
+	RatePerMinute float64 `json:"ratePerMinute,omitempty"`
+	Burst         int     `json:"burst,omitempty"`
+}
+
+// LoadAPIKeys reads API keys from a JSON file containing an array of keys.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+	for i, k := range keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("API key %d: missing key", i)
+		}
+	}
+	return keys, nil
+}
+
+// ParseAPIKeys parses keys from a comma-separated list of name:key pairs,
+// as used by the API_KEYS environment variable.
+func ParseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(pair, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid API key entry %q (expected name:key)", name)
+		}
+		keys = append(keys, APIKey{Name: name, Key: key})
+	}
+	return keys, nil
+}
+
+// KeyUsage holds usage counters for an API key.
+type KeyUsage struct {
+	Name        string    `json:"name"`
+	Requests    int64     `json:"requests"`
+	RateLimited int64     `json:"rateLimited"`
+	LastUsed    time.Time `json:"lastUsed"`
+}
+
+// keyState is the runtime state of a single API key.
+type keyState struct {
+	key    APIKey
+	bucket *tokenBucket
+	usage  KeyUsage
+}
+
+// apiKeyAuth validates keys and enforces per-key rate limits.
+type apiKeyAuth struct {
+	mu   sync.Mutex
+	keys []*keyState
+}
+
+// EnableAPIKeys requires one of keys on protected endpoints. Call before serving requests.
+func (h *Handler) EnableAPIKeys(keys []APIKey) {
+	now := time.Now()
+	auth := &apiKeyAuth{}
+	for _, k := range keys {
+		if k.RatePerMinute <= 0 {
+			k.RatePerMinute = DefaultKeyRatePerMinute
+		}
+		if k.Burst <= 0 {
+			k.Burst = DefaultKeyBurst
+		}
+		auth.keys = append(auth.keys, &keyState{
+			key:    k,
+			bucket: newTokenBucket(k.RatePerMinute, k.Burst, now),
+			usage:  KeyUsage{Name: k.Name},
+		})
+	}
+	h.apiKeys = auth
+}
+
+// lookup finds the state for a presented key using a constant-time comparison.
+func (a *apiKeyAuth) lookup(presented string) *keyState {
+	var found *keyState
+	for _, ks := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(ks.key.Key), []byte(presented)) == 1 {
+			found = ks
+		}
+	}
+	return found
+}
+
+// presentedKey extracts an API key from the X-API-Key header, a Bearer token,
+// or the api_key query parameter.
+func presentedKey(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// withAPIKey requires a valid API key within its rate limit when keys are enabled.
+func (h *Handler) withAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.apiKeys == nil {
+			next(w, r)
+			return
+		}
+
+		presented := presentedKey(r)
+		if presented == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="city-cycling"`)
+			httpError(w, r, "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		a := h.apiKeys
+		a.mu.Lock()
+		ks := a.lookup(presented)
+		if ks == nil {
+			a.mu.Unlock()
+			httpError(w, r, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		allowed, wait := ks.bucket.allow(now)
+		ks.usage.LastUsed = now
+		if allowed {
+			ks.usage.Requests++
+		} else {
+			ks.usage.RateLimited++
+		}
+		a.mu.Unlock()
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			httpError(w, r, "Rate limit exceeded for API key", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleKeyUsage returns usage counters for the calling API key.
+func (h *Handler) handleKeyUsage(w http.ResponseWriter, r *http.Request) {
+	if h.apiKeys == nil {
+		httpError(w, r, "API keys are not enabled", http.StatusNotFound)
+		return
+	}
+
+	a := h.apiKeys
+	a.mu.Lock()
+	ks := a.lookup(presentedKey(r))
+	var usage KeyUsage
+	if ks != nil {
+		usage = ks.usage
+	}
+	a.mu.Unlock()
+
+	if ks == nil {
+		httpError(w, r, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, usage)
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+
+	"city-cycling/internal/geo"
+)
+
+// AreaResponse is the latest availability of the stations in one area.
+type AreaResponse struct {
+	Name       string  `json:"name"`
+	Stations   int     `json:"stations"`
+	Bikes      int     `json:"bikes"`
+	EBikes     int     `json:"ebikes"`
+	EmptyDocks int     `json:"emptyDocks"`
+	Docks      int     `json:"docks"`
+	Occupancy  float64 `json:"occupancy"`
+	// SquareKm is the area's size; the densities divide by it, so that areas
+	// of different sizes compare.
+	SquareKm            float64 `json:"squareKm"`
+	StationsPerSquareKm float64 `json:"stationsPerSquareKm"`
+	DocksPerSquareKm    float64 `json:"docksPerSquareKm"`
+	// Bounds is south, west, north, east.
+	Bounds [4]float64 `json:"bounds"`
+}
+
+// AreasResponse is the JSON response for the areas API.
+type AreasResponse struct {
+	Timestamp string         `json:"timestamp"`
+	Areas     []AreaResponse `json:"areas"`
+	// Unassigned counts the stations outside every area.
+	Unassigned int `json:"unassigned"`
+}
+
+// AreaStationsResponse is the JSON response for an area's stations.
+type AreaStationsResponse struct {
+	Timestamp string            `json:"timestamp"`
+	Area      AreaResponse      `json:"area"`
+	Stations  []StationResponse `json:"stations"`
+}
+
+// SetAreas sets the boroughs or neighbourhoods stations are grouped by in
+// /areas, /query and the station listings. Without areas those are not served.
+func (h *Handler) SetAreas(areas *geo.Areas) {
+	h.areas = areas
+}
+
+// handleAreas serves the latest availability aggregated by area.
+func (h *Handler) handleAreas(w http.ResponseWriter, r *http.Request) {
+	if h.areas == nil {
+		httpError(w, r, "No areas configured", http.StatusNotImplemented)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+
+	totals, unassigned := h.areas.Totals(stations)
+	response := AreasResponse{
+		Timestamp:  timestamp.Format("2006-01-02T15:04:05Z"),
+		Areas:      make([]AreaResponse, len(totals)),
+		Unassigned: unassigned,
+	}
+	for i, t := range totals {
+		response.Areas[i] = areaResponse(t)
+	}
+
+	writeJSON(w, response)
+}
+
+// handleAreaStations serves the latest availability of the stations in one area.
+func (h *Handler) handleAreaStations(w http.ResponseWriter, r *http.Request) {
+	if h.areas == nil {
+		httpError(w, r, "No areas configured", http.StatusNotImplemented)
+		return
+	}
+	area, ok := h.areas.Area(r.PathValue("area"))
+	if !ok {
+		httpError(w, r, "Area not found", http.StatusNotFound)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+
+	all := h.stationsResponse(stations, timestamp)
+	response := AreaStationsResponse{
+		Timestamp: all.Timestamp,
+		Stations:  []StationResponse{},
+	}
+	totals := geo.AreaTotals{Area: area}
+	for i, s := range stations {
+		if all.Stations[i].Area != area.Name {
+			continue
+		}
+		response.Stations = append(response.Stations, all.Stations[i])
+		totals.Stations++
+		totals.Bikes += s.NbBikes
+		totals.EBikes += s.NbEBikes
+		totals.EmptyDocks += s.NbEmptyDocks
+		totals.Docks += s.NbDocks
+	}
+	response.Area = areaResponse(totals)
+
+	writeJSON(w, response)
+}
+
+// stationArea returns the name of the area a station is in, or "" when it is
+// in none or no areas are configured.
+func (h *Handler) stationArea(lat, lng float64) string {
+	if h.areas == nil {
+		return ""
+	}
+	return h.areas.Locate(lat, lng)
+}
+
+// areaResponse converts an area's totals for the API.
+func areaResponse(t geo.AreaTotals) AreaResponse {
+	a := t.Area
+	response := AreaResponse{
+		Name:       a.Name,
+		Stations:   t.Stations,
+		Bikes:      t.Bikes,
+		EBikes:     t.EBikes,
+		EmptyDocks: t.EmptyDocks,
+		Docks:      t.Docks,
+		Occupancy:  math.Round(t.Occupancy()*1000) / 1000,
+		SquareKm:   math.Round(a.SquareKm*100) / 100,
+		Bounds:     [4]float64{a.South, a.West, a.North, a.East},
+	}
+	if a.SquareKm > 0 {
+		response.StationsPerSquareKm = math.Round(float64(t.Stations)/a.SquareKm*100) / 100
+		response.DocksPerSquareKm = math.Round(float64(t.Docks)/a.SquareKm*100) / 100
+	}
+	return response
+}
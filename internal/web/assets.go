@@ -0,0 +1,95 @@
+package web
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// staticPrefix is the path the map's JS and CSS are served under.
+const staticPrefix = "/static/"
+
+//go:embed static/*
+var staticFS embed.FS
+
+// staticAsset is an embedded file and its fingerprinted name.
+type staticAsset struct {
+	name        string // e.g. map.1a2b3c4d5e6f.js
+	data        []byte
+	contentType string
+	etag        string
+}
+
+// staticAssets holds the embedded assets by both their plain and fingerprinted names.
+type staticAssets struct {
+	byName map[string]*staticAsset
+	// fingerprinted maps plain names to fingerprinted ones.
+	fingerprinted map[string]string
+}
+
+// loadStaticAssets reads and fingerprints every embedded asset.
+func loadStaticAssets() (*staticAssets, error) {
+	assets := &staticAssets{byName: make(map[string]*staticAsset), fingerprinted: make(map[string]string)}
+	entries, err := fs.ReadDir(staticFS, "static")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list static assets: %w", err)
+	}
+	for _, e := range entries {
+		data, err := staticFS.ReadFile("static/" + e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read static asset: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:6])
+		ext := path.Ext(e.Name())
+		a := &staticAsset{
+			name:        strings.TrimSuffix(e.Name(), ext) + "." + hash + ext,
+			data:        data,
+			contentType: mime.TypeByExtension(ext),
+			etag:        `"` + hash + `"`,
+		}
+		assets.byName[e.Name()] = a
+		assets.byName[a.name] = a
+		assets.fingerprinted[e.Name()] = a.name
+	}
+	return assets, nil
+}
+
+// url returns the fingerprinted URL of the asset named name, for templates.
+func (s *staticAssets) url(name string) (string, error) {
+	fingerprinted, ok := s.fingerprinted[name]
+	if !ok {
+		return "", fmt.Errorf("unknown static asset %q", name)
+	}
+	return staticPrefix + fingerprinted, nil
+}
+
+// handleStatic serves the embedded assets. Fingerprinted names never change
+// content, so they may be cached for a year; plain names must be revalidated.
+func (h *Handler) handleStatic(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, staticPrefix)
+	a, ok := h.assets.byName[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == a.name {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if a.contentType != "" {
+		w.Header().Set("Content-Type", a.contentType)
+	}
+	if checkETag(w, r, a.etag) {
+		return
+	}
+	w.Write(a.data)
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/registry"
+	"city-cycling/internal/storage"
+)
+
+// maxAttributesBody bounds the size of an attribute edit request.
+const maxAttributesBody = 64 << 10
+
+// StationAttributesResponse is one station's attributes in the admin API.
+type StationAttributesResponse struct {
+	ID         int               `json:"id"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// AttributesListResponse is the JSON response for listing station attributes.
+type AttributesListResponse struct {
+	Revision int64                       `json:"revision"`
+	Stations []StationAttributesResponse `json:"stations"`
+}
+
+// newStationAttributes returns the attribute store for store, or nil if the
+// backend cannot hold one.
+func newStationAttributes(store storage.DataStore) *registry.Attributes {
+	objects, ok := store.(storage.ObjectStore)
+	if !ok {
+		return nil
+	}
+	return registry.NewAttributes(objects)
+}
+
+// reloadAttributes picks up attribute edits made through other servers.
+func (h *Handler) reloadAttributes(ctx context.Context) {
+	if h.attributes == nil {
+		return
+	}
+	if err := h.attributes.Reload(ctx); err != nil {
+		slog.Error("Failed to load station attributes", "key", registry.AttributesKey, "error", err)
+	}
+}
+
+// stationAttributes returns the attributes of a station, or nil if it has none.
+func (h *Handler) stationAttributes(id int) map[string]string {
+	if h.attributes == nil {
+		return nil
+	}
+	return h.attributes.Station(id)
+}
+
+// attributesRevision returns how often the station attributes were edited.
+func (h *Handler) attributesRevision() int64 {
+	if h.attributes == nil {
+		return 0
+	}
+	return h.attributes.Revision()
+}
+
+// attributeStore returns the attribute store, or writes an error if the
+// backend cannot hold one.
+func (h *Handler) attributeStore(w http.ResponseWriter, r *http.Request) (*registry.Attributes, bool) {
+	if h.attributes == nil {
+		httpError(w, r, "Station attributes not available with current storage backend", http.StatusNotImplemented)
+		return nil, false
+	}
+	return h.attributes, true
+}
+
+// attributesStationID parses the {id} path value.
+func attributesStationID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid station id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// handleAdminListAttributes lists every station with attributes, by ID.
+func (h *Handler) handleAdminListAttributes(w http.ResponseWriter, r *http.Request, admin string) {
+	attributes, ok := h.attributeStore(w, r)
+	if !ok {
+		return
+	}
+	h.reloadAttributes(r.Context())
+
+	all := attributes.All()
+	response := AttributesListResponse{
+		Revision: attributes.Revision(),
+		Stations: make([]StationAttributesResponse, 0, len(all)),
+	}
+	for id, attrs := range all {
+		response.Stations = append(response.Stations, StationAttributesResponse{ID: id, Attributes: attrs})
+	}
+	sort.Slice(response.Stations, func(i, j int) bool { return response.Stations[i].ID < response.Stations[j].ID })
+	writeJSON(w, response)
+}
+
+// handleAdminGetAttributes returns one station's attributes.
+func (h *Handler) handleAdminGetAttributes(w http.ResponseWriter, r *http.Request, admin string) {
+	attributes, ok := h.attributeStore(w, r)
+	if !ok {
+		return
+	}
+	id, ok := attributesStationID(w, r)
+	if !ok {
+		return
+	}
+	h.reloadAttributes(r.Context())
+	writeJSON(w, stationAttributesResponse(id, attributes.Station(id)))
+}
+
+// handleAdminSetAttributes edits one station's attributes from a JSON object
+// of string values: PUT replaces them all, PATCH merges them, an empty value
+// removing its key.
+func (h *Handler) handleAdminSetAttributes(w http.ResponseWriter, r *http.Request, admin string) {
+	attributes, ok := h.attributeStore(w, r)
+	if !ok {
+		return
+	}
+	id, ok := attributesStationID(w, r)
+	if !ok {
+		return
+	}
+
+	var attrs map[string]string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAttributesBody)).Decode(&attrs); err != nil {
+		httpError(w, r, "Invalid attributes (expected a JSON object of strings)", http.StatusBadRequest)
+		return
+	}
+	h.updateAttributes(w, r, admin, attributes, id, attrs, r.Method == http.MethodPut)
+}
+
+// handleAdminDeleteAttributes removes every attribute of one station.
+func (h *Handler) handleAdminDeleteAttributes(w http.ResponseWriter, r *http.Request, admin string) {
+	attributes, ok := h.attributeStore(w, r)
+	if !ok {
+		return
+	}
+	id, ok := attributesStationID(w, r)
+	if !ok {
+		return
+	}
+	h.updateAttributes(w, r, admin, attributes, id, nil, true)
+}
+
+// updateAttributes applies an edit to a station's attributes, audits it and
+// writes the attributes that result.
+func (h *Handler) updateAttributes(w http.ResponseWriter, r *http.Request, admin string, attributes *registry.Attributes, id int, attrs map[string]string, replace bool) {
+	ctx := context.WithoutCancel(r.Context())
+	result, err := attributes.Set(ctx, id, attrs, replace)
+	if errors.Is(err, registry.ErrInvalidAttribute) {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		httpError(w, r, "Station attributes are being edited concurrently, try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to save station attributes", "station", id, "admin", admin, "error", err)
+		httpError(w, r, "Failed to save station attributes", http.StatusInternalServerError)
+		return
+	}
+
+	action := "set_attributes"
+	if attrs == nil {
+		action = "delete_attributes"
+	}
+	h.recordAudit(r, auditRecord{
+		Time:      time.Now().UTC(),
+		Admin:     admin,
+		Action:    action,
+		City:      h.city.ID,
+		Key:       registry.AttributesKey,
+		StationID: id,
+		Remote:    r.RemoteAddr,
+	})
+	writeJSON(w, stationAttributesResponse(id, result))
+}
+
+// stationAttributesResponse converts a station's attributes for the admin API.
+func stationAttributesResponse(id int, attrs map[string]string) StationAttributesResponse {
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	return StationAttributesResponse{ID: id, Attributes: attrs}
+}
@@ -0,0 +1,173 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/cache"
+	"city-cycling/internal/city"
+	"city-cycling/internal/storage"
+)
+
+// CityResponse describes one city served by the deployment.
+type CityResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	FeedType string `json:"feedType"`
+	Timezone string `json:"timezone"`
+	// API is the prefix of the city's API routes, e.g. /api/v1/manchester.
+	API string `json:"api"`
+	// Map is the path of the city's map page.
+	Map string `json:"map"`
+}
+
+// CitiesResponse is the JSON response for the cities API.
+type CitiesResponse struct {
+	Cities []CityResponse `json:"cities"`
+}
+
+// mapPage is the data the map template is rendered with.
+type mapPage struct {
+	Title string
+	// APIBase is the prefix the page fetches station data from.
+	APIBase string
+	// FeedURL is the city's Atom feed of network events.
+	FeedURL string
+	// FitBounds zooms the map to the stations instead of the London default view.
+	FitBounds bool
+	// InitialStations is the latest snapshot, inlined to save the page a
+	// request; nil makes the page fetch it.
+	InitialStations *StationsResponse
+}
+
+// mapPage returns the map template data for the handler's city mounted at mount.
+func (h *Handler) mapPage(ctx context.Context, mount string) mapPage {
+	page := mapPage{
+		Title:     h.city.Name,
+		APIBase:   basePath(ctx) + apiRoot + "/" + currentAPIVersion + mount,
+		FeedURL:   basePath(ctx) + mount + "/feed.xml",
+		FitBounds: h.city.FeedType != city.FeedTFL,
+	}
+	if stations, timestamp, err := h.latestSnapshot(ctx); err == nil {
+		response := h.stationsResponse(stations, timestamp)
+		page.InitialStations = &response
+	}
+	return page
+}
+
+// SetCities records every city of a multi-city deployment. The handler serves
+// the first, at the unprefixed routes and under its own ID. Call it before ForCity.
+func (h *Handler) SetCities(cities []city.City) {
+	h.cities = cities
+	if len(cities) > 0 {
+		h.city = cities[0]
+		h.mountPath = "/" + cities[0].ID
+		h.location = cities[0].Location()
+	}
+}
+
+// SetTimezone sets the time zone bucketed analytics and timestamps use when a
+// request has no tz parameter. It defaults to the city's time zone.
+func (h *Handler) SetTimezone(loc *time.Location) {
+	h.location = loc
+}
+
+// ForCity returns a handler serving c from store, to be mounted with
+// RegisterCityRoutes. It shares CORS, API key, admin key, rate limit and mode
+// state with h, so enable those on h first; caches and the latest snapshot
+// are its own, with the default snapshot cache limits.
+func (h *Handler) ForCity(c city.City, store storage.DataStore) *Handler {
+	return &Handler{
+		store:         store,
+		feed:          c.NewFeed(),
+		templates:     h.templates,
+		assets:        h.assets,
+		cors:          h.cors,
+		apiKeys:       h.apiKeys,
+		adminKeys:     h.adminKeys,
+		ipLimiter:     h.ipLimiter,
+		loadLimiter:   h.loadLimiter,
+		mode:          h.mode,
+		city:          c,
+		mountPath:     "/" + c.ID,
+		location:      c.Location(),
+		cities:        h.cities,
+		snapshotCache: cache.NewMemory(DefaultSnapshotCacheEntries, DefaultSnapshotCacheBytes),
+		anomalies:     analytics.NewAnomalyDetector(),
+		heatmapCache:  make(map[int]heatmapCacheEntry),
+		clusterCache:  make(map[int]clusterCacheEntry),
+		tileCache:     cache.NewMemory(tileCacheEntries, tileCacheBytes),
+		attributes:    newStationAttributes(store),
+		columnar:      newColumnarEngine(store),
+		prefetch:      make(chan time.Time, prefetchQueue),
+	}
+}
+
+// RegisterCityRoutes mounts the handler's city: its map at /{city}/, its status
+// page at /{city}/status, its event feed at /{city}/feed.xml, its vector tiles
+// at /{city}/tiles/... and every API version at /api/{version}/{city}/...,
+// plus the deprecated /api/{city}/... aliases. It fails if the city ID would
+// shadow an existing route.
+func (h *Handler) RegisterCityRoutes(mux *http.ServeMux) error {
+	id := strings.TrimPrefix(h.mountPath, "/")
+	if reserved := h.reservedSegments(); reserved[id] {
+		return fmt.Errorf("city id %q clashes with an API route", id)
+	}
+
+	mux.HandleFunc(h.mountPath+"/", h.withLogging(h.handleMap(h.mountPath)))
+	mux.HandleFunc("GET "+h.mountPath+"/status", h.withLogging(h.withIPRateLimit(h.handleStatusPage(h.mountPath))))
+	mux.HandleFunc("GET "+h.mountPath+"/feed.xml", h.withLogging(h.withIPRateLimit(withCompression(h.handleFeed(h.mountPath)))))
+	mux.HandleFunc("GET "+h.mountPath+"/tiles/{z}/{x}/{y}", h.api(h.handleStationTile))
+	h.registerAPI(mux, h.mountPath)
+	h.registerAdmin(mux, h.mountPath)
+	return nil
+}
+
+// reservedSegments returns the first path segments used by the API, which
+// city IDs must not take.
+func (h *Handler) reservedSegments() map[string]bool {
+	reserved := map[string]bool{
+		strings.TrimPrefix(apiRoot, "/"):   true,
+		"openapi.json":                     true,
+		"docs":                             true,
+		strings.TrimPrefix(adminRoot, "/"): true,
+		strings.Trim(staticPrefix, "/"):    true,
+	}
+	for _, v := range h.apiVersions() {
+		reserved[v.Name] = true
+		for _, rt := range v.Routes {
+			segment, _, _ := strings.Cut(strings.TrimPrefix(rt.Path, "/"), "/")
+			reserved[segment] = true
+		}
+	}
+	return reserved
+}
+
+// handleCities lists the cities served by the deployment.
+func (h *Handler) handleCities(w http.ResponseWriter, r *http.Request) {
+	var response CitiesResponse
+	if len(h.cities) == 0 {
+		// Single-city deployment served at the unprefixed routes only
+		response.Cities = []CityResponse{cityResponse(h.city, basePath(r.Context()))}
+	}
+	for _, c := range h.cities {
+		response.Cities = append(response.Cities, cityResponse(c, basePath(r.Context())+"/"+c.ID))
+	}
+	writeJSON(w, response)
+}
+
+// cityResponse describes c mounted at mount.
+func cityResponse(c city.City, mount string) CityResponse {
+	return CityResponse{
+		ID:       c.ID,
+		Name:     c.Name,
+		FeedType: c.FeedType,
+		Timezone: c.Timezone,
+		API:      apiRoot + "/" + currentAPIVersion + mount,
+		Map:      mount + "/",
+	}
+}
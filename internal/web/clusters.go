@@ -0,0 +1,129 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/geo"
+)
+
+// defaultClusterZoom is the map zoom used when a clusters request has no zoom parameter.
+const defaultClusterZoom = 12
+
+// ClusterResponse is a marker standing for one or more nearby stations.
+type ClusterResponse struct {
+	Lat      float64    `json:"lat"`
+	Lng      float64    `json:"lng"`
+	Bounds   [4]float64 `json:"bounds"` // south, west, north, east of its stations
+	Stations int        `json:"stations"`
+	// StationID is set when the marker is a single station.
+	StationID  int     `json:"stationId,omitempty"`
+	Bikes      int     `json:"bikes"`
+	EBikes     int     `json:"ebikes"`
+	EmptyDocks int     `json:"emptyDocks"`
+	Docks      int     `json:"docks"`
+	Occupancy  float64 `json:"occupancy"`
+}
+
+// ClustersResponse is the JSON response for the station clustering API.
+type ClustersResponse struct {
+	Timestamp string            `json:"timestamp"`
+	Zoom      int               `json:"zoom"`
+	Clusters  []ClusterResponse `json:"clusters"`
+}
+
+// clusterCacheEntry holds the clusters computed for one zoom level of a snapshot.
+type clusterCacheEntry struct {
+	timestamp time.Time
+	clusters  []geo.Cluster
+}
+
+// handleStationClusters serves the latest snapshot's stations grouped into
+// map markers for a zoom level, optionally only those in a bounding box.
+func (h *Handler) handleStationClusters(w http.ResponseWriter, r *http.Request) {
+	zoom := defaultClusterZoom
+	if v := r.URL.Query().Get("zoom"); v != "" {
+		z, err := strconv.Atoi(v)
+		if err != nil || z < 0 || z > geo.MaxZoom {
+			httpError(w, r, "Invalid zoom parameter", http.StatusBadRequest)
+			return
+		}
+		zoom = z
+	}
+	bbox, err := parseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+
+	// Clusters only change when a new snapshot arrives
+	h.clusterCacheMu.Lock()
+	entry, hit := h.clusterCache[zoom]
+	if !hit || !entry.timestamp.Equal(timestamp) {
+		entry = clusterCacheEntry{timestamp: timestamp, clusters: geo.Clusters(stations, zoom)}
+		h.clusterCache[zoom] = entry
+	}
+	h.clusterCacheMu.Unlock()
+
+	response := ClustersResponse{
+		Timestamp: timestamp.Format("2006-01-02T15:04:05Z"),
+		Zoom:      zoom,
+		Clusters:  []ClusterResponse{},
+	}
+	for _, c := range entry.clusters {
+		if bbox != nil && !c.Contains(bbox[0], bbox[1], bbox[2], bbox[3]) {
+			continue
+		}
+		response.Clusters = append(response.Clusters, ClusterResponse{
+			Lat:        c.Lat,
+			Lng:        c.Lng,
+			Bounds:     [4]float64{c.South, c.West, c.North, c.East},
+			Stations:   c.Stations,
+			StationID:  c.StationID,
+			Bikes:      c.Bikes,
+			EBikes:     c.EBikes,
+			EmptyDocks: c.EmptyDocks,
+			Docks:      c.Docks,
+			Occupancy:  c.Occupancy(),
+		})
+	}
+
+	writeJSON(w, response)
+}
+
+// parseBBox parses a bbox parameter given as west,south,east,north in degrees,
+// the order of Leaflet's toBBoxString, into south, west, north, east. An empty
+// parameter returns nil.
+func parseBBox(v string) (*[4]float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("Invalid bbox parameter (use west,south,east,north)")
+	}
+	var edges [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bbox parameter (use west,south,east,north)")
+		}
+		edges[i] = f
+	}
+	west, south, east, north := edges[0], edges[1], edges[2], edges[3]
+	if south > north || west > east || south < -90 || north > 90 || west < -180 || east > 180 {
+		return nil, fmt.Errorf("Invalid bbox parameter (use west,south,east,north)")
+	}
+	return &[4]float64{south, west, north, east}, nil
+}
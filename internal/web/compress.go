@@ -0,0 +1,145 @@
+package web
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	flatePool = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}}
+)
+
+// withCompression compresses responses with gzip or deflate when the client accepts it.
+func withCompression(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next(cw, r)
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip. It returns "" if neither is acceptable.
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// compressResponseWriter compresses the body written through it.
+// The compressor is only started once body bytes are written, so responses
+// without a body (such as 304s) are passed through untouched.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	// Byte ranges are of the identity body, and keep its strong ETag for If-Range
+	if code == http.StatusPartialContent || cw.Header().Get("Content-Encoding") != "" {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	// The compressed body is a different representation from the one the
+	// strong ETag was computed for; 304s answer for the compressed one too
+	weakenETag(cw.Header())
+	if code != http.StatusNoContent && code != http.StatusNotModified {
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		cw.Header().Del("Content-Length")
+		cw.start()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.writer == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.writer.Write(b)
+}
+
+// weakenETag marks a strong ETag in header as weak. checkETag compares
+// If-None-Match weakly, so revalidation still matches.
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// start takes a compressor from the pool and points it at the underlying writer.
+func (cw *compressResponseWriter) start() {
+	switch cw.encoding {
+	case "gzip":
+		gw := gzipPool.Get().(*gzip.Writer)
+		gw.Reset(cw.ResponseWriter)
+		cw.writer = gw
+	case "deflate":
+		fw := flatePool.Get().(*flate.Writer)
+		fw.Reset(cw.ResponseWriter)
+		cw.writer = fw
+	}
+}
+
+// Close flushes the compressor and returns it to the pool.
+func (cw *compressResponseWriter) Close() {
+	if cw.writer == nil {
+		return
+	}
+	cw.writer.Close()
+	switch w := cw.writer.(type) {
+	case *gzip.Writer:
+		gzipPool.Put(w)
+	case *flate.Writer:
+		flatePool.Put(w)
+	}
+	cw.writer = nil
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig controls cross-origin access to /api/* routes.
+type CORSConfig struct {
+	AllowedOrigins []string // exact origins, or "*" for any
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+// DefaultCORSMethods are the methods allowed when none are configured.
+var DefaultCORSMethods = []string{http.MethodGet, http.MethodOptions}
+
+// EnableCORS turns on CORS handling for API routes. Call before serving requests.
+func (h *Handler) EnableCORS(cfg CORSConfig) {
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = DefaultCORSMethods
+	}
+	h.cors = &cfg
+}
+
+// Middleware wraps the mux with behaviour that must run before routing,
+// such as assigning request IDs, recovering from panics, answering CORS preflight requests for any
+// API path and turning requests away in maintenance mode.
+func (h *Handler) Middleware(next http.Handler) http.Handler {
+	return withRequestID(withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.cors != nil && strings.HasPrefix(r.URL.Path, "/api/") {
+			if h.applyCORS(w, r) {
+				return
+			}
+		}
+		if h.serveMaintenance(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})))
+}
+
+// applyCORS sets CORS headers for allowed origins. It returns true if the request
+// was a preflight and has been fully answered.
+func (h *Handler) applyCORS(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !h.originAllowed(origin) {
+		return false
+	}
+
+	if h.allowsAnyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, "+requestIDHeader+", "+staleHeader)
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	// Preflight request
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(h.cors.AllowedMethods, ", "))
+	if len(h.cors.AllowedHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(h.cors.AllowedHeaders, ", "))
+	} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if h.cors.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(h.cors.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (h *Handler) originAllowed(origin string) bool {
+	for _, o := range h.cors.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) allowsAnyOrigin() bool {
+	for _, o := range h.cors.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"cmp"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+const (
+	// dashboardSparkline is the span of the dashboard's bike total sparkline,
+	// one point per dashboardSparklineStep.
+	dashboardSparkline     = 24 * time.Hour
+	dashboardSparklineStep = time.Hour
+	// dashboardTop is how many of the emptiest and fullest stations are listed.
+	dashboardTop = 5
+)
+
+// DashboardTotals sums the latest snapshot across stations.
+type DashboardTotals struct {
+	Stations      int     `json:"stations"`
+	Bikes         int     `json:"bikes"`
+	StandardBikes int     `json:"standardBikes"`
+	EBikes        int     `json:"ebikes"`
+	EmptyDocks    int     `json:"emptyDocks"`
+	Docks         int     `json:"docks"`
+	Occupancy     float64 `json:"occupancy"`
+	// EmptyStations have no bikes and FullStations no empty docks.
+	EmptyStations int `json:"emptyStations"`
+	FullStations  int `json:"fullStations"`
+}
+
+// SparklinePoint is the mean bike total over one step of the sparkline.
+type SparklinePoint struct {
+	Timestamp string `json:"timestamp"`
+	Bikes     int    `json:"bikes"`
+}
+
+// DashboardStationResponse is a station listed as one of the emptiest or fullest.
+type DashboardStationResponse struct {
+	StationID  int     `json:"stationId"`
+	Name       string  `json:"name"`
+	Bikes      int     `json:"bikes"`
+	EmptyDocks int     `json:"emptyDocks"`
+	Docks      int     `json:"docks"`
+	Occupancy  float64 `json:"occupancy"`
+}
+
+// DashboardResponse is the JSON response for the dashboard API: everything the
+// homepage shows, in one request.
+type DashboardResponse struct {
+	Timestamp string `json:"timestamp"`
+	// AgeSeconds is how long ago the latest snapshot was taken.
+	AgeSeconds float64         `json:"ageSeconds"`
+	Totals     DashboardTotals `json:"totals"`
+	// Sparkline holds hourly mean bike totals over the last 24 hours of
+	// history, oldest first; it is empty without historical data.
+	Sparkline []SparklinePoint           `json:"sparkline"`
+	Emptiest  []DashboardStationResponse `json:"emptiest"`
+	Fullest   []DashboardStationResponse `json:"fullest"`
+}
+
+// handleDashboard serves the homepage's totals, sparkline and emptiest and
+// fullest stations for the latest snapshot.
+func (h *Handler) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+
+	response := DashboardResponse{
+		Timestamp:  formatTime(timestamp, loc),
+		AgeSeconds: math.Round(time.Since(timestamp).Seconds()),
+		Totals:     dashboardTotals(stations),
+		Sparkline:  []SparklinePoint{},
+		Emptiest:   []DashboardStationResponse{},
+		Fullest:    []DashboardStationResponse{},
+	}
+
+	// The sparkline is decoration: without history the rest still renders
+	if store, ok := h.store.(storage.HistoricalDataStore); ok {
+		from := timestamp.Add(-dashboardSparkline)
+		points, stale, err := h.historyWindow(r.Context(), store, from, timestamp)
+		if err != nil {
+			slog.Warn("Failed to get historical data for dashboard", "error", err)
+		} else {
+			if stale {
+				w.Header().Set(staleHeader, "true")
+			}
+			response.Sparkline = sparkline(points, from, timestamp, loc)
+		}
+	}
+
+	// Stations without docks are out of service, neither empty nor full
+	var ranked []tfl.Station
+	for _, s := range stations {
+		if s.NbDocks > 0 {
+			ranked = append(ranked, s)
+		}
+	}
+	slices.SortFunc(ranked, func(a, b tfl.Station) int {
+		return cmp.Or(cmp.Compare(occupancy(a), occupancy(b)), cmp.Compare(a.NbBikes, b.NbBikes), cmp.Compare(a.ID, b.ID))
+	})
+	for _, s := range ranked[:min(len(ranked), dashboardTop)] {
+		response.Emptiest = append(response.Emptiest, dashboardStation(s))
+	}
+	slices.SortFunc(ranked, func(a, b tfl.Station) int {
+		return cmp.Or(cmp.Compare(occupancy(b), occupancy(a)), cmp.Compare(a.NbEmptyDocks, b.NbEmptyDocks), cmp.Compare(a.ID, b.ID))
+	})
+	for _, s := range ranked[:min(len(ranked), dashboardTop)] {
+		response.Fullest = append(response.Fullest, dashboardStation(s))
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	writeJSON(w, response)
+}
+
+// dashboardTotals sums stations' availability.
+func dashboardTotals(stations []tfl.Station) DashboardTotals {
+	var t DashboardTotals
+	for _, s := range stations {
+		t.Stations++
+		t.Bikes += s.NbBikes
+		t.StandardBikes += s.NbStandardBikes
+		t.EBikes += s.NbEBikes
+		t.EmptyDocks += s.NbEmptyDocks
+		t.Docks += s.NbDocks
+		if s.NbDocks == 0 {
+			continue
+		}
+		if s.NbBikes == 0 {
+			t.EmptyStations++
+		}
+		if s.NbEmptyDocks == 0 {
+			t.FullStations++
+		}
+	}
+	if t.Docks > 0 {
+		t.Occupancy = math.Round(float64(t.Bikes)/float64(t.Docks)*1000) / 1000
+	}
+	return t
+}
+
+// sparkline averages the bike totals of the history points in [from, to]
+// over each dashboardSparklineStep, oldest first, skipping steps without points.
+func sparkline(points []storage.HistoricalDataPoint, from, to time.Time, loc *time.Location) []SparklinePoint {
+	steps := int(to.Sub(from)/dashboardSparklineStep) + 1
+	sums := make([]int, steps)
+	counts := make([]int, steps)
+	for _, p := range points {
+		if p.Timestamp.Before(from) || p.Timestamp.After(to) {
+			continue
+		}
+		i := int(p.Timestamp.Sub(from) / dashboardSparklineStep)
+		sums[i] += p.TotalBikes
+		counts[i]++
+	}
+	line := []SparklinePoint{}
+	for i := range steps {
+		if counts[i] == 0 {
+			continue
+		}
+		line = append(line, SparklinePoint{
+			Timestamp: formatTime(from.Add(time.Duration(i)*dashboardSparklineStep), loc),
+			Bikes:     int(math.Round(float64(sums[i]) / float64(counts[i]))),
+		})
+	}
+	return line
+}
+
+// occupancy returns the fraction of a station's docks holding a bike.
+func occupancy(s tfl.Station) float64 {
+	if s.NbDocks == 0 {
+		return 0
+	}
+	return float64(s.NbBikes) / float64(s.NbDocks)
+}
+
+// dashboardStation converts a station for the dashboard's rankings.
+func dashboardStation(s tfl.Station) DashboardStationResponse {
+	return DashboardStationResponse{
+		StationID:  s.ID,
+		Name:       s.Name,
+		Bikes:      s.NbBikes,
+		EmptyDocks: s.NbEmptyDocks,
+		Docks:      s.NbDocks,
+		Occupancy:  math.Round(occupancy(s)*1000) / 1000,
+	}
+}
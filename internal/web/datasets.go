@@ -0,0 +1,239 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"city-cycling/internal/publish"
+	"city-cycling/internal/rollup"
+	"city-cycling/internal/storage"
+)
+
+// datasetsCacheTTL bounds how often the catalog rereads the publication index
+// and probes the rollups.
+const datasetsCacheTTL = 5 * time.Minute
+
+// Kinds of dataset in the catalog.
+const (
+	datasetExtract  = "extract"
+	datasetMetadata = "metadata"
+	datasetRollup   = "rollup"
+)
+
+// DatasetResponse describes one dataset a pipeline can fetch.
+type DatasetResponse struct {
+	Name string `json:"name"`
+	// Kind is "extract" for a published daily file, "metadata" for the
+	// index and data dictionary describing them, or "rollup" for an API
+	// serving precomputed aggregates.
+	Kind        string `json:"kind"`
+	Description string `json:"description,omitempty"`
+	// Format is "csv.gz", "parquet" or "json".
+	Format string `json:"format"`
+	// From and To bound the time the dataset covers.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Size is in bytes; unknown for API datasets.
+	Size int64 `json:"size,omitempty"`
+	// URL is absent when the publisher was run without -public-url.
+	URL string `json:"url,omitempty"`
+	// Key is the file's key relative to the public dataset's root.
+	Key string `json:"key,omitempty"`
+	// Checksum is "sha256:<hex>" of the file, when recorded.
+	Checksum  string `json:"checksum,omitempty"`
+	Rows      int    `json:"rows,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// DatasetsResponse is the JSON response for the datasets catalog.
+type DatasetsResponse struct {
+	City        string            `json:"city"`
+	GeneratedAt string            `json:"generatedAt"`
+	License     string            `json:"license,omitempty"`
+	Datasets    []DatasetResponse `json:"datasets"`
+}
+
+// datasetsCacheEntry is a recently built catalog. Rollup URLs are kept
+// relative to the API prefix, which depends on the request.
+type datasetsCacheEntry struct {
+	built    time.Time
+	response DatasetsResponse
+}
+
+// handleDatasets serves a catalog of the data a pipeline can sync: the daily
+// extracts published by cmd/publish (with sizes and checksums) and the rollup
+// APIs, each with the time range it covers.
+func (h *Handler) handleDatasets(w http.ResponseWriter, r *http.Request) {
+	catalog, err := h.datasets(context.WithoutCancel(r.Context()))
+	if err != nil {
+		slog.Error("Failed to build dataset catalog", "error", err)
+		httpError(w, r, "Failed to build dataset catalog", http.StatusInternalServerError)
+		return
+	}
+
+	// Rollups are served next to the catalog, under whichever prefix it was requested at
+	prefix := requestBaseURL(r) + strings.TrimSuffix(r.URL.Path, "/datasets")
+	datasets := make([]DatasetResponse, len(catalog.Datasets))
+	for i, d := range catalog.Datasets {
+		if strings.HasPrefix(d.URL, "/") {
+			d.URL = prefix + d.URL
+		}
+		datasets[i] = d
+	}
+	catalog.Datasets = datasets
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(datasetsCacheTTL.Seconds())))
+	writeJSON(w, catalog)
+}
+
+// datasets returns the catalog, rebuilding it at most once every datasetsCacheTTL.
+func (h *Handler) datasets(ctx context.Context) (DatasetsResponse, error) {
+	h.datasetsMu.Lock()
+	defer h.datasetsMu.Unlock()
+	if c := h.datasetsCache; c != nil && time.Since(c.built) < datasetsCacheTTL {
+		return c.response, nil
+	}
+
+	response := DatasetsResponse{
+		City:        h.city.ID,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Datasets:    []DatasetResponse{},
+	}
+	if objects, ok := h.store.(storage.ObjectStore); ok {
+		index, err := publish.LoadCatalog(ctx, objects)
+		switch {
+		case err == nil:
+			response.License = index.License
+			response.Datasets = append(response.Datasets, h.extractDatasets(index)...)
+		case !errors.Is(err, storage.ErrNotFound):
+			return DatasetsResponse{}, err
+		}
+
+		rollups, err := h.rollupDatasets(ctx, objects)
+		if err != nil {
+			return DatasetsResponse{}, err
+		}
+		response.Datasets = append(response.Datasets, rollups...)
+	}
+
+	h.datasetsCache = &datasetsCacheEntry{built: time.Now(), response: response}
+	return response, nil
+}
+
+// extractDatasets lists the index, the data dictionary and every published
+// day's files.
+func (h *Handler) extractDatasets(index publish.Index) []DatasetResponse {
+	loc := h.city.Location()
+	if index.TimeZone != "" {
+		if l, err := time.LoadLocation(index.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	url := func(key string) string {
+		if index.BaseURL == "" {
+			return ""
+		}
+		return index.BaseURL + key
+	}
+	checksum := func(sum string) string {
+		if sum == "" {
+			return ""
+		}
+		return "sha256:" + sum
+	}
+
+	datasets := []DatasetResponse{
+		{Name: publish.IndexKey, Kind: datasetMetadata, Description: "Every day published, with its files", Format: "json", URL: url(publish.IndexKey), Key: publish.IndexKey},
+		{Name: index.Dictionary, Kind: datasetMetadata, Description: "Columns, types, time zone and license of the extracts", Format: "json", URL: url(index.Dictionary), Key: index.Dictionary},
+	}
+	if len(index.Days) > 0 {
+		datasets[0].UpdatedAt = index.Days[len(index.Days)-1].PublishedAt.UTC().Format(time.RFC3339)
+	}
+	for _, d := range index.Days {
+		day, err := time.ParseInLocation("2006-01-02", d.Date, loc)
+		if err != nil {
+			slog.Warn("Skipping invalid date in publication index", "date", d.Date)
+			continue
+		}
+		from := day.UTC().Format(time.RFC3339)
+		to := day.AddDate(0, 0, 1).UTC().Format(time.RFC3339)
+		updated := d.PublishedAt.UTC().Format(time.RFC3339)
+		datasets = append(datasets,
+			DatasetResponse{Name: "stations_" + d.Date + ".csv.gz", Kind: datasetExtract, Format: "csv.gz", From: from, To: to, Size: d.CSVBytes, URL: url(d.CSV), Key: d.CSV, Checksum: checksum(d.CSVSHA256), Rows: d.Rows, UpdatedAt: updated},
+			DatasetResponse{Name: "stations_" + d.Date + ".parquet", Kind: datasetExtract, Format: "parquet", From: from, To: to, Size: d.ParquetBytes, URL: url(d.Parquet), Key: d.Parquet, Checksum: checksum(d.ParquetSHA256), Rows: d.Rows, UpdatedAt: updated},
+		)
+	}
+	return datasets
+}
+
+// rollupDatasets lists the rollup resolutions with the range each covers,
+// found from the first and last daily buckets within the stored snapshots.
+// Nothing is listed when no rollups have been built.
+func (h *Handler) rollupDatasets(ctx context.Context, objects storage.ObjectStore) ([]DatasetResponse, error) {
+	status, err := h.status(ctx, defaultGapInterval)
+	if err != nil {
+		return nil, err
+	}
+	if status.Snapshots.Oldest == "" {
+		return nil, nil
+	}
+	oldest, _ := time.Parse(time.RFC3339, status.Snapshots.Oldest)
+	newest, _ := time.Parse(time.RFC3339, status.Snapshots.Newest)
+
+	loc := h.city.Location()
+	days, err := rollup.Read(ctx, objects, rollup.Day, loc, 0, oldest, newest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %w", err)
+	}
+	if len(days) == 0 {
+		return nil, nil
+	}
+	first, last := days[0].Start, days[len(days)-1].Start
+
+	// Days hold exactly the hours rolled up, so only the ends need reading
+	firstHours, err := rollup.Read(ctx, objects, rollup.Hour, loc, 0, first, first.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %w", err)
+	}
+	lastHours, err := rollup.Read(ctx, objects, rollup.Hour, loc, 0, last, last.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %w", err)
+	}
+	hoursFrom, hoursTo := first, last.AddDate(0, 0, 1)
+	if len(firstHours) > 0 {
+		hoursFrom = firstHours[0].Start
+	}
+	if len(lastHours) > 0 {
+		hoursTo = lastHours[len(lastHours)-1].Start.Add(time.Hour)
+	}
+
+	weeks, err := rollup.Read(ctx, objects, rollup.Week, loc, 0, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %w", err)
+	}
+
+	rollupDataset := func(res rollup.Resolution, from, to time.Time) DatasetResponse {
+		return DatasetResponse{
+			Name:        "rollups-" + string(res),
+			Kind:        datasetRollup,
+			Description: fmt.Sprintf("Network-wide averages per %s; add station=<id> for one station and from/to for a range", res),
+			Format:      "json",
+			From:        from.UTC().Format(time.RFC3339),
+			To:          to.UTC().Format(time.RFC3339),
+			URL:         "/history?resolution=" + string(res),
+		}
+	}
+	datasets := []DatasetResponse{
+		rollupDataset(rollup.Hour, hoursFrom, hoursTo),
+		rollupDataset(rollup.Day, first, last.AddDate(0, 0, 1)),
+	}
+	if len(weeks) > 0 {
+		datasets = append(datasets, rollupDataset(rollup.Week, weeks[0].Start, weeks[len(weeks)-1].Start.AddDate(0, 0, 7)))
+	}
+	return datasets, nil
+}
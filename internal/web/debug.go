@@ -0,0 +1,43 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DebugHandler serves the Go profiler (net/http/pprof) under /debug/pprof/
+// and every Go runtime metric, with process metrics, in the Prometheus format
+// at /debug/metrics. It is meant for its own address, away from the public
+// routes; when the admin API is enabled every request needs an admin key, and
+// is logged with the admin's name.
+//
+// History refreshes carry the profiler labels task=history and city=<id>, so
+// their share of a CPU profile can be isolated with go tool pprof -tagfocus.
+func (h *Handler) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsAll)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux.Handle("/debug/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	if len(h.adminKeys) == 0 {
+		return mux
+	}
+	return h.admin(func(w http.ResponseWriter, r *http.Request, admin string) {
+		slog.Info("Debug request", "admin", admin, "path", r.URL.Path, "remote", r.RemoteAddr)
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/analytics"
+)
+
+// defaultDockAuditWindow is the range audited when a broken-docks request has
+// no from parameter.
+const defaultDockAuditWindow = 7 * 24 * time.Hour
+
+// StationDockAuditResponse is how consistently one station's readings added up.
+type StationDockAuditResponse struct {
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	Readings      int     `json:"readings"`
+	Mismatched    int     `json:"mismatched"`
+	MismatchShare float64 `json:"mismatchShare"`
+	// AvgMissing is the average docks unaccounted for when mismatched;
+	// negative values mean bikes and free docks exceeded the dock count.
+	AvgMissing    float64 `json:"avgMissing"`
+	MaxMissing    int     `json:"maxMissing"`
+	MinMissing    int     `json:"minMissing"`
+	LongestStreak int     `json:"longestStreak"`
+	Ongoing       bool    `json:"ongoing"`
+	FirstMismatch string  `json:"firstMismatch"`
+	LastMismatch  string  `json:"lastMismatch"`
+	// The cleaned view of the latest reading: InServiceDocks counts the
+	// docks holding a bike or free.
+	Latest          string `json:"latest"`
+	ReportedDocks   int    `json:"reportedDocks"`
+	InServiceDocks  int    `json:"inServiceDocks"`
+	LatestMissing   int    `json:"latestMissing"`
+	Chronic         bool   `json:"chronic"`
+	EstimatedBroken int    `json:"estimatedBroken,omitempty"`
+}
+
+// BrokenDocksResponse is the JSON response for the broken docks audit API.
+type BrokenDocksResponse struct {
+	From          string                     `json:"from"`
+	To            string                     `json:"to"`
+	SnapshotCount int                        `json:"snapshotCount"`
+	Readings      int                        `json:"readings"`
+	Mismatched    int                        `json:"mismatched"`
+	MismatchShare float64                    `json:"mismatchShare"`
+	ChronicShare  float64                    `json:"chronicShare"`
+	Chronic       []StationDockAuditResponse `json:"chronic"`
+	Stations      []StationDockAuditResponse `json:"stations"`
+}
+
+// handleBrokenDocks audits nbBikes + nbEmptyDocks against nbDocks in every
+// reading and reports the stations that chronically do not add up.
+func (h *Handler) handleBrokenDocks(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultDockAuditWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	top, err := parseTop(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chronicShare, err := parseChronicShare(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	auditor := analytics.NewDockAuditor(chronicShare)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, auditor); err != nil {
+		slog.Error("Failed to audit docks", "error", err)
+		httpError(w, r, "Failed to compute analytics", http.StatusInternalServerError)
+		return
+	}
+	report := auditor.Result(top)
+
+	response := BrokenDocksResponse{
+		From:          formatTime(from, loc),
+		To:            formatTime(to, loc),
+		SnapshotCount: report.SnapshotCount,
+		Readings:      report.Readings,
+		Mismatched:    report.Mismatched,
+		MismatchShare: report.MismatchShare,
+		ChronicShare:  chronicShare,
+		Chronic:       make([]StationDockAuditResponse, len(report.Chronic)),
+		Stations:      []StationDockAuditResponse{},
+	}
+	for i, s := range report.Chronic {
+		response.Chronic[i] = stationDockAuditResponse(s, loc)
+	}
+	for _, s := range report.Stations {
+		if stationID == 0 || s.StationID == stationID {
+			response.Stations = append(response.Stations, stationDockAuditResponse(s, loc))
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// parseChronicShare reads the chronic query parameter, a fraction between 0 and 1.
+func parseChronicShare(r *http.Request) (float64, error) {
+	v := r.URL.Query().Get("chronic")
+	if v == "" {
+		return analytics.DefaultChronicShare, nil
+	}
+	share, err := strconv.ParseFloat(v, 64)
+	if err != nil || share <= 0 || share > 1 {
+		return 0, errInvalidParam("chronic")
+	}
+	return share, nil
+}
+
+// stationDockAuditResponse converts a station's dock audit for the API.
+func stationDockAuditResponse(s analytics.StationDockAudit, loc *time.Location) StationDockAuditResponse {
+	return StationDockAuditResponse{
+		ID:              s.StationID,
+		Name:            s.Name,
+		Readings:        s.Readings,
+		Mismatched:      s.Mismatched,
+		MismatchShare:   s.MismatchShare,
+		AvgMissing:      s.AvgMissing,
+		MaxMissing:      s.MaxMissing,
+		MinMissing:      s.MinMissing,
+		LongestStreak:   s.LongestStreak,
+		Ongoing:         s.Ongoing,
+		FirstMismatch:   formatTime(s.FirstMismatch, loc),
+		LastMismatch:    formatTime(s.LastMismatch, loc),
+		Latest:          formatTime(s.Latest, loc),
+		ReportedDocks:   s.ReportedDocks,
+		InServiceDocks:  s.InServiceDocks,
+		LatestMissing:   s.LatestMissing,
+		Chronic:         s.Chronic,
+		EstimatedBroken: s.EstimatedBroken,
+	}
+}
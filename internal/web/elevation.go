@@ -0,0 +1,165 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/registry"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// defaultElevationWindow is the range analysed when an elevation request has no from parameter.
+	defaultElevationWindow = 7 * 24 * time.Hour
+	// maxElevationBands bounds the bands parameter.
+	maxElevationBands = 20
+)
+
+// StationElevationResponse is how often a station of known elevation was empty or full.
+type StationElevationResponse struct {
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Elevation    float64 `json:"elevation"`
+	Readings     int     `json:"readings"`
+	EmptyShare   float64 `json:"emptyShare"`
+	FullShare    float64 `json:"fullShare"`
+	Imbalance    float64 `json:"imbalance"`
+	AvgOccupancy float64 `json:"avgOccupancy"`
+}
+
+// ElevationBandResponse averages the stations in a range of elevations.
+type ElevationBandResponse struct {
+	MinElevation float64 `json:"minElevation"`
+	MaxElevation float64 `json:"maxElevation"`
+	AvgElevation float64 `json:"avgElevation"`
+	Stations     int     `json:"stations"`
+	EmptyShare   float64 `json:"emptyShare"`
+	FullShare    float64 `json:"fullShare"`
+	Imbalance    float64 `json:"imbalance"`
+	AvgOccupancy float64 `json:"avgOccupancy"`
+}
+
+// ElevationResponse is the JSON response for the elevation analysis API.
+type ElevationResponse struct {
+	From             string `json:"from"`
+	To               string `json:"to"`
+	SnapshotCount    int    `json:"snapshotCount"`
+	StationCount     int    `json:"stationCount"`
+	WithoutElevation int    `json:"withoutElevation"`
+	// Correlations are Pearson's r between elevation and each station's share.
+	EmptyCorrelation     float64                    `json:"emptyCorrelation"`
+	FullCorrelation      float64                    `json:"fullCorrelation"`
+	ImbalanceCorrelation float64                    `json:"imbalanceCorrelation"`
+	OccupancyCorrelation float64                    `json:"occupancyCorrelation"`
+	ImbalancePer10m      float64                    `json:"imbalancePer10m"`
+	Bands                []ElevationBandResponse    `json:"bands"`
+	MostEmptied          []StationElevationResponse `json:"mostEmptied"`
+	MostFilled           []StationElevationResponse `json:"mostFilled"`
+	Stations             []StationElevationResponse `json:"stations"`
+}
+
+// handleElevation relates the elevations recorded in the station registry to
+// how often each station was empty or full.
+func (h *Handler) handleElevation(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok {
+		httpError(w, r, "Station registry not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultElevationWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	top, err := parseTop(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bands, err := parseIntParam(r, "bands", analytics.DefaultElevationBands)
+	if err != nil || bands < 1 || bands > maxElevationBands {
+		httpError(w, r, errInvalidParam("bands").Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reg, err := registry.Load(r.Context(), objects)
+	if err != nil {
+		slog.Error("Failed to load station registry", "error", err)
+		httpError(w, r, "Failed to load station registry", http.StatusInternalServerError)
+		return
+	}
+	elevations := reg.Elevations()
+	if len(elevations) == 0 {
+		httpError(w, r, "No station elevations recorded (run the collector with -elevation)", http.StatusNotFound)
+		return
+	}
+
+	analyzer := analytics.NewElevationAnalyzer(elevations, bands)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, analyzer); err != nil {
+		slog.Error("Failed to analyse elevations", "error", err)
+		httpError(w, r, "Failed to compute analytics", http.StatusInternalServerError)
+		return
+	}
+	report := analyzer.Result(top)
+
+	response := ElevationResponse{
+		From:                 formatTime(from, loc),
+		To:                   formatTime(to, loc),
+		SnapshotCount:        report.SnapshotCount,
+		StationCount:         report.StationCount,
+		WithoutElevation:     report.WithoutElevation,
+		EmptyCorrelation:     report.EmptyCorrelation,
+		FullCorrelation:      report.FullCorrelation,
+		ImbalanceCorrelation: report.ImbalanceCorrelation,
+		OccupancyCorrelation: report.OccupancyCorrelation,
+		ImbalancePer10m:      report.ImbalancePer10m,
+		Bands:                make([]ElevationBandResponse, len(report.Bands)),
+		MostEmptied:          stationElevationResponses(report.MostEmptied),
+		MostFilled:           stationElevationResponses(report.MostFilled),
+		Stations:             stationElevationResponses(report.Stations),
+	}
+	for i, b := range report.Bands {
+		response.Bands[i] = ElevationBandResponse{
+			MinElevation: b.MinElevation,
+			MaxElevation: b.MaxElevation,
+			AvgElevation: b.AvgElevation,
+			Stations:     b.Stations,
+			EmptyShare:   b.EmptyShare,
+			FullShare:    b.FullShare,
+			Imbalance:    b.Imbalance,
+			AvgOccupancy: b.AvgOccupancy,
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// stationElevationResponses converts stations' elevation analysis for the API.
+func stationElevationResponses(stations []analytics.StationElevation) []StationElevationResponse {
+	result := make([]StationElevationResponse, len(stations))
+	for i, s := range stations {
+		result[i] = StationElevationResponse{
+			ID:           s.StationID,
+			Name:         s.Name,
+			Elevation:    s.Elevation,
+			Readings:     s.Readings,
+			EmptyShare:   s.EmptyShare,
+			FullShare:    s.FullShare,
+			Imbalance:    s.Imbalance,
+			AvgOccupancy: s.AvgOccupancy,
+		}
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// snapshotETag builds an ETag for a response derived from data as of timestamp.
+func snapshotETag(kind string, timestamp time.Time, extra int) string {
+	return fmt.Sprintf(`"%s-%d-%d"`, kind, timestamp.Unix(), extra)
+}
+
+// checkETag sets the ETag header and, if the request's If-None-Match matches it,
+// writes a 304 Not Modified response. It returns true when the response is complete.
+func checkETag(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(inm, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Weak comparison is sufficient for GET
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/export"
+	"city-cycling/internal/storage"
+)
+
+// exportWindow is the range /export covers when the request gives no from.
+const exportWindow = 24 * time.Hour
+
+// errRangeDone stops an export once the requested byte range has been written.
+var errRangeDone = errors.New("byte range written")
+
+// handleExport streams the station readings between from and to as TSV or
+// JSON lines, writing each snapshot as it is read from storage. A single byte
+// range (Range: bytes=N- to resume, or N-M for a chunk) is served as 206: the
+// export is written once to measure it and again to send the range, so only
+// the bytes in flight are held in memory.
+func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.store.(storage.RangeDataStore)
+	if !ok {
+		httpError(w, r, "Export not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+	from, to, err := parseTimeRange(r, exportWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := export.TSV
+	if v := r.URL.Query().Get("format"); v != "" {
+		if format, err = export.ParseFormat(v); err != nil {
+			httpError(w, r, errInvalidParam("format").Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Pin the range to the snapshots stored now, so that the passes below and
+	// a later request resuming this one read the same snapshots
+	timestamps, err := storage.ListTimestamps(r.Context(), h.store, storage.TimestampQuery{From: from, To: to})
+	if err != nil {
+		slog.Error("Failed to list snapshots for export", "error", err)
+		httpError(w, r, "Failed to export snapshots", http.StatusInternalServerError)
+		return
+	}
+	var first, last time.Time
+	if len(timestamps) > 0 {
+		first, last = timestamps[len(timestamps)-1], timestamps[0]
+		to = last
+	}
+
+	name := fmt.Sprintf("city-cycling_%s_%s_%s.%s", h.city.ID, from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"), format)
+	etag := snapshotETag(fmt.Sprintf("export-%s-%d-%d", format, stationID, first.Unix()), last, len(timestamps))
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if checkETag(w, r, etag) {
+		return
+	}
+
+	rng, ranged := parseByteRange(r.Header.Get("Range"))
+	// A client resuming a download that has since changed starts over
+	if ir := r.Header.Get("If-Range"); ir != "" && ir != etag {
+		ranged = false
+	}
+	if !ranged {
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := export.WriteRows(r.Context(), w, rangeStore, from, to, format, stationID); err != nil {
+			abortExport(err)
+		}
+		return
+	}
+
+	var size countingWriter
+	if _, err := export.WriteRows(r.Context(), &size, rangeStore, from, to, format, stationID); err != nil {
+		slog.Error("Failed to measure export", "error", err)
+		httpError(w, r, "Failed to export snapshots", http.StatusInternalServerError)
+		return
+	}
+	start, end, ok := rng.resolve(size.n)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size.n))
+		httpError(w, r, "Range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size.n))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return
+	}
+	rw := &rangeWriter{w: w, skip: start, remaining: end - start + 1}
+	if _, err := export.WriteRows(r.Context(), rw, rangeStore, from, to, format, stationID); err != nil && !errors.Is(err, errRangeDone) {
+		abortExport(err)
+	}
+}
+
+// abortExport ends an export that failed part way. The status has been sent,
+// so the connection is dropped instead, and the client sees a truncated
+// transfer rather than a complete-looking file.
+func abortExport(err error) {
+	if !errors.Is(err, context.Canceled) {
+		slog.Error("Failed to stream export", "error", err)
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// byteRange is a single range of a Range header: bytes start through end,
+// inclusive, with end -1 for the rest of the body; or, when suffix is set,
+// the last suffix bytes.
+type byteRange struct {
+	start, end, suffix int64
+}
+
+// parseByteRange parses a Range header requesting one byte range. Anything
+// else, including several ranges, is ignored and the whole body served.
+func parseByteRange(header string) (byteRange, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return byteRange{}, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return byteRange{}, false
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return byteRange{}, false
+		}
+		return byteRange{suffix: n}, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false
+	}
+	end := int64(-1)
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return byteRange{}, false
+		}
+	}
+	return byteRange{start: start, end: end}, true
+}
+
+// resolve returns the first and last byte of the range in a body of size
+// bytes, or false if the range lies beyond it.
+func (b byteRange) resolve(size int64) (start, end int64, ok bool) {
+	if b.suffix > 0 {
+		return max(size-b.suffix, 0), size - 1, size > 0
+	}
+	if b.start >= size {
+		return 0, 0, false
+	}
+	if b.end < 0 || b.end >= size {
+		return b.start, size - 1, true
+	}
+	return b.start, b.end, true
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// rangeWriter passes on the remaining bytes after the first skip written to
+// it, then stops the writer with errRangeDone.
+type rangeWriter struct {
+	w               io.Writer
+	skip, remaining int64
+}
+
+func (rw *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if rw.skip >= int64(len(p)) {
+		rw.skip -= int64(len(p))
+		return n, nil
+	}
+	p = p[rw.skip:]
+	rw.skip = 0
+	if int64(len(p)) > rw.remaining {
+		p = p[:rw.remaining]
+	}
+	if _, err := rw.w.Write(p); err != nil {
+		return 0, err
+	}
+	rw.remaining -= int64(len(p))
+	if rw.remaining == 0 {
+		return n, errRangeDone
+	}
+	return n, nil
+}
+
+// handleAdminExport builds a SQLite database of the snapshots between from and
+// to (default: the whole archive) and sends it as a download.
+func (h *Handler) handleAdminExport(w http.ResponseWriter, r *http.Request, admin string) {
+	rangeStore, ok := h.store.(storage.RangeDataStore)
+	if !ok {
+		httpError(w, r, "Export not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+	var from, to time.Time
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				httpError(w, r, errInvalidParam(name).Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if !from.IsZero() && from.After(to) {
+		httpError(w, r, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "city-cycling-export-")
+	if err != nil {
+		slog.Error("Failed to create export directory", "error", err)
+		httpError(w, r, "Failed to export snapshots", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := fmt.Sprintf("city-cycling_%s_%s.sqlite", h.city.ID, to.UTC().Format("20060102_150405"))
+	path := filepath.Join(dir, name)
+	start := time.Now()
+	// Finish the export even if the client gives up, so the audit trail is accurate
+	stats, err := export.WriteSQLite(context.WithoutCancel(r.Context()), path, rangeStore, from, to, map[string]string{"city": h.city.ID})
+	if err != nil {
+		slog.Error("Failed to export snapshots", "admin", admin, "error", err)
+		httpError(w, r, "Failed to export snapshots", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Exported snapshots", "admin", admin, "snapshots", stats.Snapshots, "rows", stats.Rows, "duration", time.Since(start))
+	h.recordAudit(r, auditRecord{
+		Time:     time.Now().UTC(),
+		Admin:    admin,
+		Action:   "export",
+		City:     h.city.ID,
+		Key:      name,
+		Stations: stats.Stations,
+		Remote:   r.RemoteAddr,
+	})
+
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("Failed to open export", "error", err)
+		httpError(w, r, "Failed to export snapshots", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, time.Now(), f)
+}
@@ -0,0 +1,276 @@
+package web
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/registry"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// feedWindow is how far back the event feed reaches.
+	feedWindow = 30 * 24 * time.Hour
+	// feedMaxEntries bounds the entries in the event feed.
+	feedMaxEntries = 100
+	// feedRemovedAfter is how long a station must be missing from the feed
+	// before it is reported removed, so a station briefly dropped is not.
+	feedRemovedAfter = 24 * time.Hour
+	// feedMinLocked is how long the operator must lock a station for it to be
+	// reported as an outage.
+	feedMinLocked = time.Hour
+)
+
+// Kinds of network event in the feed, used as the entries' categories.
+const (
+	feedNewStation     = "new-station"
+	feedRemovedStation = "removed-station"
+	feedOutage         = "outage"
+	feedRecordLow      = "record-low"
+)
+
+// feedEvent is a notable change to the network.
+type feedEvent struct {
+	Kind      string
+	Time      time.Time
+	StationID int
+	Title     string
+	Summary   string
+}
+
+// atomFeed is an Atom 1.0 feed document.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomLink is an Atom link element.
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// atomAuthor is an Atom author element.
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// atomCategory is an Atom category element.
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// atomEntry is an Atom entry element.
+type atomEntry struct {
+	Title    string       `xml:"title"`
+	ID       string       `xml:"id"`
+	Updated  string       `xml:"updated"`
+	Link     atomLink     `xml:"link"`
+	Category atomCategory `xml:"category"`
+	Summary  string       `xml:"summary"`
+}
+
+// handleFeed serves an Atom feed of notable network events for the city
+// mounted at mount: new and removed stations, prolonged outages and record
+// lows of available bikes, for readers that follow changes without an API client.
+func (h *Handler) handleFeed(mount string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+		if _, timestamp, err := h.latestSnapshot(r.Context()); err == nil && !timestamp.IsZero() {
+			// Replays report events as of the snapshot being replayed
+			now = timestamp
+		}
+		events := h.feedEvents(r.Context(), now)
+
+		base := requestBaseURL(r) + mount
+		feed := atomFeed{
+			Title:   h.city.Name + " network events",
+			ID:      base + "/feed.xml",
+			Updated: now.Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: base + "/feed.xml", Rel: "self", Type: "application/atom+xml"},
+				{Href: base + "/", Rel: "alternate", Type: "text/html"},
+			},
+			Author:  atomAuthor{Name: "city-cycling"},
+			Entries: make([]atomEntry, len(events)),
+		}
+		if len(events) > 0 {
+			feed.Updated = events[0].Time.UTC().Format(time.RFC3339)
+		}
+		for i, e := range events {
+			feed.Entries[i] = atomEntry{
+				Title:    e.Title,
+				ID:       fmt.Sprintf("%s/feed.xml#%s-%d-%d", base, e.Kind, e.StationID, e.Time.Unix()),
+				Updated:  e.Time.UTC().Format(time.RFC3339),
+				Link:     atomLink{Href: base + "/", Rel: "alternate", Type: "text/html"},
+				Category: atomCategory{Term: e.Kind},
+				Summary:  e.Summary,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		fmt.Fprint(w, xml.Header)
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(feed); err != nil {
+			slog.Error("XML encoding error", "error", err)
+		}
+	}
+}
+
+// feedEvents returns the events within feedWindow of now, newest first. A
+// source that cannot be read is logged and left out rather than failing the feed.
+func (h *Handler) feedEvents(ctx context.Context, now time.Time) []feedEvent {
+	names := make(map[int]string)
+	var events []feedEvent
+
+	if objects, ok := h.store.(storage.ObjectStore); ok {
+		reg, err := registry.Load(ctx, objects)
+		if err != nil {
+			slog.Error("Failed to load station registry", "error", err)
+		} else {
+			for _, st := range reg.Stations() {
+				names[st.ID] = st.Name
+			}
+			events = append(events, registryEvents(reg, h.location)...)
+		}
+	}
+
+	h.anomaliesMu.Lock()
+	for id, a := range h.anomalyStatus {
+		if a.Status != analytics.StatusStale {
+			continue
+		}
+		events = append(events, feedEvent{
+			Kind:      feedOutage,
+			Time:      a.Since,
+			StationID: id,
+			Title:     "Station not reporting: " + stationLabel(id, names),
+			Summary:   fmt.Sprintf("%s has reported the same counts since %s, likely a station or feed fault.", stationLabel(id, names), feedTime(a.Since, h.location)),
+		})
+	}
+	h.anomaliesMu.Unlock()
+
+	if historical, ok := h.store.(storage.HistoricalDataStore); ok {
+		points, err := h.historyPoints(ctx, historical)
+		if err != nil {
+			slog.Error("Failed to load history for event feed", "error", err)
+		}
+		for _, rec := range analytics.RecordLows(points, analytics.DefaultRecordWarmup, h.location) {
+			events = append(events, feedEvent{
+				Kind:    feedRecordLow,
+				Time:    rec.Timestamp,
+				Title:   fmt.Sprintf("Record low: %d bikes docked", rec.TotalBikes),
+				Summary: fmt.Sprintf("%d bikes were docked across the network at %s, the fewest on record, below the previous low of %d at %s.", rec.TotalBikes, feedTime(rec.Timestamp, h.location), rec.PrevLow, feedTime(rec.PrevLowAt, h.location)),
+			})
+		}
+	}
+
+	recent := events[:0]
+	for _, e := range events {
+		if !e.Time.Before(now.Add(-feedWindow)) && !e.Time.After(now) {
+			recent = append(recent, e)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		if !recent[i].Time.Equal(recent[j].Time) {
+			return recent[i].Time.After(recent[j].Time)
+		}
+		return recent[i].StationID < recent[j].StationID
+	})
+	if len(recent) > feedMaxEntries {
+		recent = recent[:feedMaxEntries]
+	}
+	return recent
+}
+
+// registryEvents returns the stations the registry saw appear, disappear or
+// be locked for at least feedMinLocked. Stations present when the registry
+// started are not new.
+func registryEvents(reg *registry.Registry, loc *time.Location) []feedEvent {
+	stations := reg.Stations()
+	var start time.Time
+	for _, st := range stations {
+		if start.IsZero() || st.FirstSeen.Before(start) {
+			start = st.FirstSeen
+		}
+	}
+	lastSeen := reg.LastSeen()
+
+	var events []feedEvent
+	for _, st := range stations {
+		label := fmt.Sprintf("%s (%d)", st.Name, st.ID)
+		if st.FirstSeen.After(start) {
+			events = append(events, feedEvent{
+				Kind:      feedNewStation,
+				Time:      st.FirstSeen,
+				StationID: st.ID,
+				Title:     "New station: " + st.Name,
+				Summary:   fmt.Sprintf("%s appeared in the feed at %s with %d docks.", label, feedTime(st.FirstSeen, loc), st.Docks),
+			})
+		}
+		if lastSeen.Sub(st.LastSeen) >= feedRemovedAfter {
+			events = append(events, feedEvent{
+				Kind:      feedRemovedStation,
+				Time:      st.LastSeen,
+				StationID: st.ID,
+				Title:     "Station removed: " + st.Name,
+				Summary:   fmt.Sprintf("%s has been missing from the feed since %s.", label, feedTime(st.LastSeen, loc)),
+			})
+		}
+		for _, p := range st.LockedPeriods {
+			end, summary := p.End, fmt.Sprintf("%s was locked by the operator from %s to %s.", label, feedTime(p.Start, loc), feedTime(p.End, loc))
+			if end.IsZero() {
+				end, summary = lastSeen, fmt.Sprintf("%s has been locked by the operator since %s.", label, feedTime(p.Start, loc))
+			}
+			if end.Sub(p.Start) < feedMinLocked {
+				continue
+			}
+			events = append(events, feedEvent{
+				Kind:      feedOutage,
+				Time:      p.Start,
+				StationID: st.ID,
+				Title:     "Station locked: " + st.Name,
+				Summary:   summary,
+			})
+		}
+	}
+	return events
+}
+
+// stationLabel names a station for the feed, by ID when its name is unknown.
+func stationLabel(id int, names map[int]string) string {
+	if name, ok := names[id]; ok {
+		return fmt.Sprintf("%s (%d)", name, id)
+	}
+	return fmt.Sprintf("Station %d", id)
+}
+
+// feedTime formats a time for a feed summary in loc.
+func feedTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2 Jan 2006 15:04 MST")
+}
+
+// requestBaseURL returns the scheme and host a request was made to, honouring
+// X-Forwarded-Proto from a TLS-terminating proxy, followed by the tenant's
+// path prefix on a multi-tenant server.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + basePath(r.Context())
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// forecastTrainingWindow is how much history the forecast model is trained on.
+	forecastTrainingWindow = 28 * 24 * time.Hour
+	// forecastHorizon is how far ahead forecasts are made.
+	forecastHorizon = 60 * time.Minute
+	// forecastStep is the spacing between forecast points.
+	forecastStep = 10 * time.Minute
+)
+
+// ForecastPointResponse represents predicted availability at a future time.
+type ForecastPointResponse struct {
+	Timestamp  string  `json:"timestamp"`
+	Bikes      float64 `json:"bikes"`
+	EmptyDocks float64 `json:"emptyDocks"`
+}
+
+// ForecastResponse is the JSON response for the forecast API.
+type ForecastResponse struct {
+	StationID    int                     `json:"stationId"`
+	BasedOn      string                  `json:"basedOn"`
+	CurrentBikes int                     `json:"currentBikes"`
+	CurrentDocks int                     `json:"currentEmptyDocks"`
+	SampleCount  int                     `json:"sampleCount"`
+	Forecast     []ForecastPointResponse `json:"forecast"`
+}
+
+// handleStationForecast predicts a station's availability for the next hour.
+func (h *Handler) handleStationForecast(w http.ResponseWriter, r *http.Request) {
+	stationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid station id", http.StatusBadRequest)
+		return
+	}
+
+	rangeStore, ok := h.store.(storage.RangeDataStore)
+	if !ok {
+		httpError(w, r, "Forecasts not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	samples, err := storage.StationSeries(r.Context(), rangeStore, stationID, to.Add(-forecastTrainingWindow), to)
+	if err != nil {
+		slog.Error("Failed to build station series", "station", stationID, "error", err)
+		httpError(w, r, "Failed to compute forecast", http.StatusInternalServerError)
+		return
+	}
+
+	model := analytics.TrainSeasonalModel(samples, loc)
+	if model == nil {
+		httpError(w, r, "No data for station", http.StatusNotFound)
+		return
+	}
+
+	latest := model.Latest()
+	points := model.Forecast(forecastHorizon, forecastStep)
+
+	response := ForecastResponse{
+		StationID:    stationID,
+		BasedOn:      formatTime(latest.Timestamp, loc),
+		CurrentBikes: latest.NbBikes,
+		CurrentDocks: latest.NbEmptyDocks,
+		SampleCount:  len(samples),
+		Forecast:     make([]ForecastPointResponse, len(points)),
+	}
+	for i, p := range points {
+		response.Forecast[i] = ForecastPointResponse{
+			Timestamp:  formatTime(p.Timestamp, loc),
+			Bikes:      p.Bikes,
+			EmptyDocks: p.EmptyDocks,
+		}
+	}
+
+	writeJSON(w, response)
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// defaultGapInterval is the collector interval assumed when none is requested.
+const defaultGapInterval = 5 * time.Minute
+
+// GapResponse represents a single missing snapshot window.
+type GapResponse struct {
+	Start           string  `json:"start"`
+	End             string  `json:"end"`
+	DurationMinutes float64 `json:"durationMinutes"`
+	Missing         int     `json:"missing"`
+}
+
+// GapReportResponse is the JSON response for the gaps API.
+type GapReportResponse struct {
+	ExpectedInterval string        `json:"expectedInterval"`
+	First            string        `json:"first,omitempty"`
+	Last             string        `json:"last,omitempty"`
+	SnapshotCount    int           `json:"snapshotCount"`
+	MissingCount     int           `json:"missingCount"`
+	Gaps             []GapResponse `json:"gaps"`
+}
+
+// handleGaps reports windows where the collector failed to produce snapshots.
+func (h *Handler) handleGaps(w http.ResponseWriter, r *http.Request) {
+	interval := defaultGapInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			httpError(w, r, "Invalid interval parameter", http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+
+	report, err := storage.GapReport(r.Context(), h.store, interval)
+	if err != nil {
+		slog.Error("Failed to build gap report", "error", err)
+		httpError(w, r, "Failed to build gap report", http.StatusInternalServerError)
+		return
+	}
+
+	response := GapReportResponse{
+		ExpectedInterval: report.ExpectedInterval.String(),
+		SnapshotCount:    report.SnapshotCount,
+		MissingCount:     report.MissingCount,
+		Gaps:             make([]GapResponse, len(report.Gaps)),
+	}
+	if report.SnapshotCount > 0 {
+		response.First = report.First.Format("2006-01-02T15:04:05Z")
+		response.Last = report.Last.Format("2006-01-02T15:04:05Z")
+	}
+	for i, g := range report.Gaps {
+		response.Gaps[i] = GapResponse{
+			Start:           g.Start.Format("2006-01-02T15:04:05Z"),
+			End:             g.End.Format("2006-01-02T15:04:05Z"),
+			DurationMinutes: g.Duration.Minutes(),
+			Missing:         g.Missing,
+		}
+	}
+
+	writeJSON(w, response)
+}
@@ -3,19 +3,39 @@ package web
 import (
 	"embed"
 	"encoding/json"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/cache"
+	"city-cycling/internal/city"
+	"city-cycling/internal/collector"
+	"city-cycling/internal/geo"
+	"city-cycling/internal/registry"
 	"city-cycling/internal/storage"
+	"city-cycling/internal/telemetry"
 	"city-cycling/internal/tfl"
 )
 
 const (
 	// historyCacheTTL is how long to cache the aggregate historical data.
 	historyCacheTTL = 10 * time.Minute
+	// historyMaxStale is how old a cached aggregate may be and still be
+	// served while it is refreshed in the background.
+	historyMaxStale = time.Hour
 )
 
 //go:embed templates/*
@@ -32,6 +52,17 @@ type StationResponse struct {
 	NbEBikes        int     `json:"nbEBikes"`
 	NbEmptyDocks    int     `json:"nbEmptyDocks"`
 	NbDocks         int     `json:"nbDocks"`
+	Status          string  `json:"status,omitempty"`
+	StatusSince     string  `json:"statusSince,omitempty"`
+	// Area is the borough or neighbourhood the station is in, when areas are configured.
+	Area string `json:"area,omitempty"`
+	// AdjustedEmptyDocks is NbEmptyDocks less the free docks presumed broken
+	// in the latest snapshot; EmptyDocksAdjusted is set when they differ.
+	AdjustedEmptyDocks  int  `json:"adjustedEmptyDocks"`
+	EmptyDocksAdjusted  bool `json:"emptyDocksAdjusted,omitempty"`
+	PresumedBrokenDocks int  `json:"presumedBrokenDocks,omitempty"`
+	// Attributes are the notes and tags recorded for the station through the admin API.
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // StationsResponse is the JSON response for the stations API.
@@ -47,71 +78,237 @@ type HistoryDataPointResponse struct {
 	TotalEBikes     int    `json:"totalEBikes"`
 	TotalEmptyDocks int    `json:"totalEmptyDocks"`
 	StationCount    int    `json:"stationCount"`
+	// Samples, MinBikes and MaxBikes are set for rollup buckets, whose totals
+	// are averages over Samples snapshots.
+	Samples  int  `json:"samples,omitempty"`
+	MinBikes *int `json:"minBikes,omitempty"`
+	MaxBikes *int `json:"maxBikes,omitempty"`
 }
 
 // HistoryResponse is the JSON response for the history API.
 type HistoryResponse struct {
+	// Resolution is set when the data points are rollup buckets.
+	Resolution string `json:"resolution,omitempty"`
+	StationID  int    `json:"stationId,omitempty"`
+	// Total is the number of snapshots in the requested range and NextCursor
+	// continues after the last one returned; both are set when the data points
+	// are filtered or paged.
+	Total      int                        `json:"total,omitempty"`
+	NextCursor string                     `json:"nextCursor,omitempty"`
 	DataPoints []HistoryDataPointResponse `json:"dataPoints"`
 }
 
 // Handler provides HTTP handlers for the web interface.
 type Handler struct {
 	store     storage.DataStore
-	tflClient *tfl.Client
+	feed      city.Feed
 	templates *template.Template
-
-	// Cache for historical data
+	assets    *staticAssets
+	cors      *CORSConfig
+	apiKeys   *apiKeyAuth
+	ipLimiter *ipRateLimiter
+	// Concurrency limits of the expensive routes, shared by ForCity handlers
+	loadLimiter *loadLimiter
+	// Read-only and maintenance mode, shared by ForCity handlers
+	mode *serverMode
+
+	// The city served, the path RegisterCityRoutes mounts it under (e.g.
+	// /manchester) and every city of a multi-city deployment
+	city      city.City
+	mountPath string
+	cities    []city.City
+
+	// Default time zone for local-time buckets and timestamps (the tz parameter)
+	location *time.Location
+
+	// Cache for the latest snapshot (refreshed in the background)
+	latestStations  []tfl.Station
+	latestTimestamp time.Time
+	latestMu        sync.RWMutex
+
+	// Historical snapshots served as the latest one (nil serves the real latest)
+	replay *replayState
+
+	// Per-station gauges of the latest snapshot (nil when not exported)
+	stationMetrics *collector.StationMetrics
+
+	// Anomaly detection over successive latest snapshots
+	anomalies      *analytics.AnomalyDetector
+	anomalyStatus  map[int]analytics.StationAnomaly
+	dockAdjustment map[int]analytics.DockAdjustment
+	anomaliesMu    sync.Mutex
+
+	// Cache for heatmap grid cells by zoom level (rebuilt when the latest snapshot changes)
+	heatmapCache   map[int]heatmapCacheEntry
+	heatmapCacheMu sync.Mutex
+	// Cache for station clusters by zoom level (rebuilt when the latest snapshot changes)
+	clusterCache   map[int]clusterCacheEntry
+	clusterCacheMu sync.Mutex
+	// Cache for vector tiles of the latest snapshot, keyed by snapshot and tile
+	tileCache cache.Cache
+	// Cycling times between stations (rebuilt when stations are added, removed or moved)
+	travelMatrix    *geo.TravelMatrix
+	travelMatrixKey uint64
+	travelMatrixMu  sync.Mutex
+
+	// Cache for historical data, persisted to the store and historyCacheFile
+	// and refreshed incrementally
 	historyCache     []storage.HistoricalDataPoint
 	historyCacheTime time.Time
 	historyCacheMu   sync.RWMutex
-
-	// Cache for snapshots by timestamp (immutable, no TTL needed)
-	snapshotCache   map[string][]tfl.Station
-	snapshotCacheMu sync.RWMutex
+	historyCacheFile string
+
+	// Boroughs or neighbourhoods stations are grouped by (nil when not configured)
+	areas *geo.Areas
+
+	// Station attributes edited through the admin API (nil without an object store)
+	attributes *registry.Attributes
+
+	// Engine for the query API (nil uses columnar)
+	queryEngine analytics.QueryEngine
+	// Recent snapshots held in columnar form for queries (nil unless store is a RangeDataStore)
+	columnar *analytics.ColumnarEngine
+
+	// Cache for snapshots by timestamp, in memory or shared between replicas
+	// (snapshots are immutable; a shared cache may expire them to bound its size)
+	snapshotCache    cache.Cache
+	snapshotCacheTTL time.Duration
+	// Cache the history aggregate is shared through (nil unless shared)
+	sharedCache cache.Cache
+
+	// Concurrent identical storage reads, run once per key, how many
+	// requests were served by a read they shared, and the reads that failed
+	// recently
+	reads         singleflight.Group
+	sharedReads   atomic.Int64
+	failedReads   map[string]failedRead
+	failedReadsMu sync.Mutex
+
+	// Snapshots whose neighbours are waiting to be prefetched, oldest request first
+	prefetch chan time.Time
+
+	// Bearer tokens accepted by the admin API (nil disables it)
+	adminKeys []APIKey
+
+	// Cache for the status report (rebuilt after statusCacheTTL)
+	statusCache *statusCacheEntry
+	statusMu    sync.Mutex
+
+	// Cache for the dataset catalog (rebuilt after datasetsCacheTTL)
+	datasetsCache *datasetsCacheEntry
+	datasetsMu    sync.Mutex
 }
 
-// NewHandler creates a new web handler.
-func NewHandler(store storage.DataStore, tflClient *tfl.Client) (*Handler, error) {
-	tmpl, err := template.ParseFS(templatesFS, "templates/*.html")
+// NewHandler creates a new web handler serving London, falling back to live
+// data from feed while no snapshot is stored.
+func NewHandler(store storage.DataStore, feed city.Feed) (*Handler, error) {
+	assets, err := loadStaticAssets()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("").Funcs(template.FuncMap{"asset": assets.url}).ParseFS(templatesFS, "templates/*.html")
 	if err != nil {
 		return nil, err
 	}
 
 	return &Handler{
 		store:         store,
-		tflClient:     tflClient,
+		feed:          feed,
 		templates:     tmpl,
-		snapshotCache: make(map[string][]tfl.Station),
+		assets:        assets,
+		city:          city.London(),
+		location:      city.London().Location(),
+		snapshotCache: cache.NewMemory(DefaultSnapshotCacheEntries, DefaultSnapshotCacheBytes),
+		anomalies:     analytics.NewAnomalyDetector(),
+		heatmapCache:  make(map[int]heatmapCacheEntry),
+		clusterCache:  make(map[int]clusterCacheEntry),
+		tileCache:     cache.NewMemory(tileCacheEntries, tileCacheBytes),
+		attributes:    newStationAttributes(store),
+		columnar:      newColumnarEngine(store),
+		loadLimiter:   newLoadLimiter(DefaultConcurrencyLimits),
+		mode:          &serverMode{},
+		prefetch:      make(chan time.Time, prefetchQueue),
 	}, nil
 }
 
 // RegisterRoutes registers all HTTP routes on the given mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/", h.withLogging(h.handleMap))
-	mux.HandleFunc("/api/stations", h.withLogging(h.handleStations))
-	mux.HandleFunc("/api/history", h.withLogging(h.handleHistory))
-	mux.HandleFunc("/api/history/snapshot", h.withLogging(h.handleHistorySnapshot))
+	mux.HandleFunc("/", h.withLogging(h.handleMap("")))
+	mux.HandleFunc(staticPrefix, h.withLogging(withCompression(h.handleStatic)))
+	mux.HandleFunc("GET /status", h.withLogging(h.withIPRateLimit(h.handleStatusPage(""))))
+	mux.HandleFunc("GET /feed.xml", h.withLogging(h.withIPRateLimit(withCompression(h.handleFeed("")))))
+	mux.HandleFunc("GET /tiles/{z}/{x}/{y}", h.api(h.handleStationTile))
+
+	h.registerAPI(mux, "")
+	h.registerAdmin(mux, "")
 }
 
-// withLogging wraps an HTTP handler with request timing and logging.
+// api wraps a JSON API handler with the middleware shared by all /api routes.
+func (h *Handler) api(next http.HandlerFunc) http.HandlerFunc {
+	return h.withLogging(h.withIPRateLimit(withCompression(next)))
+}
+
+// protected wraps an expensive API handler, additionally requiring an API key
+// when keys are enabled.
+func (h *Handler) protected(next http.HandlerFunc) http.HandlerFunc {
+	return h.api(h.withAPIKey(next))
+}
+
+// withLogging wraps an HTTP handler with request timing, logging and a trace span.
+// Incoming W3C trace context headers are honoured so the span joins the caller's trace.
 func (h *Handler) withLogging(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := telemetry.Tracer().Start(ctx, r.Method+" "+routeName(r),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", routeName(r)),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+		r = r.WithContext(ctx)
+
 		// Wrap response writer to capture status code
 		lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		next(lrw, r)
 
+		span.SetAttributes(attribute.Int("http.response.status_code", lrw.statusCode))
+		if lrw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(lrw.statusCode))
+		}
+
 		duration := time.Since(start)
-		log.Printf("[HTTP] %s %s - %d (%s)", r.Method, r.URL.Path, lrw.statusCode, duration)
+		attrs := []any{"requestId", requestID(r.Context()), "method", r.Method, "path", r.URL.Path, "route", r.Pattern, "status", lrw.statusCode, "bytes", lrw.bytes, "duration", duration}
+		if tenant := requestTenant(r.Context()); tenant != "" {
+			attrs = append(attrs, "tenant", tenant)
+		}
+		slog.Info("HTTP request", attrs...)
 	}
 }
 
-// loggingResponseWriter wraps http.ResponseWriter to capture the status code.
+// routeName returns the matched mux pattern without its method prefix.
+func routeName(r *http.Request) string {
+	pattern := r.Pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = pattern[i+1:]
+	}
+	if pattern == "" {
+		return r.URL.Path
+	}
+	return pattern
+}
+
+// loggingResponseWriter wraps http.ResponseWriter to capture the status code
+// and the number of body bytes written.
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
@@ -119,107 +316,152 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-// handleMap serves the main map page.
-func (h *Handler) handleMap(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
+func (lrw *loggingResponseWriter) Write(p []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(p)
+	lrw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
 
-	if err := h.templates.ExecuteTemplate(w, "map.html", nil); err != nil {
-		log.Printf("Template error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// handleMap serves the main map page for the routes mounted at mount.
+func (h *Handler) handleMap(mount string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != mount+"/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		// The page inlines the latest snapshot, so it must not be cached
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := h.templates.ExecuteTemplate(w, "map.html", h.mapPage(r.Context(), mount)); err != nil {
+			slog.Error("Template error", "error", err)
+			httpError(w, r, "Internal server error", http.StatusInternalServerError)
+		}
 	}
 }
 
 // handleStations serves the stations API endpoint.
 func (h *Handler) handleStations(w http.ResponseWriter, r *http.Request) {
-	// Try to read from storage first
-	stations, timestamp, err := h.store.ReadLatestStations()
-	if err != nil {
-		// Fall back to live API if no stored data
-		log.Printf("No stored data, fetching live: %v", err)
-		liveData, err := h.tflClient.FetchStations()
-		if err != nil {
-			http.Error(w, "Failed to fetch station data", http.StatusInternalServerError)
-			return
+	// Serve from the in-memory cache, loading it on first use
+	stations, timestamp, ok := h.cachedLatest(r.Context())
+	if !ok {
+		if err := h.RefreshLatest(r.Context()); err != nil {
+			// Fall back to live API if no stored data
+			slog.Warn("No stored data, fetching live", "error", err)
+			liveData, err := h.feed.FetchStations(r.Context())
+			if err != nil {
+				httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+				return
+			}
+			stations = liveData.Stations
+		} else {
+			stations, timestamp, _ = h.cachedLatest(r.Context())
 		}
-		stations = liveData.Stations
 	}
 
+	// Clients polling for updates get a 304 until a new snapshot arrives
+	if !timestamp.IsZero() && checkETag(w, r, snapshotETag(fmt.Sprintf("stations-%d", h.attributesRevision()), timestamp, len(stations))) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.stationsResponse(stations, timestamp)); err != nil {
+		slog.Error("JSON encoding error", "error", err)
+	}
+}
+
+// stationsResponse builds the /stations response for a snapshot, with each
+// station's anomaly status, area, free docks adjusted for docks presumed broken
+// and attributes.
+func (h *Handler) stationsResponse(stations []tfl.Station, timestamp time.Time) StationsResponse {
 	response := StationsResponse{
 		Timestamp: timestamp.Format("2006-01-02T15:04:05Z"),
 		Stations:  make([]StationResponse, len(stations)),
 	}
 
 	for i, s := range stations {
-		response.Stations[i] = StationResponse{
-			ID:              s.ID,
-			Name:            s.Name,
-			Lat:             s.Lat,
-			Long:            s.Long,
-			NbBikes:         s.NbBikes,
-			NbStandardBikes: s.NbStandardBikes,
-			NbEBikes:        s.NbEBikes,
-			NbEmptyDocks:    s.NbEmptyDocks,
-			NbDocks:         s.NbDocks,
+		response.Stations[i] = toStationResponse(s)
+		status, since := h.stationStatus(s.ID)
+		response.Stations[i].Status = status
+		if !since.IsZero() {
+			response.Stations[i].StatusSince = since.Format("2006-01-02T15:04:05Z")
 		}
+		response.Stations[i].Area = h.stationArea(s.Lat, s.Long)
+		if adj, ok := h.stationDockAdjustment(s.ID); ok {
+			response.Stations[i].AdjustedEmptyDocks = adj.EmptyDocks
+			response.Stations[i].EmptyDocksAdjusted = true
+			response.Stations[i].PresumedBrokenDocks = adj.PresumedBroken
+		}
+		response.Stations[i].Attributes = h.stationAttributes(s.ID)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("JSON encoding error: %v", err)
-	}
+	return response
 }
 
 // handleHistory serves historical usage data.
 func (h *Handler) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("resolution") != "" {
+		h.handleHistoryRollup(w, r)
+		return
+	}
+
 	// Check if store supports historical data
 	historicalStore, ok := h.store.(storage.HistoricalDataStore)
 	if !ok {
-		http.Error(w, "Historical data not available with current storage backend", http.StatusNotImplemented)
+		httpError(w, r, "Historical data not available with current storage backend", http.StatusNotImplemented)
 		return
 	}
 
-	// Check cache first
-	h.historyCacheMu.RLock()
-	if h.historyCache != nil && time.Since(h.historyCacheTime) < historyCacheTTL {
-		dataPoints := h.historyCache
-		h.historyCacheMu.RUnlock()
-		log.Printf("History cache hit (%d data points)", len(dataPoints))
-		h.writeHistoryResponse(w, dataPoints)
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	h.historyCacheMu.RUnlock()
-
-	// Cache miss - fetch from storage
-	ctx := r.Context()
-	dataPoints, err := historicalStore.GetHistoricalData(ctx)
+	query, err := parseHistoryQuery(r)
 	if err != nil {
-		log.Printf("Failed to get historical data: %v", err)
-		http.Error(w, "Failed to fetch historical data", http.StatusInternalServerError)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Update cache
-	h.historyCacheMu.Lock()
-	h.historyCache = dataPoints
-	h.historyCacheTime = time.Now()
-	h.historyCacheMu.Unlock()
-	log.Printf("History cache updated (%d data points)", len(dataPoints))
+	dataPoints, stale, err := h.historyWindow(r.Context(), historicalStore, query.from, query.to)
+	if err != nil {
+		slog.Error("Failed to get historical data", "error", err)
+		httpError(w, r, "Failed to fetch historical data", http.StatusInternalServerError)
+		return
+	}
+	if stale {
+		w.Header().Set(staleHeader, "true")
+	}
 
-	h.writeHistoryResponse(w, dataPoints)
+	h.writeHistoryResponse(w, r, dataPoints, loc, query)
 }
 
-// writeHistoryResponse writes the history response JSON.
-func (h *Handler) writeHistoryResponse(w http.ResponseWriter, dataPoints []storage.HistoricalDataPoint) {
-	response := HistoryResponse{
-		DataPoints: make([]HistoryDataPointResponse, len(dataPoints)),
+// writeHistoryResponse writes the history response JSON for the points selected
+// by query with timestamps in loc, or a 304 if the client already has the version
+// ending at the latest data point. dataPoints must be sorted newest first.
+func (h *Handler) writeHistoryResponse(w http.ResponseWriter, r *http.Request, dataPoints []storage.HistoricalDataPoint, loc *time.Location, query historyQuery) {
+	var latest time.Time
+	for _, dp := range dataPoints {
+		if dp.Timestamp.After(latest) {
+			latest = dp.Timestamp
+		}
+	}
+	if checkETag(w, r, snapshotETag("history-"+loc.String(), latest, len(dataPoints))) {
+		return
+	}
+
+	var response HistoryResponse
+	if query.paged() || !query.from.IsZero() || !query.to.IsZero() {
+		dataPoints, response.Total, response.NextCursor = query.apply(dataPoints)
 	}
+	response.DataPoints = make([]HistoryDataPointResponse, len(dataPoints))
 
 	for i, dp := range dataPoints {
 		response.DataPoints[i] = HistoryDataPointResponse{
-			Timestamp:       dp.Timestamp.Format("2006-01-02T15:04:05Z"),
+			Timestamp:       formatTime(dp.Timestamp, loc),
 			TotalBikes:      dp.TotalBikes,
 			TotalEBikes:     dp.TotalEBikes,
 			TotalEmptyDocks: dp.TotalEmptyDocks,
@@ -228,9 +470,14 @@ func (h *Handler) writeHistoryResponse(w http.ResponseWriter, dataPoints []stora
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	if w.Header().Get(staleHeader) != "" {
+		// Refreshed shortly, so not worth caching for long
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("JSON encoding error: %v", err)
+		slog.Error("JSON encoding error", "error", err)
 	}
 }
 
@@ -239,79 +486,87 @@ func (h *Handler) handleHistorySnapshot(w http.ResponseWriter, r *http.Request)
 	// Get timestamp from query parameter
 	timestampStr := r.URL.Query().Get("timestamp")
 	if timestampStr == "" {
-		http.Error(w, "Missing timestamp parameter", http.StatusBadRequest)
+		httpError(w, r, "Missing timestamp parameter", http.StatusBadRequest)
 		return
 	}
 
 	// Parse timestamp
 	targetTime, err := time.Parse(time.RFC3339, timestampStr)
 	if err != nil {
-		http.Error(w, "Invalid timestamp format", http.StatusBadRequest)
+		httpError(w, r, "Invalid timestamp format", http.StatusBadRequest)
+		return
+	}
+
+	from, to, windowed, err := parseSnapshotWindow(r, targetTime)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if windowed {
+		h.handleHistorySnapshotWindow(w, r, targetTime, from, to)
 		return
 	}
 
 	// Use normalized timestamp string as cache key
 	cacheKey := targetTime.UTC().Format(time.RFC3339)
 
-	// Check cache first (snapshots are immutable, no TTL needed)
-	h.snapshotCacheMu.RLock()
-	if stations, ok := h.snapshotCache[cacheKey]; ok {
-		h.snapshotCacheMu.RUnlock()
-		log.Printf("Snapshot cache hit for %s (%d stations)", cacheKey, len(stations))
-		h.writeSnapshotResponse(w, targetTime, stations)
+	// Check cache first
+	if stations, ok := h.cachedSnapshot(r.Context(), cacheKey); ok {
+		slog.Debug("Snapshot cache hit", "timestamp", cacheKey, "stations", len(stations))
+		h.queuePrefetch(targetTime)
+		h.writeSnapshotResponse(w, r, targetTime, stations)
 		return
 	}
-	h.snapshotCacheMu.RUnlock()
 
-	// Check if store supports R2 operations
-	r2Store, ok := h.store.(storage.R2DataStore)
+	// Check if store supports historical data
+	historicalStore, ok := h.store.(storage.HistoricalDataStore)
 	if !ok {
-		http.Error(w, "Historical snapshot data not available with current storage backend", http.StatusNotImplemented)
+		httpError(w, r, "Historical snapshot data not available with current storage backend", http.StatusNotImplemented)
 		return
 	}
 
 	// Cache miss - fetch from storage
-	ctx := r.Context()
-	stations, err := r2Store.GetSnapshotByTimestamp(ctx, targetTime)
+	stations, err := h.readSnapshot(r.Context(), historicalStore, targetTime)
 	if err != nil {
-		log.Printf("Failed to get snapshot for timestamp %s: %v", timestampStr, err)
-		http.Error(w, "Failed to fetch snapshot data", http.StatusInternalServerError)
+		slog.Error("Failed to get snapshot", "timestamp", timestampStr, "error", err)
+		httpError(w, r, "Failed to fetch snapshot data", http.StatusInternalServerError)
 		return
 	}
 
-	// Update cache
-	h.snapshotCacheMu.Lock()
-	h.snapshotCache[cacheKey] = stations
-	h.snapshotCacheMu.Unlock()
-	log.Printf("Snapshot cache updated for %s (%d stations)", cacheKey, len(stations))
-
-	h.writeSnapshotResponse(w, targetTime, stations)
+	h.queuePrefetch(targetTime)
+	h.writeSnapshotResponse(w, r, targetTime, stations)
 }
 
 // writeSnapshotResponse writes the snapshot response JSON.
-func (h *Handler) writeSnapshotResponse(w http.ResponseWriter, timestamp time.Time, stations []tfl.Station) {
+func (h *Handler) writeSnapshotResponse(w http.ResponseWriter, r *http.Request, timestamp time.Time, stations []tfl.Station) {
 	response := StationsResponse{
 		Timestamp: timestamp.Format("2006-01-02T15:04:05Z"),
 		Stations:  make([]StationResponse, len(stations)),
 	}
 
 	for i, s := range stations {
-		response.Stations[i] = StationResponse{
-			ID:              s.ID,
-			Name:            s.Name,
-			Lat:             s.Lat,
-			Long:            s.Long,
-			NbBikes:         s.NbBikes,
-			NbStandardBikes: s.NbStandardBikes,
-			NbEBikes:        s.NbEBikes,
-			NbEmptyDocks:    s.NbEmptyDocks,
-			NbDocks:         s.NbDocks,
-		}
+		response.Stations[i] = toStationResponse(s)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "public, max-age=604800, immutable") // Cache for 1 week (snapshots are immutable)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("JSON encoding error: %v", err)
+		slog.Error("JSON encoding error", "error", err)
+	}
+}
+
+// toStationResponse converts a station to its JSON representation.
+func toStationResponse(s tfl.Station) StationResponse {
+	return StationResponse{
+		ID:                 s.ID,
+		Name:               s.Name,
+		Lat:                s.Lat,
+		Long:               s.Long,
+		NbBikes:            s.NbBikes,
+		NbStandardBikes:    s.NbStandardBikes,
+		NbEBikes:           s.NbEBikes,
+		NbEmptyDocks:       s.NbEmptyDocks,
+		NbDocks:            s.NbDocks,
+		AdjustedEmptyDocks: s.NbEmptyDocks,
 	}
 }
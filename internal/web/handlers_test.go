@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+	"city-cycling/internal/tfl/tfltest"
+)
+
+// benchmarkStart is when the benchmark snapshots begin.
+var benchmarkStart = time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC)
+
+// benchmarkServer returns the routes of a handler serving a day of 5-minute
+// snapshots of a synthetic network the size of London's.
+func benchmarkServer(b *testing.B) http.Handler {
+	b.Helper()
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	b.Cleanup(func() { slog.SetDefault(logger) })
+
+	dir := b.TempDir()
+	snaps := tfltest.NewFeed(tfltest.Config{Seed: 1}).Snapshots(288, benchmarkStart, 5*time.Minute)
+	if err := tfltest.WriteSnapshots(context.Background(), dir, snaps); err != nil {
+		b.Fatal(err)
+	}
+	feed, _ := tfltest.NewServer(tfltest.Config{Seed: 1})
+	b.Cleanup(feed.Close)
+
+	h, err := NewHandler(storage.NewTSVStorage(dir), tfl.NewClientWithEndpoint(feed.URL+tfltest.XMLPath))
+	if err != nil {
+		b.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return h.Middleware(mux)
+}
+
+// benchmarkGet serves GET target over and over, after one request to warm the
+// handler's caches.
+func benchmarkGet(b *testing.B, target string, header http.Header) {
+	handler := benchmarkServer(b)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header = header
+	serve := func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+		}
+	}
+	serve()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		serve()
+	}
+}
+
+// BenchmarkStations serves the latest snapshot the map loads.
+func BenchmarkStations(b *testing.B) {
+	benchmarkGet(b, "/api/v1/stations", http.Header{})
+}
+
+// BenchmarkStationsGzip serves the latest snapshot compressed, as browsers ask for it.
+func BenchmarkStationsGzip(b *testing.B) {
+	benchmarkGet(b, "/api/v1/stations", http.Header{"Accept-Encoding": {"gzip"}})
+}
+
+// BenchmarkHistory serves the history aggregate from its cache.
+func BenchmarkHistory(b *testing.B) {
+	benchmarkGet(b, "/api/v1/history", http.Header{})
+}
+
+// BenchmarkHistorySnapshot serves a past snapshot from the snapshot cache.
+func BenchmarkHistorySnapshot(b *testing.B) {
+	ts := benchmarkStart.Add(12 * time.Hour).Format(time.RFC3339)
+	benchmarkGet(b, "/api/v1/history/snapshot?timestamp="+ts, http.Header{})
+}
+
+// BenchmarkQuery runs a day-long query over the snapshots held in columnar form.
+func BenchmarkQuery(b *testing.B) {
+	from, to := benchmarkStart.Format(time.RFC3339), benchmarkStart.Add(24*time.Hour).Format(time.RFC3339)
+	benchmarkGet(b, "/api/v1/query?select=avg(occupancy),count&group_by=station,hour&tz=UTC&from="+from+"&to="+to, http.Header{})
+}
+
+// BenchmarkAnalyticsSummary scans a day of snapshots into the network summary.
+func BenchmarkAnalyticsSummary(b *testing.B) {
+	from, to := benchmarkStart.Format(time.RFC3339), benchmarkStart.Add(24*time.Hour).Format(time.RFC3339)
+	benchmarkGet(b, "/api/v1/analytics/summary?from="+from+"&to="+to, http.Header{})
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/geo"
+)
+
+// defaultHeatmapZoom is the map zoom used when a heatmap request has no z parameter.
+const defaultHeatmapZoom = 12
+
+// HeatmapCellResponse is an aggregated grid cell.
+type HeatmapCellResponse struct {
+	Lat      float64    `json:"lat"`
+	Lng      float64    `json:"lng"`
+	Bounds   [4]float64 `json:"bounds"` // south, west, north, east
+	Value    float64    `json:"value"`
+	Stations int        `json:"stations"`
+}
+
+// HeatmapResponse is the JSON response for the heatmap API.
+type HeatmapResponse struct {
+	Timestamp string                `json:"timestamp"`
+	Zoom      int                   `json:"zoom"`
+	Metric    string                `json:"metric"`
+	Cells     []HeatmapCellResponse `json:"cells"`
+}
+
+// heatmapCacheEntry holds grid cells computed for one zoom level of a snapshot.
+type heatmapCacheEntry struct {
+	timestamp time.Time
+	cells     []geo.Cell
+}
+
+// handleHeatmap serves pre-aggregated availability grid cells for density layers.
+func (h *Handler) handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	zoom := defaultHeatmapZoom
+	if v := r.URL.Query().Get("z"); v != "" {
+		z, err := strconv.Atoi(v)
+		if err != nil || z < 0 || z > geo.MaxZoom {
+			httpError(w, r, "Invalid z parameter", http.StatusBadRequest)
+			return
+		}
+		zoom = z
+	}
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "bikes"
+	}
+	value, err := heatmapValue(metric)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+
+	// Cells only change when a new snapshot arrives
+	h.heatmapCacheMu.Lock()
+	entry, hit := h.heatmapCache[zoom]
+	if !hit || !entry.timestamp.Equal(timestamp) {
+		entry = heatmapCacheEntry{timestamp: timestamp, cells: geo.GridCells(stations, zoom)}
+		h.heatmapCache[zoom] = entry
+	}
+	h.heatmapCacheMu.Unlock()
+
+	response := HeatmapResponse{
+		Timestamp: timestamp.Format("2006-01-02T15:04:05Z"),
+		Zoom:      zoom,
+		Metric:    metric,
+		Cells:     make([]HeatmapCellResponse, len(entry.cells)),
+	}
+	for i, c := range entry.cells {
+		south, west, north, east := c.Bounds()
+		response.Cells[i] = HeatmapCellResponse{
+			Lat:      c.Lat,
+			Lng:      c.Lng,
+			Bounds:   [4]float64{south, west, north, east},
+			Value:    value(c),
+			Stations: c.Stations,
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// heatmapValue returns the function computing a cell's value for metric.
+func heatmapValue(metric string) (func(geo.Cell) float64, error) {
+	switch metric {
+	case "bikes":
+		return func(c geo.Cell) float64 { return float64(c.Bikes) }, nil
+	case "docks":
+		return func(c geo.Cell) float64 { return float64(c.EmptyDocks) }, nil
+	case "occupancy":
+		return geo.Cell.Occupancy, nil
+	default:
+		return nil, fmt.Errorf("Invalid metric parameter (use bikes, docks or occupancy)")
+	}
+}
@@ -0,0 +1,220 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/storage"
+)
+
+// historyQuery selects and shapes the raw /history data points.
+type historyQuery struct {
+	from, to time.Time // zero means unbounded
+	// cursor continues a previous page: only points older than it are returned
+	cursor    time.Time
+	offset    int
+	limit     int // 0 means no limit
+	maxPoints int // 0 means no downsampling
+}
+
+// paged reports whether the query can return fewer points than the range holds.
+func (q historyQuery) paged() bool {
+	return q.limit > 0 || q.offset > 0 || !q.cursor.IsZero() || q.maxPoints > 0
+}
+
+// parseHistoryQuery reads the optional from, to, cursor, offset, limit and
+// maxPoints query parameters of /history.
+func parseHistoryQuery(r *http.Request) (historyQuery, error) {
+	var q historyQuery
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &q.from}, {"to", &q.to}, {"cursor", &q.cursor}} {
+		if v := r.URL.Query().Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return historyQuery{}, errInvalidParam(p.name)
+			}
+			*p.t = t
+		}
+	}
+	if !q.from.IsZero() && !q.to.IsZero() && q.from.After(q.to) {
+		return historyQuery{}, fmt.Errorf("from must be before to")
+	}
+
+	var err error
+	if q.offset, err = parseIntParam(r, "offset", 0); err != nil {
+		return historyQuery{}, err
+	}
+	if q.limit, err = parseIntParam(r, "limit", 0); err != nil {
+		return historyQuery{}, err
+	}
+	if q.maxPoints, err = parseIntParam(r, "maxPoints", 0); err != nil {
+		return historyQuery{}, err
+	}
+	if q.maxPoints > 0 && q.maxPoints < 3 {
+		return historyQuery{}, fmt.Errorf("maxPoints must be at least 3")
+	}
+	return q, nil
+}
+
+// apply returns the page of points (newest first) selected by q, the number of
+// points in the from/to range and the cursor of the next page ("" when this is
+// the last one). The page is downsampled to maxPoints after paging, so cursors
+// always continue from raw points.
+func (q historyQuery) apply(points []storage.HistoricalDataPoint) ([]storage.HistoricalDataPoint, int, string) {
+	// Newest first, so index ranges below are time ranges
+	lo := sort.Search(len(points), func(i int) bool {
+		return q.to.IsZero() || !points[i].Timestamp.After(q.to)
+	})
+	hi := len(points)
+	if !q.from.IsZero() {
+		hi = sort.Search(len(points), func(i int) bool {
+			return points[i].Timestamp.Before(q.from)
+		})
+	}
+	hi = max(hi, lo)
+	total := hi - lo
+
+	start := lo
+	if !q.cursor.IsZero() {
+		start = max(start, sort.Search(len(points), func(i int) bool {
+			return points[i].Timestamp.Before(q.cursor)
+		}))
+	}
+	start = min(start+q.offset, hi)
+	end := hi
+	if q.limit > 0 {
+		end = min(start+q.limit, hi)
+	}
+	page := points[start:end]
+
+	var next string
+	if end < hi && len(page) > 0 {
+		next = page[len(page)-1].Timestamp.UTC().Format(time.RFC3339)
+	}
+
+	if q.maxPoints > 0 && len(page) > q.maxPoints {
+		keep := analytics.Downsample(len(page), q.maxPoints,
+			func(i int) float64 { return float64(page[i].Timestamp.Unix()) },
+			func(i int) float64 { return float64(page[i].TotalBikes) })
+		sampled := make([]storage.HistoricalDataPoint, len(keep))
+		for i, k := range keep {
+			sampled[i] = page[k]
+		}
+		page = sampled
+	}
+	return page, total, next
+}
+
+// parseSnapshotWindow reads the optional tolerance, from and to parameters of
+// /history/snapshot, which bound the snapshots considered to those within
+// tolerance of target and inside [from, to]. It reports false if none is set.
+func parseSnapshotWindow(r *http.Request, target time.Time) (time.Time, time.Time, bool, error) {
+	var from, to time.Time
+	q := r.URL.Query()
+	if v := q.Get("tolerance"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return time.Time{}, time.Time{}, false, errInvalidParam("tolerance")
+		}
+		from, to = target.Add(-d), target.Add(d)
+	}
+	for name, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, false, errInvalidParam(name)
+		}
+		// Keep the narrower of the tolerance and the explicit bound
+		if bound.IsZero() || (name == "from" && t.After(*bound)) || (name == "to" && t.Before(*bound)) {
+			*bound = t
+		}
+	}
+	if from.IsZero() && to.IsZero() {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("from must be before to")
+	}
+	return from, to, true, nil
+}
+
+// handleHistorySnapshotWindow serves the snapshot in [from, to] closest to
+// target, reading no snapshot outside the window, with the snapshot's own
+// timestamp.
+func (h *Handler) handleHistorySnapshotWindow(w http.ResponseWriter, r *http.Request, target, from, to time.Time) {
+	rangeStore, ok := h.store.(storage.RangeDataStore)
+	if !ok {
+		httpError(w, r, "Historical snapshot data not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+	// Keyed by the request, not the snapshot, which is not known until read
+	key := "nearest:" + target.UTC().Format(time.RFC3339) + "/" + from.UTC().Format(time.RFC3339) + "/" + to.UTC().Format(time.RFC3339)
+	snap, err := sharedRead(r.Context(), h, key, func(ctx context.Context) (storage.Snapshot, error) {
+		snap, err := storage.NearestSnapshot(ctx, rangeStore, target, from, to)
+		if err != nil {
+			return storage.Snapshot{}, err
+		}
+		// Cached under the snapshot's own time, which a later exact request hits
+		h.cacheSnapshot(ctx, snap.Timestamp.UTC().Format(time.RFC3339), snap.Stations)
+		return snap, nil
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		httpError(w, r, "No snapshot within the requested window", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get snapshot", "timestamp", target.Format(time.RFC3339), "error", err)
+		httpError(w, r, "Failed to fetch snapshot data", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeSnapshotResponse(w, r, snap.Timestamp.UTC(), snap.Stations)
+}
+
+// HistoryTimestampsResponse lists the times of stored snapshots.
+type HistoryTimestampsResponse struct {
+	// Timestamps are RFC 3339 in UTC, newest first.
+	Timestamps []string `json:"timestamps"`
+}
+
+// handleHistoryTimestamps lists the snapshot times in an optional from/to
+// range, taken from snapshot key names without reading any snapshot.
+func (h *Handler) handleHistoryTimestamps(w http.ResponseWriter, r *http.Request) {
+	query, err := parseHistoryQuery(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timestamps, err := storage.ListTimestamps(r.Context(), h.store, storage.TimestampQuery{From: query.from, To: query.to, Limit: query.limit})
+	if err != nil {
+		slog.Error("Failed to list snapshot timestamps", "error", err)
+		httpError(w, r, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	var latest time.Time
+	if len(timestamps) > 0 {
+		latest = timestamps[0]
+	}
+	if checkETag(w, r, snapshotETag("timestamps", latest, len(timestamps))) {
+		return
+	}
+
+	response := HistoryTimestampsResponse{Timestamps: make([]string, len(timestamps))}
+	for i, ts := range timestamps {
+		response.Timestamps[i] = ts.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, response)
+}
@@ -0,0 +1,372 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"city-cycling/internal/cache"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// historyCacheKey is the object key under which the history aggregate is
+	// recorded in the store, so restarts do not rescan every snapshot.
+	historyCacheKey = "meta/history_cache.json"
+	// sharedHistoryKey is the key of the history aggregate in a shared cache.
+	sharedHistoryKey = "history"
+)
+
+// historyCacheState is the persisted form of the history cache.
+type historyCacheState struct {
+	// Points are ordered newest first, one per snapshot.
+	Points []storage.HistoricalDataPoint `json:"points"`
+}
+
+// SetHistoryCacheFile also persists the history aggregate to path on local
+// disk, which is read in preference to the store copy when it is at least as
+// recent.
+func (h *Handler) SetHistoryCacheFile(path string) {
+	h.historyCacheFile = path
+}
+
+// loadHistoryCache restores the history aggregate recorded by a previous run,
+// from the local file or the store, whichever ends later. The loaded cache is
+// marked expired so the first refresh brings it up to date incrementally.
+func (h *Handler) loadHistoryCache(ctx context.Context) {
+	var (
+		points []storage.HistoricalDataPoint
+		source string
+	)
+	if h.historyCacheFile != "" {
+		data, err := os.ReadFile(h.historyCacheFile)
+		switch {
+		case err == nil:
+			if p, err := decodeHistoryCache(data); err != nil {
+				slog.Error("Failed to parse history cache", "path", h.historyCacheFile, "error", err)
+			} else {
+				points, source = p, h.historyCacheFile
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			slog.Error("Failed to load history cache", "path", h.historyCacheFile, "error", err)
+		}
+	}
+	if objects, ok := h.store.(storage.ObjectStore); ok {
+		data, err := objects.GetObject(ctx, historyCacheKey)
+		switch {
+		case err == nil:
+			if p, err := decodeHistoryCache(data); err != nil {
+				slog.Error("Failed to parse history cache", "key", historyCacheKey, "error", err)
+			} else if historyLatest(p).After(historyLatest(points)) {
+				points, source = p, historyCacheKey
+			}
+		case !errors.Is(err, storage.ErrNotFound):
+			slog.Error("Failed to load history cache", "key", historyCacheKey, "error", err)
+		}
+	}
+	if points == nil {
+		return
+	}
+
+	h.historyCacheMu.Lock()
+	if h.historyCache == nil {
+		h.historyCache = points
+	}
+	h.historyCacheMu.Unlock()
+	slog.Info("Loaded history cache", "source", source, "dataPoints", len(points), "latest", historyLatest(points).Format(time.RFC3339))
+}
+
+// historyPoints returns the history aggregate, newest first, refreshing the
+// cache when it has expired.
+func (h *Handler) historyPoints(ctx context.Context, store storage.HistoricalDataStore) ([]storage.HistoricalDataPoint, error) {
+	points, _, err := h.cachedHistory(ctx, store)
+	return points, err
+}
+
+// cachedHistory returns the history aggregate, newest first, and whether it is
+// stale: older than historyCacheTTL. A stale aggregate is returned at once
+// while a refresh runs in the background, and also when its refresh fails, so
+// a storage hiccup serves slightly old data rather than errors. Only requests
+// finding no aggregate, or one older than historyMaxStale, wait for the refresh.
+func (h *Handler) cachedHistory(ctx context.Context, store storage.HistoricalDataStore) ([]storage.HistoricalDataPoint, bool, error) {
+	h.historyCacheMu.RLock()
+	cached, cachedAt := h.historyCache, h.historyCacheTime
+	h.historyCacheMu.RUnlock()
+	age := time.Since(cachedAt)
+	if cached != nil && age < historyCacheTTL {
+		slog.Debug("History cache hit", "dataPoints", len(cached))
+		return cached, false, nil
+	}
+
+	// One refresh at a time; requests that arrive during it get its result
+	refresh := func(ctx context.Context) ([]storage.HistoricalDataPoint, error) {
+		return sharedRead(ctx, h, "history", func(ctx context.Context) ([]storage.HistoricalDataPoint, error) {
+			return h.refreshHistory(ctx, store)
+		})
+	}
+	if cached != nil && age < historyMaxStale {
+		go refresh(context.WithoutCancel(ctx))
+		return cached, true, nil
+	}
+	points, err := refresh(ctx)
+	if err != nil && cached != nil && ctx.Err() == nil {
+		slog.Warn("Serving stale history after a failed refresh", "dataPoints", len(cached), "latest", historyLatest(cached).Format(time.RFC3339), "error", err)
+		return cached, true, nil
+	}
+	return points, false, err
+}
+
+// refreshHistory updates the history cache, unless a refresh that finished
+// since it was found stale already did.
+func (h *Handler) refreshHistory(ctx context.Context, store storage.HistoricalDataStore) ([]storage.HistoricalDataPoint, error) {
+	h.historyCacheMu.RLock()
+	cached, cachedAt := h.historyCache, h.historyCacheTime
+	h.historyCacheMu.RUnlock()
+	if cached != nil && time.Since(cachedAt) < historyCacheTTL {
+		return cached, nil
+	}
+	// Another replica may have read the new snapshots already
+	shared := h.sharedHistory(ctx)
+	if historyLatest(shared).After(historyLatest(cached)) {
+		cached = shared
+	}
+
+	start := time.Now()
+	var (
+		points  []storage.HistoricalDataPoint
+		changed int
+		err     error
+	)
+	// Labelled so a CPU profile can single out history refreshes
+	pprof.Do(ctx, pprof.Labels("task", "history", "city", h.city.ID), func(ctx context.Context) {
+		points, changed, err = h.updateHistory(ctx, store, cached)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.historyCacheMu.Lock()
+	h.historyCache = points
+	h.historyCacheTime = time.Now()
+	h.historyCacheMu.Unlock()
+	slog.Info("History cache updated", "dataPoints", len(points), "changed", changed, "duration", time.Since(start))
+
+	switch {
+	case changed > 0:
+		h.saveHistoryCache(ctx, points)
+	case h.sharedCache != nil && historyLatest(points).After(historyLatest(shared)):
+		// Loaded from the store or a local file, but not shared yet
+		if data, err := json.Marshal(historyCacheState{Points: points}); err == nil {
+			h.shareHistory(ctx, data)
+		}
+	}
+	return points, nil
+}
+
+// historyWindow returns the history points for a request bounded by from and
+// to (either may be zero), newest first, and whether they are stale (see
+// cachedHistory). Until the aggregate has been built, a request with a from
+// bound reads only the snapshots in its window instead of waiting for every
+// snapshot in the archive to be aggregated.
+func (h *Handler) historyWindow(ctx context.Context, store storage.HistoricalDataStore, from, to time.Time) ([]storage.HistoricalDataPoint, bool, error) {
+	h.historyCacheMu.RLock()
+	cold := h.historyCache == nil
+	h.historyCacheMu.RUnlock()
+
+	rangeStore, ok := store.(storage.RangeDataStore)
+	if !cold || !ok || from.IsZero() {
+		return h.cachedHistory(ctx, store)
+	}
+	start := time.Now()
+	key := "history:" + from.UTC().Format(time.RFC3339) + "/" + to.UTC().Format(time.RFC3339)
+	points, err := sharedRead(ctx, h, key, func(ctx context.Context) ([]storage.HistoricalDataPoint, error) {
+		return storage.HistoricalDataRange(ctx, rangeStore, from, to)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	slog.Info("History window read before the cache was built", "from", from.Format(time.RFC3339), "dataPoints", len(points), "duration", time.Since(start))
+	return points, false, nil
+}
+
+// updateHistory brings cached up to date with the snapshots in store, reading
+// only snapshots it does not cover yet and dropping points whose snapshots are
+// gone. Without a cache, or a store that can read a range of snapshots, it
+// aggregates every snapshot. It returns the points and how many changed.
+func (h *Handler) updateHistory(ctx context.Context, store storage.HistoricalDataStore, cached []storage.HistoricalDataPoint) ([]storage.HistoricalDataPoint, int, error) {
+	rangeStore, ok := store.(storage.RangeDataStore)
+	if cached == nil || !ok {
+		points, err := store.GetHistoricalData(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		sortHistory(points)
+		return points, len(points), nil
+	}
+
+	timestamps, err := store.ListAvailableTimestamps(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	// Keyed by Unix seconds, the resolution of snapshot keys
+	listed := make(map[int64]bool, len(timestamps))
+	for _, ts := range timestamps {
+		listed[ts.Unix()] = true
+	}
+
+	points := make([]storage.HistoricalDataPoint, 0, len(timestamps))
+	have := make(map[int64]bool, len(cached))
+	for _, dp := range cached {
+		if listed[dp.Timestamp.Unix()] {
+			points = append(points, dp)
+			have[dp.Timestamp.Unix()] = true
+		}
+	}
+	changed := len(cached) - len(points)
+
+	var first, last time.Time
+	for _, ts := range timestamps {
+		if have[ts.Unix()] {
+			continue
+		}
+		if first.IsZero() || ts.Before(first) {
+			first = ts
+		}
+		if ts.After(last) {
+			last = ts
+		}
+	}
+	if !first.IsZero() {
+		// Usually just the snapshots since the last refresh; a backfill of old
+		// snapshots re-reads the range in between
+		err := rangeStore.ForEachSnapshot(ctx, first, last, func(snap storage.Snapshot) error {
+			if !have[snap.Timestamp.Unix()] {
+				points = append(points, historyPoint(snap))
+				have[snap.Timestamp.Unix()] = true
+				changed++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read new snapshots: %w", err)
+		}
+	}
+
+	if changed == 0 {
+		return cached, 0, nil
+	}
+	sortHistory(points)
+	return points, changed, nil
+}
+
+// sharedHistory returns the history aggregate from the shared cache, or nil.
+func (h *Handler) sharedHistory(ctx context.Context) []storage.HistoricalDataPoint {
+	if h.sharedCache == nil {
+		return nil
+	}
+	data, err := h.sharedCache.Get(ctx, sharedHistoryKey)
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			slog.Warn("Failed to read shared history cache", "error", err)
+		}
+		return nil
+	}
+	points, err := decodeHistoryCache(data)
+	if err != nil {
+		slog.Warn("Failed to parse shared history cache", "error", err)
+		return nil
+	}
+	return points
+}
+
+// shareHistory records an encoded history aggregate in the shared cache.
+func (h *Handler) shareHistory(ctx context.Context, data []byte) {
+	if err := h.sharedCache.Set(ctx, sharedHistoryKey, data, 0); err != nil {
+		slog.Warn("Failed to write shared history cache", "error", err)
+	}
+}
+
+// saveHistoryCache records points in the store, the shared cache and, if set,
+// the local file.
+func (h *Handler) saveHistoryCache(ctx context.Context, points []storage.HistoricalDataPoint) {
+	data, err := json.Marshal(historyCacheState{Points: points})
+	if err != nil {
+		slog.Error("Failed to encode history cache", "error", err)
+		return
+	}
+
+	// The store is left alone while read-only; the cache and file are the server's own
+	if objects, ok := h.store.(storage.ObjectStore); ok && !h.ReadOnly() {
+		if err := objects.PutObject(ctx, historyCacheKey, data, "application/json"); err != nil {
+			slog.Error("Failed to record history cache", "key", historyCacheKey, "error", err)
+		}
+	}
+	if h.sharedCache != nil {
+		h.shareHistory(ctx, data)
+	}
+	if h.historyCacheFile != "" {
+		if err := storage.WriteFileAtomic(h.historyCacheFile, data); err != nil {
+			slog.Error("Failed to write history cache", "path", h.historyCacheFile, "error", err)
+		}
+	}
+}
+
+// warmHistoryCache refreshes the history cache in the background so the first
+// /history request does not wait for it.
+func (h *Handler) warmHistoryCache(ctx context.Context) {
+	store, ok := h.store.(storage.HistoricalDataStore)
+	if !ok {
+		return
+	}
+	go func() {
+		if _, err := h.historyPoints(ctx, store); err != nil {
+			slog.Warn("History cache warm-up failed", "error", err)
+		}
+	}()
+}
+
+// decodeHistoryCache parses a persisted history cache.
+func decodeHistoryCache(data []byte) ([]storage.HistoricalDataPoint, error) {
+	var state historyCacheState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.Points == nil {
+		state.Points = []storage.HistoricalDataPoint{}
+	}
+	sortHistory(state.Points)
+	return state.Points, nil
+}
+
+// historyPoint computes the network-wide totals of a snapshot.
+func historyPoint(snap storage.Snapshot) storage.HistoricalDataPoint {
+	dp := storage.HistoricalDataPoint{Timestamp: snap.Timestamp, StationCount: len(snap.Stations)}
+	for _, s := range snap.Stations {
+		dp.TotalBikes += s.NbBikes
+		dp.TotalEBikes += s.NbEBikes
+		dp.TotalEmptyDocks += s.NbEmptyDocks
+	}
+	return dp
+}
+
+// historyLatest returns the timestamp of the newest point, or zero.
+func historyLatest(points []storage.HistoricalDataPoint) time.Time {
+	if len(points) == 0 {
+		return time.Time{}
+	}
+	return points[0].Timestamp
+}
+
+// sortHistory orders points newest first, as /history serves them.
+func sortHistory(points []storage.HistoricalDataPoint) {
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Timestamp.After(points[j].Timestamp)
+	})
+}
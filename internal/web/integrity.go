@@ -0,0 +1,50 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+
+	"city-cycling/internal/storage"
+)
+
+// IntegrityFailureResponse describes a snapshot that failed verification.
+type IntegrityFailureResponse struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// IntegrityReportResponse is the JSON response for the integrity API.
+type IntegrityReportResponse struct {
+	Checked    int                        `json:"checked"`
+	Verified   int                        `json:"verified"`
+	Unverified int                        `json:"unverified"`
+	Failures   []IntegrityFailureResponse `json:"failures"`
+}
+
+// handleIntegrity audits every stored snapshot against its recorded checksum.
+func (h *Handler) handleIntegrity(w http.ResponseWriter, r *http.Request) {
+	verifier, ok := h.store.(storage.IntegrityVerifier)
+	if !ok {
+		httpError(w, r, "Integrity verification not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	report, err := verifier.VerifySnapshots(r.Context())
+	if err != nil {
+		slog.Error("Failed to verify snapshots", "error", err)
+		httpError(w, r, "Failed to verify snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	response := IntegrityReportResponse{
+		Checked:    report.Checked,
+		Verified:   report.Verified,
+		Unverified: report.Unverified,
+		Failures:   make([]IntegrityFailureResponse, len(report.Failures)),
+	}
+	for i, f := range report.Failures {
+		response.Failures[i] = IntegrityFailureResponse{Key: f.Key, Reason: f.Reason}
+	}
+
+	writeJSON(w, response)
+}
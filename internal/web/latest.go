@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"city-cycling/internal/collector"
+	"city-cycling/internal/tfl"
+)
+
+// RefreshLatest reloads the latest snapshot from storage into the in-memory cache.
+// It can be called on a timer or directly by a collector after a new snapshot is written.
+func (h *Handler) RefreshLatest(ctx context.Context) error {
+	if h.replay != nil {
+		return h.refreshReplay(ctx)
+	}
+	stations, timestamp, err := h.store.ReadLatestStations(ctx)
+	if err != nil {
+		return err
+	}
+	h.setLatest(stations, timestamp)
+	h.reloadAttributes(ctx)
+	return nil
+}
+
+// setLatest makes a snapshot the latest, updating everything derived from it.
+func (h *Handler) setLatest(stations []tfl.Station, timestamp time.Time) {
+	h.latestMu.Lock()
+	h.latestStations = stations
+	h.latestTimestamp = timestamp
+	h.latestMu.Unlock()
+
+	h.updateAnomalies(timestamp, stations)
+	if h.stationMetrics != nil {
+		h.stationMetrics.Set(timestamp, stations)
+	}
+
+	slog.Info("Latest snapshot cache updated", "timestamp", timestamp.Format(time.RFC3339), "stations", len(stations))
+}
+
+// SetStationMetrics reports every latest snapshot the handler loads to m.
+// Call it before StartLatestRefresh.
+func (h *Handler) SetStationMetrics(m *collector.StationMetrics) {
+	h.stationMetrics = m
+}
+
+// StartLatestRefresh refreshes the latest snapshot cache every interval until ctx is cancelled.
+// The first refresh happens immediately so the cache is warm before the first request;
+// the history cache is loaded and brought up to date in the background, and
+// snapshots next to those requested are prefetched until ctx is cancelled.
+func (h *Handler) StartLatestRefresh(ctx context.Context, interval time.Duration) {
+	h.loadAnomalies(ctx)
+	h.reloadAttributes(ctx)
+	h.loadHistoryCache(ctx)
+	h.warmHistoryCache(ctx)
+	h.startPrefetch(ctx)
+
+	if err := h.RefreshLatest(ctx); err != nil {
+		slog.Warn("Initial latest snapshot refresh failed", "error", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := h.RefreshLatest(ctx); err != nil {
+					slog.Error("Latest snapshot refresh failed", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// cachedLatest returns the cached latest snapshot, if one has been loaded.
+// When replaying, it first moves the cache on to the snapshot the replay clock
+// has reached.
+func (h *Handler) cachedLatest(ctx context.Context) ([]tfl.Station, time.Time, bool) {
+	if h.replay != nil {
+		if err := h.refreshReplay(ctx); err != nil {
+			slog.Error("Replay refresh failed", "error", err)
+		}
+	}
+
+	h.latestMu.RLock()
+	defer h.latestMu.RUnlock()
+
+	if h.latestStations == nil {
+		return nil, time.Time{}, false
+	}
+	return h.latestStations, h.latestTimestamp, true
+}
+
+// NotifySnapshot tells the handler a new snapshot has been written.
+// It reloads the latest snapshot and expires the aggregate history cache so the
+// next /api/history request adds the new data point.
+func (h *Handler) NotifySnapshot() {
+	h.historyCacheMu.Lock()
+	h.historyCacheTime = time.Time{}
+	h.historyCacheMu.Unlock()
+
+	if err := h.RefreshLatest(context.Background()); err != nil {
+		slog.Error("Latest snapshot refresh after write failed", "error", err)
+	}
+}
+
+// latestSnapshot returns the cached latest snapshot, loading it from storage on
+// a cold cache; the load is abandoned if ctx is cancelled.
+func (h *Handler) latestSnapshot(ctx context.Context) ([]tfl.Station, time.Time, error) {
+	if stations, timestamp, ok := h.cachedLatest(ctx); ok {
+		return stations, timestamp, nil
+	}
+	if err := h.RefreshLatest(ctx); err != nil {
+		return nil, time.Time{}, err
+	}
+	stations, timestamp, _ := h.cachedLatest(ctx)
+	return stations, timestamp, nil
+}
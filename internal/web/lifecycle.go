@@ -0,0 +1,208 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/registry"
+	"city-cycling/internal/storage"
+)
+
+// PeriodResponse is a span of time during which a station was in some state.
+type PeriodResponse struct {
+	Start string `json:"start"`
+	End   string `json:"end,omitempty"` // omitted while ongoing
+}
+
+// DockChangeResponse is a recorded change in a station's dock count.
+type DockChangeResponse struct {
+	Time      string `json:"time"`
+	PrevDocks int    `json:"prevDocks"`
+	Docks     int    `json:"docks"`
+}
+
+// LifecycleResponse is the JSON response for the station lifecycle API.
+type LifecycleResponse struct {
+	StationID        int                  `json:"stationId"`
+	Name             string               `json:"name"`
+	TerminalName     string               `json:"terminalName,omitempty"`
+	InstallDate      string               `json:"installDate,omitempty"`
+	RemovalDate      string               `json:"removalDate,omitempty"`
+	FirstSeen        string               `json:"firstSeen"`
+	LastSeen         string               `json:"lastSeen"`
+	InFeed           bool                 `json:"inFeed"`
+	Installed        bool                 `json:"installed"`
+	Docks            int                  `json:"docks"`
+	Elevation        *float64             `json:"elevation,omitempty"`
+	Attributes       map[string]string    `json:"attributes,omitempty"`
+	LockedPeriods    []PeriodResponse     `json:"lockedPeriods"`
+	TemporaryPeriods []PeriodResponse     `json:"temporaryPeriods"`
+	DockChanges      []DockChangeResponse `json:"dockChanges"`
+}
+
+// handleStationLifecycle serves a station's recorded history from the registry.
+func (h *Handler) handleStationLifecycle(w http.ResponseWriter, r *http.Request) {
+	stationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid station id", http.StatusBadRequest)
+		return
+	}
+
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok {
+		httpError(w, r, "Station lifecycle not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	reg, err := registry.Load(r.Context(), objects)
+	if err != nil {
+		slog.Error("Failed to load station registry", "error", err)
+		httpError(w, r, "Failed to load station registry", http.StatusInternalServerError)
+		return
+	}
+
+	st, ok := reg.Station(stationID)
+	if !ok {
+		httpError(w, r, "Station not found in registry", http.StatusNotFound)
+		return
+	}
+
+	response := LifecycleResponse{
+		StationID:        st.ID,
+		Name:             st.Name,
+		TerminalName:     st.TerminalName,
+		InstallDate:      formatOptional(st.InstallDate),
+		RemovalDate:      formatOptional(st.RemovalDate),
+		FirstSeen:        st.FirstSeen.Format("2006-01-02T15:04:05Z"),
+		LastSeen:         st.LastSeen.Format("2006-01-02T15:04:05Z"),
+		InFeed:           !st.LastSeen.Before(reg.LastSeen()),
+		Installed:        st.Installed,
+		Docks:            st.Docks,
+		Elevation:        st.Elevation,
+		Attributes:       h.stationAttributes(st.ID),
+		LockedPeriods:    toPeriodResponses(st.LockedPeriods),
+		TemporaryPeriods: toPeriodResponses(st.TemporaryPeriods),
+		DockChanges:      []DockChangeResponse{},
+	}
+	for _, c := range st.Changes {
+		if c.Kind == registry.ChangeDocksChanged {
+			response.DockChanges = append(response.DockChanges, DockChangeResponse{
+				Time:      c.Time.Format("2006-01-02T15:04:05Z"),
+				PrevDocks: c.PrevDocks,
+				Docks:     c.Docks,
+			})
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// toPeriodResponses converts registry periods to their JSON representation.
+func toPeriodResponses(periods []registry.Period) []PeriodResponse {
+	result := make([]PeriodResponse, len(periods))
+	for i, p := range periods {
+		result[i] = PeriodResponse{Start: p.Start.Format("2006-01-02T15:04:05Z"), End: formatOptional(p.End)}
+	}
+	return result
+}
+
+// formatOptional formats t, or returns "" for the zero time.
+func formatOptional(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05Z")
+}
+
+// defaultCapacityWindow is the range reported when a capacity changes request has no from parameter.
+const defaultCapacityWindow = 90 * 24 * time.Hour
+
+// CapacityChangeResponse is a change in a station's capacity.
+type CapacityChangeResponse struct {
+	StationID    int    `json:"stationId"`
+	Name         string `json:"name"`
+	TerminalName string `json:"terminalName,omitempty"`
+	// Kind is expansion, shrinkage, closure (flagged locked) or removal (gone from the feed).
+	Kind      string `json:"kind"`
+	Time      string `json:"time"`
+	End       string `json:"end,omitempty"` // closures only, omitted while ongoing
+	PrevDocks int    `json:"prevDocks"`
+	Docks     int    `json:"docks"`
+	Delta     int    `json:"delta"`
+}
+
+// CapacityChangesResponse is the JSON response for the capacity changes API.
+type CapacityChangesResponse struct {
+	From    string                   `json:"from"`
+	To      string                   `json:"to"`
+	Counts  map[string]int           `json:"counts"`
+	Changes []CapacityChangeResponse `json:"changes"`
+}
+
+// handleCapacityChanges serves the dock count changes, closures and removals
+// recorded in the registry.
+func (h *Handler) handleCapacityChanges(w http.ResponseWriter, r *http.Request) {
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok {
+		httpError(w, r, "Station registry not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultCapacityWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kinds := make(map[registry.CapacityChangeKind]bool)
+	for _, k := range strings.Split(r.URL.Query().Get("kind"), ",") {
+		switch kind := registry.CapacityChangeKind(strings.TrimSpace(k)); kind {
+		case "":
+		case registry.CapacityExpanded, registry.CapacityShrunk, registry.CapacityClosed, registry.CapacityRemoved:
+			kinds[kind] = true
+		default:
+			httpError(w, r, errInvalidParam("kind").Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	reg, err := registry.Load(r.Context(), objects)
+	if err != nil {
+		slog.Error("Failed to load station registry", "error", err)
+		httpError(w, r, "Failed to load station registry", http.StatusInternalServerError)
+		return
+	}
+
+	response := CapacityChangesResponse{
+		From:    from.UTC().Format("2006-01-02T15:04:05Z"),
+		To:      to.UTC().Format("2006-01-02T15:04:05Z"),
+		Counts:  make(map[string]int),
+		Changes: []CapacityChangeResponse{},
+	}
+	for _, c := range reg.CapacityChanges(from, to) {
+		if (stationID != 0 && c.StationID != stationID) || (len(kinds) > 0 && !kinds[c.Kind]) {
+			continue
+		}
+		response.Counts[string(c.Kind)]++
+		response.Changes = append(response.Changes, CapacityChangeResponse{
+			StationID:    c.StationID,
+			Name:         c.Name,
+			TerminalName: c.TerminalName,
+			Kind:         string(c.Kind),
+			Time:         c.Time.Format("2006-01-02T15:04:05Z"),
+			End:          formatOptional(c.End),
+			PrevDocks:    c.PrevDocks,
+			Docks:        c.Docks,
+			Delta:        c.Docks - c.PrevDocks,
+		})
+	}
+
+	writeJSON(w, response)
+}
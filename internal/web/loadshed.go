@@ -0,0 +1,217 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// loadClass groups routes whose requests are expensive in the same way and
+// share one concurrency limit.
+type loadClass string
+
+const (
+	// loadUnlimited routes are cheap enough to serve without a limit.
+	loadUnlimited loadClass = ""
+	// loadHistory routes aggregate or encode the whole history.
+	loadHistory loadClass = "history"
+	// loadAnalytics routes scan ranges of snapshots.
+	loadAnalytics loadClass = "analytics"
+	// loadExport routes stream ranges of snapshots.
+	loadExport loadClass = "export"
+)
+
+// loadClasses lists the limited classes, in the order they are reported.
+var loadClasses = []loadClass{loadHistory, loadAnalytics, loadExport}
+
+// ConcurrencyLimits bounds how many requests of each expensive route class
+// run at once, so a burst cannot exhaust memory or the store's rate limits.
+// A request over its class's limit waits for a slot in a short queue; when
+// the queue is full, or the wait exceeds QueueTimeout, it is shed with 503
+// Service Unavailable and Retry-After. A limit of 0 leaves its class unlimited.
+type ConcurrencyLimits struct {
+	History   int // /history and /history/range
+	Analytics int // /analytics/*, /query, station stats, rebalancing and forecasts, /health/*
+	Export    int // /export
+	// Queue is how many requests of each class may wait for a slot.
+	Queue        int
+	QueueTimeout time.Duration
+}
+
+// DefaultConcurrencyLimits are the limits a handler starts with.
+var DefaultConcurrencyLimits = ConcurrencyLimits{
+	History:      4,
+	Analytics:    2,
+	Export:       2,
+	Queue:        16,
+	QueueTimeout: time.Second,
+}
+
+// SetConcurrencyLimits replaces the limits of every route class. Call before
+// ForCity, whose handlers share the limits, and before serving requests.
+func (h *Handler) SetConcurrencyLimits(limits ConcurrencyLimits) {
+	h.loadLimiter = newLoadLimiter(limits)
+}
+
+// loadLimiter holds the concurrency limit of every limited class.
+type loadLimiter struct {
+	classes map[loadClass]*classLimiter
+}
+
+// newLoadLimiter creates the limiters for limits.
+func newLoadLimiter(limits ConcurrencyLimits) *loadLimiter {
+	l := &loadLimiter{classes: make(map[loadClass]*classLimiter)}
+	for class, limit := range map[loadClass]int{loadHistory: limits.History, loadAnalytics: limits.Analytics, loadExport: limits.Export} {
+		if limit > 0 {
+			l.classes[class] = &classLimiter{
+				slots:   make(chan struct{}, limit),
+				queue:   max(limits.Queue, 0),
+				timeout: limits.QueueTimeout,
+			}
+		}
+	}
+	return l
+}
+
+// class returns the limiter of class, or nil if it is unlimited.
+func (l *loadLimiter) class(class loadClass) *classLimiter {
+	if l == nil {
+		return nil
+	}
+	return l.classes[class]
+}
+
+// classLimiter is a counting semaphore with a bounded queue.
+type classLimiter struct {
+	slots   chan struct{}
+	queue   int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	waiting int
+	shed    int
+	// avg is a moving average of how long requests hold a slot.
+	avg time.Duration
+}
+
+// acquire takes a slot, waiting in the queue when all are taken. It returns
+// false, and counts the request as shed, if no slot frees up in time or the
+// queue is full.
+func (c *classLimiter) acquire(ctx context.Context) bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	c.mu.Lock()
+	if c.waiting >= c.queue || c.timeout <= 0 {
+		c.shed++
+		c.mu.Unlock()
+		return false
+	}
+	c.waiting++
+	c.mu.Unlock()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	var acquired bool
+	select {
+	case c.slots <- struct{}{}:
+		acquired = true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	c.waiting--
+	if !acquired {
+		c.shed++
+	}
+	c.mu.Unlock()
+	return acquired
+}
+
+// release frees a slot held for held.
+func (c *classLimiter) release(held time.Duration) {
+	<-c.slots
+	c.mu.Lock()
+	c.avg += (held - c.avg) / 8
+	c.mu.Unlock()
+}
+
+// retryAfter estimates how long until a slot frees up: the average time a
+// request holds one.
+func (c *classLimiter) retryAfter() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.avg
+}
+
+// stats returns the requests running, waiting and shed so far.
+func (c *classLimiter) stats() (running, waiting, shed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.slots), c.waiting, c.shed
+}
+
+// withLoadLimit runs next within the concurrency limit of class, shedding the
+// request with 503 and Retry-After when the class is saturated.
+func (h *Handler) withLoadLimit(class loadClass, next http.HandlerFunc) http.HandlerFunc {
+	if class == loadUnlimited {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := h.loadLimiter.class(class)
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+		if !limiter.acquire(r.Context()) {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(limiter.retryAfter())))
+			httpError(w, r, "Server busy, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		start := time.Now()
+		defer func() { limiter.release(time.Since(start)) }()
+		next(w, r)
+	}
+}
+
+// registerLoadMetrics registers the load shedding metrics of h's limits,
+// which its ForCity handlers share.
+func registerLoadMetrics(reg prometheus.Registerer, h *Handler) {
+	stat := func(class loadClass, f func(running, waiting, shed int) int) func() float64 {
+		return func() float64 {
+			limiter := h.loadLimiter.class(class)
+			if limiter == nil {
+				return 0
+			}
+			return float64(f(limiter.stats()))
+		}
+	}
+	for _, class := range loadClasses {
+		labels := prometheus.Labels{"class": string(class)}
+		reg.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "server_load_running",
+				Help:        "Requests of an expensive route class running.",
+				ConstLabels: labels,
+			}, stat(class, func(running, _, _ int) int { return running })),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "server_load_waiting",
+				Help:        "Requests of an expensive route class waiting for a slot.",
+				ConstLabels: labels,
+			}, stat(class, func(_, waiting, _ int) int { return waiting })),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name:        "server_load_shed_total",
+				Help:        "Requests of an expensive route class rejected with 503 because it was saturated.",
+				ConstLabels: labels,
+			}, stat(class, func(_, _, shed int) int { return shed })),
+		)
+	}
+}
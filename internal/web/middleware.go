@@ -0,0 +1,153 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+)
+
+// Request timeouts. A route's Timeout overrides defaultRouteTimeout.
+const (
+	defaultRouteTimeout = 30 * time.Second
+	// shortRouteTimeout suits routes served from memory, such as the latest
+	// snapshot, where a slow response means something is stuck.
+	shortRouteTimeout = 5 * time.Second
+	// longRouteTimeout suits routes that scan ranges of historical snapshots.
+	longRouteTimeout = 5 * time.Minute
+	// streamRouteTimeout bounds streaming routes, which may send a month of
+	// snapshots to a slow client.
+	streamRouteTimeout = time.Hour
+)
+
+// requestIDHeader carries the request ID in both directions; callers such as
+// a reverse proxy may set it to tie our logs to theirs.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern restricts incoming request IDs to what is safe to log and
+// echo back.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// newRequestID returns a random ID identifying one request in the logs.
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// requestID returns the ID assigned to the request by withRequestID, or "" if
+// it has none.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID gives every request an ID, keeping a valid X-Request-ID sent
+// by the client and generating one otherwise, and returns it in the response
+// header.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// httpError replies like http.Error, quoting the request ID so that a user's
+// report can be matched to the log line.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if id := requestID(r.Context()); id != "" {
+		msg += " (request " + id + ")"
+	}
+	http.Error(w, msg, code)
+}
+
+// withRecovery turns a panicking handler into a 500 response, logging the
+// panic and stack so one bad request cannot bring down the server.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// ErrAbortHandler is how handlers deliberately abort a response
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			slog.Error("Panic serving request",
+				"requestId", requestID(r.Context()), "method", r.Method, "path", r.URL.Path,
+				"panic", v, "stack", string(debug.Stack()))
+			if !rw.wroteHeader {
+				httpError(rw, r, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoveryResponseWriter records whether the response has been started, after
+// which a panic can no longer be answered with a 500.
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryResponseWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoveryResponseWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *recoveryResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// withTimeout answers 503 if next has not finished within timeout, and cancels
+// the request context so storage reads in progress are abandoned. The response
+// is buffered until next returns.
+func withTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		timeout = defaultRouteTimeout
+	}
+	return http.TimeoutHandler(next, timeout, "Request timed out").ServeHTTP
+}
+
+// withStreamTimeout cancels the request context after timeout without
+// buffering the response, for routes that stream large bodies. It also lifts
+// the server's write timeout, which would otherwise cut the stream off, to the
+// same deadline.
+func withStreamTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		timeout = streamRouteTimeout
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Now().Add(timeout)
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.Warn("Failed to extend write deadline", "error", err)
+		}
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,187 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// adminModePath is the admin route switching read-only and maintenance mode.
+	adminModePath = adminRoot + "/mode"
+	// maintenanceRetryAfter is the Retry-After sent with maintenance responses.
+	maintenanceRetryAfter = 5 * time.Minute
+)
+
+// defaultMaintenanceMessage is shown when maintenance mode is enabled without
+// a message.
+const defaultMaintenanceMessage = "The service is down for maintenance and will be back shortly."
+
+// ModeResponse is the JSON response for the admin mode API, and the body of
+// its PATCH requests, in which every field is optional.
+type ModeResponse struct {
+	// ReadOnly refuses admin changes and stops the server writing to the store.
+	ReadOnly bool `json:"readOnly"`
+	// Maintenance answers every request but the admin API with 503.
+	Maintenance bool   `json:"maintenance"`
+	Message     string `json:"message,omitempty"`
+	// ChangedAt and ChangedBy record the last change through the admin API.
+	ChangedAt string `json:"changedAt,omitempty"`
+	ChangedBy string `json:"changedBy,omitempty"`
+}
+
+// MaintenanceResponse is the JSON error API requests get in maintenance mode.
+type MaintenanceResponse struct {
+	Error       string `json:"error"`
+	Maintenance bool   `json:"maintenance"`
+}
+
+// modeRequest is a PATCH of the server mode; nil fields are left unchanged.
+type modeRequest struct {
+	ReadOnly    *bool   `json:"readOnly"`
+	Maintenance *bool   `json:"maintenance"`
+	Message     *string `json:"message"`
+}
+
+// serverMode holds the read-only and maintenance switches, shared by every
+// city of a site. It is safe for concurrent use.
+type serverMode struct {
+	mu          sync.RWMutex
+	readOnly    bool
+	maintenance bool
+	message     string
+	changedAt   time.Time
+	changedBy   string
+}
+
+// SetReadOnly switches read-only mode, in which admin changes are refused and
+// the server writes nothing to the store: no collected snapshots, anomaly
+// state or history cache. Use it while migrating storage.
+func (h *Handler) SetReadOnly(on bool) {
+	h.mode.mu.Lock()
+	defer h.mode.mu.Unlock()
+	h.mode.readOnly = on
+}
+
+// SetMaintenance switches maintenance mode, in which every request but the
+// admin API gets a 503: a maintenance page showing message for pages, a JSON
+// error for the API. An empty message shows a default one.
+func (h *Handler) SetMaintenance(on bool, message string) {
+	h.mode.mu.Lock()
+	defer h.mode.mu.Unlock()
+	h.mode.maintenance = on
+	h.mode.message = message
+}
+
+// ReadOnly reports whether the server is in read-only mode, so that a
+// collector running in the same process can hold off writing.
+func (h *Handler) ReadOnly() bool {
+	h.mode.mu.RLock()
+	defer h.mode.mu.RUnlock()
+	return h.mode.readOnly
+}
+
+// maintenance reports whether maintenance mode is on, and its message.
+func (h *Handler) maintenance() (bool, string) {
+	h.mode.mu.RLock()
+	defer h.mode.mu.RUnlock()
+	message := h.mode.message
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	return h.mode.maintenance, message
+}
+
+// modeResponse returns the current mode for the admin API.
+func (h *Handler) modeResponse() ModeResponse {
+	h.mode.mu.RLock()
+	defer h.mode.mu.RUnlock()
+	response := ModeResponse{
+		ReadOnly:    h.mode.readOnly,
+		Maintenance: h.mode.maintenance,
+		Message:     h.mode.message,
+		ChangedBy:   h.mode.changedBy,
+	}
+	if !h.mode.changedAt.IsZero() {
+		response.ChangedAt = h.mode.changedAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+// handleAdminGetMode reports the read-only and maintenance switches.
+func (h *Handler) handleAdminGetMode(w http.ResponseWriter, r *http.Request, admin string) {
+	writeJSON(w, h.modeResponse())
+}
+
+// handleAdminSetMode changes the read-only and maintenance switches given in
+// the request body, and reports the resulting mode. Changes last until the
+// process restarts, when the -read-only and -maintenance flags apply again.
+func (h *Handler) handleAdminSetMode(w http.ResponseWriter, r *http.Request, admin string) {
+	var req modeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		httpError(w, r, "Invalid mode: expected JSON with readOnly, maintenance or message", http.StatusBadRequest)
+		return
+	}
+
+	h.mode.mu.Lock()
+	if req.ReadOnly != nil {
+		h.mode.readOnly = *req.ReadOnly
+	}
+	if req.Maintenance != nil {
+		h.mode.maintenance = *req.Maintenance
+	}
+	if req.Message != nil {
+		h.mode.message = *req.Message
+	}
+	h.mode.changedAt = time.Now()
+	h.mode.changedBy = admin
+	readOnly, maintenance := h.mode.readOnly, h.mode.maintenance
+	h.mode.mu.Unlock()
+
+	slog.Info("Server mode changed", "admin", admin, "readOnly", readOnly, "maintenance", maintenance, "remote", r.RemoteAddr)
+	writeJSON(w, h.modeResponse())
+}
+
+// refuseReadOnly writes a 503 for an admin change while the server is
+// read-only. It returns true when the request has been answered.
+func (h *Handler) refuseReadOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || !h.ReadOnly() {
+		return false
+	}
+	httpError(w, r, "Server is read-only", http.StatusServiceUnavailable)
+	return true
+}
+
+// serveMaintenance answers a request with 503 while the server is in
+// maintenance mode: a JSON error under /api/ and the maintenance page
+// elsewhere. The admin API, and the assets the page uses, are still served.
+// It returns true when the request has been answered.
+func (h *Handler) serveMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	on, message := h.maintenance()
+	if !on || strings.HasPrefix(r.URL.Path, adminRoot+"/") || strings.HasPrefix(r.URL.Path, staticPrefix) {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+	if strings.HasPrefix(r.URL.Path, apiRoot+"/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(MaintenanceResponse{Error: message, Maintenance: true}); err != nil {
+			slog.Debug("Failed to write maintenance response", "error", err)
+		}
+		return true
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	page := struct{ Title, Message string }{Title: h.city.Name, Message: message}
+	if err := h.templates.ExecuteTemplate(w, "maintenance.html", page); err != nil {
+		slog.Error("Template error", "error", err)
+	}
+	return true
+}
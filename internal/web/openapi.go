@@ -0,0 +1,254 @@
+package web
+
+import (
+	"maps"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// apiKeySecurityScheme is the name of the API key scheme in the OpenAPI document.
+const apiKeySecurityScheme = "apiKey"
+
+// handleDocs serves a Swagger UI page for the OpenAPI document.
+func (h *Handler) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "docs.html", nil); err != nil {
+		httpError(w, r, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// withServerURL returns a copy of an OpenAPI document served at url, for a
+// tenant's routes under its path prefix.
+func withServerURL(doc map[string]any, url string) map[string]any {
+	doc = maps.Clone(doc)
+	doc["servers"] = []any{map[string]any{"url": url}}
+	return doc
+}
+
+// buildOpenAPI generates an OpenAPI 3 document for an API version mounted at prefix.
+// Response schemas are derived from the Go response types by reflection.
+func buildOpenAPI(v apiVersion, prefix string) map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]any)
+
+	for _, rt := range v.Routes {
+		op := map[string]any{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt),
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						"application/json": map[string]any{
+							"schema": schemaFor(reflect.TypeOf(rt.Response), schemas),
+						},
+					},
+				},
+				"400": plainResponse("Invalid parameter"),
+				"429": plainResponse("Rate limit exceeded"),
+			},
+		}
+		if len(rt.MediaTypes) > 0 {
+			content := make(map[string]any)
+			for i, mt := range rt.MediaTypes {
+				schema := map[string]any{"type": "string"}
+				if i == 0 {
+					schema = schemaFor(reflect.TypeOf(rt.Response), schemas)
+				}
+				content[mt] = map[string]any{"schema": schema}
+			}
+			op["responses"].(map[string]any)["200"].(map[string]any)["content"] = content
+		}
+		if rt.Stream {
+			partial := map[string]any{"description": "The byte range requested"}
+			if content, ok := op["responses"].(map[string]any)["200"].(map[string]any)["content"]; ok {
+				partial["content"] = content
+			}
+			op["responses"].(map[string]any)["206"] = partial
+			op["responses"].(map[string]any)["416"] = plainResponse("Range not satisfiable")
+		}
+		if rt.Load != loadUnlimited {
+			op["responses"].(map[string]any)["503"] = plainResponse("Server busy, retry after the Retry-After delay")
+		}
+		if rt.Description != "" {
+			op["description"] = rt.Description
+		}
+		if len(rt.Tags) > 0 {
+			op["tags"] = rt.Tags
+		}
+		if len(rt.Params) > 0 {
+			params := make([]any, len(rt.Params))
+			for i, p := range rt.Params {
+				params[i] = paramSpec(p)
+			}
+			op["parameters"] = params
+		}
+		if !strings.HasPrefix(prefix, v.prefix()) {
+			op["deprecated"] = true
+		}
+		if rt.Access == accessProtected {
+			op["security"] = []any{map[string]any{apiKeySecurityScheme: []string{}}}
+			op["responses"].(map[string]any)["401"] = plainResponse("Missing or invalid API key")
+		}
+
+		item, _ := paths[rt.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "City Cycling API",
+			"version":     v.Name,
+			"description": "Santander Cycles station availability, history and analytics.",
+		},
+		"servers": []any{map[string]any{"url": prefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				apiKeySecurityScheme: map[string]any{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-API-Key",
+					"description": "Only required when the server has API keys enabled",
+				},
+			},
+		},
+	}
+}
+
+// operationID derives a stable operation ID from the route path,
+// e.g. GET /stations/{id}/stats becomes getStationsIdStats.
+func operationID(rt route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.Method))
+	for _, part := range strings.Split(rt.Path, "/") {
+		part = strings.Trim(part, "{}")
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// plainResponse describes a plain-text error response.
+func plainResponse(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"text/plain": map[string]any{"schema": map[string]any{"type": "string"}},
+		},
+	}
+}
+
+// paramSpec converts a route parameter to its OpenAPI representation.
+func paramSpec(p param) map[string]any {
+	schema := map[string]any{"type": p.Type}
+	if p.Format != "" {
+		schema["format"] = p.Format
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Default != nil {
+		schema["default"] = p.Default
+	}
+
+	spec := map[string]any{
+		"name":   p.Name,
+		"in":     p.In,
+		"schema": schema,
+	}
+	if p.Required || p.In == "path" {
+		spec["required"] = true
+	}
+	if p.Description != "" {
+		spec["description"] = p.Description
+	}
+	return spec
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the JSON schema for t. Named struct types are added to
+// schemas and referenced so shared types appear once in the document.
+func schemaFor(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == nil {
+		// A route without a Response answers with a binary body
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema := map[string]any{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+		if t.Kind() == reflect.Array {
+			schema["minItems"] = t.Len()
+			schema["maxItems"] = t.Len()
+		}
+		return schema
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case t.Kind() == reflect.Struct:
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		// Reserve the name first so recursive types terminate
+		schemas[t.Name()] = map[string]any{}
+		schemas[t.Name()] = structSchema(t, schemas)
+		return ref
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema describes the JSON encoding of a struct type.
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = schemaFor(f.Type, schemas)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errInvalidParam returns the error reported for a malformed query parameter.
+func errInvalidParam(name string) error {
+	return fmt.Errorf("Invalid %s parameter", name)
+}
+
+// parseTimeRange reads the optional from/to RFC 3339 query parameters.
+// to defaults to now and from defaults to defaultWindow before to.
+func parseTimeRange(r *http.Request, defaultWindow time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errInvalidParam("to")
+		}
+		to = t.UTC()
+	}
+
+	from := to.Add(-defaultWindow)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errInvalidParam("from")
+		}
+		from = t.UTC()
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseLocation reads the optional tz query parameter, an IANA time zone name
+// such as Europe/London, defaulting to the handler's time zone.
+func (h *Handler) parseLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return h.location, nil
+	}
+	// "Local" would expose the server's own zone setting
+	if name == "Local" {
+		return nil, errInvalidParam("tz")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errInvalidParam("tz")
+	}
+	return loc, nil
+}
+
+// formatTime formats t as RFC 3339 in loc, including its UTC offset.
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// parseTop reads the optional top query parameter.
+func parseTop(r *http.Request) (int, error) {
+	top, err := parseIntParam(r, "top", defaultAnalyticsTop)
+	if err == nil && top < 1 {
+		return 0, errInvalidParam("top")
+	}
+	return top, err
+}
+
+// parseIntParam reads an optional non-negative integer query parameter.
+func parseIntParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errInvalidParam(name)
+	}
+	return n, nil
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("JSON encoding error", "error", err)
+	}
+}
@@ -0,0 +1,267 @@
+package web
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/geo"
+	"city-cycling/internal/tfl"
+)
+
+const (
+	// walkingSpeed is the straight-line walking speed, 5 km/h. Rides are
+	// timed by the journey time matrix.
+	walkingSpeed = 1.4 // m/s
+
+	// defaultPlanWalk is the furthest a rider is assumed to walk to or from a
+	// station when a plan request has no walk parameter, in metres.
+	defaultPlanWalk = 800
+	// maxPlanWalk bounds the walk parameter.
+	maxPlanWalk = 5000
+	// planCandidates is how many of the nearest stations at either end are considered.
+	planCandidates = 5
+	// planTrainingWindow is the history availability predictions are trained
+	// on: the last week, which the query API keeps in memory.
+	planTrainingWindow = analytics.DefaultColumnarWindow
+
+	// A station predicted to have fewer than planComfort bikes (or docks) on
+	// arrival costs up to planShortagePenalty extra, the time lost finding
+	// another, in proportion to the shortfall.
+	planComfort         = 3
+	planShortagePenalty = 10 * time.Minute
+)
+
+// PlanStationResponse is a recommended pickup or drop-off station.
+type PlanStationResponse struct {
+	StationID int     `json:"stationId"`
+	Name      string  `json:"name"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	// WalkMeters and WalkMinutes are the straight-line walk between the
+	// station and the origin or destination.
+	WalkMeters  int     `json:"walkMeters"`
+	WalkMinutes float64 `json:"walkMinutes"`
+	// ArrivalTime is when the rider reaches the station.
+	ArrivalTime         string  `json:"arrivalTime"`
+	Bikes               int     `json:"bikes"`
+	EmptyDocks          int     `json:"emptyDocks"`
+	PredictedBikes      float64 `json:"predictedBikes"`
+	PredictedEmptyDocks float64 `json:"predictedEmptyDocks"`
+}
+
+// PlanResponse is the JSON response for the trip planning API.
+type PlanResponse struct {
+	// Departure is the latest snapshot's time, from which trip times count.
+	Departure string `json:"departure"`
+	// Pickup and Dropoff are ranked best first; drop-offs are ranked for the
+	// best pickup.
+	Pickup       []PlanStationResponse `json:"pickup"`
+	Dropoff      []PlanStationResponse `json:"dropoff"`
+	RideMinutes  float64               `json:"rideMinutes"`
+	TotalMinutes float64               `json:"totalMinutes"`
+	// ArrivalTime is when the rider reaches the destination.
+	ArrivalTime string `json:"arrivalTime"`
+}
+
+// planCandidate is a station near one end of a trip being ranked.
+type planCandidate struct {
+	station tfl.Station
+	meters  float64
+	arrival time.Time
+	predict analytics.ForecastPoint
+	// cost is the time the station adds to the trip, including any shortage penalty.
+	cost time.Duration
+}
+
+// handlePlan recommends a pickup station near from and a drop-off station near
+// to, trading walking and riding time against the availability predicted for
+// when the rider gets there.
+func (h *Handler) handlePlan(w http.ResponseWriter, r *http.Request) {
+	fromLat, fromLng, err := parseLatLng(r, "from")
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	toLat, toLng, err := parseLatLng(r, "to")
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	walk, err := parseIntParam(r, "walk", defaultPlanWalk)
+	if err != nil || walk < 1 || walk > maxPlanWalk {
+		httpError(w, r, fmt.Sprintf("Invalid walk parameter (1 to %d metres)", maxPlanWalk), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.columnar == nil {
+		httpError(w, r, "Trip planning not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	stations, departure, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+	pickups := nearbyStations(stations, fromLat, fromLng, float64(walk))
+	if len(pickups) == 0 {
+		httpError(w, r, "No station within walking distance of from", http.StatusNotFound)
+		return
+	}
+	dropoffs := nearbyStations(stations, toLat, toLng, float64(walk))
+	if len(dropoffs) == 0 {
+		httpError(w, r, "No station within walking distance of to", http.StatusNotFound)
+		return
+	}
+
+	ids := make([]int, 0, len(pickups)+len(dropoffs))
+	for _, c := range slices.Concat(pickups, dropoffs) {
+		ids = append(ids, c.station.ID)
+	}
+	series, err := h.columnar.StationSeries(r.Context(), ids, departure.Add(-planTrainingWindow), departure)
+	if err != nil {
+		slog.Error("Failed to build station series", "error", err)
+		httpError(w, r, "Failed to compute plan", http.StatusInternalServerError)
+		return
+	}
+	models := make(map[int]*analytics.SeasonalModel, len(series))
+	for id, samples := range series {
+		models[id] = analytics.TrainSeasonalModel(samples, loc)
+	}
+
+	for i := range pickups {
+		c := &pickups[i]
+		walkTime := travelTime(c.meters, walkingSpeed)
+		c.arrival = departure.Add(walkTime)
+		c.predict = predictAt(models[c.station.ID], c.station, c.arrival)
+		c.cost = walkTime + shortagePenalty(c.predict.Bikes)
+	}
+	slices.SortStableFunc(pickups, func(a, b planCandidate) int { return cmp.Compare(a.cost, b.cost) })
+	best := pickups[0]
+
+	matrix := h.journeyTimes(stations)
+	rideTimes := make(map[int]time.Duration, len(dropoffs))
+	for i := range dropoffs {
+		c := &dropoffs[i]
+		ride, _ := matrix.Time(best.station.ID, c.station.ID)
+		rideTimes[c.station.ID] = ride
+		c.arrival = best.arrival.Add(ride)
+		c.predict = predictAt(models[c.station.ID], c.station, c.arrival)
+		c.cost = ride + travelTime(c.meters, walkingSpeed) + shortagePenalty(c.predict.EmptyDocks)
+	}
+	slices.SortStableFunc(dropoffs, func(a, b planCandidate) int { return cmp.Compare(a.cost, b.cost) })
+	end := dropoffs[0]
+	arrival := end.arrival.Add(travelTime(end.meters, walkingSpeed))
+
+	response := PlanResponse{
+		Departure:    formatTime(departure, loc),
+		Pickup:       make([]PlanStationResponse, len(pickups)),
+		Dropoff:      make([]PlanStationResponse, len(dropoffs)),
+		RideMinutes:  minutes(rideTimes[end.station.ID]),
+		TotalMinutes: minutes(arrival.Sub(departure)),
+		ArrivalTime:  formatTime(arrival, loc),
+	}
+	for i, c := range pickups {
+		response.Pickup[i] = planStationResponse(c, loc)
+	}
+	for i, c := range dropoffs {
+		response.Dropoff[i] = planStationResponse(c, loc)
+	}
+	writeJSON(w, response)
+}
+
+// nearbyStations returns the planCandidates nearest stations within meters
+// of lat/lng that have docks, nearest first.
+func nearbyStations(stations []tfl.Station, lat, lng, meters float64) []planCandidate {
+	var nearby []planCandidate
+	for _, s := range stations {
+		// Snapshots do not record whether a station is locked; one without
+		// docks is out of service
+		if s.NbDocks == 0 {
+			continue
+		}
+		if d := geo.DistanceMeters(lat, lng, s.Lat, s.Long); d <= meters {
+			nearby = append(nearby, planCandidate{station: s, meters: d})
+		}
+	}
+	slices.SortFunc(nearby, func(a, b planCandidate) int {
+		return cmp.Or(cmp.Compare(a.meters, b.meters), cmp.Compare(a.station.ID, b.station.ID))
+	})
+	return nearby[:min(len(nearby), planCandidates)]
+}
+
+// predictAt predicts a station's availability at t, falling back to its
+// current reading when it has no history.
+func predictAt(model *analytics.SeasonalModel, s tfl.Station, t time.Time) analytics.ForecastPoint {
+	if model == nil {
+		return analytics.ForecastPoint{Timestamp: t, Bikes: float64(s.NbBikes), EmptyDocks: float64(s.NbEmptyDocks)}
+	}
+	return model.At(t)
+}
+
+// shortagePenalty returns the time a station predicted to have available bikes
+// or docks is expected to cost in searching for another.
+func shortagePenalty(available float64) time.Duration {
+	if available >= planComfort {
+		return 0
+	}
+	return time.Duration(float64(planShortagePenalty) * (1 - max(available, 0)/planComfort))
+}
+
+// travelTime returns how long covering meters takes at speed.
+func travelTime(meters, speed float64) time.Duration {
+	return time.Duration(meters / speed * float64(time.Second))
+}
+
+// minutes returns d in minutes, rounded to one decimal place.
+func minutes(d time.Duration) float64 {
+	return math.Round(d.Minutes()*10) / 10
+}
+
+// planStationResponse converts a ranked candidate to its JSON form.
+func planStationResponse(c planCandidate, loc *time.Location) PlanStationResponse {
+	return PlanStationResponse{
+		StationID:           c.station.ID,
+		Name:                c.station.Name,
+		Lat:                 c.station.Lat,
+		Lng:                 c.station.Long,
+		WalkMeters:          int(math.Round(c.meters)),
+		WalkMinutes:         minutes(travelTime(c.meters, walkingSpeed)),
+		ArrivalTime:         formatTime(c.arrival, loc),
+		Bikes:               c.station.NbBikes,
+		EmptyDocks:          c.station.NbEmptyDocks,
+		PredictedBikes:      math.Round(c.predict.Bikes*10) / 10,
+		PredictedEmptyDocks: math.Round(c.predict.EmptyDocks*10) / 10,
+	}
+}
+
+// parseLatLng reads a required query parameter given as lat,lng in degrees.
+func parseLatLng(r *http.Request, name string) (lat, lng float64, err error) {
+	invalid := fmt.Errorf("Invalid %s parameter (use lat,lng)", name)
+	latStr, lngStr, ok := strings.Cut(r.URL.Query().Get(name), ",")
+	if !ok {
+		return 0, 0, invalid
+	}
+	lat, err = strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, invalid
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, invalid
+	}
+	return lat, lng, nil
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"city-cycling/internal/analytics"
+)
+
+const (
+	// defaultPlaybackStep is the frame spacing when a range request has no step parameter.
+	defaultPlaybackStep = 5 * time.Minute
+	// maxPlaybackRange bounds how much history a single range request may cover.
+	maxPlaybackRange = 7 * 24 * time.Hour
+)
+
+// StationDeltaResponse carries the counts of a station that changed between frames.
+type StationDeltaResponse struct {
+	ID              int `json:"id"`
+	NbBikes         int `json:"nbBikes"`
+	NbStandardBikes int `json:"nbStandardBikes"`
+	NbEBikes        int `json:"nbEBikes"`
+	NbEmptyDocks    int `json:"nbEmptyDocks"`
+	NbDocks         int `json:"nbDocks"`
+}
+
+// DeltaFrameResponse lists the stations that changed since the previous frame.
+type DeltaFrameResponse struct {
+	Timestamp string                 `json:"timestamp"`
+	Added     []StationResponse      `json:"added,omitempty"`
+	Changed   []StationDeltaResponse `json:"changed"`
+	Removed   []int                  `json:"removed,omitempty"`
+}
+
+// HistoryRangeResponse is the JSON response for the playback API.
+type HistoryRangeResponse struct {
+	From    string               `json:"from"`
+	To      string               `json:"to"`
+	Step    string               `json:"step"`
+	Initial *StationsResponse    `json:"initial"`
+	Frames  []DeltaFrameResponse `json:"frames"`
+}
+
+// handleHistoryRange serves an initial full frame plus per-step deltas for map playback.
+func (h *Handler) handleHistoryRange(w http.ResponseWriter, r *http.Request) {
+	rangeStore, ok := h.analyticsStore(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultAnalyticsWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxPlaybackRange {
+		httpError(w, r, "Range too large (maximum 7 days)", http.StatusBadRequest)
+		return
+	}
+
+	step := defaultPlaybackStep
+	if v := r.URL.Query().Get("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			httpError(w, r, "Invalid step parameter (minimum 1m)", http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+
+	builder := analytics.NewPlaybackBuilder(step)
+	if err := analytics.Run(r.Context(), rangeStore, from, to, builder); err != nil {
+		slog.Error("Failed to build playback frames", "error", err)
+		httpError(w, r, "Failed to fetch historical data", http.StatusInternalServerError)
+		return
+	}
+
+	initial := builder.Initial()
+	if initial == nil {
+		httpError(w, r, "No snapshots in requested range", http.StatusNotFound)
+		return
+	}
+
+	response := HistoryRangeResponse{
+		From: from.Format("2006-01-02T15:04:05Z"),
+		To:   to.Format("2006-01-02T15:04:05Z"),
+		Step: step.String(),
+		Initial: &StationsResponse{
+			Timestamp: initial.Timestamp.Format("2006-01-02T15:04:05Z"),
+			Stations:  make([]StationResponse, len(initial.Stations)),
+		},
+		Frames: make([]DeltaFrameResponse, len(builder.Frames())),
+	}
+	for i, s := range initial.Stations {
+		response.Initial.Stations[i] = toStationResponse(s)
+	}
+	for i, f := range builder.Frames() {
+		frame := DeltaFrameResponse{
+			Timestamp: f.Timestamp.Format("2006-01-02T15:04:05Z"),
+			Changed:   make([]StationDeltaResponse, len(f.Changed)),
+			Removed:   f.Removed,
+		}
+		for _, s := range f.Added {
+			frame.Added = append(frame.Added, toStationResponse(s))
+		}
+		for j, s := range f.Changed {
+			frame.Changed[j] = StationDeltaResponse{
+				ID:              s.ID,
+				NbBikes:         s.NbBikes,
+				NbStandardBikes: s.NbStandardBikes,
+				NbEBikes:        s.NbEBikes,
+				NbEmptyDocks:    s.NbEmptyDocks,
+				NbDocks:         s.NbDocks,
+			}
+		}
+		response.Frames[i] = frame
+	}
+
+	writeJSON(w, response)
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+const (
+	// prefetchDepth is how many snapshots either side of a requested one are
+	// prefetched: the time slider moves one snapshot per step.
+	prefetchDepth = 2
+	// prefetchQueue is how many requested snapshots may wait for their
+	// neighbours to be prefetched; when it is full the oldest is dropped, as
+	// whoever asked for it has likely scrubbed past it.
+	prefetchQueue = 8
+)
+
+// queuePrefetch asks the prefetch worker to cache the snapshots either side of
+// the one at t, without waiting.
+func (h *Handler) queuePrefetch(t time.Time) {
+	for {
+		select {
+		case h.prefetch <- t:
+			return
+		default:
+		}
+		select {
+		case <-h.prefetch:
+		default:
+		}
+	}
+}
+
+// startPrefetch runs the prefetch worker until ctx is cancelled. Snapshots
+// are prefetched one at a time, so scrubbing costs the store at most one read
+// in the background on top of the reads requests make.
+func (h *Handler) startPrefetch(ctx context.Context) {
+	store, ok := h.store.(storage.HistoricalDataStore)
+	if !ok {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case t := <-h.prefetch:
+				h.prefetchAround(ctx, store, t)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// prefetchAround caches the neighbours of the snapshot at t that are not
+// cached yet, nearest first.
+func (h *Handler) prefetchAround(ctx context.Context, store storage.HistoricalDataStore, t time.Time) {
+	for _, ts := range h.snapshotNeighbours(t, prefetchDepth) {
+		key := ts.UTC().Format(time.RFC3339)
+		if cached, err := h.snapshotCache.Contains(ctx, snapshotKeyPrefix+key); err == nil && cached {
+			continue
+		}
+		if _, err := h.readSnapshot(ctx, store, ts); err != nil {
+			slog.Debug("Snapshot prefetch failed", "timestamp", key, "error", err)
+			return
+		}
+	}
+}
+
+// snapshotNeighbours returns the times of up to n snapshots either side of t,
+// alternating newer and older, nearest first. The history aggregate, which has
+// a point per snapshot, serves as the index of snapshot times; until it has
+// been built there are no neighbours.
+func (h *Handler) snapshotNeighbours(t time.Time, n int) []time.Time {
+	h.historyCacheMu.RLock()
+	points := h.historyCache
+	h.historyCacheMu.RUnlock()
+
+	// Points are newest first: newer snapshots are before i, older from i on
+	i := sort.Search(len(points), func(i int) bool { return !points[i].Timestamp.After(t) })
+	older := i
+	if older < len(points) && points[older].Timestamp.Equal(t) {
+		older++
+	}
+	var neighbours []time.Time
+	for k := range n {
+		if newer := i - 1 - k; newer >= 0 {
+			neighbours = append(neighbours, points[newer].Timestamp)
+		}
+		if o := older + k; o < len(points) {
+			neighbours = append(neighbours, points[o].Timestamp)
+		}
+	}
+	return neighbours
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// defaultQueryLimit is the number of rows returned when a query has no limit parameter.
+	defaultQueryLimit = 1000
+	// maxQueryWindow bounds how much history a single query may scan.
+	maxQueryWindow = 31 * 24 * time.Hour
+)
+
+// QueryResponse is the JSON response for the query API.
+type QueryResponse struct {
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	SnapshotCount int      `json:"snapshotCount"`
+	Columns       []string `json:"columns"`
+	Rows          [][]any  `json:"rows"`
+}
+
+// SetQueryEngine replaces the engine used by the query API. By default queries
+// over the last week run on snapshots held in columnar form, and older ones
+// scan snapshots from the store.
+func (h *Handler) SetQueryEngine(engine analytics.QueryEngine) {
+	h.queryEngine = engine
+}
+
+// QueryEngine returns the engine the query API runs on: the one set with
+// SetQueryEngine, or the default, which is nil if the store cannot be queried.
+// It lets a replacement fall back to the default for what it cannot answer.
+func (h *Handler) QueryEngine() analytics.QueryEngine {
+	if h.queryEngine != nil {
+		return h.queryEngine
+	}
+	if h.columnar == nil {
+		return nil
+	}
+	return h.columnar
+}
+
+// newColumnarEngine returns the default query engine for store, or nil if
+// store cannot be read by time range.
+func newColumnarEngine(store storage.DataStore) *analytics.ColumnarEngine {
+	rangeStore, ok := store.(storage.RangeDataStore)
+	if !ok {
+		return nil
+	}
+	return analytics.NewColumnarEngine(rangeStore, analytics.DefaultColumnarWindow)
+}
+
+// handleQuery executes a constrained aggregation query over stored snapshots.
+func (h *Handler) handleQuery(w http.ResponseWriter, r *http.Request) {
+	engine := h.queryEngine
+	if engine == nil {
+		if h.columnar == nil {
+			httpError(w, r, "Queries not available with current storage backend", http.StatusNotImplemented)
+			return
+		}
+		engine = h.columnar
+	}
+
+	q, err := h.parseQuery(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := engine.Execute(r.Context(), q)
+	if err != nil {
+		slog.Error("Failed to execute query", "error", err)
+		httpError(w, r, "Failed to execute query", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, QueryResponse{
+		From:          formatTime(q.From, q.Location),
+		To:            formatTime(q.To, q.Location),
+		SnapshotCount: result.SnapshotCount,
+		Columns:       result.Columns,
+		Rows:          result.Rows,
+	})
+}
+
+// parseQuery reads a query from the request's query parameters.
+func (h *Handler) parseQuery(r *http.Request) (analytics.Query, error) {
+	var q analytics.Query
+	var err error
+	params := r.URL.Query()
+
+	if q.Select, err = analytics.ParseSelect(params.Get("select")); err != nil {
+		return q, err
+	}
+	if q.GroupBy, err = analytics.ParseGroupBy(params.Get("group_by")); err != nil {
+		return q, err
+	}
+	if q.Stations, err = analytics.ParseStationList(params.Get("station")); err != nil {
+		return q, err
+	}
+
+	if q.From, q.To, err = parseTimeRange(r, defaultAnalyticsWindow); err != nil {
+		return q, err
+	}
+	if q.To.Sub(q.From) > maxQueryWindow {
+		return q, errInvalidParam("from")
+	}
+	if q.Location, err = h.parseLocation(r); err != nil {
+		return q, err
+	}
+	q.Areas = h.areas
+
+	if q.Limit, err = parseIntParam(r, "limit", defaultQueryLimit); err != nil {
+		return q, err
+	}
+
+	// A leading "-" sorts descending
+	order := params.Get("order")
+	q.Desc = strings.HasPrefix(order, "-")
+	q.OrderBy = strings.TrimPrefix(order, "-")
+
+	if err := q.Validate(); err != nil {
+		return q, err
+	}
+	return q, nil
+}
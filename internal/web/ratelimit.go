@@ -0,0 +1,154 @@
+package web
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a classic token-bucket rate limiter. It is not safe for
+// concurrent use; callers hold their own lock.
+type tokenBucket struct {
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket allowing ratePerMinute requests with the given burst.
+func newTokenBucket(ratePerMinute float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   ratePerMinute / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// allow takes a token if one is available. If not, it returns how long until one will be.
+func (b *tokenBucket) allow(now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if b.rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// retryAfterSeconds formats a wait as a whole number of seconds for Retry-After.
+func retryAfterSeconds(wait time.Duration) int {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// ipLimiterIdleTTL is how long an idle client's bucket is kept before being dropped.
+const ipLimiterIdleTTL = 10 * time.Minute
+
+// IPRateLimitConfig configures per-client-IP rate limiting of API routes.
+type IPRateLimitConfig struct {
+	RatePerMinute float64
+	Burst         int
+	// TrustProxy uses the last X-Forwarded-For address, the one the proxy
+	// appended, as the client IP; earlier ones are set by the client and
+	// could be forged. Only enable this behind a reverse proxy that appends
+	// to the header.
+	TrustProxy bool
+}
+
+// ipRateLimiter keeps a token bucket per client IP.
+type ipRateLimiter struct {
+	cfg IPRateLimitConfig
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// EnableIPRateLimit limits each client IP on API routes. Call before serving requests.
+func (h *Handler) EnableIPRateLimit(cfg IPRateLimitConfig) {
+	h.ipLimiter = &ipRateLimiter{
+		cfg:       cfg,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token for ip, creating its bucket on first use.
+func (l *ipRateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > ipLimiterIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > ipLimiterIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = newTokenBucket(l.cfg.RatePerMinute, l.cfg.Burst, now)
+		l.buckets[ip] = b
+	}
+	return b.allow(now)
+}
+
+// clientIP returns the request's client address.
+func (l *ipRateLimiter) clientIP(r *http.Request) string {
+	if l.cfg.TrustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			last := fwd[len(fwd)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withIPRateLimit rejects requests from clients over their rate with 429 and Retry-After.
+func (h *Handler) withIPRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.ipLimiter == nil {
+			next(w, r)
+			return
+		}
+
+		allowed, wait := h.ipLimiter.allow(h.ipLimiter.clientIP(r), time.Now())
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			httpError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/geo"
+	"city-cycling/internal/tfl"
+)
+
+// defaultReachableMinutes is the time budget used when a reachable request has
+// no minutes parameter; maxReachableMinutes bounds it.
+const (
+	defaultReachableMinutes = 15
+	maxReachableMinutes     = 120
+)
+
+// ReachableStationResponse is a station within a reachable request's budget.
+type ReachableStationResponse struct {
+	StationID  int     `json:"stationId"`
+	Name       string  `json:"name"`
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+	Meters     int     `json:"meters"` // straight-line distance
+	Minutes    float64 `json:"minutes"`
+	Bikes      int     `json:"bikes"`
+	EmptyDocks int     `json:"emptyDocks"`
+}
+
+// ReachableResponse is the JSON response for the reachable stations API.
+type ReachableResponse struct {
+	StationID int                        `json:"stationId"`
+	Timestamp string                     `json:"timestamp"`
+	Minutes   int                        `json:"minutes"`
+	Stations  []ReachableStationResponse `json:"stations"`
+}
+
+// handleReachableStations lists the stations that can be cycled to from a
+// station within a time budget, quickest first.
+func (h *Handler) handleReachableStations(w http.ResponseWriter, r *http.Request) {
+	stationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid station id", http.StatusBadRequest)
+		return
+	}
+	budget, err := parseIntParam(r, "minutes", defaultReachableMinutes)
+	if err != nil || budget < 1 || budget > maxReachableMinutes {
+		httpError(w, r, fmt.Sprintf("Invalid minutes parameter (1 to %d)", maxReachableMinutes), http.StatusBadRequest)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+	journeys, ok := h.journeyTimes(stations).Within(stationID, time.Duration(budget)*time.Minute)
+	if !ok {
+		httpError(w, r, "Station not found", http.StatusNotFound)
+		return
+	}
+
+	byID := make(map[int]tfl.Station, len(stations))
+	for _, s := range stations {
+		byID[s.ID] = s
+	}
+	from := byID[stationID]
+	response := ReachableResponse{
+		StationID: stationID,
+		Timestamp: timestamp.Format("2006-01-02T15:04:05Z"),
+		Minutes:   budget,
+		Stations:  make([]ReachableStationResponse, len(journeys)),
+	}
+	for i, j := range journeys {
+		s := byID[j.StationID]
+		response.Stations[i] = ReachableStationResponse{
+			StationID:  s.ID,
+			Name:       s.Name,
+			Lat:        s.Lat,
+			Lng:        s.Long,
+			Meters:     int(math.Round(geo.DistanceMeters(from.Lat, from.Long, s.Lat, s.Long))),
+			Minutes:    minutes(j.Time),
+			Bikes:      s.NbBikes,
+			EmptyDocks: s.NbEmptyDocks,
+		}
+	}
+	writeJSON(w, response)
+}
+
+// journeyTimes returns the travel matrix of stations, computing it only when
+// a station has been added, removed or moved since it was last built.
+func (h *Handler) journeyTimes(stations []tfl.Station) *geo.TravelMatrix {
+	key := stationLayoutKey(stations)
+	h.travelMatrixMu.Lock()
+	defer h.travelMatrixMu.Unlock()
+	if h.travelMatrix == nil || h.travelMatrixKey != key {
+		h.travelMatrix = geo.NewTravelMatrix(stations)
+		h.travelMatrixKey = key
+	}
+	return h.travelMatrix
+}
+
+// stationLayoutKey hashes the IDs and positions of stations, which is all a
+// travel matrix depends on.
+func stationLayoutKey(stations []tfl.Station) uint64 {
+	hash := fnv.New64a()
+	var buf [24]byte
+	for _, s := range stations {
+		binary.LittleEndian.PutUint64(buf[0:], uint64(s.ID))
+		binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(s.Lat))
+		binary.LittleEndian.PutUint64(buf[16:], math.Float64bits(s.Long))
+		hash.Write(buf[:])
+	}
+	return hash.Sum64()
+}
@@ -0,0 +1,183 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/rollup"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// defaultReliabilityWindow is the range reported when a reliability request has no from parameter.
+	defaultReliabilityWindow = 30 * 24 * time.Hour
+	// defaultReliabilityTarget is the share of the time a station should be usable both ways.
+	defaultReliabilityTarget = 0.9
+)
+
+// AvailabilityResponse is how much of the time a station, or the network on
+// average, could be used. All three are fractions between 0 and 1.
+type AvailabilityResponse struct {
+	Samples int `json:"samples"`
+	// WithBike is the time there was a bike to rent, WithDock the time there
+	// was a dock to return one to, and Available the time there were both.
+	WithBike  float64 `json:"withBike"`
+	WithDock  float64 `json:"withDock"`
+	Available float64 `json:"available"`
+}
+
+// ReliabilityDayResponse is a station's availability on one local day.
+type ReliabilityDayResponse struct {
+	Date string `json:"date"`
+	AvailabilityResponse
+}
+
+// StationReliabilityResponse is a station's availability over the range.
+type StationReliabilityResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"`
+	AvailabilityResponse
+	// DaysBelowTarget counts the days the station was available less than the target.
+	DaysBelowTarget int                      `json:"daysBelowTarget"`
+	Days            []ReliabilityDayResponse `json:"days,omitempty"`
+}
+
+// ReliabilityResponse is the JSON response for the reliability API.
+type ReliabilityResponse struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Target float64 `json:"target"`
+	// Network pools every station's samples.
+	Network  AvailabilityResponse         `json:"network"`
+	Stations []StationReliabilityResponse `json:"stations"`
+	// Worst lists the least available stations first, without their days.
+	Worst []StationReliabilityResponse `json:"worstStations"`
+}
+
+// handleReliability serves the share of the time each station had a bike and a
+// free dock, per day from the daily rollups, with the worst offenders ranked.
+func (h *Handler) handleReliability(w http.ResponseWriter, r *http.Request) {
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok {
+		httpError(w, r, "Rollups not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultReliabilityWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	top, err := parseTop(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	target, err := parseReliabilityTarget(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Days are the city's, the zone the collector rolls up in
+	cityLoc := h.city.Location()
+	byStation, err := rollup.ReadStations(r.Context(), objects, rollup.Day, cityLoc, from, to)
+	if err != nil {
+		slog.Error("Failed to read rollups", "resolution", rollup.Day, "error", err)
+		httpError(w, r, "Failed to read rollups", http.StatusInternalServerError)
+		return
+	}
+
+	names := make(map[int]string)
+	if stations, _, err := h.latestSnapshot(r.Context()); err == nil {
+		for _, s := range stations {
+			names[s.ID] = s.Name
+		}
+	}
+
+	response := ReliabilityResponse{
+		From:     formatTime(from, loc),
+		To:       formatTime(to, loc),
+		Target:   target,
+		Stations: []StationReliabilityResponse{},
+	}
+	var network rollup.Bucket
+	for id, days := range byStation {
+		if stationID != 0 && id != stationID {
+			continue
+		}
+		station := StationReliabilityResponse{ID: id, Name: names[id]}
+		var total rollup.Bucket
+		for _, day := range days {
+			if day.AvailSamples == 0 {
+				// Rolled up before availability was recorded
+				continue
+			}
+			total.Merge(day)
+			if day.Availability() < target {
+				station.DaysBelowTarget++
+			}
+			station.Days = append(station.Days, ReliabilityDayResponse{
+				Date:                 day.Start.In(cityLoc).Format(time.DateOnly),
+				AvailabilityResponse: availabilityResponse(day),
+			})
+		}
+		if total.AvailSamples == 0 {
+			continue
+		}
+		network.Merge(total)
+		station.AvailabilityResponse = availabilityResponse(total)
+		response.Stations = append(response.Stations, station)
+	}
+	sort.Slice(response.Stations, func(i, j int) bool { return response.Stations[i].ID < response.Stations[j].ID })
+	response.Network = availabilityResponse(network)
+
+	worst := make([]StationReliabilityResponse, len(response.Stations))
+	copy(worst, response.Stations)
+	sort.SliceStable(worst, func(i, j int) bool { return worst[i].Available < worst[j].Available })
+	if len(worst) > top {
+		worst = worst[:top]
+	}
+	for i := range worst {
+		worst[i].Days = nil
+	}
+	response.Worst = worst
+
+	writeJSON(w, response)
+}
+
+// availabilityResponse converts a bucket's availability counts.
+func availabilityResponse(b rollup.Bucket) AvailabilityResponse {
+	return AvailabilityResponse{
+		Samples:   b.AvailSamples,
+		WithBike:  b.BikeAvailability(),
+		WithDock:  b.DockAvailability(),
+		Available: b.Availability(),
+	}
+}
+
+// parseReliabilityTarget reads the availability target, a fraction between 0 and 1.
+func parseReliabilityTarget(r *http.Request) (float64, error) {
+	v := r.URL.Query().Get("target")
+	if v == "" {
+		return defaultReliabilityTarget, nil
+	}
+	target, err := strconv.ParseFloat(v, 64)
+	if err != nil || target < 0 || target > 1 {
+		return 0, errInvalidParam("target")
+	}
+	return target, nil
+}
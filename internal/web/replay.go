@@ -0,0 +1,131 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/storage"
+)
+
+// DefaultReplaySpeed is how many seconds of history a replay plays per second.
+const DefaultReplaySpeed = 60
+
+// ReplayClock runs from a point in the past at a multiple of real time,
+// starting over once it reaches the end of the replayed range.
+type ReplayClock struct {
+	from  time.Time
+	speed float64
+
+	mu      sync.Mutex
+	started time.Time
+}
+
+// NewReplayClock creates a clock that starts at from and advances speed times
+// faster than real time; speed <= 0 uses DefaultReplaySpeed.
+func NewReplayClock(from time.Time, speed float64) *ReplayClock {
+	if speed <= 0 {
+		speed = DefaultReplaySpeed
+	}
+	return &ReplayClock{from: from, speed: speed, started: time.Now()}
+}
+
+// Now returns the replayed time.
+func (c *ReplayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.from.Add(time.Duration(float64(time.Since(c.started)) * c.speed))
+}
+
+// Restart winds the clock back to its starting point.
+func (c *ReplayClock) Restart() {
+	c.mu.Lock()
+	c.started = time.Now()
+	c.mu.Unlock()
+}
+
+// replayState is the snapshot sequence a replaying handler steps through.
+type replayState struct {
+	clock      *ReplayClock
+	timestamps []time.Time // oldest first, none before the clock's start
+	mu         sync.Mutex
+}
+
+// EnableReplay makes the handler serve stored snapshots as if they were live,
+// showing the newest one taken at or before clock's time: /api/stations, the map and
+// everything else derived from the latest snapshot step through history
+// instead of following the collector. Anomaly state is kept in memory only so
+// the real detector state in the store is untouched. Call it before
+// StartLatestRefresh; it fails if no snapshot was taken after the clock's start.
+func (h *Handler) EnableReplay(ctx context.Context, clock *ReplayClock) error {
+	if _, ok := h.store.(storage.HistoricalDataStore); !ok {
+		return errors.New("replay requires a storage backend with historical snapshots")
+	}
+	from := clock.Now()
+	timestamps, err := storage.ListTimestamps(ctx, h.store, storage.TimestampQuery{From: from})
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if len(timestamps) == 0 {
+		return fmt.Errorf("no snapshots after %s to replay", from.UTC().Format(time.RFC3339))
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+
+	h.replay = &replayState{clock: clock, timestamps: timestamps}
+	slog.Info("Replay enabled", "city", h.city.ID, "from", timestamps[0].UTC().Format(time.RFC3339),
+		"to", timestamps[len(timestamps)-1].UTC().Format(time.RFC3339), "snapshots", len(timestamps), "speed", clock.speed)
+	return nil
+}
+
+// replayCurrent returns the timestamp of the snapshot the replay is showing,
+// restarting the clock once it has passed the last one.
+func (r *replayState) replayCurrent() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	last := r.timestamps[len(r.timestamps)-1]
+	if now.After(last.Add(time.Minute)) {
+		r.clock.Restart()
+		now = r.clock.Now()
+		slog.Info("Replay restarted", "from", r.timestamps[0].UTC().Format(time.RFC3339))
+	}
+	// Newest snapshot at or before now; the first one until the clock reaches it
+	i := sort.Search(len(r.timestamps), func(i int) bool { return r.timestamps[i].After(now) })
+	return r.timestamps[max(i-1, 0)]
+}
+
+// refreshReplay loads the snapshot the replay clock has reached into the
+// latest snapshot cache, if it is not already there.
+func (h *Handler) refreshReplay(ctx context.Context) error {
+	timestamp := h.replay.replayCurrent()
+	h.latestMu.RLock()
+	current := h.latestStations != nil && h.latestTimestamp.Equal(timestamp)
+	h.latestMu.RUnlock()
+	if current {
+		return nil
+	}
+
+	historical := h.store.(storage.HistoricalDataStore)
+	stations, err := historical.GetSnapshotByTimestamp(ctx, timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to load replayed snapshot: %w", err)
+	}
+
+	h.anomaliesMu.Lock()
+	if !timestamp.After(h.anomalies.LastSeen()) {
+		// The replay started over, so its history must too
+		h.anomalies = analytics.NewAnomalyDetector()
+		h.anomalyStatus = nil
+		h.dockAdjustment = nil
+	}
+	h.anomaliesMu.Unlock()
+
+	h.setLatest(stations, timestamp)
+	return nil
+}
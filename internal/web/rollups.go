@@ -0,0 +1,80 @@
+package web
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"city-cycling/internal/rollup"
+	"city-cycling/internal/storage"
+)
+
+// rollupWindows are the default ranges served for each rollup resolution.
+var rollupWindows = map[rollup.Resolution]time.Duration{
+	rollup.Hour: 7 * 24 * time.Hour,
+	rollup.Day:  365 * 24 * time.Hour,
+	rollup.Week: 5 * 365 * 24 * time.Hour,
+}
+
+// handleHistoryRollup serves /history?resolution=... from the stored rollups.
+func (h *Handler) handleHistoryRollup(w http.ResponseWriter, r *http.Request) {
+	objects, ok := h.store.(storage.ObjectStore)
+	if !ok {
+		httpError(w, r, "Rollups not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	res, err := rollup.ParseResolution(r.URL.Query().Get("resolution"))
+	if err != nil {
+		httpError(w, r, errInvalidParam("resolution").Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseTimeRange(r, rollupWindows[res])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stationID, err := parseIntParam(r, "station", 0)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Buckets are aligned to the city's zone, the one the collector rolls up in
+	buckets, err := rollup.Read(r.Context(), objects, res, h.city.Location(), stationID, from, to)
+	if err != nil {
+		slog.Error("Failed to read rollups", "resolution", res, "error", err)
+		httpError(w, r, "Failed to read rollups", http.StatusInternalServerError)
+		return
+	}
+
+	response := HistoryResponse{
+		Resolution: string(res),
+		StationID:  stationID,
+		DataPoints: make([]HistoryDataPointResponse, len(buckets)),
+	}
+	for i, b := range buckets {
+		stations := int(math.Round(b.AvgStations()))
+		if stationID != 0 {
+			stations = 1
+		}
+		response.DataPoints[i] = HistoryDataPointResponse{
+			Timestamp:       formatTime(b.Start, loc),
+			TotalBikes:      int(math.Round(b.AvgBikes())),
+			TotalEBikes:     int(math.Round(b.AvgEBikes())),
+			TotalEmptyDocks: int(math.Round(b.AvgEmptyDocks())),
+			StationCount:    stations,
+			Samples:         b.Samples,
+			MinBikes:        &b.MinBikes,
+			MaxBikes:        &b.MaxBikes,
+		}
+	}
+
+	writeJSON(w, response)
+}
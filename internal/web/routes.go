@@ -0,0 +1,526 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"city-cycling/internal/analytics"
+	"city-cycling/internal/export"
+)
+
+// access controls which middleware chain a route is served through.
+type access int
+
+const (
+	// accessPublic routes are rate limited per IP but never need an API key.
+	accessPublic access = iota
+	// accessProtected routes scan historical snapshots and require an API key
+	// when keys are enabled.
+	accessProtected
+)
+
+// param documents a query or path parameter accepted by a route.
+type param struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // OpenAPI primitive type
+	Format      string
+	Enum        []string
+	Default     any
+	Required    bool
+	Description string
+}
+
+// route is the single definition of an API endpoint. RegisterRoutes mounts it on
+// the mux and the OpenAPI document is generated from it, so the two cannot drift.
+type route struct {
+	Method string
+	// Path is relative to the API version prefix, e.g. /stations.
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Access      access
+	Params      []param
+	// Response is a zero value of the JSON response body type.
+	Response any
+	// Timeout bounds how long the handler may run; zero means
+	// defaultRouteTimeout, or streamRouteTimeout for Stream routes.
+	Timeout time.Duration
+	// Load is the class whose concurrency limit the route shares; empty
+	// routes are not limited.
+	Load loadClass
+	// Stream routes write their body as they produce it rather than into a
+	// buffer, uncompressed, and serve byte ranges of it. MediaTypes lists the
+	// response types of routes not answering JSON, the first described by
+	// Response when set.
+	Stream     bool
+	MediaTypes []string
+	Handler    http.HandlerFunc
+}
+
+// Shared parameter definitions.
+var (
+	stationIDParam = param{Name: "id", In: "path", Type: "integer", Required: true, Description: "TFL station ID"}
+	fromParam      = param{Name: "from", In: "query", Type: "string", Format: "date-time", Description: "Start of the range (RFC 3339)"}
+	toParam        = param{Name: "to", In: "query", Type: "string", Format: "date-time", Description: "End of the range (RFC 3339); defaults to now"}
+	topParam       = param{Name: "top", In: "query", Type: "integer", Default: defaultAnalyticsTop, Description: "Number of stations in each ranking"}
+	tzParam        = param{Name: "tz", In: "query", Type: "string", Description: "IANA time zone for local-time buckets and returned timestamps, e.g. Europe/London; defaults to the city's time zone"}
+	thresholdParam = param{Name: "threshold", In: "query", Type: "integer", Default: analytics.DefaultRebalanceThreshold, Description: "Minimum bike count change treated as a rebalancing event"}
+)
+
+// routesV1 returns every endpoint in version 1 of the API.
+func (h *Handler) routesV1() []route {
+	return []route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/cities",
+			Summary:  "Cities served by this deployment and where their routes are mounted",
+			Tags:     []string{"cities"},
+			Response: CitiesResponse{},
+			Timeout:  shortRouteTimeout,
+			Handler:  h.handleCities,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stations",
+			Summary:  "Latest station availability",
+			Tags:     []string{"stations"},
+			Response: StationsResponse{},
+			Timeout:  shortRouteTimeout,
+			Handler:  h.handleStations,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/history",
+			Summary:     "Network-wide totals for every stored snapshot, or hourly, daily or weekly rollups",
+			Description: "Without resolution, returns one data point per snapshot, newest first, optionally paged and downsampled for charting. With resolution, returns precomputed rollup buckets whose totals are averages, aligned to local time in the city's time zone.",
+			Tags:        []string{"history"},
+			Params: []param{
+				{Name: "resolution", In: "query", Type: "string", Enum: []string{"hour", "day", "week"}, Description: "Return rollup buckets of this width instead of every snapshot"},
+				{Name: "station", In: "query", Type: "integer", Description: "With resolution, return the rollups of this station instead of network totals"},
+				{Name: "from", In: "query", Type: "string", Format: "date-time", Description: "Start of the range (RFC 3339); with resolution defaults to 7 days, 1 year or 5 years before to, otherwise to the first snapshot"},
+				{Name: "to", In: "query", Type: "string", Format: "date-time", Description: "End of the range (RFC 3339); defaults to now"},
+				{Name: "limit", In: "query", Type: "integer", Description: "Without resolution, return at most this many snapshots, newest first, with a nextCursor for the rest"},
+				{Name: "offset", In: "query", Type: "integer", Description: "Without resolution, skip this many snapshots after the cursor or the start of the range"},
+				{Name: "cursor", In: "query", Type: "string", Description: "Without resolution, the nextCursor of the previous page"},
+				{Name: "maxPoints", In: "query", Type: "integer", Description: "Without resolution, downsample the page to at most this many points (LTTB on totalBikes; minimum 3)"},
+				tzParam,
+			},
+			Response: HistoryResponse{},
+			Load:     loadHistory,
+			Handler:  h.handleHistory,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/history/snapshot",
+			Summary: "Station availability at a point in time",
+			Tags:    []string{"history"},
+			Params: []param{
+				{Name: "timestamp", In: "query", Type: "string", Format: "date-time", Required: true, Description: "Snapshot time (RFC 3339); the closest snapshot is returned"},
+				{Name: "tolerance", In: "query", Type: "string", Description: "Only consider snapshots at most this far from timestamp, as a Go duration (e.g. 15m); 404 if there is none, and the response carries the snapshot's own time"},
+				{Name: "from", In: "query", Type: "string", Format: "date-time", Description: "Only consider snapshots at or after this time (RFC 3339), as with tolerance"},
+				{Name: "to", In: "query", Type: "string", Format: "date-time", Description: "Only consider snapshots at or before this time (RFC 3339), as with tolerance"},
+			},
+			Response: StationsResponse{},
+			Handler:  h.handleHistorySnapshot,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/history/timestamps",
+			Summary:     "Times of the stored snapshots",
+			Description: "Lists when snapshots were actually taken, newest first, read from snapshot names without downloading any, so a time slider can mark real snapshots and collector outages.",
+			Tags:        []string{"history"},
+			Params: []param{
+				{Name: "from", In: "query", Type: "string", Format: "date-time", Description: "Start of the range (RFC 3339); defaults to the first snapshot"},
+				{Name: "to", In: "query", Type: "string", Format: "date-time", Description: "End of the range (RFC 3339); defaults to the latest snapshot"},
+				{Name: "limit", In: "query", Type: "integer", Description: "Return at most this many timestamps, newest first"},
+			},
+			Response: HistoryTimestampsResponse{},
+			Handler:  h.handleHistoryTimestamps,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/heatmap",
+			Summary: "Availability aggregated onto a grid",
+			Tags:    []string{"stations"},
+			Params: []param{
+				{Name: "z", In: "query", Type: "integer", Default: defaultHeatmapZoom, Description: "Map zoom level the grid is derived from"},
+				{Name: "metric", In: "query", Type: "string", Enum: []string{"bikes", "docks", "occupancy"}, Default: "bikes", Description: "Value aggregated per cell"},
+			},
+			Response: HeatmapResponse{},
+			Handler:  h.handleHeatmap,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/dashboard",
+			Summary:     "Homepage totals, sparkline and emptiest and fullest stations",
+			Description: "Composes what the homepage shows in one response: the latest snapshot's totals and age, hourly mean bike totals over the last 24 hours, and the 5 stations with the lowest and highest occupancy. The sparkline is empty when history is unavailable.",
+			Tags:        []string{"stations"},
+			Params:      []param{tzParam},
+			Response:    DashboardResponse{},
+			Handler:     h.handleDashboard,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/stations/clusters",
+			Summary:     "Latest availability clustered into map markers",
+			Description: "Stations within 60 screen pixels of each other at the zoom level are merged into one marker with their summed counts; a marker of one station carries its stationId. Clusters are the same however the map is panned.",
+			Tags:        []string{"stations"},
+			Params: []param{
+				{Name: "zoom", In: "query", Type: "integer", Default: defaultClusterZoom, Description: "Map zoom level the markers are drawn at"},
+				{Name: "bbox", In: "query", Type: "string", Description: "Only markers centred in west,south,east,north (degrees); all when omitted"},
+			},
+			Response: ClustersResponse{},
+			Handler:  h.handleStationClusters,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/tiles/{z}/{x}/{y}",
+			Summary:     "Latest availability as Mapbox Vector Tiles",
+			Description: "A stations layer of points identified by station ID, with name, bikes, standardBikes, ebikes, emptyDocks, docks and occupancy attributes, for styling in MapLibre. Responds 204 for tiles without stations.",
+			Tags:        []string{"stations"},
+			Params: []param{
+				{Name: "z", In: "path", Type: "integer", Required: true, Description: "Tile zoom"},
+				{Name: "x", In: "path", Type: "integer", Required: true, Description: "Tile column"},
+				{Name: "y", In: "path", Type: "string", Required: true, Description: "Tile row followed by .mvt, e.g. 5448.mvt"},
+			},
+			MediaTypes: []string{mvtContentType},
+			Handler:    h.handleStationTile,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/areas",
+			Summary:     "Latest availability aggregated by borough or neighbourhood",
+			Description: "Totals and densities per area of the configured GeoJSON boundaries. Responds 501 when no areas are configured.",
+			Tags:        []string{"stations"},
+			Response:    AreasResponse{},
+			Timeout:     shortRouteTimeout,
+			Handler:     h.handleAreas,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/areas/{area}/stations",
+			Summary: "Latest availability of the stations in one area",
+			Tags:    []string{"stations"},
+			Params: []param{
+				{Name: "area", In: "path", Type: "string", Required: true, Description: "Area name, as listed by /areas"},
+			},
+			Response: AreaStationsResponse{},
+			Timeout:  shortRouteTimeout,
+			Handler:  h.handleAreaStations,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/usage",
+			Summary:  "Usage counters for the calling API key",
+			Tags:     []string{"meta"},
+			Response: KeyUsage{},
+			Timeout:  shortRouteTimeout,
+			Handler:  h.handleKeyUsage,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/history/range",
+			Summary: "Delta-encoded frames for animated playback",
+			Tags:    []string{"history"},
+			Access:  accessProtected,
+			Params: []param{
+				fromParam, toParam,
+				{Name: "step", In: "query", Type: "string", Default: defaultPlaybackStep.String(), Description: "Frame spacing as a Go duration (minimum 1m)"},
+			},
+			Response: HistoryRangeResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadHistory,
+			Handler:  h.handleHistoryRange,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/export",
+			Summary:     "Stream every station reading in a time range as TSV or JSON lines",
+			Description: "Rows are streamed from storage as snapshots are read, oldest first, so any range can be exported. A single byte range is served as 206 Partial Content, so an interrupted download can be resumed with Range: bytes=<received>-; the ETag identifies the snapshots exported, for If-Range.",
+			Tags:        []string{"history"},
+			Access:      accessProtected,
+			Params: []param{
+				{Name: "from", In: "query", Type: "string", Format: "date-time", Description: "Start of the range (RFC 3339); defaults to 24 hours before to"},
+				toParam,
+				{Name: "format", In: "query", Type: "string", Enum: []string{string(export.TSV), string(export.JSONL)}, Default: string(export.TSV), Description: "tsv for the snapshot format under one header line, jsonl for one JSON object per reading"},
+				{Name: "station", In: "query", Type: "integer", Description: "Only export this station's readings"},
+			},
+			Response:   export.Row{},
+			Stream:     true,
+			MediaTypes: []string{export.JSONL.ContentType(), export.TSV.ContentType()},
+			Load:       loadExport,
+			Handler:    h.handleExport,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/health/gaps",
+			Summary: "Missing snapshot windows",
+			Tags:    []string{"meta"},
+			Access:  accessProtected,
+			Params: []param{
+				{Name: "interval", In: "query", Type: "string", Default: defaultGapInterval.String(), Description: "Expected collection interval as a Go duration"},
+			},
+			Response: GapReportResponse{},
+			Load:     loadAnalytics,
+			Handler:  h.handleGaps,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/health/integrity",
+			Summary:  "Audit stored snapshots against their recorded checksums",
+			Tags:     []string{"meta"},
+			Access:   accessProtected,
+			Response: IntegrityReportResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleIntegrity,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/status",
+			Summary:     "System health: data freshness, snapshot counts, caches and recent gaps",
+			Description: "Reports the last successful collection, the oldest and newest snapshots, the storage backend, cache statistics and data gaps in the last 24 hours. The report is rebuilt at most every 30 seconds. The same information is shown on the HTML page at /status.",
+			Tags:        []string{"meta"},
+			Params: []param{
+				{Name: "interval", In: "query", Type: "string", Default: defaultGapInterval.String(), Description: "Expected collection interval as a Go duration; data older than three intervals is stale"},
+			},
+			Response: StatusResponse{},
+			Handler:  h.handleStatus,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/datasets",
+			Summary:     "Catalog of published extracts and rollups",
+			Description: "Lists the daily CSV and Parquet extracts published by cmd/publish, with their time range, size, URL and SHA-256 checksum, and the rollup resolutions with the range each covers, so pipelines can discover and sync data. The catalog is rebuilt at most every 5 minutes.",
+			Tags:        []string{"meta"},
+			Response:    DatasetsResponse{},
+			Handler:     h.handleDatasets,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stations/{id}/stats",
+			Summary:  "Occupancy statistics for a station",
+			Tags:     []string{"stations"},
+			Access:   accessProtected,
+			Params:   []param{stationIDParam, fromParam, toParam, tzParam},
+			Response: StationStatsResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleStationStats,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stations/{id}/rebalancing",
+			Summary:  "Rebalancing events at a station",
+			Tags:     []string{"stations", "analytics"},
+			Access:   accessProtected,
+			Params:   []param{stationIDParam, fromParam, toParam, thresholdParam},
+			Response: RebalancingResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleRebalancing,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/analytics/flows",
+			Summary:     "Estimated departures and arrivals per station per interval",
+			Description: "Derived from the differences between consecutive snapshots, counting standard bikes and e-bikes separately. Turnover that cancels out between two snapshots is not seen, so counts are lower bounds. Rebalancing jumps are reported separately, and gaps of more than 30 minutes between snapshots are not counted.",
+			Tags:        []string{"analytics"},
+			Access:      accessProtected,
+			Params: []param{
+				fromParam, toParam,
+				{Name: "interval", In: "query", Type: "string", Default: analytics.DefaultFlowInterval.String(), Description: "Bucket width as a Go duration between 5m and 24h, aligned to local midnight"},
+				thresholdParam,
+				{Name: "station", In: "query", Type: "integer", Description: "Only report flows at this station (network totals still cover every station)"},
+				tzParam,
+			},
+			Response: FlowsResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleFlows,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stations/{id}/forecast",
+			Summary:  "Predicted availability for the next hour",
+			Tags:     []string{"stations"},
+			Access:   accessProtected,
+			Params:   []param{stationIDParam, tzParam},
+			Response: ForecastResponse{},
+			Load:     loadAnalytics,
+			Handler:  h.handleStationForecast,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/stations/{id}/reachable",
+			Summary:     "Stations reachable by bike within a time budget",
+			Description: "Lists the stations that can be cycled to from the station within the budget, quickest first, with their latest availability. Riding times are estimated at 15 km/h over streets 1.3 times the straight-line distance, and precomputed for every pair of stations.",
+			Tags:        []string{"stations"},
+			Params: []param{
+				stationIDParam,
+				{Name: "minutes", In: "query", Type: "integer", Default: defaultReachableMinutes, Description: "Time budget in minutes (at most 120)"},
+			},
+			Response: ReachableResponse{},
+			Handler:  h.handleReachableStations,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/plan",
+			Summary:     "Recommended pickup and drop-off stations for a trip",
+			Description: "Ranks the nearest stations to each end of the trip by straight-line walking time (5 km/h) and estimated riding time (15 km/h over streets 1.3 times the straight-line distance), plus a penalty of up to 10 minutes for stations predicted to have fewer than 3 bikes or empty docks when the rider arrives. Predictions use hour-of-week averages over the last week corrected by the latest reading. Responds 404 when no station is within walking distance of an end.",
+			Tags:        []string{"stations"},
+			Access:      accessProtected,
+			Params: []param{
+				{Name: "from", In: "query", Type: "string", Required: true, Description: "Origin as lat,lng"},
+				{Name: "to", In: "query", Type: "string", Required: true, Description: "Destination as lat,lng"},
+				{Name: "walk", In: "query", Type: "integer", Default: defaultPlanWalk, Description: "Furthest walk to or from a station, in metres"},
+				tzParam,
+			},
+			Response: PlanResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handlePlan,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stations/{id}/lifecycle",
+			Summary:  "Install, removal, locked/temporary periods and dock changes for a station",
+			Tags:     []string{"stations"},
+			Params:   []param{stationIDParam},
+			Response: LifecycleResponse{},
+			Handler:  h.handleStationLifecycle,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/analytics/capacity-changes",
+			Summary:     "Dock count expansions and shrinkages, closures and removals across the network",
+			Description: "From the station registry the collector maintains. Closures are periods the feed flagged a station as locked; removals are stations gone from the latest snapshot. Defaults to the last 90 days.",
+			Tags:        []string{"analytics", "stations"},
+			Params: []param{
+				fromParam, toParam,
+				{Name: "kind", In: "query", Type: "string", Description: "Comma-separated kinds to list: expansion, shrinkage, closure, removal"},
+				{Name: "station", In: "query", Type: "integer", Description: "Only list changes at this station"},
+			},
+			Response: CapacityChangesResponse{},
+			Handler:  h.handleCapacityChanges,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/analytics/ebikes",
+			Summary:     "E-bike dynamics compared with standard bikes",
+			Description: "Per station: average docked and arrivals/departures of each bike type, with dwell time approximated as docked bike-time over arrivals. Network-wide: e-bike share by local hour of day, and the stations receiving the smallest share of e-bike arrivals. Defaults to the last 7 days.",
+			Tags:        []string{"analytics"},
+			Access:      accessProtected,
+			Params: []param{
+				fromParam, toParam, topParam, thresholdParam,
+				{Name: "station", In: "query", Type: "integer", Description: "Only list this station (rankings and network figures still cover every station)"},
+				tzParam,
+			},
+			Response: EBikesResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleEBikes,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/analytics/elevation",
+			Summary:     "How elevation relates to stations emptying and filling",
+			Description: "Correlates each station's elevation, recorded in the station registry by a collector run with -elevation, with the share of readings it was empty or full, per station and in elevation bands. Defaults to the last 7 days.",
+			Tags:        []string{"analytics"},
+			Access:      accessProtected,
+			Params: []param{
+				fromParam, toParam, topParam,
+				{Name: "bands", In: "query", Type: "integer", Default: analytics.DefaultElevationBands, Description: "Number of elevation bands of equal station count"},
+				tzParam,
+			},
+			Response: ElevationResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleElevation,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/analytics/broken-docks",
+			Summary:     "Stations whose bikes and free docks do not add up to their docks",
+			Description: "Checks nbBikes + nbEmptyDocks against nbDocks in every reading. Docks out of service count as neither, so stations that chronically fall short likely have broken docks; inServiceDocks is the cleaned dock count of the latest reading. Defaults to the last 7 days.",
+			Tags:        []string{"analytics", "stations"},
+			Access:      accessProtected,
+			Params: []param{
+				fromParam, toParam, topParam,
+				{Name: "station", In: "query", Type: "integer", Description: "Only list this station (chronic rankings and totals still cover every station)"},
+				{Name: "chronic", In: "query", Type: "number", Default: analytics.DefaultChronicShare, Description: "Share of mismatched readings, above 0 and at most 1, from which a station is reported as chronic"},
+				tzParam,
+			},
+			Response: BrokenDocksResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleBrokenDocks,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/analytics/reliability",
+			Summary:     "Share of the time each station had a bike and a free dock, per day",
+			Description: "Computed from the daily rollups (collector -rollups, or cmd/rollup), in the city's time zone. Rollups built before availability was recorded are skipped; rebuild them with cmd/rollup to cover older days.",
+			Tags:        []string{"analytics"},
+			Access:      accessProtected,
+			Params: []param{
+				fromParam, toParam, topParam,
+				{Name: "station", In: "query", Type: "integer", Description: "Only report this station"},
+				{Name: "target", In: "query", Type: "number", Default: defaultReliabilityTarget, Description: "Availability target between 0 and 1; days below it are counted per station"},
+				tzParam,
+			},
+			Response: ReliabilityResponse{},
+			Load:     loadAnalytics,
+			Handler:  h.handleReliability,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/analytics/summary",
+			Summary:  "Network-wide usage summary",
+			Tags:     []string{"analytics"},
+			Access:   accessProtected,
+			Params:   []param{fromParam, toParam, topParam, tzParam},
+			Response: AnalyticsSummaryResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleAnalyticsSummary,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/query",
+			Summary:     "Aggregate station readings grouped by station and time",
+			Description: "Runs a constrained aggregation over stored snapshots. Only the listed aggregates, metrics and dimensions are accepted.",
+			Tags:        []string{"analytics"},
+			Access:      accessProtected,
+			Params: []param{
+				{Name: "select", In: "query", Type: "string", Required: true, Description: "Comma-separated aggregates: count, or sum/avg/min/max of nb_bikes, nb_standard_bikes, nb_ebikes, nb_empty_docks, nb_docks or occupancy, e.g. avg(nb_bikes),count"},
+				{Name: "group_by", In: "query", Type: "string", Description: "Comma-separated dimensions: station, hour, weekday, date (in the tz time zone), area (when areas are configured)"},
+				{Name: "station", In: "query", Type: "string", Description: "Comma-separated station IDs to include"},
+				fromParam, toParam, tzParam,
+				{Name: "order", In: "query", Type: "string", Description: "Output column to sort by; prefix with - for descending"},
+				{Name: "limit", In: "query", Type: "integer", Default: defaultQueryLimit, Description: "Maximum rows returned"},
+			},
+			Response: QueryResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleQuery,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/analytics/rebalancing",
+			Summary: "Rebalancing events across the network",
+			Tags:    []string{"analytics"},
+			Access:  accessProtected,
+			Params: []param{
+				fromParam, toParam, thresholdParam,
+				{Name: "station", In: "query", Type: "integer", Description: "Only report events at this station"},
+			},
+			Response: RebalancingResponse{},
+			Timeout:  longRouteTimeout,
+			Load:     loadAnalytics,
+			Handler:  h.handleRebalancing,
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// staleHeader marks a response served from a cache that is being refreshed, or
+// could not be after a storage error.
+const staleHeader = "X-Data-Stale"
+
+// failedReadTTL is how long a failed or empty storage read is remembered, so
+// that during an outage, or for a window holding no snapshot, requests are
+// answered at once instead of each waiting on the store again.
+const failedReadTTL = 15 * time.Second
+
+// maxFailedReads bounds how many failed reads are remembered. When it is
+// reached the expired ones are dropped, then the one expiring soonest, so
+// requests for ever new keys during an outage cannot grow the map.
+const maxFailedReads = 256
+
+// failedRead is the error a read returned and until when it is reused.
+type failedRead struct {
+	err   error
+	until time.Time
+}
+
+// sharedRead runs read once for the concurrent callers passing the same key,
+// so a burst of identical requests, such as a cold cache's after a deploy,
+// costs one storage read. The read does not stop when the caller that started
+// it goes away, since the others are waiting on it, but each caller stops
+// waiting when its own ctx is done. A read that fails is not retried for
+// failedReadTTL: callers in the meantime get its error.
+func sharedRead[T any](ctx context.Context, h *Handler, key string, read func(context.Context) (T, error)) (T, error) {
+	var zero T
+	if err := h.failedRead(key); err != nil {
+		return zero, err
+	}
+	ch := h.reads.DoChan(key, func() (any, error) {
+		v, err := read(context.WithoutCancel(ctx))
+		if err != nil {
+			h.rememberFailedRead(key, err)
+		}
+		return v, err
+	})
+	select {
+	case res := <-ch:
+		if res.Shared {
+			h.sharedReads.Add(1)
+		}
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// failedRead returns the error of the last read of key if it failed within
+// failedReadTTL.
+func (h *Handler) failedRead(key string) error {
+	h.failedReadsMu.Lock()
+	defer h.failedReadsMu.Unlock()
+	f, ok := h.failedReads[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(f.until) {
+		delete(h.failedReads, key)
+		return nil
+	}
+	return f.err
+}
+
+// rememberFailedRead records that the read of key failed with err.
+func (h *Handler) rememberFailedRead(key string, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		slog.Warn("Storage read failed, reusing its error until retried", "key", key, "retryAfter", failedReadTTL, "error", err)
+	}
+
+	now := time.Now()
+	h.failedReadsMu.Lock()
+	defer h.failedReadsMu.Unlock()
+	if h.failedReads == nil {
+		h.failedReads = make(map[string]failedRead)
+	}
+	if _, ok := h.failedReads[key]; !ok && len(h.failedReads) >= maxFailedReads {
+		for k, f := range h.failedReads {
+			if now.After(f.until) {
+				delete(h.failedReads, k)
+			}
+		}
+		if len(h.failedReads) >= maxFailedReads {
+			var oldest string
+			for k, f := range h.failedReads {
+				if oldest == "" || f.until.Before(h.failedReads[oldest].until) {
+					oldest = k
+				}
+			}
+			delete(h.failedReads, oldest)
+		}
+	}
+	h.failedReads[key] = failedRead{err: err, until: now.Add(failedReadTTL)}
+}
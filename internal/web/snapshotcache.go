@@ -0,0 +1,160 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"city-cycling/internal/cache"
+	"city-cycling/internal/storage"
+	"city-cycling/internal/tfl"
+)
+
+// Default snapshot cache bounds: a full London snapshot is roughly 100 KB
+// encoded, so this holds a few hours of 5-minute snapshots for the time slider.
+const (
+	DefaultSnapshotCacheEntries = 256
+	DefaultSnapshotCacheBytes   = 64 << 20
+)
+
+// snapshotKeyPrefix namespaces cached snapshots from the history aggregate,
+// which shares the cache when it is shared between replicas.
+const snapshotKeyPrefix = "snapshot:"
+
+// cachedSnapshot returns the snapshot cached under key. A cache that fails is
+// treated as a miss, so a Redis outage only costs store reads.
+func (h *Handler) cachedSnapshot(ctx context.Context, key string) ([]tfl.Station, bool) {
+	data, err := h.snapshotCache.Get(ctx, snapshotKeyPrefix+key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			slog.Warn("Failed to read snapshot cache", "key", key, "error", err)
+		}
+		return nil, false
+	}
+	var stations []tfl.Station
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stations); err != nil {
+		slog.Warn("Failed to decode cached snapshot", "key", key, "error", err)
+		return nil, false
+	}
+	return stations, true
+}
+
+// cacheSnapshot caches stations under key.
+func (h *Handler) cacheSnapshot(ctx context.Context, key string, stations []tfl.Station) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(stations); err != nil {
+		slog.Error("Failed to encode snapshot for the cache", "key", key, "error", err)
+		return
+	}
+	if err := h.snapshotCache.Set(ctx, snapshotKeyPrefix+key, buf.Bytes(), h.snapshotCacheTTL); err != nil {
+		slog.Warn("Failed to write snapshot cache", "key", key, "error", err)
+	}
+}
+
+// readSnapshot reads the snapshot closest to t from store and caches it under
+// t, once for every request waiting on it.
+func (h *Handler) readSnapshot(ctx context.Context, store storage.HistoricalDataStore, t time.Time) ([]tfl.Station, error) {
+	key := t.UTC().Format(time.RFC3339)
+	return sharedRead(ctx, h, snapshotKeyPrefix+key, func(ctx context.Context) ([]tfl.Station, error) {
+		stations, err := store.GetSnapshotByTimestamp(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		h.cacheSnapshot(ctx, key, stations)
+		slog.Info("Snapshot cache updated", "timestamp", key, "stations", len(stations))
+		return stations, nil
+	})
+}
+
+// SetSnapshotCacheLimits bounds the in-memory cache of historical snapshots
+// served by /history/snapshot to maxEntries snapshots and maxBytes of encoded
+// station data; a bound <= 0 is not enforced. It drops any cached snapshots
+// and replaces a cache set with SetSharedCache.
+func (h *Handler) SetSnapshotCacheLimits(maxEntries int, maxBytes int64) {
+	h.snapshotCache = cache.NewMemory(maxEntries, maxBytes)
+	h.snapshotCacheTTL = 0
+	h.sharedCache = nil
+}
+
+// SetSharedCache caches historical snapshots in c, each for ttl (<= 0: until
+// evicted), and shares the /history aggregate through it, so that replicas
+// using the same c download each snapshot and new part of the archive once. c
+// must be this handler's own, e.g. a Redis cache with a per-city prefix.
+func (h *Handler) SetSharedCache(c cache.Cache, ttl time.Duration) {
+	h.snapshotCache = c
+	h.snapshotCacheTTL = ttl
+	h.sharedCache = c
+}
+
+// MetricsHandler serves the snapshot cache and shared read metrics of hs in
+// the Prometheus format. With several handlers, each series is labelled with
+// its city. The load shedding metrics of the first handler, whose limits the
+// others share, are served unlabelled.
+func MetricsHandler(hs ...*Handler) http.Handler {
+	registry := prometheus.NewRegistry()
+	registerMetrics(registry, hs, len(hs) > 1)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// TenantMetricsHandler is MetricsHandler for a multi-tenant server, given
+// each tenant's handlers by tenant ID. Every series is labelled with its
+// tenant and city, even for a tenant of one city, so that all tenants' series
+// have the same labels.
+func TenantMetricsHandler(tenants map[string][]*Handler) http.Handler {
+	registry := prometheus.NewRegistry()
+	for id, hs := range tenants {
+		registerMetrics(prometheus.WrapRegistererWith(prometheus.Labels{"tenant": id}, registry), hs, true)
+	}
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// registerMetrics registers the metrics served by MetricsHandler for hs,
+// labelling each handler's series with its city when byCity is set.
+func registerMetrics(registry prometheus.Registerer, hs []*Handler, byCity bool) {
+	for _, h := range hs {
+		var reg prometheus.Registerer = registry
+		if byCity {
+			reg = prometheus.WrapRegistererWith(prometheus.Labels{"city": h.city.ID}, registry)
+		}
+		// Read the cache through h, which SetSnapshotCacheLimits may replace
+		stat := func(f func(cache.Stats) float64) func() float64 {
+			return func() float64 { return f(h.snapshotCache.Stats()) }
+		}
+		reg.MustRegister(
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "server_snapshot_cache_hits_total",
+				Help: "Historical snapshot requests served from the cache.",
+			}, stat(func(s cache.Stats) float64 { return float64(s.Hits) })),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "server_snapshot_cache_misses_total",
+				Help: "Historical snapshot requests that had to read the store.",
+			}, stat(func(s cache.Stats) float64 { return float64(s.Misses) })),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "server_snapshot_cache_evictions_total",
+				Help: "Snapshots evicted from the cache to stay within its bounds.",
+			}, stat(func(s cache.Stats) float64 { return float64(s.Evictions) })),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "server_snapshot_cache_entries",
+				Help: "Snapshots currently cached (0 with a shared cache).",
+			}, stat(func(s cache.Stats) float64 { return float64(s.Entries) })),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "server_snapshot_cache_bytes",
+				Help: "Encoded size of the cached snapshots (0 with a shared cache).",
+			}, stat(func(s cache.Stats) float64 { return float64(s.Bytes) })),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "server_shared_reads_total",
+				Help: "Snapshot and history requests that shared one storage read with concurrent identical requests.",
+			}, func() float64 { return float64(h.sharedReads.Load()) }),
+		)
+	}
+	if len(hs) > 0 {
+		registerLoadMetrics(registry, hs[0])
+	}
+}
@@ -0,0 +1,436 @@
+// API prefix of the city this page shows, injected by the page template
+const { apiBase, fitToStations } = mapConfig;
+
+// State management
+let allHistory = [];
+let markers = {};
+let snapshotAbortController = null;
+let snapshotCache = {}; // Cache for snapshot data
+let isPlaying = false;
+let playbackInterval = null;
+let currentStations = []; // Current station data for smooth updates
+
+// Initialize map centered on London
+const map = L.map('map').setView([51.505, -0.09], 13);
+
+// Add OpenStreetMap tiles
+L.tileLayer('https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png', {
+    attribution: '&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors'
+}).addTo(map);
+
+// Determine marker color based on bike availability
+function getMarkerColor(station) {
+    const ratio = station.nbBikes / station.nbDocks;
+    if (ratio === 0) return '#F44336'; // Red - empty
+    if (ratio < 0.25) return '#FFC107'; // Yellow - low
+    return '#4CAF50'; // Green - available
+}
+
+// Get highlight color based on change in bikes
+function getChangeHighlight(oldBikes, newBikes) {
+    const change = newBikes - oldBikes;
+    if (change > 5) return { borderColor: '#4CAF50', borderWidth: 3 }; // Green - increased
+    if (change < -5) return { borderColor: '#F44336', borderWidth: 3 }; // Red - decreased
+    return null; // No significant change
+}
+
+// Create a circle marker for a station
+function createMarker(station, comparison = null) {
+    const color = getMarkerColor(station);
+    const markerOptions = {
+        radius: 8,
+        fillColor: color,
+        color: '#fff',
+        weight: 2,
+        opacity: 1,
+        fillOpacity: 0.8
+    };
+
+    // Apply change highlight if provided
+    if (comparison && comparison.oldBikes !== undefined) {
+        const highlight = getChangeHighlight(comparison.oldBikes, station.nbBikes);
+        if (highlight) {
+            markerOptions.color = highlight.borderColor;
+            markerOptions.weight = highlight.borderWidth;
+        }
+    }
+
+    const marker = L.circleMarker([station.lat, station.lng], markerOptions);
+    marker.stationData = station; // Store station data for updates
+
+    updateMarkerPopup(marker, station, comparison);
+
+    return marker;
+}
+
+// Update marker popup content
+function updateMarkerPopup(marker, station, comparison = null) {
+    let popupContent = `
+        <div class="popup-content">
+            <h4>${station.name}</h4>
+            <div class="stat">
+                <span>Standard bikes:</span>
+                <span class="stat-value bikes-standard">${station.nbStandardBikes}</span>
+            </div>
+            <div class="stat">
+                <span>E-bikes:</span>
+                <span class="stat-value bikes-ebike">${station.nbEBikes}</span>
+            </div>
+            <div class="stat">
+                <span>Empty docks:</span>
+                <span class="stat-value docks-empty">${station.nbEmptyDocks}</span>
+            </div>
+            <div class="stat">
+                <span>Total capacity:</span>
+                <span class="stat-value">${station.nbDocks}</span>
+            </div>
+    `;
+
+    if (station.emptyDocksAdjusted) {
+        popupContent += `
+            <div class="stat">
+                <span>Usable empty docks:</span>
+                <span class="stat-value docks-empty">${station.adjustedEmptyDocks}</span>
+            </div>
+            <div class="change">
+                <span>${station.presumedBrokenDocks} docks presumed broken</span>
+            </div>
+        `;
+    }
+
+    if (comparison && comparison.oldBikes !== undefined) {
+        const bikeDiff = station.nbBikes - comparison.oldBikes;
+        const diffClass = bikeDiff >= 0 ? 'change-positive' : 'change-negative';
+        const sign = bikeDiff >= 0 ? '+' : '';
+        popupContent += `
+            <div class="change">
+                <span>Change since last period:</span>
+                <span class="${diffClass}">${sign}${bikeDiff}</span>
+            </div>
+        `;
+    }
+
+    popupContent += '</div>';
+    marker.bindPopup(popupContent);
+}
+
+// Update existing marker with new station data (smooth transition)
+function updateMarker(marker, station, comparison = null) {
+    const color = getMarkerColor(station);
+    const styleOptions = {
+        fillColor: color,
+        color: '#fff',
+        weight: 2
+    };
+
+    // Apply change highlight if provided
+    if (comparison && comparison.oldBikes !== undefined) {
+        const highlight = getChangeHighlight(comparison.oldBikes, station.nbBikes);
+        if (highlight) {
+            styleOptions.color = highlight.borderColor;
+            styleOptions.weight = highlight.borderWidth;
+        }
+    }
+
+    marker.setStyle(styleOptions);
+    marker.stationData = station;
+    updateMarkerPopup(marker, station, comparison);
+}
+
+// Format timestamp for display
+function formatTime(timestamp) {
+    const date = new Date(timestamp);
+    return date.toLocaleString([], {
+        month: '2-digit',
+        day: '2-digit',
+        hour: '2-digit',
+        minute: '2-digit'
+    });
+}
+
+// Load historical data
+async function loadHistoricalData() {
+    try {
+        const response = await fetch(`${apiBase}/history`);
+        if (!response.ok) {
+            console.error('Failed to load history:', response.status);
+            return;
+        }
+
+        const data = await response.json();
+        if (!data.dataPoints || data.dataPoints.length < 1) {
+            console.log('No historical data points available');
+            return;
+        }
+
+        // Reverse so oldest is at index 0 (left) and newest at max (right)
+        allHistory = data.dataPoints.reverse();
+
+        // Setup slider: left = oldest, right = latest
+        const slider = document.getElementById('time-slider');
+        slider.max = allHistory.length - 1;
+        slider.value = allHistory.length - 1; // Start at latest (rightmost)
+
+        // Update UI
+        document.getElementById('time-controls').style.display = 'block';
+
+        updateTimeDisplay();
+        slider.addEventListener('input', () => {
+            stopPlayback(); // Stop playback when user manually moves slider
+            updateView();
+        });
+
+        // Playback control listeners
+        document.getElementById('play-btn').addEventListener('click', togglePlayback);
+        document.getElementById('speed-select').addEventListener('change', onSpeedChange);
+
+        // Initial view - load latest
+        updateView();
+    } catch (error) {
+        console.error('Failed to load historical data:', error);
+    }
+}
+
+// Update time display in slider
+function updateTimeDisplay() {
+    const slider = document.getElementById('time-slider');
+    const index = parseInt(slider.value);
+
+    if (allHistory.length === 0) return;
+
+    const currentData = allHistory[index];
+
+    document.getElementById('time-end-display').textContent = formatTime(currentData.timestamp);
+    document.getElementById('time-range-label').textContent = `${index + 1} / ${allHistory.length}`;
+}
+
+// Fetch snapshot data with caching
+async function fetchSnapshot(timestamp, signal = null) {
+    const cacheKey = timestamp;
+    if (snapshotCache[cacheKey]) {
+        return snapshotCache[cacheKey];
+    }
+
+    const fetchOptions = signal ? { signal } : {};
+    const response = await fetch(
+        `${apiBase}/history/snapshot?timestamp=${encodeURIComponent(timestamp)}`,
+        fetchOptions
+    );
+
+    if (!response.ok) {
+        throw new Error(`Failed to load snapshot: ${response.status}`);
+    }
+
+    const data = await response.json();
+    snapshotCache[cacheKey] = data.stations || [];
+    return snapshotCache[cacheKey];
+}
+
+// Pre-fetch next snapshot for smoother playback
+function prefetchNextSnapshot(currentIndex) {
+    if (currentIndex < allHistory.length - 1) {
+        const nextData = allHistory[currentIndex + 1];
+        const timestamp = new Date(nextData.timestamp).toISOString();
+        // Fire and forget - don't await
+        fetchSnapshot(timestamp).catch(() => {});
+    }
+}
+
+// Update map view based on slider position
+async function updateView() {
+    updateTimeDisplay();
+
+    const slider = document.getElementById('time-slider');
+    const index = parseInt(slider.value);
+
+    if (allHistory.length === 0) return;
+
+    // Abort any pending snapshot request
+    if (snapshotAbortController) {
+        snapshotAbortController.abort();
+    }
+    snapshotAbortController = new AbortController();
+
+    const indicator = document.getElementById('loading-indicator');
+    indicator.style.display = 'inline';
+
+    try {
+        const currentData = allHistory[index];
+        const timestamp = new Date(currentData.timestamp).toISOString();
+
+        // Fetch station data (uses cache if available)
+        const stations = await fetchSnapshot(timestamp, snapshotAbortController.signal);
+
+        // Build lookup of previous station data for comparison
+        const previousStations = {};
+        currentStations.forEach(s => {
+            previousStations[s.id] = s;
+        });
+
+        // Update info panel
+        document.getElementById('last-update').textContent =
+            `${formatTime(currentData.timestamp)} (${currentData.totalBikes} bikes available)`;
+
+        // Update or create markers with smooth transitions
+        const updatedIds = new Set();
+        stations.forEach(station => {
+            const comparison = previousStations[station.id]
+                ? { oldBikes: previousStations[station.id].nbBikes }
+                : null;
+
+            if (markers[station.id]) {
+                // Update existing marker (smooth transition via CSS)
+                updateMarker(markers[station.id], station, comparison);
+            } else {
+                // Create new marker
+                const marker = createMarker(station, comparison);
+                marker.addTo(map);
+                markers[station.id] = marker;
+            }
+            updatedIds.add(station.id);
+        });
+
+        // Remove markers that no longer exist in this snapshot
+        Object.keys(markers).forEach(id => {
+            if (!updatedIds.has(parseInt(id))) {
+                map.removeLayer(markers[id]);
+                delete markers[id];
+            }
+        });
+
+        // Store current stations for next comparison
+        currentStations = stations;
+
+        // Pre-fetch next snapshot during playback
+        if (isPlaying) {
+            prefetchNextSnapshot(index);
+        }
+
+        console.log(`Updated ${stations.length} stations for ${formatTime(currentData.timestamp)}`);
+    } catch (error) {
+        if (error.name === 'AbortError') {
+            console.log('Snapshot request aborted');
+            return;
+        }
+        console.error('Failed to load snapshot data:', error);
+        document.getElementById('last-update').textContent = 'Failed to load snapshot data';
+    } finally {
+        indicator.style.display = 'none';
+    }
+}
+
+// Playback controls
+function startPlayback() {
+    if (allHistory.length === 0) return;
+
+    const slider = document.getElementById('time-slider');
+    const speedSelect = document.getElementById('speed-select');
+    const interval = parseInt(speedSelect.value);
+
+    // If at the end, restart from beginning
+    if (parseInt(slider.value) >= allHistory.length - 1) {
+        slider.value = 0;
+    }
+
+    isPlaying = true;
+    updatePlaybackUI();
+
+    // Pre-fetch first few snapshots
+    for (let i = 0; i < 3 && i < allHistory.length; i++) {
+        const data = allHistory[parseInt(slider.value) + i];
+        if (data) {
+            fetchSnapshot(new Date(data.timestamp).toISOString()).catch(() => {});
+        }
+    }
+
+    playbackInterval = setInterval(() => {
+        const currentValue = parseInt(slider.value);
+        if (currentValue >= allHistory.length - 1) {
+            stopPlayback();
+            return;
+        }
+        slider.value = currentValue + 1;
+        updateView();
+    }, interval);
+}
+
+function stopPlayback() {
+    isPlaying = false;
+    if (playbackInterval) {
+        clearInterval(playbackInterval);
+        playbackInterval = null;
+    }
+    updatePlaybackUI();
+}
+
+function togglePlayback() {
+    if (isPlaying) {
+        stopPlayback();
+    } else {
+        startPlayback();
+    }
+}
+
+function updatePlaybackUI() {
+    const playIcon = document.getElementById('play-icon');
+    const playbackStatus = document.getElementById('playback-status');
+
+    if (isPlaying) {
+        playIcon.innerHTML = '&#10074;&#10074;'; // Pause icon
+        playbackStatus.textContent = 'Playing...';
+    } else {
+        playIcon.innerHTML = '&#9658;'; // Play icon
+        playbackStatus.textContent = '';
+    }
+}
+
+function onSpeedChange() {
+    if (isPlaying) {
+        stopPlayback();
+        startPlayback();
+    }
+}
+
+// Fetch and display latest stations initially
+async function loadLatestStations() {
+    try {
+        // The page inlines the latest snapshot; fetch it only if it is missing
+        let data = mapConfig.initialStations;
+        if (!data) {
+            const response = await fetch(`${apiBase}/stations`);
+            data = await response.json();
+        }
+
+        // Update timestamp display
+        if (data.timestamp) {
+            const date = new Date(data.timestamp);
+            document.getElementById('last-update').textContent =
+                `Updated: ${date.toLocaleString()}`;
+        }
+
+        // Add markers for all stations
+        data.stations.forEach(station => {
+            const marker = createMarker(station);
+            marker.addTo(map);
+            markers[station.id] = marker;
+        });
+
+        if (fitToStations && data.stations.length > 0) {
+            map.fitBounds(data.stations.map(s => [s.lat, s.lng]));
+        }
+
+        console.log(`Loaded ${data.stations.length} stations`);
+    } catch (error) {
+        console.error('Failed to load stations:', error);
+        document.getElementById('last-update').textContent = 'Failed to load data';
+    }
+}
+
+// Initialize
+async function initialize() {
+    await loadLatestStations();
+    await loadHistoricalData();
+}
+
+// Load on page load
+initialize();
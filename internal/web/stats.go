@@ -0,0 +1,80 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"city-cycling/internal/storage"
+)
+
+// defaultStatsWindow is the window used when a stats request has no from parameter.
+const defaultStatsWindow = 7 * 24 * time.Hour
+
+// StationStatsResponse is the JSON response for the station stats API.
+type StationStatsResponse struct {
+	StationID     int         `json:"stationId"`
+	From          string      `json:"from"`
+	To            string      `json:"to"`
+	SampleCount   int         `json:"sampleCount"`
+	OccupancyRate float64     `json:"occupancyRate"`
+	PctEmpty      float64     `json:"pctEmpty"`
+	PctFull       float64     `json:"pctFull"`
+	AvgBikes      float64     `json:"avgBikes"`
+	AvgByHour     [24]float64 `json:"avgBikesByHour"`
+	AvgByWeekday  [7]float64  `json:"avgBikesByWeekday"`
+}
+
+// handleStationStats serves occupancy statistics for a single station.
+func (h *Handler) handleStationStats(w http.ResponseWriter, r *http.Request) {
+	stationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid station id", http.StatusBadRequest)
+		return
+	}
+
+	rangeStore, ok := h.store.(storage.RangeDataStore)
+	if !ok {
+		httpError(w, r, "Station statistics not available with current storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultStatsWindow)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := h.parseLocation(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samples, err := storage.StationSeries(r.Context(), rangeStore, stationID, from, to)
+	if err != nil {
+		slog.Error("Failed to build station series", "station", stationID, "error", err)
+		httpError(w, r, "Failed to compute station statistics", http.StatusInternalServerError)
+		return
+	}
+	if len(samples) == 0 {
+		httpError(w, r, "No data for station in requested window", http.StatusNotFound)
+		return
+	}
+
+	stats := storage.ComputeStationStats(stationID, from, to, samples, loc)
+	response := StationStatsResponse{
+		StationID:     stats.StationID,
+		From:          formatTime(stats.From, loc),
+		To:            formatTime(stats.To, loc),
+		SampleCount:   stats.SampleCount,
+		OccupancyRate: stats.OccupancyRate,
+		PctEmpty:      stats.PctEmpty,
+		PctFull:       stats.PctFull,
+		AvgBikes:      stats.AvgBikes,
+		AvgByHour:     stats.AvgByHour,
+		AvgByWeekday:  stats.AvgByWeekday,
+	}
+
+	writeJSON(w, response)
+}
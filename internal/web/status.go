@@ -0,0 +1,285 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"city-cycling/internal/collector"
+	"city-cycling/internal/storage"
+)
+
+const (
+	// statusCacheTTL bounds how often the status endpoints list the store,
+	// which for a bucket means paging through every snapshot key.
+	statusCacheTTL = 30 * time.Second
+	// statusStaleIntervals is how many collection intervals the newest
+	// snapshot may be behind before the data counts as stale.
+	statusStaleIntervals = 3
+	// statusGapWindow is how far back the status reports data gaps.
+	statusGapWindow = 24 * time.Hour
+)
+
+// Overall states reported by the status endpoints.
+const (
+	statusOK    = "ok"
+	statusStale = "stale"
+	statusEmpty = "empty"
+)
+
+// CollectorStatus describes the last successful collection.
+type CollectorStatus struct {
+	LastSuccess string `json:"lastSuccess,omitempty"`
+	// AgeSeconds is -1 when no collection is known.
+	AgeSeconds float64 `json:"ageSeconds"`
+	// Source is "heartbeat" when read from a collector's heartbeat object
+	// (-heartbeat-object), or "snapshot" when inferred from the newest snapshot.
+	Source  string `json:"source,omitempty"`
+	Replica string `json:"replica,omitempty"`
+}
+
+// SnapshotStatus summarizes the stored snapshots.
+type SnapshotStatus struct {
+	Count  int    `json:"count"`
+	Oldest string `json:"oldest,omitempty"`
+	Newest string `json:"newest,omitempty"`
+}
+
+// StatusGapsResponse lists the data gaps of the last 24 hours.
+type StatusGapsResponse struct {
+	ExpectedInterval string        `json:"expectedInterval"`
+	MissingCount     int           `json:"missingCount"`
+	Gaps             []GapResponse `json:"gaps"`
+}
+
+// SnapshotCacheStatus reports the historical snapshot cache. Entries and Bytes
+// are 0 for a shared (Redis) cache, and the counters cover this server only.
+type SnapshotCacheStatus struct {
+	Backend   string `json:"backend"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// HistoryCacheStatus reports the aggregate history cache.
+type HistoryCacheStatus struct {
+	DataPoints int    `json:"dataPoints"`
+	UpdatedAt  string `json:"updatedAt,omitempty"`
+}
+
+// CacheStatus reports the server's caches.
+type CacheStatus struct {
+	Snapshots SnapshotCacheStatus `json:"snapshots"`
+	History   HistoryCacheStatus  `json:"history"`
+}
+
+// StatusResponse is the JSON response for the status API.
+type StatusResponse struct {
+	// Status is "ok", "stale" when the newest snapshot is more than three
+	// collection intervals old, or "empty" when nothing is stored.
+	Status      string             `json:"status"`
+	City        string             `json:"city"`
+	Storage     string             `json:"storage"`
+	GeneratedAt string             `json:"generatedAt"`
+	Collector   CollectorStatus    `json:"collector"`
+	Snapshots   SnapshotStatus     `json:"snapshots"`
+	Gaps        StatusGapsResponse `json:"gaps24h"`
+	Caches      CacheStatus        `json:"caches"`
+}
+
+// statusCacheEntry is a recently built status report.
+type statusCacheEntry struct {
+	interval time.Duration
+	built    time.Time
+	response StatusResponse
+}
+
+// statusPage is the data for the status page template.
+type statusPage struct {
+	StatusResponse
+	Title   string
+	APIPath string
+	// Human-readable ages of the last collection and newest snapshot
+	CollectorAge string
+	NewestAge    string
+}
+
+// handleStatus reports whether the data is current, for users and uptime
+// monitors alike.
+func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	interval, err := parseStatusInterval(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status, err := h.status(context.WithoutCancel(r.Context()), interval)
+	if err != nil {
+		slog.Error("Failed to build status", "error", err)
+		httpError(w, r, "Failed to build status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(statusCacheTTL.Seconds())))
+	writeJSON(w, status)
+}
+
+// handleStatusPage serves the HTML status page for the routes mounted at mount.
+func (h *Handler) handleStatusPage(mount string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		interval, err := parseStatusInterval(r)
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, err := h.status(context.WithoutCancel(r.Context()), interval)
+		if err != nil {
+			slog.Error("Failed to build status", "error", err)
+			httpError(w, r, "Failed to build status", http.StatusInternalServerError)
+			return
+		}
+
+		page := statusPage{
+			StatusResponse: status,
+			Title:          h.city.Name + " status",
+			APIPath:        basePath(r.Context()) + apiRoot + "/" + currentAPIVersion + mount + "/status",
+			CollectorAge:   formatAge(status.Collector.LastSuccess),
+			NewestAge:      formatAge(status.Snapshots.Newest),
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := h.templates.ExecuteTemplate(w, "status.html", page); err != nil {
+			slog.Error("Template error", "error", err)
+			httpError(w, r, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseStatusInterval reads the expected collection interval from the request.
+func parseStatusInterval(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("interval")
+	if v == "" {
+		return defaultGapInterval, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, errInvalidParam("interval")
+	}
+	return d, nil
+}
+
+// status returns the status report for interval, rebuilding it at most once
+// every statusCacheTTL.
+func (h *Handler) status(ctx context.Context, interval time.Duration) (StatusResponse, error) {
+	h.statusMu.Lock()
+	defer h.statusMu.Unlock()
+	if c := h.statusCache; c != nil && c.interval == interval && time.Since(c.built) < statusCacheTTL {
+		return c.response, nil
+	}
+
+	response, err := h.buildStatus(ctx, interval)
+	if err != nil {
+		return StatusResponse{}, err
+	}
+	h.statusCache = &statusCacheEntry{interval: interval, built: time.Now(), response: response}
+	return response, nil
+}
+
+// buildStatus assembles a status report from the store and the caches.
+func (h *Handler) buildStatus(ctx context.Context, interval time.Duration) (StatusResponse, error) {
+	now := time.Now().UTC()
+	timestamps, err := h.store.ListAvailableTimestamps(ctx)
+	if err != nil {
+		return StatusResponse{}, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	report := storage.FindGaps(timestamps, interval)
+
+	response := StatusResponse{
+		Status:      statusOK,
+		City:        h.city.ID,
+		Storage:     storage.BackendName(h.store),
+		GeneratedAt: now.Format(time.RFC3339),
+		Collector:   CollectorStatus{AgeSeconds: -1},
+		Snapshots:   SnapshotStatus{Count: report.SnapshotCount},
+		Gaps: StatusGapsResponse{
+			ExpectedInterval: interval.String(),
+			Gaps:             []GapResponse{},
+		},
+	}
+
+	if report.SnapshotCount == 0 {
+		response.Status = statusEmpty
+	} else {
+		response.Snapshots.Oldest = report.First.UTC().Format(time.RFC3339)
+		response.Snapshots.Newest = report.Last.UTC().Format(time.RFC3339)
+		if now.Sub(report.Last) > statusStaleIntervals*interval {
+			response.Status = statusStale
+		}
+		response.Collector = CollectorStatus{
+			LastSuccess: response.Snapshots.Newest,
+			AgeSeconds:  now.Sub(report.Last).Seconds(),
+			Source:      "snapshot",
+		}
+	}
+
+	// A heartbeat also counts collections whose snapshot has not been listed yet
+	if objects, ok := h.store.(storage.ObjectStore); ok {
+		hb, err := collector.ReadHeartbeat(ctx, objects)
+		switch {
+		case err == nil:
+			if response.Collector.Source == "" || !hb.Time.Before(report.Last) {
+				response.Collector = CollectorStatus{
+					LastSuccess: hb.Time.UTC().Format(time.RFC3339),
+					AgeSeconds:  now.Sub(hb.Time).Seconds(),
+					Source:      "heartbeat",
+					Replica:     hb.Replica,
+				}
+			}
+		case !errors.Is(err, storage.ErrNotFound):
+			slog.Warn("Failed to read collector heartbeat", "error", err)
+		}
+	}
+
+	windowStart := now.Add(-statusGapWindow)
+	for _, g := range report.Gaps {
+		if g.End.Before(windowStart) {
+			continue
+		}
+		response.Gaps.MissingCount += g.Missing
+		response.Gaps.Gaps = append(response.Gaps.Gaps, GapResponse{
+			Start:           g.Start.UTC().Format(time.RFC3339),
+			End:             g.End.UTC().Format(time.RFC3339),
+			DurationMinutes: g.Duration.Minutes(),
+			Missing:         g.Missing,
+		})
+	}
+
+	stats := h.snapshotCache.Stats()
+	response.Caches.Snapshots = SnapshotCacheStatus{
+		Backend:   stats.Backend,
+		Entries:   stats.Entries,
+		Bytes:     stats.Bytes,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+	}
+	h.historyCacheMu.RLock()
+	response.Caches.History.DataPoints = len(h.historyCache)
+	if !h.historyCacheTime.IsZero() {
+		response.Caches.History.UpdatedAt = h.historyCacheTime.UTC().Format(time.RFC3339)
+	}
+	h.historyCacheMu.RUnlock()
+
+	return response, nil
+}
+
+// formatAge renders the age of an RFC 3339 time for display, e.g. "4m12s ago".
+func formatAge(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return "never"
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"city-cycling/internal/tenant"
+)
+
+// tenantKey is the context key of the tenant a request was routed to.
+type tenantKey struct{}
+
+// tenantRoute records how a request reached its tenant.
+type tenantRoute struct {
+	id string
+	// prefix is the path prefix the router stripped, /{id}, or "" when the
+	// tenant was selected by host name.
+	prefix string
+}
+
+// requestTenant returns the tenant a request was routed to, or "" outside a
+// multi-tenant server.
+func requestTenant(ctx context.Context) string {
+	route, _ := ctx.Value(tenantKey{}).(tenantRoute)
+	return route.id
+}
+
+// basePath returns the path prefix the request's routes are served under,
+// which links to them must start with: /{tenant} for a tenant selected by
+// path, and "" otherwise.
+func basePath(ctx context.Context) string {
+	route, _ := ctx.Value(tenantKey{}).(tenantRoute)
+	return route.prefix
+}
+
+// TenantRouter dispatches requests between the servers of a multi-tenant
+// deployment: by host name first, then by the first path segment, /{id}/...,
+// which it strips so each tenant's routes are the same as a single
+// deployment's.
+type TenantRouter struct {
+	byID   map[string]http.Handler
+	byHost map[string]string
+	// first serves the static assets, which are the same for every tenant and
+	// referenced by absolute path.
+	first http.Handler
+}
+
+// NewTenantRouter creates a router with no tenants.
+func NewTenantRouter() *TenantRouter {
+	return &TenantRouter{byID: make(map[string]http.Handler), byHost: make(map[string]string)}
+}
+
+// Add routes requests for tenant id, and for its host names, to next.
+func (tr *TenantRouter) Add(id string, hosts []string, next http.Handler) {
+	tr.byID[id] = next
+	for _, host := range hosts {
+		tr.byHost[tenant.NormalizeHost(host)] = id
+	}
+	if tr.first == nil {
+		tr.first = next
+	}
+}
+
+// ServeHTTP routes r to its tenant, or replies 404 when it names none.
+func (tr *TenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if id, ok := tr.byHost[tenant.NormalizeHost(r.Host)]; ok {
+		ctx := context.WithValue(r.Context(), tenantKey{}, tenantRoute{id: id})
+		tr.byID[id].ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, staticPrefix) && tr.first != nil {
+		tr.first.ServeHTTP(w, r)
+		return
+	}
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	next, ok := tr.byID[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	prefix := "/" + id
+	if rest == "" && !strings.HasSuffix(r.URL.Path, "/") {
+		// The tenant's map page is at /{id}/
+		http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+	ctx := context.WithValue(r.Context(), tenantKey{}, tenantRoute{id: id, prefix: prefix})
+	http.StripPrefix(prefix, next).ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"city-cycling/internal/geo"
+)
+
+// Tile cache bounds: a city-wide tile of 800 stations is about 60 KB, and
+// tiles at street zooms hold a few stations each.
+const (
+	tileCacheEntries = 1024
+	tileCacheBytes   = 16 << 20
+)
+
+// mvtContentType is the media type of Mapbox Vector Tiles.
+const mvtContentType = "application/vnd.mapbox-vector-tile"
+
+// handleStationTile serves the latest snapshot's stations in a Mapbox Vector
+// Tile, or 204 No Content when the tile has none. Tiles are cached until the
+// next snapshot.
+func (h *Handler) handleStationTile(w http.ResponseWriter, r *http.Request) {
+	z, x, y, err := parseTileCoords(r.PathValue("z"), r.PathValue("x"), r.PathValue("y"))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stations, timestamp, err := h.latestSnapshot(r.Context())
+	if err != nil {
+		slog.Error("Failed to read latest snapshot", "error", err)
+		httpError(w, r, "Failed to fetch station data", http.StatusInternalServerError)
+		return
+	}
+	name := fmt.Sprintf("tile-%d/%d/%d", z, x, y)
+	if checkETag(w, r, snapshotETag(name, timestamp, len(stations))) {
+		return
+	}
+
+	// Keyed by snapshot, so tiles of older snapshots age out of the cache
+	key := fmt.Sprintf("%s@%d", name, timestamp.Unix())
+	tile, err := h.tileCache.Get(r.Context(), key)
+	if err != nil {
+		tile = geo.StationTile(stations, z, x, y)
+		if err := h.tileCache.Set(context.WithoutCancel(r.Context()), key, tile, 0); err != nil {
+			slog.Warn("Failed to cache tile", "tile", name, "error", err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if len(tile) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", mvtContentType)
+	if _, err := w.Write(tile); err != nil {
+		slog.Debug("Failed to write tile", "tile", name, "error", err)
+	}
+}
+
+// parseTileCoords parses the z, x and y path segments of a tile request, y
+// ending in .mvt.
+func parseTileCoords(zs, xs, ys string) (z, x, y int, err error) {
+	ys, ok := strings.CutSuffix(ys, ".mvt")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Invalid tile (use /tiles/{z}/{x}/{y}.mvt)")
+	}
+	z, err = strconv.Atoi(zs)
+	if err != nil || z < 0 || z > geo.MaxZoom {
+		return 0, 0, 0, fmt.Errorf("Invalid tile zoom")
+	}
+	n := 1 << z
+	x, err = strconv.Atoi(xs)
+	if err != nil || x < 0 || x >= n {
+		return 0, 0, 0, fmt.Errorf("Invalid tile column")
+	}
+	y, err = strconv.Atoi(ys)
+	if err != nil || y < 0 || y >= n {
+		return 0, 0, 0, fmt.Errorf("Invalid tile row")
+	}
+	return z, x, y, nil
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// apiRoot is the path every API version is mounted under.
+	apiRoot = "/api"
+	// currentAPIVersion is the version served by the deprecated unversioned /api/* aliases.
+	currentAPIVersion = "v1"
+)
+
+// apiVersion is one stable version of the API contract. Adding a version means
+// appending here with its own route table; existing versions keep their routes
+// untouched so clients built against them keep working.
+type apiVersion struct {
+	Name   string
+	Routes []route
+}
+
+// prefix returns the path the version is mounted under, e.g. /api/v1.
+func (v apiVersion) prefix() string {
+	return apiRoot + "/" + v.Name
+}
+
+// apiVersions returns every API version served by the handler.
+func (h *Handler) apiVersions() []apiVersion {
+	return []apiVersion{
+		{Name: "v1", Routes: h.routesV1()},
+	}
+}
+
+// mountAPIVersion registers a version's routes, its OpenAPI document and
+// Swagger UI under prefix. Every handler is wrapped with wrap outside the usual middleware.
+func (h *Handler) mountAPIVersion(mux *http.ServeMux, prefix string, v apiVersion, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	doc := buildOpenAPI(v, prefix)
+	mux.HandleFunc("GET "+prefix+"/openapi.json", wrap(h.api(func(w http.ResponseWriter, r *http.Request) {
+		if base := basePath(r.Context()); base != "" {
+			writeJSON(w, withServerURL(doc, base+prefix))
+			return
+		}
+		writeJSON(w, doc)
+	})))
+	mux.HandleFunc("GET "+prefix+"/docs", wrap(h.withLogging(h.handleDocs)))
+
+	// Endpoints that scan historical snapshots require an API key when keys are enabled
+	for _, rt := range v.Routes {
+		pattern := rt.Method + " " + prefix + rt.Path
+		handler := h.withLoadLimit(rt.Load, withTimeout(rt.Timeout, rt.Handler))
+		switch {
+		case rt.Stream:
+			// Uncompressed, so the byte ranges served are of the body as sent
+			stream := h.withLoadLimit(rt.Load, withStreamTimeout(rt.Timeout, rt.Handler))
+			if rt.Access == accessProtected {
+				stream = h.withAPIKey(stream)
+			}
+			mux.HandleFunc(pattern, wrap(h.withLogging(h.withIPRateLimit(stream))))
+		case rt.Access == accessProtected:
+			mux.HandleFunc(pattern, wrap(h.protected(handler)))
+		default:
+			mux.HandleFunc(pattern, wrap(h.api(handler)))
+		}
+	}
+}
+
+// registerAPI mounts every API version, plus the current version's routes at
+// the unversioned /api/* paths as deprecated aliases. A non-empty mount (e.g.
+// /manchester) nests the routes under each prefix for one city.
+func (h *Handler) registerAPI(mux *http.ServeMux, mount string) {
+	noWrap := func(next http.HandlerFunc) http.HandlerFunc { return next }
+
+	for _, v := range h.apiVersions() {
+		h.mountAPIVersion(mux, v.prefix()+mount, v, noWrap)
+		if v.Name == currentAPIVersion {
+			h.mountAPIVersion(mux, apiRoot+mount, v, withDeprecation(v.prefix()))
+		}
+	}
+}
+
+// withDeprecation marks responses from an unversioned alias as deprecated
+// (RFC 9745) and links to the same resource under successorPrefix.
+func withDeprecation(successorPrefix string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			successor := basePath(r.Context()) + successorPrefix + strings.TrimPrefix(r.URL.Path, apiRoot)
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+			next(w, r)
+		}
+	}
+}